@@ -13,17 +13,18 @@ import (
 
 func GetAnnotations(c *models.ReqContext) response.Response {
 	query := &annotations.ItemQuery{
-		From:        c.QueryInt64("from"),
-		To:          c.QueryInt64("to"),
-		OrgId:       c.OrgId,
-		UserId:      c.QueryInt64("userId"),
-		AlertId:     c.QueryInt64("alertId"),
-		DashboardId: c.QueryInt64("dashboardId"),
-		PanelId:     c.QueryInt64("panelId"),
-		Limit:       c.QueryInt64("limit"),
-		Tags:        c.QueryStrings("tags"),
-		Type:        c.Query("type"),
-		MatchAny:    c.QueryBool("matchAny"),
+		From:             c.QueryInt64("from"),
+		To:               c.QueryInt64("to"),
+		OrgId:            c.OrgId,
+		UserId:           c.QueryInt64("userId"),
+		AlertId:          c.QueryInt64("alertId"),
+		DashboardId:      c.QueryInt64("dashboardId"),
+		PanelId:          c.QueryInt64("panelId"),
+		Limit:            c.QueryInt64("limit"),
+		LibraryPanelUids: c.QueryStrings("libraryPanelUid"),
+		Tags:             c.QueryStrings("tags"),
+		Type:             c.Query("type"),
+		MatchAny:         c.QueryBool("matchAny"),
 	}
 
 	repo := annotations.GetRepository()
@@ -63,15 +64,16 @@ func PostAnnotation(c *models.ReqContext, cmd dtos.PostAnnotationsCmd) response.
 	}
 
 	item := annotations.Item{
-		OrgId:       c.OrgId,
-		UserId:      c.UserId,
-		DashboardId: cmd.DashboardId,
-		PanelId:     cmd.PanelId,
-		Epoch:       cmd.Time,
-		EpochEnd:    cmd.TimeEnd,
-		Text:        cmd.Text,
-		Data:        cmd.Data,
-		Tags:        cmd.Tags,
+		OrgId:           c.OrgId,
+		UserId:          c.UserId,
+		DashboardId:     cmd.DashboardId,
+		PanelId:         cmd.PanelId,
+		LibraryPanelUid: cmd.LibraryPanelUid,
+		Epoch:           cmd.Time,
+		EpochEnd:        cmd.TimeEnd,
+		Text:            cmd.Text,
+		Data:            cmd.Data,
+		Tags:            cmd.Tags,
 	}
 
 	if err := repo.Save(&item); err != nil {
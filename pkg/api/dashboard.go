@@ -19,6 +19,7 @@ import (
 	"github.com/grafana/grafana/pkg/infra/metrics"
 	"github.com/grafana/grafana/pkg/plugins"
 	"github.com/grafana/grafana/pkg/services/guardian"
+	"github.com/grafana/grafana/pkg/services/librarypanels"
 	"github.com/grafana/grafana/pkg/util"
 )
 
@@ -144,6 +145,14 @@ func (hs *HTTPServer) GetDashboard(c *models.ReqContext) response.Response {
 		}
 	}
 
+	if hs.Cfg.IsPanelLibraryEnabled() {
+		// load library panels JSON for this dashboard, the frontend loads the library panels that couldn't be
+		// resolved itself, so a failure doesn't prevent the dashboard from loading
+		if err := hs.LibraryPanelService.LoadLibraryPanelsForDashboard(c, dash); err != nil {
+			hs.log.Warn("Failed to load library panels for dashboard", "dashboardUid", dash.Uid, "error", err)
+		}
+	}
+
 	// make sure db version is in sync with json model version
 	dash.Data.Set("version", dash.Version)
 
@@ -246,6 +255,23 @@ func (hs *HTTPServer) PostDashboard(c *models.ReqContext, cmd models.SaveDashboa
 		}
 	}
 
+	var missingLibraryPanels []string
+	if hs.Cfg.IsPanelLibraryEnabled() {
+		var err error
+		missingLibraryPanels, err = hs.LibraryPanelService.ValidateLibraryPanelsForDashboard(c, dash)
+		var missingErr *librarypanels.MissingLibraryPanelsError
+		if errors.As(err, &missingErr) {
+			return response.JSON(400, util.DynMap{
+				"status":               "library-panel-not-found",
+				"message":              err.Error(),
+				"missingLibraryPanels": missingErr.UIDs,
+			})
+		}
+		if err != nil {
+			return response.Error(500, "Error while validating library panels", err)
+		}
+	}
+
 	provisioningData, err := dashboards.NewProvisioningService().GetProvisionedDashboardDataByDashboardID(dash.Id)
 	if err != nil {
 		return response.Error(500, "Error while checking if dashboard is provisioned", err)
@@ -289,14 +315,18 @@ func (hs *HTTPServer) PostDashboard(c *models.ReqContext, cmd models.SaveDashboa
 	}
 
 	c.TimeRequest(metrics.MApiDashboardSave)
-	return response.JSON(200, util.DynMap{
+	result := util.DynMap{
 		"status":  "success",
 		"slug":    dashboard.Slug,
 		"version": dashboard.Version,
 		"id":      dashboard.Id,
 		"uid":     dashboard.Uid,
 		"url":     dashboard.GetUrl(),
-	})
+	}
+	if len(missingLibraryPanels) > 0 {
+		result["missingLibraryPanels"] = missingLibraryPanels
+	}
+	return response.JSON(200, result)
 }
 
 func dashboardSaveErrorToApiResponse(err error) response.Response {
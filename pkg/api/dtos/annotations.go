@@ -3,13 +3,14 @@ package dtos
 import "github.com/grafana/grafana/pkg/components/simplejson"
 
 type PostAnnotationsCmd struct {
-	DashboardId int64            `json:"dashboardId"`
-	PanelId     int64            `json:"panelId"`
-	Time        int64            `json:"time"`
-	TimeEnd     int64            `json:"timeEnd,omitempty"` // Optional
-	Text        string           `json:"text"`
-	Tags        []string         `json:"tags"`
-	Data        *simplejson.Json `json:"data"`
+	DashboardId     int64            `json:"dashboardId"`
+	PanelId         int64            `json:"panelId"`
+	LibraryPanelUid string           `json:"libraryPanelUid"`
+	Time            int64            `json:"time"`
+	TimeEnd         int64            `json:"timeEnd,omitempty"` // Optional
+	Text            string           `json:"text"`
+	Tags            []string         `json:"tags"`
+	Data            *simplejson.Json `json:"data"`
 }
 
 type UpdateAnnotationsCmd struct {
@@ -1,13 +1,15 @@
 package dtos
 
 type Prefs struct {
-	Theme           string `json:"theme"`
-	HomeDashboardID int64  `json:"homeDashboardId"`
-	Timezone        string `json:"timezone"`
+	Theme                string `json:"theme"`
+	HomeDashboardID      int64  `json:"homeDashboardId"`
+	Timezone             string `json:"timezone"`
+	LibraryPanelFolderID int64  `json:"libraryPanelFolderId"`
 }
 
 type UpdatePrefsCmd struct {
-	Theme           string `json:"theme"`
-	HomeDashboardID int64  `json:"homeDashboardId"`
-	Timezone        string `json:"timezone"`
+	Theme                string `json:"theme"`
+	HomeDashboardID      int64  `json:"homeDashboardId"`
+	Timezone             string `json:"timezone"`
+	LibraryPanelFolderID int64  `json:"libraryPanelFolderId"`
 }
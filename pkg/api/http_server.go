@@ -12,6 +12,7 @@ import (
 	"path/filepath"
 	"sync"
 
+	"github.com/grafana/grafana/pkg/services/librarypanels"
 	"github.com/grafana/grafana/pkg/services/live"
 	"github.com/grafana/grafana/pkg/services/search"
 	"github.com/grafana/grafana/pkg/services/shorturls"
@@ -59,26 +60,27 @@ type HTTPServer struct {
 	httpSrv     *http.Server
 	middlewares []macaron.Handler
 
-	RouteRegister        routing.RouteRegister            `inject:""`
-	Bus                  bus.Bus                          `inject:""`
-	RenderService        rendering.Service                `inject:""`
-	Cfg                  *setting.Cfg                     `inject:""`
-	HooksService         *hooks.HooksService              `inject:""`
-	CacheService         *localcache.CacheService         `inject:""`
-	DatasourceCache      datasources.CacheService         `inject:""`
-	AuthTokenService     models.UserTokenService          `inject:""`
-	QuotaService         *quota.QuotaService              `inject:""`
-	RemoteCacheService   *remotecache.RemoteCache         `inject:""`
-	ProvisioningService  provisioning.ProvisioningService `inject:""`
-	Login                *login.LoginService              `inject:""`
-	License              models.Licensing                 `inject:""`
-	BackendPluginManager backendplugin.Manager            `inject:""`
-	PluginManager        *plugins.PluginManager           `inject:""`
-	SearchService        *search.SearchService            `inject:""`
-	ShortURLService      *shorturls.ShortURLService       `inject:""`
-	Live                 *live.GrafanaLive                `inject:""`
-	ContextHandler       *contexthandler.ContextHandler   `inject:""`
-	SQLStore             *sqlstore.SQLStore               `inject:""`
+	RouteRegister        routing.RouteRegister              `inject:""`
+	Bus                  bus.Bus                            `inject:""`
+	RenderService        rendering.Service                  `inject:""`
+	Cfg                  *setting.Cfg                       `inject:""`
+	HooksService         *hooks.HooksService                `inject:""`
+	CacheService         *localcache.CacheService           `inject:""`
+	DatasourceCache      datasources.CacheService           `inject:""`
+	AuthTokenService     models.UserTokenService            `inject:""`
+	QuotaService         *quota.QuotaService                `inject:""`
+	RemoteCacheService   *remotecache.RemoteCache           `inject:""`
+	ProvisioningService  provisioning.ProvisioningService   `inject:""`
+	Login                *login.LoginService                `inject:""`
+	License              models.Licensing                   `inject:""`
+	BackendPluginManager backendplugin.Manager              `inject:""`
+	PluginManager        *plugins.PluginManager             `inject:""`
+	SearchService        *search.SearchService              `inject:""`
+	ShortURLService      *shorturls.ShortURLService         `inject:""`
+	Live                 *live.GrafanaLive                  `inject:""`
+	ContextHandler       *contexthandler.ContextHandler     `inject:""`
+	SQLStore             *sqlstore.SQLStore                 `inject:""`
+	LibraryPanelService  *librarypanels.LibraryPanelService `inject:""`
 	Listener             net.Listener
 }
 
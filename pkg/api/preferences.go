@@ -32,9 +32,10 @@ func getPreferencesFor(orgID, userID, teamID int64) response.Response {
 	}
 
 	dto := dtos.Prefs{
-		Theme:           prefsQuery.Result.Theme,
-		HomeDashboardID: prefsQuery.Result.HomeDashboardId,
-		Timezone:        prefsQuery.Result.Timezone,
+		Theme:                prefsQuery.Result.Theme,
+		HomeDashboardID:      prefsQuery.Result.HomeDashboardId,
+		Timezone:             prefsQuery.Result.Timezone,
+		LibraryPanelFolderID: prefsQuery.Result.LibraryPanelFolderId,
 	}
 
 	return response.JSON(200, &dto)
@@ -47,12 +48,13 @@ func UpdateUserPreferences(c *models.ReqContext, dtoCmd dtos.UpdatePrefsCmd) res
 
 func updatePreferencesFor(orgID, userID, teamId int64, dtoCmd *dtos.UpdatePrefsCmd) response.Response {
 	saveCmd := models.SavePreferencesCommand{
-		UserId:          userID,
-		OrgId:           orgID,
-		TeamId:          teamId,
-		Theme:           dtoCmd.Theme,
-		Timezone:        dtoCmd.Timezone,
-		HomeDashboardId: dtoCmd.HomeDashboardID,
+		UserId:               userID,
+		OrgId:                orgID,
+		TeamId:               teamId,
+		Theme:                dtoCmd.Theme,
+		Timezone:             dtoCmd.Timezone,
+		HomeDashboardId:      dtoCmd.HomeDashboardID,
+		LibraryPanelFolderId: dtoCmd.LibraryPanelFolderID,
 	}
 
 	if err := bus.Dispatch(&saveCmd); err != nil {
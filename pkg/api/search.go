@@ -60,6 +60,8 @@ func Search(c *models.ReqContext) response.Response {
 		FolderIds:    folderIDs,
 		Permission:   permission,
 		Sort:         sort,
+
+		LibraryPanelUID: c.Query("libraryPanelUid"),
 	}
 
 	err := bus.Dispatch(&searchQuery)
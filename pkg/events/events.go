@@ -27,6 +27,13 @@ type UserCreated struct {
 	Email     string    `json:"email"`
 }
 
+type UserDeleted struct {
+	Timestamp time.Time `json:"timestamp"`
+	Id        int64     `json:"id"`
+	Login     string    `json:"login"`
+	Email     string    `json:"email"`
+}
+
 type SignUpStarted struct {
 	Timestamp time.Time `json:"timestamp"`
 	Email     string    `json:"email"`
@@ -46,3 +53,9 @@ type UserUpdated struct {
 	Login     string    `json:"login"`
 	Email     string    `json:"email"`
 }
+
+type DashboardAlertsSaved struct {
+	Timestamp   time.Time `json:"timestamp"`
+	OrgId       int64     `json:"orgId"`
+	DashboardId int64     `json:"dashboardId"`
+}
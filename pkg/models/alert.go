@@ -224,3 +224,11 @@ type ValidateDashboardAlertsCommand struct {
 	Dashboard *Dashboard
 	User      *SignedInUser
 }
+
+// ResolveLibraryQueriesCommand replaces the queries in the dashboard JSON that reference a library query with
+// the stored library query, so that alerts are extracted from the queries the panels run. It is handled by the
+// library panels service, if enabled.
+type ResolveLibraryQueriesCommand struct {
+	OrgId     int64
+	Dashboard *simplejson.Json
+}
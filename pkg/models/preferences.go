@@ -15,6 +15,9 @@ type Preferences struct {
 	Theme           string
 	Created         time.Time
 	Updated         time.Time
+
+	// LibraryPanelFolderId is the default folder of new library panels, it is only used in org preferences.
+	LibraryPanelFolderId int64
 }
 
 // ---------------------
@@ -42,7 +45,8 @@ type SavePreferencesCommand struct {
 	OrgId  int64
 	TeamId int64
 
-	HomeDashboardId int64  `json:"homeDashboardId"`
-	Timezone        string `json:"timezone"`
-	Theme           string `json:"theme"`
+	HomeDashboardId      int64  `json:"homeDashboardId"`
+	Timezone             string `json:"timezone"`
+	Theme                string `json:"theme"`
+	LibraryPanelFolderId int64  `json:"libraryPanelFolderId"`
 }
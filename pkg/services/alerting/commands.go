@@ -1,7 +1,10 @@
 package alerting
 
 import (
+	"time"
+
 	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/events"
 	"github.com/grafana/grafana/pkg/models"
 )
 
@@ -32,5 +35,13 @@ func updateDashboardAlerts(cmd *models.UpdateDashboardAlertsCommand) error {
 
 	saveAlerts.Alerts = alerts
 
-	return bus.Dispatch(&saveAlerts)
+	if err := bus.Dispatch(&saveAlerts); err != nil {
+		return err
+	}
+
+	return bus.Publish(&events.DashboardAlertsSaved{
+		Timestamp:   time.Now(),
+		OrgId:       cmd.OrgId,
+		DashboardId: cmd.Dashboard.Id,
+	})
 }
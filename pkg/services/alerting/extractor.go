@@ -210,6 +210,10 @@ func (e *DashAlertExtractor) extractAlerts(validateFunc func(alert *models.Alert
 	if err != nil {
 		return nil, err
 	}
+	resolveCmd := models.ResolveLibraryQueriesCommand{OrgId: e.OrgID, Dashboard: dashboardJSON}
+	if err := bus.Dispatch(&resolveCmd); err != nil && !errors.Is(err, bus.ErrHandlerNotFound) {
+		return nil, err
+	}
 
 	alerts := make([]*models.Alert, 0)
 
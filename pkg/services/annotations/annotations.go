@@ -20,17 +20,18 @@ type AnnotationCleaner interface {
 }
 
 type ItemQuery struct {
-	OrgId        int64    `json:"orgId"`
-	From         int64    `json:"from"`
-	To           int64    `json:"to"`
-	UserId       int64    `json:"userId"`
-	AlertId      int64    `json:"alertId"`
-	DashboardId  int64    `json:"dashboardId"`
-	PanelId      int64    `json:"panelId"`
-	AnnotationId int64    `json:"annotationId"`
-	Tags         []string `json:"tags"`
-	Type         string   `json:"type"`
-	MatchAny     bool     `json:"matchAny"`
+	OrgId            int64    `json:"orgId"`
+	From             int64    `json:"from"`
+	To               int64    `json:"to"`
+	UserId           int64    `json:"userId"`
+	AlertId          int64    `json:"alertId"`
+	DashboardId      int64    `json:"dashboardId"`
+	PanelId          int64    `json:"panelId"`
+	AnnotationId     int64    `json:"annotationId"`
+	LibraryPanelUids []string `json:"libraryPanelUids"`
+	Tags             []string `json:"tags"`
+	Type             string   `json:"type"`
+	MatchAny         bool     `json:"matchAny"`
 
 	Limit int64 `json:"limit"`
 }
@@ -63,21 +64,22 @@ func SetRepository(rep Repository) {
 }
 
 type Item struct {
-	Id          int64            `json:"id"`
-	OrgId       int64            `json:"orgId"`
-	UserId      int64            `json:"userId"`
-	DashboardId int64            `json:"dashboardId"`
-	PanelId     int64            `json:"panelId"`
-	Text        string           `json:"text"`
-	AlertId     int64            `json:"alertId"`
-	PrevState   string           `json:"prevState"`
-	NewState    string           `json:"newState"`
-	Epoch       int64            `json:"epoch"`
-	EpochEnd    int64            `json:"epochEnd"`
-	Created     int64            `json:"created"`
-	Updated     int64            `json:"updated"`
-	Tags        []string         `json:"tags"`
-	Data        *simplejson.Json `json:"data"`
+	Id              int64            `json:"id"`
+	OrgId           int64            `json:"orgId"`
+	UserId          int64            `json:"userId"`
+	DashboardId     int64            `json:"dashboardId"`
+	PanelId         int64            `json:"panelId"`
+	Text            string           `json:"text"`
+	AlertId         int64            `json:"alertId"`
+	LibraryPanelUid string           `json:"libraryPanelUid"`
+	PrevState       string           `json:"prevState"`
+	NewState        string           `json:"newState"`
+	Epoch           int64            `json:"epoch"`
+	EpochEnd        int64            `json:"epochEnd"`
+	Created         int64            `json:"created"`
+	Updated         int64            `json:"updated"`
+	Tags            []string         `json:"tags"`
+	Data            *simplejson.Json `json:"data"`
 
 	// needed until we remove it from db
 	Type  string
@@ -89,22 +91,23 @@ func (i Item) TableName() string {
 }
 
 type ItemDTO struct {
-	Id          int64            `json:"id"`
-	AlertId     int64            `json:"alertId"`
-	AlertName   string           `json:"alertName"`
-	DashboardId int64            `json:"dashboardId"`
-	PanelId     int64            `json:"panelId"`
-	UserId      int64            `json:"userId"`
-	NewState    string           `json:"newState"`
-	PrevState   string           `json:"prevState"`
-	Created     int64            `json:"created"`
-	Updated     int64            `json:"updated"`
-	Time        int64            `json:"time"`
-	TimeEnd     int64            `json:"timeEnd"`
-	Text        string           `json:"text"`
-	Tags        []string         `json:"tags"`
-	Login       string           `json:"login"`
-	Email       string           `json:"email"`
-	AvatarUrl   string           `json:"avatarUrl"`
-	Data        *simplejson.Json `json:"data"`
+	Id              int64            `json:"id"`
+	AlertId         int64            `json:"alertId"`
+	AlertName       string           `json:"alertName"`
+	DashboardId     int64            `json:"dashboardId"`
+	PanelId         int64            `json:"panelId"`
+	UserId          int64            `json:"userId"`
+	NewState        string           `json:"newState"`
+	LibraryPanelUid string           `json:"libraryPanelUid"`
+	PrevState       string           `json:"prevState"`
+	Created         int64            `json:"created"`
+	Updated         int64            `json:"updated"`
+	Time            int64            `json:"time"`
+	TimeEnd         int64            `json:"timeEnd"`
+	Text            string           `json:"text"`
+	Tags            []string         `json:"tags"`
+	Login           string           `json:"login"`
+	Email           string           `json:"email"`
+	AvatarUrl       string           `json:"avatarUrl"`
+	Data            *simplejson.Json `json:"data"`
 }
@@ -0,0 +1,138 @@
+package librarypanels
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/grafana/grafana/pkg/events"
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/sqlstore"
+)
+
+// libraryPanelAlert is an alert rule of a dashboard panel that uses a Library Panel.
+type libraryPanelAlert struct {
+	ID             int64 `xorm:"pk autoincr 'id'"`
+	LibraryPanelID int64 `xorm:"librarypanel_id"`
+	AlertID        int64 `xorm:"alert_id"`
+	DashboardID    int64 `xorm:"dashboard_id"`
+	PanelID        int64 `xorm:"panel_id"`
+}
+
+// libraryPanelAlertRule is an alert rule created from a Library Panel.
+type libraryPanelAlertRule struct {
+	ID           int64  `json:"id" xorm:"id"`
+	Name         string `json:"name"`
+	State        string `json:"state"`
+	DashboardID  int64  `json:"dashboardId" xorm:"dashboard_id"`
+	DashboardUID string `json:"dashboardUid" xorm:"dashboard_uid"`
+	PanelID      int64  `json:"panelId" xorm:"panel_id"`
+}
+
+// libraryPanelMeta is the information about a Library Panel that isn't part of the Library Panel itself.
+type libraryPanelMeta struct {
+	Alerts []libraryPanelAlertRule `json:"alerts"`
+}
+
+// handleDashboardAlertsSaved records which of the alert rules of a saved dashboard were created from panels
+// using a Library Panel.
+func (lps *LibraryPanelService) handleDashboardAlertsSaved(event *events.DashboardAlertsSaved) error {
+	return lps.SQLStore.WithTransactionalDbSession(context.Background(), func(session *sqlstore.DBSession) error {
+		if _, err := session.Exec("DELETE FROM library_panel_alert WHERE dashboard_id=?", event.DashboardId); err != nil {
+			return err
+		}
+
+		dashboard := models.Dashboard{Id: event.DashboardId, OrgId: event.OrgId}
+		if has, err := session.Get(&dashboard); err != nil || !has {
+			return err
+		}
+		uids := map[int64]string{}
+		for uid, panels := range getLibraryPanelReferences(dashboard.Data) {
+			for _, panel := range panels {
+				uids[panel.Get("id").MustInt64()] = uid
+			}
+		}
+		if len(uids) == 0 {
+			return nil
+		}
+
+		var alerts []models.Alert
+		if err := session.Table("alert").Where("org_id=? AND dashboard_id=?", event.OrgId, event.DashboardId).
+			Cols("id", "panel_id").Find(&alerts); err != nil {
+			return err
+		}
+		references := make([]string, 0, len(alerts))
+		for _, alert := range alerts {
+			if uid, ok := uids[alert.PanelId]; ok {
+				references = append(references, uid)
+			}
+		}
+		if len(references) == 0 {
+			return nil
+		}
+		var libraryPanels []LibraryPanel
+		if err := session.Table("library_panel").Where("org_id=? AND kind=?", event.OrgId, panelElement).
+			In("uid", references).Cols("id", "uid").Find(&libraryPanels); err != nil {
+			return err
+		}
+		ids := make(map[string]int64, len(libraryPanels))
+		for _, libraryPanel := range libraryPanels {
+			ids[libraryPanel.UID] = libraryPanel.ID
+		}
+
+		for _, alert := range alerts {
+			id, ok := ids[uids[alert.PanelId]]
+			if !ok {
+				continue
+			}
+			if _, err := session.Insert(&libraryPanelAlert{
+				LibraryPanelID: id,
+				AlertID:        alert.Id,
+				DashboardID:    event.DashboardId,
+				PanelID:        alert.PanelId,
+			}); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// getDerivedAlertRules gets the alert rules created from a Library Panel. Rules of deleted alerts are skipped,
+// they are only removed when their dashboard is saved again.
+func getDerivedAlertRules(session *sqlstore.DBSession, libraryPanelID int64) ([]libraryPanelAlertRule, error) {
+	rules := make([]libraryPanelAlertRule, 0)
+	err := session.SQL(`SELECT alert.id, alert.name, alert.state, alert.dashboard_id, dashboard.uid AS dashboard_uid, alert.panel_id
+		FROM library_panel_alert
+		INNER JOIN alert ON alert.id = library_panel_alert.alert_id
+		INNER JOIN dashboard ON dashboard.id = alert.dashboard_id
+		WHERE library_panel_alert.librarypanel_id=?
+		ORDER BY alert.name ASC`, libraryPanelID).Find(&rules)
+
+	return rules, err
+}
+
+// getLibraryPanelMeta gets the alert rules created from a Library Panel.
+func (lps *LibraryPanelService) getLibraryPanelMeta(libraryPanel LibraryPanel) (*libraryPanelMeta, error) {
+	meta := &libraryPanelMeta{}
+	err := lps.SQLStore.WithReadReplicaDbSession(context.Background(), func(session *sqlstore.DBSession) error {
+		var err error
+		meta.Alerts, err = getDerivedAlertRules(session, libraryPanel.ID)
+		return err
+	})
+
+	return meta, err
+}
+
+// checkNoDerivedAlertRules fails if alert rules were created from the Library Panel.
+func checkNoDerivedAlertRules(session *sqlstore.DBSession, libraryPanelID int64) error {
+	rules, err := getDerivedAlertRules(session, libraryPanelID)
+	if err != nil {
+		return err
+	}
+	if len(rules) > 0 {
+		return fmt.Errorf("%w: %d alert rules", errLibraryPanelHasAlertRules, len(rules))
+	}
+
+	return nil
+}
@@ -2,6 +2,8 @@ package librarypanels
 
 import (
 	"errors"
+	"strings"
+	"time"
 
 	"github.com/go-macaron/binding"
 	"github.com/grafana/grafana/pkg/api/response"
@@ -17,37 +19,148 @@ func (lps *LibraryPanelService) registerAPIEndpoints() {
 	}
 
 	lps.RouteRegister.Group("/api/library-panels", func(libraryPanels routing.RouteRegister) {
-		libraryPanels.Post("/", middleware.ReqSignedIn, binding.Bind(createLibraryPanelCommand{}), routing.Wrap(lps.createHandler))
-		libraryPanels.Post("/:uid/dashboards/:dashboardId", middleware.ReqSignedIn, routing.Wrap(lps.connectHandler))
+		libraryPanels.Post("/", middleware.ReqSignedIn, lps.rateLimit, lps.limitRequestSize, binding.Bind(createLibraryPanelCommand{}), routing.Wrap(lps.createHandler))
+		libraryPanels.Post("/validate", middleware.ReqSignedIn, lps.limitRequestSize, binding.Bind(validateLibraryPanelCommand{}), routing.Wrap(lps.validateHandler))
+		libraryPanels.Post("/:uid/dashboards/:dashboardId", middleware.ReqSignedIn, lps.rateLimit, routing.Wrap(lps.connectHandler))
 		libraryPanels.Delete("/:uid", middleware.ReqSignedIn, routing.Wrap(lps.deleteHandler))
 		libraryPanels.Delete("/:uid/dashboards/:dashboardId", middleware.ReqSignedIn, routing.Wrap(lps.disconnectHandler))
 		libraryPanels.Get("/", middleware.ReqSignedIn, routing.Wrap(lps.getAllHandler))
+		libraryPanels.Get("/search", middleware.ReqSignedIn, routing.Wrap(lps.searchHandler))
+		libraryPanels.Get("/suggest", middleware.ReqSignedIn, routing.Wrap(lps.suggestHandler))
+		libraryPanels.Get("/name-exists", middleware.ReqSignedIn, routing.Wrap(lps.nameExistsHandler))
+		libraryPanels.Get("/export", middleware.ReqSignedIn, routing.Wrap(lps.exportHandler))
+		libraryPanels.Get("/feed", middleware.ReqSignedIn, routing.Wrap(lps.feedHandler))
+		libraryPanels.Post("/tags/add", middleware.ReqEditorRole, lps.rateLimit, binding.Bind(bulkTagCommand{}), routing.Wrap(lps.addTagHandler))
+		libraryPanels.Post("/tags/remove", middleware.ReqEditorRole, lps.rateLimit, binding.Bind(bulkTagCommand{}), routing.Wrap(lps.removeTagHandler))
+		libraryPanels.Post("/templates/instantiate", middleware.ReqSignedIn, lps.rateLimit, lps.limitRequestSize, binding.Bind(instantiateTemplateCommand{}), routing.Wrap(lps.instantiateTemplateHandler))
+		libraryPanels.Get("/usage", middleware.ReqOrgAdmin, routing.Wrap(lps.getUsageReportHandler))
+		libraryPanels.Get("/queries/usage", middleware.ReqOrgAdmin, routing.Wrap(lps.getQueryUsageReportHandler))
+		libraryPanels.Get("/stats", middleware.ReqOrgAdmin, routing.Wrap(lps.getStatsHandler))
+		libraryPanels.Get("/connections", middleware.ReqOrgAdmin, routing.Wrap(lps.getAllConnectionsHandler))
+		libraryPanels.Get("/datasources/:datasourceUid", middleware.ReqSignedIn, routing.Wrap(lps.getByDatasourceHandler))
+		libraryPanels.Post("/datasources/rewrite", middleware.ReqOrgAdmin, binding.Bind(rewriteDatasourceCommand{}), routing.Wrap(lps.rewriteDatasourceHandler))
+		libraryPanels.Get("/unused", middleware.ReqOrgAdmin, routing.Wrap(lps.getUnusedHandler))
+		libraryPanels.Get("/deprecated/dashboards", middleware.ReqSignedIn, routing.Wrap(lps.getDeprecatedConnectionsHandler))
+		libraryPanels.Get("/cleanup-policy", middleware.ReqOrgAdmin, routing.Wrap(lps.getCleanupPolicyHandler))
+		libraryPanels.Put("/cleanup-policy", middleware.ReqOrgAdmin, binding.Bind(updateCleanupPolicyCommand{}), routing.Wrap(lps.updateCleanupPolicyHandler))
+		libraryPanels.Get("/variable-defaults", middleware.ReqOrgAdmin, routing.Wrap(lps.getVariableDefaultsHandler))
+		libraryPanels.Put("/variable-defaults", middleware.ReqOrgAdmin, binding.Bind(updateVariableDefaultsCommand{}), routing.Wrap(lps.updateVariableDefaultsHandler))
+		libraryPanels.Get("/api-keys", middleware.ReqOrgAdmin, routing.Wrap(lps.getAPIKeyAccessesHandler))
+		libraryPanels.Put("/api-keys/:id", middleware.ReqOrgAdmin, binding.Bind(setAPIKeyAccessCommand{}), routing.Wrap(lps.setAPIKeyAccessHandler))
+		libraryPanels.Delete("/api-keys/:id", middleware.ReqOrgAdmin, routing.Wrap(lps.deleteAPIKeyAccessHandler))
+		libraryPanels.Get("/missing-authors", middleware.ReqOrgAdmin, routing.Wrap(lps.getMissingAuthorsHandler))
+		libraryPanels.Get("/unowned", middleware.ReqOrgAdmin, routing.Wrap(lps.getUnownedHandler))
+		libraryPanels.Get("/duplicates", middleware.ReqOrgAdmin, routing.Wrap(lps.getDuplicatesHandler))
+		libraryPanels.Post("/duplicates/check", middleware.ReqOrgAdmin, routing.Wrap(lps.checkDuplicatesHandler))
+		libraryPanels.Post("/merge", middleware.ReqOrgAdmin, binding.Bind(mergeLibraryPanelsCommand{}), routing.Wrap(lps.mergeHandler))
+		libraryPanels.Get("/broken-references", middleware.ReqOrgAdmin, routing.Wrap(lps.getBrokenReferencesHandler))
+		libraryPanels.Post("/broken-references/repair", middleware.ReqOrgAdmin, binding.Bind(repairBrokenReferencesCommand{}), routing.Wrap(lps.repairBrokenReferencesHandler))
+		libraryPanels.Get("/backups", middleware.ReqGrafanaAdmin, routing.Wrap(lps.getBackupsHandler))
+		libraryPanels.Post("/backups/:name/restore", middleware.ReqGrafanaAdmin, routing.Wrap(lps.restoreBackupHandler))
+		libraryPanels.Post("/backups/:name/restore/:uid", middleware.ReqGrafanaAdmin, routing.Wrap(lps.restoreBackupPanelHandler))
+		libraryPanels.Post("/versions/cleanup", middleware.ReqGrafanaAdmin, routing.Wrap(lps.cleanupVersionsHandler))
+		libraryPanels.Post("/transfer-ownership", middleware.ReqGrafanaAdmin, binding.Bind(transferOwnershipCommand{}), routing.Wrap(lps.transferOwnershipHandler))
+		libraryPanels.Get("/pending-changes", middleware.ReqOrgAdmin, routing.Wrap(lps.getPendingChangesHandler))
+		libraryPanels.Post("/pending-changes/:id/approve", middleware.ReqOrgAdmin, routing.Wrap(lps.approvePendingChangeHandler))
+		libraryPanels.Post("/pending-changes/:id/reject", middleware.ReqOrgAdmin, routing.Wrap(lps.rejectPendingChangeHandler))
+		libraryPanels.Get("/git-sync", middleware.ReqOrgAdmin, routing.Wrap(lps.getGitSyncHandler))
+		libraryPanels.Put("/git-sync", middleware.ReqOrgAdmin, binding.Bind(updateGitSyncCommand{}), routing.Wrap(lps.updateGitSyncHandler))
+		libraryPanels.Post("/git-sync/run", middleware.ReqOrgAdmin, routing.Wrap(lps.runGitSyncHandler))
+		libraryPanels.Get("/catalog", middleware.ReqOrgAdmin, routing.Wrap(lps.getAllCatalogPanelsHandler))
+		libraryPanels.Post("/catalog", middleware.ReqGrafanaAdmin, lps.limitRequestSize, binding.Bind(saveCatalogPanelCommand{}), routing.Wrap(lps.createCatalogPanelHandler))
+		libraryPanels.Get("/catalog/:uid", middleware.ReqOrgAdmin, routing.Wrap(lps.getCatalogPanelHandler))
+		libraryPanels.Put("/catalog/:uid", middleware.ReqGrafanaAdmin, lps.limitRequestSize, binding.Bind(saveCatalogPanelCommand{}), routing.Wrap(lps.updateCatalogPanelHandler))
+		libraryPanels.Delete("/catalog/:uid", middleware.ReqGrafanaAdmin, routing.Wrap(lps.deleteCatalogPanelHandler))
+		libraryPanels.Post("/catalog/:uid/install", middleware.ReqOrgAdmin, binding.Bind(installCatalogPanelCommand{}), routing.Wrap(lps.installCatalogPanelHandler))
+		libraryPanels.Get("/community", middleware.ReqOrgAdmin, routing.Wrap(lps.searchCommunityPanelsHandler))
+		libraryPanels.Post("/community/:slug/install", middleware.ReqOrgAdmin, lps.rateLimit, binding.Bind(installCommunityPanelCommand{}), routing.Wrap(lps.installCommunityPanelHandler))
+		libraryPanels.Get("/collections", middleware.ReqSignedIn, routing.Wrap(lps.getAllCollectionsHandler))
+		libraryPanels.Post("/collections", middleware.ReqEditorRole, binding.Bind(saveCollectionCommand{}), routing.Wrap(lps.createCollectionHandler))
+		libraryPanels.Get("/collections/:uid", middleware.ReqSignedIn, routing.Wrap(lps.getCollectionHandler))
+		libraryPanels.Put("/collections/:uid", middleware.ReqEditorRole, binding.Bind(saveCollectionCommand{}), routing.Wrap(lps.updateCollectionHandler))
+		libraryPanels.Delete("/collections/:uid", middleware.ReqEditorRole, routing.Wrap(lps.deleteCollectionHandler))
+		libraryPanels.Post("/collections/:uid/library-panels/:libraryPanelUid", middleware.ReqEditorRole, routing.Wrap(lps.addCollectionLibraryPanelHandler))
+		libraryPanels.Delete("/collections/:uid/library-panels/:libraryPanelUid", middleware.ReqEditorRole, routing.Wrap(lps.removeCollectionLibraryPanelHandler))
+		libraryPanels.Post("/collections/:uid/dashboards/:dashboardId", middleware.ReqSignedIn, routing.Wrap(lps.addCollectionToDashboardHandler))
+		libraryPanels.Get("/notifications", middleware.ReqSignedIn, routing.Wrap(lps.getNotificationsHandler))
+		libraryPanels.Post("/notifications/:id/seen", middleware.ReqSignedIn, routing.Wrap(lps.markNotificationSeenHandler))
+		libraryPanels.Get("/notifications/mutes", middleware.ReqSignedIn, routing.Wrap(lps.getNotificationMutesHandler))
+		libraryPanels.Post("/notifications/mutes", middleware.ReqSignedIn, routing.Wrap(lps.muteAllHandler))
+		libraryPanels.Delete("/notifications/mutes", middleware.ReqSignedIn, routing.Wrap(lps.unmuteAllHandler))
 		libraryPanels.Get("/:uid", middleware.ReqSignedIn, routing.Wrap(lps.getHandler))
 		libraryPanels.Get("/:uid/dashboards/", middleware.ReqSignedIn, routing.Wrap(lps.getConnectedDashboardsHandler))
-		libraryPanels.Patch("/:uid", middleware.ReqSignedIn, binding.Bind(patchLibraryPanelCommand{}), routing.Wrap(lps.patchHandler))
-	})
+		libraryPanels.Get("/:uid/connections", middleware.ReqSignedIn, routing.Wrap(lps.getConnectionsHandler))
+		libraryPanels.Get("/:uid/thumbnail", middleware.ReqSignedIn, routing.Wrap(lps.getThumbnailHandler))
+		libraryPanels.Get("/:uid/dependencies", middleware.ReqSignedIn, routing.Wrap(lps.getDependenciesHandler))
+		libraryPanels.Get("/:uid/versions", middleware.ReqSignedIn, routing.Wrap(lps.getQueryVersionsHandler))
+		libraryPanels.Get("/:uid/template", middleware.ReqSignedIn, routing.Wrap(lps.getTemplateHandler))
+		libraryPanels.Get("/:uid/snippet", middleware.ReqSignedIn, routing.Wrap(lps.getSnippetHandler))
+		libraryPanels.Get("/:uid/community-update", middleware.ReqSignedIn, routing.Wrap(lps.checkCommunityUpdateHandler))
+		libraryPanels.Get("/:uid/replication", middleware.ReqGrafanaAdmin, routing.Wrap(lps.getReplicationHandler))
+		libraryPanels.Put("/:uid/replication", middleware.ReqGrafanaAdmin, binding.Bind(setReplicationCommand{}), routing.Wrap(lps.setReplicationHandler))
+		libraryPanels.Post("/:uid/publish", middleware.ReqEditorRole, routing.Wrap(lps.publishHandler))
+		libraryPanels.Post("/:uid/impact", middleware.ReqEditorRole, lps.limitRequestSize, binding.Bind(analyzeImpactCommand{}), routing.Wrap(lps.analyzeImpactHandler))
+		libraryPanels.Post("/:uid/star", middleware.ReqSignedIn, routing.Wrap(lps.starHandler))
+		libraryPanels.Delete("/:uid/star", middleware.ReqSignedIn, routing.Wrap(lps.unstarHandler))
+		libraryPanels.Post("/:uid/mute", middleware.ReqSignedIn, routing.Wrap(lps.muteHandler))
+		libraryPanels.Delete("/:uid/mute", middleware.ReqSignedIn, routing.Wrap(lps.unmuteHandler))
+		libraryPanels.Get("/:uid/comments", middleware.ReqSignedIn, routing.Wrap(lps.getCommentsHandler))
+		libraryPanels.Post("/:uid/comments", middleware.ReqSignedIn, binding.Bind(addCommentCommand{}), routing.Wrap(lps.addCommentHandler))
+		libraryPanels.Delete("/:uid/comments/:commentId", middleware.ReqSignedIn, routing.Wrap(lps.deleteCommentHandler))
+		libraryPanels.Get("/:uid/edit-suggestions", middleware.ReqSignedIn, routing.Wrap(lps.getEditSuggestionsHandler))
+		libraryPanels.Post("/:uid/edit-suggestions", middleware.ReqSignedIn, lps.rateLimit, lps.limitRequestSize, binding.Bind(suggestEditCommand{}), routing.Wrap(lps.suggestEditHandler))
+		libraryPanels.Post("/:uid/edit-suggestions/:id/apply", middleware.ReqEditorRole, lps.rateLimit, routing.Wrap(lps.applyEditSuggestionHandler))
+		libraryPanels.Post("/:uid/edit-suggestions/:id/reject", middleware.ReqEditorRole, routing.Wrap(lps.rejectEditSuggestionHandler))
+		libraryPanels.Post("/:uid/deprecate", middleware.ReqEditorRole, binding.Bind(deprecateLibraryPanelCommand{}), routing.Wrap(lps.deprecateHandler))
+		libraryPanels.Delete("/:uid/deprecate", middleware.ReqEditorRole, routing.Wrap(lps.undeprecateHandler))
+		libraryPanels.Post("/:uid/pin", middleware.ReqOrgAdmin, routing.Wrap(lps.pinHandler))
+		libraryPanels.Get("/:uid/scheduled-changes", middleware.ReqSignedIn, routing.Wrap(lps.getScheduledChangesHandler))
+		libraryPanels.Delete("/:uid/scheduled-changes/:id", middleware.ReqSignedIn, routing.Wrap(lps.cancelScheduledChangeHandler))
+		libraryPanels.Delete("/:uid/pin", middleware.ReqOrgAdmin, routing.Wrap(lps.unpinHandler))
+		libraryPanels.Get("/:uid/translations", middleware.ReqSignedIn, routing.Wrap(lps.getTranslationsHandler))
+		libraryPanels.Put("/:uid/translations/:locale", middleware.ReqEditorRole, binding.Bind(setLibraryPanelTranslationCommand{}), routing.Wrap(lps.setTranslationHandler))
+		libraryPanels.Delete("/:uid/translations/:locale", middleware.ReqEditorRole, routing.Wrap(lps.deleteTranslationHandler))
+		libraryPanels.Get("/:uid/variant", middleware.ReqSignedIn, routing.Wrap(lps.getVariantHandler))
+		libraryPanels.Put("/:uid/variant", middleware.ReqEditorRole, lps.limitRequestSize, binding.Bind(setLibraryPanelVariantCommand{}), routing.Wrap(lps.setVariantHandler))
+		libraryPanels.Delete("/:uid/variant", middleware.ReqEditorRole, routing.Wrap(lps.deleteVariantHandler))
+		libraryPanels.Patch("/:uid", middleware.ReqSignedIn, lps.rateLimit, lps.limitRequestSize, lps.bindPatchDocument, binding.Bind(patchLibraryPanelCommand{}), routing.Wrap(lps.patchHandler))
+	}, lps.checkAPIKeyAccess)
+
+	lps.RouteRegister.Group("/api/folders/:uid/library-panels", func(folderLibraryPanels routing.RouteRegister) {
+		folderLibraryPanels.Get("/", middleware.ReqSignedIn, routing.Wrap(lps.getAllInFolderHandler))
+		folderLibraryPanels.Post("/", middleware.ReqSignedIn, lps.rateLimit, lps.limitRequestSize, binding.Bind(createLibraryPanelCommand{}), routing.Wrap(lps.createInFolderHandler))
+	}, lps.checkAPIKeyAccess)
 }
 
 // createHandler handles POST /api/library-panels.
 func (lps *LibraryPanelService) createHandler(c *models.ReqContext, cmd createLibraryPanelCommand) response.Response {
 	panel, err := lps.createLibraryPanel(c, cmd)
 	if err != nil {
-		if errors.Is(err, errLibraryPanelAlreadyExists) {
-			return response.Error(400, errLibraryPanelAlreadyExists.Error(), err)
-		}
-		return response.Error(500, "Failed to create library panel", err)
+		return errorResponse(err, "Failed to create library panel")
 	}
+	panel.Fingerprint = libraryPanelFingerprint(panel)
 
 	return response.JSON(200, util.DynMap{"result": panel})
 }
 
+// validateHandler handles POST /api/library-panels/validate.
+func (lps *LibraryPanelService) validateHandler(c *models.ReqContext, cmd validateLibraryPanelCommand) response.Response {
+	if cmd.Kind == 0 {
+		cmd.Kind = panelElement
+	}
+
+	result, err := lps.lintLibraryPanelModel(cmd.Kind, cmd.Model)
+	if err != nil {
+		return errorResponse(err, "Failed to validate library panel model")
+	}
+
+	return response.JSON(200, util.DynMap{"result": result})
+}
+
 // connectHandler handles POST /api/library-panels/:uid/dashboards/:dashboardId.
 func (lps *LibraryPanelService) connectHandler(c *models.ReqContext) response.Response {
-	if err := lps.connectDashboard(c, c.Params(":uid"), c.ParamsInt64(":dashboardId")); err != nil {
-		if errors.Is(err, errLibraryPanelNotFound) {
-			return response.Error(404, errLibraryPanelNotFound.Error(), err)
-		}
-		return response.Error(500, "Failed to connect library panel", err)
+	if err := lps.connectDashboard(c, c.Params(":uid"), c.ParamsInt64(":dashboardId"), c.QueryInt64("panelId")); err != nil {
+		return errorResponse(err, "Failed to connect library panel")
 	}
 
 	return response.Success("Library panel connected")
@@ -57,10 +170,7 @@ func (lps *LibraryPanelService) connectHandler(c *models.ReqContext) response.Re
 func (lps *LibraryPanelService) deleteHandler(c *models.ReqContext) response.Response {
 	err := lps.deleteLibraryPanel(c, c.Params(":uid"))
 	if err != nil {
-		if errors.Is(err, errLibraryPanelNotFound) {
-			return response.Error(404, errLibraryPanelNotFound.Error(), err)
-		}
-		return response.Error(500, "Failed to delete library panel", err)
+		return errorResponse(err, "Failed to delete library panel")
 	}
 
 	return response.Success("Library panel deleted")
@@ -68,15 +178,9 @@ func (lps *LibraryPanelService) deleteHandler(c *models.ReqContext) response.Res
 
 // disconnectHandler handles DELETE /api/library-panels/:uid/dashboards/:dashboardId.
 func (lps *LibraryPanelService) disconnectHandler(c *models.ReqContext) response.Response {
-	err := lps.disconnectDashboard(c, c.Params(":uid"), c.ParamsInt64(":dashboardId"))
+	err := lps.disconnectDashboard(c, c.Params(":uid"), c.ParamsInt64(":dashboardId"), c.QueryInt64("panelId"))
 	if err != nil {
-		if errors.Is(err, errLibraryPanelNotFound) {
-			return response.Error(404, errLibraryPanelNotFound.Error(), err)
-		}
-		if errors.Is(err, errLibraryPanelDashboardNotFound) {
-			return response.Error(404, errLibraryPanelDashboardNotFound.Error(), err)
-		}
-		return response.Error(500, "Failed to disconnect library panel", err)
+		return errorResponse(err, "Failed to disconnect library panel")
 	}
 
 	return response.Success("Library panel disconnected")
@@ -86,50 +190,1172 @@ func (lps *LibraryPanelService) disconnectHandler(c *models.ReqContext) response
 func (lps *LibraryPanelService) getHandler(c *models.ReqContext) response.Response {
 	libraryPanel, err := lps.getLibraryPanel(c, c.Params(":uid"))
 	if err != nil {
-		if errors.Is(err, errLibraryPanelNotFound) {
-			return response.Error(404, errLibraryPanelNotFound.Error(), err)
+		return errorResponse(err, "Failed to get library panel")
+	}
+	libraryPanel.Meta, err = lps.getLibraryPanelMeta(libraryPanel)
+	if err != nil {
+		return errorResponse(err, "Failed to get library panel")
+	}
+	libraryPanels := []LibraryPanel{libraryPanel}
+	if err := lps.translateLibraryPanels(c, libraryPanels); err != nil {
+		return errorResponse(err, "Failed to get library panel")
+	}
+	libraryPanel = libraryPanels[0]
+	libraryPanel.Fingerprint = libraryPanelFingerprint(libraryPanel)
+	etag := libraryPanelETag(libraryPanel)
+	if paths := c.Query("modelPaths"); paths != "" {
+		if libraryPanel.Model, err = selectModelPaths(libraryPanel.Model, strings.Split(paths, ",")); err != nil {
+			return errorResponse(err, "Failed to get library panel")
 		}
-		return response.Error(500, "Failed to get library panel", err)
 	}
 
-	return response.JSON(200, util.DynMap{"result": libraryPanel})
+	return response.JSON(200, util.DynMap{"result": libraryPanel}).Header("ETag", etag)
 }
 
 // getAllHandler handles GET /api/library-panels/.
 func (lps *LibraryPanelService) getAllHandler(c *models.ReqContext) response.Response {
-	libraryPanels, err := lps.getAllLibraryPanels(c)
+	query := getAllQueryFromRequest(c)
+	if c.Query("folderId") != "" {
+		folderID := c.QueryInt64("folderId")
+		query.FolderID = &folderID
+	}
+
+	return lps.getAllResponse(c, query)
+}
+
+// getAllInFolderHandler handles GET /api/folders/:uid/library-panels.
+func (lps *LibraryPanelService) getAllInFolderHandler(c *models.ReqContext) response.Response {
+	folderID, err := lps.getViewableFolderID(c, c.Params(":uid"))
 	if err != nil {
-		return response.Error(500, "Failed to get library panels", err)
+		return errorResponse(err, "Failed to get library panels")
 	}
+	query := getAllQueryFromRequest(c)
+	query.FolderID = &folderID
 
-	return response.JSON(200, util.DynMap{"result": libraryPanels})
+	return lps.getAllResponse(c, query)
 }
 
-// getConnectedDashboardsHandler handles GET /api/library-panels/:uid/dashboards/.
-func (lps *LibraryPanelService) getConnectedDashboardsHandler(c *models.ReqContext) response.Response {
-	dashboardIDs, err := lps.getConnectedDashboards(c, c.Params(":uid"))
+// createInFolderHandler handles POST /api/folders/:uid/library-panels, the folder of the command is ignored.
+func (lps *LibraryPanelService) createInFolderHandler(c *models.ReqContext, cmd createLibraryPanelCommand) response.Response {
+	folderID, err := lps.getViewableFolderID(c, c.Params(":uid"))
 	if err != nil {
-		if errors.Is(err, errLibraryPanelNotFound) {
-			return response.Error(404, errLibraryPanelNotFound.Error(), err)
-		}
-		return response.Error(500, "Failed to get connected dashboards", err)
+		return errorResponse(err, "Failed to create library panel")
 	}
+	cmd.FolderID = &folderID
 
-	return response.JSON(200, util.DynMap{"result": dashboardIDs})
+	return lps.createHandler(c, cmd)
 }
 
-// patchHandler handles PATCH /api/library-panels/:uid
-func (lps *LibraryPanelService) patchHandler(c *models.ReqContext, cmd patchLibraryPanelCommand) response.Response {
-	libraryPanel, err := lps.patchLibraryPanel(c, cmd, c.Params(":uid"))
+func getAllQueryFromRequest(c *models.ReqContext) getAllLibraryPanelsQuery {
+	return getAllLibraryPanelsQuery{
+		Datasource:   c.Query("datasource"),
+		Kind:         libraryElementKind(c.QueryInt64("kind")),
+		Status:       c.Query("status"),
+		Starred:      c.QueryBool("starred"),
+		IncludeModel: c.QueryBool("includeModel"),
+		OwnedBy:      c.Query("ownedBy"),
+
+		IncludeSubfolders: c.QueryBool("includeSubfolders"),
+	}
+}
+
+func (lps *LibraryPanelService) getAllResponse(c *models.ReqContext, query getAllLibraryPanelsQuery) response.Response {
+	libraryPanels, err := lps.getAllLibraryPanels(c, query)
 	if err != nil {
-		if errors.Is(err, errLibraryPanelAlreadyExists) {
-			return response.Error(400, errLibraryPanelAlreadyExists.Error(), err)
+		return errorResponse(err, "Failed to get library panels")
+	}
+	if err := lps.translateLibraryPanels(c, libraryPanels); err != nil {
+		return errorResponse(err, "Failed to get library panels")
+	}
+	if query.IncludeModel {
+		for i := range libraryPanels {
+			libraryPanels[i].Fingerprint = libraryPanelFingerprint(libraryPanels[i])
 		}
-		if errors.Is(err, errLibraryPanelNotFound) {
-			return response.Error(404, errLibraryPanelNotFound.Error(), err)
+	}
+
+	return response.JSON(200, util.DynMap{"result": libraryPanels})
+}
+
+// searchHandler handles GET /api/library-panels/search.
+func (lps *LibraryPanelService) searchHandler(c *models.ReqContext) response.Response {
+	query := searchLibraryPanelsQuery{
+		Query:        c.Query("query"),
+		Page:         c.QueryInt("page"),
+		PerPage:      c.QueryInt("perpage"),
+		Kind:         libraryElementKind(c.QueryInt64("kind")),
+		Status:       c.Query("status"),
+		IncludeModel: c.QueryBool("includeModel"),
+	}
+	result, err := lps.searchLibraryPanels(c, query)
+	if err != nil {
+		return errorResponse(err, "Failed to search library panels")
+	}
+
+	return response.JSON(200, util.DynMap{"result": result})
+}
+
+// suggestHandler handles GET /api/library-panels/suggest.
+func (lps *LibraryPanelService) suggestHandler(c *models.ReqContext) response.Response {
+	query := suggestLibraryPanelsQuery{
+		Query: c.Query("q"),
+		Limit: c.QueryInt("limit"),
+		Kind:  libraryElementKind(c.QueryInt64("kind")),
+	}
+	suggestions, err := lps.suggestLibraryPanels(c, query)
+	if err != nil {
+		return errorResponse(err, "Failed to suggest library panels")
+	}
+
+	return response.JSON(200, util.DynMap{"result": suggestions})
+}
+
+// nameExistsHandler handles GET /api/library-panels/name-exists.
+func (lps *LibraryPanelService) nameExistsHandler(c *models.ReqContext) response.Response {
+	query := nameExistsQuery{
+		Name:     c.Query("name"),
+		FolderID: c.QueryInt64("folderId"),
+		Kind:     libraryElementKind(c.QueryInt64("kind")),
+		UID:      c.Query("uid"),
+	}
+	exists, err := lps.libraryPanelNameExists(c, query)
+	if err != nil {
+		return errorResponse(err, "Failed to check library panel name")
+	}
+
+	return response.JSON(200, util.DynMap{"result": util.DynMap{"exists": exists}})
+}
+
+// exportHandler handles GET /api/library-panels/export.
+func (lps *LibraryPanelService) exportHandler(c *models.ReqContext) response.Response {
+	return exportResponse{lps: lps}
+}
+
+// addTagHandler handles POST /api/library-panels/tags/add.
+func (lps *LibraryPanelService) addTagHandler(c *models.ReqContext, cmd bulkTagCommand) response.Response {
+	result, err := lps.addLibraryPanelTag(c, cmd)
+	if err != nil {
+		return errorResponse(err, "Failed to add library panel tag")
+	}
+
+	return response.JSON(200, util.DynMap{"result": result})
+}
+
+// removeTagHandler handles POST /api/library-panels/tags/remove.
+func (lps *LibraryPanelService) removeTagHandler(c *models.ReqContext, cmd bulkTagCommand) response.Response {
+	result, err := lps.removeLibraryPanelTag(c, cmd)
+	if err != nil {
+		return errorResponse(err, "Failed to remove library panel tag")
+	}
+
+	return response.JSON(200, util.DynMap{"result": result})
+}
+
+// getTemplateHandler handles GET /api/library-panels/:uid/template.
+func (lps *LibraryPanelService) getTemplateHandler(c *models.ReqContext) response.Response {
+	template, err := lps.getPanelTemplate(c, c.Params(":uid"))
+	if err != nil {
+		return errorResponse(err, "Failed to export library panel template")
+	}
+
+	return response.JSON(200, util.DynMap{"result": template})
+}
+
+// getSnippetHandler handles GET /api/library-panels/:uid/snippet.
+func (lps *LibraryPanelService) getSnippetHandler(c *models.ReqContext) response.Response {
+	query := panelSnippetQuery{
+		PanelID: c.QueryInt64("panelId"),
+		X:       c.QueryInt("x"),
+		Y:       c.QueryInt("y"),
+		W:       c.QueryInt("w"),
+		H:       c.QueryInt("h"),
+	}
+	snippet, err := lps.getPanelSnippet(c, c.Params(":uid"), query)
+	if err != nil {
+		return errorResponse(err, "Failed to export library panel snippet")
+	}
+
+	return response.JSON(200, util.DynMap{"result": snippet})
+}
+
+// instantiateTemplateHandler handles POST /api/library-panels/templates/instantiate.
+func (lps *LibraryPanelService) instantiateTemplateHandler(c *models.ReqContext, cmd instantiateTemplateCommand) response.Response {
+	panel, err := lps.instantiateTemplate(c, cmd)
+	if err != nil {
+		return errorResponse(err, "Failed to instantiate library panel template")
+	}
+
+	return response.JSON(200, util.DynMap{"result": panel})
+}
+
+// getUsageReportHandler handles GET /api/library-panels/usage.
+func (lps *LibraryPanelService) getUsageReportHandler(c *models.ReqContext) response.Response {
+	report, err := lps.getLibraryPanelUsageReport(c, c.QueryInt("limit"))
+	if err != nil {
+		return errorResponse(err, "Failed to get library panel usage")
+	}
+
+	return response.JSON(200, util.DynMap{"result": report})
+}
+
+// getQueryUsageReportHandler handles GET /api/library-panels/queries/usage.
+func (lps *LibraryPanelService) getQueryUsageReportHandler(c *models.ReqContext) response.Response {
+	report, err := lps.getLibraryQueryUsageReport(c)
+	if err != nil {
+		return errorResponse(err, "Failed to get library query usage")
+	}
+
+	return response.JSON(200, util.DynMap{"result": report})
+}
+
+// getStatsHandler handles GET /api/library-panels/stats.
+func (lps *LibraryPanelService) getStatsHandler(c *models.ReqContext) response.Response {
+	stats, err := lps.getLibraryPanelStats(c)
+	if err != nil {
+		return errorResponse(err, "Failed to get library panel stats")
+	}
+
+	return response.JSON(200, util.DynMap{"result": stats})
+}
+
+// getAllConnectionsHandler handles GET /api/library-panels/connections.
+func (lps *LibraryPanelService) getAllConnectionsHandler(c *models.ReqContext) response.Response {
+	query := getAllConnectionsQuery{
+		Page:    c.QueryInt("page"),
+		PerPage: c.QueryInt("perpage"),
+	}
+	result, err := lps.getAllConnections(c, query)
+	if err != nil {
+		return errorResponse(err, "Failed to get library panel connections")
+	}
+
+	return response.JSON(200, util.DynMap{"result": result})
+}
+
+// getByDatasourceHandler handles GET /api/library-panels/datasources/:datasourceUid.
+func (lps *LibraryPanelService) getByDatasourceHandler(c *models.ReqContext) response.Response {
+	libraryPanels, err := lps.getLibraryPanelsByDatasource(c, c.Params(":datasourceUid"))
+	if err != nil {
+		return errorResponse(err, "Failed to get library panels")
+	}
+
+	return response.JSON(200, util.DynMap{"result": libraryPanels})
+}
+
+// rewriteDatasourceHandler handles POST /api/library-panels/datasources/rewrite.
+func (lps *LibraryPanelService) rewriteDatasourceHandler(c *models.ReqContext, cmd rewriteDatasourceCommand) response.Response {
+	result, err := lps.rewriteLibraryPanelDatasources(c, cmd)
+	if err != nil {
+		return errorResponse(err, "Failed to rewrite library panel datasources")
+	}
+
+	return response.JSON(200, util.DynMap{"result": result})
+}
+
+// getUnusedHandler handles GET /api/library-panels/unused.
+func (lps *LibraryPanelService) getUnusedHandler(c *models.ReqContext) response.Response {
+	query := getUnusedLibraryPanelsQuery{
+		OlderThanDays: c.QueryInt64("olderThanDays"),
+	}
+	libraryPanels, err := lps.getUnusedLibraryPanels(c, query)
+	if err != nil {
+		return errorResponse(err, "Failed to get unused library panels")
+	}
+
+	return response.JSON(200, util.DynMap{"result": libraryPanels})
+}
+
+// getCleanupPolicyHandler handles GET /api/library-panels/cleanup-policy.
+func (lps *LibraryPanelService) getCleanupPolicyHandler(c *models.ReqContext) response.Response {
+	policy, err := lps.getCleanupPolicy(c)
+	if err != nil {
+		return errorResponse(err, "Failed to get library panel cleanup policy")
+	}
+
+	return response.JSON(200, util.DynMap{"result": policy})
+}
+
+// updateCleanupPolicyHandler handles PUT /api/library-panels/cleanup-policy.
+func (lps *LibraryPanelService) updateCleanupPolicyHandler(c *models.ReqContext, cmd updateCleanupPolicyCommand) response.Response {
+	policy, err := lps.updateCleanupPolicy(c, cmd)
+	if err != nil {
+		return errorResponse(err, "Failed to update library panel cleanup policy")
+	}
+
+	return response.JSON(200, util.DynMap{"result": policy})
+}
+
+// getVariableDefaultsHandler handles GET /api/library-panels/variable-defaults.
+func (lps *LibraryPanelService) getVariableDefaultsHandler(c *models.ReqContext) response.Response {
+	defaults, err := lps.getVariableDefaults(c)
+	if err != nil {
+		return errorResponse(err, "Failed to get library panel variable defaults")
+	}
+
+	return response.JSON(200, util.DynMap{"result": defaults})
+}
+
+// updateVariableDefaultsHandler handles PUT /api/library-panels/variable-defaults.
+func (lps *LibraryPanelService) updateVariableDefaultsHandler(c *models.ReqContext, cmd updateVariableDefaultsCommand) response.Response {
+	defaults, err := lps.updateVariableDefaults(c, cmd)
+	if err != nil {
+		return errorResponse(err, "Failed to update library panel variable defaults")
+	}
+
+	return response.JSON(200, util.DynMap{"result": defaults})
+}
+
+// getAllCollectionsHandler handles GET /api/library-panels/collections.
+func (lps *LibraryPanelService) getAllCollectionsHandler(c *models.ReqContext) response.Response {
+	collections, err := lps.getAllCollections(c)
+	if err != nil {
+		return errorResponse(err, "Failed to get library panel collections")
+	}
+
+	return response.JSON(200, util.DynMap{"result": collections})
+}
+
+// createCollectionHandler handles POST /api/library-panels/collections.
+func (lps *LibraryPanelService) createCollectionHandler(c *models.ReqContext, cmd saveCollectionCommand) response.Response {
+	collection, err := lps.createCollection(c, cmd)
+	if err != nil {
+		return errorResponse(err, "Failed to create library panel collection")
+	}
+
+	return response.JSON(200, util.DynMap{"result": collection})
+}
+
+// getCollectionHandler handles GET /api/library-panels/collections/:uid.
+func (lps *LibraryPanelService) getCollectionHandler(c *models.ReqContext) response.Response {
+	collection, err := lps.getCollection(c, c.Params(":uid"))
+	if err != nil {
+		return errorResponse(err, "Failed to get library panel collection")
+	}
+
+	return response.JSON(200, util.DynMap{"result": collection})
+}
+
+// updateCollectionHandler handles PUT /api/library-panels/collections/:uid.
+func (lps *LibraryPanelService) updateCollectionHandler(c *models.ReqContext, cmd saveCollectionCommand) response.Response {
+	collection, err := lps.updateCollection(c, c.Params(":uid"), cmd)
+	if err != nil {
+		return errorResponse(err, "Failed to update library panel collection")
+	}
+
+	return response.JSON(200, util.DynMap{"result": collection})
+}
+
+// deleteCollectionHandler handles DELETE /api/library-panels/collections/:uid.
+func (lps *LibraryPanelService) deleteCollectionHandler(c *models.ReqContext) response.Response {
+	if err := lps.deleteCollection(c, c.Params(":uid")); err != nil {
+		return errorResponse(err, "Failed to delete library panel collection")
+	}
+
+	return response.Success("Library panel collection deleted")
+}
+
+// addCollectionLibraryPanelHandler handles POST /api/library-panels/collections/:uid/library-panels/:libraryPanelUid.
+func (lps *LibraryPanelService) addCollectionLibraryPanelHandler(c *models.ReqContext) response.Response {
+	collection, err := lps.addCollectionLibraryPanel(c, c.Params(":uid"), c.Params(":libraryPanelUid"))
+	if err != nil {
+		return errorResponse(err, "Failed to add library panel to collection")
+	}
+
+	return response.JSON(200, util.DynMap{"result": collection})
+}
+
+// removeCollectionLibraryPanelHandler handles DELETE /api/library-panels/collections/:uid/library-panels/:libraryPanelUid.
+func (lps *LibraryPanelService) removeCollectionLibraryPanelHandler(c *models.ReqContext) response.Response {
+	collection, err := lps.removeCollectionLibraryPanel(c, c.Params(":uid"), c.Params(":libraryPanelUid"))
+	if err != nil {
+		return errorResponse(err, "Failed to remove library panel from collection")
+	}
+
+	return response.JSON(200, util.DynMap{"result": collection})
+}
+
+// addCollectionToDashboardHandler handles POST /api/library-panels/collections/:uid/dashboards/:dashboardId.
+func (lps *LibraryPanelService) addCollectionToDashboardHandler(c *models.ReqContext) response.Response {
+	dash, err := lps.addCollectionToDashboard(c, c.Params(":uid"), c.ParamsInt64(":dashboardId"))
+	if err != nil {
+		return errorResponse(err, "Failed to add library panel collection to dashboard")
+	}
+
+	return response.JSON(200, util.DynMap{"result": util.DynMap{
+		"id":      dash.Id,
+		"uid":     dash.Uid,
+		"version": dash.Version,
+	}})
+}
+
+// getGitSyncHandler handles GET /api/library-panels/git-sync.
+func (lps *LibraryPanelService) getGitSyncHandler(c *models.ReqContext) response.Response {
+	gitSync, err := lps.getGitSync(c)
+	if err != nil {
+		return errorResponse(err, "Failed to get library panel git sync")
+	}
+
+	return response.JSON(200, util.DynMap{"result": gitSync})
+}
+
+// updateGitSyncHandler handles PUT /api/library-panels/git-sync.
+func (lps *LibraryPanelService) updateGitSyncHandler(c *models.ReqContext, cmd updateGitSyncCommand) response.Response {
+	gitSync, err := lps.updateGitSync(c, cmd)
+	if err != nil {
+		return errorResponse(err, "Failed to update library panel git sync")
+	}
+
+	return response.JSON(200, util.DynMap{"result": gitSync})
+}
+
+// runGitSyncHandler handles POST /api/library-panels/git-sync/run.
+func (lps *LibraryPanelService) runGitSyncHandler(c *models.ReqContext) response.Response {
+	result, err := lps.syncLibraryPanelsNow(c)
+	if err != nil {
+		// invalid files in the repository are failures of the sync, not of the request
+		if !errors.Is(err, errLibraryPanelInvalidGitSync) {
+			return response.Error(500, "Failed to sync library panels from git", err)
 		}
-		return response.Error(500, "Failed to update library panel", err)
+		return errorResponse(err, "Failed to sync library panels from git")
+	}
+
+	return response.JSON(200, util.DynMap{"result": result})
+}
+
+// getAllCatalogPanelsHandler handles GET /api/library-panels/catalog.
+func (lps *LibraryPanelService) getAllCatalogPanelsHandler(c *models.ReqContext) response.Response {
+	panels, err := lps.getAllCatalogPanels()
+	if err != nil {
+		return errorResponse(err, "Failed to get catalog panels")
+	}
+
+	return response.JSON(200, util.DynMap{"result": panels})
+}
+
+// createCatalogPanelHandler handles POST /api/library-panels/catalog.
+func (lps *LibraryPanelService) createCatalogPanelHandler(c *models.ReqContext, cmd saveCatalogPanelCommand) response.Response {
+	panel, err := lps.createCatalogPanel(c, cmd)
+	if err != nil {
+		return errorResponse(err, "Failed to create catalog panel")
+	}
+
+	return response.JSON(200, util.DynMap{"result": panel})
+}
+
+// getCatalogPanelHandler handles GET /api/library-panels/catalog/:uid.
+func (lps *LibraryPanelService) getCatalogPanelHandler(c *models.ReqContext) response.Response {
+	panel, err := lps.getCatalogPanel(c.Params(":uid"))
+	if err != nil {
+		return errorResponse(err, "Failed to get catalog panel")
+	}
+
+	return response.JSON(200, util.DynMap{"result": panel})
+}
+
+// updateCatalogPanelHandler handles PUT /api/library-panels/catalog/:uid.
+func (lps *LibraryPanelService) updateCatalogPanelHandler(c *models.ReqContext, cmd saveCatalogPanelCommand) response.Response {
+	panel, err := lps.updateCatalogPanel(c, c.Params(":uid"), cmd)
+	if err != nil {
+		return errorResponse(err, "Failed to update catalog panel")
+	}
+
+	return response.JSON(200, util.DynMap{"result": panel})
+}
+
+// deleteCatalogPanelHandler handles DELETE /api/library-panels/catalog/:uid.
+func (lps *LibraryPanelService) deleteCatalogPanelHandler(c *models.ReqContext) response.Response {
+	if err := lps.deleteCatalogPanel(c.Params(":uid")); err != nil {
+		return errorResponse(err, "Failed to delete catalog panel")
+	}
+
+	return response.Success("Catalog panel deleted")
+}
+
+// installCatalogPanelHandler handles POST /api/library-panels/catalog/:uid/install.
+func (lps *LibraryPanelService) installCatalogPanelHandler(c *models.ReqContext, cmd installCatalogPanelCommand) response.Response {
+	libraryPanel, err := lps.installCatalogPanel(c, c.Params(":uid"), cmd)
+	if err != nil {
+		return errorResponse(err, "Failed to install catalog panel")
+	}
+
+	return response.JSON(200, util.DynMap{"result": libraryPanel})
+}
+
+// searchCommunityPanelsHandler handles GET /api/library-panels/community.
+func (lps *LibraryPanelService) searchCommunityPanelsHandler(c *models.ReqContext) response.Response {
+	result, err := lps.searchCommunityPanels(c.Query("query"), c.QueryInt64("page"))
+	if err != nil {
+		return errorResponse(err, "Failed to search community panels")
+	}
+
+	return response.JSON(200, util.DynMap{"result": result})
+}
+
+// installCommunityPanelHandler handles POST /api/library-panels/community/:slug/install.
+func (lps *LibraryPanelService) installCommunityPanelHandler(c *models.ReqContext, cmd installCommunityPanelCommand) response.Response {
+	libraryPanel, err := lps.installCommunityPanel(c, c.Params(":slug"), cmd)
+	if err != nil {
+		return errorResponse(err, "Failed to install community panel")
 	}
 
 	return response.JSON(200, util.DynMap{"result": libraryPanel})
 }
+
+// checkCommunityUpdateHandler handles GET /api/library-panels/:uid/community-update.
+func (lps *LibraryPanelService) checkCommunityUpdateHandler(c *models.ReqContext) response.Response {
+	update, err := lps.checkCommunityPanelUpdate(c, c.Params(":uid"))
+	if err != nil {
+		return errorResponse(err, "Failed to check for community panel updates")
+	}
+
+	return response.JSON(200, util.DynMap{"result": update})
+}
+
+// getReplicationHandler handles GET /api/library-panels/:uid/replication.
+func (lps *LibraryPanelService) getReplicationHandler(c *models.ReqContext) response.Response {
+	replication, err := lps.getReplication(c, c.Params(":uid"))
+	if err != nil {
+		return errorResponse(err, "Failed to get library panel replication")
+	}
+
+	return response.JSON(200, util.DynMap{"result": replication})
+}
+
+// setReplicationHandler handles PUT /api/library-panels/:uid/replication.
+func (lps *LibraryPanelService) setReplicationHandler(c *models.ReqContext, cmd setReplicationCommand) response.Response {
+	replication, err := lps.setReplication(c, c.Params(":uid"), cmd)
+	if err != nil {
+		return errorResponse(err, "Failed to replicate library panel")
+	}
+
+	return response.JSON(200, util.DynMap{"result": replication})
+}
+
+// getConnectedDashboardsHandler handles GET /api/library-panels/:uid/dashboards/.
+func (lps *LibraryPanelService) getConnectedDashboardsHandler(c *models.ReqContext) response.Response {
+	dashboardIDs, err := lps.getConnectedDashboards(c, c.Params(":uid"))
+	if err != nil {
+		return errorResponse(err, "Failed to get connected dashboards")
+	}
+
+	return response.JSON(200, util.DynMap{"result": dashboardIDs})
+}
+
+// getConnectionsHandler handles GET /api/library-panels/:uid/connections.
+func (lps *LibraryPanelService) getConnectionsHandler(c *models.ReqContext) response.Response {
+	connections, err := lps.getLibraryPanelConnections(c, c.Params(":uid"))
+	if err != nil {
+		return errorResponse(err, "Failed to get library panel connections")
+	}
+
+	return response.JSON(200, util.DynMap{"result": connections})
+}
+
+// getDependenciesHandler handles GET /api/library-panels/:uid/dependencies.
+func (lps *LibraryPanelService) getDependenciesHandler(c *models.ReqContext) response.Response {
+	dependencies, err := lps.getLibraryPanelDependencies(c, c.Params(":uid"))
+	if err != nil {
+		return errorResponse(err, "Failed to get library panel dependencies")
+	}
+
+	return response.JSON(200, util.DynMap{"result": dependencies})
+}
+
+// getQueryVersionsHandler handles GET /api/library-panels/:uid/versions.
+func (lps *LibraryPanelService) getQueryVersionsHandler(c *models.ReqContext) response.Response {
+	versions, err := lps.getLibraryQueryVersions(c, c.Params(":uid"))
+	if err != nil {
+		return errorResponse(err, "Failed to get library query versions")
+	}
+
+	return response.JSON(200, util.DynMap{"result": versions})
+}
+
+// getThumbnailHandler handles GET /api/library-panels/:uid/thumbnail.
+func (lps *LibraryPanelService) getThumbnailHandler(c *models.ReqContext) response.Response {
+	image, err := lps.getThumbnail(c, c.Params(":uid"))
+	if err != nil {
+		return errorResponse(err, "Failed to get library panel thumbnail")
+	}
+
+	return response.Respond(200, image).Header("Content-Type", "image/png").Header("Cache-Control", "private, max-age=60")
+}
+
+// patchHandler handles PATCH /api/library-panels/:uid
+func (lps *LibraryPanelService) patchHandler(c *models.ReqContext, cmd patchLibraryPanelCommand) response.Response {
+	if c.QueryBool("dryRun") {
+		preview, err := lps.previewLibraryPanelPatch(c, cmd, c.Params(":uid"))
+		if err != nil {
+			return errorResponse(err, "Failed to preview library panel update")
+		}
+
+		return response.JSON(200, util.DynMap{"result": preview})
+	}
+	if effectiveAt := c.Query("effectiveAt"); effectiveAt != "" {
+		at, err := time.Parse(time.RFC3339, effectiveAt)
+		if err != nil {
+			return errorResponse(errLibraryPanelInvalidEffectiveAt, "Failed to schedule library panel update")
+		}
+		change, err := lps.scheduleLibraryPanelChange(c, cmd, c.Params(":uid"), at)
+		if err != nil {
+			return errorResponse(err, "Failed to schedule library panel update")
+		}
+
+		return response.JSON(202, util.DynMap{"result": change})
+	}
+
+	change, pending, err := lps.requestApproval(c, cmd, c.Params(":uid"))
+	if err == nil && pending {
+		return response.JSON(202, util.DynMap{"result": change})
+	}
+
+	var libraryPanel LibraryPanel
+	if err == nil {
+		libraryPanel, err = lps.patchLibraryPanel(c, cmd, c.Params(":uid"))
+	}
+	if err != nil {
+		return errorResponse(err, "Failed to update library panel")
+	}
+	libraryPanel.Fingerprint = libraryPanelFingerprint(libraryPanel)
+
+	return response.JSON(200, util.DynMap{"result": libraryPanel}).Header("ETag", libraryPanelETag(libraryPanel))
+}
+
+// analyzeImpactHandler handles POST /api/library-panels/:uid/impact.
+func (lps *LibraryPanelService) analyzeImpactHandler(c *models.ReqContext, cmd analyzeImpactCommand) response.Response {
+	analysis, err := lps.analyzeImpact(c, c.Params(":uid"), cmd)
+	if err != nil {
+		return errorResponse(err, "Failed to analyze library panel impact")
+	}
+
+	return response.JSON(200, util.DynMap{"result": analysis})
+}
+
+// publishHandler handles POST /api/library-panels/:uid/publish.
+func (lps *LibraryPanelService) publishHandler(c *models.ReqContext) response.Response {
+	libraryPanel, err := lps.publishLibraryPanel(c, c.Params(":uid"))
+	if err != nil {
+		return errorResponse(err, "Failed to publish library panel")
+	}
+
+	return response.JSON(200, util.DynMap{"result": libraryPanel})
+}
+
+// deprecateHandler handles POST /api/library-panels/:uid/deprecate.
+func (lps *LibraryPanelService) deprecateHandler(c *models.ReqContext, cmd deprecateLibraryPanelCommand) response.Response {
+	libraryPanel, err := lps.setLibraryPanelDeprecation(c, c.Params(":uid"), true, cmd.ReplacedBy)
+	if err != nil {
+		return errorResponse(err, "Failed to deprecate library panel")
+	}
+
+	return response.JSON(200, util.DynMap{"result": libraryPanel})
+}
+
+// undeprecateHandler handles DELETE /api/library-panels/:uid/deprecate.
+func (lps *LibraryPanelService) undeprecateHandler(c *models.ReqContext) response.Response {
+	libraryPanel, err := lps.setLibraryPanelDeprecation(c, c.Params(":uid"), false, "")
+	if err != nil {
+		return errorResponse(err, "Failed to undeprecate library panel")
+	}
+
+	return response.JSON(200, util.DynMap{"result": libraryPanel})
+}
+
+// getScheduledChangesHandler handles GET /api/library-panels/:uid/scheduled-changes.
+func (lps *LibraryPanelService) getScheduledChangesHandler(c *models.ReqContext) response.Response {
+	changes, err := lps.getScheduledChanges(c, c.Params(":uid"))
+	if err != nil {
+		return errorResponse(err, "Failed to get scheduled library panel changes")
+	}
+
+	return response.JSON(200, util.DynMap{"result": changes})
+}
+
+// cancelScheduledChangeHandler handles DELETE /api/library-panels/:uid/scheduled-changes/:id.
+func (lps *LibraryPanelService) cancelScheduledChangeHandler(c *models.ReqContext) response.Response {
+	change, err := lps.cancelScheduledChange(c, c.Params(":uid"), c.ParamsInt64(":id"))
+	if err != nil {
+		return errorResponse(err, "Failed to cancel scheduled library panel change")
+	}
+
+	return response.JSON(200, util.DynMap{"result": change})
+}
+
+// pinHandler handles POST /api/library-panels/:uid/pin.
+func (lps *LibraryPanelService) pinHandler(c *models.ReqContext) response.Response {
+	libraryPanel, err := lps.setLibraryPanelPinned(c, c.Params(":uid"), true)
+	if err != nil {
+		return errorResponse(err, "Failed to pin library panel")
+	}
+
+	return response.JSON(200, util.DynMap{"result": libraryPanel})
+}
+
+// unpinHandler handles DELETE /api/library-panels/:uid/pin.
+func (lps *LibraryPanelService) unpinHandler(c *models.ReqContext) response.Response {
+	libraryPanel, err := lps.setLibraryPanelPinned(c, c.Params(":uid"), false)
+	if err != nil {
+		return errorResponse(err, "Failed to unpin library panel")
+	}
+
+	return response.JSON(200, util.DynMap{"result": libraryPanel})
+}
+
+// getVariantHandler handles GET /api/library-panels/:uid/variant.
+func (lps *LibraryPanelService) getVariantHandler(c *models.ReqContext) response.Response {
+	variant, err := lps.getLibraryPanelVariant(c, c.Params(":uid"))
+	if err != nil {
+		return errorResponse(err, "Failed to get library panel variant")
+	}
+
+	return response.JSON(200, util.DynMap{"result": variant})
+}
+
+// setVariantHandler handles PUT /api/library-panels/:uid/variant.
+func (lps *LibraryPanelService) setVariantHandler(c *models.ReqContext, cmd setLibraryPanelVariantCommand) response.Response {
+	variant, err := lps.setLibraryPanelVariant(c, c.Params(":uid"), cmd)
+	if err != nil {
+		return errorResponse(err, "Failed to set library panel variant")
+	}
+
+	return response.JSON(200, util.DynMap{"result": variant})
+}
+
+// deleteVariantHandler handles DELETE /api/library-panels/:uid/variant.
+func (lps *LibraryPanelService) deleteVariantHandler(c *models.ReqContext) response.Response {
+	if err := lps.deleteLibraryPanelVariant(c, c.Params(":uid")); err != nil {
+		return errorResponse(err, "Failed to delete library panel variant")
+	}
+
+	return response.Success("Library panel variant deleted")
+}
+
+// getTranslationsHandler handles GET /api/library-panels/:uid/translations.
+func (lps *LibraryPanelService) getTranslationsHandler(c *models.ReqContext) response.Response {
+	translations, err := lps.getLibraryPanelTranslations(c, c.Params(":uid"))
+	if err != nil {
+		return errorResponse(err, "Failed to get library panel translations")
+	}
+
+	return response.JSON(200, util.DynMap{"result": translations})
+}
+
+// setTranslationHandler handles PUT /api/library-panels/:uid/translations/:locale.
+func (lps *LibraryPanelService) setTranslationHandler(c *models.ReqContext, cmd setLibraryPanelTranslationCommand) response.Response {
+	translation, err := lps.setLibraryPanelTranslation(c, c.Params(":uid"), c.Params(":locale"), cmd)
+	if err != nil {
+		return errorResponse(err, "Failed to set library panel translation")
+	}
+
+	return response.JSON(200, util.DynMap{"result": translation})
+}
+
+// deleteTranslationHandler handles DELETE /api/library-panels/:uid/translations/:locale.
+func (lps *LibraryPanelService) deleteTranslationHandler(c *models.ReqContext) response.Response {
+	if err := lps.deleteLibraryPanelTranslation(c, c.Params(":uid"), c.Params(":locale")); err != nil {
+		return errorResponse(err, "Failed to delete library panel translation")
+	}
+
+	return response.Success("Library panel translation deleted")
+}
+
+// getDeprecatedConnectionsHandler handles GET /api/library-panels/deprecated/dashboards.
+func (lps *LibraryPanelService) getDeprecatedConnectionsHandler(c *models.ReqContext) response.Response {
+	connections, err := lps.getDeprecatedLibraryPanelConnections(c)
+	if err != nil {
+		return errorResponse(err, "Failed to get dashboards connected to deprecated library panels")
+	}
+
+	return response.JSON(200, util.DynMap{"result": connections})
+}
+
+// starHandler handles POST /api/library-panels/:uid/star.
+func (lps *LibraryPanelService) starHandler(c *models.ReqContext) response.Response {
+	if err := lps.starLibraryPanel(c, c.Params(":uid")); err != nil {
+		return errorResponse(err, "Failed to star library panel")
+	}
+
+	return response.Success("Library panel starred")
+}
+
+// unstarHandler handles DELETE /api/library-panels/:uid/star.
+func (lps *LibraryPanelService) unstarHandler(c *models.ReqContext) response.Response {
+	if err := lps.unstarLibraryPanel(c, c.Params(":uid")); err != nil {
+		return errorResponse(err, "Failed to unstar library panel")
+	}
+
+	return response.Success("Library panel unstarred")
+}
+
+// getCommentsHandler handles GET /api/library-panels/:uid/comments.
+func (lps *LibraryPanelService) getCommentsHandler(c *models.ReqContext) response.Response {
+	comments, err := lps.getComments(c, c.Params(":uid"))
+	if err != nil {
+		return errorResponse(err, "Failed to get library panel comments")
+	}
+
+	return response.JSON(200, util.DynMap{"result": comments})
+}
+
+// addCommentHandler handles POST /api/library-panels/:uid/comments.
+func (lps *LibraryPanelService) addCommentHandler(c *models.ReqContext, cmd addCommentCommand) response.Response {
+	comment, err := lps.addComment(c, c.Params(":uid"), cmd)
+	if err != nil {
+		return errorResponse(err, "Failed to add library panel comment")
+	}
+
+	return response.JSON(200, util.DynMap{"result": comment})
+}
+
+// deleteCommentHandler handles DELETE /api/library-panels/:uid/comments/:commentId.
+func (lps *LibraryPanelService) deleteCommentHandler(c *models.ReqContext) response.Response {
+	if err := lps.deleteComment(c, c.Params(":uid"), c.ParamsInt64(":commentId")); err != nil {
+		return errorResponse(err, "Failed to delete library panel comment")
+	}
+
+	return response.Success("Library panel comment deleted")
+}
+
+// getEditSuggestionsHandler handles GET /api/library-panels/:uid/edit-suggestions.
+func (lps *LibraryPanelService) getEditSuggestionsHandler(c *models.ReqContext) response.Response {
+	suggestions, err := lps.getEditSuggestions(c, c.Params(":uid"))
+	if err != nil {
+		return errorResponse(err, "Failed to get library panel edit suggestions")
+	}
+
+	return response.JSON(200, util.DynMap{"result": suggestions})
+}
+
+// suggestEditHandler handles POST /api/library-panels/:uid/edit-suggestions.
+func (lps *LibraryPanelService) suggestEditHandler(c *models.ReqContext, cmd suggestEditCommand) response.Response {
+	suggestion, err := lps.suggestEdit(c, c.Params(":uid"), cmd)
+	if err != nil {
+		return errorResponse(err, "Failed to suggest library panel edit")
+	}
+
+	return response.JSON(200, util.DynMap{"result": suggestion})
+}
+
+// applyEditSuggestionHandler handles POST /api/library-panels/:uid/edit-suggestions/:id/apply.
+func (lps *LibraryPanelService) applyEditSuggestionHandler(c *models.ReqContext) response.Response {
+	return lps.reviewEditSuggestionResponse(c, true)
+}
+
+// rejectEditSuggestionHandler handles POST /api/library-panels/:uid/edit-suggestions/:id/reject.
+func (lps *LibraryPanelService) rejectEditSuggestionHandler(c *models.ReqContext) response.Response {
+	return lps.reviewEditSuggestionResponse(c, false)
+}
+
+func (lps *LibraryPanelService) reviewEditSuggestionResponse(c *models.ReqContext, apply bool) response.Response {
+	review, err := lps.reviewEditSuggestion(c, c.Params(":uid"), c.ParamsInt64(":id"), apply)
+	if err != nil {
+		return errorResponse(err, "Failed to review library panel edit suggestion")
+	}
+	if review.PendingChange != nil {
+		return response.JSON(202, util.DynMap{"result": review})
+	}
+
+	return response.JSON(200, util.DynMap{"result": review})
+}
+
+// feedHandler handles GET /api/library-panels/feed.
+func (lps *LibraryPanelService) feedHandler(c *models.ReqContext) response.Response {
+	format := c.Query("format")
+	entries, err := lps.getFeedEntries(c)
+	if err != nil {
+		return errorResponse(err, "Failed to get library panel changes")
+	}
+	feed, err := lps.renderFeed(c, entries, format)
+	if err != nil {
+		return errorResponse(err, "Failed to render library panel feed")
+	}
+
+	contentType := "application/atom+xml; charset=utf-8"
+	if format == feedFormatRSS {
+		contentType = "application/rss+xml; charset=utf-8"
+	}
+	return response.Respond(200, feed).Header("Content-Type", contentType)
+}
+
+// getNotificationsHandler handles GET /api/library-panels/notifications.
+func (lps *LibraryPanelService) getNotificationsHandler(c *models.ReqContext) response.Response {
+	notifications, err := lps.getNotifications(c)
+	if err != nil {
+		return errorResponse(err, "Failed to get library panel notifications")
+	}
+
+	return response.JSON(200, util.DynMap{"result": notifications})
+}
+
+// markNotificationSeenHandler handles POST /api/library-panels/notifications/:id/seen.
+func (lps *LibraryPanelService) markNotificationSeenHandler(c *models.ReqContext) response.Response {
+	if err := lps.markNotificationSeen(c, c.ParamsInt64(":id")); err != nil {
+		return errorResponse(err, "Failed to mark library panel notification as seen")
+	}
+
+	return response.Success("Library panel notification marked as seen")
+}
+
+// getNotificationMutesHandler handles GET /api/library-panels/notifications/mutes.
+func (lps *LibraryPanelService) getNotificationMutesHandler(c *models.ReqContext) response.Response {
+	mutes, err := lps.getNotificationMutes(c)
+	if err != nil {
+		return errorResponse(err, "Failed to get library panel notification mutes")
+	}
+
+	return response.JSON(200, util.DynMap{"result": mutes})
+}
+
+// muteAllHandler handles POST /api/library-panels/notifications/mutes.
+func (lps *LibraryPanelService) muteAllHandler(c *models.ReqContext) response.Response {
+	return lps.notificationMuteResponse(c, "", true)
+}
+
+// unmuteAllHandler handles DELETE /api/library-panels/notifications/mutes.
+func (lps *LibraryPanelService) unmuteAllHandler(c *models.ReqContext) response.Response {
+	return lps.notificationMuteResponse(c, "", false)
+}
+
+// muteHandler handles POST /api/library-panels/:uid/mute.
+func (lps *LibraryPanelService) muteHandler(c *models.ReqContext) response.Response {
+	return lps.notificationMuteResponse(c, c.Params(":uid"), true)
+}
+
+// unmuteHandler handles DELETE /api/library-panels/:uid/mute.
+func (lps *LibraryPanelService) unmuteHandler(c *models.ReqContext) response.Response {
+	return lps.notificationMuteResponse(c, c.Params(":uid"), false)
+}
+
+func (lps *LibraryPanelService) notificationMuteResponse(c *models.ReqContext, uid string, muted bool) response.Response {
+	if err := lps.setNotificationMute(c, uid, muted); err != nil {
+		return errorResponse(err, "Failed to change library panel notification mute")
+	}
+
+	if muted {
+		return response.Success("Library panel notifications muted")
+	}
+	return response.Success("Library panel notifications unmuted")
+}
+
+// getAPIKeyAccessesHandler handles GET /api/library-panels/api-keys.
+func (lps *LibraryPanelService) getAPIKeyAccessesHandler(c *models.ReqContext) response.Response {
+	accesses, err := lps.getAPIKeyAccesses(c)
+	if err != nil {
+		return errorResponse(err, "Failed to get library panel API key access")
+	}
+
+	return response.JSON(200, util.DynMap{"result": accesses})
+}
+
+// setAPIKeyAccessHandler handles PUT /api/library-panels/api-keys/:id.
+func (lps *LibraryPanelService) setAPIKeyAccessHandler(c *models.ReqContext, cmd setAPIKeyAccessCommand) response.Response {
+	access, err := lps.setAPIKeyAccess(c, c.ParamsInt64(":id"), cmd)
+	if err != nil {
+		return errorResponse(err, "Failed to set library panel API key access")
+	}
+
+	return response.JSON(200, util.DynMap{"result": access})
+}
+
+// deleteAPIKeyAccessHandler handles DELETE /api/library-panels/api-keys/:id.
+func (lps *LibraryPanelService) deleteAPIKeyAccessHandler(c *models.ReqContext) response.Response {
+	if err := lps.deleteAPIKeyAccess(c, c.ParamsInt64(":id")); err != nil {
+		return errorResponse(err, "Failed to delete library panel API key access")
+	}
+
+	return response.Success("Library panel API key access deleted")
+}
+
+// getBackupsHandler handles GET /api/library-panels/backups.
+func (lps *LibraryPanelService) getBackupsHandler(c *models.ReqContext) response.Response {
+	backups, err := lps.getBackups(c)
+	if err != nil {
+		return errorResponse(err, "Failed to get library panel backups")
+	}
+
+	return response.JSON(200, util.DynMap{"result": backups})
+}
+
+// restoreBackupHandler handles POST /api/library-panels/backups/:name/restore.
+func (lps *LibraryPanelService) restoreBackupHandler(c *models.ReqContext) response.Response {
+	result, err := lps.restoreBackup(c, c.Params(":name"))
+	if err != nil {
+		return errorResponse(err, "Failed to restore library panel backup")
+	}
+
+	return response.JSON(200, util.DynMap{"result": result})
+}
+
+// restoreBackupPanelHandler handles POST /api/library-panels/backups/:name/restore/:uid.
+func (lps *LibraryPanelService) restoreBackupPanelHandler(c *models.ReqContext) response.Response {
+	libraryPanel, err := lps.restoreBackupPanel(c, c.Params(":name"), c.Params(":uid"))
+	if err != nil {
+		return errorResponse(err, "Failed to restore library panel from backup")
+	}
+
+	return response.JSON(200, util.DynMap{"result": libraryPanel}).Header("ETag", libraryPanelETag(libraryPanel))
+}
+
+// transferOwnershipHandler handles POST /api/library-panels/transfer-ownership.
+func (lps *LibraryPanelService) transferOwnershipHandler(c *models.ReqContext, cmd transferOwnershipCommand) response.Response {
+	result, err := lps.transferOwnership(cmd, ownershipTransferBatchSize)
+	if err != nil {
+		return errorResponse(err, "Failed to transfer library panel ownership")
+	}
+
+	return response.JSON(200, util.DynMap{"result": result})
+}
+
+// cleanupVersionsHandler handles POST /api/library-panels/versions/cleanup.
+func (lps *LibraryPanelService) cleanupVersionsHandler(c *models.ReqContext) response.Response {
+	result, err := lps.deleteExpiredLibraryQueryVersions()
+	if err != nil {
+		return errorResponse(err, "Failed to delete expired library query versions")
+	}
+
+	return response.JSON(200, util.DynMap{"result": result})
+}
+
+// getMissingAuthorsHandler handles GET /api/library-panels/missing-authors.
+func (lps *LibraryPanelService) getMissingAuthorsHandler(c *models.ReqContext) response.Response {
+	libraryPanels, err := lps.getLibraryPanelsWithMissingAuthors(c)
+	if err != nil {
+		return errorResponse(err, "Failed to get library panels with missing authors")
+	}
+
+	return response.JSON(200, util.DynMap{"result": libraryPanels})
+}
+
+// getUnownedHandler handles GET /api/library-panels/unowned.
+func (lps *LibraryPanelService) getUnownedHandler(c *models.ReqContext) response.Response {
+	libraryPanels, err := lps.getLibraryPanelsWithoutOwnerTeam(c)
+	if err != nil {
+		return errorResponse(err, "Failed to get library panels without owning team")
+	}
+
+	return response.JSON(200, util.DynMap{"result": libraryPanels})
+}
+
+// getDuplicatesHandler handles GET /api/library-panels/duplicates.
+func (lps *LibraryPanelService) getDuplicatesHandler(c *models.ReqContext) response.Response {
+	clusters, err := lps.getDuplicateLibraryPanels(c)
+	if err != nil {
+		return errorResponse(err, "Failed to get duplicate library panels")
+	}
+
+	return response.JSON(200, util.DynMap{"result": clusters})
+}
+
+// checkDuplicatesHandler handles POST /api/library-panels/duplicates/check.
+func (lps *LibraryPanelService) checkDuplicatesHandler(c *models.ReqContext) response.Response {
+	if _, err := lps.checkDuplicateLibraryPanelsOfOrg(c.SignedInUser.OrgId); err != nil {
+		return errorResponse(err, "Failed to check for duplicate library panels")
+	}
+
+	return lps.getDuplicatesHandler(c)
+}
+
+// mergeHandler handles POST /api/library-panels/merge.
+func (lps *LibraryPanelService) mergeHandler(c *models.ReqContext, cmd mergeLibraryPanelsCommand) response.Response {
+	result, err := lps.mergeLibraryPanels(c, cmd)
+	if err != nil {
+		return errorResponse(err, "Failed to merge library panels")
+	}
+
+	return response.JSON(200, util.DynMap{"result": result})
+}
+
+// getBrokenReferencesHandler handles GET /api/library-panels/broken-references.
+func (lps *LibraryPanelService) getBrokenReferencesHandler(c *models.ReqContext) response.Response {
+	references, err := lps.getBrokenLibraryPanelReferences(c.SignedInUser.OrgId)
+	if err != nil {
+		return errorResponse(err, "Failed to get broken library panel references")
+	}
+
+	return response.JSON(200, util.DynMap{"result": references})
+}
+
+// repairBrokenReferencesHandler handles POST /api/library-panels/broken-references/repair.
+func (lps *LibraryPanelService) repairBrokenReferencesHandler(c *models.ReqContext, cmd repairBrokenReferencesCommand) response.Response {
+	result, err := lps.repairBrokenLibraryPanelReferences(c, cmd)
+	if err != nil {
+		return errorResponse(err, "Failed to repair broken library panel references")
+	}
+
+	return response.JSON(200, util.DynMap{"result": result})
+}
+
+// getPendingChangesHandler handles GET /api/library-panels/pending-changes.
+func (lps *LibraryPanelService) getPendingChangesHandler(c *models.ReqContext) response.Response {
+	changes, err := lps.getPendingChanges(c)
+	if err != nil {
+		return errorResponse(err, "Failed to get pending library panel changes")
+	}
+
+	return response.JSON(200, util.DynMap{"result": changes})
+}
+
+// approvePendingChangeHandler handles POST /api/library-panels/pending-changes/:id/approve.
+func (lps *LibraryPanelService) approvePendingChangeHandler(c *models.ReqContext) response.Response {
+	return lps.reviewPendingChangeResponse(c, true)
+}
+
+// rejectPendingChangeHandler handles POST /api/library-panels/pending-changes/:id/reject.
+func (lps *LibraryPanelService) rejectPendingChangeHandler(c *models.ReqContext) response.Response {
+	return lps.reviewPendingChangeResponse(c, false)
+}
+
+func (lps *LibraryPanelService) reviewPendingChangeResponse(c *models.ReqContext, approve bool) response.Response {
+	change, err := lps.reviewPendingChange(c, c.ParamsInt64(":id"), approve)
+	if err != nil {
+		return errorResponse(err, "Failed to review pending library panel change")
+	}
+
+	return response.JSON(200, util.DynMap{"result": change})
+}
+
+// errorResponse maps errors to responses with the code of the error, so API clients can branch on the kind of
+// error. Unexpected errors are responses with the status 500 and the message.
+func errorResponse(err error, message string) response.Response {
+	var libraryPanelErr *libraryPanelError
+	if errors.As(err, &libraryPanelErr) {
+		return response.JSON(libraryPanelErr.code.httpStatus(), util.DynMap{
+			"code":    libraryPanelErr.code,
+			"message": err.Error(),
+		})
+	}
+
+	var validationErrs modelValidationErrors
+	if errors.As(err, &validationErrs) {
+		return response.JSON(errorCodeInvalid.httpStatus(), util.DynMap{
+			"code":    errorCodeInvalid,
+			"message": "Invalid library panel model",
+			"errors":  validationErrs,
+		})
+	}
+
+	var dashboardErr models.DashboardErr
+	if errors.As(err, &dashboardErr) {
+		code := errorCodeInvalid
+		switch dashboardErr.StatusCode {
+		case 404:
+			code = errorCodeNotFound
+		case 403:
+			code = errorCodePermissionDenied
+		case 412:
+			code = errorCodeVersionMismatch
+		}
+		return response.JSON(dashboardErr.StatusCode, util.DynMap{
+			"code":    code,
+			"message": dashboardErr.Error(),
+		})
+	}
+
+	if errors.Is(err, models.ErrUserNotFound) {
+		return response.JSON(errorCodeNotFound.httpStatus(), util.DynMap{
+			"code":    errorCodeNotFound,
+			"message": "User not found",
+		})
+	}
+
+	return response.Error(500, message, err)
+}
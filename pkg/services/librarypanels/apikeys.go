@@ -0,0 +1,125 @@
+package librarypanels
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/sqlstore"
+)
+
+const (
+	// apiKeyAccessRead restricts an API key to reading Library Panels.
+	apiKeyAccessRead = "read"
+	// apiKeyAccessWrite lets an API key change Library Panels, within the permissions of its role.
+	apiKeyAccessWrite = "write"
+)
+
+// apiKeyAccess is the Library Panel access of an API key. API keys without access have write access.
+type apiKeyAccess struct {
+	ID       int64  `json:"-" xorm:"pk autoincr 'id'"`
+	OrgID    int64  `json:"-" xorm:"org_id"`
+	APIKeyID int64  `json:"apiKeyId" xorm:"api_key_id"`
+	Name     string `json:"name" xorm:"<- name"`
+	Access   string `json:"access"`
+}
+
+// setAPIKeyAccessCommand is the command for setting the Library Panel access of an API key.
+type setAPIKeyAccessCommand struct {
+	Access string `json:"access"`
+}
+
+// checkAPIKeyAccess rejects the requests of read only API keys that could change Library Panels. The access is read
+// from the primary database, so a key that was just restricted can't write while a replica lags.
+func (lps *LibraryPanelService) checkAPIKeyAccess(c *models.ReqContext) {
+	if c.SignedInUser == nil || c.SignedInUser.ApiKeyId == 0 || c.Req.Method == http.MethodGet || c.Req.Method == http.MethodHead {
+		return
+	}
+
+	var access string
+	err := lps.SQLStore.WithDbSession(context.Background(), func(session *sqlstore.DBSession) error {
+		_, err := session.SQL("SELECT access FROM library_panel_api_key_access WHERE org_id=? AND api_key_id=?",
+			c.SignedInUser.OrgId, c.SignedInUser.ApiKeyId).Get(&access)
+		return err
+	})
+	if err != nil {
+		errorResponse(err, "Failed to check API key access").WriteTo(c)
+		return
+	}
+	if access == apiKeyAccessRead {
+		errorResponse(errLibraryPanelReadOnlyAPIKey, "").WriteTo(c)
+	}
+}
+
+// getAPIKeyAccesses gets the API keys of the org with a Library Panel access, ordered by name.
+func (lps *LibraryPanelService) getAPIKeyAccesses(c *models.ReqContext) ([]apiKeyAccess, error) {
+	accesses := make([]apiKeyAccess, 0)
+	err := lps.SQLStore.WithReadReplicaDbSession(context.Background(), func(session *sqlstore.DBSession) error {
+		return session.SQL(`SELECT library_panel_api_key_access.*, api_key.name FROM library_panel_api_key_access
+			INNER JOIN api_key ON api_key.id = library_panel_api_key_access.api_key_id
+			WHERE library_panel_api_key_access.org_id=?
+			ORDER BY api_key.name ASC`, c.SignedInUser.OrgId).Find(&accesses)
+	})
+
+	return accesses, err
+}
+
+// setAPIKeyAccess sets the Library Panel access of an API key of the org.
+func (lps *LibraryPanelService) setAPIKeyAccess(c *models.ReqContext, apiKeyID int64, cmd setAPIKeyAccessCommand) (apiKeyAccess, error) {
+	if cmd.Access != apiKeyAccessRead && cmd.Access != apiKeyAccessWrite {
+		return apiKeyAccess{}, errLibraryPanelInvalidAPIKeyAccess
+	}
+
+	query := models.GetApiKeyByIdQuery{ApiKeyId: apiKeyID}
+	if err := bus.Dispatch(&query); err != nil {
+		if errors.Is(err, models.ErrInvalidApiKey) {
+			return apiKeyAccess{}, errLibraryPanelAPIKeyNotFound
+		}
+		return apiKeyAccess{}, err
+	}
+	if query.Result.OrgId != c.SignedInUser.OrgId {
+		return apiKeyAccess{}, errLibraryPanelAPIKeyNotFound
+	}
+
+	access := apiKeyAccess{OrgID: c.SignedInUser.OrgId, APIKeyID: apiKeyID, Name: query.Result.Name, Access: cmd.Access}
+	err := lps.SQLStore.WithTransactionalDbSession(context.Background(), func(session *sqlstore.DBSession) error {
+		if _, err := session.Exec("DELETE FROM library_panel_api_key_access WHERE api_key_id=?", apiKeyID); err != nil {
+			return err
+		}
+
+		_, err := session.Table("library_panel_api_key_access").Insert(&access)
+		return err
+	})
+
+	return access, err
+}
+
+// deleteAPIKeyAccess deletes the Library Panel access of an API key of the org, which gives it write access.
+func (lps *LibraryPanelService) deleteAPIKeyAccess(c *models.ReqContext, apiKeyID int64) error {
+	return lps.SQLStore.WithDbSession(context.Background(), func(session *sqlstore.DBSession) error {
+		result, err := session.Exec("DELETE FROM library_panel_api_key_access WHERE org_id=? AND api_key_id=?", c.SignedInUser.OrgId, apiKeyID)
+		if err != nil {
+			return err
+		}
+
+		if rowsAffected, err := result.RowsAffected(); err != nil {
+			return err
+		} else if rowsAffected == 0 {
+			return errLibraryPanelAPIKeyNotFound
+		}
+
+		return nil
+	})
+}
+
+// checkSignedInUser returns errLibraryPanelUserRequired for API keys, which have no user to store personal
+// settings like stars, comments and notification mutes for.
+func checkSignedInUser(user *models.SignedInUser) error {
+	if user.UserId <= 0 {
+		return errLibraryPanelUserRequired
+	}
+
+	return nil
+}
@@ -0,0 +1,180 @@
+package librarypanels
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/sqlstore"
+)
+
+const (
+	pendingChangeStatusPending  = "pending"
+	pendingChangeStatusApproved = "approved"
+	pendingChangeStatusRejected = "rejected"
+)
+
+// libraryPanelPendingChange is the model for changes to widely used Library Panels that wait for the
+// approval of an org admin.
+type libraryPanelPendingChange struct {
+	ID              int64  `json:"id" xorm:"pk autoincr 'id'"`
+	OrgID           int64  `json:"-" xorm:"org_id"`
+	LibraryPanelID  int64  `json:"-" xorm:"librarypanel_id"`
+	LibraryPanelUID string `json:"libraryPanelUid" xorm:"-"`
+	// Command is the JSON of the patchLibraryPanelCommand that is applied when the change is approved.
+	Command json.RawMessage `json:"command"`
+	Status  string          `json:"status"`
+
+	Requested   time.Time  `json:"requested"`
+	RequestedBy int64      `json:"requestedBy"`
+	Reviewed    *time.Time `json:"reviewed"`
+	ReviewedBy  *int64     `json:"reviewedBy"`
+}
+
+// requestApproval stores the patch as a pending change if it changes the model of a Library Panel that is
+// connected to more dashboards than the approval threshold, and returns whether it did. Changes by org
+// admins are never held for approval.
+func (lps *LibraryPanelService) requestApproval(c *models.ReqContext, cmd patchLibraryPanelCommand, uid string) (libraryPanelPendingChange, bool, error) {
+	threshold := lps.Cfg.LibraryPanels.ApprovalThreshold
+	if threshold <= 0 || cmd.Model == nil || c.SignedInUser.OrgRole == models.ROLE_ADMIN {
+		return libraryPanelPendingChange{}, false, nil
+	}
+
+	var change libraryPanelPendingChange
+	pending := false
+	err := lps.SQLStore.WithTransactionalDbSession(context.Background(), func(session *sqlstore.DBSession) error {
+		panel, err := getLibraryPanel(session, uid, c.SignedInUser.OrgId)
+		if err != nil {
+			return err
+		}
+		if err := checkCanEditLibraryPanel(session, lps.SQLStore.Dialect, c.SignedInUser, panel); err != nil {
+			return err
+		}
+
+		// changes that can't be applied are rejected by the patch right away
+		if panel.SyncPath != "" || panel.CatalogUID != "" {
+			return nil
+		}
+		if err := checkIfMatch(c, panel); err != nil {
+			return err
+		}
+		// the same model is a no-op for the patch
+		if modelHash(normalizeModel(panel.Kind, cmd.Model)) == panel.ModelHash {
+			return nil
+		}
+
+		connections, err := countConnectedDashboards(session, panel.ID)
+		if err != nil {
+			return err
+		}
+		if connections <= threshold {
+			return nil
+		}
+
+		// the model is validated now rather than when an admin approves the change
+		if err := validateElementModel(panel.Kind, cmd.Model, lps.Cfg.LibraryPanels); err != nil {
+			return err
+		}
+
+		command, err := json.Marshal(cmd)
+		if err != nil {
+			return err
+		}
+		change = libraryPanelPendingChange{
+			OrgID:           c.SignedInUser.OrgId,
+			LibraryPanelID:  panel.ID,
+			LibraryPanelUID: panel.UID,
+			Command:         command,
+			Status:          pendingChangeStatusPending,
+			Requested:       time.Now(),
+			RequestedBy:     c.SignedInUser.UserId,
+		}
+		if _, err := session.Insert(&change); err != nil {
+			return err
+		}
+
+		pending = true
+		return nil
+	})
+
+	return change, pending, err
+}
+
+// getPendingChanges gets the pending changes of the org, oldest first.
+func (lps *LibraryPanelService) getPendingChanges(c *models.ReqContext) ([]libraryPanelPendingChange, error) {
+	changes := make([]libraryPanelPendingChange, 0)
+	err := lps.SQLStore.WithReadReplicaDbSession(context.Background(), func(session *sqlstore.DBSession) error {
+		if err := session.Table("library_panel_pending_change").Where("org_id=? AND status=?", c.SignedInUser.OrgId, pendingChangeStatusPending).
+			OrderBy("requested ASC").Find(&changes); err != nil {
+			return err
+		}
+		if len(changes) == 0 {
+			return nil
+		}
+
+		ids := make([]int64, 0, len(changes))
+		for _, change := range changes {
+			ids = append(ids, change.LibraryPanelID)
+		}
+		var libraryPanels []LibraryPanel
+		if err := session.Table("library_panel").In("id", ids).Cols("id", "uid").Find(&libraryPanels); err != nil {
+			return err
+		}
+		uids := make(map[int64]string, len(libraryPanels))
+		for _, panel := range libraryPanels {
+			uids[panel.ID] = panel.UID
+		}
+		for i := range changes {
+			changes[i].LibraryPanelUID = uids[changes[i].LibraryPanelID]
+		}
+
+		return nil
+	})
+
+	return changes, err
+}
+
+// reviewPendingChange approves or rejects a pending change. An approved change is applied to the Library Panel.
+func (lps *LibraryPanelService) reviewPendingChange(c *models.ReqContext, id int64, approve bool) (libraryPanelPendingChange, error) {
+	var change libraryPanelPendingChange
+	var uid string
+	err := lps.SQLStore.WithDbSession(context.Background(), func(session *sqlstore.DBSession) error {
+		has, err := session.Table("library_panel_pending_change").Where("id=? AND org_id=? AND status=?", id, c.SignedInUser.OrgId, pendingChangeStatusPending).Get(&change)
+		if err != nil {
+			return err
+		}
+		if !has {
+			return errLibraryPanelPendingChangeNotFound
+		}
+
+		_, err = session.Table("library_panel").Where("id=?", change.LibraryPanelID).Cols("uid").Get(&uid)
+		return err
+	})
+	if err != nil {
+		return libraryPanelPendingChange{}, err
+	}
+	change.LibraryPanelUID = uid
+
+	change.Status = pendingChangeStatusRejected
+	if approve {
+		var cmd patchLibraryPanelCommand
+		if err := json.Unmarshal(change.Command, &cmd); err != nil {
+			return libraryPanelPendingChange{}, err
+		}
+		if _, err := lps.patchLibraryPanel(c, cmd, uid); err != nil {
+			return libraryPanelPendingChange{}, err
+		}
+		change.Status = pendingChangeStatusApproved
+	}
+
+	now := time.Now()
+	change.Reviewed = &now
+	change.ReviewedBy = &c.SignedInUser.UserId
+	err = lps.SQLStore.WithDbSession(context.Background(), func(session *sqlstore.DBSession) error {
+		_, err := session.ID(change.ID).Cols("status", "reviewed", "reviewed_by").Update(&change)
+		return err
+	})
+
+	return change, err
+}
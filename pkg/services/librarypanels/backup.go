@@ -0,0 +1,491 @@
+package librarypanels
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/sqlstore"
+	"github.com/grafana/grafana/pkg/setting"
+)
+
+const (
+	// backupVersion is the version of the backup format.
+	backupVersion = 1
+	// backupTimeFormat is the UTC time of a backup in its name, names sort in the order the backups were made.
+	backupTimeFormat = "20060102T150405Z"
+	// defaultBackupPath is the directory in the data path, or the key prefix in the bucket, of the backups.
+	defaultBackupPath = "library-panel-backups"
+)
+
+// backupNamePattern matches the names of backups, so that names can't be used to read other files.
+var backupNamePattern = regexp.MustCompile(`^library-panels-\d{8}T\d{6}Z\.json$`)
+
+// libraryPanelBackup is a backup of the Library Panels of all orgs.
+type libraryPanelBackup struct {
+	Name    string    `json:"name"`
+	Size    int64     `json:"size"`
+	Created time.Time `json:"created"`
+}
+
+// restoreBackupResult is the outcome of restoring the Library Panels of an org from a backup. Library Panels
+// are skipped if another Library Panel in their folder has their name.
+type restoreBackupResult struct {
+	Created []string `json:"created"`
+	Updated []string `json:"updated"`
+	Skipped []string `json:"skipped"`
+}
+
+// backupStorage stores the backups of the Library Panels.
+type backupStorage interface {
+	Save(ctx context.Context, name string, r io.Reader) error
+	// List returns the backups, oldest first.
+	List(ctx context.Context) ([]libraryPanelBackup, error)
+	Open(ctx context.Context, name string) (io.ReadCloser, error)
+	Delete(ctx context.Context, name string) error
+}
+
+// localBackupStorage is the backupStorage that stores the backups in a local directory.
+type localBackupStorage struct {
+	dir string
+}
+
+func (s localBackupStorage) Save(ctx context.Context, name string, r io.Reader) error {
+	if err := os.MkdirAll(s.dir, 0750); err != nil {
+		return err
+	}
+
+	// the backup is written next to its final name, so that incomplete backups are never listed
+	tmp, err := ioutil.TempFile(s.dir, ".backup-")
+	if err != nil {
+		return err
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+	if _, err := io.Copy(tmp, r); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), filepath.Join(s.dir, name))
+}
+
+func (s localBackupStorage) List(ctx context.Context) ([]libraryPanelBackup, error) {
+	files, err := ioutil.ReadDir(s.dir)
+	if os.IsNotExist(err) {
+		return []libraryPanelBackup{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	backups := make([]libraryPanelBackup, 0, len(files))
+	for _, file := range files {
+		if !file.IsDir() && backupNamePattern.MatchString(file.Name()) {
+			backups = append(backups, libraryPanelBackup{Name: file.Name(), Size: file.Size(), Created: backupCreated(file.Name())})
+		}
+	}
+
+	return backups, nil
+}
+
+func (s localBackupStorage) Open(ctx context.Context, name string) (io.ReadCloser, error) {
+	// #nosec G304 -- the name matches backupNamePattern
+	file, err := os.Open(filepath.Join(s.dir, name))
+	if os.IsNotExist(err) {
+		return nil, errLibraryPanelBackupNotFound
+	}
+
+	return file, err
+}
+
+func (s localBackupStorage) Delete(ctx context.Context, name string) error {
+	return os.Remove(filepath.Join(s.dir, name))
+}
+
+// s3BackupStorage is the backupStorage that stores the backups in an S3-compatible bucket.
+type s3BackupStorage struct {
+	bucket string
+	prefix string
+	config *aws.Config
+}
+
+func newS3BackupStorage(settings setting.LibraryPanelsSettings) s3BackupStorage {
+	prefix := strings.Trim(settings.BackupPath, "/")
+	if prefix == "" {
+		prefix = defaultBackupPath
+	}
+
+	config := &aws.Config{
+		Region:           aws.String(settings.BackupS3Region),
+		S3ForcePathStyle: aws.Bool(settings.BackupS3PathStyleAccess),
+	}
+	if settings.BackupS3Endpoint != "" {
+		config.Endpoint = aws.String(settings.BackupS3Endpoint)
+	}
+	// without keys the default credential chain is used, like the environment or the instance role
+	if settings.BackupS3AccessKey != "" {
+		config.Credentials = credentials.NewStaticCredentials(settings.BackupS3AccessKey, settings.BackupS3SecretKey, "")
+	}
+
+	return s3BackupStorage{bucket: settings.BackupS3Bucket, prefix: prefix + "/", config: config}
+}
+
+func (s s3BackupStorage) Save(ctx context.Context, name string, r io.Reader) error {
+	sess, err := session.NewSession(s.config)
+	if err != nil {
+		return err
+	}
+
+	_, err = s3manager.NewUploader(sess).UploadWithContext(ctx, &s3manager.UploadInput{
+		Bucket:      aws.String(s.bucket),
+		Key:         aws.String(s.prefix + name),
+		Body:        r,
+		ContentType: aws.String("application/json"),
+	})
+	return err
+}
+
+func (s s3BackupStorage) List(ctx context.Context) ([]libraryPanelBackup, error) {
+	sess, err := session.NewSession(s.config)
+	if err != nil {
+		return nil, err
+	}
+
+	backups := make([]libraryPanelBackup, 0)
+	err = s3.New(sess).ListObjectsV2PagesWithContext(ctx, &s3.ListObjectsV2Input{
+		Bucket: aws.String(s.bucket),
+		Prefix: aws.String(s.prefix),
+	}, func(page *s3.ListObjectsV2Output, lastPage bool) bool {
+		for _, object := range page.Contents {
+			name := strings.TrimPrefix(aws.StringValue(object.Key), s.prefix)
+			if backupNamePattern.MatchString(name) {
+				backups = append(backups, libraryPanelBackup{Name: name, Size: aws.Int64Value(object.Size), Created: backupCreated(name)})
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(backups, func(i, j int) bool { return backups[i].Name < backups[j].Name })
+	return backups, nil
+}
+
+func (s s3BackupStorage) Open(ctx context.Context, name string) (io.ReadCloser, error) {
+	sess, err := session.NewSession(s.config)
+	if err != nil {
+		return nil, err
+	}
+
+	object, err := s3.New(sess).GetObjectWithContext(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(s.prefix + name),
+	})
+	if err != nil {
+		var awsErr awserr.Error
+		if errors.As(err, &awsErr) && awsErr.Code() == s3.ErrCodeNoSuchKey {
+			return nil, errLibraryPanelBackupNotFound
+		}
+		return nil, err
+	}
+
+	return object.Body, nil
+}
+
+func (s s3BackupStorage) Delete(ctx context.Context, name string) error {
+	sess, err := session.NewSession(s.config)
+	if err != nil {
+		return err
+	}
+
+	_, err = s3.New(sess).DeleteObjectWithContext(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(s.prefix + name),
+	})
+	return err
+}
+
+func (lps *LibraryPanelService) backups() backupStorage {
+	if lps.backupStorage != nil {
+		return lps.backupStorage
+	}
+
+	settings := lps.Cfg.LibraryPanels
+	if settings.BackupS3Bucket != "" {
+		return newS3BackupStorage(settings)
+	}
+	dir := settings.BackupPath
+	if dir == "" {
+		dir = filepath.Join(lps.Cfg.DataPath, defaultBackupPath)
+	}
+
+	return localBackupStorage{dir: dir}
+}
+
+// backupCreated returns the time in the name of a backup.
+func backupCreated(name string) time.Time {
+	created, _ := time.Parse(backupTimeFormat, strings.TrimSuffix(strings.TrimPrefix(name, "library-panels-"), ".json"))
+	return created
+}
+
+// backupLibraryPanels backs up the Library Panels of all orgs, then deletes the backups beyond the retention,
+// if any.
+// The backup is streamed from the database to the storage.
+func (lps *LibraryPanelService) backupLibraryPanels(ctx context.Context) (libraryPanelBackup, error) {
+	now := time.Now().UTC()
+	backup := libraryPanelBackup{Name: "library-panels-" + now.Format(backupTimeFormat) + ".json", Created: now.Truncate(time.Second)}
+	storage := lps.backups()
+
+	reader, writer := io.Pipe()
+	go func() {
+		err := lps.SQLStore.WithReadReplicaDbSession(context.Background(), func(session *sqlstore.DBSession) error {
+			builder := sqlstore.SQLBuilder{}
+			builder.Write("SELECT library_panel.* FROM library_panel ORDER BY library_panel.org_id ASC, library_panel.id ASC")
+
+			if _, err := fmt.Fprintf(writer, `{"version":%d,"created":%q,"libraryPanels":`, backupVersion, backup.Created.Format(time.RFC3339)); err != nil {
+				return err
+			}
+			if err := lps.writeLibraryPanelsJSON(session, builder, writer); err != nil {
+				return err
+			}
+
+			_, err := io.WriteString(writer, "}")
+			return err
+		})
+		// a failed backup fails the save, so that it isn't stored incomplete
+		writer.CloseWithError(err)
+	}()
+	err := storage.Save(ctx, backup.Name, reader)
+	// stops the database read if the storage failed first
+	_ = reader.CloseWithError(err)
+	if err != nil {
+		return libraryPanelBackup{}, err
+	}
+
+	retention := int(lps.Cfg.LibraryPanels.BackupRetention)
+	if retention <= 0 {
+		return backup, nil
+	}
+	backups, err := storage.List(ctx)
+	if err != nil {
+		return backup, err
+	}
+	for i := 0; i < len(backups)-retention; i++ {
+		if err := storage.Delete(ctx, backups[i].Name); err != nil {
+			return backup, err
+		}
+	}
+
+	return backup, nil
+}
+
+// getBackups gets the backups of the Library Panels, newest first.
+func (lps *LibraryPanelService) getBackups(c *models.ReqContext) ([]libraryPanelBackup, error) {
+	backups, err := lps.backups().List(c.Req.Context())
+	if err != nil {
+		return nil, err
+	}
+
+	for i, j := 0, len(backups)-1; i < j; i, j = i+1, j-1 {
+		backups[i], backups[j] = backups[j], backups[i]
+	}
+	return backups, nil
+}
+
+// restoreBackup restores the Library Panels of the org of the user from a backup. Library Panels that still
+// exist are updated, the others are created again with the same UID, so that dashboards using them work
+// again. Library Panels that were created since the backup are kept. Library Panels whose folder was deleted
+// are restored to the General folder.
+func (lps *LibraryPanelService) restoreBackup(c *models.ReqContext, name string) (restoreBackupResult, error) {
+	file, err := lps.openBackup(c, name)
+	if err != nil {
+		return restoreBackupResult{}, err
+	}
+	defer func() { _ = file.Close() }()
+
+	result := restoreBackupResult{Created: []string{}, Updated: []string{}, Skipped: []string{}}
+	err = lps.SQLStore.WithTransactionalDbSession(context.Background(), func(session *sqlstore.DBSession) error {
+		return readBackupLibraryPanels(file, func(panel LibraryPanel) error {
+			if panel.OrgID != c.SignedInUser.OrgId {
+				return nil
+			}
+
+			created, err := lps.restoreBackupLibraryPanel(session, c, panel)
+			switch {
+			case errors.Is(err, errLibraryPanelAlreadyExists):
+				result.Skipped = append(result.Skipped, panel.UID)
+			case err != nil:
+				return err
+			case created:
+				result.Created = append(result.Created, panel.UID)
+			default:
+				result.Updated = append(result.Updated, panel.UID)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return restoreBackupResult{}, err
+	}
+	lps.invalidateLibraryPanelCache()
+
+	return result, nil
+}
+
+// restoreBackupPanel restores one Library Panel of the org of the user from a backup, like restoreBackup.
+// The restore is a new change of the Library Panel, it fails if another Library Panel in its folder has its name.
+func (lps *LibraryPanelService) restoreBackupPanel(c *models.ReqContext, name string, uid string) (LibraryPanel, error) {
+	file, err := lps.openBackup(c, name)
+	if err != nil {
+		return LibraryPanel{}, err
+	}
+	defer func() { _ = file.Close() }()
+
+	err = lps.SQLStore.WithTransactionalDbSession(context.Background(), func(session *sqlstore.DBSession) error {
+		found := false
+		err := readBackupLibraryPanels(file, func(panel LibraryPanel) error {
+			if found || panel.OrgID != c.SignedInUser.OrgId || panel.UID != uid {
+				return nil
+			}
+
+			found = true
+			_, err := lps.restoreBackupLibraryPanel(session, c, panel)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		if !found {
+			return errLibraryPanelNotFound
+		}
+		return nil
+	})
+	if err != nil {
+		return LibraryPanel{}, err
+	}
+	lps.invalidateLibraryPanelCache()
+
+	return lps.getLibraryPanel(c, uid)
+}
+
+func (lps *LibraryPanelService) openBackup(c *models.ReqContext, name string) (io.ReadCloser, error) {
+	if !backupNamePattern.MatchString(name) {
+		return nil, errLibraryPanelBackupNotFound
+	}
+
+	return lps.backups().Open(c.Req.Context(), name)
+}
+
+// restoreBackupLibraryPanel updates or creates a Library Panel from a backup, and returns whether it was created.
+// It returns errLibraryPanelAlreadyExists if another Library Panel in its folder has its name.
+func (lps *LibraryPanelService) restoreBackupLibraryPanel(session *sqlstore.DBSession, c *models.ReqContext, panel LibraryPanel) (bool, error) {
+	orgID := c.SignedInUser.OrgId
+	if panel.FolderID != 0 {
+		exists, err := session.Table("dashboard").Where("id=? AND org_id=? AND is_folder=?", panel.FolderID, orgID, true).Exist()
+		if err != nil {
+			return false, err
+		}
+		if !exists {
+			panel.FolderID = 0
+		}
+	}
+
+	var existing LibraryPanel
+	exists, err := session.Table("library_panel").Where("org_id=? AND uid=?", orgID, panel.UID).Get(&existing)
+	if err != nil {
+		return false, err
+	}
+	conflict, err := session.Table("library_panel").Where("org_id=? AND folder_id=? AND name=? AND kind=? AND uid<>?",
+		orgID, panel.FolderID, panel.Name, panel.Kind, panel.UID).Exist()
+	if err != nil {
+		return false, err
+	}
+	if conflict {
+		return false, errLibraryPanelAlreadyExists
+	}
+
+	panel.ModelHash = modelHash(panel.Model)
+	panel.Updated = time.Now()
+	panel.UpdatedBy = c.SignedInUser.UserId
+	panel.modelCompression = lps.modelCompression
+	if exists {
+		panel.ID = existing.ID
+		if _, err := session.ID(existing.ID).Cols("folder_id", "name", "kind", "model", "model_hash", "schema_version", "status", "updated", "updated_by").
+			Update(&panel); err != nil {
+			return false, err
+		}
+	} else {
+		panel.ID = 0
+		// the connections are made again when the dashboards using the Library Panel are saved
+		panel.LastConnectedAt = nil
+		if _, err := session.Insert(&panel); err != nil {
+			return false, err
+		}
+	}
+
+	if err := setLibraryPanelTags(session, panel.ID, normalizeTags(panel.Tags)); err != nil {
+		return false, err
+	}
+	return !exists, setLibraryPanelDatasources(session, panel.ID, panel.Model)
+}
+
+// readBackupLibraryPanels decodes the Library Panels of a backup one at a time, so that large backups aren't
+// read into memory.
+func readBackupLibraryPanels(r io.Reader, fn func(panel LibraryPanel) error) error {
+	decoder := json.NewDecoder(r)
+	if _, err := decoder.Token(); err != nil {
+		return err
+	}
+	for decoder.More() {
+		key, err := decoder.Token()
+		if err != nil {
+			return err
+		}
+		if key != "libraryPanels" {
+			var skipped json.RawMessage
+			if err := decoder.Decode(&skipped); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if _, err := decoder.Token(); err != nil {
+			return err
+		}
+		for decoder.More() {
+			var panel LibraryPanel
+			if err := decoder.Decode(&panel); err != nil {
+				return err
+			}
+			if err := fn(panel); err != nil {
+				return err
+			}
+		}
+		if _, err := decoder.Token(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
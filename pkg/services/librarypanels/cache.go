@@ -0,0 +1,110 @@
+package librarypanels
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/grafana/grafana/pkg/infra/localcache"
+	"github.com/grafana/grafana/pkg/infra/remotecache"
+	"github.com/grafana/grafana/pkg/util"
+)
+
+// cacheGenerationKey is the remote cache key of the generation of the Library Panel caches. Every change of a
+// Library Panel stores a new generation, and each Grafana server drops its cache when it sees another one, so
+// that a change made on one server is visible on the others right away. Grafana Live doesn't forward messages
+// between servers, the remote cache is what all servers of a high availability setup share.
+const cacheGenerationKey = "library-panels-cache-generation"
+
+// libraryPanelCache caches the library elements that dashboards are loaded with, on this Grafana server.
+type libraryPanelCache struct {
+	mu         sync.Mutex
+	generation string
+	elements   *localcache.CacheService
+}
+
+func newLibraryPanelCache() *libraryPanelCache {
+	return &libraryPanelCache{elements: localcache.New(time.Minute, 10*time.Minute)}
+}
+
+func libraryPanelCacheKey(orgID int64, kind libraryElementKind, uid string) string {
+	return fmt.Sprintf("%d/%d/%s", orgID, kind, uid)
+}
+
+// get returns the cached library elements, and the UIDs that aren't cached. The cache is flushed first if the
+// generation changed.
+func (cache *libraryPanelCache) get(generation string, orgID int64, kind libraryElementKind, uids []string) ([]LibraryPanel, []string) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	if generation != cache.generation {
+		cache.elements.Flush()
+		cache.generation = generation
+	}
+
+	found := make([]LibraryPanel, 0, len(uids))
+	missing := make([]string, 0)
+	for _, uid := range uids {
+		if element, ok := cache.elements.Get(libraryPanelCacheKey(orgID, kind, uid)); ok {
+			found = append(found, element.(LibraryPanel))
+		} else {
+			missing = append(missing, uid)
+		}
+	}
+
+	return found, missing
+}
+
+// set caches library elements read in the generation, unless the generation changed while they were read.
+func (cache *libraryPanelCache) set(generation string, elements []LibraryPanel, ttl time.Duration) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	if generation != cache.generation {
+		return
+	}
+	for _, element := range elements {
+		cache.elements.Set(libraryPanelCacheKey(element.OrgID, element.Kind, element.UID), element, ttl)
+	}
+}
+
+func (cache *libraryPanelCache) flush() {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	cache.elements.Flush()
+}
+
+// cacheEnabled returns true if library elements are cached.
+func (lps *LibraryPanelService) cacheEnabled() bool {
+	return lps.panelCache != nil && lps.Cfg.LibraryPanels.CacheTTL > 0
+}
+
+// getCacheGeneration gets the generation of the Library Panel caches from the remote cache. The generation is
+// empty until a Library Panel changes.
+func (lps *LibraryPanelService) getCacheGeneration() (string, error) {
+	value, err := lps.RemoteCache.Get(cacheGenerationKey)
+	if errors.Is(err, remotecache.ErrCacheItemNotFound) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	generation, _ := value.(string)
+	return generation, nil
+}
+
+// invalidateLibraryPanelCache drops the cached library elements of all Grafana servers. It is called after
+// library elements are changed or deleted, created ones aren't cached yet.
+func (lps *LibraryPanelService) invalidateLibraryPanelCache() {
+	if !lps.cacheEnabled() {
+		return
+	}
+
+	lps.panelCache.flush()
+	if err := lps.RemoteCache.Set(cacheGenerationKey, util.GenerateShortUID(), 0); err != nil {
+		lps.log.Warn("Failed to invalidate the library panel caches of the other servers", "error", err)
+	}
+}
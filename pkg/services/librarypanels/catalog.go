@@ -0,0 +1,197 @@
+package librarypanels
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/sqlstore"
+	"github.com/grafana/grafana/pkg/util"
+)
+
+// catalogPanel is the model for the panels in the instance wide catalog, that org admins can install into
+// their org.
+type catalogPanel struct {
+	ID          int64           `json:"id" xorm:"pk autoincr 'id'"`
+	UID         string          `json:"uid" xorm:"uid"`
+	Name        string          `json:"name"`
+	Description string          `json:"description"`
+	Model       json.RawMessage `json:"model"`
+
+	Created time.Time `json:"created"`
+	Updated time.Time `json:"updated"`
+
+	CreatedBy int64 `json:"createdBy"`
+	UpdatedBy int64 `json:"updatedBy"`
+}
+
+// saveCatalogPanelCommand is the command for adding or updating a catalog panel.
+type saveCatalogPanelCommand struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description"`
+	Model       json.RawMessage `json:"model"`
+}
+
+// installCatalogPanelCommand is the command for installing a catalog panel into an org.
+type installCatalogPanelCommand struct {
+	FolderID int64 `json:"folderId"`
+	// Name is the name of the installed Library Panel, the name of the catalog panel if not set.
+	Name string `json:"name"`
+	// Linked installs a reference that follows the catalog panel, rather than a copy.
+	Linked bool `json:"linked"`
+}
+
+// createCatalogPanel adds a panel to the catalog.
+func (lps *LibraryPanelService) createCatalogPanel(c *models.ReqContext, cmd saveCatalogPanelCommand) (catalogPanel, error) {
+	if err := validateModel(cmd.Model, lps.Cfg.LibraryPanels); err != nil {
+		return catalogPanel{}, err
+	}
+
+	now := time.Now()
+	panel := catalogPanel{
+		UID:         util.GenerateShortUID(),
+		Name:        cmd.Name,
+		Description: cmd.Description,
+		Model:       cmd.Model,
+		Created:     now,
+		Updated:     now,
+		CreatedBy:   c.SignedInUser.UserId,
+		UpdatedBy:   c.SignedInUser.UserId,
+	}
+	err := lps.SQLStore.WithTransactionalDbSession(context.Background(), func(session *sqlstore.DBSession) error {
+		if _, err := session.Table("library_panel_catalog").Insert(&panel); err != nil {
+			if lps.SQLStore.Dialect.IsUniqueConstraintViolation(err) {
+				return errLibraryPanelCatalogPanelAlreadyExists
+			}
+			return err
+		}
+
+		return nil
+	})
+
+	return panel, err
+}
+
+func getCatalogPanel(session *sqlstore.DBSession, uid string) (catalogPanel, error) {
+	var panel catalogPanel
+	has, err := session.Table("library_panel_catalog").Where("uid=?", uid).Get(&panel)
+	if err != nil {
+		return catalogPanel{}, err
+	}
+	if !has {
+		return catalogPanel{}, errLibraryPanelCatalogPanelNotFound
+	}
+
+	return panel, nil
+}
+
+// getCatalogPanel gets a catalog panel.
+func (lps *LibraryPanelService) getCatalogPanel(uid string) (catalogPanel, error) {
+	var panel catalogPanel
+	err := lps.SQLStore.WithReadReplicaDbSession(context.Background(), func(session *sqlstore.DBSession) error {
+		var err error
+		panel, err = getCatalogPanel(session, uid)
+		return err
+	})
+
+	return panel, err
+}
+
+// getAllCatalogPanels gets all panels in the catalog.
+func (lps *LibraryPanelService) getAllCatalogPanels() ([]catalogPanel, error) {
+	panels := make([]catalogPanel, 0)
+	err := lps.SQLStore.WithReadReplicaDbSession(context.Background(), func(session *sqlstore.DBSession) error {
+		return session.Table("library_panel_catalog").OrderBy("name ASC").Find(&panels)
+	})
+
+	return panels, err
+}
+
+// updateCatalogPanel updates a catalog panel, and the model of the Library Panels that are linked to it.
+func (lps *LibraryPanelService) updateCatalogPanel(c *models.ReqContext, uid string, cmd saveCatalogPanelCommand) (catalogPanel, error) {
+	if err := validateModel(cmd.Model, lps.Cfg.LibraryPanels); err != nil {
+		return catalogPanel{}, err
+	}
+
+	var panel catalogPanel
+	err := lps.SQLStore.WithTransactionalDbSession(context.Background(), func(session *sqlstore.DBSession) error {
+		var err error
+		panel, err = getCatalogPanel(session, uid)
+		if err != nil {
+			return err
+		}
+
+		panel.Name = cmd.Name
+		panel.Description = cmd.Description
+		panel.Model = cmd.Model
+		panel.Updated = time.Now()
+		panel.UpdatedBy = c.SignedInUser.UserId
+		if _, err := session.Table("library_panel_catalog").ID(panel.ID).Cols("name", "description", "model", "updated", "updated_by").Update(&panel); err != nil {
+			if lps.SQLStore.Dialect.IsUniqueConstraintViolation(err) {
+				return errLibraryPanelCatalogPanelAlreadyExists
+			}
+			return err
+		}
+
+		var linked []LibraryPanel
+		if err := session.Table("library_panel").Where("catalog_uid=?", uid).Find(&linked); err != nil {
+			return err
+		}
+		for _, libraryPanel := range linked {
+			if _, err := session.Exec("UPDATE library_panel SET model=?, model_hash=?, schema_version=?, updated=? WHERE id=?",
+				string(encodeStoredModel(panel.Model, lps.modelCompression)), modelHash(panel.Model), currentPanelSchemaVersion, panel.Updated, libraryPanel.ID); err != nil {
+				return err
+			}
+			if err := setLibraryPanelDatasources(session, libraryPanel.ID, panel.Model); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err == nil {
+		lps.invalidateLibraryPanelCache()
+	}
+
+	return panel, err
+}
+
+// deleteCatalogPanel deletes a catalog panel. Library Panels linked to it are kept as copies.
+func (lps *LibraryPanelService) deleteCatalogPanel(uid string) error {
+	return lps.SQLStore.WithTransactionalDbSession(context.Background(), func(session *sqlstore.DBSession) error {
+		panel, err := getCatalogPanel(session, uid)
+		if err != nil {
+			return err
+		}
+
+		if _, err := session.Exec("UPDATE library_panel SET catalog_uid='' WHERE catalog_uid=?", panel.UID); err != nil {
+			return err
+		}
+		_, err = session.Exec("DELETE FROM library_panel_catalog WHERE id=?", panel.ID)
+		return err
+	})
+}
+
+// installCatalogPanel adds a catalog panel to the org of the user as a Library Panel.
+func (lps *LibraryPanelService) installCatalogPanel(c *models.ReqContext, uid string, cmd installCatalogPanelCommand) (LibraryPanel, error) {
+	panel, err := lps.getCatalogPanel(uid)
+	if err != nil {
+		return LibraryPanel{}, err
+	}
+
+	createCmd := createLibraryPanelCommand{
+		FolderID: &cmd.FolderID,
+		Name:     cmd.Name,
+		Kind:     panelElement,
+		Model:    panel.Model,
+	}
+	if createCmd.Name == "" {
+		createCmd.Name = panel.Name
+	}
+	if cmd.Linked {
+		createCmd.CatalogUID = panel.UID
+	}
+
+	return lps.createLibraryPanel(c, createCmd)
+}
@@ -0,0 +1,457 @@
+package librarypanels
+
+import (
+	"context"
+	"time"
+
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/sqlstore"
+)
+
+const (
+	cleanupActionArchive = "archive"
+	cleanupActionDelete  = "delete"
+
+	defaultUnusedOlderThanDays  = 30
+	defaultCleanupOlderThanDays = 90
+	defaultCleanupInterval      = time.Hour
+)
+
+// libraryPanelCleanupPolicy is the model for the per org policy for cleaning up unused Library Panels.
+type libraryPanelCleanupPolicy struct {
+	ID            int64    `json:"-" xorm:"pk autoincr 'id'"`
+	OrgID         int64    `json:"-" xorm:"org_id"`
+	Enabled       bool     `json:"enabled"`
+	OlderThanDays int64    `json:"olderThanDays"`
+	Action        string   `json:"action"`
+	ExcludedUIDs  []string `json:"excludedUids" xorm:"excluded_uids"`
+
+	Created time.Time `json:"-"`
+	Updated time.Time `json:"updated"`
+}
+
+// libraryPanelArchive is the model for Library Panels archived by the cleanup policy or by merges.
+type libraryPanelArchive struct {
+	ID        int64  `xorm:"pk autoincr 'id'"`
+	OrgID     int64  `xorm:"org_id"`
+	FolderID  int64  `xorm:"folder_id"`
+	UID       string `xorm:"uid"`
+	Name      string
+	Model     string
+	Created   time.Time
+	CreatedBy int64
+	Archived  time.Time
+}
+
+// getUnusedLibraryPanelsQuery is the query for listing unused LibraryPanels.
+type getUnusedLibraryPanelsQuery struct {
+	// OlderThanDays is how long a Library Panel must have existed, and not been connected, to be unused.
+	OlderThanDays int64
+}
+
+// updateCleanupPolicyCommand is the command for updating the cleanup policy of an org.
+type updateCleanupPolicyCommand struct {
+	Enabled       bool     `json:"enabled"`
+	OlderThanDays int64    `json:"olderThanDays"`
+	Action        string   `json:"action"`
+	ExcludedUIDs  []string `json:"excludedUids"`
+}
+
+// defaultCleanupPolicy is the cleanup policy of orgs that didn't set one, with the number of days of the
+// cleanup_older_than_days setting.
+func (lps *LibraryPanelService) defaultCleanupPolicy(orgID int64) libraryPanelCleanupPolicy {
+	olderThanDays := lps.Cfg.LibraryPanels.CleanupOlderThanDays
+	if olderThanDays <= 0 {
+		olderThanDays = defaultCleanupOlderThanDays
+	}
+
+	return libraryPanelCleanupPolicy{
+		OrgID:         orgID,
+		OlderThanDays: olderThanDays,
+		Action:        cleanupActionArchive,
+		ExcludedUIDs:  []string{},
+	}
+}
+
+// Run upgrades the stale stored Library Panel models and converts them to the configured compression, and runs
+// the scheduled Git syncs, the checks of dashboards for broken references and of duplicate Library Panels, the
+// deletion of expired library query versions and feed changes, and the cleanup of unused Library Panels for the
+// orgs that opted in, and writes the views of Library Panels counted on this server. The cleanup doesn't run if cleanup_enabled is off, the thumbnails are only rendered if
+// thumbnails_enabled is on and the backups only run if backup_enabled is on. The queued Library Panel updates are
+// propagated to the connected dashboards by a goroutine of their own.
+func (lps *LibraryPanelService) Run(ctx context.Context) error {
+	go lps.runPropagations(ctx)
+
+	err := lps.ServerLockService.LockAndExecute(ctx, "upgrade library panel models", time.Hour, func() {
+		if count, err := lps.upgradeStoredLibraryPanelModels(); err != nil {
+			lps.log.Error("Failed to upgrade library panel models", "error", err)
+		} else if count > 0 {
+			lps.log.Info("Upgraded library panel models", "count", count, "schemaVersion", currentPanelSchemaVersion)
+		}
+	})
+	if err != nil {
+		lps.log.Error("failed to lock and execute upgrade of library panel models", "error", err)
+	}
+	err = lps.ServerLockService.LockAndExecute(ctx, "convert library panel model compression", time.Hour, func() {
+		if count, err := lps.convertStoredModels(); err != nil {
+			lps.log.Error("Failed to convert library panel model compression", "error", err)
+		} else if count > 0 {
+			lps.log.Info("Converted library panel model compression", "count", count, "compression", lps.modelCompression)
+		}
+	})
+	if err != nil {
+		lps.log.Error("failed to lock and execute conversion of library panel model compression", "error", err)
+	}
+	// the database filters on paths inside the models once no model is stored compressed anymore, which can take
+	// until another server converted them
+	var storedModelsTick <-chan time.Time
+	if uncompressed, err := lps.checkStoredModels(); err != nil || !uncompressed {
+		if err != nil {
+			lps.log.Error("Failed to check library panel model compression", "error", err)
+		}
+		if lps.modelCompression == modelCompressionNone {
+			ticker := time.NewTicker(storedModelsCheckInterval)
+			defer ticker.Stop()
+			storedModelsTick = ticker.C
+		}
+	}
+
+	// a nil channel never receives, so a disabled cleanup is never selected
+	var cleanupTick <-chan time.Time
+	interval := lps.Cfg.LibraryPanels.CleanupInterval
+	if interval <= 0 {
+		interval = defaultCleanupInterval
+	}
+	if lps.Cfg.LibraryPanels.CleanupEnabled {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		cleanupTick = ticker.C
+	}
+	var backupTick <-chan time.Time
+	if lps.Cfg.LibraryPanels.BackupEnabled {
+		ticker := time.NewTicker(lps.Cfg.LibraryPanels.BackupInterval)
+		defer ticker.Stop()
+		backupTick = ticker.C
+	}
+	var thumbnailTick <-chan time.Time
+	if lps.Cfg.LibraryPanels.ThumbnailsEnabled {
+		ticker := time.NewTicker(thumbnailRenderInterval)
+		defer ticker.Stop()
+		thumbnailTick = ticker.C
+	}
+	syncTicker := time.NewTicker(gitSyncCheckInterval)
+	defer syncTicker.Stop()
+	replicationTicker := time.NewTicker(replicationReconcileInterval)
+	defer replicationTicker.Stop()
+	scheduledChangeTicker := time.NewTicker(scheduledChangeCheckInterval)
+	defer scheduledChangeTicker.Stop()
+	brokenReferenceTicker := time.NewTicker(brokenReferenceCheckInterval)
+	defer brokenReferenceTicker.Stop()
+	versionRetentionTicker := time.NewTicker(versionRetentionInterval)
+	defer versionRetentionTicker.Stop()
+	changeRetentionTicker := time.NewTicker(changeRetentionInterval)
+	defer changeRetentionTicker.Stop()
+	duplicateCheckTicker := time.NewTicker(duplicateCheckInterval)
+	defer duplicateCheckTicker.Stop()
+	viewFlushTicker := time.NewTicker(viewFlushInterval)
+	defer viewFlushTicker.Stop()
+	for {
+		select {
+		case <-versionRetentionTicker.C:
+			err := lps.ServerLockService.LockAndExecute(ctx, "delete expired library query versions", versionRetentionInterval, func() {
+				if result, err := lps.deleteExpiredLibraryQueryVersions(); err != nil {
+					lps.log.Error("Failed to delete expired library query versions", "error", err)
+				} else if result.Deleted > 0 {
+					lps.log.Info("Deleted expired library query versions", "count", result.Deleted)
+				}
+			})
+			if err != nil {
+				lps.log.Error("failed to lock and execute deletion of expired library query versions", "error", err)
+			}
+		case <-changeRetentionTicker.C:
+			err := lps.ServerLockService.LockAndExecute(ctx, "delete expired library panel changes", changeRetentionInterval, func() {
+				if count, err := lps.deleteExpiredLibraryPanelChanges(); err != nil {
+					lps.log.Error("Failed to delete expired library panel changes", "error", err)
+				} else if count > 0 {
+					lps.log.Info("Deleted expired library panel changes", "count", count)
+				}
+			})
+			if err != nil {
+				lps.log.Error("failed to lock and execute deletion of expired library panel changes", "error", err)
+			}
+		case <-duplicateCheckTicker.C:
+			err := lps.ServerLockService.LockAndExecute(ctx, "check duplicate library panels", duplicateCheckInterval, func() {
+				if _, err := lps.checkDuplicateLibraryPanels(); err != nil {
+					lps.log.Error("Failed to check duplicate library panels", "error", err)
+				}
+			})
+			if err != nil {
+				lps.log.Error("failed to lock and execute check of duplicate library panels", "error", err)
+			}
+		case <-brokenReferenceTicker.C:
+			err := lps.ServerLockService.LockAndExecute(ctx, "check broken library panel references", brokenReferenceCheckInterval, func() {
+				if _, err := lps.checkBrokenLibraryPanelReferences(); err != nil {
+					lps.log.Error("Failed to check broken library panel references", "error", err)
+				}
+			})
+			if err != nil {
+				lps.log.Error("failed to lock and execute check of broken library panel references", "error", err)
+			}
+		case <-scheduledChangeTicker.C:
+			err := lps.ServerLockService.LockAndExecute(ctx, "publish scheduled library panel changes", scheduledChangeCheckInterval, func() {
+				if count, err := lps.publishDueScheduledChanges(); err != nil {
+					lps.log.Error("Failed to publish scheduled library panel changes", "error", err)
+				} else if count > 0 {
+					lps.log.Info("Published scheduled library panel changes", "count", count)
+				}
+			})
+			if err != nil {
+				lps.log.Error("failed to lock and execute publication of scheduled library panel changes", "error", err)
+			}
+		case <-syncTicker.C:
+			err := lps.ServerLockService.LockAndExecute(ctx, "sync library panels from git", gitSyncCheckInterval, func() {
+				if err := lps.syncDueLibraryPanels(ctx); err != nil {
+					lps.log.Error("Failed to sync library panels from git", "error", err)
+				}
+			})
+			if err != nil {
+				lps.log.Error("failed to lock and execute sync of library panels from git", "error", err)
+			}
+		case <-replicationTicker.C:
+			err := lps.ServerLockService.LockAndExecute(ctx, "reconcile replicated library panels", replicationReconcileInterval, func() {
+				if _, err := lps.reconcileReplicatedLibraryPanels(); err != nil {
+					lps.log.Error("Failed to reconcile replicated library panels", "error", err)
+				}
+			})
+			if err != nil {
+				lps.log.Error("failed to lock and execute reconciliation of replicated library panels", "error", err)
+			}
+		case <-cleanupTick:
+			err := lps.ServerLockService.LockAndExecute(ctx, "cleanup unused library panels", interval, func() {
+				if _, err := lps.cleanUpUnusedLibraryPanels(); err != nil {
+					lps.log.Error("Failed to clean up unused library panels", "error", err)
+				}
+			})
+			if err != nil {
+				lps.log.Error("failed to lock and execute cleanup of unused library panels", "error", err)
+			}
+		case <-backupTick:
+			err := lps.ServerLockService.LockAndExecute(ctx, "back up library panels", lps.Cfg.LibraryPanels.BackupInterval, func() {
+				if backup, err := lps.backupLibraryPanels(ctx); err != nil {
+					lps.log.Error("Failed to back up library panels", "error", err)
+				} else {
+					lps.log.Info("Backed up library panels", "name", backup.Name)
+				}
+			})
+			if err != nil {
+				lps.log.Error("failed to lock and execute backup of library panels", "error", err)
+			}
+		case <-thumbnailTick:
+			err := lps.ServerLockService.LockAndExecute(ctx, "render library panel thumbnails", thumbnailRenderInterval, func() {
+				if _, err := lps.renderStaleThumbnails(ctx); err != nil {
+					lps.log.Error("Failed to render library panel thumbnails", "error", err)
+				}
+			})
+			if err != nil {
+				lps.log.Error("failed to lock and execute rendering of library panel thumbnails", "error", err)
+			}
+		case <-storedModelsTick:
+			if uncompressed, err := lps.checkStoredModels(); err != nil {
+				lps.log.Error("Failed to check library panel model compression", "error", err)
+			} else if uncompressed {
+				storedModelsTick = nil
+			}
+		case <-viewFlushTicker.C:
+			// every server writes the views it counted itself, so no server lock is taken
+			if _, err := lps.flushLibraryPanelViews(); err != nil {
+				lps.log.Error("Failed to record library panel views", "error", err)
+			}
+		case <-ctx.Done():
+			if _, err := lps.flushLibraryPanelViews(); err != nil {
+				lps.log.Error("Failed to record library panel views", "error", err)
+			}
+			return ctx.Err()
+		}
+	}
+}
+
+// IsDisabled returns true if the Panel Library feature is disabled, in which case no cleanup is scheduled.
+func (lps *LibraryPanelService) IsDisabled() bool {
+	return !lps.IsEnabled()
+}
+
+// getUnusedLibraryPanels gets the Library Panels in the org without connected dashboards that were
+// neither created nor connected in the last OlderThanDays days. Pinned Library Panels are never unused.
+func (lps *LibraryPanelService) getUnusedLibraryPanels(c *models.ReqContext, query getUnusedLibraryPanelsQuery) ([]LibraryPanel, error) {
+	if query.OlderThanDays <= 0 {
+		query.OlderThanDays = defaultUnusedOlderThanDays
+	}
+
+	libraryPanels := make([]LibraryPanel, 0)
+	err := lps.SQLStore.WithReadReplicaDbSession(context.Background(), func(session *sqlstore.DBSession) error {
+		var err error
+		libraryPanels, err = getUnusedLibraryPanels(session, c.SignedInUser.OrgId, query.OlderThanDays)
+		return err
+	})
+
+	return libraryPanels, err
+}
+
+func getUnusedLibraryPanels(session *sqlstore.DBSession, orgID int64, olderThanDays int64) ([]LibraryPanel, error) {
+	cutoff := time.Now().AddDate(0, 0, -int(olderThanDays))
+	libraryPanels := make([]LibraryPanel, 0)
+	err := session.SQL(`SELECT library_panel.* FROM library_panel
+		WHERE library_panel.org_id=? AND library_panel.created < ?
+		AND (library_panel.last_connected_at IS NULL OR library_panel.last_connected_at < ?)
+		AND NOT EXISTS (SELECT 1 FROM library_panel_dashboard WHERE library_panel_dashboard.librarypanel_id = library_panel.id)
+		AND library_panel.pinned=? ORDER BY library_panel.name ASC`, orgID, cutoff, cutoff, false).Find(&libraryPanels)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := loadLibraryPanelTags(session, libraryPanels); err != nil {
+		return nil, err
+	}
+
+	return libraryPanels, nil
+}
+
+// getCleanupPolicy gets the cleanup policy of the org, or the default policy if the org has none.
+func (lps *LibraryPanelService) getCleanupPolicy(c *models.ReqContext) (libraryPanelCleanupPolicy, error) {
+	policy := lps.defaultCleanupPolicy(c.SignedInUser.OrgId)
+	err := lps.SQLStore.WithDbSession(context.Background(), func(session *sqlstore.DBSession) error {
+		_, err := session.Table("library_panel_cleanup_policy").Where("org_id=?", c.SignedInUser.OrgId).Get(&policy)
+		return err
+	})
+	if policy.ExcludedUIDs == nil {
+		policy.ExcludedUIDs = []string{}
+	}
+
+	return policy, err
+}
+
+// updateCleanupPolicy creates or updates the cleanup policy of the org.
+func (lps *LibraryPanelService) updateCleanupPolicy(c *models.ReqContext, cmd updateCleanupPolicyCommand) (libraryPanelCleanupPolicy, error) {
+	if cmd.Action != cleanupActionArchive && cmd.Action != cleanupActionDelete {
+		return libraryPanelCleanupPolicy{}, errLibraryPanelInvalidCleanupPolicy
+	}
+	if cmd.OlderThanDays <= 0 {
+		return libraryPanelCleanupPolicy{}, errLibraryPanelInvalidCleanupPolicy
+	}
+
+	orgID := c.SignedInUser.OrgId
+	policy := libraryPanelCleanupPolicy{
+		OrgID:         orgID,
+		Enabled:       cmd.Enabled,
+		OlderThanDays: cmd.OlderThanDays,
+		Action:        cmd.Action,
+		ExcludedUIDs:  normalizeTags(cmd.ExcludedUIDs),
+		Created:       time.Now(),
+		Updated:       time.Now(),
+	}
+	err := lps.SQLStore.WithTransactionalDbSession(context.Background(), func(session *sqlstore.DBSession) error {
+		var existing libraryPanelCleanupPolicy
+		has, err := session.Table("library_panel_cleanup_policy").Where("org_id=?", orgID).Get(&existing)
+		if err != nil {
+			return err
+		}
+
+		if !has {
+			_, err = session.Insert(&policy)
+			return err
+		}
+
+		policy.ID = existing.ID
+		policy.Created = existing.Created
+		_, err = session.ID(existing.ID).AllCols().Update(&policy)
+		return err
+	})
+
+	return policy, err
+}
+
+// cleanUpUnusedLibraryPanels archives or deletes the unused Library Panels of every org with an enabled
+// cleanup policy, skipping the Library Panels on the policy's exclusion list. Returns the number of
+// Library Panels that were removed.
+func (lps *LibraryPanelService) cleanUpUnusedLibraryPanels() (int, error) {
+	var policies []libraryPanelCleanupPolicy
+	err := lps.SQLStore.WithDbSession(context.Background(), func(session *sqlstore.DBSession) error {
+		return session.Table("library_panel_cleanup_policy").Where("enabled=?", true).Find(&policies)
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	removed := 0
+	for _, policy := range policies {
+		count, err := lps.applyCleanupPolicy(policy)
+		if err != nil {
+			return removed, err
+		}
+		if count > 0 {
+			lps.log.Info("Cleaned up unused library panels", "orgId", policy.OrgID, "action", policy.Action, "count", count)
+		}
+		removed += count
+	}
+
+	return removed, nil
+}
+
+func (lps *LibraryPanelService) applyCleanupPolicy(policy libraryPanelCleanupPolicy) (int, error) {
+	excluded := make(map[string]bool, len(policy.ExcludedUIDs))
+	for _, uid := range policy.ExcludedUIDs {
+		excluded[uid] = true
+	}
+
+	removed := 0
+	err := lps.SQLStore.WithTransactionalDbSession(context.Background(), func(session *sqlstore.DBSession) error {
+		libraryPanels, err := getUnusedLibraryPanels(session, policy.OrgID, policy.OlderThanDays)
+		if err != nil {
+			return err
+		}
+
+		for _, panel := range libraryPanels {
+			// Library Panels synced from Git are removed by deleting them from the repository
+			if excluded[panel.UID] || panel.SyncPath != "" {
+				continue
+			}
+
+			if policy.Action == cleanupActionArchive {
+				if err := archiveLibraryPanel(session, panel); err != nil {
+					return err
+				}
+			}
+
+			if err := deleteLibraryPanelByID(session, panel.ID); err != nil {
+				return err
+			}
+			removed++
+		}
+
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	if removed > 0 {
+		lps.invalidateLibraryPanelCache()
+	}
+
+	return removed, nil
+}
+
+// archiveLibraryPanel copies the Library Panel to the archive. The Library Panel itself is left in place.
+func archiveLibraryPanel(session *sqlstore.DBSession, panel LibraryPanel) error {
+	archive := libraryPanelArchive{
+		OrgID:     panel.OrgID,
+		FolderID:  panel.FolderID,
+		UID:       panel.UID,
+		Name:      panel.Name,
+		Model:     string(panel.Model),
+		Created:   panel.Created,
+		CreatedBy: panel.CreatedBy,
+		Archived:  time.Now(),
+	}
+	_, err := session.Insert(&archive)
+	return err
+}
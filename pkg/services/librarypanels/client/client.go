@@ -0,0 +1,314 @@
+// Package client is a Go client for the library panel HTTP API, for tools that manage the library panels of
+// a Grafana server without hand-rolling the HTTP requests.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Kind is the kind of a library element.
+type Kind int
+
+// Kinds of library elements.
+const (
+	KindPanel Kind = iota + 1
+	KindVariable
+	KindRow
+	KindFragment
+	KindQuery
+	KindTransformation
+)
+
+// ErrPendingApproval is returned by Patch when the update of a protected library panel has to be approved
+// before it is applied.
+var ErrPendingApproval = errors.New("library panel update is pending approval")
+
+// LibraryPanel is a library panel as returned by the API.
+type LibraryPanel struct {
+	ID                  int64
+	OrgID               int64
+	FolderID            int64
+	UID                 string
+	Name                string
+	Kind                Kind
+	Model               json.RawMessage
+	Tags                []string
+	Created             time.Time
+	Updated             time.Time
+	CreatedBy           int64
+	UpdatedBy           int64
+	ModelHash           string
+	SchemaVersion       int64
+	Status              string
+	Deprecated          bool
+	ReplacedBy          string
+	Pinned              bool
+	ConnectedDashboards int64
+	// Fingerprint only changes when the folder, name, kind, status, tags or model of the library panel change.
+	Fingerprint string
+
+	// ETag is the current ETag of the library panel, it's only set by Get and Patch.
+	ETag string `json:"-"`
+}
+
+// CreateCommand is the command for creating a library panel.
+type CreateCommand struct {
+	// FolderID is the folder of the library panel, the default folder of the org if not set.
+	FolderID *int64          `json:"folderId,omitempty"`
+	Name     string          `json:"name"`
+	Kind     Kind            `json:"kind,omitempty"`
+	Model    json.RawMessage `json:"model"`
+	Tags     []string        `json:"tags,omitempty"`
+	// Status is draft or published, published if not set.
+	Status string `json:"status,omitempty"`
+}
+
+// PatchCommand is the command for patching a library panel, unset fields are kept.
+type PatchCommand struct {
+	FolderID int64           `json:"folderId,omitempty"`
+	Name     string          `json:"name,omitempty"`
+	Model    json.RawMessage `json:"model,omitempty"`
+	Tags     []string        `json:"tags,omitempty"`
+
+	// IfMatch is the ETag the library panel must still have for the patch to be applied.
+	IfMatch string `json:"-"`
+}
+
+// GetAllQuery filters the library panels returned by GetAll.
+type GetAllQuery struct {
+	FolderID          *int64
+	IncludeSubfolders bool
+	Kind              Kind
+	Datasource        string
+	Status            string
+	IncludeModel      bool
+}
+
+// Config is the configuration of a Client.
+type Config struct {
+	// URL is the root URL of the Grafana server.
+	URL string
+	// APIKey authenticates the requests, unless BasicAuthUser is set.
+	APIKey            string
+	BasicAuthUser     string
+	BasicAuthPassword string
+	// OrgID is the org the requests are made in, the org of the API key or the current org of the user if not set.
+	OrgID int64
+	// HTTPClient sends the requests, a client with a 30 seconds timeout if not set.
+	HTTPClient *http.Client
+}
+
+// Client is a client of the library panel API of a Grafana server.
+type Client struct {
+	cfg     Config
+	baseURL *url.URL
+}
+
+// New returns a Client for the Grafana server of the config.
+func New(cfg Config) (*Client, error) {
+	baseURL, err := url.Parse(strings.TrimSuffix(cfg.URL, "/") + "/api/library-panels")
+	if err != nil {
+		return nil, fmt.Errorf("invalid Grafana URL %q: %w", cfg.URL, err)
+	}
+	if baseURL.Scheme != "http" && baseURL.Scheme != "https" {
+		return nil, fmt.Errorf("invalid Grafana URL %q: the scheme must be http or https", cfg.URL)
+	}
+	if cfg.HTTPClient == nil {
+		cfg.HTTPClient = &http.Client{Timeout: 30 * time.Second}
+	}
+
+	return &Client{cfg: cfg, baseURL: baseURL}, nil
+}
+
+// Get gets the library panel with the UID.
+func (c *Client) Get(ctx context.Context, uid string) (LibraryPanel, error) {
+	var libraryPanel LibraryPanel
+	header, err := c.do(ctx, http.MethodGet, "/"+url.PathEscape(uid), nil, nil, nil, &libraryPanel)
+	libraryPanel.ETag = header.Get("ETag")
+
+	return libraryPanel, err
+}
+
+// GetModelPaths gets the library panel with the UID with only the parts of its model at the dot separated
+// paths, like fieldConfig.defaults.unit.
+func (c *Client) GetModelPaths(ctx context.Context, uid string, paths ...string) (LibraryPanel, error) {
+	params := url.Values{"modelPaths": []string{strings.Join(paths, ",")}}
+
+	var libraryPanel LibraryPanel
+	header, err := c.do(ctx, http.MethodGet, "/"+url.PathEscape(uid), params, nil, nil, &libraryPanel)
+	libraryPanel.ETag = header.Get("ETag")
+
+	return libraryPanel, err
+}
+
+// GetAll gets the library panels matching the query.
+func (c *Client) GetAll(ctx context.Context, query GetAllQuery) ([]LibraryPanel, error) {
+	params := url.Values{}
+	if query.FolderID != nil {
+		params.Set("folderId", strconv.FormatInt(*query.FolderID, 10))
+	}
+	if query.IncludeSubfolders {
+		params.Set("includeSubfolders", "true")
+	}
+	if query.Kind != 0 {
+		params.Set("kind", strconv.Itoa(int(query.Kind)))
+	}
+	if query.Datasource != "" {
+		params.Set("datasource", query.Datasource)
+	}
+	if query.Status != "" {
+		params.Set("status", query.Status)
+	}
+	if query.IncludeModel {
+		params.Set("includeModel", "true")
+	}
+
+	libraryPanels := make([]LibraryPanel, 0)
+	_, err := c.do(ctx, http.MethodGet, "/", params, nil, nil, &libraryPanels)
+
+	return libraryPanels, err
+}
+
+// Create creates a library panel.
+func (c *Client) Create(ctx context.Context, cmd CreateCommand) (LibraryPanel, error) {
+	var libraryPanel LibraryPanel
+	_, err := c.do(ctx, http.MethodPost, "/", nil, nil, cmd, &libraryPanel)
+
+	return libraryPanel, err
+}
+
+// Patch patches the library panel with the UID. It returns ErrPendingApproval if the update has to be approved
+// first.
+func (c *Client) Patch(ctx context.Context, uid string, cmd PatchCommand) (LibraryPanel, error) {
+	header := http.Header{}
+	if cmd.IfMatch != "" {
+		header.Set("If-Match", cmd.IfMatch)
+	}
+
+	var libraryPanel LibraryPanel
+	responseHeader, err := c.do(ctx, http.MethodPatch, "/"+url.PathEscape(uid), nil, header, cmd, &libraryPanel)
+	if err != nil {
+		return LibraryPanel{}, err
+	}
+	libraryPanel.ETag = responseHeader.Get("ETag")
+
+	return libraryPanel, nil
+}
+
+// Delete deletes the library panel with the UID.
+func (c *Client) Delete(ctx context.Context, uid string) error {
+	_, err := c.do(ctx, http.MethodDelete, "/"+url.PathEscape(uid), nil, nil, nil, nil)
+	return err
+}
+
+// Connect connects the library panel with the UID to a panel of a dashboard, or to the dashboard if panelID
+// is 0.
+func (c *Client) Connect(ctx context.Context, uid string, dashboardID int64, panelID int64) error {
+	_, err := c.do(ctx, http.MethodPost, connectionPath(uid, dashboardID), panelParams(panelID), nil, nil, nil)
+	return err
+}
+
+// Disconnect disconnects the library panel with the UID from a panel of a dashboard, or from the dashboard if
+// panelID is 0.
+func (c *Client) Disconnect(ctx context.Context, uid string, dashboardID int64, panelID int64) error {
+	_, err := c.do(ctx, http.MethodDelete, connectionPath(uid, dashboardID), panelParams(panelID), nil, nil, nil)
+	return err
+}
+
+// ConnectedDashboards gets the IDs of the dashboards the library panel with the UID is connected to.
+func (c *Client) ConnectedDashboards(ctx context.Context, uid string) ([]int64, error) {
+	dashboardIDs := make([]int64, 0)
+	_, err := c.do(ctx, http.MethodGet, "/"+url.PathEscape(uid)+"/dashboards/", nil, nil, nil, &dashboardIDs)
+
+	return dashboardIDs, err
+}
+
+func connectionPath(uid string, dashboardID int64) string {
+	return "/" + url.PathEscape(uid) + "/dashboards/" + strconv.FormatInt(dashboardID, 10)
+}
+
+func panelParams(panelID int64) url.Values {
+	if panelID == 0 {
+		return nil
+	}
+	return url.Values{"panelId": []string{strconv.FormatInt(panelID, 10)}}
+}
+
+// do sends a request to the library panel API and decodes the result of the response into result, unless it's
+// nil. It returns the headers of the response.
+func (c *Client) do(ctx context.Context, method string, path string, params url.Values, header http.Header, body interface{}, result interface{}) (http.Header, error) {
+	requestURL := *c.baseURL
+	requestURL.Path += path
+	requestURL.RawQuery = params.Encode()
+
+	var bodyReader io.Reader
+	if body != nil {
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			return http.Header{}, err
+		}
+		bodyReader = bytes.NewReader(encoded)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, requestURL.String(), bodyReader)
+	if err != nil {
+		return http.Header{}, err
+	}
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.cfg.BasicAuthUser != "" {
+		req.SetBasicAuth(c.cfg.BasicAuthUser, c.cfg.BasicAuthPassword)
+	} else if c.cfg.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+c.cfg.APIKey)
+	}
+	if c.cfg.OrgID != 0 {
+		req.Header.Set("X-Grafana-Org-Id", strconv.FormatInt(c.cfg.OrgID, 10))
+	}
+
+	resp, err := c.cfg.HTTPClient.Do(req)
+	if err != nil {
+		return http.Header{}, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return resp.Header, err
+	}
+	if resp.StatusCode/100 != 2 {
+		return resp.Header, newError(resp.StatusCode, data)
+	}
+	if resp.StatusCode == http.StatusAccepted {
+		return resp.Header, ErrPendingApproval
+	}
+	if result == nil {
+		return resp.Header, nil
+	}
+
+	var envelope struct {
+		Result json.RawMessage `json:"result"`
+	}
+	if err := json.Unmarshal(data, &envelope); err != nil {
+		return resp.Header, fmt.Errorf("failed to decode library panel API response: %w", err)
+	}
+	if err := json.Unmarshal(envelope.Result, result); err != nil {
+		return resp.Header, fmt.Errorf("failed to decode library panel API response: %w", err)
+	}
+
+	return resp.Header, nil
+}
@@ -0,0 +1,89 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestClient(t *testing.T) {
+	t.Run("Get should authenticate and return the library panel with its ETag", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			require.Equal(t, http.MethodGet, r.Method)
+			require.Equal(t, "/grafana/api/library-panels/panel-1", r.URL.Path)
+			require.Equal(t, "Bearer secret", r.Header.Get("Authorization"))
+			require.Equal(t, "2", r.Header.Get("X-Grafana-Org-Id"))
+			w.Header().Set("ETag", `"etag"`)
+			_, _ = w.Write([]byte(`{"result":{"ID":1,"UID":"panel-1","Name":"Text","Kind":1,"Model":{"type":"text"},"Tags":["a"]}}`))
+		}))
+		t.Cleanup(server.Close)
+
+		client, err := New(Config{URL: server.URL + "/grafana/", APIKey: "secret", OrgID: 2})
+		require.NoError(t, err)
+		libraryPanel, err := client.Get(context.Background(), "panel-1")
+		require.NoError(t, err)
+		require.Equal(t, "Text", libraryPanel.Name)
+		require.Equal(t, KindPanel, libraryPanel.Kind)
+		require.JSONEq(t, `{"type":"text"}`, string(libraryPanel.Model))
+		require.Equal(t, []string{"a"}, libraryPanel.Tags)
+		require.Equal(t, `"etag"`, libraryPanel.ETag)
+	})
+
+	t.Run("Patch should send the command and If-Match, and report pending approvals", func(t *testing.T) {
+		status := http.StatusOK
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			require.Equal(t, http.MethodPatch, r.Method)
+			require.Equal(t, `"etag"`, r.Header.Get("If-Match"))
+			body, err := ioutil.ReadAll(r.Body)
+			require.NoError(t, err)
+			require.JSONEq(t, `{"name":"Renamed"}`, string(body))
+			w.WriteHeader(status)
+			_, _ = w.Write([]byte(`{"result":{"UID":"panel-1","Name":"Renamed"}}`))
+		}))
+		t.Cleanup(server.Close)
+
+		client, err := New(Config{URL: server.URL})
+		require.NoError(t, err)
+		libraryPanel, err := client.Patch(context.Background(), "panel-1", PatchCommand{Name: "Renamed", IfMatch: `"etag"`})
+		require.NoError(t, err)
+		require.Equal(t, "Renamed", libraryPanel.Name)
+
+		status = http.StatusAccepted
+		_, err = client.Patch(context.Background(), "panel-1", PatchCommand{Name: "Renamed", IfMatch: `"etag"`})
+		require.Equal(t, ErrPendingApproval, err)
+	})
+
+	t.Run("Connect should pass the panel, and errors should keep their code", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			require.Equal(t, http.MethodPost, r.Method)
+			require.Equal(t, "/api/library-panels/panel-1/dashboards/3", r.URL.Path)
+			require.Equal(t, "4", r.URL.Query().Get("panelId"))
+			user, password, ok := r.BasicAuth()
+			require.True(t, ok)
+			require.Equal(t, "admin", user)
+			require.Equal(t, "password", password)
+			w.WriteHeader(http.StatusNotFound)
+			_ = json.NewEncoder(w).Encode(map[string]string{"code": "NotFound", "message": "library panel could not be found"})
+		}))
+		t.Cleanup(server.Close)
+
+		client, err := New(Config{URL: server.URL, BasicAuthUser: "admin", BasicAuthPassword: "password"})
+		require.NoError(t, err)
+		err = client.Connect(context.Background(), "panel-1", 3, 4)
+		require.True(t, IsNotFound(err))
+		var apiErr *Error
+		require.ErrorAs(t, err, &apiErr)
+		require.Equal(t, http.StatusNotFound, apiErr.StatusCode)
+		require.Equal(t, "library panel could not be found", apiErr.Message)
+	})
+
+	t.Run("New should reject URLs that aren't HTTP", func(t *testing.T) {
+		_, err := New(Config{URL: "localhost:3000"})
+		require.Error(t, err)
+	})
+}
@@ -0,0 +1,62 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// ErrorCode is the machine readable kind of a library panel API error.
+type ErrorCode string
+
+// Codes of library panel API errors.
+const (
+	CodeNotFound         ErrorCode = "NotFound"
+	CodeAlreadyExists    ErrorCode = "AlreadyExists"
+	CodeVersionMismatch  ErrorCode = "VersionMismatch"
+	CodeHasConnections   ErrorCode = "HasConnections"
+	CodeQuotaExceeded    ErrorCode = "QuotaExceeded"
+	CodeTooLarge         ErrorCode = "TooLarge"
+	CodeInvalid          ErrorCode = "Invalid"
+	CodeReadOnly         ErrorCode = "ReadOnly"
+	CodePermissionDenied ErrorCode = "PermissionDenied"
+	CodeRateLimited      ErrorCode = "RateLimited"
+)
+
+// Error is an error response of the library panel API.
+type Error struct {
+	StatusCode int
+	// Code is empty for errors that aren't library panel errors, like authentication errors.
+	Code    ErrorCode `json:"code"`
+	Message string    `json:"message"`
+	// Errors are the validation errors of an invalid model.
+	Errors json.RawMessage `json:"errors,omitempty"`
+}
+
+func newError(statusCode int, body []byte) *Error {
+	apiErr := &Error{StatusCode: statusCode}
+	if err := json.Unmarshal(body, apiErr); err != nil || apiErr.Message == "" {
+		apiErr.Message = string(body)
+	}
+	apiErr.StatusCode = statusCode
+
+	return apiErr
+}
+
+func (e *Error) Error() string {
+	if e.Code == "" {
+		return fmt.Sprintf("library panel API returned status %d: %s", e.StatusCode, e.Message)
+	}
+	return fmt.Sprintf("library panel API returned status %d (%s): %s", e.StatusCode, e.Code, e.Message)
+}
+
+// HasCode returns true if err is an Error with the code.
+func HasCode(err error, code ErrorCode) bool {
+	var apiErr *Error
+	return errors.As(err, &apiErr) && apiErr.Code == code
+}
+
+// IsNotFound returns true if err is the error of a library panel that doesn't exist.
+func IsNotFound(err error) bool {
+	return HasCode(err, CodeNotFound)
+}
@@ -0,0 +1,331 @@
+package librarypanels
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/components/simplejson"
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/dashboards"
+	"github.com/grafana/grafana/pkg/services/sqlstore"
+	"github.com/grafana/grafana/pkg/util"
+)
+
+const (
+	// collectionPanelWidth and collectionPanelHeight are the size of the panels added to a dashboard
+	// from a collection, two panels fit next to each other.
+	collectionPanelWidth  = 12
+	collectionPanelHeight = 8
+)
+
+// libraryPanelCollection is the model for named collections of Library Panels.
+type libraryPanelCollection struct {
+	ID          int64  `json:"id" xorm:"pk autoincr 'id'"`
+	OrgID       int64  `json:"orgId" xorm:"org_id"`
+	UID         string `json:"uid" xorm:"uid"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+
+	LibraryPanels []LibraryPanel `json:"libraryPanels" xorm:"-"`
+
+	Created time.Time `json:"created"`
+	Updated time.Time `json:"updated"`
+
+	CreatedBy int64 `json:"createdBy"`
+	UpdatedBy int64 `json:"updatedBy"`
+}
+
+// libraryPanelCollectionMember is the model for the Library Panels in a collection.
+type libraryPanelCollectionMember struct {
+	ID             int64 `xorm:"pk autoincr 'id'"`
+	CollectionID   int64 `xorm:"collection_id"`
+	LibraryPanelID int64 `xorm:"librarypanel_id"`
+	Position       int64
+}
+
+// saveCollectionCommand is the command for adding or updating a library panel collection.
+type saveCollectionCommand struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+// createCollection adds a library panel collection.
+func (lps *LibraryPanelService) createCollection(c *models.ReqContext, cmd saveCollectionCommand) (libraryPanelCollection, error) {
+	name := strings.TrimSpace(cmd.Name)
+	if name == "" {
+		return libraryPanelCollection{}, errLibraryPanelCollectionInvalidName
+	}
+
+	now := time.Now()
+	collection := libraryPanelCollection{
+		OrgID:         c.SignedInUser.OrgId,
+		UID:           util.GenerateShortUID(),
+		Name:          name,
+		Description:   cmd.Description,
+		LibraryPanels: []LibraryPanel{},
+		Created:       now,
+		Updated:       now,
+		CreatedBy:     c.SignedInUser.UserId,
+		UpdatedBy:     c.SignedInUser.UserId,
+	}
+	err := lps.SQLStore.WithTransactionalDbSession(context.Background(), func(session *sqlstore.DBSession) error {
+		if _, err := session.Insert(&collection); err != nil {
+			if lps.SQLStore.Dialect.IsUniqueConstraintViolation(err) {
+				return errLibraryPanelCollectionAlreadyExists
+			}
+			return err
+		}
+
+		return nil
+	})
+
+	return collection, err
+}
+
+func getCollection(session *sqlstore.DBSession, uid string, orgID int64) (libraryPanelCollection, error) {
+	var collection libraryPanelCollection
+	has, err := session.Table("library_panel_collection").Where("uid=? AND org_id=?", uid, orgID).Get(&collection)
+	if err != nil {
+		return libraryPanelCollection{}, err
+	}
+	if !has {
+		return libraryPanelCollection{}, errLibraryPanelCollectionNotFound
+	}
+
+	collection.LibraryPanels, err = getCollectionLibraryPanels(session, collection.ID)
+	return collection, err
+}
+
+// getCollectionLibraryPanels gets the Library Panels in a collection, in the order they were added.
+func getCollectionLibraryPanels(session *sqlstore.DBSession, collectionID int64) ([]LibraryPanel, error) {
+	libraryPanels := make([]LibraryPanel, 0)
+	err := session.SQL(`SELECT library_panel.* FROM library_panel
+		INNER JOIN library_panel_collection_member ON library_panel_collection_member.librarypanel_id = library_panel.id
+		WHERE library_panel_collection_member.collection_id=?
+		ORDER BY library_panel_collection_member.position ASC`, collectionID).Find(&libraryPanels)
+	if err != nil {
+		return nil, err
+	}
+
+	upgradeLibraryPanelModels(libraryPanels)
+	if err := loadLibraryPanelTags(session, libraryPanels); err != nil {
+		return nil, err
+	}
+
+	return libraryPanels, nil
+}
+
+// getCollection gets a library panel collection with its Library Panels.
+func (lps *LibraryPanelService) getCollection(c *models.ReqContext, uid string) (libraryPanelCollection, error) {
+	var collection libraryPanelCollection
+	err := lps.SQLStore.WithReadReplicaDbSession(context.Background(), func(session *sqlstore.DBSession) error {
+		var err error
+		collection, err = getCollection(session, uid, c.SignedInUser.OrgId)
+		return err
+	})
+
+	return collection, err
+}
+
+// getAllCollections gets all library panel collections in the org, without their Library Panels.
+func (lps *LibraryPanelService) getAllCollections(c *models.ReqContext) ([]libraryPanelCollection, error) {
+	collections := make([]libraryPanelCollection, 0)
+	err := lps.SQLStore.WithReadReplicaDbSession(context.Background(), func(session *sqlstore.DBSession) error {
+		return session.Table("library_panel_collection").Where("org_id=?", c.SignedInUser.OrgId).OrderBy("name ASC").Find(&collections)
+	})
+
+	return collections, err
+}
+
+// updateCollection updates the name and description of a library panel collection.
+func (lps *LibraryPanelService) updateCollection(c *models.ReqContext, uid string, cmd saveCollectionCommand) (libraryPanelCollection, error) {
+	name := strings.TrimSpace(cmd.Name)
+	if name == "" {
+		return libraryPanelCollection{}, errLibraryPanelCollectionInvalidName
+	}
+
+	var collection libraryPanelCollection
+	err := lps.SQLStore.WithTransactionalDbSession(context.Background(), func(session *sqlstore.DBSession) error {
+		var err error
+		collection, err = getCollection(session, uid, c.SignedInUser.OrgId)
+		if err != nil {
+			return err
+		}
+
+		collection.Name = name
+		collection.Description = cmd.Description
+		collection.Updated = time.Now()
+		collection.UpdatedBy = c.SignedInUser.UserId
+		if _, err := session.ID(collection.ID).Cols("name", "description", "updated", "updated_by").Update(&collection); err != nil {
+			if lps.SQLStore.Dialect.IsUniqueConstraintViolation(err) {
+				return errLibraryPanelCollectionAlreadyExists
+			}
+			return err
+		}
+
+		return nil
+	})
+
+	return collection, err
+}
+
+// deleteCollection deletes a library panel collection. The Library Panels in it are kept.
+func (lps *LibraryPanelService) deleteCollection(c *models.ReqContext, uid string) error {
+	return lps.SQLStore.WithTransactionalDbSession(context.Background(), func(session *sqlstore.DBSession) error {
+		collection, err := getCollection(session, uid, c.SignedInUser.OrgId)
+		if err != nil {
+			return err
+		}
+
+		if _, err := session.Exec("DELETE FROM library_panel_collection_member WHERE collection_id=?", collection.ID); err != nil {
+			return err
+		}
+		_, err = session.Exec("DELETE FROM library_panel_collection WHERE id=?", collection.ID)
+		return err
+	})
+}
+
+// addCollectionLibraryPanel adds a Library Panel to the end of a collection. Adding a Library Panel that is
+// already in the collection does nothing.
+func (lps *LibraryPanelService) addCollectionLibraryPanel(c *models.ReqContext, uid string, libraryPanelUID string) (libraryPanelCollection, error) {
+	var collection libraryPanelCollection
+	err := lps.SQLStore.WithTransactionalDbSession(context.Background(), func(session *sqlstore.DBSession) error {
+		var err error
+		collection, err = getCollection(session, uid, c.SignedInUser.OrgId)
+		if err != nil {
+			return err
+		}
+
+		panel, err := getLibraryPanel(session, libraryPanelUID, c.SignedInUser.OrgId)
+		if err != nil {
+			return err
+		}
+		if panel.Kind != panelElement {
+			return errLibraryPanelNotFound
+		}
+		for _, member := range collection.LibraryPanels {
+			if member.ID == panel.ID {
+				return nil
+			}
+		}
+
+		var last libraryPanelCollectionMember
+		hasMembers, err := session.Table("library_panel_collection_member").Where("collection_id=?", collection.ID).Desc("position").Get(&last)
+		if err != nil {
+			return err
+		}
+		member := libraryPanelCollectionMember{
+			CollectionID:   collection.ID,
+			LibraryPanelID: panel.ID,
+		}
+		if hasMembers {
+			member.Position = last.Position + 1
+		}
+		if _, err := session.Insert(&member); err != nil {
+			return err
+		}
+
+		collection.LibraryPanels = append(collection.LibraryPanels, panel)
+		return nil
+	})
+
+	return collection, err
+}
+
+// removeCollectionLibraryPanel removes a Library Panel from a collection.
+func (lps *LibraryPanelService) removeCollectionLibraryPanel(c *models.ReqContext, uid string, libraryPanelUID string) (libraryPanelCollection, error) {
+	var collection libraryPanelCollection
+	err := lps.SQLStore.WithTransactionalDbSession(context.Background(), func(session *sqlstore.DBSession) error {
+		var err error
+		collection, err = getCollection(session, uid, c.SignedInUser.OrgId)
+		if err != nil {
+			return err
+		}
+
+		panel, err := getLibraryPanel(session, libraryPanelUID, c.SignedInUser.OrgId)
+		if err != nil {
+			return err
+		}
+
+		result, err := session.Exec("DELETE FROM library_panel_collection_member WHERE collection_id=? AND librarypanel_id=?", collection.ID, panel.ID)
+		if err != nil {
+			return err
+		}
+		if rowsAffected, err := result.RowsAffected(); err != nil {
+			return err
+		} else if rowsAffected != 1 {
+			return errLibraryPanelCollectionMemberNotFound
+		}
+
+		collection.LibraryPanels, err = getCollectionLibraryPanels(session, collection.ID)
+		return err
+	})
+
+	return collection, err
+}
+
+// addCollectionToDashboard adds the Library Panels of a collection to the bottom of a dashboard, saves the
+// dashboard and connects the Library Panels to it.
+func (lps *LibraryPanelService) addCollectionToDashboard(c *models.ReqContext, uid string, dashboardID int64) (*models.Dashboard, error) {
+	collection, err := lps.getCollection(c, uid)
+	if err != nil {
+		return nil, err
+	}
+
+	query := models.GetDashboardQuery{Id: dashboardID, OrgId: c.SignedInUser.OrgId}
+	if err := bus.Dispatch(&query); err != nil {
+		return nil, err
+	}
+	dash := query.Result
+
+	panels := dash.Data.Get("panels").MustArray()
+	firstID := maxPanelID(panels) + 1
+	nextID := firstID
+	bottom := 0
+	for _, item := range panels {
+		gridPos := simplejson.NewFromAny(item).Get("gridPos")
+		if y := gridPos.Get("y").MustInt() + gridPos.Get("h").MustInt(); y > bottom {
+			bottom = y
+		}
+	}
+
+	for i, libraryPanel := range collection.LibraryPanels {
+		panels = append(panels, map[string]interface{}{
+			"id":    nextID,
+			"title": libraryPanel.Name,
+			"gridPos": map[string]interface{}{
+				"x": (i % 2) * collectionPanelWidth,
+				"y": bottom + (i/2)*collectionPanelHeight,
+				"w": collectionPanelWidth,
+				"h": collectionPanelHeight,
+			},
+			"libraryPanel": map[string]interface{}{
+				"uid":  libraryPanel.UID,
+				"name": libraryPanel.Name,
+			},
+		})
+		nextID++
+	}
+	dash.Data.Set("panels", panels)
+
+	saved, err := dashboards.NewService().SaveDashboard(&dashboards.SaveDashboardDTO{
+		OrgId:     c.SignedInUser.OrgId,
+		User:      c.SignedInUser,
+		Message:   fmt.Sprintf("Added library panel collection %s", collection.Name),
+		Dashboard: dash,
+	}, false)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, libraryPanel := range collection.LibraryPanels {
+		if err := lps.connectDashboard(c, libraryPanel.UID, saved.Id, firstID+int64(i)); err != nil {
+			return nil, err
+		}
+	}
+
+	return saved, nil
+}
@@ -0,0 +1,105 @@
+package librarypanels
+
+import (
+	"context"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/sqlstore"
+)
+
+// maxCommentLength is the maximum number of characters in a library panel comment.
+const maxCommentLength = 10000
+
+// libraryPanelComment is the model for comments on Library Panels.
+type libraryPanelComment struct {
+	ID             int64     `json:"id" xorm:"pk autoincr 'id'"`
+	OrgID          int64     `json:"-" xorm:"org_id"`
+	LibraryPanelID int64     `json:"-" xorm:"librarypanel_id"`
+	UserID         int64     `json:"userId" xorm:"user_id"`
+	Login          string    `json:"login" xorm:"<- login"`
+	Content        string    `json:"content"`
+	Created        time.Time `json:"created"`
+}
+
+// addCommentCommand is the command for commenting on a Library Panel.
+type addCommentCommand struct {
+	Content string `json:"content"`
+}
+
+// addComment adds a comment to a Library Panel the user can view.
+func (lps *LibraryPanelService) addComment(c *models.ReqContext, uid string, cmd addCommentCommand) (libraryPanelComment, error) {
+	if err := checkSignedInUser(c.SignedInUser); err != nil {
+		return libraryPanelComment{}, err
+	}
+
+	content := strings.TrimSpace(cmd.Content)
+	if content == "" || utf8.RuneCountInString(content) > maxCommentLength {
+		return libraryPanelComment{}, errLibraryPanelInvalidComment
+	}
+
+	libraryPanel, err := lps.getLibraryPanel(c, uid)
+	if err != nil {
+		return libraryPanelComment{}, err
+	}
+
+	comment := libraryPanelComment{
+		OrgID:          c.SignedInUser.OrgId,
+		LibraryPanelID: libraryPanel.ID,
+		UserID:         c.SignedInUser.UserId,
+		Login:          c.SignedInUser.Login,
+		Content:        content,
+		Created:        time.Now(),
+	}
+	err = lps.SQLStore.WithTransactionalDbSession(context.Background(), func(session *sqlstore.DBSession) error {
+		_, err := session.Table("library_panel_comment").Insert(&comment)
+		return err
+	})
+
+	return comment, err
+}
+
+// getComments gets the comments on a Library Panel the user can view, oldest first.
+func (lps *LibraryPanelService) getComments(c *models.ReqContext, uid string) ([]libraryPanelComment, error) {
+	libraryPanel, err := lps.getLibraryPanel(c, uid)
+	if err != nil {
+		return nil, err
+	}
+
+	comments := make([]libraryPanelComment, 0)
+	err = lps.SQLStore.WithReadReplicaDbSession(context.Background(), func(session *sqlstore.DBSession) error {
+		return session.SQL(`SELECT library_panel_comment.*, u.login FROM library_panel_comment
+			LEFT JOIN `+lps.SQLStore.Dialect.Quote("user")+` AS u ON u.id = library_panel_comment.user_id
+			WHERE library_panel_comment.librarypanel_id=?
+			ORDER BY library_panel_comment.created ASC, library_panel_comment.id ASC`, libraryPanel.ID).Find(&comments)
+	})
+
+	return comments, err
+}
+
+// deleteComment deletes a comment on a Library Panel. Comments can be deleted by their author and by org admins.
+func (lps *LibraryPanelService) deleteComment(c *models.ReqContext, uid string, commentID int64) error {
+	libraryPanel, err := lps.getLibraryPanel(c, uid)
+	if err != nil {
+		return err
+	}
+
+	return lps.SQLStore.WithTransactionalDbSession(context.Background(), func(session *sqlstore.DBSession) error {
+		var comment libraryPanelComment
+		has, err := session.Table("library_panel_comment").Cols("id", "user_id").Where("id=? AND librarypanel_id=?", commentID, libraryPanel.ID).Get(&comment)
+		if err != nil {
+			return err
+		}
+		if !has {
+			return errLibraryPanelCommentNotFound
+		}
+		if comment.UserID != c.SignedInUser.UserId && c.SignedInUser.OrgRole != models.ROLE_ADMIN {
+			return errLibraryPanelPermissionDenied
+		}
+
+		_, err = session.Exec("DELETE FROM library_panel_comment WHERE id=?", comment.ID)
+		return err
+	})
+}
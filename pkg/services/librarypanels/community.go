@@ -0,0 +1,145 @@
+package librarypanels
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/grafana/grafana/pkg/models"
+)
+
+var communityRegistryClient = http.Client{Timeout: 10 * time.Second}
+
+// communityPanel is a panel definition published to the community registry.
+type communityPanel struct {
+	Slug        string `json:"slug"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Type        string `json:"type"`
+	Revision    int64  `json:"revision"`
+	Downloads   int64  `json:"downloads"`
+	// Model is only returned when a single panel is read.
+	Model json.RawMessage `json:"model,omitempty"`
+}
+
+// communityPanelSearchResult is a page of the panels of the community registry.
+type communityPanelSearchResult struct {
+	Items []communityPanel `json:"items"`
+	Page  int64            `json:"page"`
+	Pages int64            `json:"pages"`
+}
+
+// installCommunityPanelCommand is the command for installing a community registry panel into an org.
+type installCommunityPanelCommand struct {
+	FolderID int64 `json:"folderId"`
+	// Name is the name of the installed Library Panel, the name of the community panel if not set.
+	Name string `json:"name"`
+}
+
+// communityPanelUpdate is the result of checking a Library Panel installed from the community registry for
+// a newer revision.
+type communityPanelUpdate struct {
+	Source          string `json:"source"`
+	Revision        int64  `json:"revision"`
+	LatestRevision  int64  `json:"latestRevision"`
+	UpdateAvailable bool   `json:"updateAvailable"`
+}
+
+// getCommunityRegistry reads a JSON response of the community registry.
+func getCommunityRegistry(address string, result interface{}) error {
+	resp, err := communityRegistryClient.Get(address)
+	if err != nil {
+		return fmt.Errorf("failed to reach the community registry: %w", err)
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return errLibraryPanelCommunityPanelNotFound
+	default:
+		return fmt.Errorf("community registry responded with status %d", resp.StatusCode)
+	}
+
+	return json.NewDecoder(resp.Body).Decode(result)
+}
+
+// communityPanelURL is the address of a panel in the configured community registry, which is also stored as
+// the source of the Library Panels installed from it.
+func (lps *LibraryPanelService) communityPanelURL(slug string) string {
+	return lps.Cfg.LibraryPanels.CommunityRegistryURL + "/panels/" + url.PathEscape(slug)
+}
+
+// searchCommunityPanels gets a page of the panels of the community registry matching the query.
+func (lps *LibraryPanelService) searchCommunityPanels(query string, page int64) (communityPanelSearchResult, error) {
+	params := url.Values{}
+	if query != "" {
+		params.Set("query", query)
+	}
+	if page > 0 {
+		params.Set("page", strconv.FormatInt(page, 10))
+	}
+	address := lps.Cfg.LibraryPanels.CommunityRegistryURL + "/panels"
+	if len(params) > 0 {
+		address += "?" + params.Encode()
+	}
+
+	result := communityPanelSearchResult{Items: make([]communityPanel, 0)}
+	if err := getCommunityRegistry(address, &result); err != nil {
+		return communityPanelSearchResult{}, err
+	}
+
+	return result, nil
+}
+
+// installCommunityPanel adds the latest revision of a community registry panel to the org of the user as a
+// Library Panel, recording the panel and the revision it was installed from.
+func (lps *LibraryPanelService) installCommunityPanel(c *models.ReqContext, slug string, cmd installCommunityPanelCommand) (LibraryPanel, error) {
+	source := lps.communityPanelURL(slug)
+	var panel communityPanel
+	if err := getCommunityRegistry(source, &panel); err != nil {
+		return LibraryPanel{}, err
+	}
+
+	name := cmd.Name
+	if name == "" {
+		name = panel.Name
+	}
+	return lps.createLibraryPanel(c, createLibraryPanelCommand{
+		FolderID:         &cmd.FolderID,
+		Name:             name,
+		Kind:             panelElement,
+		Model:            panel.Model,
+		RegistrySource:   source,
+		RegistryRevision: panel.Revision,
+	})
+}
+
+// checkCommunityPanelUpdate compares the installed revision of a Library Panel with the latest revision of the
+// community registry panel it was installed from.
+func (lps *LibraryPanelService) checkCommunityPanelUpdate(c *models.ReqContext, uid string) (communityPanelUpdate, error) {
+	libraryPanel, err := lps.getLibraryPanel(c, uid)
+	if err != nil {
+		return communityPanelUpdate{}, err
+	}
+	if libraryPanel.RegistrySource == "" {
+		return communityPanelUpdate{}, errLibraryPanelNotFromRegistry
+	}
+
+	var panel communityPanel
+	if err := getCommunityRegistry(libraryPanel.RegistrySource, &panel); err != nil {
+		return communityPanelUpdate{}, err
+	}
+
+	return communityPanelUpdate{
+		Source:          libraryPanel.RegistrySource,
+		Revision:        libraryPanel.RegistryRevision,
+		LatestRevision:  panel.Revision,
+		UpdateAvailable: panel.Revision > libraryPanel.RegistryRevision,
+	}, nil
+}
@@ -0,0 +1,314 @@
+package librarypanels
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/sqlstore"
+)
+
+const (
+	// fragmentReferenceKey is the key of the references to library fragments in models. An object like
+	// {"refId": "A", "libraryFragment": {"uid": "nErXDvCkzz"}} is merged with the model of the fragment, the keys
+	// of the object taking precedence.
+	fragmentReferenceKey = "libraryFragment"
+	// maxFragmentDepth is how many levels of fragments referencing fragments are resolved.
+	maxFragmentDepth = 10
+)
+
+// libraryPanelDependency is a reference from the model of a library element to a library fragment, query or
+// transformation.
+type libraryPanelDependency struct {
+	ID             int64 `xorm:"pk autoincr 'id'"`
+	LibraryPanelID int64 `xorm:"librarypanel_id"`
+	DependencyID   int64 `xorm:"dependency_id"`
+}
+
+// libraryElementReference is a library element that another one depends on or is used by.
+type libraryElementReference struct {
+	UID  string             `json:"uid" xorm:"uid"`
+	Name string             `json:"name" xorm:"name"`
+	Kind libraryElementKind `json:"kind" xorm:"kind"`
+}
+
+// libraryElementDependencies are the library fragments, queries and transformations a library element
+// references, and the library elements referencing it.
+type libraryElementDependencies struct {
+	Dependencies []libraryElementReference `json:"dependencies"`
+	Dependents   []libraryElementReference `json:"dependents"`
+}
+
+// fragmentReference returns the UID of the library fragment the object references, if any.
+func fragmentReference(object map[string]interface{}) (string, bool) {
+	reference, ok := object[fragmentReferenceKey].(map[string]interface{})
+	if !ok {
+		return "", false
+	}
+	uid, ok := reference["uid"].(string)
+
+	return uid, ok && uid != ""
+}
+
+// collectFragmentReferences adds the UIDs of the library fragments referenced in the value to uids.
+func collectFragmentReferences(value interface{}, uids map[string]bool) {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		if uid, ok := fragmentReference(value); ok {
+			uids[uid] = true
+		}
+		for key, child := range value {
+			if key != fragmentReferenceKey {
+				collectFragmentReferences(child, uids)
+			}
+		}
+	case []interface{}:
+		for _, child := range value {
+			collectFragmentReferences(child, uids)
+		}
+	}
+}
+
+// getFragmentReferences returns the UIDs of the library fragments referenced in a model, sorted.
+func getFragmentReferences(model json.RawMessage) []string {
+	var value interface{}
+	if err := json.Unmarshal(model, &value); err != nil {
+		return []string{}
+	}
+
+	set := map[string]bool{}
+	collectFragmentReferences(value, set)
+	uids := make([]string, 0, len(set))
+	for uid := range set {
+		uids = append(uids, uid)
+	}
+	sort.Strings(uids)
+
+	return uids
+}
+
+// setLibraryPanelDependencies stores the library fragments, queries and transformations that the model of a
+// library element references. It fails if a referenced element doesn't exist, or if the library element is a
+// fragment that would end up referencing itself. Library queries and transformations don't reference other
+// library elements.
+func setLibraryPanelDependencies(session *sqlstore.DBSession, libraryPanel LibraryPanel) error {
+	if _, err := session.Exec("DELETE FROM library_panel_dependency WHERE librarypanel_id=?", libraryPanel.ID); err != nil {
+		return err
+	}
+	if libraryPanel.Kind == queryElement || libraryPanel.Kind == transformationElement {
+		return nil
+	}
+
+	fragmentIDs, err := getReferencedElementIDs(session, libraryPanel.OrgID, fragmentElement,
+		getFragmentReferences(libraryPanel.Model), errLibraryPanelUnknownFragment)
+	if err != nil {
+		return err
+	}
+	if libraryPanel.Kind == fragmentElement {
+		if err := checkFragmentCycle(session, libraryPanel.ID, fragmentIDs); err != nil {
+			return err
+		}
+	}
+	queryIDs, err := getReferencedElementIDs(session, libraryPanel.OrgID, queryElement,
+		getQueryReferences(libraryPanel.Model), errLibraryPanelUnknownQuery)
+	if err != nil {
+		return err
+	}
+	transformationIDs, err := getReferencedElementIDs(session, libraryPanel.OrgID, transformationElement,
+		getTransformationReferences(libraryPanel.Model), errLibraryPanelUnknownTransformation)
+	if err != nil {
+		return err
+	}
+
+	for _, id := range append(append(fragmentIDs, queryIDs...), transformationIDs...) {
+		if _, err := session.Insert(&libraryPanelDependency{LibraryPanelID: libraryPanel.ID, DependencyID: id}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// getReferencedElementIDs gets the IDs of the library elements of the kind with the UIDs, and fails with
+// notFound if one of them doesn't exist.
+func getReferencedElementIDs(session *sqlstore.DBSession, orgID int64, kind libraryElementKind, uids []string, notFound error) ([]int64, error) {
+	if len(uids) == 0 {
+		return nil, nil
+	}
+	var elements []LibraryPanel
+	if err := session.Table("library_panel").Where("org_id=? AND kind=?", orgID, kind).
+		In("uid", uids).Cols("id", "uid").Find(&elements); err != nil {
+		return nil, err
+	}
+	found := make(map[string]bool, len(elements))
+	for _, element := range elements {
+		found[element.UID] = true
+	}
+	for _, uid := range uids {
+		if !found[uid] {
+			return nil, fmt.Errorf("%w: %s", notFound, uid)
+		}
+	}
+
+	ids := make([]int64, 0, len(elements))
+	for _, element := range elements {
+		ids = append(ids, element.ID)
+	}
+
+	return ids, nil
+}
+
+// checkFragmentCycle follows the stored dependencies of the fragments a fragment references, one level at a
+// time, and fails if they lead back to the fragment.
+func checkFragmentCycle(session *sqlstore.DBSession, fragmentID int64, dependencyIDs []int64) error {
+	visited := map[int64]bool{}
+	level := dependencyIDs
+	for len(level) > 0 {
+		next := make([]interface{}, 0, len(level))
+		for _, id := range level {
+			if id == fragmentID {
+				return errLibraryPanelDependencyCycle
+			}
+			if !visited[id] {
+				visited[id] = true
+				next = append(next, id)
+			}
+		}
+		if len(next) == 0 {
+			return nil
+		}
+
+		level = nil
+		if err := session.Table("library_panel_dependency").In("librarypanel_id", next...).Cols("dependency_id").Find(&level); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// getLibraryPanelDependencies gets the library fragments, queries and transformations a library element
+// references and the library elements referencing it.
+func (lps *LibraryPanelService) getLibraryPanelDependencies(c *models.ReqContext, uid string) (libraryElementDependencies, error) {
+	libraryPanel, err := lps.getLibraryPanel(c, uid)
+	if err != nil {
+		return libraryElementDependencies{}, err
+	}
+
+	result := libraryElementDependencies{Dependencies: make([]libraryElementReference, 0), Dependents: make([]libraryElementReference, 0)}
+	err = lps.SQLStore.WithReadReplicaDbSession(context.Background(), func(session *sqlstore.DBSession) error {
+		if err := session.SQL(`SELECT library_panel.uid, library_panel.name, library_panel.kind FROM library_panel
+			INNER JOIN library_panel_dependency ON library_panel_dependency.dependency_id = library_panel.id
+			WHERE library_panel_dependency.librarypanel_id=? ORDER BY library_panel.name ASC`, libraryPanel.ID).Find(&result.Dependencies); err != nil {
+			return err
+		}
+
+		return session.SQL(`SELECT library_panel.uid, library_panel.name, library_panel.kind FROM library_panel
+			INNER JOIN library_panel_dependency ON library_panel_dependency.librarypanel_id = library_panel.id
+			WHERE library_panel_dependency.dependency_id=? ORDER BY library_panel.name ASC`, libraryPanel.ID).Find(&result.Dependents)
+	})
+	if err != nil {
+		return libraryElementDependencies{}, err
+	}
+
+	return result, nil
+}
+
+// resolveLibraryFragments merges the objects in the dashboard that reference a library fragment with the models
+// of the fragments, including the fragments that the fragments reference, and returns the fragments that were
+// found. It runs after the library panels are resolved, since their models can reference fragments.
+func (lps *LibraryPanelService) resolveLibraryFragments(orgID int64, dashboard interface{}) ([]LibraryPanel, error) {
+	uids := map[string]bool{}
+	collectFragmentReferences(dashboard, uids)
+	fragments := map[string]LibraryPanel{}
+	for depth := 0; depth < maxFragmentDepth && len(uids) > 0; depth++ {
+		missing := make([]string, 0, len(uids))
+		for uid := range uids {
+			missing = append(missing, uid)
+		}
+		found, err := lps.getLibraryPanelsByUIDs(orgID, fragmentElement, missing)
+		if err != nil {
+			return nil, err
+		}
+
+		uids = map[string]bool{}
+		for _, fragment := range found {
+			fragments[fragment.UID] = fragment
+		}
+		for _, fragment := range found {
+			for _, uid := range getFragmentReferences(fragment.Model) {
+				if _, ok := fragments[uid]; !ok {
+					uids[uid] = true
+				}
+			}
+		}
+	}
+	if len(fragments) == 0 {
+		return nil, nil
+	}
+
+	if err := mergeLibraryFragments(dashboard, fragments, map[string]bool{}); err != nil {
+		return nil, err
+	}
+	result := make([]LibraryPanel, 0, len(fragments))
+	for _, fragment := range fragments {
+		result = append(result, fragment)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].UID < result[j].UID })
+
+	return result, nil
+}
+
+// mergeLibraryFragments merges the objects referencing a library fragment with the fragment in place, after
+// merging the fragments that the fragment references. The fragments being merged are skipped, in case fragments
+// were stored with a cycle.
+func mergeLibraryFragments(value interface{}, fragments map[string]LibraryPanel, merging map[string]bool) error {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		for key, child := range value {
+			if key == fragmentReferenceKey {
+				continue
+			}
+			if err := mergeLibraryFragments(child, fragments, merging); err != nil {
+				return err
+			}
+		}
+
+		uid, ok := fragmentReference(value)
+		fragment, found := fragments[uid]
+		if !ok || !found || merging[uid] {
+			return nil
+		}
+		var model map[string]interface{}
+		if err := json.Unmarshal(fragment.Model, &model); err != nil {
+			return err
+		}
+		merging[uid] = true
+		err := mergeLibraryFragments(model, fragments, merging)
+		delete(merging, uid)
+		if err != nil {
+			return err
+		}
+
+		for key, child := range value {
+			model[key] = child
+		}
+		model[fragmentReferenceKey] = map[string]interface{}{"uid": fragment.UID, "name": fragment.Name}
+		for key := range value {
+			delete(value, key)
+		}
+		for key, child := range model {
+			value[key] = child
+		}
+	case []interface{}:
+		for _, child := range value {
+			if err := mergeLibraryFragments(child, fragments, merging); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
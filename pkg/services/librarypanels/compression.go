@@ -0,0 +1,199 @@
+package librarypanels
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"sync"
+	"time"
+
+	"github.com/grafana/grafana/pkg/services/sqlstore"
+)
+
+// Compressions of the stored models.
+const (
+	modelCompressionNone = ""
+	modelCompressionGzip = "gzip"
+)
+
+// compressionBatchSize is the number of stored models that are converted at once when the compression changes.
+const compressionBatchSize = 100
+
+// storedModelsCheckInterval is how often the stored models are checked again until they are all uncompressed.
+const storedModelsCheckInterval = time.Minute
+
+// storedModelState is whether the stored models were found to be all uncompressed, which they have to be for the
+// database to filter on paths inside them. Until they are, models compressed before the compression was turned
+// off are converted and the models are filtered in Go.
+type storedModelState struct {
+	mu           sync.Mutex
+	uncompressed bool
+}
+
+func (state *storedModelState) isUncompressed() bool {
+	state.mu.Lock()
+	defer state.mu.Unlock()
+
+	return state.uncompressed
+}
+
+func (state *storedModelState) setUncompressed(uncompressed bool) {
+	state.mu.Lock()
+	defer state.mu.Unlock()
+
+	state.uncompressed = uncompressed
+}
+
+// compressedModel is how a compressed model is stored. It's a JSON object, so it can be stored in the native
+// JSON columns of Postgres and MySQL.
+type compressedModel struct {
+	Compression string `json:"__compressed"`
+	// Data is base64 encoded in the JSON.
+	Data []byte `json:"data"`
+}
+
+// encodeStoredModel returns the model as it's stored with the compression.
+func encodeStoredModel(model json.RawMessage, compression string) json.RawMessage {
+	if compression != modelCompressionGzip || len(model) == 0 {
+		return model
+	}
+
+	var buffer bytes.Buffer
+	writer := gzip.NewWriter(&buffer)
+	if _, err := writer.Write(model); err != nil {
+		return model
+	}
+	if err := writer.Close(); err != nil {
+		return model
+	}
+	stored, err := json.Marshal(compressedModel{Compression: modelCompressionGzip, Data: buffer.Bytes()})
+	if err != nil {
+		return model
+	}
+
+	return stored
+}
+
+// isCompressedModel returns true if the stored model is compressed, without decompressing it.
+func isCompressedModel(stored json.RawMessage) bool {
+	if !bytes.Contains(stored, []byte(`"__compressed"`)) {
+		return false
+	}
+
+	var header struct {
+		Compression string `json:"__compressed"`
+	}
+	return json.Unmarshal(stored, &header) == nil && header.Compression == modelCompressionGzip
+}
+
+// decodeStoredModel returns the model of a stored model, decompressing it if it was stored compressed. Models
+// are decompressed whatever the configured compression is, so the setting can be changed at any time.
+func decodeStoredModel(stored json.RawMessage) (json.RawMessage, error) {
+	if !isCompressedModel(stored) {
+		return stored, nil
+	}
+
+	var compressed compressedModel
+	if err := json.Unmarshal(stored, &compressed); err != nil {
+		return nil, err
+	}
+	reader, err := gzip.NewReader(bytes.NewReader(compressed.Data))
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = reader.Close() }()
+
+	return ioutil.ReadAll(reader)
+}
+
+// BeforeInsert encodes the model of the Library Panel that is inserted.
+func (lp *LibraryPanel) BeforeInsert() {
+	lp.StoredModel = encodeStoredModel(lp.Model, lp.modelCompression)
+}
+
+// BeforeUpdate encodes the model of the Library Panel that is updated.
+func (lp *LibraryPanel) BeforeUpdate() {
+	lp.StoredModel = encodeStoredModel(lp.Model, lp.modelCompression)
+}
+
+// modelsFilterable returns true if the database can filter on paths inside the stored models, which it can't
+// while some of them are compressed.
+func (lps *LibraryPanelService) modelsFilterable() bool {
+	return lps.modelCompression == modelCompressionNone && lps.storedModels.isUncompressed()
+}
+
+// checkStoredModels checks if the stored models are all uncompressed, and returns true if they are.
+func (lps *LibraryPanelService) checkStoredModels() (bool, error) {
+	if lps.modelCompression != modelCompressionNone {
+		lps.storedModels.setUncompressed(false)
+		return false, nil
+	}
+
+	compressed := false
+	err := lps.SQLStore.WithDbSession(context.Background(), func(session *sqlstore.DBSession) error {
+		session.Table("library_panel")
+		if expr, ok := jsonPathSQL(lps.SQLStore.Dialect, "model", "__compressed"); ok {
+			session.Where(expr + " IS NOT NULL")
+		} else {
+			session.Where("model "+lps.SQLStore.Dialect.LikeStr()+" ?", `%"__compressed"%`)
+		}
+
+		var err error
+		compressed, err = session.Exist()
+		return err
+	})
+	if err != nil {
+		return false, err
+	}
+
+	lps.storedModels.setUncompressed(!compressed)
+	return !compressed, nil
+}
+
+// AfterLoad decodes the stored model of the Library Panel that was read. A model that can't be decompressed is
+// kept as it's stored, so the validation of the model reports it.
+func (lp *LibraryPanel) AfterLoad() {
+	model, err := decodeStoredModel(lp.StoredModel)
+	if err != nil {
+		model = lp.StoredModel
+	}
+	lp.Model = model
+}
+
+// convertStoredModels compresses or decompresses the stored models that aren't stored with the configured
+// compression, and returns the number of models converted.
+func (lps *LibraryPanelService) convertStoredModels() (int, error) {
+	converted := 0
+	var lastID int64
+	for {
+		var libraryPanels []LibraryPanel
+		err := lps.SQLStore.WithTransactionalDbSession(context.Background(), func(session *sqlstore.DBSession) error {
+			if err := session.Table("library_panel").Cols("id", "model").Where("id>?", lastID).OrderBy("id ASC").
+				Limit(compressionBatchSize).Find(&libraryPanels); err != nil {
+				return err
+			}
+
+			for i := range libraryPanels {
+				if isCompressedModel(libraryPanels[i].StoredModel) == (lps.modelCompression != modelCompressionNone) {
+					continue
+				}
+				libraryPanels[i].modelCompression = lps.modelCompression
+				if _, err := session.ID(libraryPanels[i].ID).Cols("model").Update(&libraryPanels[i]); err != nil {
+					return err
+				}
+				converted++
+			}
+
+			return nil
+		})
+		if err != nil {
+			return converted, err
+		}
+		if len(libraryPanels) < compressionBatchSize {
+			return converted, nil
+		}
+		lastID = libraryPanels[len(libraryPanels)-1].ID
+	}
+}
@@ -0,0 +1,148 @@
+package librarypanels
+
+import (
+	"context"
+	"time"
+
+	"github.com/grafana/grafana/pkg/api/dtos"
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/sqlstore"
+	"github.com/grafana/grafana/pkg/services/sqlstore/migrator"
+	"github.com/grafana/grafana/pkg/services/sqlstore/permissions"
+)
+
+const (
+	defaultConnectionsPerPage = 100
+	maxConnectionsPerPage     = 1000
+)
+
+// getAllConnectionsQuery is the query for listing the Library Panel connections in an org.
+type getAllConnectionsQuery struct {
+	Page    int
+	PerPage int
+}
+
+// libraryPanelConnection is a connection between a Library Panel and a dashboard, with the user who connected
+// them. The user fields are empty for connections made with API keys or by users that were deleted since.
+type libraryPanelConnection struct {
+	ID                 int64     `json:"id" xorm:"id"`
+	LibraryPanelUID    string    `json:"libraryPanelUid" xorm:"librarypanel_uid"`
+	LibraryPanelName   string    `json:"libraryPanelName" xorm:"librarypanel_name"`
+	DashboardID        int64     `json:"dashboardId" xorm:"dashboard_id"`
+	DashboardUID       string    `json:"dashboardUid" xorm:"dashboard_uid"`
+	DashboardTitle     string    `json:"dashboardTitle" xorm:"dashboard_title"`
+	PanelID            int64     `json:"panelId" xorm:"panel_id"`
+	Created            time.Time `json:"created" xorm:"created"`
+	CreatedBy          int64     `json:"createdBy" xorm:"created_by"`
+	CreatedByLogin     string    `json:"createdByLogin" xorm:"created_by_login"`
+	CreatedByName      string    `json:"createdByName" xorm:"created_by_name"`
+	CreatedByEmail     string    `json:"createdByEmail" xorm:"created_by_email"`
+	CreatedByAvatarURL string    `json:"createdByAvatarUrl" xorm:"-"`
+}
+
+// getAllConnectionsResult is a page of the Library Panel connections in an org.
+type getAllConnectionsResult struct {
+	TotalCount  int64                    `json:"totalCount"`
+	Connections []libraryPanelConnection `json:"connections"`
+	Page        int                      `json:"page"`
+	PerPage     int                      `json:"perPage"`
+}
+
+// getAllConnections gets the connections between the Library Panels and dashboards in the org, ordered by
+// Library Panel name. Connections to dashboards that don't exist anymore have an empty dashboard title.
+func (lps *LibraryPanelService) getAllConnections(c *models.ReqContext, query getAllConnectionsQuery) (getAllConnectionsResult, error) {
+	if query.PerPage <= 0 {
+		query.PerPage = defaultConnectionsPerPage
+	}
+	if query.PerPage > maxConnectionsPerPage {
+		query.PerPage = maxConnectionsPerPage
+	}
+	if query.Page <= 0 {
+		query.Page = 1
+	}
+
+	result := getAllConnectionsResult{
+		Connections: make([]libraryPanelConnection, 0),
+		Page:        query.Page,
+		PerPage:     query.PerPage,
+	}
+	err := lps.SQLStore.WithReadReplicaDbSession(context.Background(), func(session *sqlstore.DBSession) error {
+		dialect := lps.SQLStore.Dialect
+		orgID := c.SignedInUser.OrgId
+		from := ` FROM library_panel_dashboard
+			INNER JOIN library_panel ON library_panel.id = library_panel_dashboard.librarypanel_id
+			WHERE library_panel.org_id=?`
+
+		if _, err := session.SQL("SELECT COUNT(*)"+from, orgID).Get(&result.TotalCount); err != nil {
+			return err
+		}
+
+		if err := session.SQL(connectionsSQL(dialect)+`
+			WHERE library_panel.org_id=?
+			ORDER BY library_panel.name ASC, library_panel_dashboard.id ASC`+
+			dialect.LimitOffset(int64(query.PerPage), int64((query.Page-1)*query.PerPage)), orgID).Find(&result.Connections); err != nil {
+			return err
+		}
+		resolveConnectionAvatars(result.Connections)
+		return nil
+	})
+
+	return result, err
+}
+
+// getLibraryPanelConnections gets the connections of a Library Panel to the dashboards the user can view, oldest
+// first. Admins also get the connections to dashboards that don't exist anymore, with an empty dashboard title.
+func (lps *LibraryPanelService) getLibraryPanelConnections(c *models.ReqContext, uid string) ([]libraryPanelConnection, error) {
+	libraryPanel, err := lps.getLibraryPanel(c, uid)
+	if err != nil {
+		return nil, err
+	}
+
+	connections := make([]libraryPanelConnection, 0)
+	err = lps.SQLStore.WithReadReplicaDbSession(context.Background(), func(session *sqlstore.DBSession) error {
+		builder := sqlstore.SQLBuilder{}
+		builder.Write(connectionsSQL(lps.SQLStore.Dialect)+" WHERE library_panel.id=?", libraryPanel.ID)
+		if c.SignedInUser.OrgRole != models.ROLE_ADMIN {
+			filterSQL, params := permissions.DashboardPermissionFilter{
+				OrgRole:         c.SignedInUser.OrgRole,
+				Dialect:         lps.SQLStore.Dialect,
+				UserId:          c.SignedInUser.UserId,
+				OrgId:           c.SignedInUser.OrgId,
+				PermissionLevel: models.PERMISSION_VIEW,
+			}.Where()
+			builder.Write(" AND "+filterSQL, params...)
+		}
+		builder.Write(" ORDER BY library_panel_dashboard.created ASC, library_panel_dashboard.id ASC")
+
+		if err := session.SQL(builder.GetSQLString(), builder.GetParams()...).Find(&connections); err != nil {
+			return err
+		}
+		resolveConnectionAvatars(connections)
+		return nil
+	})
+
+	return connections, err
+}
+
+// connectionsSQL selects the connections with their Library Panel, dashboard and the user who connected them.
+// Dashboards and users are left joined, so connections to deleted dashboards or by deleted users are kept.
+func connectionsSQL(dialect migrator.Dialect) string {
+	user := dialect.Quote("user")
+	return `SELECT library_panel_dashboard.id, library_panel.uid AS librarypanel_uid, library_panel.name AS librarypanel_name,
+		library_panel_dashboard.dashboard_id, COALESCE(dashboard.uid, '') AS dashboard_uid, COALESCE(dashboard.title, '') AS dashboard_title,
+		library_panel_dashboard.panel_id, library_panel_dashboard.created, library_panel_dashboard.created_by,
+		COALESCE(` + user + `.login, '') AS created_by_login, COALESCE(` + user + `.name, '') AS created_by_name,
+		COALESCE(` + user + `.email, '') AS created_by_email
+		FROM library_panel_dashboard
+		INNER JOIN library_panel ON library_panel.id = library_panel_dashboard.librarypanel_id
+		LEFT JOIN dashboard ON dashboard.id = library_panel_dashboard.dashboard_id
+		LEFT JOIN ` + user + ` ON ` + user + `.id = library_panel_dashboard.created_by`
+}
+
+func resolveConnectionAvatars(connections []libraryPanelConnection) {
+	for i := range connections {
+		if connections[i].CreatedByEmail != "" {
+			connections[i].CreatedByAvatarURL = dtos.GetGravatarUrl(connections[i].CreatedByEmail)
+		}
+	}
+}
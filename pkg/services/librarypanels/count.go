@@ -0,0 +1,89 @@
+package librarypanels
+
+import (
+	"github.com/grafana/grafana/pkg/services/sqlstore"
+)
+
+// countLibraryPanels returns the number of library elements of the kind in the org, or of all kinds if the kind
+// is 0.
+func countLibraryPanels(session *sqlstore.DBSession, orgID int64, kind libraryElementKind) (int64, error) {
+	session.Table("library_panel").Where("org_id=?", orgID)
+	if kind != 0 {
+		session.And("kind=?", kind)
+	}
+
+	return session.Count()
+}
+
+// countLibraryPanelsByFolder returns the number of library elements of the kind in each folder of the org, or of
+// all kinds if the kind is 0, in a single query. Folders without library elements aren't in the map.
+func countLibraryPanelsByFolder(session *sqlstore.DBSession, orgID int64, kind libraryElementKind) (map[int64]int64, error) {
+	var rows []struct {
+		FolderID int64 `xorm:"folder_id"`
+		Count    int64 `xorm:"count"`
+	}
+	session.Table("library_panel").Select("folder_id, COUNT(*) AS count").Where("org_id=?", orgID)
+	if kind != 0 {
+		session.And("kind=?", kind)
+	}
+	if err := session.GroupBy("folder_id").Find(&rows); err != nil {
+		return nil, err
+	}
+
+	counts := make(map[int64]int64, len(rows))
+	for _, row := range rows {
+		counts[row.FolderID] = row.Count
+	}
+
+	return counts, nil
+}
+
+// countConnectedDashboards returns the number of dashboards connected to a Library Panel. Dashboards using the
+// Library Panel in several panels are counted once.
+func countConnectedDashboards(session *sqlstore.DBSession, libraryPanelID int64) (int64, error) {
+	counts, err := countConnectedDashboardsByPanel(session, []int64{libraryPanelID})
+	return counts[libraryPanelID], err
+}
+
+// countConnectedDashboardsByPanel returns the number of connected dashboards of each of the Library Panels, in a
+// single query. Library Panels without connections aren't in the map.
+func countConnectedDashboardsByPanel(session *sqlstore.DBSession, libraryPanelIDs []int64) (map[int64]int64, error) {
+	counts := make(map[int64]int64, len(libraryPanelIDs))
+	if len(libraryPanelIDs) == 0 {
+		return counts, nil
+	}
+
+	var rows []struct {
+		LibraryPanelID int64 `xorm:"librarypanel_id"`
+		Count          int64 `xorm:"count"`
+	}
+	err := session.Table("library_panel_dashboard").Select("librarypanel_id, COUNT(DISTINCT dashboard_id) AS count").
+		In("librarypanel_id", libraryPanelIDs).GroupBy("librarypanel_id").Find(&rows)
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		counts[row.LibraryPanelID] = row.Count
+	}
+
+	return counts, nil
+}
+
+// loadConnectedDashboardCounts sets the number of connected dashboards on the given Library Panels using a
+// single query, for lists that show how widely each Library Panel is used.
+func loadConnectedDashboardCounts(session *sqlstore.DBSession, libraryPanels []LibraryPanel) error {
+	ids := make([]int64, 0, len(libraryPanels))
+	for _, panel := range libraryPanels {
+		ids = append(ids, panel.ID)
+	}
+
+	counts, err := countConnectedDashboardsByPanel(session, ids)
+	if err != nil {
+		return err
+	}
+	for i := range libraryPanels {
+		libraryPanels[i].ConnectedDashboards = counts[libraryPanels[i].ID]
+	}
+
+	return nil
+}
@@ -2,24 +2,117 @@ package librarypanels
 
 import (
 	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/grafana/grafana/pkg/util"
 
+	"github.com/grafana/grafana/pkg/bus"
 	"github.com/grafana/grafana/pkg/models"
 
 	"github.com/grafana/grafana/pkg/services/sqlstore"
+	"github.com/grafana/grafana/pkg/services/sqlstore/migrator"
+	"github.com/grafana/grafana/pkg/services/sqlstore/permissions"
 )
 
-// createLibraryPanel adds a Library Panel.
+// getDefaultFolderID gets the folder that new Library Panels are added to if no folder is set, from the
+// preferences of the org. It is 0, the General folder, if the org has no default folder.
+func getDefaultFolderID(orgID int64) (int64, error) {
+	query := models.GetPreferencesQuery{OrgId: orgID}
+	if err := bus.Dispatch(&query); err != nil {
+		return 0, err
+	}
+
+	return query.Result.LibraryPanelFolderId, nil
+}
+
+// maxUIDAttempts is the number of UIDs generated for a new Library Panel before giving up on finding one that
+// isn't used.
+const maxUIDAttempts = 5
+
+// errLibraryPanelUIDCollision is an error for when no unused UID could be generated. It isn't an API error, since
+// the user can't resolve it.
+var errLibraryPanelUIDCollision = errors.New("failed to generate an unused library panel uid")
+
+// errUniqueViolation is returned from the transaction that creates a Library Panel when the insert violates a
+// unique index, to tell a taken name apart from a UID collision once the transaction is rolled back.
+var errUniqueViolation = errors.New("library panel violates a unique index")
+
+// generateLibraryPanelUID generates a UID that no Library Panel in the org uses, in the transaction that creates
+// the Library Panel. The unique index on the UIDs catches concurrent creates that generated the same UID, the
+// Library Panel is then created again.
+func (lps *LibraryPanelService) generateLibraryPanelUID(session *sqlstore.DBSession, orgID int64) (string, error) {
+	generate := lps.uidGenerator
+	if generate == nil {
+		generate = util.GenerateShortUID
+	}
+
+	for attempt := 0; attempt < maxUIDAttempts; attempt++ {
+		uid := generate()
+		exists, err := session.Table("library_panel").Where("org_id=? AND uid=?", orgID, uid).Exist()
+		if err != nil {
+			return "", err
+		}
+		if !exists {
+			return uid, nil
+		}
+	}
+
+	return "", errLibraryPanelUIDCollision
+}
+
+// createLibraryPanel adds a Library Panel, or a library variable if the command has the variable kind.
 func (lps *LibraryPanelService) createLibraryPanel(c *models.ReqContext, cmd createLibraryPanelCommand) (LibraryPanel, error) {
+	if cmd.Kind == 0 {
+		cmd.Kind = panelElement
+	}
+	if cmd.Status == "" {
+		cmd.Status = statusPublished
+	}
+	if cmd.Status != statusDraft && cmd.Status != statusPublished {
+		return LibraryPanel{}, errLibraryPanelInvalidStatus
+	}
+	cmd.Model = normalizeModel(cmd.Kind, cmd.Model)
+	if err := validateElementModel(cmd.Kind, cmd.Model, lps.Cfg.LibraryPanels); err != nil {
+		return LibraryPanel{}, err
+	}
+
+	if cmd.FolderID == nil {
+		folderID, err := getDefaultFolderID(c.SignedInUser.OrgId)
+		if err != nil {
+			return LibraryPanel{}, err
+		}
+		cmd.FolderID = &folderID
+	}
+
+	limitReached, err := lps.QuotaService.QuotaReached(c, "library_panel")
+	if err != nil {
+		return LibraryPanel{}, err
+	}
+	if limitReached {
+		return LibraryPanel{}, errLibraryPanelQuotaReached
+	}
+
 	libraryPanel := LibraryPanel{
 		OrgID:    c.SignedInUser.OrgId,
-		FolderID: cmd.FolderID,
-		UID:      util.GenerateShortUID(),
+		FolderID: *cmd.FolderID,
 		Name:     cmd.Name,
+		Kind:     cmd.Kind,
 		Model:    cmd.Model,
+		Tags:     normalizeTags(cmd.Tags),
+
+		ModelHash:        modelHash(cmd.Model),
+		SchemaVersion:    currentPanelSchemaVersion,
+		CatalogUID:       cmd.CatalogUID,
+		RegistrySource:   cmd.RegistrySource,
+		RegistryRevision: cmd.RegistryRevision,
+		Status:           cmd.Status,
+		OwnerTeamID:      cmd.OwnerTeamID,
 
 		Created: time.Now(),
 		Updated: time.Now(),
@@ -27,33 +120,159 @@ func (lps *LibraryPanelService) createLibraryPanel(c *models.ReqContext, cmd cre
 		CreatedBy: c.SignedInUser.UserId,
 		UpdatedBy: c.SignedInUser.UserId,
 	}
-	err := lps.SQLStore.WithTransactionalDbSession(context.Background(), func(session *sqlstore.DBSession) error {
-		if _, err := session.Insert(&libraryPanel); err != nil {
-			if lps.SQLStore.Dialect.IsUniqueConstraintViolation(err) {
-				return errLibraryPanelAlreadyExists
+	// the insert violates a unique index if the name is taken, or if a concurrent create stored the same
+	// generated UID first, in which case the Library Panel is created again with another UID
+	for attempt := 1; ; attempt++ {
+		err = lps.SQLStore.WithTransactionalDbSession(context.Background(), func(session *sqlstore.DBSession) error {
+			if err := checkCanEditFolder(session, lps.SQLStore.Dialect, c.SignedInUser, libraryPanel.FolderID); err != nil {
+				return err
+			}
+			if err := checkOwnerTeam(session, libraryPanel.OrgID, libraryPanel.OwnerTeamID); err != nil {
+				return err
+			}
+			if maxPanels := lps.Cfg.LibraryPanels.MaxPanelsPerOrg; maxPanels > 0 {
+				count, err := countLibraryPanels(session, libraryPanel.OrgID, 0)
+				if err != nil {
+					return err
+				}
+				if count >= maxPanels {
+					return errLibraryPanelQuotaReached
+				}
 			}
+			uid, err := lps.generateLibraryPanelUID(session, libraryPanel.OrgID)
+			if err != nil {
+				return err
+			}
+			libraryPanel.UID = uid
+			libraryPanel.modelCompression = lps.modelCompression
+			if _, err := session.Insert(&libraryPanel); err != nil {
+				if lps.SQLStore.Dialect.IsUniqueConstraintViolation(err) {
+					return errUniqueViolation
+				}
+				return err
+			}
+
+			if err := setLibraryPanelTags(session, libraryPanel.ID, libraryPanel.Tags); err != nil {
+				return err
+			}
+			if err := setLibraryPanelDependencies(session, libraryPanel); err != nil {
+				return err
+			}
+			if libraryPanel.Kind == queryElement {
+				if err := addLibraryQueryVersion(session, libraryPanel); err != nil {
+					return err
+				}
+			}
+			if err := recordLibraryPanelChange(session, libraryPanel, changeActionCreated, c.SignedInUser.UserId); err != nil {
+				return err
+			}
+
+			return setLibraryPanelDatasources(session, libraryPanel.ID, libraryPanel.Model)
+		})
+		if !errors.Is(err, errUniqueViolation) {
+			break
+		}
+		// the primary database is read, the Library Panel with the name can be missing on a lagging replica
+		nameTaken := false
+		checkErr := lps.SQLStore.WithDbSession(context.Background(), func(session *sqlstore.DBSession) error {
+			var err error
+			nameTaken, err = session.Table("library_panel").Where("org_id=? AND folder_id=? AND name=? AND kind=?",
+				libraryPanel.OrgID, libraryPanel.FolderID, libraryPanel.Name, libraryPanel.Kind).Exist()
 			return err
+		})
+		if checkErr != nil {
+			return LibraryPanel{}, checkErr
 		}
-		return nil
-	})
+		if nameTaken {
+			err = errLibraryPanelAlreadyExists
+			break
+		}
+		if attempt == maxUIDAttempts {
+			err = errLibraryPanelUIDCollision
+			break
+		}
+	}
+	if err == nil {
+		lps.warnIfQuotaThresholdCrossed(libraryPanel)
+	}
 
 	return libraryPanel, err
 }
 
-// connectDashboard adds a connection between a Library Panel and a Dashboard.
-func (lps *LibraryPanelService) connectDashboard(c *models.ReqContext, uid string, dashboardID int64) error {
+// libraryPanelNameExists returns true if a library element of the kind in the query already has the name in the
+// folder. It uses the unique index on the names, so that it's cheap enough to check names as they are typed.
+func (lps *LibraryPanelService) libraryPanelNameExists(c *models.ReqContext, query nameExistsQuery) (bool, error) {
+	if query.Name == "" {
+		return false, errLibraryPanelNameRequired
+	}
+	if query.Kind == 0 {
+		query.Kind = panelElement
+	}
+
+	exists := false
+	err := lps.SQLStore.WithReadReplicaDbSession(context.Background(), func(session *sqlstore.DBSession) error {
+		session.Table("library_panel").Where("org_id=? AND folder_id=? AND name=? AND kind=?",
+			c.SignedInUser.OrgId, query.FolderID, query.Name, query.Kind)
+		if query.UID != "" {
+			session.Where("uid<>?", query.UID)
+		}
+
+		var err error
+		exists, err = session.Exist()
+		return err
+	})
+
+	return exists, err
+}
+
+// connectDashboard adds a connection between a Library Panel and a panel in a Dashboard. The panelID is the id
+// of the panel in the dashboard JSON that uses the Library Panel, 0 if it's unknown. A dashboard using the Library
+// Panel in several panels has a connection for each of them. It requires view permission on the Library Panel and
+// edit permission on the dashboard.
+func (lps *LibraryPanelService) connectDashboard(c *models.ReqContext, uid string, dashboardID int64, panelID int64) error {
 	err := lps.SQLStore.WithTransactionalDbSession(context.Background(), func(session *sqlstore.DBSession) error {
 		panel, err := getLibraryPanel(session, uid, c.SignedInUser.OrgId)
 		if err != nil {
 			return err
 		}
 
-		// TODO add check that dashboard exists
+		if err := checkCanViewLibraryPanel(session, lps.SQLStore.Dialect, c.SignedInUser, panel); err != nil {
+			return err
+		}
+		if err := checkDashboardInOrg(session, dashboardID, panel.OrgID); err != nil {
+			return err
+		}
+		if err := checkCanEditDashboard(session, lps.SQLStore.Dialect, c.SignedInUser, dashboardID); err != nil {
+			return err
+		}
+
+		now := time.Now()
+		var existing []libraryPanelDashboard
+		if err := session.Where("librarypanel_id=? AND dashboard_id=?", panel.ID, dashboardID).Find(&existing); err != nil {
+			return err
+		}
+		for _, connection := range existing {
+			// a connection without panel already covers any panel of the dashboard
+			if connection.PanelID == panelID || panelID == 0 {
+				return nil
+			}
+		}
+		for _, connection := range existing {
+			// connections recorded before the panel was known get it now
+			if connection.PanelID == 0 {
+				_, err := session.Exec("UPDATE library_panel_dashboard SET panel_id=? WHERE id=?", panelID, connection.ID)
+				return err
+			}
+		}
+		if err := lps.checkConnectionLimits(session, panel.ID, dashboardID, len(existing) == 0); err != nil {
+			return err
+		}
 
 		libraryPanelDashboard := libraryPanelDashboard{
 			DashboardID:    dashboardID,
 			LibraryPanelID: panel.ID,
-			Created:        time.Now(),
+			PanelID:        panelID,
+			Created:        now,
 			CreatedBy:      c.SignedInUser.UserId,
 		}
 		if _, err := session.Insert(&libraryPanelDashboard); err != nil {
@@ -62,7 +281,9 @@ func (lps *LibraryPanelService) connectDashboard(c *models.ReqContext, uid strin
 			}
 			return err
 		}
-		return nil
+
+		_, err = session.Exec("UPDATE library_panel SET last_connected_at=? WHERE id=?", now, panel.ID)
+		return err
 	})
 
 	return err
@@ -71,38 +292,209 @@ func (lps *LibraryPanelService) connectDashboard(c *models.ReqContext, uid strin
 // deleteLibraryPanel deletes a Library Panel.
 func (lps *LibraryPanelService) deleteLibraryPanel(c *models.ReqContext, uid string) error {
 	orgID := c.SignedInUser.OrgId
-	return lps.SQLStore.WithTransactionalDbSession(context.Background(), func(session *sqlstore.DBSession) error {
-		result, err := session.Exec("DELETE FROM library_panel WHERE uid=? and org_id=?", uid, orgID)
+	var deletedID int64
+	err := lps.SQLStore.WithTransactionalDbSession(context.Background(), func(session *sqlstore.DBSession) error {
+		panel, err := getLibraryPanel(session, uid, orgID)
 		if err != nil {
 			return err
 		}
-
-		if rowsAffected, err := result.RowsAffected(); err != nil {
+		if err := checkCanEditLibraryPanel(session, lps.SQLStore.Dialect, c.SignedInUser, panel); err != nil {
+			return err
+		}
+		if panel.SyncPath != "" {
+			return errLibraryPanelProvisioned
+		}
+		if panel.ReplicaOf != 0 {
+			return errLibraryPanelReplica
+		}
+		if err := checkIfMatch(c, panel); err != nil {
+			return err
+		}
+		if dependents, err := session.Where("dependency_id=?", panel.ID).Count(&libraryPanelDependency{}); err != nil {
+			return err
+		} else if dependents > 0 {
+			return errLibraryElementInUse
+		}
+		if err := checkNoDerivedAlertRules(session, panel.ID); err != nil {
 			return err
-		} else if rowsAffected != 1 {
-			return errLibraryPanelNotFound
 		}
 
-		return nil
+		deletedID = panel.ID
+		if err := recordLibraryPanelChange(session, panel, changeActionDeleted, c.SignedInUser.UserId); err != nil {
+			return err
+		}
+		return deleteLibraryPanelByID(session, panel.ID)
 	})
+	if err == nil {
+		lps.invalidateLibraryPanelCache()
+		lps.reconcileReplicasAfterChange(deletedID)
+	}
+
+	return err
+}
+
+// deleteLibraryPanelByID deletes a Library Panel together with its connections, tags, usage statistics, collection
+// memberships, pending changes, comments, stars, thumbnail, dependencies, library query versions, alert rules,
+// replication rules, scheduled changes and experimental variant. Replicated copies are deleted by the reconciler.
+func deleteLibraryPanelByID(session *sqlstore.DBSession, id int64) error {
+	if _, err := session.Exec("DELETE FROM library_panel_dashboard WHERE librarypanel_id=?", id); err != nil {
+		return err
+	}
+	if _, err := session.Exec("DELETE FROM library_panel_tag WHERE librarypanel_id=?", id); err != nil {
+		return err
+	}
+	if _, err := session.Exec("DELETE FROM library_panel_stat WHERE librarypanel_id=?", id); err != nil {
+		return err
+	}
+	if _, err := session.Exec("DELETE FROM library_panel_datasource WHERE librarypanel_id=?", id); err != nil {
+		return err
+	}
+	if _, err := session.Exec("DELETE FROM library_panel_collection_member WHERE librarypanel_id=?", id); err != nil {
+		return err
+	}
+	if _, err := session.Exec("DELETE FROM library_panel_pending_change WHERE librarypanel_id=?", id); err != nil {
+		return err
+	}
+	if _, err := session.Exec("DELETE FROM library_panel_comment WHERE librarypanel_id=?", id); err != nil {
+		return err
+	}
+	if _, err := session.Exec("DELETE FROM library_panel_star WHERE librarypanel_id=?", id); err != nil {
+		return err
+	}
+	if _, err := session.Exec("DELETE FROM library_panel_notification WHERE librarypanel_id=?", id); err != nil {
+		return err
+	}
+	if _, err := session.Exec("DELETE FROM library_panel_notification_mute WHERE librarypanel_id=?", id); err != nil {
+		return err
+	}
+	if _, err := session.Exec("DELETE FROM library_panel_thumbnail WHERE librarypanel_id=?", id); err != nil {
+		return err
+	}
+	if _, err := session.Exec("DELETE FROM library_panel_dependency WHERE librarypanel_id=? OR dependency_id=?", id, id); err != nil {
+		return err
+	}
+	if _, err := session.Exec("DELETE FROM library_query_version WHERE librarypanel_id=?", id); err != nil {
+		return err
+	}
+	if _, err := session.Exec("DELETE FROM library_panel_alert WHERE librarypanel_id=?", id); err != nil {
+		return err
+	}
+	if _, err := session.Exec("DELETE FROM library_panel_replication WHERE librarypanel_id=?", id); err != nil {
+		return err
+	}
+	if _, err := session.Exec("DELETE FROM library_panel_scheduled_change WHERE librarypanel_id=?", id); err != nil {
+		return err
+	}
+	if _, err := session.Exec("DELETE FROM library_panel_variant WHERE librarypanel_id=?", id); err != nil {
+		return err
+	}
+	if _, err := session.Exec("DELETE FROM library_panel_variant_team WHERE librarypanel_id=?", id); err != nil {
+		return err
+	}
+	if _, err := session.Exec("DELETE FROM library_panel_edit_suggestion WHERE librarypanel_id=?", id); err != nil {
+		return err
+	}
+	if _, err := session.Exec("DELETE FROM library_panel_duplicate WHERE librarypanel_id=?", id); err != nil {
+		return err
+	}
+	if _, err := session.Exec("DELETE FROM library_panel_translation WHERE librarypanel_id=?", id); err != nil {
+		return err
+	}
+
+	result, err := session.Exec("DELETE FROM library_panel WHERE id=?", id)
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected, err := result.RowsAffected(); err != nil {
+		return err
+	} else if rowsAffected != 1 {
+		return errLibraryPanelNotFound
+	}
+
+	return nil
 }
 
-// disconnectDashboard deletes a connection between a Library Panel and a Dashboard.
-func (lps *LibraryPanelService) disconnectDashboard(c *models.ReqContext, uid string, dashboardID int64) error {
+// deleteCrossOrgConnectionsSQL deletes the connections between Library Panels and dashboards of different orgs.
+const deleteCrossOrgConnectionsSQL = `DELETE FROM library_panel_dashboard WHERE EXISTS (
+	SELECT 1 FROM library_panel, dashboard
+	WHERE library_panel.id = library_panel_dashboard.librarypanel_id
+	AND dashboard.id = library_panel_dashboard.dashboard_id
+	AND dashboard.org_id <> library_panel.org_id)`
+
+// checkDashboardInOrg returns errLibraryPanelConnectedDashboardNotFound if the dashboard doesn't exist in the org of
+// the Library Panel. Dashboards of other orgs aren't told apart from dashboards that don't exist, so their ids can't
+// be probed. Admins can edit any dashboard id, so the permission checks don't cover it.
+func checkDashboardInOrg(session *sqlstore.DBSession, dashboardID int64, orgID int64) error {
+	exists, err := session.Table("dashboard").Where("id=? AND org_id=?", dashboardID, orgID).Exist()
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return errLibraryPanelConnectedDashboardNotFound
+	}
+
+	return nil
+}
+
+// checkConnectionLimits returns an error if adding a connection between the Library Panel and the dashboard would
+// exceed the MaxDashboardsPerPanel or MaxConnectionsPerDashboard. newDashboard is whether the Library Panel isn't
+// connected to the dashboard yet, only then it counts against the dashboards of the Library Panel. Connections to
+// deleted dashboards are kept, but don't count against the limits.
+func (lps *LibraryPanelService) checkConnectionLimits(session *sqlstore.DBSession, libraryPanelID int64, dashboardID int64, newDashboard bool) error {
+	if maxDashboards := lps.Cfg.LibraryPanels.MaxDashboardsPerPanel; maxDashboards > 0 && newDashboard {
+		var count int64
+		if _, err := session.SQL(`SELECT COUNT(DISTINCT library_panel_dashboard.dashboard_id) FROM library_panel_dashboard
+			INNER JOIN dashboard ON dashboard.id = library_panel_dashboard.dashboard_id
+			WHERE library_panel_dashboard.librarypanel_id=?`, libraryPanelID).Get(&count); err != nil {
+			return err
+		}
+		if count >= maxDashboards {
+			return errLibraryPanelTooManyDashboards
+		}
+	}
+	if maxConnections := lps.Cfg.LibraryPanels.MaxConnectionsPerDashboard; maxConnections > 0 {
+		var count int64
+		if _, err := session.SQL(`SELECT COUNT(*) FROM library_panel_dashboard
+			INNER JOIN library_panel ON library_panel.id = library_panel_dashboard.librarypanel_id
+			WHERE library_panel_dashboard.dashboard_id=?`, dashboardID).Get(&count); err != nil {
+			return err
+		}
+		if count >= maxConnections {
+			return errLibraryPanelTooManyConnections
+		}
+	}
+
+	return nil
+}
+
+// disconnectDashboard deletes the connection between a Library Panel and a panel in a Dashboard. If panelID is 0
+// all connections between the Library Panel and the Dashboard are deleted. It requires edit permission on the
+// dashboard, the Library Panel is only read.
+func (lps *LibraryPanelService) disconnectDashboard(c *models.ReqContext, uid string, dashboardID int64, panelID int64) error {
 	return lps.SQLStore.WithTransactionalDbSession(context.Background(), func(session *sqlstore.DBSession) error {
 		panel, err := getLibraryPanel(session, uid, c.SignedInUser.OrgId)
 		if err != nil {
 			return err
 		}
 
-		result, err := session.Exec("DELETE FROM library_panel_dashboard WHERE librarypanel_id=? and dashboard_id=?", panel.ID, dashboardID)
+		if err := checkCanEditDashboard(session, lps.SQLStore.Dialect, c.SignedInUser, dashboardID); err != nil {
+			return err
+		}
+
+		var result sql.Result
+		if panelID == 0 {
+			result, err = session.Exec("DELETE FROM library_panel_dashboard WHERE librarypanel_id=? and dashboard_id=?", panel.ID, dashboardID)
+		} else {
+			result, err = session.Exec("DELETE FROM library_panel_dashboard WHERE librarypanel_id=? and dashboard_id=? and panel_id=?", panel.ID, dashboardID, panelID)
+		}
 		if err != nil {
 			return err
 		}
 
 		if rowsAffected, err := result.RowsAffected(); err != nil {
 			return err
-		} else if rowsAffected != 1 {
+		} else if rowsAffected == 0 {
 			return errLibraryPanelDashboardNotFound
 		}
 
@@ -125,56 +517,377 @@ func getLibraryPanel(session *sqlstore.DBSession, uid string, orgID int64) (Libr
 		return LibraryPanel{}, fmt.Errorf("found %d panels, while expecting at most one", len(libraryPanels))
 	}
 
+	if libraryPanels[0].ModelHash == "" {
+		libraryPanels[0].ModelHash = modelHash(libraryPanels[0].Model)
+	}
+	upgradeLibraryPanelModels(libraryPanels)
+	normalizeLibraryPanelModels(libraryPanels)
+	if err := loadLibraryPanelTags(session, libraryPanels); err != nil {
+		return LibraryPanel{}, err
+	}
+
 	return libraryPanels[0], nil
 }
 
-// getLibraryPanel gets a Library Panel.
+// normalizeTags trims and de-duplicates tags, dropping empty ones.
+func normalizeTags(tags []string) []string {
+	normalized := make([]string, 0, len(tags))
+	seen := make(map[string]bool, len(tags))
+	for _, tag := range tags {
+		tag = strings.TrimSpace(tag)
+		if tag == "" || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		normalized = append(normalized, tag)
+	}
+
+	return normalized
+}
+
+// setLibraryPanelTags replaces the tags of a Library Panel.
+func setLibraryPanelTags(session *sqlstore.DBSession, libraryPanelID int64, tags []string) error {
+	if _, err := session.Exec("DELETE FROM library_panel_tag WHERE librarypanel_id=?", libraryPanelID); err != nil {
+		return err
+	}
+
+	for _, tag := range tags {
+		if _, err := session.Insert(&libraryPanelTag{LibraryPanelID: libraryPanelID, Term: tag}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// loadLibraryPanelTags sets the tags on the given Library Panels using a single query.
+func loadLibraryPanelTags(session *sqlstore.DBSession, libraryPanels []LibraryPanel) error {
+	if len(libraryPanels) == 0 {
+		return nil
+	}
+
+	ids := make([]int64, 0, len(libraryPanels))
+	for _, panel := range libraryPanels {
+		ids = append(ids, panel.ID)
+	}
+
+	var tags []libraryPanelTag
+	if err := session.Table("library_panel_tag").In("librarypanel_id", ids).Asc("term").Find(&tags); err != nil {
+		return err
+	}
+
+	tagsByPanel := make(map[int64][]string)
+	for _, tag := range tags {
+		tagsByPanel[tag.LibraryPanelID] = append(tagsByPanel[tag.LibraryPanelID], tag.Term)
+	}
+
+	for i := range libraryPanels {
+		libraryPanels[i].Tags = tagsByPanel[libraryPanels[i].ID]
+		if libraryPanels[i].Tags == nil {
+			libraryPanels[i].Tags = []string{}
+		}
+	}
+
+	return nil
+}
+
+// getLibraryPanel gets a Library Panel. It reads the primary database, since it's what clients read back after
+// a write and what conditional updates compare their version with, which must not be stale.
 func (lps *LibraryPanelService) getLibraryPanel(c *models.ReqContext, uid string) (LibraryPanel, error) {
 	var libraryPanel LibraryPanel
 	err := lps.SQLStore.WithDbSession(context.Background(), func(session *sqlstore.DBSession) error {
 		var err error
 		libraryPanel, err = getLibraryPanel(session, uid, c.SignedInUser.OrgId)
-		return err
+		if err != nil {
+			return err
+		}
+
+		return checkCanViewLibraryPanel(session, lps.SQLStore.Dialect, c.SignedInUser, libraryPanel)
 	})
 
 	return libraryPanel, err
 }
 
-// getAllLibraryPanels gets all library panels.
-func (lps *LibraryPanelService) getAllLibraryPanels(c *models.ReqContext) ([]LibraryPanel, error) {
+// getLibraryPanelsByUIDs gets the library elements of the given kind with the given UIDs, from the cache if it is
+// enabled. Unknown UIDs are ignored.
+func (lps *LibraryPanelService) getLibraryPanelsByUIDs(orgID int64, kind libraryElementKind, uids []string) ([]LibraryPanel, error) {
+	if !lps.cacheEnabled() {
+		return lps.readLibraryPanelsByUIDs(orgID, kind, uids, false)
+	}
+
+	generation, err := lps.getCacheGeneration()
+	if err != nil {
+		// without the generation the cache could be stale, the database is the source of truth
+		lps.log.Warn("Failed to get the library panel cache generation", "error", err)
+		return lps.readLibraryPanelsByUIDs(orgID, kind, uids, false)
+	}
+	cached, missing := lps.panelCache.get(generation, orgID, kind, uids)
+	if len(missing) == 0 {
+		return cached, nil
+	}
+
+	// the cache is filled from the primary database, a lagging replica could return the models from before the
+	// change that started the generation, which would then be cached until they expire
+	libraryPanels, err := lps.readLibraryPanelsByUIDs(orgID, kind, missing, true)
+	if err != nil {
+		return nil, err
+	}
+	lps.panelCache.set(generation, libraryPanels, lps.Cfg.LibraryPanels.CacheTTL)
+
+	return append(cached, libraryPanels...), nil
+}
+
+// readLibraryPanelsByUIDs reads the library elements of the given kind with the given UIDs from the read replica, or
+// from the primary database if fromPrimary is set.
+func (lps *LibraryPanelService) readLibraryPanelsByUIDs(orgID int64, kind libraryElementKind, uids []string, fromPrimary bool) ([]LibraryPanel, error) {
+	withSession := lps.SQLStore.WithReadReplicaDbSession
+	if fromPrimary {
+		withSession = lps.SQLStore.WithDbSession
+	}
+
+	libraryPanels := make([]LibraryPanel, 0)
+	err := withSession(context.Background(), func(session *sqlstore.DBSession) error {
+		if err := session.Table("library_panel").Where("org_id=? AND kind=?", orgID, kind).In("uid", uids).Find(&libraryPanels); err != nil {
+			return err
+		}
+
+		upgradeLibraryPanelModels(libraryPanels)
+		return loadLibraryPanelTags(session, libraryPanels)
+	})
+
+	return libraryPanels, err
+}
+
+// libraryPanelListColumns are the columns of library_panel without the model, which can be large, for lists
+// that don't return the models.
+const libraryPanelListColumns = `library_panel.id, library_panel.org_id, library_panel.folder_id, library_panel.uid,
+	library_panel.name, library_panel.kind, library_panel.created, library_panel.updated, library_panel.created_by,
+	library_panel.updated_by, library_panel.last_connected_at, library_panel.last_viewed_at, library_panel.schema_version,
+	library_panel.catalog_uid, library_panel.sync_path, library_panel.plugin_id, library_panel.plugin_path,
+	library_panel.status, library_panel.deprecated, library_panel.replaced_by, library_panel.pinned,
+	library_panel.owner_team_id`
+
+// libraryPanelColumns returns the columns of library_panel to select for a list, with or without the model.
+func libraryPanelColumns(includeModel bool) string {
+	if includeModel {
+		return "library_panel.*"
+	}
+
+	return libraryPanelListColumns
+}
+
+// getAllLibraryPanels gets all library panels, or all library elements of the kind in the query. The models are
+// only included if the query asks for them.
+func (lps *LibraryPanelService) getAllLibraryPanels(c *models.ReqContext, query getAllLibraryPanelsQuery) ([]LibraryPanel, error) {
+	if query.Kind == 0 {
+		query.Kind = panelElement
+	}
+
 	orgID := c.SignedInUser.OrgId
 	libraryPanels := make([]LibraryPanel, 0)
-	err := lps.SQLStore.WithDbSession(context.Background(), func(session *sqlstore.DBSession) error {
-		err := session.SQL("SELECT * FROM library_panel WHERE org_id=?", orgID).Find(&libraryPanels)
-		if err != nil {
+	err := lps.SQLStore.WithReadReplicaDbSession(context.Background(), func(session *sqlstore.DBSession) error {
+		where := sqlstore.SQLBuilder{}
+		where.Write(" WHERE org_id=? AND kind=?", orgID, query.Kind)
+		writePermissionFilter(&where, lps.SQLStore.Dialect, c.SignedInUser, models.PERMISSION_VIEW)
+		writeStatusFilter(&where, lps.SQLStore.Dialect, c.SignedInUser, query.Status)
+		if query.Starred {
+			where.Write(" AND library_panel.id IN (SELECT librarypanel_id FROM library_panel_star WHERE user_id=?)", c.SignedInUser.UserId)
+		}
+		if query.OwnedBy != "" {
+			teamID, err := parseOwnedBy(query.OwnedBy)
+			if err != nil {
+				return err
+			}
+			where.Write(" AND library_panel.owner_team_id=?", teamID)
+		}
+		if query.FolderID != nil {
+			folderIDs := []int64{*query.FolderID}
+			if query.IncludeSubfolders {
+				var err error
+				if folderIDs, err = getFolderTreeIDs(session, orgID, *query.FolderID); err != nil {
+					return err
+				}
+			}
+			params := make([]interface{}, 0, len(folderIDs))
+			for _, id := range folderIDs {
+				params = append(params, id)
+			}
+			where.Write(" AND library_panel.folder_id IN (?"+strings.Repeat(",?", len(folderIDs)-1)+")", params...)
+		}
+
+		filterInGo := false
+		if query.Datasource != "" {
+			if expr, ok := lps.jsonTextSQL("model", "datasource"); ok {
+				where.Write(" AND "+expr+"=?", query.Datasource)
+			} else {
+				filterInGo = true
+			}
+		}
+
+		// the models are read to filter them when the database can't
+		builder := sqlstore.SQLBuilder{}
+		builder.Write("SELECT " + libraryPanelColumns(query.IncludeModel || filterInGo) + " FROM library_panel" + where.GetSQLString())
+		builder.AddParams(where.GetParams()...)
+		builder.Write(" ORDER BY library_panel.id ASC")
+
+		if err := session.SQL(builder.GetSQLString(), builder.GetParams()...).Find(&libraryPanels); err != nil {
 			return err
 		}
 
-		return nil
+		if filterInGo {
+			libraryPanels = filterLibraryPanelsByDatasource(libraryPanels, query.Datasource)
+		}
+
+		if query.IncludeModel {
+			upgradeLibraryPanelModels(libraryPanels)
+			normalizeLibraryPanelModels(libraryPanels)
+		} else {
+			for i := range libraryPanels {
+				libraryPanels[i].Model = nil
+			}
+		}
+		if err := loadConnectedDashboardCounts(session, libraryPanels); err != nil {
+			return err
+		}
+		return loadLibraryPanelTags(session, libraryPanels)
 	})
 
 	return libraryPanels, err
 }
 
-// getConnectedDashboards gets all dashboards connected to a Library Panel.
+// getFolderTreeIDs gets the ids of a folder and all of its descendant folders. The General folder, 0, is the
+// root of all folders. The tree is read one level at a time, so that databases without recursive queries work.
+func getFolderTreeIDs(session *sqlstore.DBSession, orgID int64, folderID int64) ([]int64, error) {
+	folderIDs := []int64{folderID}
+	seen := map[int64]bool{folderID: true}
+	for parents := folderIDs; len(parents) > 0; {
+		var children []int64
+		if err := session.Table("dashboard").Where("org_id=? AND is_folder=?", orgID, true).In("folder_id", parents).
+			Cols("id").Find(&children); err != nil {
+			return nil, err
+		}
+
+		parents = parents[:0:0]
+		for _, child := range children {
+			if !seen[child] {
+				seen[child] = true
+				folderIDs = append(folderIDs, child)
+				parents = append(parents, child)
+			}
+		}
+	}
+
+	return folderIDs, nil
+}
+
+// writePermissionFilter limits the query to Library Panels in folders where the user has at least the given permission.
+// Library Panels in the General folder follow the org role, like dashboards in the General folder do.
+func writePermissionFilter(builder *sqlstore.SQLBuilder, dialect migrator.Dialect, user *models.SignedInUser, permission models.PermissionType) {
+	if user.OrgRole == models.ROLE_ADMIN {
+		return
+	}
+
+	filterSQL, params := folderPermissionSQL(dialect, user, permission)
+	builder.Write(" AND "+filterSQL, params...)
+}
+
+// folderPermissionSQL returns the condition of writePermissionFilter.
+func folderPermissionSQL(dialect migrator.Dialect, user *models.SignedInUser, permission models.PermissionType) (string, []interface{}) {
+	if user.OrgRole == models.ROLE_ADMIN {
+		return "1=1", nil
+	}
+
+	filter := permissions.DashboardPermissionFilter{
+		OrgRole:         user.OrgRole,
+		Dialect:         dialect,
+		UserId:          user.UserId,
+		OrgId:           user.OrgId,
+		PermissionLevel: permission,
+	}
+	filterSQL, params := filter.Where()
+	sql := "(library_panel.folder_id IN (SELECT dashboard.id FROM dashboard WHERE " + filterSQL + ")"
+	if permission <= models.PERMISSION_VIEW || user.OrgRole == models.ROLE_EDITOR {
+		sql += " OR library_panel.folder_id = 0"
+	}
+
+	return sql + ")", params
+}
+
+// jsonTextSQL returns an SQL expression extracting the top level key from the stored models as text, and whether
+// the database can filter on it. Compressed models are opaque to the database, so it can't while models are
+// stored compressed, or models compressed before the compression was turned off aren't converted yet.
+func (lps *LibraryPanelService) jsonTextSQL(column string, key string) (string, bool) {
+	if !lps.modelsFilterable() {
+		return "", false
+	}
+
+	return jsonPathSQL(lps.SQLStore.Dialect, column, key)
+}
+
+// jsonPathSQL returns an SQL expression extracting the top level key from the JSON column expression as text, and
+// whether the dialect supports it. SQLite without the JSON1 extension does not.
+func jsonPathSQL(dialect migrator.Dialect, column string, key string) (string, bool) {
+	switch dialect.DriverName() {
+	case migrator.Postgres:
+		return fmt.Sprintf("%s->>'%s'", column, key), true
+	case migrator.MySQL:
+		return fmt.Sprintf("JSON_UNQUOTE(JSON_EXTRACT(%s, '$.%s'))", column, key), true
+	default:
+		return "", false
+	}
+}
+
+// filterLibraryPanelsByDatasource is the fallback for jsonTextSQL when the database can't filter on JSON paths.
+func filterLibraryPanelsByDatasource(libraryPanels []LibraryPanel, datasource string) []LibraryPanel {
+	filtered := make([]LibraryPanel, 0, len(libraryPanels))
+	for _, panel := range libraryPanels {
+		var model struct {
+			Datasource string `json:"datasource"`
+		}
+		if err := json.Unmarshal(panel.Model, &model); err != nil {
+			continue
+		}
+		if model.Datasource == datasource {
+			filtered = append(filtered, panel)
+		}
+	}
+
+	return filtered
+}
+
+// getConnectedDashboards gets all dashboards connected to a Library Panel, in a single query. The Library Panel
+// is left joined, so a Library Panel without connections has one row with a NULL dashboard_id.
 func (lps *LibraryPanelService) getConnectedDashboards(c *models.ReqContext, uid string) ([]int64, error) {
 	connectedDashboardIDs := make([]int64, 0)
-	err := lps.SQLStore.WithDbSession(context.Background(), func(session *sqlstore.DBSession) error {
-		panel, err := getLibraryPanel(session, uid, c.SignedInUser.OrgId)
+	err := lps.SQLStore.WithReadReplicaDbSession(context.Background(), func(session *sqlstore.DBSession) error {
+		var rows []struct {
+			DashboardID *int64 `xorm:"dashboard_id"`
+			ID          int64  `xorm:"id"`
+			FolderID    int64  `xorm:"folder_id"`
+			Status      string `xorm:"status"`
+			CreatedBy   int64  `xorm:"created_by"`
+		}
+		err := session.SQL(`SELECT DISTINCT library_panel_dashboard.dashboard_id, library_panel.id, library_panel.folder_id,
+			library_panel.status, library_panel.created_by FROM library_panel
+			LEFT JOIN library_panel_dashboard ON library_panel_dashboard.librarypanel_id = library_panel.id
+			WHERE library_panel.uid=? AND library_panel.org_id=?
+			ORDER BY library_panel_dashboard.dashboard_id ASC`, uid, c.SignedInUser.OrgId).Find(&rows)
 		if err != nil {
 			return err
 		}
-
-		var libraryPanelDashboards []libraryPanelDashboard
-		session.Table("library_panel_dashboard")
-		session.Where("librarypanel_id=?", panel.ID)
-		err = session.Find(&libraryPanelDashboards)
-		if err != nil {
+		if len(rows) == 0 {
+			return errLibraryPanelNotFound
+		}
+		libraryPanel := LibraryPanel{ID: rows[0].ID, OrgID: c.SignedInUser.OrgId, FolderID: rows[0].FolderID,
+			Status: rows[0].Status, CreatedBy: rows[0].CreatedBy}
+		if err := checkCanViewLibraryPanel(session, lps.SQLStore.Dialect, c.SignedInUser, libraryPanel); err != nil {
 			return err
 		}
 
-		for _, lpd := range libraryPanelDashboards {
-			connectedDashboardIDs = append(connectedDashboardIDs, lpd.DashboardID)
+		for _, row := range rows {
+			if row.DashboardID != nil {
+				connectedDashboardIDs = append(connectedDashboardIDs, *row.DashboardID)
+			}
 		}
 
 		return nil
@@ -185,12 +898,100 @@ func (lps *LibraryPanelService) getConnectedDashboards(c *models.ReqContext, uid
 
 // patchLibraryPanel updates a Library Panel.
 func (lps *LibraryPanelService) patchLibraryPanel(c *models.ReqContext, cmd patchLibraryPanelCommand, uid string) (LibraryPanel, error) {
+	panelInDB, libraryPanel, err := lps.applyLibraryPanelPatch(c, cmd, uid, false)
+	if err != nil {
+		return libraryPanel, err
+	}
+	changes := libraryPanelChanges(panelInDB, libraryPanel)
+	if len(changes) == 0 {
+		return libraryPanel, nil
+	}
+
+	for _, change := range changes {
+		if change == "model" || change == "name" {
+			lps.enqueuePropagation(libraryPanel)
+			break
+		}
+	}
+	lps.notifyLibraryPanelChanged(c, libraryPanel, changes)
+	lps.reconcileReplicasAfterChange(libraryPanel.ID)
+
+	return libraryPanel, nil
+}
+
+// isUnchangedByPatch returns true if the patch without a model sets nothing that differs from the Library Panel.
+func isUnchangedByPatch(panel LibraryPanel, cmd patchLibraryPanelCommand) bool {
+	if cmd.Model != nil || (cmd.FolderID != 0 && cmd.FolderID != panel.FolderID) || (cmd.Name != "" && cmd.Name != panel.Name) {
+		return false
+	}
+	if cmd.OwnerTeamID != nil && *cmd.OwnerTeamID != panel.OwnerTeamID {
+		return false
+	}
+	if cmd.Tags == nil {
+		return true
+	}
+
+	tags := normalizeTags(cmd.Tags)
+	current := append([]string{}, panel.Tags...)
+	sort.Strings(tags)
+	sort.Strings(current)
+	return strings.Join(tags, ",") == strings.Join(current, ",")
+}
+
+// applyLibraryPanelPatch validates and stores a patch, and returns the Library Panel before and after it. With
+// dryRun set the transaction is rolled back after the update, so nothing is stored but the patch still goes
+// through the checks of the database, like the unique names.
+func (lps *LibraryPanelService) applyLibraryPanelPatch(c *models.ReqContext, cmd patchLibraryPanelCommand, uid string, dryRun bool) (LibraryPanel, LibraryPanel, error) {
+	var panelInDB LibraryPanel
 	var libraryPanel LibraryPanel
 	err := lps.SQLStore.WithTransactionalDbSession(context.Background(), func(session *sqlstore.DBSession) error {
-		panelInDB, err := getLibraryPanel(session, uid, c.SignedInUser.OrgId)
+		var err error
+		panelInDB, err = getLibraryPanel(session, uid, c.SignedInUser.OrgId)
 		if err != nil {
 			return err
 		}
+		if err := checkCanEditLibraryPanel(session, lps.SQLStore.Dialect, c.SignedInUser, panelInDB); err != nil {
+			return err
+		}
+		if cmd.FolderID != 0 && cmd.FolderID != panelInDB.FolderID {
+			if err := checkCanEditFolder(session, lps.SQLStore.Dialect, c.SignedInUser, cmd.FolderID); err != nil {
+				return err
+			}
+		}
+		if cmd.OwnerTeamID != nil {
+			if err := checkOwnerTeam(session, panelInDB.OrgID, *cmd.OwnerTeamID); err != nil {
+				return err
+			}
+		}
+
+		if panelInDB.SyncPath != "" {
+			return errLibraryPanelProvisioned
+		}
+		if panelInDB.ReplicaOf != 0 {
+			return errLibraryPanelReplica
+		}
+		if err := checkIfMatch(c, panelInDB); err != nil {
+			return err
+		}
+		if cmd.Model != nil {
+			cmd.Model = normalizeModel(panelInDB.Kind, cmd.Model)
+		}
+		// re-applying the same model, like GitOps reconcilers do, doesn't change the Library Panel
+		if cmd.Model != nil && modelHash(cmd.Model) == panelInDB.ModelHash {
+			cmd.Model = nil
+			if isUnchangedByPatch(panelInDB, cmd) {
+				libraryPanel = panelInDB
+				return nil
+			}
+		}
+		if cmd.Model != nil {
+			if panelInDB.CatalogUID != "" {
+				return errLibraryPanelLinked
+			}
+			if err := validateElementModel(panelInDB.Kind, cmd.Model, lps.Cfg.LibraryPanels); err != nil {
+				return err
+			}
+		}
 
 		libraryPanel = LibraryPanel{
 			ID:        panelInDB.ID,
@@ -198,11 +999,18 @@ func (lps *LibraryPanelService) patchLibraryPanel(c *models.ReqContext, cmd patc
 			FolderID:  cmd.FolderID,
 			UID:       uid,
 			Name:      cmd.Name,
+			Kind:      panelInDB.Kind,
 			Model:     cmd.Model,
+			Tags:      normalizeTags(cmd.Tags),
 			Created:   panelInDB.Created,
 			CreatedBy: panelInDB.CreatedBy,
 			Updated:   time.Now(),
 			UpdatedBy: c.SignedInUser.UserId,
+
+			LastConnectedAt: panelInDB.LastConnectedAt,
+			LastViewedAt:    panelInDB.LastViewedAt,
+			SchemaVersion:   currentPanelSchemaVersion,
+			OwnerTeamID:     panelInDB.OwnerTeamID,
 		}
 
 		if cmd.FolderID == 0 {
@@ -213,9 +1021,20 @@ func (lps *LibraryPanelService) patchLibraryPanel(c *models.ReqContext, cmd patc
 		}
 		if cmd.Model == nil {
 			libraryPanel.Model = panelInDB.Model
+			libraryPanel.ModelHash = panelInDB.ModelHash
+			libraryPanel.SchemaVersion = panelInDB.SchemaVersion
+		} else {
+			libraryPanel.ModelHash = modelHash(cmd.Model)
 		}
-
-		if rowsAffected, err := session.ID(panelInDB.ID).Update(&libraryPanel); err != nil {
+		if cmd.Tags == nil {
+			libraryPanel.Tags = panelInDB.Tags
+		}
+		if cmd.OwnerTeamID != nil {
+			libraryPanel.OwnerTeamID = *cmd.OwnerTeamID
+		}
+		libraryPanel.modelCompression = lps.modelCompression
+		// the owning team is updated even when it's cleared to 0
+		if rowsAffected, err := session.ID(panelInDB.ID).MustCols("owner_team_id").Update(&libraryPanel); err != nil {
 			if lps.SQLStore.Dialect.IsUniqueConstraintViolation(err) {
 				return errLibraryPanelAlreadyExists
 			}
@@ -224,8 +1043,45 @@ func (lps *LibraryPanelService) patchLibraryPanel(c *models.ReqContext, cmd patc
 			return errLibraryPanelNotFound
 		}
 
+		if cmd.Tags != nil {
+			if err := setLibraryPanelTags(session, libraryPanel.ID, libraryPanel.Tags); err != nil {
+				return err
+			}
+		}
+		if cmd.Model != nil {
+			if err := setLibraryPanelDatasources(session, libraryPanel.ID, libraryPanel.Model); err != nil {
+				return err
+			}
+			if err := setLibraryPanelDependencies(session, libraryPanel); err != nil {
+				return err
+			}
+			if libraryPanel.Kind == queryElement {
+				if err := addLibraryQueryVersion(session, libraryPanel); err != nil {
+					return err
+				}
+			}
+		}
+		// the patched Library Panel is read back, so it has the columns the patch doesn't set and is what getting it
+		// returns, with the same fingerprint
+		patched, err := getLibraryPanel(session, uid, c.SignedInUser.OrgId)
+		if err != nil {
+			return err
+		}
+		libraryPanel = patched
+		if err := recordLibraryPanelChange(session, libraryPanel, changeActionUpdated, c.SignedInUser.UserId); err != nil {
+			return err
+		}
+		if dryRun {
+			return errDryRunRollback
+		}
+
 		return nil
 	})
+	if errors.Is(err, errDryRunRollback) {
+		err = nil
+	} else if err == nil {
+		lps.invalidateLibraryPanelCache()
+	}
 
-	return libraryPanel, err
+	return panelInDB, libraryPanel, err
 }
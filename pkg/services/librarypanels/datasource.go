@@ -0,0 +1,258 @@
+package librarypanels
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"time"
+
+	"xorm.io/xorm"
+
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/sqlstore"
+	"github.com/grafana/grafana/pkg/services/sqlstore/migrator"
+)
+
+// mixedDatasource is the datasource of panels whose queries each have their own datasource.
+const mixedDatasource = "-- Mixed --"
+
+// libraryPanelDatasource is the model for the datasources referenced by a library panel.
+type libraryPanelDatasource struct {
+	ID             int64  `xorm:"pk autoincr 'id'"`
+	LibraryPanelID int64  `xorm:"librarypanel_id"`
+	DatasourceUID  string `xorm:"datasource_uid"`
+}
+
+// rewriteDatasourceCommand is the command for rewriting the references to a datasource in Library Panels.
+type rewriteDatasourceCommand struct {
+	From   string `json:"from"`
+	To     string `json:"to"`
+	DryRun bool   `json:"dryRun"`
+}
+
+// rewriteDatasourceResult is the result of rewriting the references to a datasource in Library Panels.
+type rewriteDatasourceResult struct {
+	DryRun        bool           `json:"dryRun"`
+	LibraryPanels []LibraryPanel `json:"libraryPanels"`
+}
+
+// getDatasourceReferences returns the datasources referenced by the panel model and its queries, sorted and
+// without duplicates. A datasource is referenced either by name or by an object with an uid.
+func getDatasourceReferences(model json.RawMessage) []string {
+	type datasourceHolder struct {
+		Datasource json.RawMessage `json:"datasource"`
+	}
+	var panel struct {
+		datasourceHolder
+		Targets []datasourceHolder `json:"targets"`
+	}
+	if err := json.Unmarshal(model, &panel); err != nil {
+		return []string{}
+	}
+
+	seen := map[string]bool{}
+	for _, holder := range append(panel.Targets, panel.datasourceHolder) {
+		if uid := datasourceReferenceUID(holder.Datasource); uid != "" && uid != mixedDatasource {
+			seen[uid] = true
+		}
+	}
+
+	references := make([]string, 0, len(seen))
+	for uid := range seen {
+		references = append(references, uid)
+	}
+	sort.Strings(references)
+
+	return references
+}
+
+func datasourceReferenceUID(raw json.RawMessage) string {
+	if len(raw) == 0 {
+		return ""
+	}
+
+	var name string
+	if err := json.Unmarshal(raw, &name); err == nil {
+		return name
+	}
+
+	var ref struct {
+		UID string `json:"uid"`
+	}
+	if err := json.Unmarshal(raw, &ref); err == nil {
+		return ref.UID
+	}
+
+	return ""
+}
+
+// setLibraryPanelDatasources replaces the datasource references of a Library Panel with the ones in the model.
+func setLibraryPanelDatasources(session *sqlstore.DBSession, libraryPanelID int64, model json.RawMessage) error {
+	if _, err := session.Exec("DELETE FROM library_panel_datasource WHERE librarypanel_id=?", libraryPanelID); err != nil {
+		return err
+	}
+
+	for _, uid := range getDatasourceReferences(model) {
+		if _, err := session.Insert(&libraryPanelDatasource{LibraryPanelID: libraryPanelID, DatasourceUID: uid}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// getLibraryPanelsByDatasource gets the Library Panels the user can view that reference the given datasource.
+func (lps *LibraryPanelService) getLibraryPanelsByDatasource(c *models.ReqContext, datasourceUID string) ([]LibraryPanel, error) {
+	libraryPanels := make([]LibraryPanel, 0)
+	err := lps.SQLStore.WithReadReplicaDbSession(context.Background(), func(session *sqlstore.DBSession) error {
+		builder := sqlstore.SQLBuilder{}
+		builder.Write(`SELECT library_panel.* FROM library_panel
+			WHERE library_panel.org_id=?
+			AND EXISTS (SELECT 1 FROM library_panel_datasource
+				WHERE library_panel_datasource.librarypanel_id = library_panel.id AND library_panel_datasource.datasource_uid = ?)`,
+			c.SignedInUser.OrgId, datasourceUID)
+		writePermissionFilter(&builder, lps.SQLStore.Dialect, c.SignedInUser, models.PERMISSION_VIEW)
+		builder.Write(" ORDER BY library_panel.name ASC")
+
+		if err := session.SQL(builder.GetSQLString(), builder.GetParams()...).Find(&libraryPanels); err != nil {
+			return err
+		}
+
+		upgradeLibraryPanelModels(libraryPanels)
+		return loadLibraryPanelTags(session, libraryPanels)
+	})
+
+	return libraryPanels, err
+}
+
+// addLibraryPanelDatasourcesMigration fills library_panel_datasource for the Library Panels created before it existed.
+type addLibraryPanelDatasourcesMigration struct {
+	migrator.MigrationBase
+}
+
+func (m *addLibraryPanelDatasourcesMigration) SQL(dialect migrator.Dialect) string {
+	return "code migration"
+}
+
+func (m *addLibraryPanelDatasourcesMigration) Exec(sess *xorm.Session, mg *migrator.Migrator) error {
+	var panels []struct {
+		ID    int64 `xorm:"id"`
+		Model string
+	}
+	if err := sess.SQL("SELECT id, model FROM library_panel").Find(&panels); err != nil {
+		return err
+	}
+
+	for _, panel := range panels {
+		for _, uid := range getDatasourceReferences(json.RawMessage(panel.Model)) {
+			if _, err := sess.Exec("INSERT INTO library_panel_datasource (librarypanel_id, datasource_uid) VALUES (?, ?)", panel.ID, uid); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// rewriteDatasourceReferences replaces the references to the datasource from with to in the panel model and
+// its queries, and returns the rewritten model and whether anything changed.
+func rewriteDatasourceReferences(model json.RawMessage, from string, to string) (json.RawMessage, bool, error) {
+	var panel map[string]interface{}
+	if err := json.Unmarshal(model, &panel); err != nil {
+		return nil, false, err
+	}
+
+	changed := rewriteDatasourceReference(panel, from, to)
+	if targets, ok := panel["targets"].([]interface{}); ok {
+		for _, target := range targets {
+			if target, ok := target.(map[string]interface{}); ok {
+				changed = rewriteDatasourceReference(target, from, to) || changed
+			}
+		}
+	}
+	if !changed {
+		return model, false, nil
+	}
+
+	rewritten, err := json.Marshal(panel)
+	if err != nil {
+		return nil, false, err
+	}
+
+	return rewritten, true, nil
+}
+
+func rewriteDatasourceReference(holder map[string]interface{}, from string, to string) bool {
+	switch datasource := holder["datasource"].(type) {
+	case string:
+		if datasource == from {
+			holder["datasource"] = to
+			return true
+		}
+	case map[string]interface{}:
+		if uid, ok := datasource["uid"].(string); ok && uid == from {
+			datasource["uid"] = to
+			return true
+		}
+	}
+
+	return false
+}
+
+// rewriteLibraryPanelDatasources rewrites the references to a datasource in all Library Panels of the org in a
+// single transaction. With DryRun set, the affected Library Panels are returned but nothing is stored.
+func (lps *LibraryPanelService) rewriteLibraryPanelDatasources(c *models.ReqContext, cmd rewriteDatasourceCommand) (rewriteDatasourceResult, error) {
+	if cmd.From == "" || cmd.To == "" || cmd.From == cmd.To {
+		return rewriteDatasourceResult{}, errLibraryPanelInvalidDatasourceRewrite
+	}
+
+	result := rewriteDatasourceResult{
+		DryRun:        cmd.DryRun,
+		LibraryPanels: make([]LibraryPanel, 0),
+	}
+	err := lps.SQLStore.WithTransactionalDbSession(context.Background(), func(session *sqlstore.DBSession) error {
+		var libraryPanels []LibraryPanel
+		err := session.SQL(`SELECT library_panel.* FROM library_panel
+			WHERE library_panel.org_id=?
+			AND EXISTS (SELECT 1 FROM library_panel_datasource
+				WHERE library_panel_datasource.librarypanel_id = library_panel.id AND library_panel_datasource.datasource_uid = ?)
+			ORDER BY library_panel.name ASC`, c.SignedInUser.OrgId, cmd.From).Find(&libraryPanels)
+		if err != nil {
+			return err
+		}
+
+		for _, panel := range libraryPanels {
+			model, changed, err := rewriteDatasourceReferences(panel.Model, cmd.From, cmd.To)
+			if err != nil {
+				return err
+			}
+			if !changed {
+				continue
+			}
+
+			panel.Model = model
+			panel.ModelHash = modelHash(model)
+			panel.Updated = time.Now()
+			panel.UpdatedBy = c.SignedInUser.UserId
+			result.LibraryPanels = append(result.LibraryPanels, panel)
+			if cmd.DryRun {
+				continue
+			}
+
+			panel.modelCompression = lps.modelCompression
+			if _, err := session.ID(panel.ID).Cols("model", "model_hash", "updated", "updated_by").Update(&panel); err != nil {
+				return err
+			}
+			if err := setLibraryPanelDatasources(session, panel.ID, panel.Model); err != nil {
+				return err
+			}
+		}
+
+		return loadLibraryPanelTags(session, result.LibraryPanels)
+	})
+	if err == nil && !cmd.DryRun {
+		lps.invalidateLibraryPanelCache()
+	}
+
+	return result, err
+}
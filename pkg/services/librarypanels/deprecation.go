@@ -0,0 +1,101 @@
+package librarypanels
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/sqlstore"
+	"github.com/grafana/grafana/pkg/services/sqlstore/permissions"
+)
+
+// deprecateLibraryPanelCommand is the command for deprecating a Library Panel.
+type deprecateLibraryPanelCommand struct {
+	// ReplacedBy is the UID of the Library Panel that dashboards should use instead, optional.
+	ReplacedBy string `json:"replacedBy"`
+}
+
+// deprecatedLibraryPanelConnection is a dashboard that is still connected to a deprecated Library Panel.
+type deprecatedLibraryPanelConnection struct {
+	DashboardID      int64  `json:"dashboardId" xorm:"dashboard_id"`
+	DashboardUID     string `json:"dashboardUid" xorm:"dashboard_uid"`
+	DashboardTitle   string `json:"dashboardTitle" xorm:"dashboard_title"`
+	PanelID          int64  `json:"panelId" xorm:"panel_id"`
+	LibraryPanelUID  string `json:"libraryPanelUid" xorm:"librarypanel_uid"`
+	LibraryPanelName string `json:"libraryPanelName" xorm:"librarypanel_name"`
+	ReplacedBy       string `json:"replacedBy" xorm:"replaced_by"`
+}
+
+// setLibraryPanelDeprecation deprecates a Library Panel, or undeprecates it. Changing the deprecation
+// requires edit permission.
+func (lps *LibraryPanelService) setLibraryPanelDeprecation(c *models.ReqContext, uid string, deprecated bool, replacedBy string) (LibraryPanel, error) {
+	var libraryPanel LibraryPanel
+	err := lps.SQLStore.WithTransactionalDbSession(context.Background(), func(session *sqlstore.DBSession) error {
+		var err error
+		libraryPanel, err = getLibraryPanel(session, uid, c.SignedInUser.OrgId)
+		if err != nil {
+			return err
+		}
+
+		if err := checkCanEditLibraryPanel(session, lps.SQLStore.Dialect, c.SignedInUser, libraryPanel); err != nil {
+			return err
+		}
+
+		if replacedBy != "" {
+			if replacedBy == uid {
+				return errLibraryPanelInvalidReplacement
+			}
+			replacement, err := getLibraryPanel(session, replacedBy, c.SignedInUser.OrgId)
+			if err != nil {
+				if errors.Is(err, errLibraryPanelNotFound) {
+					return errLibraryPanelInvalidReplacement
+				}
+				return err
+			}
+			if replacement.Kind != libraryPanel.Kind {
+				return errLibraryPanelInvalidReplacement
+			}
+		}
+
+		libraryPanel.Deprecated = deprecated
+		libraryPanel.ReplacedBy = replacedBy
+		libraryPanel.Updated = time.Now()
+		libraryPanel.UpdatedBy = c.SignedInUser.UserId
+		_, err = session.ID(libraryPanel.ID).Cols("deprecated", "replaced_by", "updated", "updated_by").Update(&libraryPanel)
+		return err
+	})
+
+	return libraryPanel, err
+}
+
+// getDeprecatedLibraryPanelConnections gets the dashboards the user can view that are still connected to
+// deprecated Library Panels, so they can be migrated to the replacements.
+func (lps *LibraryPanelService) getDeprecatedLibraryPanelConnections(c *models.ReqContext) ([]deprecatedLibraryPanelConnection, error) {
+	connections := make([]deprecatedLibraryPanelConnection, 0)
+	err := lps.SQLStore.WithReadReplicaDbSession(context.Background(), func(session *sqlstore.DBSession) error {
+		builder := sqlstore.SQLBuilder{}
+		builder.Write(`SELECT dashboard.id AS dashboard_id, dashboard.uid AS dashboard_uid, dashboard.title AS dashboard_title, library_panel_dashboard.panel_id,
+			library_panel.uid AS librarypanel_uid, library_panel.name AS librarypanel_name, library_panel.replaced_by
+			FROM library_panel_dashboard
+			INNER JOIN library_panel ON library_panel.id = library_panel_dashboard.librarypanel_id
+			INNER JOIN dashboard ON dashboard.id = library_panel_dashboard.dashboard_id
+			WHERE library_panel.org_id=? AND library_panel.deprecated=`+lps.SQLStore.Dialect.BooleanStr(true), c.SignedInUser.OrgId)
+		if c.SignedInUser.OrgRole != models.ROLE_ADMIN {
+			filter := permissions.DashboardPermissionFilter{
+				OrgRole:         c.SignedInUser.OrgRole,
+				Dialect:         lps.SQLStore.Dialect,
+				UserId:          c.SignedInUser.UserId,
+				OrgId:           c.SignedInUser.OrgId,
+				PermissionLevel: models.PERMISSION_VIEW,
+			}
+			filterSQL, params := filter.Where()
+			builder.Write(" AND "+filterSQL, params...)
+		}
+		builder.Write(" ORDER BY dashboard.title ASC, library_panel.name ASC")
+
+		return session.SQL(builder.GetSQLString(), builder.GetParams()...).Find(&connections)
+	})
+
+	return connections, err
+}
@@ -0,0 +1,88 @@
+package librarypanels
+
+import (
+	"encoding/json"
+	"errors"
+
+	"github.com/grafana/grafana/pkg/models"
+	diff "github.com/yudai/gojsondiff"
+	deltaFormatter "github.com/yudai/gojsondiff/formatter"
+)
+
+// errDryRunRollback rolls back the transaction of a dry run patch. It is never returned to callers.
+var errDryRunRollback = errors.New("dry run")
+
+// patchPreview is the result of a dry run patch.
+type patchPreview struct {
+	DryRun       bool         `json:"dryRun"`
+	LibraryPanel LibraryPanel `json:"libraryPanel"`
+	// Changes are the names of the changed properties, like in the notifications of changes.
+	Changes []string `json:"changes"`
+	// Diff is the jsondiffpatch delta from the stored Library Panel to the patched one.
+	Diff json.RawMessage `json:"diff"`
+}
+
+// patchDiffTarget is the part of a Library Panel that a patch can change.
+type patchDiffTarget struct {
+	FolderID int64           `json:"folderId"`
+	Name     string          `json:"name"`
+	Model    json.RawMessage `json:"model"`
+	Tags     []string        `json:"tags"`
+}
+
+// previewLibraryPanelPatch validates a patch and returns the Library Panel it would store, without storing it.
+// Changes to widely used Library Panels are previewed as if they were approved.
+func (lps *LibraryPanelService) previewLibraryPanelPatch(c *models.ReqContext, cmd patchLibraryPanelCommand, uid string) (patchPreview, error) {
+	panelInDB, libraryPanel, err := lps.applyLibraryPanelPatch(c, cmd, uid, true)
+	if err != nil {
+		return patchPreview{}, err
+	}
+
+	delta, err := patchDiff(panelInDB, libraryPanel)
+	if err != nil {
+		return patchPreview{}, err
+	}
+	changes := libraryPanelChanges(panelInDB, libraryPanel)
+	if changes == nil {
+		changes = []string{}
+	}
+
+	return patchPreview{DryRun: true, LibraryPanel: libraryPanel, Changes: changes, Diff: delta}, nil
+}
+
+// patchDiff returns the jsondiffpatch delta between two versions of a Library Panel, or an empty object if they
+// are the same.
+func patchDiff(before LibraryPanel, after LibraryPanel) (json.RawMessage, error) {
+	left, err := json.Marshal(newPatchDiffTarget(before))
+	if err != nil {
+		return nil, err
+	}
+	right, err := json.Marshal(newPatchDiffTarget(after))
+	if err != nil {
+		return nil, err
+	}
+
+	jsonDiff, err := diff.New().Compare(left, right)
+	if err != nil {
+		return nil, err
+	}
+	if !jsonDiff.Modified() {
+		return json.RawMessage("{}"), nil
+	}
+
+	delta, err := deltaFormatter.NewDeltaFormatter().Format(jsonDiff)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.RawMessage(delta), nil
+}
+
+func newPatchDiffTarget(panel LibraryPanel) patchDiffTarget {
+	tags := panel.Tags
+	if tags == nil {
+		tags = []string{}
+	}
+
+	return patchDiffTarget{FolderID: panel.FolderID, Name: panel.Name, Model: panel.Model, Tags: tags}
+}
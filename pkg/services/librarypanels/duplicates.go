@@ -0,0 +1,347 @@
+package librarypanels
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/sqlstore"
+)
+
+const (
+	// duplicateCheckInterval is how often the Library Panels of all orgs are checked for duplicates.
+	duplicateCheckInterval = time.Hour
+	// duplicateCheckBatchSize is the number of Library Panels that are hashed at a time.
+	duplicateCheckBatchSize = 100
+)
+
+// libraryPanelDuplicate is a Library Panel with the similarity hash it shares with other Library Panels of the
+// org, as of the last duplicate check.
+type libraryPanelDuplicate struct {
+	ID             int64     `xorm:"pk autoincr 'id'"`
+	OrgID          int64     `xorm:"org_id"`
+	LibraryPanelID int64     `xorm:"librarypanel_id"`
+	SimilarityHash string    `xorm:"similarity_hash"`
+	Checked        time.Time `xorm:"checked"`
+}
+
+// duplicateCluster is a group of near-identical Library Panels, oldest first.
+type duplicateCluster struct {
+	SimilarityHash string         `json:"similarityHash"`
+	Checked        time.Time      `json:"checked"`
+	LibraryPanels  []LibraryPanel `json:"libraryPanels"`
+}
+
+// mergeLibraryPanelsCommand is the command for merging the Library Panel From into the Library Panel Into.
+type mergeLibraryPanelsCommand struct {
+	From string `json:"from"`
+	Into string `json:"into"`
+}
+
+// mergeLibraryPanelsResult is the result of merging two Library Panels.
+type mergeLibraryPanelsResult struct {
+	// Dashboards is the number of dashboards that were rewired.
+	Dashboards   int64        `json:"dashboards"`
+	LibraryPanel LibraryPanel `json:"libraryPanel"`
+}
+
+// similarityHash returns the SHA-256 of the properties that make Library Panels near-identical: the panel type,
+// the data source and the targets without their refIds, which only name them. Panels without targets, like text
+// panels, are compared on their options instead. Titles, descriptions and the rest of the display settings are
+// ignored, so copies that were renamed or restyled are still found. It returns an empty hash for models that
+// aren't JSON objects.
+func similarityHash(model json.RawMessage) string {
+	var object map[string]interface{}
+	decoder := json.NewDecoder(bytes.NewReader(model))
+	decoder.UseNumber()
+	if err := decoder.Decode(&object); err != nil || object == nil {
+		return ""
+	}
+
+	similar := map[string]interface{}{
+		"type":       object["type"],
+		"datasource": object["datasource"],
+	}
+	if targets, ok := object["targets"].([]interface{}); ok && len(targets) > 0 {
+		for _, target := range targets {
+			if target, ok := target.(map[string]interface{}); ok {
+				delete(target, "refId")
+			}
+		}
+		similar["targets"] = targets
+	} else {
+		similar["options"] = object["options"]
+	}
+
+	hashed, err := canonicalJSON(similar)
+	if err != nil {
+		return ""
+	}
+
+	hash := sha256.Sum256(hashed)
+	return hex.EncodeToString(hash[:])
+}
+
+// checkDuplicateLibraryPanels checks the Library Panels of all orgs for duplicates, and returns the number of
+// clusters of duplicates found.
+func (lps *LibraryPanelService) checkDuplicateLibraryPanels() (int, error) {
+	var orgIDs []int64
+	err := lps.SQLStore.WithReadReplicaDbSession(context.Background(), func(session *sqlstore.DBSession) error {
+		return session.SQL("SELECT DISTINCT org_id FROM library_panel WHERE kind=? ORDER BY org_id ASC", panelElement).Find(&orgIDs)
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	total := 0
+	for _, orgID := range orgIDs {
+		clusters, err := lps.checkDuplicateLibraryPanelsOfOrg(orgID)
+		if err != nil {
+			return total, err
+		}
+		total += clusters
+	}
+
+	return total, nil
+}
+
+// checkDuplicateLibraryPanelsOfOrg hashes the models of the Library Panels of the org and replaces the stored
+// duplicates of the org with the Library Panels that share their hash with others. It returns the number of
+// clusters of duplicates.
+func (lps *LibraryPanelService) checkDuplicateLibraryPanelsOfOrg(orgID int64) (int, error) {
+	byHash := make(map[string][]int64)
+	err := lps.SQLStore.WithReadReplicaDbSession(context.Background(), func(session *sqlstore.DBSession) error {
+		var lastID int64
+		for {
+			var libraryPanels []LibraryPanel
+			if err := session.SQL("SELECT * FROM library_panel WHERE org_id=? AND kind=? AND id>? ORDER BY id ASC"+
+				lps.SQLStore.Dialect.Limit(duplicateCheckBatchSize), orgID, panelElement, lastID).Find(&libraryPanels); err != nil {
+				return err
+			}
+			if len(libraryPanels) == 0 {
+				return nil
+			}
+			lastID = libraryPanels[len(libraryPanels)-1].ID
+
+			upgradeLibraryPanelModels(libraryPanels)
+			normalizeLibraryPanelModels(libraryPanels)
+			for _, panel := range libraryPanels {
+				if hash := similarityHash(panel.Model); hash != "" {
+					byHash[hash] = append(byHash[hash], panel.ID)
+				}
+			}
+			if len(libraryPanels) < duplicateCheckBatchSize {
+				return nil
+			}
+		}
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	clusters := 0
+	now := time.Now()
+	err = lps.SQLStore.WithTransactionalDbSession(context.Background(), func(session *sqlstore.DBSession) error {
+		if _, err := session.Exec("DELETE FROM library_panel_duplicate WHERE org_id=?", orgID); err != nil {
+			return err
+		}
+		for hash, ids := range byHash {
+			if len(ids) < 2 {
+				continue
+			}
+			clusters++
+			for _, id := range ids {
+				duplicate := libraryPanelDuplicate{OrgID: orgID, LibraryPanelID: id, SimilarityHash: hash, Checked: now}
+				if _, err := session.Insert(&duplicate); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	if err == nil && clusters > 0 {
+		lps.log.Info("Found duplicate library panels", "orgId", orgID, "clusters", clusters)
+	}
+
+	return clusters, err
+}
+
+// getDuplicateLibraryPanels gets the clusters of duplicate Library Panels in the org as of the last check, with
+// the clusters of the most Library Panels first. Library Panels deleted since the check are left out, and so are
+// the clusters they leave with a single Library Panel.
+func (lps *LibraryPanelService) getDuplicateLibraryPanels(c *models.ReqContext) ([]duplicateCluster, error) {
+	clusters := make([]duplicateCluster, 0)
+	err := lps.SQLStore.WithReadReplicaDbSession(context.Background(), func(session *sqlstore.DBSession) error {
+		var rows []struct {
+			LibraryPanel   `xorm:"extends"`
+			SimilarityHash string    `xorm:"similarity_hash"`
+			Checked        time.Time `xorm:"checked"`
+		}
+		if err := session.SQL(`SELECT `+libraryPanelListColumns+`, library_panel_duplicate.similarity_hash, library_panel_duplicate.checked
+			FROM library_panel_duplicate
+			INNER JOIN library_panel ON library_panel.id = library_panel_duplicate.librarypanel_id
+			WHERE library_panel_duplicate.org_id=?
+			ORDER BY library_panel.created ASC, library_panel.id ASC`, c.SignedInUser.OrgId).Find(&rows); err != nil {
+			return err
+		}
+
+		byHash := make(map[string]*duplicateCluster)
+		var hashes []string
+		for _, row := range rows {
+			cluster, ok := byHash[row.SimilarityHash]
+			if !ok {
+				cluster = &duplicateCluster{SimilarityHash: row.SimilarityHash, Checked: row.Checked}
+				byHash[row.SimilarityHash] = cluster
+				hashes = append(hashes, row.SimilarityHash)
+			}
+			cluster.LibraryPanels = append(cluster.LibraryPanels, row.LibraryPanel)
+		}
+		for _, hash := range hashes {
+			if len(byHash[hash].LibraryPanels) < 2 {
+				continue
+			}
+			if err := loadLibraryPanelTags(session, byHash[hash].LibraryPanels); err != nil {
+				return err
+			}
+			clusters = append(clusters, *byHash[hash])
+		}
+		sort.SliceStable(clusters, func(i, j int) bool {
+			return len(clusters[i].LibraryPanels) > len(clusters[j].LibraryPanels)
+		})
+
+		return nil
+	})
+
+	return clusters, err
+}
+
+// mergeLibraryPanels merges the Library Panel From into the Library Panel Into in one transaction: the references
+// to From in the stored dashboards are rebound to Into, each rewired dashboard is saved as a new version, the
+// connections of From are moved to Into, and From is archived, deleted and recorded as merged in the change feed.
+func (lps *LibraryPanelService) mergeLibraryPanels(c *models.ReqContext, cmd mergeLibraryPanelsCommand) (mergeLibraryPanelsResult, error) {
+	if cmd.From == "" || cmd.Into == "" || cmd.From == cmd.Into {
+		return mergeLibraryPanelsResult{}, errLibraryPanelInvalidMerge
+	}
+
+	result := mergeLibraryPanelsResult{}
+	var mergedID int64
+	err := lps.SQLStore.WithTransactionalDbSession(context.Background(), func(session *sqlstore.DBSession) error {
+		from, err := getLibraryPanel(session, cmd.From, c.SignedInUser.OrgId)
+		if err != nil {
+			return err
+		}
+		into, err := getLibraryPanel(session, cmd.Into, c.SignedInUser.OrgId)
+		if err != nil {
+			return err
+		}
+		if from.Kind != panelElement || into.Kind != panelElement {
+			return errLibraryPanelInvalidMerge
+		}
+		// Library Panels synced from Git or replicated from another org would come back
+		if from.SyncPath != "" {
+			return errLibraryPanelProvisioned
+		}
+		if from.ReplicaOf != 0 {
+			return errLibraryPanelReplica
+		}
+		if err := checkNoDerivedAlertRules(session, from.ID); err != nil {
+			return err
+		}
+
+		var connections []libraryPanelDashboard
+		if err := session.Where("librarypanel_id=?", from.ID).OrderBy("dashboard_id ASC, panel_id ASC").Find(&connections); err != nil {
+			return err
+		}
+		var dashboardIDs []int64
+		for i, connection := range connections {
+			if i == 0 || connection.DashboardID != connections[i-1].DashboardID {
+				dashboardIDs = append(dashboardIDs, connection.DashboardID)
+			}
+		}
+		for _, dashboardID := range dashboardIDs {
+			if err := rebindDashboardReferences(session, c.SignedInUser, dashboardID, from.UID, into,
+				fmt.Sprintf("Merged library panel %s into %s", from.Name, into.Name)); err != nil {
+				return err
+			}
+		}
+
+		now := time.Now()
+		for _, connection := range connections {
+			exists, err := session.Table("library_panel_dashboard").
+				Where("librarypanel_id=? AND dashboard_id=? AND panel_id=?", into.ID, connection.DashboardID, connection.PanelID).Exist()
+			if err != nil {
+				return err
+			}
+			if !exists {
+				if _, err := session.Insert(&libraryPanelDashboard{
+					LibraryPanelID: into.ID,
+					DashboardID:    connection.DashboardID,
+					PanelID:        connection.PanelID,
+					Created:        now,
+					CreatedBy:      c.SignedInUser.UserId,
+				}); err != nil {
+					return err
+				}
+			}
+		}
+		if _, err := session.Exec("DELETE FROM library_panel_dashboard WHERE librarypanel_id=?", from.ID); err != nil {
+			return err
+		}
+		if len(connections) > 0 {
+			if _, err := session.Exec("UPDATE library_panel SET last_connected_at=? WHERE id=?", now, into.ID); err != nil {
+				return err
+			}
+		}
+
+		if err := archiveLibraryPanel(session, from); err != nil {
+			return err
+		}
+		if err := recordLibraryPanelMerge(session, from, into, c.SignedInUser.UserId); err != nil {
+			return err
+		}
+		if err := deleteLibraryPanelByID(session, from.ID); err != nil {
+			return err
+		}
+
+		mergedID = from.ID
+		result.Dashboards = int64(len(dashboardIDs))
+		result.LibraryPanel = into
+		return nil
+	})
+	if err != nil {
+		return mergeLibraryPanelsResult{}, err
+	}
+	lps.invalidateLibraryPanelCache()
+	lps.reconcileReplicasAfterChange(mergedID)
+
+	return result, nil
+}
+
+// rebindDashboardReferences rebinds the references to the Library Panel fromUID in the stored dashboard to the
+// Library Panel into, and saves the dashboard as a new version. Dashboards that don't exist anymore or don't
+// reference the Library Panel are left as they are.
+func rebindDashboardReferences(session *sqlstore.DBSession, user *models.SignedInUser, dashboardID int64, fromUID string,
+	into LibraryPanel, message string) error {
+	dash := models.Dashboard{}
+	has, err := session.Where("id=? AND org_id=?", dashboardID, user.OrgId).Get(&dash)
+	if err != nil || !has {
+		return err
+	}
+
+	panels := getLibraryPanelReferences(dash.Data)[fromUID]
+	if len(panels) == 0 {
+		return nil
+	}
+	for _, panel := range panels {
+		panel.Get("libraryPanel").Set("uid", into.UID)
+		panel.Get("libraryPanel").Set("name", into.Name)
+	}
+
+	return saveDashboardVersion(session, user, &dash, message)
+}
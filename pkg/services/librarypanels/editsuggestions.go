@@ -0,0 +1,233 @@
+package librarypanels
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/sqlstore"
+	"github.com/grafana/grafana/pkg/util"
+)
+
+const (
+	editSuggestionStatusPending  = "pending"
+	editSuggestionStatusApplied  = "applied"
+	editSuggestionStatusRejected = "rejected"
+)
+
+// libraryPanelEditSuggestion is a model change suggested by a user who can view a Library Panel, for the users who
+// can edit it to apply or reject.
+type libraryPanelEditSuggestion struct {
+	ID             int64           `json:"id" xorm:"pk autoincr 'id'"`
+	OrgID          int64           `json:"-" xorm:"org_id"`
+	LibraryPanelID int64           `json:"-" xorm:"librarypanel_id"`
+	Model          json.RawMessage `json:"model"`
+	Comment        string          `json:"comment"`
+	Status         string          `json:"status"`
+
+	Created    time.Time  `json:"created"`
+	CreatedBy  int64      `json:"createdBy"`
+	Reviewed   *time.Time `json:"reviewed"`
+	ReviewedBy *int64     `json:"reviewedBy"`
+}
+
+// suggestEditCommand is the command for suggesting a model change to a Library Panel.
+type suggestEditCommand struct {
+	Model   json.RawMessage `json:"model"`
+	Comment string          `json:"comment"`
+}
+
+// editSuggestionReview is the result of applying or rejecting an edit suggestion. An applied suggestion has the
+// updated LibraryPanel, or the PendingChange if the change waits for approval.
+type editSuggestionReview struct {
+	Suggestion    libraryPanelEditSuggestion `json:"suggestion"`
+	LibraryPanel  *LibraryPanel              `json:"libraryPanel,omitempty"`
+	PendingChange *libraryPanelPendingChange `json:"pendingChange,omitempty"`
+}
+
+// suggestEdit stores a model change to a Library Panel the user can view but doesn't have to be able to edit, and
+// notifies the owners of the Library Panel. The model is validated now rather than when it is applied.
+func (lps *LibraryPanelService) suggestEdit(c *models.ReqContext, uid string, cmd suggestEditCommand) (libraryPanelEditSuggestion, error) {
+	if err := checkSignedInUser(c.SignedInUser); err != nil {
+		return libraryPanelEditSuggestion{}, err
+	}
+	comment := strings.TrimSpace(cmd.Comment)
+	if len(cmd.Model) == 0 || utf8.RuneCountInString(comment) > maxCommentLength {
+		return libraryPanelEditSuggestion{}, errLibraryPanelInvalidEditSuggestion
+	}
+
+	libraryPanel, err := lps.getLibraryPanel(c, uid)
+	if err != nil {
+		return libraryPanelEditSuggestion{}, err
+	}
+	// suggestions that can't be applied are rejected right away
+	switch {
+	case libraryPanel.SyncPath != "":
+		return libraryPanelEditSuggestion{}, errLibraryPanelProvisioned
+	case libraryPanel.CatalogUID != "":
+		return libraryPanelEditSuggestion{}, errLibraryPanelLinked
+	case libraryPanel.ReplicaOf != 0:
+		return libraryPanelEditSuggestion{}, errLibraryPanelReplica
+	}
+	model := normalizeModel(libraryPanel.Kind, cmd.Model)
+	if err := validateElementModel(libraryPanel.Kind, model, lps.Cfg.LibraryPanels); err != nil {
+		return libraryPanelEditSuggestion{}, err
+	}
+
+	suggestion := libraryPanelEditSuggestion{
+		OrgID:          c.SignedInUser.OrgId,
+		LibraryPanelID: libraryPanel.ID,
+		Model:          model,
+		Comment:        comment,
+		Status:         editSuggestionStatusPending,
+		Created:        time.Now(),
+		CreatedBy:      c.SignedInUser.UserId,
+	}
+	err = lps.SQLStore.WithDbSession(context.Background(), func(session *sqlstore.DBSession) error {
+		_, err := session.Table("library_panel_edit_suggestion").Insert(&suggestion)
+		return err
+	})
+	if err != nil {
+		return libraryPanelEditSuggestion{}, err
+	}
+
+	suggestedBy := util.StringsFallback3(c.SignedInUser.Name, c.SignedInUser.Login, c.SignedInUser.Email)
+	lps.notifyLibraryPanelOwners(c.SignedInUser, libraryPanel, fmt.Sprintf("%s suggested an edit to library panel %s", suggestedBy, libraryPanel.Name))
+
+	return suggestion, nil
+}
+
+// getEditSuggestions gets the pending edit suggestions of a Library Panel the user can view, oldest first.
+func (lps *LibraryPanelService) getEditSuggestions(c *models.ReqContext, uid string) ([]libraryPanelEditSuggestion, error) {
+	libraryPanel, err := lps.getLibraryPanel(c, uid)
+	if err != nil {
+		return nil, err
+	}
+
+	suggestions := make([]libraryPanelEditSuggestion, 0)
+	err = lps.SQLStore.WithReadReplicaDbSession(context.Background(), func(session *sqlstore.DBSession) error {
+		return session.Table("library_panel_edit_suggestion").Where("librarypanel_id=? AND status=?", libraryPanel.ID, editSuggestionStatusPending).
+			OrderBy("created ASC, id ASC").Find(&suggestions)
+	})
+
+	return suggestions, err
+}
+
+// reviewEditSuggestion applies or rejects a pending edit suggestion, which requires edit permission on the Library
+// Panel. An applied suggestion updates the model like a patch by the reviewer, so changes to widely used Library
+// Panels wait for approval. The suggestion keeps who suggested and who applied the change,
+// and its author is notified either way.
+func (lps *LibraryPanelService) reviewEditSuggestion(c *models.ReqContext, uid string, id int64, apply bool) (editSuggestionReview, error) {
+	var review editSuggestionReview
+	var libraryPanel LibraryPanel
+	err := lps.SQLStore.WithReadReplicaDbSession(context.Background(), func(session *sqlstore.DBSession) error {
+		var err error
+		libraryPanel, err = getLibraryPanel(session, uid, c.SignedInUser.OrgId)
+		if err != nil {
+			return err
+		}
+		if err := checkCanEditLibraryPanel(session, lps.SQLStore.Dialect, c.SignedInUser, libraryPanel); err != nil {
+			return err
+		}
+
+		has, err := session.Table("library_panel_edit_suggestion").Where("id=? AND librarypanel_id=? AND status=?", id, libraryPanel.ID, editSuggestionStatusPending).
+			Get(&review.Suggestion)
+		if err != nil {
+			return err
+		}
+		if !has {
+			return errLibraryPanelEditSuggestionNotFound
+		}
+
+		return nil
+	})
+	if err != nil {
+		return editSuggestionReview{}, err
+	}
+
+	review.Suggestion.Status = editSuggestionStatusRejected
+	if apply {
+		cmd := patchLibraryPanelCommand{Model: review.Suggestion.Model}
+		change, pending, err := lps.requestApproval(c, cmd, uid)
+		if err != nil {
+			return editSuggestionReview{}, err
+		}
+		if pending {
+			review.PendingChange = &change
+		} else {
+			updated, err := lps.patchLibraryPanel(c, cmd, uid)
+			if err != nil {
+				return editSuggestionReview{}, err
+			}
+			review.LibraryPanel = &updated
+		}
+		review.Suggestion.Status = editSuggestionStatusApplied
+	}
+
+	now := time.Now()
+	review.Suggestion.Reviewed = &now
+	review.Suggestion.ReviewedBy = &c.SignedInUser.UserId
+	err = lps.SQLStore.WithDbSession(context.Background(), func(session *sqlstore.DBSession) error {
+		_, err := session.Table("library_panel_edit_suggestion").ID(review.Suggestion.ID).Cols("status", "reviewed", "reviewed_by").Update(&review.Suggestion)
+		return err
+	})
+	if err != nil {
+		return editSuggestionReview{}, err
+	}
+
+	reviewedBy := util.StringsFallback3(c.SignedInUser.Name, c.SignedInUser.Login, c.SignedInUser.Email)
+	lps.addNotifications(libraryPanel, []int64{review.Suggestion.CreatedBy}, fmt.Sprintf("%s %s your suggested edit to library panel %s",
+		reviewedBy, review.Suggestion.Status, libraryPanel.Name))
+
+	return review, nil
+}
+
+// notifyLibraryPanelOwners notifies the creator and the last editor of a Library Panel, and the members of its
+// owning team, except the user and users who muted the notifications of the Library Panel. Notifications are
+// best effort, failures are logged.
+func (lps *LibraryPanelService) notifyLibraryPanelOwners(user *models.SignedInUser, panel LibraryPanel, summary string) {
+	var userIDs []int64
+	err := lps.SQLStore.WithReadReplicaDbSession(context.Background(), func(session *sqlstore.DBSession) error {
+		u := lps.SQLStore.Dialect.Quote("user")
+		return session.SQL(`SELECT `+u+`.id FROM `+u+`
+			WHERE (`+u+`.id IN (?, ?) OR `+u+`.id IN (SELECT user_id FROM team_member WHERE team_id=?)) AND `+u+`.id<>?
+			ORDER BY `+u+`.id ASC`, panel.CreatedBy, panel.UpdatedBy, panel.OwnerTeamID, user.UserId).Find(&userIDs)
+	})
+	if err != nil {
+		lps.log.Warn("Failed to get the owners of library panel", "uid", panel.UID, "error", err)
+		return
+	}
+
+	lps.addNotifications(panel, userIDs, summary)
+}
+
+// addNotifications adds a notification about a Library Panel to the users that didn't mute its notifications.
+func (lps *LibraryPanelService) addNotifications(panel LibraryPanel, userIDs []int64, summary string) {
+	now := time.Now()
+	for _, userID := range userIDs {
+		err := lps.SQLStore.WithDbSession(context.Background(), func(session *sqlstore.DBSession) error {
+			muted, err := session.Where("org_id=? AND user_id=? AND librarypanel_id IN (0, ?)", panel.OrgID, userID, panel.ID).
+				Count(&libraryPanelNotificationMute{})
+			if err != nil || muted > 0 {
+				return err
+			}
+
+			notification := libraryPanelNotification{
+				OrgID:          panel.OrgID,
+				UserID:         userID,
+				LibraryPanelID: panel.ID,
+				Summary:        summary,
+				Created:        now,
+			}
+			_, err = session.Table("library_panel_notification").Insert(&notification)
+			return err
+		})
+		if err != nil {
+			lps.log.Warn("Failed to add library panel notification", "uid", panel.UID, "userId", userID, "error", err)
+		}
+	}
+}
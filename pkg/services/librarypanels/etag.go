@@ -0,0 +1,60 @@
+package librarypanels
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/grafana/grafana/pkg/models"
+)
+
+// libraryPanelETag returns a strong ETag for the Library Panel. It changes with every update, and with the
+// content of the Library Panel, so updates within the same second get different ETags too.
+func libraryPanelETag(panel LibraryPanel) string {
+	tags := append([]string{}, panel.Tags...)
+	sort.Strings(tags)
+
+	hash := sha256.New()
+	fmt.Fprintf(hash, "%d\n%d\n%d\n%d\n%s\n%s\n", panel.ID, panel.Updated.Unix(), panel.UpdatedBy, panel.FolderID, panel.Name, strings.Join(tags, ","))
+	hash.Write(panel.Model)
+
+	return `"` + hex.EncodeToString(hash.Sum(nil)[:16]) + `"`
+}
+
+// modelHash returns the SHA-256 of the canonical JSON of the model, without whitespace and with sorted keys, so
+// models that only differ in formatting have the same hash.
+func modelHash(model json.RawMessage) string {
+	var value interface{}
+	decoder := json.NewDecoder(bytes.NewReader(model))
+	decoder.UseNumber()
+	if err := decoder.Decode(&value); err == nil {
+		if canonical, err := canonicalJSON(value); err == nil {
+			model = canonical
+		}
+	}
+
+	hash := sha256.Sum256(model)
+	return hex.EncodeToString(hash[:])
+}
+
+// checkIfMatch returns errLibraryPanelPreconditionFailed if the request has an If-Match header that doesn't
+// match the current ETag of the Library Panel. Weak ETags never match, as If-Match uses strong comparison.
+func checkIfMatch(c *models.ReqContext, panel LibraryPanel) error {
+	ifMatch := strings.TrimSpace(c.Req.Header.Get("If-Match"))
+	if ifMatch == "" || ifMatch == "*" {
+		return nil
+	}
+
+	etag := libraryPanelETag(panel)
+	for _, candidate := range strings.Split(ifMatch, ",") {
+		if strings.TrimSpace(candidate) == etag {
+			return nil
+		}
+	}
+
+	return errLibraryPanelPreconditionFailed
+}
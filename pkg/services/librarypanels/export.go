@@ -0,0 +1,195 @@
+package librarypanels
+
+import (
+	"compress/gzip"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+
+	"github.com/grafana/grafana/pkg/components/simplejson"
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/sqlstore"
+)
+
+// exportBatchSize is the number of library elements an export loads the tags of at once, and keeps in memory.
+const exportBatchSize = 100
+
+// exportResponse streams all library elements of the org that the user can view as {"result": [...]}, in the
+// order they were created. The rows are read from a database cursor and written in batches, so large orgs
+// aren't read into memory. The JSON is gzipped if the client accepts it and the server doesn't gzip it already.
+type exportResponse struct {
+	lps *LibraryPanelService
+}
+
+// Status gets the status of the response, it is 200 unless the export fails before anything is written.
+func (r exportResponse) Status() int {
+	return 200
+}
+
+// Body gets the body of the response, which is streamed and never in memory.
+func (r exportResponse) Body() []byte {
+	return nil
+}
+
+// WriteTo streams the export to the client. Errors after the response was started can't be returned anymore,
+// they are logged and the JSON is left incomplete so that clients can't mistake it for a complete export.
+func (r exportResponse) WriteTo(c *models.ReqContext) {
+	header := c.Resp.Header()
+	header.Set("Content-Type", "application/json")
+	header.Set("Content-Disposition", `attachment; filename="library-panels.json"`)
+
+	var w io.Writer = c.Resp
+	if strings.Contains(c.Req.Header.Get("Accept-Encoding"), "gzip") && header.Get("Content-Encoding") == "" {
+		header.Set("Content-Encoding", "gzip")
+		header.Add("Vary", "Accept-Encoding")
+		gz := gzip.NewWriter(c.Resp)
+		defer func() {
+			if err := gz.Close(); err != nil {
+				c.Logger.Error("Failed to write library panel export", "error", err)
+			}
+		}()
+		w = gz
+	}
+
+	if err := r.lps.exportLibraryPanels(c.SignedInUser, w); err != nil {
+		c.Logger.Error("Failed to export library panels", "error", err)
+	}
+}
+
+// exportLibraryPanels writes the library elements of the org that the user can view to w.
+func (lps *LibraryPanelService) exportLibraryPanels(user *models.SignedInUser, w io.Writer) error {
+	return lps.SQLStore.WithReadReplicaDbSession(context.Background(), func(session *sqlstore.DBSession) error {
+		builder := sqlstore.SQLBuilder{}
+		builder.Write("SELECT library_panel.* FROM library_panel WHERE org_id=?", user.OrgId)
+		writePermissionFilter(&builder, lps.SQLStore.Dialect, user, models.PERMISSION_VIEW)
+		writeStatusFilter(&builder, lps.SQLStore.Dialect, user, "")
+		builder.Write(" ORDER BY library_panel.id ASC")
+
+		if _, err := io.WriteString(w, `{"result":`); err != nil {
+			return err
+		}
+		if err := lps.writeLibraryPanelsJSON(session, builder, w); err != nil {
+			return err
+		}
+
+		_, err := io.WriteString(w, "}")
+		return err
+	})
+}
+
+// writeLibraryPanelsJSON writes the Library Panels selected by the query to w as a JSON array, with their tags
+// and upgraded models. The rows are read from a database cursor in batches of exportBatchSize.
+func (lps *LibraryPanelService) writeLibraryPanelsJSON(session *sqlstore.DBSession, builder sqlstore.SQLBuilder, w io.Writer) error {
+	rows, err := session.SQL(builder.GetSQLString(), builder.GetParams()...).Rows(&LibraryPanel{})
+	if err != nil {
+		return err
+	}
+	defer func() { _ = rows.Close() }()
+
+	if _, err := io.WriteString(w, "["); err != nil {
+		return err
+	}
+	written := 0
+	batch := make([]LibraryPanel, 0, exportBatchSize)
+	writeBatch := func() error {
+		upgradeLibraryPanelModels(batch)
+		// the cursor keeps its connection busy, the tags are read with another one
+		err := lps.SQLStore.WithReadReplicaDbSession(context.Background(), func(tagSession *sqlstore.DBSession) error {
+			return loadLibraryPanelTags(tagSession, batch)
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, panel := range batch {
+			if written > 0 {
+				if _, err := io.WriteString(w, ","); err != nil {
+					return err
+				}
+			}
+			encoded, err := json.Marshal(panel)
+			if err != nil {
+				return err
+			}
+			if _, err := w.Write(encoded); err != nil {
+				return err
+			}
+			written++
+		}
+		batch = batch[:0]
+		return nil
+	}
+
+	for rows.Next() {
+		var panel LibraryPanel
+		if err := rows.Scan(&panel); err != nil {
+			return err
+		}
+		batch = append(batch, panel)
+		if len(batch) == exportBatchSize {
+			if err := writeBatch(); err != nil {
+				return err
+			}
+		}
+	}
+	// xorm reports the end of the rows as sql.ErrNoRows
+	if err := rows.Err(); err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+	if err := writeBatch(); err != nil {
+		return err
+	}
+
+	_, err = io.WriteString(w, "]")
+	return err
+}
+
+// Default size of the panel snippets of Library Panels, the size of new panels in dashboards.
+const (
+	defaultSnippetWidth  = 12
+	defaultSnippetHeight = 8
+)
+
+// panelSnippetQuery is the placement in a dashboard of a panel snippet of a Library Panel.
+type panelSnippetQuery struct {
+	// PanelID is the id of the panel in the dashboard, the snippet has no id if it's 0.
+	PanelID int64
+	X       int
+	Y       int
+	// W and H are the size of the panel, the default size if 0.
+	W int
+	H int
+}
+
+// getPanelSnippet exports a Library Panel as a panel that can be added to the panels of a dashboard JSON, with
+// its placement and the reference to the Library Panel. It's the panel dashboards get when they're loaded.
+func (lps *LibraryPanelService) getPanelSnippet(c *models.ReqContext, uid string, query panelSnippetQuery) (*simplejson.Json, error) {
+	libraryPanel, err := lps.getLibraryPanel(c, uid)
+	if err != nil {
+		return nil, err
+	}
+	if libraryPanel.Kind != panelElement {
+		return nil, errLibraryPanelInvalidSnippet
+	}
+	if query.W <= 0 {
+		query.W = defaultSnippetWidth
+	}
+	if query.H <= 0 {
+		query.H = defaultSnippetHeight
+	}
+
+	snippet := simplejson.NewFromAny(map[string]interface{}{
+		"gridPos": map[string]interface{}{"h": query.H, "w": query.W, "x": query.X, "y": query.Y},
+	})
+	if query.PanelID != 0 {
+		snippet.Set("id", query.PanelID)
+	}
+	if err := resolveLibraryPanel(snippet, libraryPanel); err != nil {
+		return nil, err
+	}
+
+	return snippet, nil
+}
@@ -0,0 +1,262 @@
+package librarypanels
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/sqlstore"
+	"github.com/grafana/grafana/pkg/util"
+)
+
+const (
+	// maxFeedEntries is the number of the latest changes in the feed.
+	maxFeedEntries = 50
+	// changeRetention is how long changes are kept for the feed, changeRetentionInterval how often older ones are
+	// deleted.
+	changeRetention         = 30 * 24 * time.Hour
+	changeRetentionInterval = time.Hour
+
+	changeActionCreated = "created"
+	changeActionUpdated = "updated"
+	changeActionDeleted = "deleted"
+	changeActionMerged  = "merged"
+
+	feedFormatAtom = "atom"
+	feedFormatRSS  = "rss"
+)
+
+// libraryPanelChange records that a Library Panel was created, updated, deleted or merged into another, for the
+// change feed. It keeps the UID, name and folder of the Library Panel, so that the changes of deleted Library Panels
+// stay in the feed.
+type libraryPanelChange struct {
+	ID              int64              `xorm:"pk autoincr 'id'"`
+	OrgID           int64              `xorm:"org_id"`
+	FolderID        int64              `xorm:"folder_id"`
+	LibraryPanelUID string             `xorm:"librarypanel_uid"`
+	Name            string             `xorm:"name"`
+	Kind            libraryElementKind `xorm:"kind"`
+	Action          string             `xorm:"action"`
+	UserID          int64              `xorm:"user_id"`
+	Created         time.Time          `xorm:"created"`
+	// MergedIntoUID is the UID of the Library Panel that a merged Library Panel was merged into.
+	MergedIntoUID string `xorm:"merged_into_uid"`
+}
+
+// feedEntry is a change with the user who made it.
+type feedEntry struct {
+	libraryPanelChange `xorm:"extends"`
+	Login              string `xorm:"login"`
+	Email              string `xorm:"email"`
+	UserName           string `xorm:"user_name"`
+}
+
+// atomFeed is an Atom feed, see RFC 4287.
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	ID      string      `xml:"id"`
+	Title   string      `xml:"title"`
+	Updated string      `xml:"updated"`
+	Link    atomLink    `xml:"link"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+}
+
+type atomEntry struct {
+	ID      string     `xml:"id"`
+	Title   string     `xml:"title"`
+	Updated string     `xml:"updated"`
+	Author  atomAuthor `xml:"author"`
+	Link    atomLink   `xml:"link"`
+	Summary string     `xml:"summary"`
+}
+
+type atomAuthor struct {
+	Name string `xml:"name"`
+}
+
+// rssFeed is an RSS 2.0 feed.
+type rssFeed struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title       string    `xml:"title"`
+	Link        string    `xml:"link"`
+	Description string    `xml:"description"`
+	Items       []rssItem `xml:"item"`
+}
+
+type rssItem struct {
+	GUID        rssGUID `xml:"guid"`
+	Title       string  `xml:"title"`
+	Link        string  `xml:"link"`
+	Author      string  `xml:"author,omitempty"`
+	Description string  `xml:"description"`
+	PubDate     string  `xml:"pubDate"`
+}
+
+type rssGUID struct {
+	Value       string `xml:",chardata"`
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+}
+
+// recordLibraryPanelChange adds a change of the Library Panel by the user to the change feed.
+func recordLibraryPanelChange(session *sqlstore.DBSession, panel LibraryPanel, action string, userID int64) error {
+	change := newLibraryPanelChange(panel, action, userID)
+	_, err := session.Insert(&change)
+	return err
+}
+
+// recordLibraryPanelMerge adds the merge of the Library Panel from into the Library Panel into by the user to the
+// change feed.
+func recordLibraryPanelMerge(session *sqlstore.DBSession, from LibraryPanel, into LibraryPanel, userID int64) error {
+	change := newLibraryPanelChange(from, changeActionMerged, userID)
+	change.MergedIntoUID = into.UID
+	_, err := session.Insert(&change)
+	return err
+}
+
+func newLibraryPanelChange(panel LibraryPanel, action string, userID int64) libraryPanelChange {
+	return libraryPanelChange{
+		OrgID:           panel.OrgID,
+		FolderID:        panel.FolderID,
+		LibraryPanelUID: panel.UID,
+		Name:            panel.Name,
+		Kind:            panel.Kind,
+		Action:          action,
+		UserID:          userID,
+		Created:         time.Now(),
+	}
+}
+
+// getFeedEntries gets the latest changes to the Library Panels of the org in folders the user can view, newest
+// first. The changes of deleted Library Panels are filtered by the folder they were in.
+func (lps *LibraryPanelService) getFeedEntries(c *models.ReqContext) ([]feedEntry, error) {
+	entries := make([]feedEntry, 0)
+	err := lps.SQLStore.WithReadReplicaDbSession(context.Background(), func(session *sqlstore.DBSession) error {
+		u := lps.SQLStore.Dialect.Quote("user")
+		// the changes are aliased as library_panel, which the folder permission filter refers to
+		builder := sqlstore.SQLBuilder{}
+		builder.Write(`SELECT library_panel.*, `+u+`.login, `+u+`.email, `+u+`.name AS user_name
+			FROM library_panel_change AS library_panel
+			LEFT JOIN `+u+` ON `+u+`.id = library_panel.user_id
+			WHERE library_panel.org_id=? AND library_panel.kind=?`, c.SignedInUser.OrgId, panelElement)
+		writePermissionFilter(&builder, lps.SQLStore.Dialect, c.SignedInUser, models.PERMISSION_VIEW)
+		builder.Write(" ORDER BY library_panel.created DESC, library_panel.id DESC" + lps.SQLStore.Dialect.Limit(maxFeedEntries))
+
+		return session.SQL(builder.GetSQLString(), builder.GetParams()...).Find(&entries)
+	})
+
+	return entries, err
+}
+
+// renderFeed renders the changes as an Atom feed, or an RSS feed for the rss format. Entries link to the Library
+// Panels in the HTTP API.
+func (lps *LibraryPanelService) renderFeed(c *models.ReqContext, entries []feedEntry, format string) ([]byte, error) {
+	appURL := strings.TrimSuffix(lps.Cfg.AppURL, "/")
+	feedURL := fmt.Sprintf("%s/api/library-panels/feed?orgId=%d", appURL, c.SignedInUser.OrgId)
+	title := "Library panel changes"
+
+	var feed interface{}
+	switch format {
+	case "", feedFormatAtom:
+		atom := atomFeed{
+			ID:      feedURL,
+			Title:   title,
+			Updated: time.Now().UTC().Format(time.RFC3339),
+			Link:    atomLink{Href: feedURL, Rel: "self"},
+			Entries: make([]atomEntry, 0, len(entries)),
+		}
+		if len(entries) > 0 {
+			atom.Updated = entries[0].Created.UTC().Format(time.RFC3339)
+		}
+		for _, entry := range entries {
+			atom.Entries = append(atom.Entries, atomEntry{
+				ID:      fmt.Sprintf("%s#%d", feedURL, entry.ID),
+				Title:   feedEntryTitle(entry),
+				Updated: entry.Created.UTC().Format(time.RFC3339),
+				Author:  atomAuthor{Name: feedEntryActor(entry)},
+				Link:    atomLink{Href: libraryPanelURL(appURL, entry)},
+				Summary: feedEntrySummary(entry),
+			})
+		}
+		feed = atom
+	case feedFormatRSS:
+		rss := rssFeed{
+			Version: "2.0",
+			Channel: rssChannel{Title: title, Link: feedURL, Description: title, Items: make([]rssItem, 0, len(entries))},
+		}
+		for _, entry := range entries {
+			rss.Channel.Items = append(rss.Channel.Items, rssItem{
+				GUID:        rssGUID{Value: fmt.Sprintf("%s#%d", feedURL, entry.ID)},
+				Title:       feedEntryTitle(entry),
+				Link:        libraryPanelURL(appURL, entry),
+				Description: feedEntrySummary(entry),
+				PubDate:     entry.Created.UTC().Format(time.RFC1123Z),
+			})
+		}
+		feed = rss
+	default:
+		return nil, errLibraryPanelInvalidFeedFormat
+	}
+
+	body, err := xml.MarshalIndent(feed, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	return append([]byte(xml.Header), body...), nil
+}
+
+func feedEntryTitle(entry feedEntry) string {
+	return fmt.Sprintf("Library panel %s %s", entry.Name, entry.Action)
+}
+
+// feedEntryActor returns the name of the user who made the change. Changes without user are made with API keys.
+func feedEntryActor(entry feedEntry) string {
+	if entry.UserID == 0 {
+		return "API key"
+	}
+	if actor := util.StringsFallback3(entry.UserName, entry.Login, entry.Email); actor != "" {
+		return actor
+	}
+
+	// the user was deleted
+	return fmt.Sprintf("User %d", entry.UserID)
+}
+
+func feedEntrySummary(entry feedEntry) string {
+	if entry.Action == changeActionMerged && entry.MergedIntoUID != "" {
+		return fmt.Sprintf("%s merged library panel %s into library panel %s", feedEntryActor(entry), entry.Name, entry.MergedIntoUID)
+	}
+	return fmt.Sprintf("%s %s library panel %s", feedEntryActor(entry), entry.Action, entry.Name)
+}
+
+func libraryPanelURL(appURL string, entry feedEntry) string {
+	return fmt.Sprintf("%s/api/library-panels/%s?orgId=%d", appURL, entry.LibraryPanelUID, entry.OrgID)
+}
+
+// deleteExpiredLibraryPanelChanges deletes the changes older than the changeRetention from the change feed.
+func (lps *LibraryPanelService) deleteExpiredLibraryPanelChanges() (int64, error) {
+	var deleted int64
+	err := lps.SQLStore.WithDbSession(context.Background(), func(session *sqlstore.DBSession) error {
+		res, err := session.Exec("DELETE FROM library_panel_change WHERE created < ?", time.Now().Add(-changeRetention))
+		if err != nil {
+			return err
+		}
+		deleted, err = res.RowsAffected()
+		return err
+	})
+
+	return deleted, err
+}
@@ -0,0 +1,42 @@
+package librarypanels
+
+import (
+	"context"
+
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/sqlstore"
+	"github.com/grafana/grafana/pkg/services/sqlstore/permissions"
+)
+
+// getViewableFolderID gets the ID of the folder with the UID in the org of the user. It returns
+// errLibraryPanelFolderNotFound if the folder doesn't exist or the user can't view it, so the routes scoped to
+// a folder don't reveal the folders the user can't see.
+func (lps *LibraryPanelService) getViewableFolderID(c *models.ReqContext, uid string) (int64, error) {
+	var ids []int64
+	err := lps.SQLStore.WithReadReplicaDbSession(context.Background(), func(session *sqlstore.DBSession) error {
+		builder := sqlstore.SQLBuilder{}
+		builder.Write("SELECT dashboard.id FROM dashboard WHERE dashboard.uid=? AND dashboard.org_id=? AND dashboard.is_folder="+
+			lps.SQLStore.Dialect.BooleanStr(true), uid, c.SignedInUser.OrgId)
+		if c.SignedInUser.OrgRole != models.ROLE_ADMIN {
+			filter := permissions.DashboardPermissionFilter{
+				OrgRole:         c.SignedInUser.OrgRole,
+				Dialect:         lps.SQLStore.Dialect,
+				UserId:          c.SignedInUser.UserId,
+				OrgId:           c.SignedInUser.OrgId,
+				PermissionLevel: models.PERMISSION_VIEW,
+			}
+			filterSQL, params := filter.Where()
+			builder.Write(" AND "+filterSQL, params...)
+		}
+
+		return session.SQL(builder.GetSQLString(), builder.GetParams()...).Find(&ids)
+	})
+	if err != nil {
+		return 0, err
+	}
+	if len(ids) == 0 {
+		return 0, errLibraryPanelFolderNotFound
+	}
+
+	return ids[0], nil
+}
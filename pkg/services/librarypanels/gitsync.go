@@ -0,0 +1,467 @@
+package librarypanels
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/sqlstore"
+	"github.com/grafana/grafana/pkg/setting"
+)
+
+const (
+	defaultGitSyncIntervalSeconds = 300
+	minGitSyncIntervalSeconds     = 60
+	// gitSyncCheckInterval is how often the orgs are checked for a due sync.
+	gitSyncCheckInterval = time.Minute
+	// gitSyncUserID is the user that synced Library Panels are created and updated by.
+	gitSyncUserID = -1
+)
+
+// libraryPanelGitSync is the model for the per org configuration and status of syncing Library Panels
+// from a Git repository.
+type libraryPanelGitSync struct {
+	ID              int64      `json:"-" xorm:"pk autoincr 'id'"`
+	OrgID           int64      `json:"-" xorm:"org_id"`
+	Enabled         bool       `json:"enabled"`
+	Repository      string     `json:"repository"`
+	Branch          string     `json:"branch"`
+	Path            string     `json:"path"`
+	IntervalSeconds int64      `json:"intervalSeconds"`
+	LastSync        *time.Time `json:"lastSync"`
+	LastCommit      string     `json:"lastCommit"`
+	LastError       string     `json:"lastError"`
+
+	Created time.Time `json:"-"`
+	Updated time.Time `json:"updated"`
+}
+
+// updateGitSyncCommand is the command for configuring the Git sync of an org.
+type updateGitSyncCommand struct {
+	Enabled         bool   `json:"enabled"`
+	Repository      string `json:"repository"`
+	Branch          string `json:"branch"`
+	Path            string `json:"path"`
+	IntervalSeconds int64  `json:"intervalSeconds"`
+}
+
+// gitSyncResult is the outcome of syncing the Library Panels of an org.
+type gitSyncResult struct {
+	Commit  string   `json:"commit"`
+	Created []string `json:"created"`
+	Updated []string `json:"updated"`
+	Deleted []string `json:"deleted"`
+}
+
+// gitPanelFile is the format of the Library Panel files in a synced repository.
+type gitPanelFile struct {
+	UID      string          `json:"uid"`
+	Name     string          `json:"name"`
+	FolderID int64           `json:"folderId"`
+	Model    json.RawMessage `json:"model"`
+	Tags     []string        `json:"tags"`
+}
+
+// gitFetcher checks out the head of a branch of a repository into a directory.
+type gitFetcher interface {
+	Fetch(ctx context.Context, repository string, branch string, dir string) (commit string, err error)
+}
+
+// gitCommandFetcher is the gitFetcher that uses the git command line client.
+type gitCommandFetcher struct{}
+
+func (gitCommandFetcher) Fetch(ctx context.Context, repository string, branch string, dir string) (string, error) {
+	if _, err := os.Stat(filepath.Join(dir, ".git")); os.IsNotExist(err) {
+		if err := os.MkdirAll(filepath.Dir(dir), 0750); err != nil {
+			return "", err
+		}
+		if _, err := runGit(ctx, "", "clone", "--depth", "1", "--branch", branch, "--", repository, dir); err != nil {
+			return "", err
+		}
+	} else {
+		if _, err := runGit(ctx, dir, "remote", "set-url", "origin", "--", repository); err != nil {
+			return "", err
+		}
+		if _, err := runGit(ctx, dir, "fetch", "--depth", "1", "origin", "--", branch); err != nil {
+			return "", err
+		}
+		if _, err := runGit(ctx, dir, "reset", "--hard", "FETCH_HEAD"); err != nil {
+			return "", err
+		}
+	}
+
+	commit, err := runGit(ctx, dir, "rev-parse", "HEAD")
+	return strings.TrimSpace(commit), err
+}
+
+func runGit(ctx context.Context, dir string, subcommand string, args ...string) (string, error) {
+	// only allow the transports that were validated, never helpers like ext:: that run commands
+	args = append([]string{"-c", "protocol.allow=never", "-c", "protocol.https.allow=always", "-c", "protocol.ssh.allow=always", subcommand}, args...)
+	// #nosec G204 -- the repository and branch are validated and passed after --
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("git %s: %w: %s", subcommand, err, strings.TrimSpace(stderr.String()))
+	}
+
+	return stdout.String(), nil
+}
+
+func (lps *LibraryPanelService) fetcher() gitFetcher {
+	if lps.gitFetcher == nil {
+		return gitCommandFetcher{}
+	}
+
+	return lps.gitFetcher
+}
+
+// validateGitSync checks that the repository uses a transport that can't run commands, and that the
+// branch and path can't be mistaken for options or escape the checkout.
+func validateGitSync(cmd updateGitSyncCommand) error {
+	if cmd.IntervalSeconds < minGitSyncIntervalSeconds {
+		return errLibraryPanelInvalidGitSync
+	}
+	if cmd.Branch == "" || strings.HasPrefix(cmd.Branch, "-") {
+		return errLibraryPanelInvalidGitSync
+	}
+	if filepath.IsAbs(cmd.Path) || strings.HasPrefix(filepath.Clean(cmd.Path), "..") {
+		return errLibraryPanelInvalidGitSync
+	}
+
+	repository, err := url.Parse(cmd.Repository)
+	if err != nil || repository.Host == "" {
+		return errLibraryPanelInvalidGitSync
+	}
+	if repository.Scheme != "https" && repository.Scheme != "ssh" {
+		return errLibraryPanelInvalidGitSync
+	}
+
+	return nil
+}
+
+// getGitSync gets the Git sync configuration and status of the org.
+func (lps *LibraryPanelService) getGitSync(c *models.ReqContext) (libraryPanelGitSync, error) {
+	gitSync := libraryPanelGitSync{OrgID: c.SignedInUser.OrgId, IntervalSeconds: defaultGitSyncIntervalSeconds}
+	err := lps.SQLStore.WithDbSession(context.Background(), func(session *sqlstore.DBSession) error {
+		_, err := session.Table("library_panel_git_sync").Where("org_id=?", c.SignedInUser.OrgId).Get(&gitSync)
+		return err
+	})
+
+	return gitSync, err
+}
+
+// updateGitSync creates or updates the Git sync configuration of the org.
+func (lps *LibraryPanelService) updateGitSync(c *models.ReqContext, cmd updateGitSyncCommand) (libraryPanelGitSync, error) {
+	if cmd.IntervalSeconds == 0 {
+		cmd.IntervalSeconds = defaultGitSyncIntervalSeconds
+	}
+	if err := validateGitSync(cmd); err != nil {
+		return libraryPanelGitSync{}, err
+	}
+
+	orgID := c.SignedInUser.OrgId
+	gitSync := libraryPanelGitSync{
+		OrgID:           orgID,
+		Enabled:         cmd.Enabled,
+		Repository:      cmd.Repository,
+		Branch:          cmd.Branch,
+		Path:            filepath.Clean(cmd.Path),
+		IntervalSeconds: cmd.IntervalSeconds,
+		Created:         time.Now(),
+		Updated:         time.Now(),
+	}
+	err := lps.SQLStore.WithTransactionalDbSession(context.Background(), func(session *sqlstore.DBSession) error {
+		var existing libraryPanelGitSync
+		has, err := session.Table("library_panel_git_sync").Where("org_id=?", orgID).Get(&existing)
+		if err != nil {
+			return err
+		}
+
+		if !has {
+			_, err = session.Insert(&gitSync)
+			return err
+		}
+
+		gitSync.ID = existing.ID
+		gitSync.Created = existing.Created
+		gitSync.LastSync = existing.LastSync
+		gitSync.LastCommit = existing.LastCommit
+		gitSync.LastError = existing.LastError
+		_, err = session.ID(existing.ID).AllCols().Update(&gitSync)
+		return err
+	})
+
+	return gitSync, err
+}
+
+// syncDueLibraryPanels syncs the orgs with an enabled Git sync whose interval has passed since the last sync.
+func (lps *LibraryPanelService) syncDueLibraryPanels(ctx context.Context) error {
+	var syncs []libraryPanelGitSync
+	err := lps.SQLStore.WithDbSession(context.Background(), func(session *sqlstore.DBSession) error {
+		return session.Table("library_panel_git_sync").Where("enabled=?", true).Find(&syncs)
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, gitSync := range syncs {
+		if gitSync.LastSync != nil && time.Since(*gitSync.LastSync) < time.Duration(gitSync.IntervalSeconds)*time.Second {
+			continue
+		}
+
+		result, err := lps.syncLibraryPanels(ctx, gitSync)
+		if err != nil {
+			lps.log.Warn("Failed to sync library panels from git", "orgId", gitSync.OrgID, "repository", gitSync.Repository, "error", err)
+			continue
+		}
+		if len(result.Created)+len(result.Updated)+len(result.Deleted) > 0 {
+			lps.log.Info("Synced library panels from git", "orgId", gitSync.OrgID, "commit", result.Commit,
+				"created", len(result.Created), "updated", len(result.Updated), "deleted", len(result.Deleted))
+		}
+	}
+
+	return nil
+}
+
+// syncLibraryPanelsNow syncs the Library Panels of the org from its repository, whether or not the sync is due.
+func (lps *LibraryPanelService) syncLibraryPanelsNow(c *models.ReqContext) (gitSyncResult, error) {
+	gitSync, err := lps.getGitSync(c)
+	if err != nil {
+		return gitSyncResult{}, err
+	}
+	if gitSync.ID == 0 {
+		return gitSyncResult{}, errLibraryPanelInvalidGitSync
+	}
+
+	return lps.syncLibraryPanels(c.Req.Context(), gitSync)
+}
+
+// syncLibraryPanels checks out the repository of the org and makes the Library Panels synced from it match
+// the panel files in the configured path, then records the outcome in the sync status.
+func (lps *LibraryPanelService) syncLibraryPanels(ctx context.Context, gitSync libraryPanelGitSync) (gitSyncResult, error) {
+	result, syncErr := lps.reconcileLibraryPanels(ctx, gitSync)
+
+	now := time.Now()
+	status := libraryPanelGitSync{LastSync: &now, LastCommit: gitSync.LastCommit}
+	if syncErr != nil {
+		status.LastError = syncErr.Error()
+	} else {
+		status.LastCommit = result.Commit
+	}
+	err := lps.SQLStore.WithDbSession(context.Background(), func(session *sqlstore.DBSession) error {
+		_, err := session.Table("library_panel_git_sync").ID(gitSync.ID).Cols("last_sync", "last_commit", "last_error").Update(&status)
+		return err
+	})
+	if syncErr != nil {
+		return gitSyncResult{}, syncErr
+	}
+
+	return result, err
+}
+
+func (lps *LibraryPanelService) reconcileLibraryPanels(ctx context.Context, gitSync libraryPanelGitSync) (gitSyncResult, error) {
+	dir := filepath.Join(lps.Cfg.DataPath, "library-panels-git", strconv.FormatInt(gitSync.OrgID, 10))
+	commit, err := lps.fetcher().Fetch(ctx, gitSync.Repository, gitSync.Branch, dir)
+	if err != nil {
+		return gitSyncResult{}, err
+	}
+
+	files, err := readGitPanelFiles(dir, gitSync.Path, lps.Cfg.LibraryPanels)
+	if err != nil {
+		return gitSyncResult{}, err
+	}
+
+	result := gitSyncResult{Commit: commit, Created: []string{}, Updated: []string{}, Deleted: []string{}}
+	err = lps.SQLStore.WithTransactionalDbSession(context.Background(), func(session *sqlstore.DBSession) error {
+		var synced []LibraryPanel
+		if err := session.Table("library_panel").Where("org_id=? AND sync_path<>''", gitSync.OrgID).Find(&synced); err != nil {
+			return err
+		}
+		if err := loadLibraryPanelTags(session, synced); err != nil {
+			return err
+		}
+		syncedByPath := make(map[string]LibraryPanel, len(synced))
+		for _, panel := range synced {
+			syncedByPath[panel.SyncPath] = panel
+		}
+
+		for path, file := range files {
+			existing, exists := syncedByPath[path]
+			delete(syncedByPath, path)
+			file.Tags = normalizeTags(file.Tags)
+			if file.FolderID != 0 {
+				// the folder id comes from the repository, it must be a folder of the org
+				folderExists, err := session.Table("dashboard").Where("id=? AND org_id=? AND is_folder=?", file.FolderID, gitSync.OrgID, true).Exist()
+				if err != nil {
+					return err
+				}
+				if !folderExists {
+					return fmt.Errorf("invalid library panel in %s: folder %d could not be found", path, file.FolderID)
+				}
+			}
+			if exists && existing.Name == file.Name && existing.FolderID == file.FolderID &&
+				jsonEqual(existing.Model, file.Model) && reflect.DeepEqual(existing.Tags, file.Tags) {
+				continue
+			}
+
+			panel := LibraryPanel{
+				OrgID:         gitSync.OrgID,
+				FolderID:      file.FolderID,
+				UID:           file.UID,
+				Name:          file.Name,
+				Kind:          panelElement,
+				Model:         file.Model,
+				ModelHash:     modelHash(file.Model),
+				Tags:          file.Tags,
+				SchemaVersion: currentPanelSchemaVersion,
+				SyncPath:      path,
+				Status:        statusPublished,
+				Updated:       time.Now(),
+				UpdatedBy:     gitSyncUserID,
+
+				modelCompression: lps.modelCompression,
+			}
+			if exists {
+				panel.ID = existing.ID
+				panel.UID = existing.UID
+				if _, err := session.ID(existing.ID).Cols("folder_id", "name", "model", "model_hash", "schema_version", "updated", "updated_by").Update(&panel); err != nil {
+					return fmt.Errorf("failed to update library panel from %s: %w", path, err)
+				}
+				result.Updated = append(result.Updated, panel.UID)
+			} else {
+				if panel.UID == "" {
+					if panel.UID, err = lps.generateLibraryPanelUID(session, gitSync.OrgID); err != nil {
+						return err
+					}
+				}
+				panel.Created = panel.Updated
+				panel.CreatedBy = gitSyncUserID
+				if _, err := session.Insert(&panel); err != nil {
+					return fmt.Errorf("failed to create library panel from %s: %w", path, err)
+				}
+				result.Created = append(result.Created, panel.UID)
+			}
+
+			if err := setLibraryPanelTags(session, panel.ID, panel.Tags); err != nil {
+				return err
+			}
+			if err := setLibraryPanelDatasources(session, panel.ID, panel.Model); err != nil {
+				return err
+			}
+		}
+
+		for _, panel := range syncedByPath {
+			// pinned Library Panels are kept, and aren't synced anymore
+			if panel.Pinned {
+				if _, err := session.Exec("UPDATE library_panel SET sync_path='' WHERE id=?", panel.ID); err != nil {
+					return err
+				}
+				continue
+			}
+			if err := deleteLibraryPanelByID(session, panel.ID); err != nil {
+				return err
+			}
+			result.Deleted = append(result.Deleted, panel.UID)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return gitSyncResult{}, err
+	}
+	lps.invalidateLibraryPanelCache()
+
+	return result, nil
+}
+
+// readGitPanelFiles reads the Library Panel files in the path of the checkout and its subdirectories, by their path
+// relative to the path. Files that aren't valid Library Panels fail the whole sync, so a broken commit doesn't delete
+// panels. Symbolic links are skipped and the path must resolve to a directory inside the checkout, so a repository
+// can't import files of the host.
+func readGitPanelFiles(checkout string, syncPath string, settings setting.LibraryPanelsSettings) (map[string]gitPanelFile, error) {
+	root, err := filepath.EvalSymlinks(checkout)
+	if err != nil {
+		return nil, err
+	}
+	dir, err := filepath.EvalSymlinks(filepath.Join(checkout, syncPath))
+	if err != nil {
+		return nil, err
+	}
+	if inside, err := filepath.Rel(root, dir); err != nil || inside == ".." || strings.HasPrefix(inside, ".."+string(filepath.Separator)) {
+		return nil, fmt.Errorf("the path %s is outside of the repository", syncPath)
+	}
+
+	files := make(map[string]gitPanelFile)
+	err = filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			return nil
+		}
+		if info.IsDir() {
+			if info.Name() == ".git" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if filepath.Ext(path) != ".json" {
+			return nil
+		}
+
+		relative, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		// #nosec G304 -- the path is inside the checkout of the repository
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+
+		var file gitPanelFile
+		if err := json.Unmarshal(data, &file); err != nil {
+			return fmt.Errorf("failed to parse %s: %w", relative, err)
+		}
+		if file.Name == "" {
+			file.Name = strings.TrimSuffix(filepath.Base(relative), ".json")
+		}
+		file.Model = normalizeModel(panelElement, file.Model)
+		if err := validateModel(file.Model, settings); err != nil {
+			return fmt.Errorf("invalid library panel in %s: %w", relative, err)
+		}
+
+		files[filepath.ToSlash(relative)] = file
+		return nil
+	})
+
+	return files, err
+}
+
+// jsonEqual returns true if the models are the same JSON, the database may have reformatted the stored model.
+func jsonEqual(a json.RawMessage, b json.RawMessage) bool {
+	var valueA, valueB interface{}
+	if err := json.Unmarshal(a, &valueA); err != nil {
+		return false
+	}
+	if err := json.Unmarshal(b, &valueB); err != nil {
+		return false
+	}
+
+	return reflect.DeepEqual(valueA, valueB)
+}
@@ -0,0 +1,145 @@
+package librarypanels
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/sqlstore"
+)
+
+const (
+	impactNone   = "none"
+	impactLow    = "low"
+	impactMedium = "medium"
+	impactHigh   = "high"
+)
+
+// impactLevels orders the impact levels from the lowest to the highest.
+var impactLevels = map[string]int{impactNone: 0, impactLow: 1, impactMedium: 2, impactHigh: 3}
+
+// analyzeImpactCommand is the command for analyzing the impact of a new model for a Library Panel.
+type analyzeImpactCommand struct {
+	Model json.RawMessage `json:"model"`
+}
+
+// impactChange is a change of the model that affects the dashboards using the Library Panel.
+type impactChange struct {
+	// Kind is datasource, query, visualization or options.
+	Kind    string `json:"kind"`
+	Impact  string `json:"impact"`
+	Message string `json:"message"`
+}
+
+// impactedDashboard is a dashboard using the Library Panel. The title is empty if the dashboard doesn't
+// exist anymore.
+type impactedDashboard struct {
+	ID      int64  `json:"id" xorm:"id"`
+	UID     string `json:"uid" xorm:"uid"`
+	Title   string `json:"title" xorm:"title"`
+	PanelID int64  `json:"panelId" xorm:"panel_id"`
+}
+
+// impactAnalysis is the impact of a new model on the dashboards using a Library Panel. Impact is the highest
+// impact of the changes, or none if no dashboard uses the Library Panel.
+type impactAnalysis struct {
+	Impact     string              `json:"impact"`
+	Changes    []impactChange      `json:"changes"`
+	Dashboards []impactedDashboard `json:"dashboards"`
+}
+
+// analyzeImpact compares a new model of a Library Panel with the stored one, and returns the dashboards using the
+// Library Panel with an estimate of how much they would change. Changing the datasource or the visualization type
+// has a high impact, changing the queries a medium one and changing other options a low one.
+func (lps *LibraryPanelService) analyzeImpact(c *models.ReqContext, uid string, cmd analyzeImpactCommand) (impactAnalysis, error) {
+	libraryPanel, err := lps.getLibraryPanel(c, uid)
+	if err != nil {
+		return impactAnalysis{}, err
+	}
+	if err := validateElementModel(libraryPanel.Kind, cmd.Model, lps.Cfg.LibraryPanels); err != nil {
+		return impactAnalysis{}, err
+	}
+
+	result := impactAnalysis{Impact: impactNone, Changes: modelChanges(libraryPanel.Model, cmd.Model), Dashboards: make([]impactedDashboard, 0)}
+	err = lps.SQLStore.WithReadReplicaDbSession(context.Background(), func(session *sqlstore.DBSession) error {
+		return session.SQL(`SELECT library_panel_dashboard.dashboard_id AS id, COALESCE(dashboard.uid, '') AS uid,
+			COALESCE(dashboard.title, '') AS title, library_panel_dashboard.panel_id
+			FROM library_panel_dashboard
+			LEFT JOIN dashboard ON dashboard.id = library_panel_dashboard.dashboard_id
+			WHERE library_panel_dashboard.librarypanel_id=?
+			ORDER BY library_panel_dashboard.dashboard_id ASC, library_panel_dashboard.panel_id ASC`, libraryPanel.ID).Find(&result.Dashboards)
+	})
+	if err != nil {
+		return impactAnalysis{}, err
+	}
+
+	if len(result.Dashboards) > 0 {
+		for _, change := range result.Changes {
+			if impactLevels[change.Impact] > impactLevels[result.Impact] {
+				result.Impact = change.Impact
+			}
+		}
+	}
+
+	return result, nil
+}
+
+// modelChanges returns the changes between two panel models, in a fixed order.
+func modelChanges(before json.RawMessage, after json.RawMessage) []impactChange {
+	changes := make([]impactChange, 0)
+	var beforePanel, afterPanel map[string]interface{}
+	if err := json.Unmarshal(before, &beforePanel); err != nil {
+		beforePanel = map[string]interface{}{}
+	}
+	if err := json.Unmarshal(after, &afterPanel); err != nil {
+		afterPanel = map[string]interface{}{}
+	}
+
+	beforeDatasources, afterDatasources := getDatasourceReferences(before), getDatasourceReferences(after)
+	if !reflect.DeepEqual(beforeDatasources, afterDatasources) {
+		changes = append(changes, impactChange{Kind: "datasource", Impact: impactHigh,
+			Message: fmt.Sprintf("datasources change from [%s] to [%s]", strings.Join(beforeDatasources, ", "), strings.Join(afterDatasources, ", "))})
+	}
+	if !reflect.DeepEqual(queriesWithoutDatasource(beforePanel["targets"]), queriesWithoutDatasource(afterPanel["targets"])) {
+		changes = append(changes, impactChange{Kind: "query", Impact: impactMedium, Message: "queries change"})
+	}
+	if beforePanel["type"] != afterPanel["type"] {
+		changes = append(changes, impactChange{Kind: "visualization", Impact: impactHigh,
+			Message: fmt.Sprintf("visualization changes from %v to %v", beforePanel["type"], afterPanel["type"])})
+	}
+
+	// the panel position and id belong to the dashboards, not to the Library Panel
+	for _, key := range []string{"datasource", "targets", "type", "gridPos", "id", "libraryPanel"} {
+		delete(beforePanel, key)
+		delete(afterPanel, key)
+	}
+	if !reflect.DeepEqual(beforePanel, afterPanel) {
+		changes = append(changes, impactChange{Kind: "options", Impact: impactLow, Message: "panel options change"})
+	}
+
+	return changes
+}
+
+// queriesWithoutDatasource returns the queries of a panel without their datasources, so that datasource changes
+// aren't reported as query changes too.
+func queriesWithoutDatasource(targets interface{}) []interface{} {
+	queries, _ := targets.([]interface{})
+	result := make([]interface{}, 0, len(queries))
+	for _, query := range queries {
+		if object, ok := query.(map[string]interface{}); ok {
+			copied := make(map[string]interface{}, len(object))
+			for key, value := range object {
+				if key != "datasource" {
+					copied[key] = value
+				}
+			}
+			query = copied
+		}
+		result = append(result, query)
+	}
+
+	return result
+}
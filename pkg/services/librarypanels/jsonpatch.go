@@ -0,0 +1,385 @@
+package librarypanels
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/grafana/grafana/pkg/models"
+)
+
+// Content types of patch requests that are applied to the patch document of the Library Panel, rather than
+// holding the fields to update.
+const (
+	contentTypeJSONPatch  = "application/json-patch+json"
+	contentTypeMergePatch = "application/merge-patch+json"
+)
+
+// patchDocument is the document JSON Patches and JSON Merge Patches of a Library Panel are applied to.
+type patchDocument struct {
+	FolderID int64           `json:"folderId"`
+	Name     string          `json:"name"`
+	Model    json.RawMessage `json:"model"`
+	Tags     []string        `json:"tags"`
+}
+
+// jsonPatchOperation is an operation of a JSON Patch, RFC 6902.
+type jsonPatchOperation struct {
+	Op    string           `json:"op"`
+	Path  string           `json:"path"`
+	From  string           `json:"from"`
+	Value *json.RawMessage `json:"value"`
+}
+
+// bindPatchDocument applies the JSON Patch or JSON Merge Patch of a patch request to the patch document of the
+// Library Panel, and replaces the request body with the resulting patchLibraryPanelCommand, so the rest of the
+// patch endpoint handles it like any other patch. Other requests are left as they are.
+func (lps *LibraryPanelService) bindPatchDocument(c *models.ReqContext) {
+	contentType, _, _ := mime.ParseMediaType(c.Req.Header.Get("Content-Type"))
+	if contentType != contentTypeJSONPatch && contentType != contentTypeMergePatch {
+		return
+	}
+
+	body, err := ioutil.ReadAll(c.Req.Request.Body)
+	if err != nil {
+		errorResponse(fmt.Errorf("%w: %s", errLibraryPanelInvalidPatch, err), "Failed to update library panel").WriteTo(c)
+		return
+	}
+	cmd, err := lps.applyPatchDocument(c, c.Params(":uid"), contentType, body)
+	if err != nil {
+		errorResponse(err, "Failed to update library panel").WriteTo(c)
+		return
+	}
+	encoded, err := json.Marshal(cmd)
+	if err != nil {
+		errorResponse(err, "Failed to update library panel").WriteTo(c)
+		return
+	}
+
+	c.Req.Request.Body = ioutil.NopCloser(bytes.NewReader(encoded))
+	c.Req.ContentLength = int64(len(encoded))
+	c.Req.Header.Set("Content-Type", "application/json")
+}
+
+// applyPatchDocument applies a JSON Patch or JSON Merge Patch to the patch document of the Library Panel with
+// the UID, and returns the command patching the Library Panel to the result.
+func (lps *LibraryPanelService) applyPatchDocument(c *models.ReqContext, uid string, contentType string, patch []byte) (patchLibraryPanelCommand, error) {
+	libraryPanel, err := lps.getLibraryPanel(c, uid)
+	if err != nil {
+		return patchLibraryPanelCommand{}, err
+	}
+	tags := libraryPanel.Tags
+	if tags == nil {
+		tags = []string{}
+	}
+	current, err := json.Marshal(patchDocument{
+		FolderID: libraryPanel.FolderID,
+		Name:     libraryPanel.Name,
+		Model:    libraryPanel.Model,
+		Tags:     tags,
+	})
+	if err != nil {
+		return patchLibraryPanelCommand{}, err
+	}
+	var document interface{}
+	if err := json.Unmarshal(current, &document); err != nil {
+		return patchLibraryPanelCommand{}, err
+	}
+
+	if contentType == contentTypeJSONPatch {
+		var operations []jsonPatchOperation
+		if err := json.Unmarshal(patch, &operations); err != nil {
+			return patchLibraryPanelCommand{}, fmt.Errorf("%w: %s", errLibraryPanelInvalidPatch, err)
+		}
+		if document, err = applyJSONPatch(document, operations); err != nil {
+			return patchLibraryPanelCommand{}, err
+		}
+	} else {
+		var mergePatch interface{}
+		if err := json.Unmarshal(patch, &mergePatch); err != nil {
+			return patchLibraryPanelCommand{}, fmt.Errorf("%w: %s", errLibraryPanelInvalidPatch, err)
+		}
+		document = applyMergePatch(document, mergePatch)
+	}
+
+	patched, err := json.Marshal(document)
+	if err != nil {
+		return patchLibraryPanelCommand{}, err
+	}
+	var result patchDocument
+	if err := json.Unmarshal(patched, &result); err != nil {
+		return patchLibraryPanelCommand{}, fmt.Errorf("%w: %s", errLibraryPanelInvalidPatch, err)
+	}
+	if result.Tags == nil {
+		result.Tags = []string{}
+	}
+
+	return patchLibraryPanelCommand{
+		FolderID: result.FolderID,
+		Name:     result.Name,
+		Model:    result.Model,
+		Tags:     result.Tags,
+	}, nil
+}
+
+// applyMergePatch applies a JSON Merge Patch, RFC 7396, to the target.
+func applyMergePatch(target interface{}, patch interface{}) interface{} {
+	patchObject, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+	targetObject, ok := target.(map[string]interface{})
+	if !ok {
+		targetObject = map[string]interface{}{}
+	}
+	for key, value := range patchObject {
+		if value == nil {
+			delete(targetObject, key)
+			continue
+		}
+		targetObject[key] = applyMergePatch(targetObject[key], value)
+	}
+
+	return targetObject
+}
+
+// applyJSONPatch applies the operations of a JSON Patch, RFC 6902, to the document. The patch is applied
+// completely or not at all.
+func applyJSONPatch(document interface{}, operations []jsonPatchOperation) (interface{}, error) {
+	for i, operation := range operations {
+		var value interface{}
+		if operation.Value != nil {
+			if err := json.Unmarshal(*operation.Value, &value); err != nil {
+				return nil, fmt.Errorf("%w: operation %d: %s", errLibraryPanelInvalidPatch, i, err)
+			}
+		}
+
+		var err error
+		switch operation.Op {
+		case "add":
+			if operation.Value == nil {
+				return nil, fmt.Errorf("%w: operation %d: missing value", errLibraryPanelInvalidPatch, i)
+			}
+			document, err = addJSONValue(document, operation.Path, value)
+		case "remove":
+			document, _, err = removeJSONValue(document, operation.Path)
+		case "replace":
+			if operation.Value == nil {
+				return nil, fmt.Errorf("%w: operation %d: missing value", errLibraryPanelInvalidPatch, i)
+			}
+			if document, _, err = removeJSONValue(document, operation.Path); err == nil {
+				document, err = addJSONValue(document, operation.Path, value)
+			}
+		case "move":
+			if strings.HasPrefix(operation.Path, operation.From+"/") {
+				return nil, fmt.Errorf("%w: operation %d: can't move %s into itself", errLibraryPanelInvalidPatch, i, operation.From)
+			}
+			var moved interface{}
+			if document, moved, err = removeJSONValue(document, operation.From); err == nil {
+				document, err = addJSONValue(document, operation.Path, moved)
+			}
+		case "copy":
+			var copied interface{}
+			if copied, err = getJSONValue(document, operation.From); err == nil {
+				document, err = addJSONValue(document, operation.Path, deepCopyJSON(copied))
+			}
+		case "test":
+			var actual interface{}
+			if actual, err = getJSONValue(document, operation.Path); err == nil && !reflect.DeepEqual(actual, value) {
+				return nil, errLibraryPanelPatchTestFailed
+			}
+		default:
+			return nil, fmt.Errorf("%w: operation %d: unknown op %q", errLibraryPanelInvalidPatch, i, operation.Op)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: operation %d: %s", errLibraryPanelInvalidPatch, i, err)
+		}
+	}
+
+	return document, nil
+}
+
+// parseJSONPointer returns the reference tokens of a JSON Pointer, RFC 6901.
+func parseJSONPointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("path %q must start with /", pointer)
+	}
+
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+	}
+	return tokens, nil
+}
+
+// arrayIndex returns the index of the token in an array of the length, allowing the length itself (and "-")
+// when appending.
+func arrayIndex(token string, length int, appending bool) (int, error) {
+	if token == "-" && appending {
+		return length, nil
+	}
+	index, err := strconv.Atoi(token)
+	if err != nil || index < 0 || (token != "0" && strings.HasPrefix(token, "0")) {
+		return 0, fmt.Errorf("invalid array index %q", token)
+	}
+	if index > length || (index == length && !appending) {
+		return 0, fmt.Errorf("array index %d out of range", index)
+	}
+	return index, nil
+}
+
+func getJSONValue(document interface{}, pointer string) (interface{}, error) {
+	tokens, err := parseJSONPointer(pointer)
+	if err != nil {
+		return nil, err
+	}
+
+	value := document
+	for _, token := range tokens {
+		switch container := value.(type) {
+		case map[string]interface{}:
+			child, ok := container[token]
+			if !ok {
+				return nil, fmt.Errorf("path %q does not exist", pointer)
+			}
+			value = child
+		case []interface{}:
+			index, err := arrayIndex(token, len(container), false)
+			if err != nil {
+				return nil, err
+			}
+			value = container[index]
+		default:
+			return nil, fmt.Errorf("path %q does not exist", pointer)
+		}
+	}
+	return value, nil
+}
+
+// addJSONValue adds the value at the pointer and returns the document, which is replaced if the pointer is
+// the whole document.
+func addJSONValue(document interface{}, pointer string, value interface{}) (interface{}, error) {
+	tokens, err := parseJSONPointer(pointer)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return value, nil
+	}
+
+	return updateJSONParent(document, pointer, tokens, func(parent interface{}, token string) (interface{}, error) {
+		switch container := parent.(type) {
+		case map[string]interface{}:
+			container[token] = value
+			return container, nil
+		case []interface{}:
+			index, err := arrayIndex(token, len(container), true)
+			if err != nil {
+				return nil, err
+			}
+			container = append(container, nil)
+			copy(container[index+1:], container[index:])
+			container[index] = value
+			return container, nil
+		default:
+			return nil, fmt.Errorf("path %q does not exist", pointer)
+		}
+	})
+}
+
+// removeJSONValue removes the value at the pointer, and returns the document and the removed value.
+func removeJSONValue(document interface{}, pointer string) (interface{}, interface{}, error) {
+	tokens, err := parseJSONPointer(pointer)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, document, nil
+	}
+
+	var removed interface{}
+	document, err = updateJSONParent(document, pointer, tokens, func(parent interface{}, token string) (interface{}, error) {
+		switch container := parent.(type) {
+		case map[string]interface{}:
+			value, ok := container[token]
+			if !ok {
+				return nil, fmt.Errorf("path %q does not exist", pointer)
+			}
+			removed = value
+			delete(container, token)
+			return container, nil
+		case []interface{}:
+			index, err := arrayIndex(token, len(container), false)
+			if err != nil {
+				return nil, err
+			}
+			removed = container[index]
+			return append(container[:index:index], container[index+1:]...), nil
+		default:
+			return nil, fmt.Errorf("path %q does not exist", pointer)
+		}
+	})
+	return document, removed, err
+}
+
+// updateJSONParent replaces the parent of the last token of the pointer with the result of update, since
+// inserting into and removing from arrays returns new slices.
+func updateJSONParent(document interface{}, pointer string, tokens []string, update func(parent interface{}, token string) (interface{}, error)) (interface{}, error) {
+	if len(tokens) == 1 {
+		return update(document, tokens[0])
+	}
+
+	switch container := document.(type) {
+	case map[string]interface{}:
+		child, ok := container[tokens[0]]
+		if !ok {
+			return nil, fmt.Errorf("path %q does not exist", pointer)
+		}
+		updated, err := updateJSONParent(child, pointer, tokens[1:], update)
+		if err != nil {
+			return nil, err
+		}
+		container[tokens[0]] = updated
+		return container, nil
+	case []interface{}:
+		index, err := arrayIndex(tokens[0], len(container), false)
+		if err != nil {
+			return nil, err
+		}
+		updated, err := updateJSONParent(container[index], pointer, tokens[1:], update)
+		if err != nil {
+			return nil, err
+		}
+		container[index] = updated
+		return container, nil
+	default:
+		return nil, fmt.Errorf("path %q does not exist", pointer)
+	}
+}
+
+func deepCopyJSON(value interface{}) interface{} {
+	switch typed := value.(type) {
+	case map[string]interface{}:
+		copied := make(map[string]interface{}, len(typed))
+		for key, child := range typed {
+			copied[key] = deepCopyJSON(child)
+		}
+		return copied
+	case []interface{}:
+		copied := make([]interface{}, len(typed))
+		for i, child := range typed {
+			copied[i] = deepCopyJSON(child)
+		}
+		return copied
+	default:
+		return value
+	}
+}
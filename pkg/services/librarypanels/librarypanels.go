@@ -1,9 +1,18 @@
 package librarypanels
 
 import (
+	"encoding/json"
+
 	"github.com/grafana/grafana/pkg/api/routing"
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/components/simplejson"
 	"github.com/grafana/grafana/pkg/infra/log"
+	"github.com/grafana/grafana/pkg/infra/remotecache"
+	"github.com/grafana/grafana/pkg/infra/serverlock"
+	"github.com/grafana/grafana/pkg/models"
 	"github.com/grafana/grafana/pkg/registry"
+	"github.com/grafana/grafana/pkg/services/quota"
+	"github.com/grafana/grafana/pkg/services/rendering"
 	"github.com/grafana/grafana/pkg/services/sqlstore"
 	"github.com/grafana/grafana/pkg/services/sqlstore/migrator"
 	"github.com/grafana/grafana/pkg/setting"
@@ -11,10 +20,24 @@ import (
 
 // LibraryPanelService is the service for the Panel Library feature.
 type LibraryPanelService struct {
-	Cfg           *setting.Cfg          `inject:""`
-	SQLStore      *sqlstore.SQLStore    `inject:""`
-	RouteRegister routing.RouteRegister `inject:""`
-	log           log.Logger
+	Bus               bus.Bus                       `inject:""`
+	Cfg               *setting.Cfg                  `inject:""`
+	SQLStore          *sqlstore.SQLStore            `inject:""`
+	QuotaService      *quota.QuotaService           `inject:""`
+	ServerLockService *serverlock.ServerLockService `inject:""`
+	RouteRegister     routing.RouteRegister         `inject:""`
+	RemoteCache       *remotecache.RemoteCache      `inject:""`
+	RenderService     rendering.Service             `inject:""`
+	log               log.Logger
+	gitFetcher        gitFetcher
+	backupStorage     backupStorage
+	panelCache        *libraryPanelCache
+	uidGenerator      func() string
+	variantRandom     func() float64
+	propagationWake   chan struct{}
+	viewBuffer        *libraryPanelViewBuffer
+	modelCompression  string
+	storedModels      *storedModelState
 }
 
 func init() {
@@ -24,12 +47,36 @@ func init() {
 // Init initializes the LibraryPanel service
 func (lps *LibraryPanelService) Init() error {
 	lps.log = log.New("librarypanels")
+	lps.propagationWake = make(chan struct{}, 1)
+	lps.panelCache = newLibraryPanelCache()
+	lps.viewBuffer = newLibraryPanelViewBuffer()
+	lps.storedModels = &storedModelState{}
+	switch compression := lps.Cfg.LibraryPanels.ModelCompression; compression {
+	case modelCompressionNone, modelCompressionGzip:
+		lps.modelCompression = compression
+	default:
+		lps.log.Warn("Unsupported library panel model compression, models are stored uncompressed", "compression", compression)
+		lps.modelCompression = modelCompressionNone
+	}
 
 	lps.registerAPIEndpoints()
+	lps.registerBusHandlers()
 
 	return nil
 }
 
+func (lps *LibraryPanelService) registerBusHandlers() {
+	if !lps.IsEnabled() {
+		return
+	}
+
+	lps.Bus.AddHandler(lps.findLibraryPanelsHandler)
+	lps.Bus.AddHandler(lps.resolveLibraryQueriesHandler)
+	lps.Bus.AddEventListener(lps.handlePluginStateChanged)
+	lps.Bus.AddEventListener(lps.handleUserDeleted)
+	lps.Bus.AddEventListener(lps.handleDashboardAlertsSaved)
+}
+
 // IsEnabled returns true if the Panel Library feature is enabled for this instance.
 func (lps *LibraryPanelService) IsEnabled() bool {
 	if lps.Cfg == nil {
@@ -68,6 +115,32 @@ func (lps *LibraryPanelService) AddMigration(mg *migrator.Migrator) {
 	mg.AddMigration("create library_panel table v1", migrator.NewAddTableMigration(libraryPanelV1))
 	mg.AddMigration("add index library_panel org_id & folder_id & name", migrator.NewAddIndexMigration(libraryPanelV1, libraryPanelV1.Indices[0]))
 
+	mg.AddMigration("add last_connected_at column to library_panel", migrator.NewAddColumnMigration(libraryPanelV1, &migrator.Column{
+		Name: "last_connected_at", Type: migrator.DB_DateTime, Nullable: true,
+	}))
+	mg.AddMigration("add last_viewed_at column to library_panel", migrator.NewAddColumnMigration(libraryPanelV1, &migrator.Column{
+		Name: "last_viewed_at", Type: migrator.DB_DateTime, Nullable: true,
+	}))
+
+	mg.AddMigration("add schema_version column to library_panel", migrator.NewAddColumnMigration(libraryPanelV1, &migrator.Column{
+		Name: "schema_version", Type: migrator.DB_BigInt, Nullable: false, Default: "0",
+	}))
+
+	// Library variables are stored next to Library Panels, and names only have to be unique per kind.
+	mg.AddMigration("add kind column to library_panel", migrator.NewAddColumnMigration(libraryPanelV1, &migrator.Column{
+		Name: "kind", Type: migrator.DB_BigInt, Nullable: false, Default: "1",
+	}))
+	mg.AddMigration("drop index library_panel org_id & folder_id & name", migrator.NewDropIndexMigration(libraryPanelV1, libraryPanelV1.Indices[0]))
+	mg.AddMigration("add index library_panel org_id & folder_id & name & kind", migrator.NewAddIndexMigration(libraryPanelV1, &migrator.Index{
+		Cols: []string{"org_id", "folder_id", "name", "kind"}, Type: migrator.UniqueIndex,
+	}))
+
+	// Native JSON columns let us filter on paths inside the model in the database rather than in Go.
+	// SQLite keeps storing the model as text.
+	mg.AddMigration("alter library_panel model to native json", migrator.NewRawSQLMigration("").
+		Postgres("ALTER TABLE library_panel ALTER COLUMN model TYPE JSONB USING model::JSONB;").
+		Mysql("ALTER TABLE library_panel MODIFY model JSON NOT NULL;"))
+
 	libraryPanelDashboardV1 := migrator.Table{
 		Name: "library_panel_dashboard",
 		Columns: []*migrator.Column{
@@ -84,4 +157,845 @@ func (lps *LibraryPanelService) AddMigration(mg *migrator.Migrator) {
 
 	mg.AddMigration("create library_panel_dashboard table v1", migrator.NewAddTableMigration(libraryPanelDashboardV1))
 	mg.AddMigration("add index library_panel_dashboard librarypanel_id & dashboard_id", migrator.NewAddIndexMigration(libraryPanelDashboardV1, libraryPanelDashboardV1.Indices[0]))
+
+	libraryPanelTagV1 := migrator.Table{
+		Name: "library_panel_tag",
+		Columns: []*migrator.Column{
+			{Name: "id", Type: migrator.DB_BigInt, IsPrimaryKey: true, IsAutoIncrement: true},
+			{Name: "librarypanel_id", Type: migrator.DB_BigInt, Nullable: false},
+			{Name: "term", Type: migrator.DB_NVarchar, Length: 50, Nullable: false},
+		},
+		Indices: []*migrator.Index{
+			{Cols: []string{"librarypanel_id", "term"}, Type: migrator.UniqueIndex},
+			{Cols: []string{"term"}},
+		},
+	}
+
+	mg.AddMigration("create library_panel_tag table v1", migrator.NewAddTableMigration(libraryPanelTagV1))
+	mg.AddMigration("add index library_panel_tag librarypanel_id & term", migrator.NewAddIndexMigration(libraryPanelTagV1, libraryPanelTagV1.Indices[0]))
+	mg.AddMigration("add index library_panel_tag term", migrator.NewAddIndexMigration(libraryPanelTagV1, libraryPanelTagV1.Indices[1]))
+
+	libraryPanelStatV1 := migrator.Table{
+		Name: "library_panel_stat",
+		Columns: []*migrator.Column{
+			{Name: "id", Type: migrator.DB_BigInt, IsPrimaryKey: true, IsAutoIncrement: true},
+			{Name: "org_id", Type: migrator.DB_BigInt, Nullable: false},
+			{Name: "librarypanel_id", Type: migrator.DB_BigInt, Nullable: false},
+			{Name: "views", Type: migrator.DB_BigInt, Nullable: false},
+			{Name: "created", Type: migrator.DB_DateTime, Nullable: false},
+			{Name: "updated", Type: migrator.DB_DateTime, Nullable: false},
+		},
+		Indices: []*migrator.Index{
+			{Cols: []string{"librarypanel_id"}, Type: migrator.UniqueIndex},
+		},
+	}
+
+	mg.AddMigration("create library_panel_stat table v1", migrator.NewAddTableMigration(libraryPanelStatV1))
+	mg.AddMigration("add index library_panel_stat librarypanel_id", migrator.NewAddIndexMigration(libraryPanelStatV1, libraryPanelStatV1.Indices[0]))
+
+	libraryPanelDatasourceV1 := migrator.Table{
+		Name: "library_panel_datasource",
+		Columns: []*migrator.Column{
+			{Name: "id", Type: migrator.DB_BigInt, IsPrimaryKey: true, IsAutoIncrement: true},
+			{Name: "librarypanel_id", Type: migrator.DB_BigInt, Nullable: false},
+			{Name: "datasource_uid", Type: migrator.DB_NVarchar, Length: 255, Nullable: false},
+		},
+		Indices: []*migrator.Index{
+			{Cols: []string{"librarypanel_id", "datasource_uid"}, Type: migrator.UniqueIndex},
+			{Cols: []string{"datasource_uid"}},
+		},
+	}
+
+	mg.AddMigration("create library_panel_datasource table v1", migrator.NewAddTableMigration(libraryPanelDatasourceV1))
+	mg.AddMigration("add index library_panel_datasource librarypanel_id & datasource_uid", migrator.NewAddIndexMigration(libraryPanelDatasourceV1, libraryPanelDatasourceV1.Indices[0]))
+	mg.AddMigration("add index library_panel_datasource datasource_uid", migrator.NewAddIndexMigration(libraryPanelDatasourceV1, libraryPanelDatasourceV1.Indices[1]))
+	mg.AddMigration("fill library_panel_datasource from library panel models", &addLibraryPanelDatasourcesMigration{})
+
+	libraryPanelCleanupPolicyV1 := migrator.Table{
+		Name: "library_panel_cleanup_policy",
+		Columns: []*migrator.Column{
+			{Name: "id", Type: migrator.DB_BigInt, IsPrimaryKey: true, IsAutoIncrement: true},
+			{Name: "org_id", Type: migrator.DB_BigInt, Nullable: false},
+			{Name: "enabled", Type: migrator.DB_Bool, Nullable: false},
+			{Name: "older_than_days", Type: migrator.DB_BigInt, Nullable: false},
+			{Name: "action", Type: migrator.DB_NVarchar, Length: 20, Nullable: false},
+			{Name: "excluded_uids", Type: migrator.DB_Text, Nullable: true},
+			{Name: "created", Type: migrator.DB_DateTime, Nullable: false},
+			{Name: "updated", Type: migrator.DB_DateTime, Nullable: false},
+		},
+		Indices: []*migrator.Index{
+			{Cols: []string{"org_id"}, Type: migrator.UniqueIndex},
+		},
+	}
+
+	mg.AddMigration("create library_panel_cleanup_policy table v1", migrator.NewAddTableMigration(libraryPanelCleanupPolicyV1))
+	mg.AddMigration("add index library_panel_cleanup_policy org_id", migrator.NewAddIndexMigration(libraryPanelCleanupPolicyV1, libraryPanelCleanupPolicyV1.Indices[0]))
+
+	libraryPanelArchiveV1 := migrator.Table{
+		Name: "library_panel_archive",
+		Columns: []*migrator.Column{
+			{Name: "id", Type: migrator.DB_BigInt, IsPrimaryKey: true, IsAutoIncrement: true},
+			{Name: "org_id", Type: migrator.DB_BigInt, Nullable: false},
+			{Name: "folder_id", Type: migrator.DB_BigInt, Nullable: false},
+			{Name: "uid", Type: migrator.DB_NVarchar, Length: 40, Nullable: false},
+			{Name: "name", Type: migrator.DB_NVarchar, Length: 255, Nullable: false},
+			{Name: "model", Type: migrator.DB_MediumText, Nullable: false},
+			{Name: "created", Type: migrator.DB_DateTime, Nullable: false},
+			{Name: "created_by", Type: migrator.DB_BigInt, Nullable: false},
+			{Name: "archived", Type: migrator.DB_DateTime, Nullable: false},
+		},
+		Indices: []*migrator.Index{
+			{Cols: []string{"org_id", "uid"}},
+		},
+	}
+
+	mg.AddMigration("create library_panel_archive table v1", migrator.NewAddTableMigration(libraryPanelArchiveV1))
+	mg.AddMigration("add index library_panel_archive org_id & uid", migrator.NewAddIndexMigration(libraryPanelArchiveV1, libraryPanelArchiveV1.Indices[0]))
+
+	libraryPanelCollectionV1 := migrator.Table{
+		Name: "library_panel_collection",
+		Columns: []*migrator.Column{
+			{Name: "id", Type: migrator.DB_BigInt, IsPrimaryKey: true, IsAutoIncrement: true},
+			{Name: "org_id", Type: migrator.DB_BigInt, Nullable: false},
+			{Name: "uid", Type: migrator.DB_NVarchar, Length: 40, Nullable: false},
+			{Name: "name", Type: migrator.DB_NVarchar, Length: 255, Nullable: false},
+			{Name: "description", Type: migrator.DB_Text, Nullable: true},
+			{Name: "created", Type: migrator.DB_DateTime, Nullable: false},
+			{Name: "created_by", Type: migrator.DB_BigInt, Nullable: false},
+			{Name: "updated", Type: migrator.DB_DateTime, Nullable: false},
+			{Name: "updated_by", Type: migrator.DB_BigInt, Nullable: false},
+		},
+		Indices: []*migrator.Index{
+			{Cols: []string{"org_id", "uid"}, Type: migrator.UniqueIndex},
+			{Cols: []string{"org_id", "name"}, Type: migrator.UniqueIndex},
+		},
+	}
+
+	mg.AddMigration("create library_panel_collection table v1", migrator.NewAddTableMigration(libraryPanelCollectionV1))
+	mg.AddMigration("add index library_panel_collection org_id & uid", migrator.NewAddIndexMigration(libraryPanelCollectionV1, libraryPanelCollectionV1.Indices[0]))
+	mg.AddMigration("add index library_panel_collection org_id & name", migrator.NewAddIndexMigration(libraryPanelCollectionV1, libraryPanelCollectionV1.Indices[1]))
+
+	libraryPanelCollectionMemberV1 := migrator.Table{
+		Name: "library_panel_collection_member",
+		Columns: []*migrator.Column{
+			{Name: "id", Type: migrator.DB_BigInt, IsPrimaryKey: true, IsAutoIncrement: true},
+			{Name: "collection_id", Type: migrator.DB_BigInt, Nullable: false},
+			{Name: "librarypanel_id", Type: migrator.DB_BigInt, Nullable: false},
+			{Name: "position", Type: migrator.DB_BigInt, Nullable: false},
+		},
+		Indices: []*migrator.Index{
+			{Cols: []string{"collection_id", "librarypanel_id"}, Type: migrator.UniqueIndex},
+			{Cols: []string{"librarypanel_id"}},
+		},
+	}
+
+	mg.AddMigration("create library_panel_collection_member table v1", migrator.NewAddTableMigration(libraryPanelCollectionMemberV1))
+	mg.AddMigration("add index library_panel_collection_member collection_id & librarypanel_id", migrator.NewAddIndexMigration(libraryPanelCollectionMemberV1, libraryPanelCollectionMemberV1.Indices[0]))
+	mg.AddMigration("add index library_panel_collection_member librarypanel_id", migrator.NewAddIndexMigration(libraryPanelCollectionMemberV1, libraryPanelCollectionMemberV1.Indices[1]))
+
+	// The catalog is shared by all orgs, org admins install catalog panels into their org.
+	libraryPanelCatalogV1 := migrator.Table{
+		Name: "library_panel_catalog",
+		Columns: []*migrator.Column{
+			{Name: "id", Type: migrator.DB_BigInt, IsPrimaryKey: true, IsAutoIncrement: true},
+			{Name: "uid", Type: migrator.DB_NVarchar, Length: 40, Nullable: false},
+			{Name: "name", Type: migrator.DB_NVarchar, Length: 255, Nullable: false},
+			{Name: "description", Type: migrator.DB_Text, Nullable: true},
+			{Name: "model", Type: migrator.DB_MediumText, Nullable: false},
+			{Name: "created", Type: migrator.DB_DateTime, Nullable: false},
+			{Name: "created_by", Type: migrator.DB_BigInt, Nullable: false},
+			{Name: "updated", Type: migrator.DB_DateTime, Nullable: false},
+			{Name: "updated_by", Type: migrator.DB_BigInt, Nullable: false},
+		},
+		Indices: []*migrator.Index{
+			{Cols: []string{"uid"}, Type: migrator.UniqueIndex},
+			{Cols: []string{"name"}, Type: migrator.UniqueIndex},
+		},
+	}
+
+	mg.AddMigration("create library_panel_catalog table v1", migrator.NewAddTableMigration(libraryPanelCatalogV1))
+	mg.AddMigration("add index library_panel_catalog uid", migrator.NewAddIndexMigration(libraryPanelCatalogV1, libraryPanelCatalogV1.Indices[0]))
+	mg.AddMigration("add index library_panel_catalog name", migrator.NewAddIndexMigration(libraryPanelCatalogV1, libraryPanelCatalogV1.Indices[1]))
+
+	// Library Panels installed as a linked reference follow the model of their catalog panel.
+	mg.AddMigration("add catalog_uid column to library_panel", migrator.NewAddColumnMigration(libraryPanelV1, &migrator.Column{
+		Name: "catalog_uid", Type: migrator.DB_NVarchar, Length: 40, Nullable: false, Default: "''",
+	}))
+	mg.AddMigration("add index library_panel catalog_uid", migrator.NewAddIndexMigration(libraryPanelV1, &migrator.Index{
+		Cols: []string{"catalog_uid"},
+	}))
+
+	libraryPanelGitSyncV1 := migrator.Table{
+		Name: "library_panel_git_sync",
+		Columns: []*migrator.Column{
+			{Name: "id", Type: migrator.DB_BigInt, IsPrimaryKey: true, IsAutoIncrement: true},
+			{Name: "org_id", Type: migrator.DB_BigInt, Nullable: false},
+			{Name: "enabled", Type: migrator.DB_Bool, Nullable: false},
+			{Name: "repository", Type: migrator.DB_NVarchar, Length: 255, Nullable: false},
+			{Name: "branch", Type: migrator.DB_NVarchar, Length: 255, Nullable: false},
+			{Name: "path", Type: migrator.DB_NVarchar, Length: 255, Nullable: false},
+			{Name: "interval_seconds", Type: migrator.DB_BigInt, Nullable: false},
+			{Name: "last_sync", Type: migrator.DB_DateTime, Nullable: true},
+			{Name: "last_commit", Type: migrator.DB_NVarchar, Length: 40, Nullable: true},
+			{Name: "last_error", Type: migrator.DB_Text, Nullable: true},
+			{Name: "created", Type: migrator.DB_DateTime, Nullable: false},
+			{Name: "updated", Type: migrator.DB_DateTime, Nullable: false},
+		},
+		Indices: []*migrator.Index{
+			{Cols: []string{"org_id"}, Type: migrator.UniqueIndex},
+		},
+	}
+
+	mg.AddMigration("create library_panel_git_sync table v1", migrator.NewAddTableMigration(libraryPanelGitSyncV1))
+	mg.AddMigration("add index library_panel_git_sync org_id", migrator.NewAddIndexMigration(libraryPanelGitSyncV1, libraryPanelGitSyncV1.Indices[0]))
+
+	// Library Panels synced from a Git repository are owned by the file they were read from.
+	mg.AddMigration("add sync_path column to library_panel", migrator.NewAddColumnMigration(libraryPanelV1, &migrator.Column{
+		Name: "sync_path", Type: migrator.DB_NVarchar, Length: 255, Nullable: false, Default: "''",
+	}))
+
+	// Library Panels shipped by app plugins are owned by the plugin include they were read from.
+	mg.AddMigration("add plugin_id column to library_panel", migrator.NewAddColumnMigration(libraryPanelV1, &migrator.Column{
+		Name: "plugin_id", Type: migrator.DB_NVarchar, Length: 190, Nullable: false, Default: "''",
+	}))
+	mg.AddMigration("add plugin_path column to library_panel", migrator.NewAddColumnMigration(libraryPanelV1, &migrator.Column{
+		Name: "plugin_path", Type: migrator.DB_NVarchar, Length: 255, Nullable: false, Default: "''",
+	}))
+	mg.AddMigration("add index library_panel org_id & plugin_id", migrator.NewAddIndexMigration(libraryPanelV1, &migrator.Index{
+		Cols: []string{"org_id", "plugin_id"},
+	}))
+
+	mg.AddMigration("add status column to library_panel", migrator.NewAddColumnMigration(libraryPanelV1, &migrator.Column{
+		Name: "status", Type: migrator.DB_NVarchar, Length: 20, Nullable: false, Default: "'published'",
+	}))
+
+	libraryPanelPendingChangeV1 := migrator.Table{
+		Name: "library_panel_pending_change",
+		Columns: []*migrator.Column{
+			{Name: "id", Type: migrator.DB_BigInt, IsPrimaryKey: true, IsAutoIncrement: true},
+			{Name: "org_id", Type: migrator.DB_BigInt, Nullable: false},
+			{Name: "librarypanel_id", Type: migrator.DB_BigInt, Nullable: false},
+			{Name: "command", Type: migrator.DB_MediumText, Nullable: false},
+			{Name: "status", Type: migrator.DB_NVarchar, Length: 20, Nullable: false},
+			{Name: "requested", Type: migrator.DB_DateTime, Nullable: false},
+			{Name: "requested_by", Type: migrator.DB_BigInt, Nullable: false},
+			{Name: "reviewed", Type: migrator.DB_DateTime, Nullable: true},
+			{Name: "reviewed_by", Type: migrator.DB_BigInt, Nullable: true},
+		},
+		Indices: []*migrator.Index{
+			{Cols: []string{"org_id", "status"}},
+			{Cols: []string{"librarypanel_id"}},
+		},
+	}
+
+	mg.AddMigration("create library_panel_pending_change table v1", migrator.NewAddTableMigration(libraryPanelPendingChangeV1))
+	mg.AddMigration("add index library_panel_pending_change org_id & status", migrator.NewAddIndexMigration(libraryPanelPendingChangeV1, libraryPanelPendingChangeV1.Indices[0]))
+	mg.AddMigration("add index library_panel_pending_change librarypanel_id", migrator.NewAddIndexMigration(libraryPanelPendingChangeV1, libraryPanelPendingChangeV1.Indices[1]))
+
+	mg.AddMigration("add deprecated column to library_panel", migrator.NewAddColumnMigration(libraryPanelV1, &migrator.Column{
+		Name: "deprecated", Type: migrator.DB_Bool, Nullable: false, Default: "0",
+	}))
+	mg.AddMigration("add replaced_by column to library_panel", migrator.NewAddColumnMigration(libraryPanelV1, &migrator.Column{
+		Name: "replaced_by", Type: migrator.DB_NVarchar, Length: 40, Nullable: false, Default: "''",
+	}))
+
+	libraryPanelCommentV1 := migrator.Table{
+		Name: "library_panel_comment",
+		Columns: []*migrator.Column{
+			{Name: "id", Type: migrator.DB_BigInt, IsPrimaryKey: true, IsAutoIncrement: true},
+			{Name: "org_id", Type: migrator.DB_BigInt, Nullable: false},
+			{Name: "librarypanel_id", Type: migrator.DB_BigInt, Nullable: false},
+			{Name: "user_id", Type: migrator.DB_BigInt, Nullable: false},
+			{Name: "content", Type: migrator.DB_Text, Nullable: false},
+			{Name: "created", Type: migrator.DB_DateTime, Nullable: false},
+		},
+		Indices: []*migrator.Index{
+			{Cols: []string{"librarypanel_id"}},
+		},
+	}
+
+	mg.AddMigration("create library_panel_comment table v1", migrator.NewAddTableMigration(libraryPanelCommentV1))
+	mg.AddMigration("add index library_panel_comment librarypanel_id", migrator.NewAddIndexMigration(libraryPanelCommentV1, libraryPanelCommentV1.Indices[0]))
+
+	libraryPanelStarV1 := migrator.Table{
+		Name: "library_panel_star",
+		Columns: []*migrator.Column{
+			{Name: "id", Type: migrator.DB_BigInt, IsPrimaryKey: true, IsAutoIncrement: true},
+			{Name: "user_id", Type: migrator.DB_BigInt, Nullable: false},
+			{Name: "librarypanel_id", Type: migrator.DB_BigInt, Nullable: false},
+		},
+		Indices: []*migrator.Index{
+			{Cols: []string{"user_id", "librarypanel_id"}, Type: migrator.UniqueIndex},
+			{Cols: []string{"librarypanel_id"}},
+		},
+	}
+
+	mg.AddMigration("create library_panel_star table v1", migrator.NewAddTableMigration(libraryPanelStarV1))
+	mg.AddMigration("add unique index library_panel_star user_id & librarypanel_id", migrator.NewAddIndexMigration(libraryPanelStarV1, libraryPanelStarV1.Indices[0]))
+	mg.AddMigration("add index library_panel_star librarypanel_id", migrator.NewAddIndexMigration(libraryPanelStarV1, libraryPanelStarV1.Indices[1]))
+
+	mg.AddMigration("add panel_id column to library_panel_dashboard", migrator.NewAddColumnMigration(libraryPanelDashboardV1, &migrator.Column{
+		Name: "panel_id", Type: migrator.DB_BigInt, Nullable: false, Default: "0",
+	}))
+
+	// a dashboard can use the same library panel in several panels
+	mg.AddMigration("drop index library_panel_dashboard librarypanel_id & dashboard_id", migrator.NewDropIndexMigration(libraryPanelDashboardV1, libraryPanelDashboardV1.Indices[0]))
+	mg.AddMigration("add unique index library_panel_dashboard librarypanel_id & dashboard_id & panel_id", migrator.NewAddIndexMigration(libraryPanelDashboardV1, &migrator.Index{
+		Cols: []string{"librarypanel_id", "dashboard_id", "panel_id"}, Type: migrator.UniqueIndex,
+	}))
+
+	libraryPanelNotificationV1 := migrator.Table{
+		Name: "library_panel_notification",
+		Columns: []*migrator.Column{
+			{Name: "id", Type: migrator.DB_BigInt, IsPrimaryKey: true, IsAutoIncrement: true},
+			{Name: "org_id", Type: migrator.DB_BigInt, Nullable: false},
+			{Name: "user_id", Type: migrator.DB_BigInt, Nullable: false},
+			{Name: "librarypanel_id", Type: migrator.DB_BigInt, Nullable: false},
+			{Name: "summary", Type: migrator.DB_Text, Nullable: false},
+			{Name: "seen", Type: migrator.DB_Bool, Nullable: false, Default: "0"},
+			{Name: "created", Type: migrator.DB_DateTime, Nullable: false},
+		},
+		Indices: []*migrator.Index{
+			{Cols: []string{"org_id", "user_id"}},
+			{Cols: []string{"librarypanel_id"}},
+		},
+	}
+
+	mg.AddMigration("create library_panel_notification table v1", migrator.NewAddTableMigration(libraryPanelNotificationV1))
+	mg.AddMigration("add index library_panel_notification org_id & user_id", migrator.NewAddIndexMigration(libraryPanelNotificationV1, libraryPanelNotificationV1.Indices[0]))
+	mg.AddMigration("add index library_panel_notification librarypanel_id", migrator.NewAddIndexMigration(libraryPanelNotificationV1, libraryPanelNotificationV1.Indices[1]))
+
+	libraryPanelNotificationMuteV1 := migrator.Table{
+		Name: "library_panel_notification_mute",
+		Columns: []*migrator.Column{
+			{Name: "id", Type: migrator.DB_BigInt, IsPrimaryKey: true, IsAutoIncrement: true},
+			{Name: "org_id", Type: migrator.DB_BigInt, Nullable: false},
+			{Name: "user_id", Type: migrator.DB_BigInt, Nullable: false},
+			{Name: "librarypanel_id", Type: migrator.DB_BigInt, Nullable: false},
+		},
+		Indices: []*migrator.Index{
+			{Cols: []string{"org_id", "user_id", "librarypanel_id"}, Type: migrator.UniqueIndex},
+		},
+	}
+
+	mg.AddMigration("create library_panel_notification_mute table v1", migrator.NewAddTableMigration(libraryPanelNotificationMuteV1))
+	mg.AddMigration("add unique index library_panel_notification_mute org_id & user_id & librarypanel_id", migrator.NewAddIndexMigration(libraryPanelNotificationMuteV1, libraryPanelNotificationMuteV1.Indices[0]))
+
+	libraryPanelAPIKeyAccessV1 := migrator.Table{
+		Name: "library_panel_api_key_access",
+		Columns: []*migrator.Column{
+			{Name: "id", Type: migrator.DB_BigInt, IsPrimaryKey: true, IsAutoIncrement: true},
+			{Name: "org_id", Type: migrator.DB_BigInt, Nullable: false},
+			{Name: "api_key_id", Type: migrator.DB_BigInt, Nullable: false},
+			{Name: "access", Type: migrator.DB_NVarchar, Length: 20, Nullable: false},
+		},
+		Indices: []*migrator.Index{
+			{Cols: []string{"api_key_id"}, Type: migrator.UniqueIndex},
+		},
+	}
+
+	mg.AddMigration("create library_panel_api_key_access table v1", migrator.NewAddTableMigration(libraryPanelAPIKeyAccessV1))
+	mg.AddMigration("add unique index library_panel_api_key_access api_key_id", migrator.NewAddIndexMigration(libraryPanelAPIKeyAccessV1, libraryPanelAPIKeyAccessV1.Indices[0]))
+
+	// Library Panels are looked up by UID in every request. UIDs are unique per org, so that two Library Panels
+	// created at the same time with the same generated UID can't both be stored.
+	mg.AddMigration("add unique index library_panel org_id & uid", migrator.NewAddIndexMigration(libraryPanelV1, &migrator.Index{
+		Cols: []string{"org_id", "uid"}, Type: migrator.UniqueIndex,
+	}))
+	// The suggestions for the panel picker are filtered and sorted by name.
+	mg.AddMigration("add index library_panel org_id & kind & name", migrator.NewAddIndexMigration(libraryPanelV1, &migrator.Index{
+		Cols: []string{"org_id", "kind", "name"},
+	}))
+
+	libraryPanelThumbnailV1 := migrator.Table{
+		Name: "library_panel_thumbnail",
+		Columns: []*migrator.Column{
+			{Name: "id", Type: migrator.DB_BigInt, IsPrimaryKey: true, IsAutoIncrement: true},
+			{Name: "librarypanel_id", Type: migrator.DB_BigInt, Nullable: false},
+			{Name: "image", Type: migrator.DB_MediumBlob, Nullable: true},
+			{Name: "panel_updated", Type: migrator.DB_DateTime, Nullable: false},
+			{Name: "rendered", Type: migrator.DB_DateTime, Nullable: false},
+		},
+		Indices: []*migrator.Index{
+			{Cols: []string{"librarypanel_id"}, Type: migrator.UniqueIndex},
+		},
+	}
+
+	mg.AddMigration("create library_panel_thumbnail table v1", migrator.NewAddTableMigration(libraryPanelThumbnailV1))
+	mg.AddMigration("add unique index library_panel_thumbnail librarypanel_id", migrator.NewAddIndexMigration(libraryPanelThumbnailV1, libraryPanelThumbnailV1.Indices[0]))
+
+	libraryPanelDependencyV1 := migrator.Table{
+		Name: "library_panel_dependency",
+		Columns: []*migrator.Column{
+			{Name: "id", Type: migrator.DB_BigInt, IsPrimaryKey: true, IsAutoIncrement: true},
+			{Name: "librarypanel_id", Type: migrator.DB_BigInt, Nullable: false},
+			{Name: "dependency_id", Type: migrator.DB_BigInt, Nullable: false},
+		},
+		Indices: []*migrator.Index{
+			{Cols: []string{"librarypanel_id", "dependency_id"}, Type: migrator.UniqueIndex},
+			{Cols: []string{"dependency_id"}},
+		},
+	}
+
+	mg.AddMigration("create library_panel_dependency table v1", migrator.NewAddTableMigration(libraryPanelDependencyV1))
+	mg.AddMigration("add unique index library_panel_dependency librarypanel_id & dependency_id", migrator.NewAddIndexMigration(libraryPanelDependencyV1, libraryPanelDependencyV1.Indices[0]))
+	mg.AddMigration("add index library_panel_dependency dependency_id", migrator.NewAddIndexMigration(libraryPanelDependencyV1, libraryPanelDependencyV1.Indices[1]))
+
+	libraryQueryVersionV1 := migrator.Table{
+		Name: "library_query_version",
+		Columns: []*migrator.Column{
+			{Name: "id", Type: migrator.DB_BigInt, IsPrimaryKey: true, IsAutoIncrement: true},
+			{Name: "librarypanel_id", Type: migrator.DB_BigInt, Nullable: false},
+			{Name: "version", Type: migrator.DB_BigInt, Nullable: false},
+			{Name: "model", Type: migrator.DB_Text, Nullable: false},
+			{Name: "created", Type: migrator.DB_DateTime, Nullable: false},
+			{Name: "created_by", Type: migrator.DB_BigInt, Nullable: false},
+		},
+		Indices: []*migrator.Index{
+			{Cols: []string{"librarypanel_id", "version"}, Type: migrator.UniqueIndex},
+		},
+	}
+
+	mg.AddMigration("create library_query_version table v1", migrator.NewAddTableMigration(libraryQueryVersionV1))
+	mg.AddMigration("add unique index library_query_version librarypanel_id & version", migrator.NewAddIndexMigration(libraryQueryVersionV1, libraryQueryVersionV1.Indices[0]))
+
+	libraryPanelAlertV1 := migrator.Table{
+		Name: "library_panel_alert",
+		Columns: []*migrator.Column{
+			{Name: "id", Type: migrator.DB_BigInt, IsPrimaryKey: true, IsAutoIncrement: true},
+			{Name: "librarypanel_id", Type: migrator.DB_BigInt, Nullable: false},
+			{Name: "alert_id", Type: migrator.DB_BigInt, Nullable: false},
+			{Name: "dashboard_id", Type: migrator.DB_BigInt, Nullable: false},
+			{Name: "panel_id", Type: migrator.DB_BigInt, Nullable: false},
+		},
+		Indices: []*migrator.Index{
+			{Cols: []string{"librarypanel_id", "alert_id"}, Type: migrator.UniqueIndex},
+			{Cols: []string{"dashboard_id"}},
+		},
+	}
+
+	mg.AddMigration("create library_panel_alert table v1", migrator.NewAddTableMigration(libraryPanelAlertV1))
+	mg.AddMigration("add unique index library_panel_alert librarypanel_id & alert_id", migrator.NewAddIndexMigration(libraryPanelAlertV1, libraryPanelAlertV1.Indices[0]))
+	mg.AddMigration("add index library_panel_alert dashboard_id", migrator.NewAddIndexMigration(libraryPanelAlertV1, libraryPanelAlertV1.Indices[1]))
+
+	// Library Panels installed from the community registry keep where they came from, to check for updates.
+	mg.AddMigration("add registry_source column to library_panel", migrator.NewAddColumnMigration(libraryPanelV1, &migrator.Column{
+		Name: "registry_source", Type: migrator.DB_NVarchar, Length: 255, Nullable: false, Default: "''",
+	}))
+	mg.AddMigration("add registry_revision column to library_panel", migrator.NewAddColumnMigration(libraryPanelV1, &migrator.Column{
+		Name: "registry_revision", Type: migrator.DB_BigInt, Nullable: false, Default: "0",
+	}))
+
+	// Replication rules copy a Library Panel into other orgs, the copies are kept in sync with it.
+	libraryPanelReplicationV1 := migrator.Table{
+		Name: "library_panel_replication",
+		Columns: []*migrator.Column{
+			{Name: "id", Type: migrator.DB_BigInt, IsPrimaryKey: true, IsAutoIncrement: true},
+			{Name: "org_id", Type: migrator.DB_BigInt, Nullable: false},
+			{Name: "librarypanel_id", Type: migrator.DB_BigInt, Nullable: false},
+			{Name: "target_org_id", Type: migrator.DB_BigInt, Nullable: false},
+			{Name: "created", Type: migrator.DB_DateTime, Nullable: false},
+			{Name: "created_by", Type: migrator.DB_BigInt, Nullable: false},
+		},
+		Indices: []*migrator.Index{
+			{Cols: []string{"librarypanel_id", "target_org_id"}, Type: migrator.UniqueIndex},
+		},
+	}
+
+	mg.AddMigration("create library_panel_replication table v1", migrator.NewAddTableMigration(libraryPanelReplicationV1))
+	mg.AddMigration("add unique index library_panel_replication librarypanel_id & target_org_id", migrator.NewAddIndexMigration(libraryPanelReplicationV1, libraryPanelReplicationV1.Indices[0]))
+	mg.AddMigration("add replica_of column to library_panel", migrator.NewAddColumnMigration(libraryPanelV1, &migrator.Column{
+		Name: "replica_of", Type: migrator.DB_BigInt, Nullable: false, Default: "0",
+	}))
+	mg.AddMigration("add index library_panel replica_of", migrator.NewAddIndexMigration(libraryPanelV1, &migrator.Index{
+		Cols: []string{"replica_of"},
+	}))
+
+	// the hash of Library Panels stored before is computed when they're read, until their model changes
+	mg.AddMigration("add model_hash column to library_panel", migrator.NewAddColumnMigration(libraryPanelV1, &migrator.Column{
+		Name: "model_hash", Type: migrator.DB_Char, Length: 64, Nullable: false, Default: "''",
+	}))
+
+	mg.AddMigration("add pinned column to library_panel", migrator.NewAddColumnMigration(libraryPanelV1, &migrator.Column{
+		Name: "pinned", Type: migrator.DB_Bool, Nullable: false, Default: "0",
+	}))
+
+	libraryPanelScheduledChangeV1 := migrator.Table{
+		Name: "library_panel_scheduled_change",
+		Columns: []*migrator.Column{
+			{Name: "id", Type: migrator.DB_BigInt, IsPrimaryKey: true, IsAutoIncrement: true},
+			{Name: "org_id", Type: migrator.DB_BigInt, Nullable: false},
+			{Name: "librarypanel_id", Type: migrator.DB_BigInt, Nullable: false},
+			{Name: "command", Type: migrator.DB_MediumText, Nullable: false},
+			{Name: "effective_at", Type: migrator.DB_DateTime, Nullable: false},
+			{Name: "status", Type: migrator.DB_NVarchar, Length: 20, Nullable: false},
+			{Name: "error", Type: migrator.DB_Text, Nullable: true},
+			{Name: "created", Type: migrator.DB_DateTime, Nullable: false},
+			{Name: "created_by", Type: migrator.DB_BigInt, Nullable: false},
+			{Name: "published", Type: migrator.DB_DateTime, Nullable: true},
+		},
+		Indices: []*migrator.Index{
+			{Cols: []string{"status", "effective_at"}},
+			{Cols: []string{"librarypanel_id"}},
+		},
+	}
+
+	mg.AddMigration("create library_panel_scheduled_change table v1", migrator.NewAddTableMigration(libraryPanelScheduledChangeV1))
+	mg.AddMigration("add index library_panel_scheduled_change status & effective_at", migrator.NewAddIndexMigration(libraryPanelScheduledChangeV1, libraryPanelScheduledChangeV1.Indices[0]))
+	mg.AddMigration("add index library_panel_scheduled_change librarypanel_id", migrator.NewAddIndexMigration(libraryPanelScheduledChangeV1, libraryPanelScheduledChangeV1.Indices[1]))
+
+	libraryPanelVariantV1 := migrator.Table{
+		Name: "library_panel_variant",
+		Columns: []*migrator.Column{
+			{Name: "id", Type: migrator.DB_BigInt, IsPrimaryKey: true, IsAutoIncrement: true},
+			{Name: "org_id", Type: migrator.DB_BigInt, Nullable: false},
+			{Name: "librarypanel_id", Type: migrator.DB_BigInt, Nullable: false},
+			{Name: "model", Type: migrator.DB_MediumText, Nullable: false},
+			{Name: "percentage", Type: migrator.DB_Int, Nullable: false},
+			{Name: "created", Type: migrator.DB_DateTime, Nullable: false},
+			{Name: "updated", Type: migrator.DB_DateTime, Nullable: false},
+			{Name: "updated_by", Type: migrator.DB_BigInt, Nullable: false},
+		},
+		Indices: []*migrator.Index{
+			{Cols: []string{"librarypanel_id"}, Type: migrator.UniqueIndex},
+		},
+	}
+
+	mg.AddMigration("create library_panel_variant table v1", migrator.NewAddTableMigration(libraryPanelVariantV1))
+	mg.AddMigration("add unique index library_panel_variant librarypanel_id", migrator.NewAddIndexMigration(libraryPanelVariantV1, libraryPanelVariantV1.Indices[0]))
+
+	libraryPanelVariantTeamV1 := migrator.Table{
+		Name: "library_panel_variant_team",
+		Columns: []*migrator.Column{
+			{Name: "id", Type: migrator.DB_BigInt, IsPrimaryKey: true, IsAutoIncrement: true},
+			{Name: "librarypanel_id", Type: migrator.DB_BigInt, Nullable: false},
+			{Name: "team_id", Type: migrator.DB_BigInt, Nullable: false},
+		},
+		Indices: []*migrator.Index{
+			{Cols: []string{"librarypanel_id", "team_id"}, Type: migrator.UniqueIndex},
+		},
+	}
+
+	mg.AddMigration("create library_panel_variant_team table v1", migrator.NewAddTableMigration(libraryPanelVariantTeamV1))
+	mg.AddMigration("add unique index library_panel_variant_team librarypanel_id & team_id", migrator.NewAddIndexMigration(libraryPanelVariantTeamV1, libraryPanelVariantTeamV1.Indices[0]))
+
+	mg.AddMigration("add owner_team_id column to library_panel", migrator.NewAddColumnMigration(libraryPanelV1, &migrator.Column{
+		Name: "owner_team_id", Type: migrator.DB_BigInt, Nullable: false, Default: "0",
+	}))
+	mg.AddMigration("add index library_panel org_id & owner_team_id", migrator.NewAddIndexMigration(libraryPanelV1, &migrator.Index{
+		Cols: []string{"org_id", "owner_team_id"},
+	}))
+
+	libraryPanelEditSuggestionV1 := migrator.Table{
+		Name: "library_panel_edit_suggestion",
+		Columns: []*migrator.Column{
+			{Name: "id", Type: migrator.DB_BigInt, IsPrimaryKey: true, IsAutoIncrement: true},
+			{Name: "org_id", Type: migrator.DB_BigInt, Nullable: false},
+			{Name: "librarypanel_id", Type: migrator.DB_BigInt, Nullable: false},
+			{Name: "model", Type: migrator.DB_MediumText, Nullable: false},
+			{Name: "comment", Type: migrator.DB_Text, Nullable: false},
+			{Name: "status", Type: migrator.DB_NVarchar, Length: 20, Nullable: false},
+			{Name: "created", Type: migrator.DB_DateTime, Nullable: false},
+			{Name: "created_by", Type: migrator.DB_BigInt, Nullable: false},
+			{Name: "reviewed", Type: migrator.DB_DateTime, Nullable: true},
+			{Name: "reviewed_by", Type: migrator.DB_BigInt, Nullable: true},
+		},
+		Indices: []*migrator.Index{
+			{Cols: []string{"librarypanel_id", "status"}},
+		},
+	}
+
+	mg.AddMigration("create library_panel_edit_suggestion table v1", migrator.NewAddTableMigration(libraryPanelEditSuggestionV1))
+	mg.AddMigration("add index library_panel_edit_suggestion librarypanel_id & status", migrator.NewAddIndexMigration(libraryPanelEditSuggestionV1, libraryPanelEditSuggestionV1.Indices[0]))
+
+	// The changes of the feed aren't deleted with the Library Panel, they keep its UID and name.
+	libraryPanelChangeV1 := migrator.Table{
+		Name: "library_panel_change",
+		Columns: []*migrator.Column{
+			{Name: "id", Type: migrator.DB_BigInt, IsPrimaryKey: true, IsAutoIncrement: true},
+			{Name: "org_id", Type: migrator.DB_BigInt, Nullable: false},
+			{Name: "folder_id", Type: migrator.DB_BigInt, Nullable: false},
+			{Name: "librarypanel_uid", Type: migrator.DB_NVarchar, Length: 40, Nullable: false},
+			{Name: "name", Type: migrator.DB_NVarchar, Length: 255, Nullable: false},
+			{Name: "kind", Type: migrator.DB_BigInt, Nullable: false},
+			{Name: "action", Type: migrator.DB_NVarchar, Length: 20, Nullable: false},
+			{Name: "user_id", Type: migrator.DB_BigInt, Nullable: false},
+			{Name: "created", Type: migrator.DB_DateTime, Nullable: false},
+		},
+		Indices: []*migrator.Index{
+			{Cols: []string{"org_id", "created"}},
+			{Cols: []string{"created"}},
+		},
+	}
+
+	mg.AddMigration("create library_panel_change table v1", migrator.NewAddTableMigration(libraryPanelChangeV1))
+	mg.AddMigration("add index library_panel_change org_id & created", migrator.NewAddIndexMigration(libraryPanelChangeV1, libraryPanelChangeV1.Indices[0]))
+	mg.AddMigration("add index library_panel_change created", migrator.NewAddIndexMigration(libraryPanelChangeV1, libraryPanelChangeV1.Indices[1]))
+
+	libraryPanelDuplicateV1 := migrator.Table{
+		Name: "library_panel_duplicate",
+		Columns: []*migrator.Column{
+			{Name: "id", Type: migrator.DB_BigInt, IsPrimaryKey: true, IsAutoIncrement: true},
+			{Name: "org_id", Type: migrator.DB_BigInt, Nullable: false},
+			{Name: "librarypanel_id", Type: migrator.DB_BigInt, Nullable: false},
+			{Name: "similarity_hash", Type: migrator.DB_NVarchar, Length: 64, Nullable: false},
+			{Name: "checked", Type: migrator.DB_DateTime, Nullable: false},
+		},
+		Indices: []*migrator.Index{
+			{Cols: []string{"org_id", "similarity_hash"}},
+			{Cols: []string{"librarypanel_id"}},
+		},
+	}
+
+	mg.AddMigration("create library_panel_duplicate table v1", migrator.NewAddTableMigration(libraryPanelDuplicateV1))
+	mg.AddMigration("add index library_panel_duplicate org_id & similarity_hash", migrator.NewAddIndexMigration(libraryPanelDuplicateV1, libraryPanelDuplicateV1.Indices[0]))
+	mg.AddMigration("add index library_panel_duplicate librarypanel_id", migrator.NewAddIndexMigration(libraryPanelDuplicateV1, libraryPanelDuplicateV1.Indices[1]))
+
+	mg.AddMigration("add merged_into_uid column to library_panel_change", migrator.NewAddColumnMigration(libraryPanelChangeV1, &migrator.Column{
+		Name: "merged_into_uid", Type: migrator.DB_NVarchar, Length: 40, Nullable: true,
+	}))
+
+	libraryPanelTranslationV1 := migrator.Table{
+		Name: "library_panel_translation",
+		Columns: []*migrator.Column{
+			{Name: "id", Type: migrator.DB_BigInt, IsPrimaryKey: true, IsAutoIncrement: true},
+			{Name: "librarypanel_id", Type: migrator.DB_BigInt, Nullable: false},
+			{Name: "locale", Type: migrator.DB_NVarchar, Length: 20, Nullable: false},
+			{Name: "name", Type: migrator.DB_NVarchar, Length: 255, Nullable: false},
+			{Name: "description", Type: migrator.DB_Text, Nullable: false},
+			{Name: "updated", Type: migrator.DB_DateTime, Nullable: false},
+			{Name: "updated_by", Type: migrator.DB_BigInt, Nullable: false},
+		},
+		Indices: []*migrator.Index{
+			{Cols: []string{"librarypanel_id", "locale"}, Type: migrator.UniqueIndex},
+		},
+	}
+
+	mg.AddMigration("create library_panel_translation table v1", migrator.NewAddTableMigration(libraryPanelTranslationV1))
+	mg.AddMigration("add unique index library_panel_translation librarypanel_id & locale", migrator.NewAddIndexMigration(libraryPanelTranslationV1, libraryPanelTranslationV1.Indices[0]))
+
+	// connections were not checked to be in the org of the Library Panel before
+	mg.AddMigration("delete library_panel_dashboard connections to dashboards of other orgs", migrator.NewRawSQLMigration(deleteCrossOrgConnectionsSQL))
+
+	libraryPanelVariableDefaultsV1 := migrator.Table{
+		Name: "library_panel_variable_defaults",
+		Columns: []*migrator.Column{
+			{Name: "id", Type: migrator.DB_BigInt, IsPrimaryKey: true, IsAutoIncrement: true},
+			{Name: "org_id", Type: migrator.DB_BigInt, Nullable: false},
+			{Name: "variables", Type: migrator.DB_Text, Nullable: true},
+			{Name: "updated", Type: migrator.DB_DateTime, Nullable: false},
+			{Name: "updated_by", Type: migrator.DB_BigInt, Nullable: false},
+		},
+		Indices: []*migrator.Index{
+			{Cols: []string{"org_id"}, Type: migrator.UniqueIndex},
+		},
+	}
+
+	mg.AddMigration("create library_panel_variable_defaults table v1", migrator.NewAddTableMigration(libraryPanelVariableDefaultsV1))
+	mg.AddMigration("add index library_panel_variable_defaults org_id", migrator.NewAddIndexMigration(libraryPanelVariableDefaultsV1, libraryPanelVariableDefaultsV1.Indices[0]))
+
+	// The Library Panel updates waiting to be propagated to the connected dashboards.
+	libraryPanelPropagationV1 := migrator.Table{
+		Name: "library_panel_propagation",
+		Columns: []*migrator.Column{
+			{Name: "id", Type: migrator.DB_BigInt, IsPrimaryKey: true, IsAutoIncrement: true},
+			{Name: "org_id", Type: migrator.DB_BigInt, Nullable: false},
+			{Name: "uid", Type: migrator.DB_NVarchar, Length: 40, Nullable: false},
+			{Name: "queued", Type: migrator.DB_BigInt, Nullable: false},
+			{Name: "claimed_at", Type: migrator.DB_BigInt, Nullable: false},
+		},
+		Indices: []*migrator.Index{
+			{Cols: []string{"org_id", "uid"}, Type: migrator.UniqueIndex},
+		},
+	}
+
+	mg.AddMigration("create library_panel_propagation table v1", migrator.NewAddTableMigration(libraryPanelPropagationV1))
+	mg.AddMigration("add unique index library_panel_propagation org_id & uid", migrator.NewAddIndexMigration(libraryPanelPropagationV1, libraryPanelPropagationV1.Indices[0]))
+}
+
+// LoadLibraryPanelsForDashboard replaces the library row, library panel, library variable, library fragment,
+// library query and library transformation references in the dashboard with the stored models, and records that the library elements were viewed.
+// Library panels with an experimental variant are replaced with the variant the user gets, and the placeholders in
+// Library Panel models of the variable defaults of the org are replaced, unless the dashboard defines the variable. Dashboards loaded by
+// anonymous viewers are resolved by LoadLibraryPanelsForDashboardAccess.
+func (lps *LibraryPanelService) LoadLibraryPanelsForDashboard(c *models.ReqContext, dash *models.Dashboard) error {
+	if c.SignedInUser == nil || c.SignedInUser.IsAnonymous {
+		return lps.LoadLibraryPanelsForDashboardAccess(dash, c.SignedInUser)
+	}
+
+	return lps.loadLibraryPanelsForDashboard(c.SignedInUser.OrgId, c.SignedInUser, dash)
+}
+
+// LoadLibraryPanelsForDashboardAccess replaces the library element references in a stored dashboard like
+// LoadLibraryPanelsForDashboard, for a viewer that was granted access to the dashboard rather than to its org, like
+// an anonymous viewer. The references are only resolved to the library elements of the org of the dashboard. The
+// viewer, which can be nil, only decides the variants of Library Panels with an experimental variant.
+func (lps *LibraryPanelService) LoadLibraryPanelsForDashboardAccess(dash *models.Dashboard, viewer *models.SignedInUser) error {
+	if dash.OrgId == 0 {
+		return errLibraryPanelDashboardOrgRequired
+	}
+
+	return lps.loadLibraryPanelsForDashboard(dash.OrgId, viewer, dash)
+}
+
+func (lps *LibraryPanelService) loadLibraryPanelsForDashboard(orgID int64, viewer *models.SignedInUser, dash *models.Dashboard) error {
+	// rows are expanded first, since the panels of a library row can reference library panels
+	libraryRows, err := lps.expandLibraryRows(orgID, dash.Data)
+	if err != nil {
+		return err
+	}
+	panelReferences := getLibraryPanelReferences(dash.Data)
+	panelUIDs := make([]string, 0, len(panelReferences))
+	for uid := range panelReferences {
+		panelUIDs = append(panelUIDs, uid)
+	}
+	variants, err := lps.getLibraryPanelVariantsByUIDs(orgID, panelUIDs)
+	if err != nil {
+		return err
+	}
+	variables, err := lps.getOrgVariables(orgID, dash.Data)
+	if err != nil {
+		return err
+	}
+	libraryPanels, err := lps.resolveLibraryElements(orgID, panelElement, panelReferences,
+		substitutingResolver(variables, lps.variantResolver(viewer, variants)))
+	if err != nil {
+		return err
+	}
+	libraryVariables, err := lps.resolveLibraryElements(orgID, variableElement, getLibraryVariableReferences(dash.Data), resolveLibraryVariable)
+	if err != nil {
+		return err
+	}
+	libraryFragments, err := lps.resolveLibraryFragments(orgID, dash.Data.Interface())
+	if err != nil {
+		return err
+	}
+	libraryQueries, err := lps.resolveLibraryQueries(orgID, dash.Data.Interface())
+	if err != nil {
+		return err
+	}
+	libraryTransformations, err := lps.resolveLibraryTransformations(orgID, dash.Data.Interface())
+	if err != nil {
+		return err
+	}
+
+	viewed := append(append(append(append(append(libraryRows, libraryPanels...), libraryVariables...), libraryFragments...),
+		libraryQueries...), libraryTransformations...)
+	lps.recordLibraryPanelViews(orgID, viewed)
+
+	return nil
+}
+
+// resolveLibraryElements resolves the references, grouped by UID, to library elements of the given kind
+// and returns the library elements that were found.
+func (lps *LibraryPanelService) resolveLibraryElements(orgID int64, kind libraryElementKind, references map[string][]*simplejson.Json,
+	resolve func(*simplejson.Json, LibraryPanel) error) ([]LibraryPanel, error) {
+	if len(references) == 0 {
+		return nil, nil
+	}
+
+	uids := make([]string, 0, len(references))
+	for uid := range references {
+		uids = append(uids, uid)
+	}
+
+	elements, err := lps.getLibraryPanelsByUIDs(orgID, kind, uids)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, element := range elements {
+		for _, reference := range references[element.UID] {
+			if err := resolve(reference, element); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return elements, nil
+}
+
+// getLibraryVariableReferences returns the template variables in the dashboard that reference a library
+// variable, grouped by library variable UID.
+func getLibraryVariableReferences(dashboard *simplejson.Json) map[string][]*simplejson.Json {
+	references := make(map[string][]*simplejson.Json)
+	if dashboard == nil {
+		return references
+	}
+
+	for _, item := range dashboard.Get("templating").Get("list").MustArray() {
+		variable := simplejson.NewFromAny(item)
+		if uid := variable.Get("libraryVariable").Get("uid").MustString(); uid != "" {
+			references[uid] = append(references[uid], variable)
+		}
+	}
+
+	return references
+}
+
+// resolveLibraryVariable replaces the template variable with the library variable model, keeping
+// the value that is selected in the dashboard.
+func resolveLibraryVariable(variable *simplejson.Json, libraryVariable LibraryPanel) error {
+	return replaceWithModel(variable, libraryVariable.Model, []string{"current"}, "libraryVariable", libraryVariable)
+}
+
+// getLibraryPanelReferences returns the panels in the dashboard, including panels in collapsed rows,
+// that reference a library panel, grouped by library panel UID.
+func getLibraryPanelReferences(dashboard *simplejson.Json) map[string][]*simplejson.Json {
+	references := make(map[string][]*simplejson.Json)
+	if dashboard == nil {
+		return references
+	}
+
+	var collect func(panels []interface{})
+	collect = func(panels []interface{}) {
+		for i := range panels {
+			panel := simplejson.NewFromAny(panels[i])
+			if uid := panel.Get("libraryPanel").Get("uid").MustString(); uid != "" {
+				references[uid] = append(references[uid], panel)
+			}
+			collect(panel.Get("panels").MustArray())
+		}
+	}
+	collect(dashboard.Get("panels").MustArray())
+
+	return references
+}
+
+// resolveLibraryPanel replaces the panel with the library panel model, keeping the
+// properties that belong to the panel's placement in the dashboard.
+func resolveLibraryPanel(panel *simplejson.Json, libraryPanel LibraryPanel) error {
+	return replaceWithModel(panel, libraryPanel.Model, []string{"id", "gridPos"}, "libraryPanel", libraryPanel)
+}
+
+// replaceWithModel replaces the properties of the dashboard object with the library element model, except for
+// the ones to keep, and stores the reference to the library element under referenceKey.
+func replaceWithModel(object *simplejson.Json, elementModel json.RawMessage, keepKeys []string, referenceKey string, element LibraryPanel) error {
+	model, err := simplejson.NewJson(elementModel)
+	if err != nil {
+		return err
+	}
+
+	keep := map[string]interface{}{}
+	for _, key := range keepKeys {
+		if value, ok := object.CheckGet(key); ok {
+			keep[key] = value.Interface()
+		}
+	}
+
+	for key := range object.MustMap() {
+		object.Del(key)
+	}
+	for key, value := range model.MustMap() {
+		object.Set(key, value)
+	}
+	for key, value := range keep {
+		object.Set(key, value)
+	}
+	object.Set(referenceKey, map[string]interface{}{
+		"uid":  element.UID,
+		"name": element.Name,
+	})
+
+	return nil
 }
@@ -0,0 +1,69 @@
+package librarypanels
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/grafana/pkg/components/simplejson"
+	"github.com/grafana/grafana/pkg/events"
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/sqlstore"
+)
+
+func TestLibraryPanelAlertRules(t *testing.T) {
+	testScenario(t, "When alert rules are created from a library panel, they should be listed and block deleting it",
+		func(t *testing.T, sc scenarioContext) {
+			existing := createLibraryPanel(t, sc, getCreateCommand(1, "Text - Library Panel"))
+			dash := saveTestDashboard(t, `{ "title": "Alerting", "panels": [
+				{ "id": 1, "libraryPanel": { "uid": "`+existing.UID+`" }, "alert": { "name": "Library alert" } },
+				{ "id": 2, "type": "graph", "alert": { "name": "Other alert" } }
+			] }`)
+			var alertID int64
+			err := sc.service.SQLStore.WithDbSession(context.Background(), func(session *sqlstore.DBSession) error {
+				for _, panelID := range []int64{1, 2} {
+					alert := models.Alert{OrgId: 1, DashboardId: dash.Id, PanelId: panelID, Name: "Alert on panel",
+						Settings: simplejson.New(), State: models.AlertStateOK, Created: time.Now(), Updated: time.Now(), NewStateDate: time.Now()}
+					if _, err := session.Insert(&alert); err != nil {
+						return err
+					}
+					if panelID == 1 {
+						alertID = alert.Id
+					}
+				}
+				return nil
+			})
+			require.NoError(t, err)
+
+			err = sc.service.handleDashboardAlertsSaved(&events.DashboardAlertsSaved{OrgId: 1, DashboardId: dash.Id})
+			require.NoError(t, err)
+
+			sc.reqContext.ReplaceAllParams(map[string]string{":uid": existing.UID})
+			response := sc.service.getHandler(sc.reqContext)
+			require.Equal(t, 200, response.Status())
+			var result struct {
+				Result struct {
+					Meta libraryPanelMeta
+				} `json:"result"`
+			}
+			err = json.Unmarshal(response.Body(), &result)
+			require.NoError(t, err)
+			require.Equal(t, []libraryPanelAlertRule{{
+				ID: alertID, Name: "Alert on panel", State: string(models.AlertStateOK), DashboardID: dash.Id, DashboardUID: dash.Uid, PanelID: 1,
+			}}, result.Result.Meta.Alerts)
+
+			response = sc.service.deleteHandler(sc.reqContext)
+			requireErrorCode(t, response, 409, errorCodeHasConnections)
+
+			err = sc.service.SQLStore.WithDbSession(context.Background(), func(session *sqlstore.DBSession) error {
+				_, err := session.Exec("DELETE FROM alert WHERE id=?", alertID)
+				return err
+			})
+			require.NoError(t, err)
+			response = sc.service.deleteHandler(sc.reqContext)
+			require.Equal(t, 200, response.Status())
+		})
+}
@@ -0,0 +1,65 @@
+package librarypanels
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/grafana/pkg/components/simplejson"
+	"github.com/grafana/grafana/pkg/models"
+)
+
+func TestLoadLibraryPanelsForDashboardAccess(t *testing.T) {
+	testScenario(t, "When an anonymous viewer loads a dashboard, the library panels of the dashboard's org should be used",
+		func(t *testing.T, sc scenarioContext) {
+			existing := createLibraryPanel(t, sc, getCreateCommand(1, "Text - Library Panel"))
+
+			for _, viewer := range []*models.SignedInUser{{IsAnonymous: true, OrgId: 1, OrgRole: models.ROLE_VIEWER}, nil} {
+				sc.reqContext.SignedInUser = viewer
+				dash := getDashboardWithLibraryPanels(t, existing.UID, "unknown")
+				dash.OrgId = 1
+				err := sc.service.LoadLibraryPanelsForDashboard(sc.reqContext, dash)
+				require.NoError(t, err)
+
+				resolved := simplejson.NewFromAny(dash.Data.Get("panels").MustArray()[0])
+				require.Equal(t, "text", resolved.Get("type").MustString())
+				require.Equal(t, existing.UID, resolved.Get("libraryPanel").Get("uid").MustString())
+			}
+		})
+
+	testScenario(t, "When a dashboard is loaded by dashboard access, library panels of other orgs should not be used",
+		func(t *testing.T, sc scenarioContext) {
+			existing := createLibraryPanel(t, sc, getCreateCommand(1, "Text - Library Panel"))
+
+			dash := getDashboardWithLibraryPanels(t, existing.UID, "unknown")
+			dash.OrgId = 2
+			err := sc.service.LoadLibraryPanelsForDashboardAccess(dash, &models.SignedInUser{IsAnonymous: true, OrgId: 1})
+			require.NoError(t, err)
+
+			unresolved := simplejson.NewFromAny(dash.Data.Get("panels").MustArray()[0])
+			require.Empty(t, unresolved.Get("type").MustString())
+			require.Equal(t, "old name", unresolved.Get("libraryPanel").Get("name").MustString())
+
+			err = sc.service.LoadLibraryPanelsForDashboardAccess(getDashboardWithLibraryPanels(t, existing.UID, "unknown"), nil)
+			require.Equal(t, errLibraryPanelDashboardOrgRequired, err)
+		})
+
+	testScenario(t, "When a viewer without a user loads a dashboard, library panel variants should be served by percentage",
+		func(t *testing.T, sc scenarioContext) {
+			existing := createLibraryPanel(t, sc, getCreateCommand(1, "Text - Library Panel"))
+			_, err := sc.service.setLibraryPanelVariant(sc.reqContext, existing.UID, setLibraryPanelVariantCommand{
+				Model:      []byte(`{ "type": "graph", "title": "Experimental" }`),
+				Percentage: 100,
+			})
+			require.NoError(t, err)
+
+			dash := getDashboardWithLibraryPanels(t, existing.UID, "unknown")
+			dash.OrgId = 1
+			err = sc.service.LoadLibraryPanelsForDashboardAccess(dash, nil)
+			require.NoError(t, err)
+
+			resolved := simplejson.NewFromAny(dash.Data.Get("panels").MustArray()[0])
+			require.Equal(t, "graph", resolved.Get("type").MustString())
+			require.Equal(t, variantExperimental, resolved.Get("libraryPanel").Get("variant").MustString())
+		})
+}
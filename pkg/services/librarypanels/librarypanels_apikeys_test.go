@@ -0,0 +1,80 @@
+package librarypanels
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/macaron.v1"
+
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/models"
+)
+
+func TestLibraryPanelAPIKeys(t *testing.T) {
+	testScenario(t, "When an API key has read only access, it should not be able to change library panels",
+		func(t *testing.T, sc scenarioContext) {
+			apiKey := models.AddApiKeyCommand{Name: "Provisioning", Role: models.ROLE_EDITOR, OrgId: 1, Key: "secret"}
+			err := bus.Dispatch(&apiKey)
+			require.NoError(t, err)
+
+			apiKeyUser := &models.SignedInUser{OrgId: 1, OrgRole: models.ROLE_EDITOR, ApiKeyId: apiKey.Result.Id}
+			m := macaron.New()
+			m.Use(macaron.Renderer(macaron.RenderOptions{
+				Directory: "",
+				Delims:    macaron.Delims{Left: "[[", Right: "]]"},
+			}))
+			m.Any("/api/library-panels", func(c *macaron.Context) {
+				sc.service.checkAPIKeyAccess(&models.ReqContext{Context: c, SignedInUser: apiKeyUser})
+			})
+			request := func(method string) int {
+				recorder := httptest.NewRecorder()
+				m.ServeHTTP(recorder, httptest.NewRequest(method, "/api/library-panels", nil))
+				return recorder.Code
+			}
+
+			// API keys without access have write access
+			require.Equal(t, 200, request("POST"))
+
+			sc.reqContext.ReplaceAllParams(map[string]string{":id": strconv.FormatInt(apiKey.Result.Id, 10)})
+			response := sc.service.setAPIKeyAccessHandler(sc.reqContext, setAPIKeyAccessCommand{Access: "admin"})
+			require.Equal(t, 400, response.Status())
+			response = sc.service.setAPIKeyAccessHandler(sc.reqContext, setAPIKeyAccessCommand{Access: apiKeyAccessRead})
+			require.Equal(t, 200, response.Status())
+
+			require.Equal(t, 200, request("GET"))
+			require.Equal(t, 403, request("POST"))
+			require.Equal(t, 403, request("DELETE"))
+
+			response = sc.service.getAPIKeyAccessesHandler(sc.reqContext)
+			require.Equal(t, 200, response.Status())
+			var result struct {
+				Result []apiKeyAccess `json:"result"`
+			}
+			err = json.Unmarshal(response.Body(), &result)
+			require.NoError(t, err)
+			require.Equal(t, []apiKeyAccess{{APIKeyID: apiKey.Result.Id, Name: "Provisioning", Access: apiKeyAccessRead}}, result.Result)
+
+			response = sc.service.deleteAPIKeyAccessHandler(sc.reqContext)
+			require.Equal(t, 200, response.Status())
+			require.Equal(t, 200, request("POST"))
+			response = sc.service.deleteAPIKeyAccessHandler(sc.reqContext)
+			require.Equal(t, 404, response.Status())
+
+			sc.reqContext.ReplaceAllParams(map[string]string{":id": "-1"})
+			response = sc.service.setAPIKeyAccessHandler(sc.reqContext, setAPIKeyAccessCommand{Access: apiKeyAccessRead})
+			require.Equal(t, 404, response.Status())
+		})
+
+	testScenario(t, "When an API key stars a library panel, it should fail because there is no user",
+		func(t *testing.T, sc scenarioContext) {
+			existing := createLibraryPanel(t, sc, getCreateCommand(0, "CPU"))
+
+			sc.reqContext.SignedInUser = &models.SignedInUser{OrgId: 1, OrgRole: models.ROLE_ADMIN, ApiKeyId: 1}
+			sc.reqContext.ReplaceAllParams(map[string]string{":uid": existing.UID})
+			response := sc.service.starHandler(sc.reqContext)
+			require.Equal(t, 403, response.Status())
+		})
+}
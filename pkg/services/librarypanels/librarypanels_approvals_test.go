@@ -0,0 +1,95 @@
+package librarypanels
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/grafana/pkg/models"
+)
+
+func TestLibraryPanelApprovals(t *testing.T) {
+	testScenario(t, "When an editor changes the model of a widely used library panel, an admin should approve the change",
+		func(t *testing.T, sc scenarioContext) {
+			sc.service.Cfg.LibraryPanels.ApprovalThreshold = 1
+			existing := createLibraryPanel(t, sc, getCreateCommand(0, "Widely used"))
+			for _, dashboardID := range saveTestDashboards(t, 2) {
+				err := sc.service.connectDashboard(sc.reqContext, existing.UID, dashboardID, 0)
+				require.NoError(t, err)
+			}
+
+			admin := sc.reqContext.SignedInUser
+			sc.reqContext.SignedInUser = &models.SignedInUser{UserId: 2, OrgId: 1, OrgRole: models.ROLE_EDITOR}
+			sc.reqContext.ReplaceAllParams(map[string]string{":uid": existing.UID})
+			response := sc.service.patchHandler(sc.reqContext, patchLibraryPanelCommand{Model: []byte(`{ "type": "graph" }`)})
+			require.Equal(t, 202, response.Status())
+			var pending struct {
+				Result libraryPanelPendingChange `json:"result"`
+			}
+			err := json.Unmarshal(response.Body(), &pending)
+			require.NoError(t, err)
+			require.Equal(t, pendingChangeStatusPending, pending.Result.Status)
+
+			// the stored model is unchanged until the change is approved
+			panel, err := sc.service.getLibraryPanel(sc.reqContext, existing.UID)
+			require.NoError(t, err)
+			require.JSONEq(t, `{ "datasource": "${DS_GDEV-TESTDATA}", "name": "Text - Library Panel", "type": "text" }`, string(panel.Model))
+
+			// changes that don't touch the model are applied directly
+			response = sc.service.patchHandler(sc.reqContext, patchLibraryPanelCommand{Name: "Renamed"})
+			require.Equal(t, 200, response.Status())
+
+			sc.reqContext.SignedInUser = admin
+			response = sc.service.getPendingChangesHandler(sc.reqContext)
+			require.Equal(t, 200, response.Status())
+			var changes struct {
+				Result []libraryPanelPendingChange `json:"result"`
+			}
+			err = json.Unmarshal(response.Body(), &changes)
+			require.NoError(t, err)
+			require.Len(t, changes.Result, 1)
+			require.Equal(t, existing.UID, changes.Result[0].LibraryPanelUID)
+			require.Equal(t, int64(2), changes.Result[0].RequestedBy)
+
+			sc.reqContext.ReplaceAllParams(map[string]string{":id": "1"})
+			response = sc.service.approvePendingChangeHandler(sc.reqContext)
+			require.Equal(t, 200, response.Status())
+			response = sc.service.rejectPendingChangeHandler(sc.reqContext)
+			require.Equal(t, 404, response.Status())
+
+			panel, err = sc.service.getLibraryPanel(sc.reqContext, existing.UID)
+			require.NoError(t, err)
+			require.Equal(t, "Renamed", panel.Name)
+			require.JSONEq(t, `{ "type": "graph" }`, string(panel.Model))
+		})
+
+	testScenario(t, "When an admin rejects a pending change, the library panel should be kept as is",
+		func(t *testing.T, sc scenarioContext) {
+			sc.service.Cfg.LibraryPanels.ApprovalThreshold = 1
+			existing := createLibraryPanel(t, sc, getCreateCommand(0, "Widely used"))
+			for _, dashboardID := range saveTestDashboards(t, 2) {
+				err := sc.service.connectDashboard(sc.reqContext, existing.UID, dashboardID, 0)
+				require.NoError(t, err)
+			}
+
+			// admins change widely used library panels directly
+			sc.reqContext.ReplaceAllParams(map[string]string{":uid": existing.UID})
+			response := sc.service.patchHandler(sc.reqContext, patchLibraryPanelCommand{Model: []byte(`{ "type": "text", "title": "By admin" }`)})
+			require.Equal(t, 200, response.Status())
+
+			admin := sc.reqContext.SignedInUser
+			sc.reqContext.SignedInUser = &models.SignedInUser{UserId: 2, OrgId: 1, OrgRole: models.ROLE_EDITOR}
+			response = sc.service.patchHandler(sc.reqContext, patchLibraryPanelCommand{Model: []byte(`{ "type": "graph" }`)})
+			require.Equal(t, 202, response.Status())
+
+			sc.reqContext.SignedInUser = admin
+			sc.reqContext.ReplaceAllParams(map[string]string{":id": "1"})
+			response = sc.service.rejectPendingChangeHandler(sc.reqContext)
+			require.Equal(t, 200, response.Status())
+
+			panel, err := sc.service.getLibraryPanel(sc.reqContext, existing.UID)
+			require.NoError(t, err)
+			require.JSONEq(t, `{ "type": "text", "title": "By admin" }`, string(panel.Model))
+		})
+}
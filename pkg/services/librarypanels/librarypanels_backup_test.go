@@ -0,0 +1,133 @@
+package librarypanels
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBackupLibraryPanels(t *testing.T) {
+	testScenario(t, "When the library panels are backed up, the backup should be listed and old backups should be deleted",
+		func(t *testing.T, sc scenarioContext) {
+			dir := t.TempDir()
+			sc.service.backupStorage = localBackupStorage{dir: dir}
+			sc.service.Cfg.LibraryPanels.BackupRetention = 1
+			err := ioutil.WriteFile(filepath.Join(dir, "library-panels-20200101T000000Z.json"), []byte(`{}`), 0600)
+			require.NoError(t, err)
+			createLibraryPanel(t, sc, getCreateCommand(0, "Text - Library Panel"))
+
+			backup, err := sc.service.backupLibraryPanels(context.Background())
+			require.NoError(t, err)
+
+			backups := getBackups(t, sc)
+			require.Len(t, backups, 1)
+			require.Equal(t, backup.Name, backups[0].Name)
+			require.Greater(t, backups[0].Size, int64(0))
+		})
+
+	testScenario(t, "When a backup is restored, deleted library panels should be created and changed ones updated",
+		func(t *testing.T, sc scenarioContext) {
+			sc.service.backupStorage = localBackupStorage{dir: t.TempDir()}
+			updated := createLibraryPanel(t, sc, getCreateCommand(0, "Panel A"))
+			deleted := createLibraryPanel(t, sc, getCreateCommand(0, "Panel B"))
+			replaced := createLibraryPanel(t, sc, getCreateCommand(0, "Panel C"))
+			backup, err := sc.service.backupLibraryPanels(context.Background())
+			require.NoError(t, err)
+
+			sc.reqContext.ReplaceAllParams(map[string]string{":uid": updated.UID})
+			response := sc.service.patchHandler(sc.reqContext, patchLibraryPanelCommand{Name: "Panel A - New name"})
+			require.Equal(t, 200, response.Status())
+			for _, uid := range []string{deleted.UID, replaced.UID} {
+				sc.reqContext.ReplaceAllParams(map[string]string{":uid": uid})
+				response = sc.service.deleteHandler(sc.reqContext)
+				require.Equal(t, 200, response.Status())
+			}
+			createLibraryPanel(t, sc, getCreateCommand(0, "Panel C"))
+
+			sc.reqContext.ReplaceAllParams(map[string]string{":name": backup.Name})
+			response = sc.service.restoreBackupHandler(sc.reqContext)
+			require.Equal(t, 200, response.Status())
+			var result struct {
+				Result restoreBackupResult `json:"result"`
+			}
+			err = json.Unmarshal(response.Body(), &result)
+			require.NoError(t, err)
+			require.Equal(t, restoreBackupResult{
+				Created: []string{deleted.UID},
+				Updated: []string{updated.UID},
+				Skipped: []string{replaced.UID},
+			}, result.Result)
+
+			for uid, name := range map[string]string{updated.UID: "Panel A", deleted.UID: "Panel B"} {
+				sc.reqContext.ReplaceAllParams(map[string]string{":uid": uid})
+				response = sc.service.getHandler(sc.reqContext)
+				require.Equal(t, 200, response.Status())
+				var restored libraryPanelResult
+				err = json.Unmarshal(response.Body(), &restored)
+				require.NoError(t, err)
+				require.Equal(t, name, restored.Result.Name)
+			}
+		})
+
+	testScenario(t, "When a library panel is restored from a backup, only that library panel should be restored",
+		func(t *testing.T, sc scenarioContext) {
+			sc.service.backupStorage = localBackupStorage{dir: t.TempDir()}
+			restored := createLibraryPanel(t, sc, getCreateCommand(0, "Panel A"))
+			kept := createLibraryPanel(t, sc, getCreateCommand(0, "Panel B"))
+			backup, err := sc.service.backupLibraryPanels(context.Background())
+			require.NoError(t, err)
+			for _, panel := range []libraryPanel{restored, kept} {
+				sc.reqContext.ReplaceAllParams(map[string]string{":uid": panel.UID})
+				response := sc.service.patchHandler(sc.reqContext, patchLibraryPanelCommand{Name: panel.Name + " - New name"})
+				require.Equal(t, 200, response.Status())
+			}
+
+			sc.reqContext.ReplaceAllParams(map[string]string{":name": backup.Name, ":uid": restored.UID})
+			response := sc.service.restoreBackupPanelHandler(sc.reqContext)
+			require.Equal(t, 200, response.Status())
+			var result libraryPanelResult
+			err = json.Unmarshal(response.Body(), &result)
+			require.NoError(t, err)
+			require.Equal(t, "Panel A", result.Result.Name)
+
+			sc.reqContext.ReplaceAllParams(map[string]string{":uid": kept.UID})
+			response = sc.service.getHandler(sc.reqContext)
+			require.Equal(t, 200, response.Status())
+			err = json.Unmarshal(response.Body(), &result)
+			require.NoError(t, err)
+			require.Equal(t, "Panel B - New name", result.Result.Name)
+
+			sc.reqContext.ReplaceAllParams(map[string]string{":name": backup.Name, ":uid": "unknown"})
+			response = sc.service.restoreBackupPanelHandler(sc.reqContext)
+			require.Equal(t, 404, response.Status())
+		})
+
+	testScenario(t, "When a backup that does not exist is restored, it should fail",
+		func(t *testing.T, sc scenarioContext) {
+			sc.service.backupStorage = localBackupStorage{dir: t.TempDir()}
+
+			for _, name := range []string{"library-panels-20200101T000000Z.json", "../grafana.db"} {
+				sc.reqContext.ReplaceAllParams(map[string]string{":name": name})
+				response := sc.service.restoreBackupHandler(sc.reqContext)
+				require.Equal(t, 404, response.Status())
+			}
+		})
+}
+
+func getBackups(t *testing.T, sc scenarioContext) []libraryPanelBackup {
+	t.Helper()
+
+	response := sc.service.getBackupsHandler(sc.reqContext)
+	require.Equal(t, 200, response.Status())
+	var result struct {
+		Result []libraryPanelBackup `json:"result"`
+	}
+	err := json.Unmarshal(response.Body(), &result)
+	require.NoError(t, err)
+
+	return result.Result
+}
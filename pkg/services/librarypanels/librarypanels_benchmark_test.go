@@ -0,0 +1,211 @@
+package librarypanels
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"gopkg.in/macaron.v1"
+
+	"github.com/grafana/grafana/pkg/components/simplejson"
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/plugins"
+	"github.com/grafana/grafana/pkg/registry"
+	"github.com/grafana/grafana/pkg/services/sqlstore"
+	"github.com/grafana/grafana/pkg/setting"
+)
+
+const (
+	benchmarkLibraryPanels = 10000
+	benchmarkDashboards    = 1000
+	// benchmarkPanelsPerDashboard makes the 100000 connections, every library panel is used by 10 dashboards.
+	benchmarkPanelsPerDashboard = 100
+	benchmarkBatchSize          = 500
+)
+
+// benchmarkContext is a test database seeded with benchmarkLibraryPanels library panels, connected to
+// benchmarkDashboards dashboards.
+type benchmarkContext struct {
+	service    *LibraryPanelService
+	reqContext *models.ReqContext
+	// dashboard uses benchmarkPanelsPerDashboard library panels.
+	dashboard *models.Dashboard
+}
+
+// benchmarkPaths are the list, search and dashboard hydration paths that are benchmarked, with their
+// performance budget. The budgets are about three times what the paths take on SQLite on a CI machine, and are
+// checked by TestLibraryPanelPerformanceBudget in the integration tests. Lower a budget when an index or a
+// projection makes a path faster, so the improvement doesn't regress.
+var benchmarkPaths = []struct {
+	name   string
+	budget time.Duration
+	run    func(bc benchmarkContext) error
+}{
+	{
+		name:   "list",
+		budget: 1500 * time.Millisecond,
+		run: func(bc benchmarkContext) error {
+			_, err := bc.service.getAllLibraryPanels(bc.reqContext, getAllLibraryPanelsQuery{})
+			return err
+		},
+	},
+	{
+		name:   "search",
+		budget: 200 * time.Millisecond,
+		run: func(bc benchmarkContext) error {
+			_, err := bc.service.searchLibraryPanels(bc.reqContext, searchLibraryPanelsQuery{Query: "Panel 04", PerPage: 100})
+			return err
+		},
+	},
+	{
+		name:   "hydrate",
+		budget: 50 * time.Millisecond,
+		run: func(bc benchmarkContext) error {
+			return bc.service.LoadLibraryPanelsForDashboard(bc.reqContext, bc.dashboard)
+		},
+	},
+}
+
+func BenchmarkLibraryPanelPaths(b *testing.B) {
+	bc := setupBenchmark(b)
+	for _, path := range benchmarkPaths {
+		path := path
+		b.Run(path.name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if err := path.run(bc); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// setupBenchmark sets up the service like testScenario does and seeds the test database.
+func setupBenchmark(tb testing.TB) benchmarkContext {
+	tb.Helper()
+	tb.Cleanup(registry.ClearOverrides)
+
+	panels := plugins.Panels
+	plugins.Panels = map[string]*plugins.PanelPlugin{"text": {}, "graph": {}}
+	tb.Cleanup(func() { plugins.Panels = panels })
+
+	cfg := setting.NewCfg()
+	cfg.FeatureToggles = map[string]bool{"panelLibrary": true}
+	service := overrideLibraryPanelServiceInRegistry(cfg)
+	service.SQLStore = sqlstore.InitTestDB(tb)
+
+	ctx := macaron.Context{Req: macaron.Request{Request: &http.Request{URL: &url.URL{}}}}
+	user := models.SignedInUser{UserId: 1, OrgId: 1, OrgRole: models.ROLE_ADMIN, LastSeenAt: time.Now()}
+	bc := benchmarkContext{
+		service:    &service,
+		reqContext: &models.ReqContext{Context: &ctx, SignedInUser: &user},
+	}
+
+	uids, err := seedBenchmarkDatabase(service.SQLStore)
+	if err != nil {
+		tb.Fatalf("Failed to seed the benchmark database: %s", err)
+	}
+	references := make([]interface{}, 0, benchmarkPanelsPerDashboard)
+	for i, uid := range uids[:benchmarkPanelsPerDashboard] {
+		references = append(references, map[string]interface{}{
+			"id":           i + 1,
+			"gridPos":      map[string]interface{}{"h": 6, "w": 6, "x": 0, "y": 6 * i},
+			"libraryPanel": map[string]interface{}{"uid": uid},
+		})
+	}
+	bc.dashboard = models.NewDashboardFromJson(simplejson.NewFromAny(map[string]interface{}{"panels": references}))
+
+	return bc
+}
+
+// seedBenchmarkDatabase inserts the library panels, dashboards and connections in batches, and returns the UIDs
+// of the library panels.
+func seedBenchmarkDatabase(sqlStore *sqlstore.SQLStore) ([]string, error) {
+	var uids []string
+	err := sqlStore.WithTransactionalDbSession(context.Background(), func(session *sqlstore.DBSession) error {
+		now := time.Now()
+		for start := 0; start < benchmarkLibraryPanels; start += benchmarkBatchSize {
+			libraryPanels := make([]*LibraryPanel, 0, benchmarkBatchSize)
+			for i := start; i < start+benchmarkBatchSize; i++ {
+				name := fmt.Sprintf("Panel %05d", i)
+				model, err := json.Marshal(map[string]interface{}{
+					"type":       "graph",
+					"title":      name,
+					"datasource": fmt.Sprintf("datasource-%d", i%20),
+					"targets":    []interface{}{map[string]interface{}{"refId": "A", "expr": fmt.Sprintf("rate(metric_%d[5m])", i)}},
+				})
+				if err != nil {
+					return err
+				}
+				libraryPanels = append(libraryPanels, &LibraryPanel{
+					OrgID: 1, UID: fmt.Sprintf("benchmark-%05d", i), Name: name, Kind: panelElement, Model: model,
+					Status: statusPublished, Created: now, Updated: now, CreatedBy: 1, UpdatedBy: 1,
+				})
+			}
+			if _, err := session.Insert(&libraryPanels); err != nil {
+				return err
+			}
+		}
+		// batch inserts don't set the IDs
+		var libraryPanels []LibraryPanel
+		if err := session.Table("library_panel").Cols("id", "uid").OrderBy("uid ASC").Find(&libraryPanels); err != nil {
+			return err
+		}
+		tags := make([]libraryPanelTag, 0, benchmarkBatchSize)
+		for _, libraryPanel := range libraryPanels {
+			uids = append(uids, libraryPanel.UID)
+			tags = append(tags, libraryPanelTag{LibraryPanelID: libraryPanel.ID, Term: fmt.Sprintf("team-%d", libraryPanel.ID%50)})
+			if len(tags) == benchmarkBatchSize {
+				if _, err := session.Insert(&tags); err != nil {
+					return err
+				}
+				tags = tags[:0]
+			}
+		}
+
+		for start := 0; start < benchmarkDashboards; start += benchmarkBatchSize {
+			dashboards := make([]*models.Dashboard, 0, benchmarkBatchSize)
+			for i := start; i < start+benchmarkBatchSize && i < benchmarkDashboards; i++ {
+				dashboard := models.NewDashboard(fmt.Sprintf("Dashboard %04d", i))
+				dashboard.OrgId = 1
+				dashboard.Uid = fmt.Sprintf("benchmark-%04d", i)
+				dashboard.Created = now
+				dashboard.Updated = now
+				dashboards = append(dashboards, dashboard)
+			}
+			if _, err := session.Insert(&dashboards); err != nil {
+				return err
+			}
+		}
+		var dashboards []models.Dashboard
+		if err := session.Table("dashboard").Cols("id", "uid").OrderBy("uid ASC").Find(&dashboards); err != nil {
+			return err
+		}
+
+		connections := make([]libraryPanelDashboard, 0, benchmarkBatchSize)
+		for d, dashboard := range dashboards {
+			for p := 0; p < benchmarkPanelsPerDashboard; p++ {
+				// dashboard n uses the library panels n*100 to n*100+99, wrapping around
+				index := (d*benchmarkPanelsPerDashboard + p) % benchmarkLibraryPanels
+				connections = append(connections, libraryPanelDashboard{
+					LibraryPanelID: libraryPanels[index].ID, DashboardID: dashboard.Id, PanelID: int64(p + 1),
+					Created: now, CreatedBy: 1,
+				})
+				if len(connections) == benchmarkBatchSize {
+					if _, err := session.Insert(&connections); err != nil {
+						return err
+					}
+					connections = connections[:0]
+				}
+			}
+		}
+
+		return nil
+	})
+
+	return uids, err
+}
@@ -0,0 +1,30 @@
+// +build integration
+
+package librarypanels
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLibraryPanelPerformanceBudget(t *testing.T) {
+	bc := setupBenchmark(t)
+	for _, path := range benchmarkPaths {
+		result := testing.Benchmark(func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if err := path.run(bc); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+		if result.N == 0 {
+			t.Fatalf("Benchmark of the %s path failed", path.name)
+		}
+
+		took := time.Duration(result.NsPerOp())
+		t.Logf("The %s path took %s, its budget is %s", path.name, took, path.budget)
+		if took > path.budget {
+			t.Errorf("The %s path took %s, which is over its budget of %s", path.name, took, path.budget)
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package librarypanels
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/grafana/pkg/infra/log"
+	"github.com/grafana/grafana/pkg/infra/remotecache"
+	"github.com/grafana/grafana/pkg/services/sqlstore"
+)
+
+func TestLibraryPanelCache(t *testing.T) {
+	testScenario(t, "When a library panel is patched on one server, the other servers should stop using their cached model",
+		func(t *testing.T, sc scenarioContext) {
+			sc.service.log = log.New("librarypanels")
+			sc.service.RemoteCache = remotecache.NewFakeStore(t)
+			sc.service.Cfg.LibraryPanels.CacheTTL = time.Minute
+			sc.service.panelCache = newLibraryPanelCache()
+			other := *sc.service
+			other.panelCache = newLibraryPanelCache()
+			existing := createLibraryPanel(t, sc, getCreateCommand(1, "Text - Library Panel"))
+			require.Equal(t, "Text - Library Panel", loadLibraryPanelName(t, sc, &other, existing.UID))
+
+			// changes that bypass the service aren't seen until the cache expires
+			err := sc.service.SQLStore.WithDbSession(context.Background(), func(session *sqlstore.DBSession) error {
+				_, err := session.Exec("UPDATE library_panel SET name=? WHERE uid=?", "Changed in the database", existing.UID)
+				return err
+			})
+			require.NoError(t, err)
+			require.Equal(t, "Text - Library Panel", loadLibraryPanelName(t, sc, &other, existing.UID))
+
+			sc.reqContext.ReplaceAllParams(map[string]string{":uid": existing.UID})
+			response := sc.service.patchHandler(sc.reqContext, patchLibraryPanelCommand{Name: "Panel - New name"})
+			require.Equal(t, 200, response.Status())
+			require.Equal(t, "Panel - New name", loadLibraryPanelName(t, sc, &other, existing.UID))
+			require.Equal(t, "Panel - New name", loadLibraryPanelName(t, sc, sc.service, existing.UID))
+		})
+}
+
+func loadLibraryPanelName(t *testing.T, sc scenarioContext, service *LibraryPanelService, uid string) string {
+	t.Helper()
+
+	dash := getDashboardWithLibraryPanels(t, uid, "unknown")
+	err := service.LoadLibraryPanelsForDashboard(sc.reqContext, dash)
+	require.NoError(t, err)
+
+	return dash.Data.Get("panels").GetIndex(0).Get("libraryPanel").Get("name").MustString()
+}
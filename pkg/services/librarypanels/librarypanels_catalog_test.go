@@ -0,0 +1,106 @@
+package librarypanels
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLibraryPanelCatalog(t *testing.T) {
+	testScenario(t, "When an org admin installs a catalog panel as a copy, it should not follow the catalog panel",
+		func(t *testing.T, sc scenarioContext) {
+			catalog := createCatalogPanel(t, sc, "Node exporter CPU", `{ "type": "graph", "title": "CPU" }`)
+
+			sc.reqContext.ReplaceAllParams(map[string]string{":uid": catalog.UID})
+			response := sc.service.installCatalogPanelHandler(sc.reqContext, installCatalogPanelCommand{FolderID: 1})
+			require.Equal(t, 200, response.Status())
+			var installed libraryPanelResult
+			err := json.Unmarshal(response.Body(), &installed)
+			require.NoError(t, err)
+			require.Equal(t, "Node exporter CPU", installed.Result.Name)
+			require.Equal(t, "CPU", installed.Result.Model["title"])
+
+			response = sc.service.updateCatalogPanelHandler(sc.reqContext, saveCatalogPanelCommand{
+				Name:  "Node exporter CPU",
+				Model: []byte(`{ "type": "graph", "title": "CPU usage" }`),
+			})
+			require.Equal(t, 200, response.Status())
+
+			libraryPanel, err := sc.service.getLibraryPanel(sc.reqContext, installed.Result.UID)
+			require.NoError(t, err)
+			require.JSONEq(t, `{ "type": "graph", "title": "CPU" }`, string(libraryPanel.Model))
+			require.Empty(t, libraryPanel.CatalogUID)
+		})
+
+	testScenario(t, "When an org admin installs a catalog panel as a linked reference, it should follow the catalog panel",
+		func(t *testing.T, sc scenarioContext) {
+			catalog := createCatalogPanel(t, sc, "Node exporter CPU", `{ "type": "graph", "title": "CPU" }`)
+
+			sc.reqContext.ReplaceAllParams(map[string]string{":uid": catalog.UID})
+			response := sc.service.installCatalogPanelHandler(sc.reqContext, installCatalogPanelCommand{FolderID: 1, Name: "CPU", Linked: true})
+			require.Equal(t, 200, response.Status())
+			var installed libraryPanelResult
+			err := json.Unmarshal(response.Body(), &installed)
+			require.NoError(t, err)
+
+			response = sc.service.updateCatalogPanelHandler(sc.reqContext, saveCatalogPanelCommand{
+				Name:  "Node exporter CPU",
+				Model: []byte(`{ "type": "graph", "title": "CPU usage" }`),
+			})
+			require.Equal(t, 200, response.Status())
+
+			libraryPanel, err := sc.service.getLibraryPanel(sc.reqContext, installed.Result.UID)
+			require.NoError(t, err)
+			require.JSONEq(t, `{ "type": "graph", "title": "CPU usage" }`, string(libraryPanel.Model))
+			require.Equal(t, catalog.UID, libraryPanel.CatalogUID)
+
+			sc.reqContext.ReplaceAllParams(map[string]string{":uid": installed.Result.UID})
+			response = sc.service.patchHandler(sc.reqContext, patchLibraryPanelCommand{Model: []byte(`{ "type": "text" }`)})
+			require.Equal(t, 400, response.Status())
+
+			sc.reqContext.ReplaceAllParams(map[string]string{":uid": catalog.UID})
+			response = sc.service.deleteCatalogPanelHandler(sc.reqContext)
+			require.Equal(t, 200, response.Status())
+			response = sc.service.getCatalogPanelHandler(sc.reqContext)
+			require.Equal(t, 404, response.Status())
+
+			libraryPanel, err = sc.service.getLibraryPanel(sc.reqContext, installed.Result.UID)
+			require.NoError(t, err)
+			require.Empty(t, libraryPanel.CatalogUID)
+		})
+
+	testScenario(t, "When a server admin adds an invalid or existing catalog panel, it should fail",
+		func(t *testing.T, sc scenarioContext) {
+			createCatalogPanel(t, sc, "Node exporter CPU", `{ "type": "graph" }`)
+
+			response := sc.service.createCatalogPanelHandler(sc.reqContext, saveCatalogPanelCommand{Name: "Node exporter CPU", Model: []byte(`{ "type": "graph" }`)})
+			require.Equal(t, 400, response.Status())
+			response = sc.service.createCatalogPanelHandler(sc.reqContext, saveCatalogPanelCommand{Name: "Invalid", Model: []byte(`{ "type": "unknown-panel" }`)})
+			require.Equal(t, 400, response.Status())
+
+			response = sc.service.getAllCatalogPanelsHandler(sc.reqContext)
+			require.Equal(t, 200, response.Status())
+			var result struct {
+				Result []catalogPanel `json:"result"`
+			}
+			err := json.Unmarshal(response.Body(), &result)
+			require.NoError(t, err)
+			require.Len(t, result.Result, 1)
+		})
+}
+
+func createCatalogPanel(t *testing.T, sc scenarioContext, name string, model string) catalogPanel {
+	t.Helper()
+
+	response := sc.service.createCatalogPanelHandler(sc.reqContext, saveCatalogPanelCommand{Name: name, Model: []byte(model)})
+	require.Equal(t, 200, response.Status())
+
+	var result struct {
+		Result catalogPanel `json:"result"`
+	}
+	err := json.Unmarshal(response.Body(), &result)
+	require.NoError(t, err)
+
+	return result.Result
+}
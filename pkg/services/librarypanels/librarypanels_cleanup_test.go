@@ -0,0 +1,125 @@
+package librarypanels
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/grafana/pkg/infra/log"
+	"github.com/grafana/grafana/pkg/services/sqlstore"
+)
+
+func TestGetUnusedLibraryPanels(t *testing.T) {
+	testScenario(t, "When an admin gets unused library panels, only old panels without connections should be returned",
+		func(t *testing.T, sc scenarioContext) {
+			old := createLibraryPanel(t, sc, getCreateCommand(1, "Old"))
+			createLibraryPanel(t, sc, getCreateCommand(1, "New"))
+			connected := createLibraryPanel(t, sc, getCreateCommand(1, "Connected"))
+			setLibraryPanelCreated(t, sc, time.Now().AddDate(0, 0, -40), old.UID, connected.UID)
+
+			dash := saveTestDashboard(t, `{ "title": "Dashboard", "panels": [] }`)
+			sc.reqContext.ReplaceAllParams(map[string]string{":uid": connected.UID, ":dashboardId": strconv.FormatInt(dash.Id, 10)})
+			response := sc.service.connectHandler(sc.reqContext)
+			require.Equal(t, 200, response.Status())
+
+			response = sc.service.getUnusedHandler(sc.reqContext)
+			require.Equal(t, 200, response.Status())
+
+			var result libraryPanelsResult
+			err := json.Unmarshal(response.Body(), &result)
+			require.NoError(t, err)
+			require.Len(t, result.Result, 1)
+			require.Equal(t, old.UID, result.Result[0].UID)
+		})
+}
+
+func TestLibraryPanelCleanupPolicy(t *testing.T) {
+	testScenario(t, "When an admin gets the cleanup policy of an org without one, the default policy should be returned",
+		func(t *testing.T, sc scenarioContext) {
+			response := sc.service.getCleanupPolicyHandler(sc.reqContext)
+			require.Equal(t, 200, response.Status())
+
+			var result cleanupPolicyResult
+			err := json.Unmarshal(response.Body(), &result)
+			require.NoError(t, err)
+			require.False(t, result.Result.Enabled)
+			require.Equal(t, cleanupActionArchive, result.Result.Action)
+			require.Equal(t, []string{}, result.Result.ExcludedUIDs)
+		})
+
+	testScenario(t, "When an admin updates the cleanup policy with an unknown action, it should fail",
+		func(t *testing.T, sc scenarioContext) {
+			cmd := updateCleanupPolicyCommand{Enabled: true, OlderThanDays: 30, Action: "shred"}
+			response := sc.service.updateCleanupPolicyHandler(sc.reqContext, cmd)
+			require.Equal(t, 400, response.Status())
+		})
+
+	testScenario(t, "When the cleanup runs for an org that opted in, unused panels should be archived unless excluded",
+		func(t *testing.T, sc scenarioContext) {
+			sc.service.log = log.New("librarypanels")
+			archived := createLibraryPanel(t, sc, getCreateCommand(1, "Archived"))
+			protected := createLibraryPanel(t, sc, getCreateCommand(1, "Protected"))
+			recent := createLibraryPanel(t, sc, getCreateCommand(1, "Recent"))
+			setLibraryPanelCreated(t, sc, time.Now().AddDate(0, 0, -40), archived.UID, protected.UID)
+
+			cmd := updateCleanupPolicyCommand{Enabled: true, OlderThanDays: 30, Action: cleanupActionArchive, ExcludedUIDs: []string{protected.UID}}
+			response := sc.service.updateCleanupPolicyHandler(sc.reqContext, cmd)
+			require.Equal(t, 200, response.Status())
+
+			removed, err := sc.service.cleanUpUnusedLibraryPanels()
+			require.NoError(t, err)
+			require.Equal(t, 1, removed)
+
+			for _, uid := range []string{protected.UID, recent.UID} {
+				_, err := sc.service.getLibraryPanel(sc.reqContext, uid)
+				require.NoError(t, err)
+			}
+			_, err = sc.service.getLibraryPanel(sc.reqContext, archived.UID)
+			require.ErrorIs(t, err, errLibraryPanelNotFound)
+
+			var archives []libraryPanelArchive
+			err = sc.service.SQLStore.WithDbSession(context.Background(), func(session *sqlstore.DBSession) error {
+				return session.Table("library_panel_archive").Find(&archives)
+			})
+			require.NoError(t, err)
+			require.Len(t, archives, 1)
+			require.Equal(t, archived.UID, archives[0].UID)
+
+			var model map[string]interface{}
+			err = json.Unmarshal([]byte(archives[0].Model), &model)
+			require.NoError(t, err)
+			require.Equal(t, archived.Model, model)
+		})
+
+	testScenario(t, "When the cleanup runs for an org that hasn't opted in, nothing should be removed",
+		func(t *testing.T, sc scenarioContext) {
+			existing := createLibraryPanel(t, sc, getCreateCommand(1, "Old"))
+			setLibraryPanelCreated(t, sc, time.Now().AddDate(0, 0, -400), existing.UID)
+
+			removed, err := sc.service.cleanUpUnusedLibraryPanels()
+			require.NoError(t, err)
+			require.Equal(t, 0, removed)
+		})
+}
+
+func setLibraryPanelCreated(t *testing.T, sc scenarioContext, created time.Time, uids ...string) {
+	t.Helper()
+
+	err := sc.service.SQLStore.WithDbSession(context.Background(), func(session *sqlstore.DBSession) error {
+		for _, uid := range uids {
+			if _, err := session.Exec("UPDATE library_panel SET created=? WHERE uid=?", created, uid); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	require.NoError(t, err)
+}
+
+type cleanupPolicyResult struct {
+	Result libraryPanelCleanupPolicy `json:"result"`
+}
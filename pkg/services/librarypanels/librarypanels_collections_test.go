@@ -0,0 +1,175 @@
+package librarypanels
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/components/simplejson"
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/dashboards"
+)
+
+func TestLibraryPanelCollections(t *testing.T) {
+	testScenario(t, "When an admin manages a collection, its library panels should be kept in order",
+		func(t *testing.T, sc scenarioContext) {
+			first := createLibraryPanel(t, sc, getCreateCommand(1, "CPU"))
+			second := createLibraryPanel(t, sc, getCreateCommand(1, "Memory"))
+
+			response := sc.service.createCollectionHandler(sc.reqContext, saveCollectionCommand{Name: "Kubernetes essentials"})
+			require.Equal(t, 200, response.Status())
+			var created collectionResult
+			err := json.Unmarshal(response.Body(), &created)
+			require.NoError(t, err)
+
+			for _, uid := range []string{second.UID, first.UID, second.UID} {
+				sc.reqContext.ReplaceAllParams(map[string]string{":uid": created.Result.UID, ":libraryPanelUid": uid})
+				response = sc.service.addCollectionLibraryPanelHandler(sc.reqContext)
+				require.Equal(t, 200, response.Status())
+			}
+
+			sc.reqContext.ReplaceAllParams(map[string]string{":uid": created.Result.UID})
+			response = sc.service.getCollectionHandler(sc.reqContext)
+			require.Equal(t, 200, response.Status())
+			var result collectionResult
+			err = json.Unmarshal(response.Body(), &result)
+			require.NoError(t, err)
+			require.Equal(t, "Kubernetes essentials", result.Result.Name)
+			require.Len(t, result.Result.LibraryPanels, 2)
+			require.Equal(t, second.UID, result.Result.LibraryPanels[0].UID)
+			require.Equal(t, first.UID, result.Result.LibraryPanels[1].UID)
+
+			sc.reqContext.ReplaceAllParams(map[string]string{":uid": created.Result.UID, ":libraryPanelUid": second.UID})
+			response = sc.service.removeCollectionLibraryPanelHandler(sc.reqContext)
+			require.Equal(t, 200, response.Status())
+			response = sc.service.removeCollectionLibraryPanelHandler(sc.reqContext)
+			require.Equal(t, 404, response.Status())
+
+			sc.reqContext.ReplaceAllParams(map[string]string{":uid": created.Result.UID})
+			response = sc.service.updateCollectionHandler(sc.reqContext, saveCollectionCommand{Name: "Kubernetes", Description: "Cluster panels"})
+			require.Equal(t, 200, response.Status())
+			err = json.Unmarshal(response.Body(), &result)
+			require.NoError(t, err)
+			require.Equal(t, "Kubernetes", result.Result.Name)
+			require.Len(t, result.Result.LibraryPanels, 1)
+			require.Equal(t, first.UID, result.Result.LibraryPanels[0].UID)
+
+			response = sc.service.deleteCollectionHandler(sc.reqContext)
+			require.Equal(t, 200, response.Status())
+			response = sc.service.getCollectionHandler(sc.reqContext)
+			require.Equal(t, 404, response.Status())
+
+			// the library panels outlive the collection
+			sc.reqContext.ReplaceAllParams(map[string]string{":uid": first.UID})
+			response = sc.service.getHandler(sc.reqContext)
+			require.Equal(t, 200, response.Status())
+		})
+
+	testScenario(t, "When an admin creates a collection without a name or with an existing name, it should fail",
+		func(t *testing.T, sc scenarioContext) {
+			response := sc.service.createCollectionHandler(sc.reqContext, saveCollectionCommand{Name: " "})
+			require.Equal(t, 400, response.Status())
+
+			response = sc.service.createCollectionHandler(sc.reqContext, saveCollectionCommand{Name: "Essentials"})
+			require.Equal(t, 200, response.Status())
+			response = sc.service.createCollectionHandler(sc.reqContext, saveCollectionCommand{Name: "Essentials"})
+			require.Equal(t, 400, response.Status())
+		})
+
+	testScenario(t, "When an admin adds a collection to a dashboard, its library panels should be added below the existing panels",
+		func(t *testing.T, sc scenarioContext) {
+			fakeService := &dashboards.FakeDashboardService{}
+			newService := dashboards.NewService
+			dashboards.MockDashboardService(fakeService)
+			t.Cleanup(func() { dashboards.NewService = newService })
+
+			first := createLibraryPanel(t, sc, getCreateCommand(1, "CPU"))
+			second := createLibraryPanel(t, sc, getCreateCommand(1, "Memory"))
+			response := sc.service.createCollectionHandler(sc.reqContext, saveCollectionCommand{Name: "Essentials"})
+			require.Equal(t, 200, response.Status())
+			var created collectionResult
+			err := json.Unmarshal(response.Body(), &created)
+			require.NoError(t, err)
+			for _, uid := range []string{first.UID, second.UID} {
+				sc.reqContext.ReplaceAllParams(map[string]string{":uid": created.Result.UID, ":libraryPanelUid": uid})
+				response = sc.service.addCollectionLibraryPanelHandler(sc.reqContext)
+				require.Equal(t, 200, response.Status())
+			}
+
+			dash := saveTestDashboard(t, `{
+				"title": "Cluster",
+				"panels": [{ "id": 7, "type": "text", "gridPos": { "x": 0, "y": 0, "w": 24, "h": 4 } }]
+			}`)
+			sc.reqContext.ReplaceAllParams(map[string]string{":uid": created.Result.UID, ":dashboardId": strconv.FormatInt(dash.Id, 10)})
+			response = sc.service.addCollectionToDashboardHandler(sc.reqContext)
+			require.Equal(t, 200, response.Status())
+
+			require.Len(t, fakeService.SavedDashboards, 1)
+			panels := fakeService.SavedDashboards[0].Dashboard.Data.Get("panels")
+			require.Len(t, panels.MustArray(), 3)
+			for i, uid := range []string{first.UID, second.UID} {
+				panel := panels.GetIndex(i + 1)
+				require.Equal(t, int64(8+i), panel.Get("id").MustInt64())
+				require.Equal(t, uid, panel.Get("libraryPanel").Get("uid").MustString())
+				require.Equal(t, i*collectionPanelWidth, panel.Get("gridPos").Get("x").MustInt())
+				require.Equal(t, 4, panel.Get("gridPos").Get("y").MustInt())
+			}
+
+			sc.reqContext.ReplaceAllParams(map[string]string{":uid": first.UID})
+			response = sc.service.getConnectedDashboardsHandler(sc.reqContext)
+			var connected libraryPanelDashboardsResult
+			err = json.Unmarshal(response.Body(), &connected)
+			require.NoError(t, err)
+			require.Equal(t, []int64{dash.Id}, connected.Result)
+
+			sc.reqContext.ReplaceAllParams(map[string]string{":uid": created.Result.UID, ":dashboardId": "999"})
+			response = sc.service.addCollectionToDashboardHandler(sc.reqContext)
+			require.Equal(t, 404, response.Status())
+		})
+}
+
+type collectionResult struct {
+	Result struct {
+		UID           string         `json:"uid"`
+		Name          string         `json:"name"`
+		Description   string         `json:"description"`
+		LibraryPanels []libraryPanel `json:"libraryPanels"`
+	} `json:"result"`
+}
+
+func saveTestDashboard(t *testing.T, data string) *models.Dashboard {
+	t.Helper()
+
+	dashboard, err := simplejson.NewJson([]byte(data))
+	require.NoError(t, err)
+	cmd := models.SaveDashboardCommand{OrgId: 1, Dashboard: dashboard}
+	err = bus.Dispatch(&cmd)
+	require.NoError(t, err)
+
+	return cmd.Result
+}
+
+// deleteTestDashboard deletes the dashboard, its connections to library panels are kept.
+func deleteTestDashboard(t *testing.T, dashboard *models.Dashboard) {
+	t.Helper()
+
+	err := bus.Dispatch(&models.DeleteDashboardCommand{Id: dashboard.Id, OrgId: dashboard.OrgId})
+	require.NoError(t, err)
+}
+
+// saveTestDashboards saves count dashboards without panels in org 1 and returns their ids, for connecting library
+// panels to.
+func saveTestDashboards(t *testing.T, count int) []int64 {
+	t.Helper()
+
+	ids := make([]int64, 0, count)
+	for i := 1; i <= count; i++ {
+		ids = append(ids, saveTestDashboard(t, fmt.Sprintf(`{ "title": "Dashboard %d", "panels": [] }`, i)).Id)
+	}
+
+	return ids
+}
@@ -0,0 +1,81 @@
+package librarypanels
+
+import (
+	"encoding/json"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/grafana/pkg/models"
+)
+
+func TestLibraryPanelComments(t *testing.T) {
+	testScenario(t, "When users comment on a library panel, the comments should be listed oldest first",
+		func(t *testing.T, sc scenarioContext) {
+			existing := createLibraryPanel(t, sc, getCreateCommand(0, "Discussed"))
+			sc.reqContext.ReplaceAllParams(map[string]string{":uid": existing.UID})
+
+			response := sc.service.addCommentHandler(sc.reqContext, addCommentCommand{Content: "Should we switch to a bar gauge?"})
+			require.Equal(t, 200, response.Status())
+			sc.reqContext.SignedInUser = &models.SignedInUser{UserId: 2, OrgId: 1, OrgRole: models.ROLE_VIEWER}
+			response = sc.service.addCommentHandler(sc.reqContext, addCommentCommand{Content: " Yes please "})
+			require.Equal(t, 200, response.Status())
+			response = sc.service.addCommentHandler(sc.reqContext, addCommentCommand{Content: "  "})
+			require.Equal(t, 400, response.Status())
+
+			comments := getComments(t, sc)
+			require.Len(t, comments, 2)
+			require.Equal(t, "Should we switch to a bar gauge?", comments[0].Content)
+			require.Equal(t, int64(1), comments[0].UserID)
+			require.Equal(t, "Yes please", comments[1].Content)
+			require.Equal(t, int64(2), comments[1].UserID)
+		})
+
+	testScenario(t, "When users delete comments, only the author and org admins should be allowed to",
+		func(t *testing.T, sc scenarioContext) {
+			existing := createLibraryPanel(t, sc, getCreateCommand(0, "Discussed"))
+			sc.reqContext.ReplaceAllParams(map[string]string{":uid": existing.UID})
+			admin := sc.reqContext.SignedInUser
+
+			sc.reqContext.SignedInUser = &models.SignedInUser{UserId: 2, OrgId: 1, OrgRole: models.ROLE_EDITOR}
+			response := sc.service.addCommentHandler(sc.reqContext, addCommentCommand{Content: "First"})
+			require.Equal(t, 200, response.Status())
+			response = sc.service.addCommentHandler(sc.reqContext, addCommentCommand{Content: "Second"})
+			require.Equal(t, 200, response.Status())
+			comments := getComments(t, sc)
+			require.Len(t, comments, 2)
+
+			sc.reqContext.SignedInUser = &models.SignedInUser{UserId: 3, OrgId: 1, OrgRole: models.ROLE_EDITOR}
+			sc.reqContext.ReplaceAllParams(map[string]string{":uid": existing.UID, ":commentId": strconv.FormatInt(comments[0].ID, 10)})
+			response = sc.service.deleteCommentHandler(sc.reqContext)
+			require.Equal(t, 403, response.Status())
+
+			sc.reqContext.SignedInUser = &models.SignedInUser{UserId: 2, OrgId: 1, OrgRole: models.ROLE_EDITOR}
+			response = sc.service.deleteCommentHandler(sc.reqContext)
+			require.Equal(t, 200, response.Status())
+			response = sc.service.deleteCommentHandler(sc.reqContext)
+			require.Equal(t, 404, response.Status())
+
+			sc.reqContext.SignedInUser = admin
+			sc.reqContext.ReplaceAllParams(map[string]string{":uid": existing.UID, ":commentId": strconv.FormatInt(comments[1].ID, 10)})
+			response = sc.service.deleteCommentHandler(sc.reqContext)
+			require.Equal(t, 200, response.Status())
+			require.Empty(t, getComments(t, sc))
+		})
+}
+
+func getComments(t *testing.T, sc scenarioContext) []libraryPanelComment {
+	t.Helper()
+
+	response := sc.service.getCommentsHandler(sc.reqContext)
+	require.Equal(t, 200, response.Status())
+
+	var result struct {
+		Result []libraryPanelComment `json:"result"`
+	}
+	err := json.Unmarshal(response.Body(), &result)
+	require.NoError(t, err)
+
+	return result.Result
+}
@@ -0,0 +1,90 @@
+package librarypanels
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCommunityPanels(t *testing.T) {
+	testScenario(t, "When a community panel is installed, its source and revision should be kept to check for updates",
+		func(t *testing.T, sc scenarioContext) {
+			revision := 3
+			registry := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch r.URL.Path {
+				case "/panels":
+					require.Equal(t, "cpu", r.URL.Query().Get("query"))
+					_, _ = w.Write([]byte(`{ "items": [{ "slug": "node-cpu", "name": "Node CPU", "type": "graph", "revision": 3 }], "page": 1, "pages": 1 }`))
+				case "/panels/node-cpu":
+					_ = json.NewEncoder(w).Encode(communityPanel{
+						Slug: "node-cpu", Name: "Node CPU", Type: "graph", Revision: int64(revision),
+						Model: []byte(`{ "type": "graph", "title": "CPU" }`),
+					})
+				default:
+					http.NotFound(w, r)
+				}
+			}))
+			t.Cleanup(registry.Close)
+			sc.service.Cfg.LibraryPanels.CommunityRegistryURL = registry.URL
+
+			sc.ctx.Req.Request = &http.Request{URL: &url.URL{RawQuery: "query=cpu"}}
+			response := sc.service.searchCommunityPanelsHandler(sc.reqContext)
+			require.Equal(t, 200, response.Status())
+			var found struct {
+				Result communityPanelSearchResult `json:"result"`
+			}
+			err := json.Unmarshal(response.Body(), &found)
+			require.NoError(t, err)
+			require.Len(t, found.Result.Items, 1)
+			require.Equal(t, "node-cpu", found.Result.Items[0].Slug)
+
+			sc.reqContext.ReplaceAllParams(map[string]string{":slug": "node-cpu"})
+			response = sc.service.installCommunityPanelHandler(sc.reqContext, installCommunityPanelCommand{FolderID: 1})
+			require.Equal(t, 200, response.Status())
+			var installed libraryPanelResult
+			err = json.Unmarshal(response.Body(), &installed)
+			require.NoError(t, err)
+			require.Equal(t, "Node CPU", installed.Result.Name)
+			libraryPanel, err := sc.service.getLibraryPanel(sc.reqContext, installed.Result.UID)
+			require.NoError(t, err)
+			require.Equal(t, registry.URL+"/panels/node-cpu", libraryPanel.RegistrySource)
+			require.Equal(t, int64(3), libraryPanel.RegistryRevision)
+
+			checkUpdate := func() communityPanelUpdate {
+				sc.reqContext.ReplaceAllParams(map[string]string{":uid": installed.Result.UID})
+				response := sc.service.checkCommunityUpdateHandler(sc.reqContext)
+				require.Equal(t, 200, response.Status())
+				var result struct {
+					Result communityPanelUpdate `json:"result"`
+				}
+				err := json.Unmarshal(response.Body(), &result)
+				require.NoError(t, err)
+				return result.Result
+			}
+			require.False(t, checkUpdate().UpdateAvailable)
+			revision = 4
+			update := checkUpdate()
+			require.True(t, update.UpdateAvailable)
+			require.Equal(t, int64(4), update.LatestRevision)
+		})
+
+	testScenario(t, "When a community panel doesn't exist or a library panel isn't from the registry, it should fail",
+		func(t *testing.T, sc scenarioContext) {
+			registry := httptest.NewServer(http.NotFoundHandler())
+			t.Cleanup(registry.Close)
+			sc.service.Cfg.LibraryPanels.CommunityRegistryURL = registry.URL
+
+			sc.reqContext.ReplaceAllParams(map[string]string{":slug": "unknown"})
+			response := sc.service.installCommunityPanelHandler(sc.reqContext, installCommunityPanelCommand{FolderID: 1})
+			require.Equal(t, 404, response.Status())
+
+			existing := createLibraryPanel(t, sc, getCreateCommand(1, "Text - Library Panel"))
+			sc.reqContext.ReplaceAllParams(map[string]string{":uid": existing.UID})
+			response = sc.service.checkCommunityUpdateHandler(sc.reqContext)
+			require.Equal(t, 400, response.Status())
+		})
+}
@@ -0,0 +1,84 @@
+package librarypanels
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLibraryFragments(t *testing.T) {
+	testScenario(t, "When a dashboard is loaded, the library fragments referenced by its library panels should be merged",
+		func(t *testing.T, sc scenarioContext) {
+			base := createLibraryFragment(t, sc, "Base query", `{ "expr": "up", "legendFormat": "{{instance}}" }`)
+			query := createLibraryFragment(t, sc, "Rate query",
+				`{ "libraryFragment": { "uid": "`+base.UID+`" }, "expr": "rate(up[5m])" }`)
+			panel := createLibraryPanel(t, sc, getCreateCommandWithModel(1, "Uptime",
+				`{ "type": "graph", "targets": [{ "refId": "A", "libraryFragment": { "uid": "`+query.UID+`" } }] }`))
+
+			dash := getDashboardWithLibraryPanels(t, panel.UID, "unknown")
+			err := sc.service.LoadLibraryPanelsForDashboard(sc.reqContext, dash)
+			require.NoError(t, err)
+
+			target := dash.Data.Get("panels").GetIndex(0).Get("targets").GetIndex(0)
+			require.Equal(t, "A", target.Get("refId").MustString())
+			require.Equal(t, "rate(up[5m])", target.Get("expr").MustString())
+			require.Equal(t, "{{instance}}", target.Get("legendFormat").MustString())
+			require.Equal(t, query.UID, target.Get("libraryFragment").Get("uid").MustString())
+			require.Equal(t, "Rate query", target.Get("libraryFragment").Get("name").MustString())
+
+			sc.reqContext.ReplaceAllParams(map[string]string{":uid": query.UID})
+			response := sc.service.getDependenciesHandler(sc.reqContext)
+			require.Equal(t, 200, response.Status())
+			var result struct {
+				Result libraryElementDependencies `json:"result"`
+			}
+			err = json.Unmarshal(response.Body(), &result)
+			require.NoError(t, err)
+			require.Equal(t, libraryElementDependencies{
+				Dependencies: []libraryElementReference{{UID: base.UID, Name: "Base query", Kind: fragmentElement}},
+				Dependents:   []libraryElementReference{{UID: panel.UID, Name: "Uptime", Kind: panelElement}},
+			}, result.Result)
+		})
+
+	testScenario(t, "When a library element references a library fragment that does not exist or itself, it should fail",
+		func(t *testing.T, sc scenarioContext) {
+			command := getCreateCommandWithModel(1, "Unknown fragment", `{ "type": "graph", "targets": [{ "libraryFragment": { "uid": "unknown" } }] }`)
+			response := sc.service.createHandler(sc.reqContext, command)
+			require.Equal(t, 400, response.Status())
+
+			base := createLibraryFragment(t, sc, "Base query", `{ "expr": "up" }`)
+			query := createLibraryFragment(t, sc, "Rate query", `{ "libraryFragment": { "uid": "`+base.UID+`" } }`)
+			for _, uid := range []string{base.UID, query.UID} {
+				sc.reqContext.ReplaceAllParams(map[string]string{":uid": base.UID})
+				response = sc.service.patchHandler(sc.reqContext, patchLibraryPanelCommand{
+					Model: []byte(`{ "libraryFragment": { "uid": "` + uid + `" } }`),
+				})
+				require.Equal(t, 400, response.Status())
+			}
+		})
+
+	testScenario(t, "When a library fragment that other library elements reference is deleted, it should fail",
+		func(t *testing.T, sc scenarioContext) {
+			base := createLibraryFragment(t, sc, "Base query", `{ "expr": "up" }`)
+			query := createLibraryFragment(t, sc, "Rate query", `{ "libraryFragment": { "uid": "`+base.UID+`" } }`)
+
+			sc.reqContext.ReplaceAllParams(map[string]string{":uid": base.UID})
+			response := sc.service.deleteHandler(sc.reqContext)
+			requireErrorCode(t, response, 409, errorCodeHasConnections)
+
+			for _, uid := range []string{query.UID, base.UID} {
+				sc.reqContext.ReplaceAllParams(map[string]string{":uid": uid})
+				response = sc.service.deleteHandler(sc.reqContext)
+				require.Equal(t, 200, response.Status())
+			}
+		})
+}
+
+func createLibraryFragment(t *testing.T, sc scenarioContext, name string, model string) libraryPanel {
+	t.Helper()
+
+	command := getCreateCommandWithModel(1, name, model)
+	command.Kind = fragmentElement
+	return createLibraryPanel(t, sc, command)
+}
@@ -0,0 +1,58 @@
+package librarypanels
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/grafana/pkg/services/sqlstore"
+)
+
+func TestModelCompression(t *testing.T) {
+	testScenario(t, "When models are compressed, they should be stored compressed and read decompressed",
+		func(t *testing.T, sc scenarioContext) {
+			sc.service.modelCompression = modelCompressionGzip
+
+			existing := createLibraryQuery(t, sc, "Up", `{ "datasource": "Prometheus", "expr": "up" }`)
+			require.True(t, isCompressedModel(getStoredModel(t, sc, existing.ID)))
+
+			libraryPanel, err := sc.service.getLibraryPanel(sc.reqContext, existing.UID)
+			require.NoError(t, err)
+			require.JSONEq(t, `{ "datasource": "Prometheus", "expr": "up" }`, string(libraryPanel.Model))
+			require.Equal(t, modelHash([]byte(`{ "datasource": "Prometheus", "expr": "up" }`)), libraryPanel.ModelHash)
+
+			// the database doesn't filter on paths inside the models until they are converted
+			sc.service.modelCompression = modelCompressionNone
+			uncompressed, err := sc.service.checkStoredModels()
+			require.NoError(t, err)
+			require.False(t, uncompressed)
+			require.False(t, sc.service.modelsFilterable())
+
+			converted, err := sc.service.convertStoredModels()
+			require.NoError(t, err)
+			require.Equal(t, 1, converted)
+			require.JSONEq(t, `{ "datasource": "Prometheus", "expr": "up" }`, string(getStoredModel(t, sc, existing.ID)))
+
+			converted, err = sc.service.convertStoredModels()
+			require.NoError(t, err)
+			require.Equal(t, 0, converted)
+			uncompressed, err = sc.service.checkStoredModels()
+			require.NoError(t, err)
+			require.True(t, uncompressed)
+			require.True(t, sc.service.modelsFilterable())
+		})
+}
+
+func getStoredModel(t *testing.T, sc scenarioContext, id int64) []byte {
+	t.Helper()
+
+	var stored string
+	err := sc.service.SQLStore.WithDbSession(context.Background(), func(session *sqlstore.DBSession) error {
+		_, err := session.SQL("SELECT model FROM library_panel WHERE id=?", id).Get(&stored)
+		return err
+	})
+	require.NoError(t, err)
+
+	return []byte(stored)
+}
@@ -0,0 +1,319 @@
+package librarypanels
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/components/simplejson"
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/sqlstore"
+)
+
+func TestLibraryPanelConnections(t *testing.T) {
+	testScenario(t, "When an admin lists the connections in the org, they should be paginated",
+		func(t *testing.T, sc scenarioContext) {
+			createUser := models.CreateUserCommand{Login: "auditor", Name: "Audrey Auditor", Email: "auditor@example.com", SkipOrgSetup: true}
+			err := bus.Dispatch(&createUser)
+			require.NoError(t, err)
+			require.Equal(t, sc.user.UserId, createUser.Result.Id)
+
+			first := createLibraryPanel(t, sc, getCreateCommand(0, "A first"))
+			second := createLibraryPanel(t, sc, getCreateCommand(0, "B second"))
+			dash := saveTestDashboard(t, `{ "title": "Audited", "panels": [] }`)
+			deleted := saveTestDashboard(t, `{ "title": "Deleted", "panels": [] }`)
+			for _, connection := range []struct {
+				uid         string
+				dashboardID int64
+			}{{first.UID, dash.Id}, {first.UID, deleted.Id}, {second.UID, dash.Id}} {
+				err := sc.service.connectDashboard(sc.reqContext, connection.uid, connection.dashboardID, 0)
+				require.NoError(t, err)
+			}
+			deleteTestDashboard(t, deleted)
+
+			result := getAllConnections(t, sc, "page=1&perpage=2")
+			require.Equal(t, int64(3), result.TotalCount)
+			require.Len(t, result.Connections, 2)
+			require.Equal(t, first.UID, result.Connections[0].LibraryPanelUID)
+			require.Equal(t, "Audited", result.Connections[0].DashboardTitle)
+			require.Equal(t, "auditor", result.Connections[0].CreatedByLogin)
+			require.Equal(t, "Audrey Auditor", result.Connections[0].CreatedByName)
+			require.Equal(t, "auditor@example.com", result.Connections[0].CreatedByEmail)
+			require.NotEmpty(t, result.Connections[0].CreatedByAvatarURL)
+			// the dashboard of the second connection doesn't exist anymore
+			require.Equal(t, deleted.Id, result.Connections[1].DashboardID)
+			require.Empty(t, result.Connections[1].DashboardTitle)
+
+			result = getAllConnections(t, sc, "page=2&perpage=2")
+			require.Len(t, result.Connections, 1)
+			require.Equal(t, "B second", result.Connections[0].LibraryPanelName)
+		})
+
+	testScenario(t, "When the connections of a library panel are listed, they should include who connected it",
+		func(t *testing.T, sc scenarioContext) {
+			createUser := models.CreateUserCommand{Login: "wirer", Name: "Wendy Wirer", Email: "wirer@example.com", SkipOrgSetup: true}
+			err := bus.Dispatch(&createUser)
+			require.NoError(t, err)
+			require.Equal(t, sc.user.UserId, createUser.Result.Id)
+
+			existing := createLibraryPanel(t, sc, getCreateCommand(0, "Text - Library Panel"))
+			dash := saveTestDashboard(t, `{ "title": "Wired", "panels": [] }`)
+			deleted := saveTestDashboard(t, `{ "title": "Deleted", "panels": [] }`)
+			for _, dashboardID := range []int64{dash.Id, deleted.Id} {
+				err := sc.service.connectDashboard(sc.reqContext, existing.UID, dashboardID, 0)
+				require.NoError(t, err)
+			}
+			deleteTestDashboard(t, deleted)
+
+			connections := getLibraryPanelConnections(t, sc, existing.UID)
+			require.Len(t, connections, 2)
+			require.Equal(t, "Wired", connections[0].DashboardTitle)
+			require.Equal(t, createUser.Result.Id, connections[0].CreatedBy)
+			require.Equal(t, "wirer", connections[0].CreatedByLogin)
+			require.Equal(t, "Wendy Wirer", connections[0].CreatedByName)
+			require.NotEmpty(t, connections[0].CreatedByAvatarURL)
+			require.Equal(t, deleted.Id, connections[1].DashboardID)
+
+			// viewers only get the connections to the dashboards they can view
+			sc.reqContext.SignedInUser = &models.SignedInUser{UserId: 2, OrgId: 1, OrgRole: models.ROLE_VIEWER}
+			connections = getLibraryPanelConnections(t, sc, existing.UID)
+			require.Len(t, connections, 1)
+			require.Equal(t, dash.Id, connections[0].DashboardID)
+
+			sc.reqContext.ReplaceAllParams(map[string]string{":uid": "unknown"})
+			response := sc.service.getConnectionsHandler(sc.reqContext)
+			requireErrorCode(t, response, 404, errorCodeNotFound)
+		})
+
+	testScenario(t, "When a library panel is connected with a panelId, the panel in the dashboard should be recorded",
+		func(t *testing.T, sc scenarioContext) {
+			existing := createLibraryPanel(t, sc, getCreateCommand(0, "Text - Library Panel"))
+			dash := saveTestDashboard(t, `{ "title": "Dashboard", "panels": [] }`)
+
+			sc.ctx.Req.Request = &http.Request{URL: &url.URL{RawQuery: "panelId=3"}}
+			sc.reqContext.ReplaceAllParams(map[string]string{":uid": existing.UID, ":dashboardId": strconv.FormatInt(dash.Id, 10)})
+			response := sc.service.connectHandler(sc.reqContext)
+			require.Equal(t, 200, response.Status())
+
+			result := getAllConnections(t, sc, "")
+			require.Len(t, result.Connections, 1)
+			require.Equal(t, int64(3), result.Connections[0].PanelID)
+
+			// connecting again without a panelId keeps the recorded panel
+			err := sc.service.connectDashboard(sc.reqContext, existing.UID, dash.Id, 0)
+			require.NoError(t, err)
+			result = getAllConnections(t, sc, "")
+			require.Equal(t, int64(3), result.Connections[0].PanelID)
+
+		})
+
+	testScenario(t, "When a connection without panel is connected with a panelId, the panel should be recorded",
+		func(t *testing.T, sc scenarioContext) {
+			existing := createLibraryPanel(t, sc, getCreateCommand(0, "Text - Library Panel"))
+			dash := saveTestDashboard(t, `{ "title": "Dashboard", "panels": [] }`)
+			err := sc.service.connectDashboard(sc.reqContext, existing.UID, dash.Id, 0)
+			require.NoError(t, err)
+
+			err = sc.service.connectDashboard(sc.reqContext, existing.UID, dash.Id, 5)
+			require.NoError(t, err)
+			result := getAllConnections(t, sc, "")
+			require.Len(t, result.Connections, 1)
+			require.Equal(t, int64(5), result.Connections[0].PanelID)
+		})
+
+	testScenario(t, "When a dashboard uses a library panel twice, each panel should have a connection",
+		func(t *testing.T, sc scenarioContext) {
+			existing := createLibraryPanel(t, sc, getCreateCommand(0, "Text - Library Panel"))
+			dash := saveTestDashboard(t, `{ "title": "Dashboard", "panels": [] }`)
+			for _, panelID := range []int64{3, 5, 5} {
+				err := sc.service.connectDashboard(sc.reqContext, existing.UID, dash.Id, panelID)
+				require.NoError(t, err)
+			}
+
+			result := getAllConnections(t, sc, "")
+			require.Len(t, result.Connections, 2)
+			dashboardIDs, err := sc.service.getConnectedDashboards(sc.reqContext, existing.UID)
+			require.NoError(t, err)
+			require.Equal(t, []int64{dash.Id}, dashboardIDs)
+
+			sc.ctx.Req.Request = &http.Request{URL: &url.URL{RawQuery: "panelId=3"}}
+			sc.reqContext.ReplaceAllParams(map[string]string{":uid": existing.UID, ":dashboardId": strconv.FormatInt(dash.Id, 10)})
+			response := sc.service.disconnectHandler(sc.reqContext)
+			require.Equal(t, 200, response.Status())
+			response = sc.service.disconnectHandler(sc.reqContext)
+			require.Equal(t, 404, response.Status())
+
+			result = getAllConnections(t, sc, "")
+			require.Len(t, result.Connections, 1)
+			require.Equal(t, int64(5), result.Connections[0].PanelID)
+
+			err = sc.service.connectDashboard(sc.reqContext, existing.UID, dash.Id, 7)
+			require.NoError(t, err)
+			// without a panelId all connections to the dashboard are removed
+			err = sc.service.disconnectDashboard(sc.reqContext, existing.UID, dash.Id, 0)
+			require.NoError(t, err)
+			result = getAllConnections(t, sc, "")
+			require.Empty(t, result.Connections)
+		})
+}
+
+func getAllConnections(t *testing.T, sc scenarioContext, rawQuery string) getAllConnectionsResult {
+	t.Helper()
+
+	sc.ctx.Req.Request = &http.Request{URL: &url.URL{RawQuery: rawQuery}}
+	response := sc.service.getAllConnectionsHandler(sc.reqContext)
+	require.Equal(t, 200, response.Status())
+
+	var result struct {
+		Result getAllConnectionsResult `json:"result"`
+	}
+	err := json.Unmarshal(response.Body(), &result)
+	require.NoError(t, err)
+
+	return result.Result
+}
+
+func getLibraryPanelConnections(t *testing.T, sc scenarioContext, uid string) []libraryPanelConnection {
+	t.Helper()
+
+	sc.reqContext.ReplaceAllParams(map[string]string{":uid": uid})
+	response := sc.service.getConnectionsHandler(sc.reqContext)
+	require.Equal(t, 200, response.Status())
+
+	var result struct {
+		Result []libraryPanelConnection `json:"result"`
+	}
+	err := json.Unmarshal(response.Body(), &result)
+	require.NoError(t, err)
+
+	return result.Result
+}
+
+func TestCrossOrgConnections(t *testing.T) {
+	testScenario(t, "When an admin connects a library panel to a dashboard of another org, it should fail like for a dashboard that doesn't exist",
+		func(t *testing.T, sc scenarioContext) {
+			existing := createLibraryPanel(t, sc, getCreateCommand(0, "Text - Library Panel"))
+			other := models.SaveDashboardCommand{OrgId: 2, Dashboard: simplejson.NewFromAny(map[string]interface{}{"title": "Other org"})}
+			err := bus.Dispatch(&other)
+			require.NoError(t, err)
+
+			sc.reqContext.ReplaceAllParams(map[string]string{":uid": existing.UID, ":dashboardId": strconv.FormatInt(other.Result.Id, 10)})
+			response := sc.service.connectHandler(sc.reqContext)
+			requireErrorCode(t, response, 404, errorCodeNotFound)
+			require.Contains(t, string(response.Body()), "dashboard could not be found")
+			connected, err := sc.service.getConnectedDashboards(sc.reqContext, existing.UID)
+			require.NoError(t, err)
+			require.Empty(t, connected)
+		})
+
+	testScenario(t, "When connections to dashboards of other orgs exist, the migration should delete them",
+		func(t *testing.T, sc scenarioContext) {
+			existing := createLibraryPanel(t, sc, getCreateCommand(0, "Text - Library Panel"))
+			dash := saveTestDashboard(t, `{ "title": "Same org", "panels": [] }`)
+			other := models.SaveDashboardCommand{OrgId: 2, Dashboard: simplejson.NewFromAny(map[string]interface{}{"title": "Other org"})}
+			err := bus.Dispatch(&other)
+			require.NoError(t, err)
+			err = sc.service.connectDashboard(sc.reqContext, existing.UID, dash.Id, 1)
+			require.NoError(t, err)
+			err = sc.service.SQLStore.WithDbSession(context.Background(), func(session *sqlstore.DBSession) error {
+				_, err := session.Insert(&libraryPanelDashboard{LibraryPanelID: existing.ID, DashboardID: other.Result.Id, PanelID: 1, Created: time.Now()})
+				if err != nil {
+					return err
+				}
+				_, err = session.Exec(deleteCrossOrgConnectionsSQL)
+				return err
+			})
+			require.NoError(t, err)
+
+			connected, err := sc.service.getConnectedDashboards(sc.reqContext, existing.UID)
+			require.NoError(t, err)
+			require.Equal(t, []int64{dash.Id}, connected)
+		})
+}
+
+func TestConnectionLimits(t *testing.T) {
+	testScenario(t, "When a library panel is connected to the maximum number of dashboards, connecting another dashboard should fail",
+		func(t *testing.T, sc scenarioContext) {
+			sc.service.Cfg.LibraryPanels.MaxDashboardsPerPanel = 2
+			existing := createLibraryPanel(t, sc, getCreateCommand(0, "Text - Library Panel"))
+			dashboardIDs := saveTestDashboards(t, 3)
+			for _, dashboardID := range dashboardIDs[:2] {
+				err := sc.service.connectDashboard(sc.reqContext, existing.UID, dashboardID, 0)
+				require.NoError(t, err)
+			}
+
+			err := sc.service.connectDashboard(sc.reqContext, existing.UID, dashboardIDs[2], 0)
+			require.ErrorIs(t, err, errLibraryPanelTooManyDashboards)
+			sc.reqContext.ReplaceAllParams(map[string]string{":uid": existing.UID, ":dashboardId": strconv.FormatInt(dashboardIDs[2], 10)})
+			response := sc.service.connectHandler(sc.reqContext)
+			requireErrorCode(t, response, 403, errorCodeQuotaExceeded)
+
+			// more panels of a connected dashboard don't count as another dashboard
+			err = sc.service.connectDashboard(sc.reqContext, existing.UID, dashboardIDs[1], 4)
+			require.NoError(t, err)
+			err = sc.service.connectDashboard(sc.reqContext, existing.UID, dashboardIDs[1], 5)
+			require.NoError(t, err)
+		})
+
+	testScenario(t, "When a dashboard has the maximum number of connections, connecting another library panel should fail",
+		func(t *testing.T, sc scenarioContext) {
+			sc.service.Cfg.LibraryPanels.MaxConnectionsPerDashboard = 2
+			first := createLibraryPanel(t, sc, getCreateCommand(0, "First"))
+			second := createLibraryPanel(t, sc, getCreateCommand(0, "Second"))
+			dashboardIDs := saveTestDashboards(t, 2)
+			err := sc.service.connectDashboard(sc.reqContext, first.UID, dashboardIDs[0], 1)
+			require.NoError(t, err)
+			err = sc.service.connectDashboard(sc.reqContext, second.UID, dashboardIDs[0], 2)
+			require.NoError(t, err)
+
+			err = sc.service.connectDashboard(sc.reqContext, first.UID, dashboardIDs[0], 3)
+			require.ErrorIs(t, err, errLibraryPanelTooManyConnections)
+			// connecting an existing connection again doesn't add one
+			err = sc.service.connectDashboard(sc.reqContext, second.UID, dashboardIDs[0], 2)
+			require.NoError(t, err)
+			err = sc.service.connectDashboard(sc.reqContext, second.UID, dashboardIDs[1], 1)
+			require.NoError(t, err)
+		})
+
+	testScenario(t, "When a connected library panel is deleted, its connections should not count against the dashboard",
+		func(t *testing.T, sc scenarioContext) {
+			sc.service.Cfg.LibraryPanels.MaxConnectionsPerDashboard = 1
+			first := createLibraryPanel(t, sc, getCreateCommand(0, "First"))
+			second := createLibraryPanel(t, sc, getCreateCommand(0, "Second"))
+			dashboardIDs := saveTestDashboards(t, 1)
+			err := sc.service.connectDashboard(sc.reqContext, first.UID, dashboardIDs[0], 1)
+			require.NoError(t, err)
+			err = sc.service.deleteLibraryPanel(sc.reqContext, first.UID)
+			require.NoError(t, err)
+
+			err = sc.service.connectDashboard(sc.reqContext, second.UID, dashboardIDs[0], 1)
+			require.NoError(t, err)
+			err = sc.service.SQLStore.WithDbSession(context.Background(), func(session *sqlstore.DBSession) error {
+				count, err := session.Where("librarypanel_id=?", first.ID).Count(&libraryPanelDashboard{})
+				require.Zero(t, count)
+				return err
+			})
+			require.NoError(t, err)
+		})
+
+	testScenario(t, "When a connected dashboard is deleted, its connection should not count against the library panel",
+		func(t *testing.T, sc scenarioContext) {
+			sc.service.Cfg.LibraryPanels.MaxDashboardsPerPanel = 1
+			existing := createLibraryPanel(t, sc, getCreateCommand(0, "Text - Library Panel"))
+			deleted := saveTestDashboard(t, `{ "title": "Deleted", "panels": [] }`)
+			err := sc.service.connectDashboard(sc.reqContext, existing.UID, deleted.Id, 1)
+			require.NoError(t, err)
+			deleteTestDashboard(t, deleted)
+
+			dashboardIDs := saveTestDashboards(t, 1)
+			err = sc.service.connectDashboard(sc.reqContext, existing.UID, dashboardIDs[0], 1)
+			require.NoError(t, err)
+		})
+}
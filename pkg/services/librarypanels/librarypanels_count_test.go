@@ -0,0 +1,53 @@
+package librarypanels
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/grafana/pkg/services/sqlstore"
+)
+
+func TestCountQueries(t *testing.T) {
+	testScenario(t, "When library elements are counted, they should be counted in SQL by org, folder, kind and connection",
+		func(t *testing.T, sc scenarioContext) {
+			first := createLibraryPanel(t, sc, getCreateCommand(0, "Text one"))
+			second := createLibraryPanel(t, sc, getCreateCommand(0, "Text two"))
+			createLibraryPanel(t, sc, getCreateCommand(1, "Text three"))
+			createLibraryPanel(t, sc, getCreateRowCommand(1, "Row"))
+			dashboardIDs := saveTestDashboards(t, 2)
+			err := sc.service.connectDashboard(sc.reqContext, first.UID, dashboardIDs[0], 0)
+			require.NoError(t, err)
+			err = sc.service.connectDashboard(sc.reqContext, first.UID, dashboardIDs[1], 0)
+			require.NoError(t, err)
+
+			err = sc.service.SQLStore.WithDbSession(context.Background(), func(session *sqlstore.DBSession) error {
+				count, err := countLibraryPanels(session, 1, 0)
+				require.NoError(t, err)
+				require.Equal(t, int64(4), count)
+				count, err = countLibraryPanels(session, 1, panelElement)
+				require.NoError(t, err)
+				require.Equal(t, int64(3), count)
+				count, err = countLibraryPanels(session, 2, 0)
+				require.NoError(t, err)
+				require.Equal(t, int64(0), count)
+
+				byFolder, err := countLibraryPanelsByFolder(session, 1, 0)
+				require.NoError(t, err)
+				require.Equal(t, map[int64]int64{0: 2, 1: 2}, byFolder)
+				byFolder, err = countLibraryPanelsByFolder(session, 1, panelElement)
+				require.NoError(t, err)
+				require.Equal(t, map[int64]int64{0: 2, 1: 1}, byFolder)
+
+				connections, err := countConnectedDashboardsByPanel(session, []int64{first.ID, second.ID})
+				require.NoError(t, err)
+				require.Equal(t, map[int64]int64{first.ID: 2}, connections)
+				connections, err = countConnectedDashboardsByPanel(session, nil)
+				require.NoError(t, err)
+				require.Empty(t, connections)
+				return nil
+			})
+			require.NoError(t, err)
+		})
+}
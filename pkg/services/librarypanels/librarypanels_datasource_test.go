@@ -0,0 +1,147 @@
+package librarypanels
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetDatasourceReferences(t *testing.T) {
+	testCases := []struct {
+		desc     string
+		model    string
+		expected []string
+	}{
+		{desc: "panel datasource by name", model: `{ "datasource": "gdev-testdata" }`, expected: []string{"gdev-testdata"}},
+		{desc: "panel datasource by uid", model: `{ "datasource": { "uid": "PD8C576611E62080A", "type": "testdata" } }`, expected: []string{"PD8C576611E62080A"}},
+		{
+			desc:     "mixed panel with query datasources",
+			model:    `{ "datasource": "-- Mixed --", "targets": [{ "datasource": "b" }, { "datasource": { "uid": "a" } }, { "datasource": "b" }] }`,
+			expected: []string{"a", "b"},
+		},
+		{desc: "no datasource", model: `{ "type": "text" }`, expected: []string{}},
+		{desc: "invalid model", model: `[`, expected: []string{}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			require.Equal(t, tc.expected, getDatasourceReferences(json.RawMessage(tc.model)))
+		})
+	}
+}
+
+func TestGetLibraryPanelsByDatasource(t *testing.T) {
+	testScenario(t, "When an admin gets library panels by datasource, panels referencing it in the panel or a query should be returned",
+		func(t *testing.T, sc scenarioContext) {
+			command := getCreateCommand(1, "Panel datasource")
+			command.Model = []byte(`{ "datasource": "gdev-prometheus", "type": "graph" }`)
+			panelDatasource := createLibraryPanel(t, sc, command)
+
+			command = getCreateCommand(1, "Query datasource")
+			command.Model = []byte(`{ "datasource": "-- Mixed --", "type": "graph", "targets": [{ "datasource": { "uid": "gdev-prometheus" } }] }`)
+			queryDatasource := createLibraryPanel(t, sc, command)
+
+			createLibraryPanel(t, sc, getCreateCommand(1, "Other datasource"))
+
+			sc.reqContext.ReplaceAllParams(map[string]string{":datasourceUid": "gdev-prometheus"})
+			response := sc.service.getByDatasourceHandler(sc.reqContext)
+			require.Equal(t, 200, response.Status())
+
+			var result libraryPanelsResult
+			err := json.Unmarshal(response.Body(), &result)
+			require.NoError(t, err)
+			require.Len(t, result.Result, 2)
+			require.Equal(t, panelDatasource.UID, result.Result[0].UID)
+			require.Equal(t, queryDatasource.UID, result.Result[1].UID)
+		})
+
+	testScenario(t, "When an admin patches the model of a library panel, its datasource references should be updated",
+		func(t *testing.T, sc scenarioContext) {
+			existing := createLibraryPanel(t, sc, getCreateCommand(1, "Text - Library Panel"))
+
+			cmd := patchLibraryPanelCommand{Model: []byte(`{ "datasource": "gdev-prometheus", "type": "graph" }`)}
+			sc.reqContext.ReplaceAllParams(map[string]string{":uid": existing.UID})
+			response := sc.service.patchHandler(sc.reqContext, cmd)
+			require.Equal(t, 200, response.Status())
+
+			for datasource, count := range map[string]int{"gdev-prometheus": 1, "${DS_GDEV-TESTDATA}": 0} {
+				sc.reqContext.ReplaceAllParams(map[string]string{":datasourceUid": datasource})
+				response = sc.service.getByDatasourceHandler(sc.reqContext)
+				require.Equal(t, 200, response.Status())
+
+				var result libraryPanelsResult
+				err := json.Unmarshal(response.Body(), &result)
+				require.NoError(t, err)
+				require.Len(t, result.Result, count)
+			}
+		})
+}
+
+func TestRewriteLibraryPanelDatasources(t *testing.T) {
+	testScenario(t, "When an admin rewrites a datasource in dry-run mode, the affected panels should be returned but not stored",
+		func(t *testing.T, sc scenarioContext) {
+			existing := createLibraryPanel(t, sc, getCreateCommand(1, "Text - Library Panel"))
+			createLibraryPanel(t, sc, getCreateCommandWithModel(1, "Other datasource", `{ "datasource": "gdev-prometheus", "type": "graph" }`))
+
+			cmd := rewriteDatasourceCommand{From: "${DS_GDEV-TESTDATA}", To: "gdev-testdata", DryRun: true}
+			response := sc.service.rewriteDatasourceHandler(sc.reqContext, cmd)
+			require.Equal(t, 200, response.Status())
+
+			var result rewriteDatasourceResponse
+			err := json.Unmarshal(response.Body(), &result)
+			require.NoError(t, err)
+			require.True(t, result.Result.DryRun)
+			require.Len(t, result.Result.LibraryPanels, 1)
+			require.Equal(t, existing.UID, result.Result.LibraryPanels[0].UID)
+			require.Equal(t, "gdev-testdata", result.Result.LibraryPanels[0].Model["datasource"])
+
+			panel, err := sc.service.getLibraryPanel(sc.reqContext, existing.UID)
+			require.NoError(t, err)
+			require.Equal(t, []string{"${DS_GDEV-TESTDATA}"}, getDatasourceReferences(panel.Model))
+		})
+
+	testScenario(t, "When an admin rewrites a datasource, the panel and query references should be stored",
+		func(t *testing.T, sc scenarioContext) {
+			existing := createLibraryPanel(t, sc, getCreateCommandWithModel(1, "Mixed",
+				`{ "datasource": "-- Mixed --", "type": "graph", "targets": [{ "datasource": { "uid": "old" } }, { "datasource": "other" }] }`))
+
+			cmd := rewriteDatasourceCommand{From: "old", To: "new"}
+			response := sc.service.rewriteDatasourceHandler(sc.reqContext, cmd)
+			require.Equal(t, 200, response.Status())
+
+			panel, err := sc.service.getLibraryPanel(sc.reqContext, existing.UID)
+			require.NoError(t, err)
+			require.Equal(t, []string{"new", "other"}, getDatasourceReferences(panel.Model))
+
+			sc.reqContext.ReplaceAllParams(map[string]string{":datasourceUid": "old"})
+			response = sc.service.getByDatasourceHandler(sc.reqContext)
+			require.Equal(t, 200, response.Status())
+
+			var result libraryPanelsResult
+			err = json.Unmarshal(response.Body(), &result)
+			require.NoError(t, err)
+			require.Len(t, result.Result, 0)
+		})
+
+	testScenario(t, "When an admin rewrites a datasource to itself, it should fail",
+		func(t *testing.T, sc scenarioContext) {
+			cmd := rewriteDatasourceCommand{From: "same", To: "same"}
+			response := sc.service.rewriteDatasourceHandler(sc.reqContext, cmd)
+			require.Equal(t, 400, response.Status())
+		})
+}
+
+func getCreateCommandWithModel(folderID int64, name string, model string) createLibraryPanelCommand {
+	command := getCreateCommand(folderID, name)
+	command.Model = []byte(model)
+
+	return command
+}
+
+type rewriteDatasourceResponse struct {
+	Result struct {
+		DryRun        bool           `json:"dryRun"`
+		LibraryPanels []libraryPanel `json:"libraryPanels"`
+	} `json:"result"`
+}
@@ -0,0 +1,84 @@
+package librarypanels
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/grafana/pkg/models"
+)
+
+func TestLibraryPanelDeprecation(t *testing.T) {
+	testScenario(t, "When a library panel is deprecated, the list and the report should show it",
+		func(t *testing.T, sc scenarioContext) {
+			old := createLibraryPanel(t, sc, getCreateCommand(0, "Old"))
+			replacement := createLibraryPanel(t, sc, getCreateCommand(0, "New"))
+			dash := saveTestDashboard(t, `{ "title": "Uses old panel", "panels": [] }`)
+			err := sc.service.connectDashboard(sc.reqContext, old.UID, dash.Id, 0)
+			require.NoError(t, err)
+			err = sc.service.connectDashboard(sc.reqContext, replacement.UID, dash.Id, 0)
+			require.NoError(t, err)
+
+			sc.reqContext.ReplaceAllParams(map[string]string{":uid": old.UID})
+			response := sc.service.deprecateHandler(sc.reqContext, deprecateLibraryPanelCommand{ReplacedBy: replacement.UID})
+			require.Equal(t, 200, response.Status())
+
+			sc.ctx.Req.Request = &http.Request{URL: &url.URL{}}
+			response = sc.service.getAllHandler(sc.reqContext)
+			require.Equal(t, 200, response.Status())
+			var result libraryPanelsResult
+			err = json.Unmarshal(response.Body(), &result)
+			require.NoError(t, err)
+			require.Len(t, result.Result, 2)
+			for _, panel := range result.Result {
+				require.Equal(t, panel.UID == old.UID, panel.Deprecated)
+				if panel.UID == old.UID {
+					require.Equal(t, replacement.UID, panel.ReplacedBy)
+				}
+			}
+
+			connections := getDeprecatedConnections(t, sc)
+			require.Len(t, connections, 1)
+			require.Equal(t, dash.Id, connections[0].DashboardID)
+			require.Equal(t, "Uses old panel", connections[0].DashboardTitle)
+			require.Equal(t, old.UID, connections[0].LibraryPanelUID)
+			require.Equal(t, replacement.UID, connections[0].ReplacedBy)
+
+			response = sc.service.undeprecateHandler(sc.reqContext)
+			require.Equal(t, 200, response.Status())
+			require.Empty(t, getDeprecatedConnections(t, sc))
+		})
+
+	testScenario(t, "When a library panel is replaced by itself or an unknown panel, it should fail",
+		func(t *testing.T, sc scenarioContext) {
+			existing := createLibraryPanel(t, sc, getCreateCommand(0, "Old"))
+			sc.reqContext.ReplaceAllParams(map[string]string{":uid": existing.UID})
+
+			response := sc.service.deprecateHandler(sc.reqContext, deprecateLibraryPanelCommand{ReplacedBy: existing.UID})
+			require.Equal(t, 400, response.Status())
+			response = sc.service.deprecateHandler(sc.reqContext, deprecateLibraryPanelCommand{ReplacedBy: "unknown"})
+			require.Equal(t, 400, response.Status())
+
+			sc.reqContext.SignedInUser = &models.SignedInUser{UserId: 2, OrgId: 1, OrgRole: models.ROLE_VIEWER}
+			response = sc.service.deprecateHandler(sc.reqContext, deprecateLibraryPanelCommand{})
+			require.Equal(t, 403, response.Status())
+		})
+}
+
+func getDeprecatedConnections(t *testing.T, sc scenarioContext) []deprecatedLibraryPanelConnection {
+	t.Helper()
+
+	response := sc.service.getDeprecatedConnectionsHandler(sc.reqContext)
+	require.Equal(t, 200, response.Status())
+
+	var result struct {
+		Result []deprecatedLibraryPanelConnection `json:"result"`
+	}
+	err := json.Unmarshal(response.Body(), &result)
+	require.NoError(t, err)
+
+	return result.Result
+}
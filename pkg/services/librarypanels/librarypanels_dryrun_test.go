@@ -0,0 +1,56 @@
+package librarypanels
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPatchLibraryPanelDryRun(t *testing.T) {
+	testScenario(t, "When an admin patches a library panel in dry-run mode, the result and diff should be returned but not stored",
+		func(t *testing.T, sc scenarioContext) {
+			existing := createLibraryPanel(t, sc, getCreateCommand(1, "Text - Library Panel"))
+
+			sc.ctx.Req.Request = &http.Request{URL: &url.URL{RawQuery: "dryRun=true"}}
+			sc.reqContext.ReplaceAllParams(map[string]string{":uid": existing.UID})
+			cmd := patchLibraryPanelCommand{Name: "Renamed", Tags: []string{"preview"}}
+			response := sc.service.patchHandler(sc.reqContext, cmd)
+			require.Equal(t, 200, response.Status())
+
+			var result struct {
+				Result patchPreview `json:"result"`
+			}
+			err := json.Unmarshal(response.Body(), &result)
+			require.NoError(t, err)
+			require.True(t, result.Result.DryRun)
+			require.Equal(t, "Renamed", result.Result.LibraryPanel.Name)
+			require.Equal(t, []string{"name", "tags"}, result.Result.Changes)
+			require.JSONEq(t, `{ "name": ["Text - Library Panel", "Renamed"], "tags": { "_t": "a", "0": ["preview"] } }`, string(result.Result.Diff))
+
+			panel, err := sc.service.getLibraryPanel(sc.reqContext, existing.UID)
+			require.NoError(t, err)
+			require.Equal(t, "Text - Library Panel", panel.Name)
+			require.Empty(t, panel.Tags)
+
+			response = sc.service.patchHandler(sc.reqContext, patchLibraryPanelCommand{})
+			require.Equal(t, 200, response.Status())
+			err = json.Unmarshal(response.Body(), &result)
+			require.NoError(t, err)
+			require.Empty(t, result.Result.Changes)
+			require.JSONEq(t, `{}`, string(result.Result.Diff))
+		})
+
+	testScenario(t, "When an admin patches a library panel in dry-run mode with an existing name, it should fail",
+		func(t *testing.T, sc scenarioContext) {
+			existing := createLibraryPanel(t, sc, getCreateCommand(1, "Text - Library Panel"))
+			createLibraryPanel(t, sc, getCreateCommand(1, "Another"))
+
+			sc.ctx.Req.Request = &http.Request{URL: &url.URL{RawQuery: "dryRun=true"}}
+			sc.reqContext.ReplaceAllParams(map[string]string{":uid": existing.UID})
+			response := sc.service.patchHandler(sc.reqContext, patchLibraryPanelCommand{Name: "Another"})
+			require.Equal(t, 400, response.Status())
+		})
+}
@@ -0,0 +1,133 @@
+package librarypanels
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/grafana/pkg/api/response"
+	"github.com/grafana/grafana/pkg/infra/log"
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/sqlstore"
+)
+
+func TestDuplicateLibraryPanels(t *testing.T) {
+	testScenario(t, "When library panels have the same type and targets, they should be reported as duplicates",
+		func(t *testing.T, sc scenarioContext) {
+			sc.service.log = log.New("librarypanels")
+			var uids []string
+			for name, model := range map[string]string{
+				"CPU":         `{"type": "graph", "title": "CPU", "targets": [{"refId": "A", "expr": "cpu"}]}`,
+				"CPU copy":    `{"type": "graph", "title": "CPU (copy)", "targets": [{"refId": "B", "expr": "cpu"}], "description": "Copied"}`,
+				"CPU as text": `{"type": "text", "title": "CPU", "targets": [{"refId": "A", "expr": "cpu"}]}`,
+				"Memory":      `{"type": "graph", "title": "Memory", "targets": [{"refId": "A", "expr": "memory"}]}`,
+			} {
+				command := getCreateCommand(0, name)
+				command.Model = []byte(model)
+				panel := createLibraryPanel(t, sc, command)
+				if name == "CPU" || name == "CPU copy" {
+					uids = append(uids, panel.UID)
+				}
+			}
+
+			response := sc.service.getDuplicatesHandler(sc.reqContext)
+			require.Empty(t, getDuplicateClusters(t, response))
+
+			response = sc.service.checkDuplicatesHandler(sc.reqContext)
+			clusters := getDuplicateClusters(t, response)
+			require.Len(t, clusters, 1)
+			require.Len(t, clusters[0].LibraryPanels, 2)
+			require.ElementsMatch(t, uids, []string{clusters[0].LibraryPanels[0].UID, clusters[0].LibraryPanels[1].UID})
+
+			// a deleted duplicate leaves no cluster until the next check
+			sc.reqContext.ReplaceAllParams(map[string]string{":uid": uids[0]})
+			response = sc.service.deleteHandler(sc.reqContext)
+			require.Equal(t, 200, response.Status())
+			response = sc.service.getDuplicatesHandler(sc.reqContext)
+			require.Empty(t, getDuplicateClusters(t, response))
+		})
+
+	testScenario(t, "When a library panel is merged into another, its connections and dashboard references should move and it should be archived",
+		func(t *testing.T, sc scenarioContext) {
+			into := createLibraryPanel(t, sc, getCreateCommand(0, "CPU"))
+			from := createLibraryPanel(t, sc, getCreateCommand(0, "CPU copy"))
+			dash := saveTestDashboard(t, `{"title": "Cluster", "panels": [
+				{"id": 1, "libraryPanel": {"uid": "`+from.UID+`", "name": "CPU copy"}},
+				{"id": 2, "libraryPanel": {"uid": "`+from.UID+`", "name": "CPU copy"}},
+				{"id": 3, "libraryPanel": {"uid": "`+into.UID+`", "name": "CPU"}}
+			]}`)
+			for uid, panelIDs := range map[string][]int64{from.UID: {1, 2}, into.UID: {3}} {
+				for _, panelID := range panelIDs {
+					err := sc.service.connectDashboard(sc.reqContext, uid, dash.Id, panelID)
+					require.NoError(t, err)
+				}
+			}
+
+			response := sc.service.mergeHandler(sc.reqContext, mergeLibraryPanelsCommand{From: from.UID, Into: into.UID})
+			require.Equal(t, 200, response.Status())
+			var result struct {
+				Result mergeLibraryPanelsResult `json:"result"`
+			}
+			err := json.Unmarshal(response.Body(), &result)
+			require.NoError(t, err)
+			require.Equal(t, int64(1), result.Result.Dashboards)
+			require.Equal(t, into.UID, result.Result.LibraryPanel.UID)
+
+			_, err = sc.service.getLibraryPanel(sc.reqContext, from.UID)
+			require.ErrorIs(t, err, errLibraryPanelNotFound)
+			var panelIDs []int64
+			err = sc.service.SQLStore.WithDbSession(context.Background(), func(session *sqlstore.DBSession) error {
+				return session.Table("library_panel_dashboard").Where("librarypanel_id=?", result.Result.LibraryPanel.ID).
+					OrderBy("panel_id ASC").Cols("panel_id").Find(&panelIDs)
+			})
+			require.NoError(t, err)
+			require.Equal(t, []int64{1, 2, 3}, panelIDs)
+
+			query := models.GetDashboardQuery{Id: dash.Id, OrgId: 1}
+			require.NoError(t, sqlstore.GetDashboard(&query))
+			require.Equal(t, dash.Version+1, query.Result.Version)
+			references := getLibraryPanelReferences(query.Result.Data)
+			require.Len(t, references[into.UID], 3)
+			require.Empty(t, references[from.UID])
+			require.Equal(t, "CPU", references[into.UID][0].Get("libraryPanel").Get("name").MustString())
+
+			var archives []libraryPanelArchive
+			err = sc.service.SQLStore.WithDbSession(context.Background(), func(session *sqlstore.DBSession) error {
+				return session.Table("library_panel_archive").Find(&archives)
+			})
+			require.NoError(t, err)
+			require.Len(t, archives, 1)
+			require.Equal(t, from.UID, archives[0].UID)
+
+			entries, err := sc.service.getFeedEntries(sc.reqContext)
+			require.NoError(t, err)
+			require.Equal(t, changeActionMerged, entries[0].Action)
+			require.Equal(t, from.UID, entries[0].LibraryPanelUID)
+			require.Equal(t, into.UID, entries[0].MergedIntoUID)
+		})
+
+	testScenario(t, "When a library panel is merged into itself, it should fail",
+		func(t *testing.T, sc scenarioContext) {
+			panel := createLibraryPanel(t, sc, getCreateCommand(0, "CPU"))
+
+			response := sc.service.mergeHandler(sc.reqContext, mergeLibraryPanelsCommand{From: panel.UID, Into: panel.UID})
+			requireErrorCode(t, response, 400, errorCodeInvalid)
+			response = sc.service.mergeHandler(sc.reqContext, mergeLibraryPanelsCommand{From: "unknown", Into: panel.UID})
+			requireErrorCode(t, response, 404, errorCodeNotFound)
+		})
+}
+
+func getDuplicateClusters(t *testing.T, resp response.Response) []duplicateCluster {
+	t.Helper()
+
+	require.Equal(t, 200, resp.Status())
+	var result struct {
+		Result []duplicateCluster `json:"result"`
+	}
+	err := json.Unmarshal(resp.Body(), &result)
+	require.NoError(t, err)
+
+	return result.Result
+}
@@ -0,0 +1,133 @@
+package librarypanels
+
+import (
+	"encoding/json"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/grafana/pkg/api/response"
+	"github.com/grafana/grafana/pkg/infra/log"
+	"github.com/grafana/grafana/pkg/models"
+)
+
+func TestLibraryPanelEditSuggestions(t *testing.T) {
+	testScenario(t, "When a viewer suggests an edit, the owners should be notified and an editor should be able to apply it",
+		func(t *testing.T, sc scenarioContext) {
+			sc.service.log = log.New("librarypanels")
+			viewer := createNotificationTestUsers(t)
+			existing := createLibraryPanel(t, sc, getCreateCommand(0, "CPU"))
+
+			sc.reqContext.SignedInUser = &models.SignedInUser{UserId: viewer.Id, OrgId: 1, OrgRole: models.ROLE_VIEWER, Login: "owner"}
+			sc.reqContext.ReplaceAllParams(map[string]string{":uid": existing.UID})
+			model := json.RawMessage(`{"id": 1, "title": "CPU usage", "type": "text"}`)
+			response := sc.service.suggestEditHandler(sc.reqContext, suggestEditCommand{Model: model, Comment: "Better title"})
+			require.Equal(t, 200, response.Status())
+
+			sc.reqContext.SignedInUser = &sc.user
+			notifications := getNotifications(t, sc)
+			require.Len(t, notifications, 1)
+			require.Equal(t, "owner suggested an edit to library panel CPU", notifications[0].Summary)
+
+			suggestions := getEditSuggestions(t, sc)
+			require.Len(t, suggestions, 1)
+			require.Equal(t, "Better title", suggestions[0].Comment)
+			require.Equal(t, viewer.Id, suggestions[0].CreatedBy)
+
+			sc.reqContext.SignedInUser.Login = "editor"
+			sc.reqContext.ReplaceAllParams(map[string]string{":uid": existing.UID, ":id": strconv.FormatInt(suggestions[0].ID, 10)})
+			response = sc.service.applyEditSuggestionHandler(sc.reqContext)
+			review := getEditSuggestionReview(t, response)
+			require.Equal(t, editSuggestionStatusApplied, review.Suggestion.Status)
+			require.Equal(t, sc.user.UserId, *review.Suggestion.ReviewedBy)
+			require.Equal(t, sc.user.UserId, review.LibraryPanel.UpdatedBy)
+			require.JSONEq(t, `{"title": "CPU usage", "type": "text"}`, string(review.LibraryPanel.Model))
+			require.Empty(t, getEditSuggestions(t, sc))
+
+			// a suggestion can only be reviewed once
+			response = sc.service.rejectEditSuggestionHandler(sc.reqContext)
+			requireErrorCode(t, response, 404, errorCodeNotFound)
+
+			sc.reqContext.SignedInUser = &models.SignedInUser{UserId: viewer.Id, OrgId: 1, OrgRole: models.ROLE_VIEWER}
+			notifications = getNotifications(t, sc)
+			require.Len(t, notifications, 1)
+			require.Equal(t, "editor applied your suggested edit to library panel CPU", notifications[0].Summary)
+		})
+
+	testScenario(t, "When an edit suggestion is rejected, the library panel should not change",
+		func(t *testing.T, sc scenarioContext) {
+			sc.service.log = log.New("librarypanels")
+			team := createTestTeam(t, sc, "Platform")
+			command := getCreateCommand(0, "CPU")
+			command.OwnerTeamID = team.Id
+			existing := createLibraryPanel(t, sc, command)
+
+			sc.reqContext.SignedInUser = &models.SignedInUser{UserId: 2, OrgId: 1, OrgRole: models.ROLE_EDITOR}
+			sc.reqContext.ReplaceAllParams(map[string]string{":uid": existing.UID})
+			response := sc.service.suggestEditHandler(sc.reqContext, suggestEditCommand{Model: json.RawMessage(`{"id": 1, "type": "graph"}`)})
+			require.Equal(t, 200, response.Status())
+			suggestions := getEditSuggestions(t, sc)
+			require.Len(t, suggestions, 1)
+
+			// editors outside of the owning team can suggest edits but not review them
+			sc.reqContext.ReplaceAllParams(map[string]string{":uid": existing.UID, ":id": strconv.FormatInt(suggestions[0].ID, 10)})
+			response = sc.service.applyEditSuggestionHandler(sc.reqContext)
+			requireErrorCode(t, response, 403, errorCodePermissionDenied)
+
+			sc.reqContext.SignedInUser = &sc.user
+			response = sc.service.rejectEditSuggestionHandler(sc.reqContext)
+			review := getEditSuggestionReview(t, response)
+			require.Equal(t, editSuggestionStatusRejected, review.Suggestion.Status)
+			require.Nil(t, review.LibraryPanel)
+
+			panel, err := sc.service.getLibraryPanel(sc.reqContext, existing.UID)
+			require.NoError(t, err)
+			require.Equal(t, existing.UID, panel.UID)
+			require.JSONEq(t, `{"datasource": "${DS_GDEV-TESTDATA}", "name": "Text - Library Panel", "type": "text"}`, string(panel.Model))
+		})
+
+	testScenario(t, "When an edit suggestion has no model or a too long comment, it should fail",
+		func(t *testing.T, sc scenarioContext) {
+			existing := createLibraryPanel(t, sc, getCreateCommand(0, "CPU"))
+
+			sc.reqContext.ReplaceAllParams(map[string]string{":uid": existing.UID})
+			response := sc.service.suggestEditHandler(sc.reqContext, suggestEditCommand{Comment: "No model"})
+			requireErrorCode(t, response, 400, errorCodeInvalid)
+
+			comment := make([]rune, maxCommentLength+1)
+			for i := range comment {
+				comment[i] = 'a'
+			}
+			response = sc.service.suggestEditHandler(sc.reqContext, suggestEditCommand{Model: json.RawMessage(`{"id": 1, "type": "text"}`), Comment: string(comment)})
+			requireErrorCode(t, response, 400, errorCodeInvalid)
+		})
+}
+
+func getEditSuggestions(t *testing.T, sc scenarioContext) []libraryPanelEditSuggestion {
+	t.Helper()
+
+	response := sc.service.getEditSuggestionsHandler(sc.reqContext)
+	require.Equal(t, 200, response.Status())
+
+	var result struct {
+		Result []libraryPanelEditSuggestion `json:"result"`
+	}
+	err := json.Unmarshal(response.Body(), &result)
+	require.NoError(t, err)
+
+	return result.Result
+}
+
+func getEditSuggestionReview(t *testing.T, resp response.Response) editSuggestionReview {
+	t.Helper()
+
+	require.Equal(t, 200, resp.Status())
+	var result struct {
+		Result editSuggestionReview `json:"result"`
+	}
+	err := json.Unmarshal(resp.Body(), &result)
+	require.NoError(t, err)
+
+	return result.Result
+}
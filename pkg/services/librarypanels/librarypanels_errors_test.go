@@ -0,0 +1,49 @@
+package librarypanels
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/grafana/pkg/api/response"
+)
+
+func TestLibraryPanelErrorResponses(t *testing.T) {
+	testScenario(t, "When library panel requests fail, the responses should have a machine readable code",
+		func(t *testing.T, sc scenarioContext) {
+			existing := createLibraryPanel(t, sc, getCreateCommand(0, "Coded"))
+
+			response := sc.service.createHandler(sc.reqContext, getCreateCommand(0, "Coded"))
+			requireErrorCode(t, response, 400, errorCodeAlreadyExists)
+
+			sc.reqContext.ReplaceAllParams(map[string]string{":uid": "unknown"})
+			response = sc.service.getHandler(sc.reqContext)
+			requireErrorCode(t, response, 404, errorCodeNotFound)
+
+			sc.reqContext.ReplaceAllParams(map[string]string{":uid": existing.UID})
+			sc.ctx.Req.Request = &http.Request{URL: &url.URL{}, Header: http.Header{"If-Match": []string{`"stale"`}}}
+			response = sc.service.patchHandler(sc.reqContext, patchLibraryPanelCommand{Name: "Changed"})
+			requireErrorCode(t, response, 412, errorCodeVersionMismatch)
+
+			sc.ctx.Req.Request = &http.Request{URL: &url.URL{}}
+			response = sc.service.patchHandler(sc.reqContext, patchLibraryPanelCommand{Model: []byte(`[]`)})
+			requireErrorCode(t, response, 400, errorCodeInvalid)
+		})
+}
+
+func requireErrorCode(t *testing.T, resp response.Response, status int, code libraryPanelErrorCode) {
+	t.Helper()
+
+	require.Equal(t, status, resp.Status())
+	var result struct {
+		Code    libraryPanelErrorCode `json:"code"`
+		Message string                `json:"message"`
+	}
+	err := json.Unmarshal(resp.Body(), &result)
+	require.NoError(t, err)
+	require.Equal(t, code, result.Code)
+	require.NotEmpty(t, result.Message)
+}
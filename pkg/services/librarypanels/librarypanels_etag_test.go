@@ -0,0 +1,56 @@
+package librarypanels
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLibraryPanelETag(t *testing.T) {
+	testScenario(t, "When a library panel is patched with If-Match, the ETag should have to be current",
+		func(t *testing.T, sc scenarioContext) {
+			existing := createLibraryPanel(t, sc, getCreateCommand(0, "Conditional"))
+			panel, err := sc.service.getLibraryPanel(sc.reqContext, existing.UID)
+			require.NoError(t, err)
+			etag := libraryPanelETag(panel)
+
+			sc.reqContext.ReplaceAllParams(map[string]string{":uid": existing.UID})
+			sc.ctx.Req.Request = &http.Request{URL: &url.URL{}, Header: http.Header{"If-Match": []string{etag}}}
+			patched, err := sc.service.patchLibraryPanel(sc.reqContext, patchLibraryPanelCommand{Name: "First change"}, existing.UID)
+			require.NoError(t, err)
+
+			// the ETag of the patch result is the one later reads get
+			panel, err = sc.service.getLibraryPanel(sc.reqContext, existing.UID)
+			require.NoError(t, err)
+			require.Equal(t, libraryPanelETag(patched), libraryPanelETag(panel))
+			require.NotEqual(t, etag, libraryPanelETag(panel))
+
+			// the stale ETag is rejected, for patches and deletes
+			response := sc.service.patchHandler(sc.reqContext, patchLibraryPanelCommand{Name: "Lost update"})
+			require.Equal(t, 412, response.Status())
+			response = sc.service.deleteHandler(sc.reqContext)
+			require.Equal(t, 412, response.Status())
+
+			sc.ctx.Req.Request.Header.Set("If-Match", `W/`+libraryPanelETag(panel))
+			response = sc.service.deleteHandler(sc.reqContext)
+			require.Equal(t, 412, response.Status())
+
+			sc.ctx.Req.Request.Header.Set("If-Match", `"other", `+libraryPanelETag(panel))
+			response = sc.service.deleteHandler(sc.reqContext)
+			require.Equal(t, 200, response.Status())
+		})
+
+	testScenario(t, "When a library panel is patched without If-Match or with a wildcard, it should be updated",
+		func(t *testing.T, sc scenarioContext) {
+			existing := createLibraryPanel(t, sc, getCreateCommand(0, "Unconditional"))
+			sc.reqContext.ReplaceAllParams(map[string]string{":uid": existing.UID})
+
+			response := sc.service.patchHandler(sc.reqContext, patchLibraryPanelCommand{Name: "Changed"})
+			require.Equal(t, 200, response.Status())
+			sc.ctx.Req.Request = &http.Request{URL: &url.URL{}, Header: http.Header{"If-Match": []string{"*"}}}
+			response = sc.service.patchHandler(sc.reqContext, patchLibraryPanelCommand{Name: "Changed again"})
+			require.Equal(t, 200, response.Status())
+		})
+}
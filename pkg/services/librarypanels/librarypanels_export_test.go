@@ -0,0 +1,67 @@
+package librarypanels
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/macaron.v1"
+
+	"github.com/grafana/grafana/pkg/infra/log"
+	"github.com/grafana/grafana/pkg/models"
+)
+
+func TestExportLibraryPanels(t *testing.T) {
+	testScenario(t, "When an admin exports the library panels, all of them should be streamed, gzipped if accepted",
+		func(t *testing.T, sc scenarioContext) {
+			// more than a batch, so the export writes several batches
+			for i := 0; i <= exportBatchSize; i++ {
+				command := getCreateCommand(1, fmt.Sprintf("Panel %03d", i))
+				if i == exportBatchSize {
+					command.Tags = []string{"last"}
+				}
+				createLibraryPanel(t, sc, command)
+			}
+
+			m := macaron.New()
+			m.Get("/api/library-panels/export", func(c *macaron.Context) {
+				reqContext := &models.ReqContext{Context: c, SignedInUser: &sc.user, Logger: log.New("test")}
+				sc.service.exportHandler(reqContext).WriteTo(reqContext)
+			})
+			export := func(acceptEncoding string) []libraryPanel {
+				recorder := httptest.NewRecorder()
+				request := httptest.NewRequest("GET", "/api/library-panels/export", nil)
+				request.Header.Set("Accept-Encoding", acceptEncoding)
+				m.ServeHTTP(recorder, request)
+				require.Equal(t, 200, recorder.Code)
+				require.Equal(t, "application/json", recorder.Header().Get("Content-Type"))
+
+				var body io.Reader = recorder.Body
+				if acceptEncoding == "gzip" {
+					require.Equal(t, "gzip", recorder.Header().Get("Content-Encoding"))
+					gz, err := gzip.NewReader(recorder.Body)
+					require.NoError(t, err)
+					body = gz
+				} else {
+					require.Empty(t, recorder.Header().Get("Content-Encoding"))
+				}
+
+				var result libraryPanelsResult
+				err := json.NewDecoder(body).Decode(&result)
+				require.NoError(t, err)
+				return result.Result
+			}
+
+			for _, acceptEncoding := range []string{"", "gzip"} {
+				panels := export(acceptEncoding)
+				require.Len(t, panels, exportBatchSize+1)
+				require.Equal(t, "Panel 000", panels[0].Name)
+				require.Equal(t, "text", panels[0].Model["type"])
+				require.Equal(t, []string{"last"}, panels[exportBatchSize].Tags)
+			}
+		})
+}
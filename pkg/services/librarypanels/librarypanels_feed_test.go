@@ -0,0 +1,80 @@
+package librarypanels
+
+import (
+	"encoding/xml"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/components/simplejson"
+	"github.com/grafana/grafana/pkg/models"
+)
+
+func TestLibraryPanelFeed(t *testing.T) {
+	testScenario(t, "When library panels are created, updated and deleted, the feed should have the changes newest first",
+		func(t *testing.T, sc scenarioContext) {
+			sc.service.Cfg.AppURL = "https://grafana.example.com/"
+			existing := createLibraryPanel(t, sc, getCreateCommand(0, "CPU"))
+			sc.reqContext.ReplaceAllParams(map[string]string{":uid": existing.UID})
+			response := sc.service.patchHandler(sc.reqContext, patchLibraryPanelCommand{Name: "CPU usage"})
+			require.Equal(t, 200, response.Status())
+			response = sc.service.deleteHandler(sc.reqContext)
+			require.Equal(t, 200, response.Status())
+
+			response = sc.service.feedHandler(sc.reqContext)
+			require.Equal(t, 200, response.Status())
+			var feed atomFeed
+			err := xml.Unmarshal(response.Body(), &feed)
+			require.NoError(t, err)
+			require.Len(t, feed.Entries, 3)
+			var titles []string
+			for _, entry := range feed.Entries {
+				titles = append(titles, entry.Title)
+			}
+			require.Equal(t, []string{
+				"Library panel CPU usage deleted",
+				"Library panel CPU usage updated",
+				"Library panel CPU created",
+			}, titles)
+			require.Equal(t, "https://grafana.example.com/api/library-panels/"+existing.UID+"?orgId=1", feed.Entries[0].Link.Href)
+
+			sc.ctx.Req.Form.Set("format", "rss")
+			response = sc.service.feedHandler(sc.reqContext)
+			require.Equal(t, 200, response.Status())
+			var rss rssFeed
+			err = xml.Unmarshal(response.Body(), &rss)
+			require.NoError(t, err)
+			require.Len(t, rss.Channel.Items, 3)
+			require.Equal(t, "Library panel CPU usage deleted", rss.Channel.Items[0].Title)
+
+			sc.ctx.Req.Form.Set("format", "json")
+			response = sc.service.feedHandler(sc.reqContext)
+			requireErrorCode(t, response, 400, errorCodeInvalid)
+		})
+
+	testScenario(t, "When a user can't view a folder, the feed should not have the changes of its library panels",
+		func(t *testing.T, sc scenarioContext) {
+			folder := models.SaveDashboardCommand{OrgId: 1, IsFolder: true, Dashboard: simplejson.NewFromAny(map[string]interface{}{"title": "Restricted"})}
+			err := bus.Dispatch(&folder)
+			require.NoError(t, err)
+			err = bus.Dispatch(&models.UpdateDashboardAclCommand{
+				DashboardID: folder.Result.Id,
+				Items: []*models.DashboardAcl{{
+					OrgID: 1, DashboardID: folder.Result.Id, UserID: 2, Permission: models.PERMISSION_VIEW,
+					Created: time.Now(), Updated: time.Now(),
+				}},
+			})
+			require.NoError(t, err)
+			createLibraryPanel(t, sc, getCreateCommand(folder.Result.Id, "Restricted"))
+			createLibraryPanel(t, sc, getCreateCommand(0, "Open"))
+
+			sc.reqContext.SignedInUser = &models.SignedInUser{UserId: 3, OrgId: 1, OrgRole: models.ROLE_VIEWER}
+			entries, err := sc.service.getFeedEntries(sc.reqContext)
+			require.NoError(t, err)
+			require.Len(t, entries, 1)
+			require.Equal(t, "Open", entries[0].Name)
+			require.Equal(t, changeActionCreated, entries[0].Action)
+		})
+}
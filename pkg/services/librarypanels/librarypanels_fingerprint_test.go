@@ -0,0 +1,102 @@
+package librarypanels
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/grafana/pkg/services/sqlstore"
+)
+
+func TestLibraryPanelFingerprint(t *testing.T) {
+	testScenario(t, "When a library panel is read, its fingerprint should only change with its content",
+		func(t *testing.T, sc scenarioContext) {
+			response := sc.service.createHandler(sc.reqContext, getCreateCommand(1, "Text - Library Panel"))
+			require.Equal(t, 200, response.Status())
+			var created struct {
+				Result struct {
+					ID          int64  `json:"id"`
+					UID         string `json:"uid"`
+					Fingerprint string `json:"fingerprint"`
+				} `json:"result"`
+			}
+			err := json.Unmarshal(response.Body(), &created)
+			require.NoError(t, err)
+			existing := created.Result
+			require.NotEmpty(t, existing.Fingerprint)
+
+			sc.reqContext.ReplaceAllParams(map[string]string{":uid": existing.UID})
+			fetched := getLibraryPanelFromHandler(t, sc)
+			require.Equal(t, existing.Fingerprint, fetched.Fingerprint)
+
+			// a model stored before models were normalized
+			err = sc.service.SQLStore.WithDbSession(context.Background(), func(session *sqlstore.DBSession) error {
+				_, err := session.Exec("UPDATE library_panel SET model=? WHERE id=?",
+					`{"type": "text", "id": 7, "links": [], "name": "Text - Library Panel", "datasource": "${DS_GDEV-TESTDATA}"}`, existing.ID)
+				return err
+			})
+			require.NoError(t, err)
+			sc.service.invalidateLibraryPanelCache()
+			fetched = getLibraryPanelFromHandler(t, sc)
+			require.Equal(t, existing.Fingerprint, fetched.Fingerprint)
+			require.Equal(t, map[string]interface{}{
+				"datasource": "${DS_GDEV-TESTDATA}",
+				"name":       "Text - Library Panel",
+				"type":       "text",
+			}, fetched.Model)
+
+			sc.reqContext.UserId = 2
+			response = sc.service.patchHandler(sc.reqContext, patchLibraryPanelCommand{Tags: []string{"drift"}})
+			require.Equal(t, 200, response.Status())
+			fetched = getLibraryPanelFromHandler(t, sc)
+			require.NotEqual(t, existing.Fingerprint, fetched.Fingerprint)
+		})
+
+	testScenario(t, "When a published and deprecated library panel is patched, the response should have the fingerprint of getting it",
+		func(t *testing.T, sc scenarioContext) {
+			existing := createLibraryPanel(t, sc, getCreateCommand(1, "Text - Library Panel"))
+			_, err := sc.service.publishLibraryPanel(sc.reqContext, existing.UID)
+			require.NoError(t, err)
+			_, err = sc.service.setLibraryPanelDeprecation(sc.reqContext, existing.UID, true, "")
+			require.NoError(t, err)
+
+			sc.reqContext.ReplaceAllParams(map[string]string{":uid": existing.UID})
+			response := sc.service.patchHandler(sc.reqContext, patchLibraryPanelCommand{Tags: []string{"drift"}})
+			require.Equal(t, 200, response.Status())
+			var patched struct {
+				Result struct {
+					Status      string `json:"status"`
+					Deprecated  bool   `json:"deprecated"`
+					Fingerprint string `json:"fingerprint"`
+				} `json:"result"`
+			}
+			err = json.Unmarshal(response.Body(), &patched)
+			require.NoError(t, err)
+			require.Equal(t, "published", patched.Result.Status)
+			require.True(t, patched.Result.Deprecated)
+
+			fetched := getLibraryPanelFromHandler(t, sc)
+			require.Equal(t, fetched.Fingerprint, patched.Result.Fingerprint)
+		})
+}
+
+type fingerprintedLibraryPanel struct {
+	Model       map[string]interface{} `json:"model"`
+	Fingerprint string                 `json:"fingerprint"`
+}
+
+func getLibraryPanelFromHandler(t *testing.T, sc scenarioContext) fingerprintedLibraryPanel {
+	t.Helper()
+
+	response := sc.service.getHandler(sc.reqContext)
+	require.Equal(t, 200, response.Status())
+	var result struct {
+		Result fingerprintedLibraryPanel `json:"result"`
+	}
+	err := json.Unmarshal(response.Body(), &result)
+	require.NoError(t, err)
+
+	return result.Result
+}
@@ -0,0 +1,75 @@
+package librarypanels
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/components/simplejson"
+	"github.com/grafana/grafana/pkg/models"
+)
+
+func TestFolderLibraryPanels(t *testing.T) {
+	testScenario(t, "When library panels of a folder are requested, only the folder's panels should be returned to users who can view it",
+		func(t *testing.T, sc scenarioContext) {
+			open := models.SaveDashboardCommand{OrgId: 1, IsFolder: true, Dashboard: simplejson.NewFromAny(map[string]interface{}{"title": "Open"})}
+			require.NoError(t, bus.Dispatch(&open))
+			restricted := models.SaveDashboardCommand{OrgId: 1, IsFolder: true, Dashboard: simplejson.NewFromAny(map[string]interface{}{"title": "Restricted"})}
+			require.NoError(t, bus.Dispatch(&restricted))
+			require.NoError(t, bus.Dispatch(&models.UpdateDashboardAclCommand{
+				DashboardID: restricted.Result.Id,
+				Items: []*models.DashboardAcl{{
+					OrgID: 1, DashboardID: restricted.Result.Id, UserID: 2, Permission: models.PERMISSION_VIEW,
+					Created: time.Now(), Updated: time.Now(),
+				}},
+			}))
+			createLibraryPanel(t, sc, getCreateCommand(0, "General"))
+			createLibraryPanel(t, sc, getCreateCommand(open.Result.Id, "Open"))
+			createLibraryPanel(t, sc, getCreateCommand(restricted.Result.Id, "Restricted"))
+
+			sc.reqContext.ReplaceAllParams(map[string]string{":uid": open.Result.Uid})
+			response := sc.service.getAllInFolderHandler(sc.reqContext)
+			require.Equal(t, 200, response.Status())
+			var result libraryPanelsResult
+			require.NoError(t, json.Unmarshal(response.Body(), &result))
+			require.Len(t, result.Result, 1)
+			require.Equal(t, "Open", result.Result[0].Name)
+
+			sc.reqContext.ReplaceAllParams(map[string]string{":uid": restricted.Result.Uid})
+			sc.reqContext.SignedInUser = &models.SignedInUser{UserId: 2, OrgId: 1, OrgRole: models.ROLE_VIEWER}
+			response = sc.service.getAllInFolderHandler(sc.reqContext)
+			require.Equal(t, 200, response.Status())
+			require.NoError(t, json.Unmarshal(response.Body(), &result))
+			require.Len(t, result.Result, 1)
+			require.Equal(t, "Restricted", result.Result[0].Name)
+
+			sc.reqContext.SignedInUser = &models.SignedInUser{UserId: 3, OrgId: 1, OrgRole: models.ROLE_VIEWER}
+			response = sc.service.getAllInFolderHandler(sc.reqContext)
+			require.Equal(t, 404, response.Status())
+
+			sc.reqContext.ReplaceAllParams(map[string]string{":uid": "unknown"})
+			sc.reqContext.SignedInUser = &sc.user
+			response = sc.service.getAllInFolderHandler(sc.reqContext)
+			require.Equal(t, 404, response.Status())
+		})
+
+	testScenario(t, "When a library panel is created in a folder, it should be in that folder",
+		func(t *testing.T, sc scenarioContext) {
+			folder := models.SaveDashboardCommand{OrgId: 1, IsFolder: true, Dashboard: simplejson.NewFromAny(map[string]interface{}{"title": "Team"})}
+			require.NoError(t, bus.Dispatch(&folder))
+
+			sc.reqContext.ReplaceAllParams(map[string]string{":uid": folder.Result.Uid})
+			response := sc.service.createInFolderHandler(sc.reqContext, getCreateCommand(0, "Text - Library Panel"))
+			require.Equal(t, 200, response.Status())
+			var result libraryPanelResult
+			require.NoError(t, json.Unmarshal(response.Body(), &result))
+			require.Equal(t, folder.Result.Id, result.Result.FolderID)
+
+			sc.reqContext.SignedInUser = &models.SignedInUser{UserId: 2, OrgId: 1, OrgRole: models.ROLE_VIEWER}
+			response = sc.service.createInFolderHandler(sc.reqContext, getCreateCommand(0, "Another"))
+			require.Equal(t, 403, response.Status())
+		})
+}
@@ -0,0 +1,211 @@
+package librarypanels
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLibraryPanelGitSync(t *testing.T) {
+	testScenario(t, "When an admin configures an unsafe git sync, it should fail",
+		func(t *testing.T, sc scenarioContext) {
+			for _, cmd := range []updateGitSyncCommand{
+				{Repository: "ext::sh -c touch% /tmp/pwned", Branch: "main"},
+				{Repository: "file:///etc", Branch: "main"},
+				{Repository: "https://example.com/panels.git", Branch: "--upload-pack=touch"},
+				{Repository: "https://example.com/panels.git", Branch: "main", Path: "../../etc"},
+				{Repository: "https://example.com/panels.git", Branch: "main", IntervalSeconds: 10},
+			} {
+				response := sc.service.updateGitSyncHandler(sc.reqContext, cmd)
+				require.Equal(t, 400, response.Status(), cmd)
+			}
+		})
+
+	testScenario(t, "When the library panels are synced, they should match the panel files in the repository",
+		func(t *testing.T, sc scenarioContext) {
+			fetcher := &fakeGitFetcher{files: map[string]string{
+				"panels/cpu.json":       `{ "uid": "cpu", "model": { "type": "graph", "title": "CPU" }, "tags": ["node"] }`,
+				"panels/memory.json":    `{ "name": "Memory usage", "model": { "type": "graph" } }`,
+				"panels/README.md":      `not a panel`,
+				"dashboards/other.json": `{ "model": { "type": "unknown-panel" } }`,
+			}}
+			sc.service.gitFetcher = fetcher
+			sc.service.Cfg.DataPath = t.TempDir()
+			response := sc.service.updateGitSyncHandler(sc.reqContext, updateGitSyncCommand{
+				Enabled:    true,
+				Repository: "https://example.com/panels.git",
+				Branch:     "main",
+				Path:       "panels",
+			})
+			require.Equal(t, 200, response.Status())
+
+			result := runGitSync(t, sc)
+			require.Equal(t, "commit-1", result.Commit)
+			require.Len(t, result.Created, 2)
+			require.Contains(t, result.Created, "cpu")
+
+			cpu, err := sc.service.getLibraryPanel(sc.reqContext, "cpu")
+			require.NoError(t, err)
+			require.Equal(t, "cpu", cpu.Name)
+			require.Equal(t, []string{"node"}, cpu.Tags)
+			require.Equal(t, "cpu.json", cpu.SyncPath)
+
+			// synced panels can only be changed in the repository
+			sc.reqContext.ReplaceAllParams(map[string]string{":uid": "cpu"})
+			response = sc.service.deleteHandler(sc.reqContext)
+			require.Equal(t, 400, response.Status())
+			response = sc.service.patchHandler(sc.reqContext, patchLibraryPanelCommand{Name: "Renamed"})
+			require.Equal(t, 400, response.Status())
+
+			fetcher.commit = "commit-2"
+			fetcher.files = map[string]string{
+				"panels/cpu.json":    `{ "uid": "cpu", "model": { "type": "graph", "title": "CPU usage" }, "tags": ["node"] }`,
+				"panels/memory.json": `{ "name": "Memory usage", "model": { "type": "graph" } }`,
+			}
+			result = runGitSync(t, sc)
+			require.Equal(t, []string{"cpu"}, result.Updated)
+			require.Empty(t, result.Created)
+			require.Empty(t, result.Deleted)
+
+			fetcher.files = map[string]string{"panels/cpu.json": fetcher.files["panels/cpu.json"]}
+			result = runGitSync(t, sc)
+			require.Len(t, result.Deleted, 1)
+			require.Empty(t, result.Updated)
+
+			response = sc.service.getGitSyncHandler(sc.reqContext)
+			var status struct {
+				Result libraryPanelGitSync `json:"result"`
+			}
+			err = json.Unmarshal(response.Body(), &status)
+			require.NoError(t, err)
+			require.Equal(t, "commit-2", status.Result.LastCommit)
+			require.Empty(t, status.Result.LastError)
+			require.NotNil(t, status.Result.LastSync)
+		})
+
+	testScenario(t, "When a commit has an invalid panel file, the sync should fail without changing the library panels",
+		func(t *testing.T, sc scenarioContext) {
+			sc.service.gitFetcher = &fakeGitFetcher{files: map[string]string{
+				"cpu.json":     `{ "model": { "type": "graph" } }`,
+				"invalid.json": `{ "model": { "title": "No type" } }`,
+			}}
+			sc.service.Cfg.DataPath = t.TempDir()
+			response := sc.service.updateGitSyncHandler(sc.reqContext, updateGitSyncCommand{Repository: "ssh://git@example.com/panels.git", Branch: "main"})
+			require.Equal(t, 200, response.Status())
+
+			response = sc.service.runGitSyncHandler(sc.reqContext)
+			require.Equal(t, 500, response.Status())
+
+			gitSync, err := sc.service.getGitSync(sc.reqContext)
+			require.NoError(t, err)
+			require.Contains(t, gitSync.LastError, "invalid.json")
+			libraryPanels, err := sc.service.getAllLibraryPanels(sc.reqContext, getAllLibraryPanelsQuery{})
+			require.NoError(t, err)
+			require.Empty(t, libraryPanels)
+		})
+
+	testScenario(t, "When a repository has symbolic links, they should not be followed",
+		func(t *testing.T, sc scenarioContext) {
+			outside := filepath.Join(t.TempDir(), "outside")
+			err := os.MkdirAll(outside, 0750)
+			require.NoError(t, err)
+			err = ioutil.WriteFile(filepath.Join(outside, "host.json"), []byte(`{ "model": { "type": "graph" } }`), 0600)
+			require.NoError(t, err)
+			sc.service.gitFetcher = &fakeGitFetcher{
+				files: map[string]string{"panels/cpu.json": `{ "uid": "cpu", "model": { "type": "graph" } }`},
+				links: map[string]string{
+					"panels/host.json": filepath.Join(outside, "host.json"),
+					"linked":           outside,
+				},
+			}
+			sc.service.Cfg.DataPath = t.TempDir()
+			response := sc.service.updateGitSyncHandler(sc.reqContext, updateGitSyncCommand{Repository: "https://example.com/panels.git", Branch: "main", Path: "panels"})
+			require.Equal(t, 200, response.Status())
+
+			result := runGitSync(t, sc)
+			require.Equal(t, []string{"cpu"}, result.Created)
+
+			// a path that is a link out of the checkout
+			response = sc.service.updateGitSyncHandler(sc.reqContext, updateGitSyncCommand{Repository: "https://example.com/panels.git", Branch: "main", Path: "linked"})
+			require.Equal(t, 200, response.Status())
+			response = sc.service.runGitSyncHandler(sc.reqContext)
+			require.Equal(t, 500, response.Status())
+			gitSync, err := sc.service.getGitSync(sc.reqContext)
+			require.NoError(t, err)
+			require.Contains(t, gitSync.LastError, "outside of the repository")
+		})
+
+	testScenario(t, "When a panel file has a folder that is not in the org, the sync should fail",
+		func(t *testing.T, sc scenarioContext) {
+			dash := saveTestDashboard(t, `{ "title": "Not a folder", "panels": [] }`)
+			sc.service.gitFetcher = &fakeGitFetcher{files: map[string]string{
+				"cpu.json": `{ "folderId": ` + strconv.FormatInt(dash.Id, 10) + `, "model": { "type": "graph" } }`,
+			}}
+			sc.service.Cfg.DataPath = t.TempDir()
+			response := sc.service.updateGitSyncHandler(sc.reqContext, updateGitSyncCommand{Repository: "https://example.com/panels.git", Branch: "main"})
+			require.Equal(t, 200, response.Status())
+
+			response = sc.service.runGitSyncHandler(sc.reqContext)
+			require.Equal(t, 500, response.Status())
+			libraryPanels, err := sc.service.getAllLibraryPanels(sc.reqContext, getAllLibraryPanelsQuery{})
+			require.NoError(t, err)
+			require.Empty(t, libraryPanels)
+		})
+}
+
+// fakeGitFetcher checks out files and symbolic links to their targets instead of a repository.
+type fakeGitFetcher struct {
+	commit string
+	files  map[string]string
+	links  map[string]string
+}
+
+func (f *fakeGitFetcher) Fetch(_ context.Context, _ string, _ string, dir string) (string, error) {
+	if err := os.RemoveAll(dir); err != nil {
+		return "", err
+	}
+	for path, content := range f.files {
+		path = filepath.Join(dir, path)
+		if err := os.MkdirAll(filepath.Dir(path), 0750); err != nil {
+			return "", err
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+			return "", err
+		}
+	}
+	for path, target := range f.links {
+		path = filepath.Join(dir, path)
+		if err := os.MkdirAll(filepath.Dir(path), 0750); err != nil {
+			return "", err
+		}
+		if err := os.Symlink(target, path); err != nil {
+			return "", err
+		}
+	}
+	if f.commit == "" {
+		f.commit = "commit-1"
+	}
+
+	return f.commit, nil
+}
+
+func runGitSync(t *testing.T, sc scenarioContext) gitSyncResult {
+	t.Helper()
+
+	response := sc.service.runGitSyncHandler(sc.reqContext)
+	require.Equal(t, 200, response.Status())
+
+	var result struct {
+		Result gitSyncResult `json:"result"`
+	}
+	err := json.Unmarshal(response.Body(), &result)
+	require.NoError(t, err)
+
+	return result.Result
+}
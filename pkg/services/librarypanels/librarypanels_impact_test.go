@@ -0,0 +1,65 @@
+package librarypanels
+
+import (
+	"encoding/json"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAnalyzeLibraryPanelImpact(t *testing.T) {
+	testScenario(t, "When an admin analyzes a new model for a library panel, the changes and connected dashboards should be returned",
+		func(t *testing.T, sc scenarioContext) {
+			libraryPanel := createLibraryPanel(t, sc, getCreateCommandWithModel(1, "CPU usage",
+				`{ "type": "graph", "datasource": "prometheus", "targets": [{ "expr": "cpu", "datasource": "prometheus" }] }`))
+			dashboard := saveTestDashboard(t, `{"title": "Hosts"}`)
+			sc.reqContext.ReplaceAllParams(map[string]string{":uid": libraryPanel.UID, ":dashboardId": strconv.FormatInt(dashboard.Id, 10)})
+			response := sc.service.connectHandler(sc.reqContext)
+			require.Equal(t, 200, response.Status())
+
+			analysis := analyzeImpact(t, sc, libraryPanel.UID,
+				`{ "type": "text", "datasource": "loki", "targets": [{ "expr": "cpu", "datasource": "loki" }], "title": "CPU" }`)
+			require.Equal(t, impactHigh, analysis.Impact)
+			require.Equal(t, []impactChange{
+				{Kind: "datasource", Impact: impactHigh, Message: "datasources change from [prometheus] to [loki]"},
+				{Kind: "visualization", Impact: impactHigh, Message: "visualization changes from graph to text"},
+				{Kind: "options", Impact: impactLow, Message: "panel options change"},
+			}, analysis.Changes)
+			require.Equal(t, []impactedDashboard{{ID: dashboard.Id, UID: dashboard.Uid, Title: "Hosts"}}, analysis.Dashboards)
+
+			analysis = analyzeImpact(t, sc, libraryPanel.UID,
+				`{ "type": "graph", "datasource": "prometheus", "targets": [{ "expr": "cpu_seconds", "datasource": "prometheus" }], "gridPos": { "w": 6 } }`)
+			require.Equal(t, impactMedium, analysis.Impact)
+			require.Equal(t, []impactChange{{Kind: "query", Impact: impactMedium, Message: "queries change"}}, analysis.Changes)
+		})
+
+	testScenario(t, "When an admin analyzes a new model for a library panel that no dashboard uses, the impact should be none",
+		func(t *testing.T, sc scenarioContext) {
+			libraryPanel := createLibraryPanel(t, sc, getCreateCommand(1, "Text - Library Panel"))
+
+			analysis := analyzeImpact(t, sc, libraryPanel.UID, `{ "type": "graph" }`)
+			require.Equal(t, impactNone, analysis.Impact)
+			require.NotEmpty(t, analysis.Changes)
+			require.Empty(t, analysis.Dashboards)
+
+			sc.reqContext.ReplaceAllParams(map[string]string{":uid": "unknown"})
+			response := sc.service.analyzeImpactHandler(sc.reqContext, analyzeImpactCommand{Model: []byte(`{ "type": "graph" }`)})
+			require.Equal(t, 404, response.Status())
+		})
+}
+
+func analyzeImpact(t *testing.T, sc scenarioContext, uid string, model string) impactAnalysis {
+	t.Helper()
+
+	sc.reqContext.ReplaceAllParams(map[string]string{":uid": uid})
+	response := sc.service.analyzeImpactHandler(sc.reqContext, analyzeImpactCommand{Model: []byte(model)})
+	require.Equal(t, 200, response.Status())
+	var result struct {
+		Result impactAnalysis `json:"result"`
+	}
+	err := json.Unmarshal(response.Body(), &result)
+	require.NoError(t, err)
+
+	return result.Result
+}
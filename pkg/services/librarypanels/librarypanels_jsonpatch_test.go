@@ -0,0 +1,94 @@
+package librarypanels
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPatchDocument(t *testing.T) {
+	testScenario(t, "When a library panel is patched with a JSON Patch, only the patched properties should change",
+		func(t *testing.T, sc scenarioContext) {
+			existing := createLibraryPanel(t, sc, getCreateCommandWithModel(1, "Graph", `{
+				"type": "graph", "title": "Graph",
+				"thresholds": [{ "value": 80, "colorMode": "critical" }]
+			}`))
+
+			cmd := bindTestPatchDocument(t, sc, existing.UID, contentTypeJSONPatch, `[
+				{ "op": "test", "path": "/model/thresholds/0/value", "value": 80 },
+				{ "op": "replace", "path": "/model/thresholds/0/value", "value": 90 },
+				{ "op": "add", "path": "/tags/-", "value": "cpu" },
+				{ "op": "copy", "from": "/model/title", "path": "/model/description" }
+			]`)
+			response := sc.service.patchHandler(sc.reqContext, cmd)
+			require.Equal(t, 200, response.Status())
+
+			libraryPanel, err := sc.service.getLibraryPanel(sc.reqContext, existing.UID)
+			require.NoError(t, err)
+			require.Equal(t, "Graph", libraryPanel.Name)
+			require.Equal(t, []string{"cpu"}, libraryPanel.Tags)
+			require.JSONEq(t, `{
+				"type": "graph", "title": "Graph", "description": "Graph",
+				"thresholds": [{ "value": 90, "colorMode": "critical" }]
+			}`, string(libraryPanel.Model))
+		})
+
+	testScenario(t, "When a library panel is patched with a JSON Merge Patch, the patch should be merged into it",
+		func(t *testing.T, sc scenarioContext) {
+			existing := createLibraryPanel(t, sc, getCreateCommandWithModel(1, "Graph", `{
+				"type": "graph", "title": "Graph", "options": { "legend": true, "tooltip": "single" }
+			}`))
+
+			cmd := bindTestPatchDocument(t, sc, existing.UID, contentTypeMergePatch+"; charset=utf-8",
+				`{ "name": "CPU", "model": { "options": { "tooltip": null, "stack": true } } }`)
+			response := sc.service.patchHandler(sc.reqContext, cmd)
+			require.Equal(t, 200, response.Status())
+
+			libraryPanel, err := sc.service.getLibraryPanel(sc.reqContext, existing.UID)
+			require.NoError(t, err)
+			require.Equal(t, "CPU", libraryPanel.Name)
+			require.JSONEq(t, `{ "type": "graph", "title": "Graph", "options": { "legend": true, "stack": true } }`, string(libraryPanel.Model))
+		})
+
+	testScenario(t, "When a JSON Patch fails, the library panel should not change",
+		func(t *testing.T, sc scenarioContext) {
+			existing := createLibraryPanel(t, sc, getCreateCommand(1, "Text - Library Panel"))
+
+			_, err := sc.service.applyPatchDocument(sc.reqContext, existing.UID, contentTypeJSONPatch,
+				[]byte(`[{ "op": "test", "path": "/name", "value": "Other" }]`))
+			require.True(t, errors.Is(err, errLibraryPanelPatchTestFailed))
+			_, err = sc.service.applyPatchDocument(sc.reqContext, existing.UID, contentTypeJSONPatch,
+				[]byte(`[{ "op": "remove", "path": "/model/missing" }]`))
+			require.True(t, errors.Is(err, errLibraryPanelInvalidPatch))
+			_, err = sc.service.applyPatchDocument(sc.reqContext, existing.UID, contentTypeJSONPatch,
+				[]byte(`[{ "op": "replace", "path": "/model/type", "value": "graph" }, { "op": "increment", "path": "/name" }]`))
+			require.True(t, errors.Is(err, errLibraryPanelInvalidPatch))
+			_, err = sc.service.applyPatchDocument(sc.reqContext, "unknown", contentTypeMergePatch, []byte(`{}`))
+			require.Equal(t, errLibraryPanelNotFound, err)
+		})
+}
+
+func bindTestPatchDocument(t *testing.T, sc scenarioContext, uid string, contentType string, patch string) patchLibraryPanelCommand {
+	t.Helper()
+
+	sc.reqContext.ReplaceAllParams(map[string]string{":uid": uid})
+	sc.ctx.Req.Request = &http.Request{
+		URL:    &url.URL{},
+		Header: http.Header{"Content-Type": []string{contentType}},
+		Body:   ioutil.NopCloser(bytes.NewReader([]byte(patch))),
+	}
+	sc.service.bindPatchDocument(sc.reqContext)
+	require.Equal(t, "application/json", sc.ctx.Req.Header.Get("Content-Type"))
+
+	var cmd patchLibraryPanelCommand
+	err := json.NewDecoder(sc.ctx.Req.Request.Body).Decode(&cmd)
+	require.NoError(t, err)
+
+	return cmd
+}
@@ -0,0 +1,83 @@
+package librarypanels
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/grafana/pkg/plugins"
+)
+
+func TestValidateLibraryPanelModel(t *testing.T) {
+	testScenario(t, "When an admin validates a panel model, the lint warnings and validation errors should be returned",
+		func(t *testing.T, sc scenarioContext) {
+			plugins.Panels["stat"] = &plugins.PanelPlugin{}
+			model := []byte(`{
+				"type": "stat",
+				"span": 4,
+				"fieldConfig": {
+					"defaults": {
+						"thresholds": { "mode": "percentage", "steps": [{ "value": null }, { "value": 80 }, { "value": 50 }, { "value": 120 }] }
+					}
+				}
+			}`)
+			result := validateLibraryPanelModel(t, sc, validateLibraryPanelCommand{Model: model})
+			require.True(t, result.Valid)
+			require.Empty(t, result.Errors)
+			require.Equal(t, modelValidationErrors{
+				{Field: "model.span", Message: "is deprecated, use gridPos instead"},
+				{Field: "model.fieldConfig.defaults.unit", Message: "is not set, values are shown without a unit"},
+				{Field: "model.fieldConfig.defaults.thresholds.steps[2].value", Message: "must be greater than the value of the previous step, 80"},
+				{Field: "model.fieldConfig.defaults.thresholds.steps[3].value", Message: "must be between 0 and 100 in percentage mode"},
+			}, result.Warnings)
+
+			result = validateLibraryPanelModel(t, sc, validateLibraryPanelCommand{Model: []byte(`{ "type": "singlestat" }`)})
+			require.False(t, result.Valid)
+			require.Equal(t, modelValidationErrors{{Field: "model.type", Message: `unknown panel type "singlestat"`}}, result.Errors)
+			require.Equal(t, modelValidationErrors{{Field: "model.type", Message: `panel type "singlestat" is deprecated, use "stat" instead`}}, result.Warnings)
+
+			row := []byte(`{ "type": "row", "panels": [{ "type": "text", "options": { "fieldOptions": {} } }] }`)
+			result = validateLibraryPanelModel(t, sc, validateLibraryPanelCommand{Kind: rowElement, Model: row})
+			require.True(t, result.Valid)
+			require.Equal(t, modelValidationErrors{{Field: "model.panels[0].options.fieldOptions", Message: "is deprecated, use fieldConfig instead"}}, result.Warnings)
+
+			result = validateLibraryPanelModel(t, sc, validateLibraryPanelCommand{Model: []byte(`{ "type": "stat", "fieldConfig": { "defaults": { "unit": "short" } } }`)})
+			require.True(t, result.Valid)
+			require.Empty(t, result.Warnings)
+		})
+
+	testScenario(t, "When strict linting is enabled, models with lint warnings should be invalid and rejected",
+		func(t *testing.T, sc scenarioContext) {
+			plugins.Panels["stat"] = &plugins.PanelPlugin{}
+			sc.service.Cfg.LibraryPanels.StrictLinting = true
+			model := []byte(`{ "type": "stat" }`)
+
+			result := validateLibraryPanelModel(t, sc, validateLibraryPanelCommand{Model: model})
+			require.False(t, result.Valid)
+			require.Empty(t, result.Errors)
+			require.Len(t, result.Warnings, 1)
+
+			response := sc.service.createHandler(sc.reqContext, getCreateCommandWithModel(1, "Stat", string(model)))
+			require.Equal(t, 400, response.Status())
+
+			existing := createLibraryPanel(t, sc, getCreateCommand(1, "Text - Library Panel"))
+			sc.reqContext.ReplaceAllParams(map[string]string{":uid": existing.UID})
+			response = sc.service.patchHandler(sc.reqContext, patchLibraryPanelCommand{Model: model})
+			require.Equal(t, 400, response.Status())
+		})
+}
+
+func validateLibraryPanelModel(t *testing.T, sc scenarioContext, cmd validateLibraryPanelCommand) lintResult {
+	t.Helper()
+
+	response := sc.service.validateHandler(sc.reqContext, cmd)
+	require.Equal(t, 200, response.Status())
+	var result struct {
+		Result lintResult `json:"result"`
+	}
+	err := json.Unmarshal(response.Body(), &result)
+	require.NoError(t, err)
+
+	return result.Result
+}
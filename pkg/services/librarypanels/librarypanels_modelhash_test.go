@@ -0,0 +1,84 @@
+package librarypanels
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestModelHash(t *testing.T) {
+	testScenario(t, "When a library panel is patched with the same model, it should not be changed",
+		func(t *testing.T, sc scenarioContext) {
+			existing := createLibraryQuery(t, sc, "Up", `{ "datasource": "Prometheus", "expr": "up" }`)
+			before, err := sc.service.getLibraryPanel(sc.reqContext, existing.UID)
+			require.NoError(t, err)
+			require.Equal(t, modelHash([]byte(`{"expr":"up","datasource":"Prometheus"}`)), before.ModelHash)
+
+			sc.reqContext.UserId = 2
+			sc.reqContext.ReplaceAllParams(map[string]string{":uid": existing.UID})
+			response := sc.service.patchHandler(sc.reqContext, patchLibraryPanelCommand{
+				Model: []byte(`{"expr": "up",   "datasource": "Prometheus"}`),
+			})
+			require.Equal(t, 200, response.Status())
+
+			after, err := sc.service.getLibraryPanel(sc.reqContext, existing.UID)
+			require.NoError(t, err)
+			require.Equal(t, before.Updated.Unix(), after.Updated.Unix())
+			require.Equal(t, before.UpdatedBy, after.UpdatedBy)
+			require.Equal(t, libraryPanelETag(before), libraryPanelETag(after))
+			versions, err := sc.service.getLibraryQueryVersions(sc.reqContext, existing.UID)
+			require.NoError(t, err)
+			require.Len(t, versions, 1)
+		})
+
+	testScenario(t, "When a library panel is patched with the same model and a new name, only the name should change",
+		func(t *testing.T, sc scenarioContext) {
+			existing := createLibraryQuery(t, sc, "Up", `{ "datasource": "Prometheus", "expr": "up" }`)
+
+			sc.reqContext.ReplaceAllParams(map[string]string{":uid": existing.UID})
+			response := sc.service.patchHandler(sc.reqContext, patchLibraryPanelCommand{
+				Name:  "Up targets",
+				Model: []byte(`{ "datasource": "Prometheus", "expr": "up" }`),
+			})
+			require.Equal(t, 200, response.Status())
+
+			after, err := sc.service.getLibraryPanel(sc.reqContext, existing.UID)
+			require.NoError(t, err)
+			require.Equal(t, "Up targets", after.Name)
+			versions, err := sc.service.getLibraryQueryVersions(sc.reqContext, existing.UID)
+			require.NoError(t, err)
+			require.Len(t, versions, 1)
+
+			response = sc.service.patchHandler(sc.reqContext, patchLibraryPanelCommand{
+				Model: []byte(`{ "datasource": "Prometheus", "expr": "up == 0" }`),
+			})
+			require.Equal(t, 200, response.Status())
+			after, err = sc.service.getLibraryPanel(sc.reqContext, existing.UID)
+			require.NoError(t, err)
+			require.Equal(t, modelHash([]byte(`{ "datasource": "Prometheus", "expr": "up == 0" }`)), after.ModelHash)
+			versions, err = sc.service.getLibraryQueryVersions(sc.reqContext, existing.UID)
+			require.NoError(t, err)
+			require.Len(t, versions, 2)
+		})
+
+	testScenario(t, "When a library panel is stored, its model should be normalized",
+		func(t *testing.T, sc scenarioContext) {
+			existing := createLibraryPanel(t, sc, getCreateCommandWithModel(1, "Notes", `{
+				"type": "text", "id": 4, "gridPos": { "x": 0, "y": 0, "w": 12, "h": 4 },
+				"transparent": false, "links": [], "datasource": null,
+				"options": { "mode": "html", "content": "<b>Notes</b>" }, "title": "Notes"
+			}`))
+			before, err := sc.service.getLibraryPanel(sc.reqContext, existing.UID)
+			require.NoError(t, err)
+			require.Equal(t, `{"options":{"content":"<b>Notes</b>","mode":"html"},"title":"Notes","type":"text"}`, string(before.Model))
+
+			// a panel of another dashboard only differs in the volatile properties
+			sc.reqContext.ReplaceAllParams(map[string]string{":uid": existing.UID})
+			patched, err := sc.service.patchLibraryPanel(sc.reqContext, patchLibraryPanelCommand{
+				Model: []byte(`{ "id": 9, "gridPos": { "x": 12, "y": 8, "w": 12, "h": 4 }, "title": "Notes", "type": "text",
+					"options": { "content": "<b>Notes</b>", "mode": "html" }, "links": [] }`),
+			}, existing.UID)
+			require.NoError(t, err)
+			require.Equal(t, libraryPanelETag(before), libraryPanelETag(patched))
+		})
+}
@@ -0,0 +1,41 @@
+package librarypanels
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestModelPaths(t *testing.T) {
+	testScenario(t, "When a library panel is read with model paths, only these parts of the model should be returned",
+		func(t *testing.T, sc scenarioContext) {
+			existing := createLibraryPanel(t, sc, getCreateCommandWithModel(1, "Graph", `{
+				"type": "graph", "title": "Graph",
+				"fieldConfig": { "defaults": { "unit": "percent", "min": 0 }, "overrides": [] },
+				"targets": [{ "refId": "A", "expr": "up" }]
+			}`))
+
+			sc.reqContext.ReplaceAllParams(map[string]string{":uid": existing.UID})
+			sc.ctx.Req.Request = &http.Request{URL: &url.URL{RawQuery: "modelPaths=fieldConfig.defaults.unit,targets,options.legend,title.text"}}
+			response := sc.service.getHandler(sc.reqContext)
+			require.Equal(t, 200, response.Status())
+			var result struct {
+				Result struct {
+					Model json.RawMessage `json:"model"`
+				} `json:"result"`
+			}
+			err := json.Unmarshal(response.Body(), &result)
+			require.NoError(t, err)
+			require.JSONEq(t, `{
+				"fieldConfig": { "defaults": { "unit": "percent" } },
+				"targets": [{ "refId": "A", "expr": "up" }]
+			}`, string(result.Result.Model))
+
+			sc.ctx.Req.Request = &http.Request{URL: &url.URL{RawQuery: "modelPaths=fieldConfig..unit"}}
+			response = sc.service.getHandler(sc.reqContext)
+			require.Equal(t, 400, response.Status())
+		})
+}
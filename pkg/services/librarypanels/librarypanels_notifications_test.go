@@ -0,0 +1,159 @@
+package librarypanels
+
+import (
+	"encoding/json"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/components/simplejson"
+	"github.com/grafana/grafana/pkg/infra/log"
+	"github.com/grafana/grafana/pkg/models"
+)
+
+func TestLibraryPanelNotifications(t *testing.T) {
+	testScenario(t, "When a library panel is changed, the owners of connected dashboards should be notified",
+		func(t *testing.T, sc scenarioContext) {
+			sc.service.log = log.New("librarypanels")
+			sc.service.Cfg.LibraryPanels.ChangeEmails = true
+			var emails []*models.SendEmailCommand
+			bus.AddHandler("test", func(cmd *models.SendEmailCommand) error {
+				emails = append(emails, cmd)
+				return nil
+			})
+
+			owner := createNotificationTestUsers(t)
+			existing := createLibraryPanel(t, sc, getCreateCommand(0, "CPU"))
+			dash := saveOwnedDashboard(t, owner.Id, "Cluster")
+			for _, panelID := range []int64{1, 2} {
+				err := sc.service.connectDashboard(sc.reqContext, existing.UID, dash.Id, panelID)
+				require.NoError(t, err)
+			}
+
+			sc.reqContext.SignedInUser.Login = "editor"
+			sc.reqContext.ReplaceAllParams(map[string]string{":uid": existing.UID})
+			response := sc.service.patchHandler(sc.reqContext, patchLibraryPanelCommand{Name: "CPU usage"})
+			require.Equal(t, 200, response.Status())
+
+			// the user who changed the library panel isn't notified
+			require.Empty(t, getNotifications(t, sc))
+
+			sc.reqContext.SignedInUser = &models.SignedInUser{UserId: owner.Id, OrgId: 1, OrgRole: models.ROLE_EDITOR}
+			notifications := getNotifications(t, sc)
+			require.Len(t, notifications, 1)
+			require.Equal(t, existing.UID, notifications[0].LibraryPanelUID)
+			require.Equal(t, "editor changed the name of library panel CPU usage, used in Cluster", notifications[0].Summary)
+			require.False(t, notifications[0].Seen)
+
+			require.Len(t, emails, 1)
+			require.Equal(t, []string{"owner@example.com"}, emails[0].To)
+			require.Equal(t, []string{"Cluster"}, emails[0].Data["Dashboards"])
+
+			sc.reqContext.ReplaceAllParams(map[string]string{":id": strconv.FormatInt(notifications[0].ID, 10)})
+			response = sc.service.markNotificationSeenHandler(sc.reqContext)
+			require.Equal(t, 200, response.Status())
+			require.True(t, getNotifications(t, sc)[0].Seen)
+
+			// notifications of other users can't be marked as seen
+			sc.reqContext.SignedInUser = &sc.user
+			response = sc.service.markNotificationSeenHandler(sc.reqContext)
+			require.Equal(t, 404, response.Status())
+		})
+
+	testScenario(t, "When a user mutes notifications, they should not be notified of changes",
+		func(t *testing.T, sc scenarioContext) {
+			sc.service.log = log.New("librarypanels")
+			owner := createNotificationTestUsers(t)
+			existing := createLibraryPanel(t, sc, getCreateCommand(0, "CPU"))
+			dash := saveOwnedDashboard(t, owner.Id, "Cluster")
+			err := sc.service.connectDashboard(sc.reqContext, existing.UID, dash.Id, 1)
+			require.NoError(t, err)
+
+			ownerUser := &models.SignedInUser{UserId: owner.Id, OrgId: 1, OrgRole: models.ROLE_EDITOR}
+			patch := func(name string) {
+				sc.reqContext.SignedInUser = &sc.user
+				sc.reqContext.ReplaceAllParams(map[string]string{":uid": existing.UID})
+				response := sc.service.patchHandler(sc.reqContext, patchLibraryPanelCommand{Name: name})
+				require.Equal(t, 200, response.Status())
+				sc.reqContext.SignedInUser = ownerUser
+			}
+
+			sc.reqContext.SignedInUser = ownerUser
+			sc.reqContext.ReplaceAllParams(map[string]string{":uid": existing.UID})
+			response := sc.service.muteHandler(sc.reqContext)
+			require.Equal(t, 200, response.Status())
+			response = sc.service.muteHandler(sc.reqContext)
+			require.Equal(t, 200, response.Status())
+			patch("Muted")
+			require.Empty(t, getNotifications(t, sc))
+
+			response = sc.service.muteAllHandler(sc.reqContext)
+			require.Equal(t, 200, response.Status())
+			response = sc.service.getNotificationMutesHandler(sc.reqContext)
+			require.Equal(t, 200, response.Status())
+			var mutes struct {
+				Result notificationMutes `json:"result"`
+			}
+			err = json.Unmarshal(response.Body(), &mutes)
+			require.NoError(t, err)
+			require.True(t, mutes.Result.All)
+			require.Equal(t, []string{existing.UID}, mutes.Result.LibraryPanelUIDs)
+
+			sc.reqContext.ReplaceAllParams(map[string]string{":uid": existing.UID})
+			response = sc.service.unmuteHandler(sc.reqContext)
+			require.Equal(t, 200, response.Status())
+			patch("Muted for all")
+			require.Empty(t, getNotifications(t, sc))
+
+			response = sc.service.unmuteAllHandler(sc.reqContext)
+			require.Equal(t, 200, response.Status())
+			patch("Unmuted")
+			require.Len(t, getNotifications(t, sc), 1)
+		})
+}
+
+// createNotificationTestUsers creates the user of the scenario, that changes library panels, and returns a
+// dashboard owner.
+func createNotificationTestUsers(t *testing.T) *models.User {
+	t.Helper()
+
+	editor := models.CreateUserCommand{Login: "editor", Email: "editor@example.com", SkipOrgSetup: true}
+	err := bus.Dispatch(&editor)
+	require.NoError(t, err)
+	owner := models.CreateUserCommand{Login: "owner", Email: "owner@example.com", SkipOrgSetup: true}
+	err = bus.Dispatch(&owner)
+	require.NoError(t, err)
+
+	return &owner.Result
+}
+
+func saveOwnedDashboard(t *testing.T, userID int64, title string) *models.Dashboard {
+	t.Helper()
+
+	cmd := models.SaveDashboardCommand{
+		OrgId:     1,
+		UserId:    userID,
+		Dashboard: simplejson.NewFromAny(map[string]interface{}{"title": title, "panels": []interface{}{}}),
+	}
+	err := bus.Dispatch(&cmd)
+	require.NoError(t, err)
+
+	return cmd.Result
+}
+
+func getNotifications(t *testing.T, sc scenarioContext) []libraryPanelNotification {
+	t.Helper()
+
+	response := sc.service.getNotificationsHandler(sc.reqContext)
+	require.Equal(t, 200, response.Status())
+
+	var result struct {
+		Result []libraryPanelNotification `json:"result"`
+	}
+	err := json.Unmarshal(response.Body(), &result)
+	require.NoError(t, err)
+
+	return result.Result
+}
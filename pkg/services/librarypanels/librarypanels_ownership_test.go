@@ -0,0 +1,92 @@
+package librarypanels
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/events"
+	"github.com/grafana/grafana/pkg/infra/log"
+	"github.com/grafana/grafana/pkg/models"
+)
+
+func TestLibraryPanelOwnershipTransfer(t *testing.T) {
+	testScenario(t, "When the library panels of a user are transferred, they should be reassigned in batches",
+		func(t *testing.T, sc scenarioContext) {
+			for _, name := range []string{"First", "Second", "Third"} {
+				createLibraryPanel(t, sc, getCreateCommand(0, name))
+			}
+			var successorID int64
+			for _, login := range []string{"departing", "successor"} {
+				createUser := models.CreateUserCommand{Login: login, Email: login + "@example.com", SkipOrgSetup: true}
+				err := bus.Dispatch(&createUser)
+				require.NoError(t, err)
+				successorID = createUser.Result.Id
+			}
+			require.NotEqual(t, sc.user.UserId, successorID)
+
+			result, err := sc.service.transferOwnership(transferOwnershipCommand{FromUserID: sc.user.UserId, ToUserID: successorID}, 2)
+			require.NoError(t, err)
+			require.Equal(t, int64(3), result.LibraryPanels)
+
+			libraryPanels, err := sc.service.getAllLibraryPanels(sc.reqContext, getAllLibraryPanelsQuery{})
+			require.NoError(t, err)
+			require.Len(t, libraryPanels, 3)
+			for _, panel := range libraryPanels {
+				require.Equal(t, successorID, panel.CreatedBy)
+				require.Equal(t, successorID, panel.UpdatedBy)
+			}
+
+			result, err = sc.service.transferOwnership(transferOwnershipCommand{FromUserID: sc.user.UserId, ToUserID: successorID}, 2)
+			require.NoError(t, err)
+			require.Equal(t, int64(0), result.LibraryPanels)
+		})
+
+	testScenario(t, "When the library panels are transferred to the same or an unknown user, it should fail",
+		func(t *testing.T, sc scenarioContext) {
+			response := sc.service.transferOwnershipHandler(sc.reqContext, transferOwnershipCommand{FromUserID: 1, ToUserID: 1})
+			require.Equal(t, 400, response.Status())
+
+			response = sc.service.transferOwnershipHandler(sc.reqContext, transferOwnershipCommand{FromUserID: 1, ToUserID: 999})
+			require.Equal(t, 404, response.Status())
+		})
+
+	testScenario(t, "When the author of library panels is deleted, they should be reassigned to the fallback author",
+		func(t *testing.T, sc scenarioContext) {
+			createLibraryPanel(t, sc, getCreateCommand(0, "Orphaned"))
+			var userIDs []int64
+			for _, login := range []string{"departing", "fallback"} {
+				createUser := models.CreateUserCommand{Login: login, Email: login + "@example.com", SkipOrgSetup: true}
+				err := bus.Dispatch(&createUser)
+				require.NoError(t, err)
+				userIDs = append(userIDs, createUser.Result.Id)
+			}
+			require.Equal(t, sc.user.UserId, userIDs[0])
+
+			missing, err := sc.service.getLibraryPanelsWithMissingAuthors(sc.reqContext)
+			require.NoError(t, err)
+			require.Empty(t, missing)
+
+			err = bus.Dispatch(&models.DeleteUserCommand{UserId: userIDs[0]})
+			require.NoError(t, err)
+			err = sc.service.handleUserDeleted(&events.UserDeleted{Id: userIDs[0]})
+			require.NoError(t, err)
+			missing, err = sc.service.getLibraryPanelsWithMissingAuthors(sc.reqContext)
+			require.NoError(t, err)
+			require.Len(t, missing, 1)
+			require.Equal(t, "Orphaned", missing[0].Name)
+
+			sc.service.Cfg.LibraryPanels.FallbackAuthor = "fallback"
+			sc.service.log = log.New("librarypanels")
+			err = sc.service.handleUserDeleted(&events.UserDeleted{Id: userIDs[0]})
+			require.NoError(t, err)
+			missing, err = sc.service.getLibraryPanelsWithMissingAuthors(sc.reqContext)
+			require.NoError(t, err)
+			require.Empty(t, missing)
+			libraryPanels, err := sc.service.getAllLibraryPanels(sc.reqContext, getAllLibraryPanelsQuery{})
+			require.NoError(t, err)
+			require.Len(t, libraryPanels, 1)
+			require.Equal(t, userIDs[1], libraryPanels[0].CreatedBy)
+		})
+}
@@ -0,0 +1,195 @@
+package librarypanels
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/components/simplejson"
+	"github.com/grafana/grafana/pkg/models"
+)
+
+func TestLibraryPanelPermissions(t *testing.T) {
+	testScenario(t, "When a viewer tries to change library panels, it should fail regardless of the route",
+		func(t *testing.T, sc scenarioContext) {
+			existing := createLibraryPanel(t, sc, getCreateCommand(0, "Text - Library Panel"))
+			dash := saveTestDashboard(t, `{ "title": "Dashboard", "panels": [] }`)
+
+			sc.reqContext.SignedInUser = &models.SignedInUser{UserId: 2, OrgId: 1, OrgRole: models.ROLE_VIEWER}
+			response := sc.service.createHandler(sc.reqContext, getCreateCommand(0, "By viewer"))
+			require.Equal(t, 403, response.Status())
+
+			sc.reqContext.ReplaceAllParams(map[string]string{":uid": existing.UID, ":dashboardId": strconv.FormatInt(dash.Id, 10)})
+			response = sc.service.patchHandler(sc.reqContext, patchLibraryPanelCommand{Name: "Renamed"})
+			require.Equal(t, 403, response.Status())
+			response = sc.service.connectHandler(sc.reqContext)
+			require.Equal(t, 403, response.Status())
+			response = sc.service.deleteHandler(sc.reqContext)
+			require.Equal(t, 403, response.Status())
+
+			response = sc.service.getHandler(sc.reqContext)
+			require.Equal(t, 200, response.Status())
+		})
+
+	testScenario(t, "When an editor connects a library panel, they should need edit permission on the dashboard",
+		func(t *testing.T, sc scenarioContext) {
+			existing := createLibraryPanel(t, sc, getCreateCommand(0, "Text - Library Panel"))
+			editable := saveTestDashboard(t, `{ "title": "Editable", "panels": [] }`)
+			restricted := saveTestDashboard(t, `{ "title": "Restricted", "panels": [] }`)
+			restrictDashboard(t, restricted.Id)
+			err := sc.service.connectDashboard(sc.reqContext, existing.UID, restricted.Id, 1)
+			require.NoError(t, err)
+
+			sc.reqContext.SignedInUser = &models.SignedInUser{UserId: 2, OrgId: 1, OrgRole: models.ROLE_EDITOR}
+			sc.reqContext.ReplaceAllParams(map[string]string{":uid": existing.UID, ":dashboardId": strconv.FormatInt(editable.Id, 10)})
+			response := sc.service.connectHandler(sc.reqContext)
+			require.Equal(t, 200, response.Status())
+
+			sc.reqContext.ReplaceAllParams(map[string]string{":uid": existing.UID, ":dashboardId": strconv.FormatInt(restricted.Id, 10)})
+			response = sc.service.connectHandler(sc.reqContext)
+			require.Equal(t, 403, response.Status())
+			response = sc.service.disconnectHandler(sc.reqContext)
+			require.Equal(t, 403, response.Status())
+		})
+
+	testScenario(t, "When a user connects a library panel, the dashboard and folder permissions should decide rather than the role",
+		func(t *testing.T, sc scenarioContext) {
+			folder := models.SaveDashboardCommand{OrgId: 1, IsFolder: true, Dashboard: simplejson.NewFromAny(map[string]interface{}{"title": "Hidden"})}
+			err := bus.Dispatch(&folder)
+			require.NoError(t, err)
+			err = bus.Dispatch(&models.UpdateDashboardAclCommand{
+				DashboardID: folder.Result.Id,
+				Items: []*models.DashboardAcl{{
+					OrgID: 1, DashboardID: folder.Result.Id, UserID: 3, Permission: models.PERMISSION_VIEW,
+					Created: time.Now(), Updated: time.Now(),
+				}},
+			})
+			require.NoError(t, err)
+			hidden := createLibraryPanel(t, sc, getCreateCommand(folder.Result.Id, "Hidden"))
+			existing := createLibraryPanel(t, sc, getCreateCommand(0, "Text - Library Panel"))
+			dash := saveTestDashboard(t, `{ "title": "Shared", "panels": [] }`)
+			err = bus.Dispatch(&models.UpdateDashboardAclCommand{
+				DashboardID: dash.Id,
+				Items: []*models.DashboardAcl{{
+					OrgID: 1, DashboardID: dash.Id, UserID: 2, Permission: models.PERMISSION_EDIT,
+					Created: time.Now(), Updated: time.Now(),
+				}},
+			})
+			require.NoError(t, err)
+			err = sc.service.connectDashboard(sc.reqContext, existing.UID, dash.Id, 1)
+			require.NoError(t, err)
+
+			// a viewer with the Edit permission on the dashboard can connect and disconnect
+			sc.reqContext.SignedInUser = &models.SignedInUser{UserId: 2, OrgId: 1, OrgRole: models.ROLE_VIEWER}
+			sc.reqContext.ReplaceAllParams(map[string]string{":uid": existing.UID, ":dashboardId": strconv.FormatInt(dash.Id, 10)})
+			response := sc.service.disconnectHandler(sc.reqContext)
+			require.Equal(t, 200, response.Status())
+			response = sc.service.connectHandler(sc.reqContext)
+			require.Equal(t, 200, response.Status())
+			// but not with a library panel in a folder they can't view
+			sc.reqContext.ReplaceAllParams(map[string]string{":uid": hidden.UID, ":dashboardId": strconv.FormatInt(dash.Id, 10)})
+			response = sc.service.connectHandler(sc.reqContext)
+			require.Equal(t, 404, response.Status())
+
+			// an editor without permission on the dashboard can't
+			sc.reqContext.SignedInUser = &models.SignedInUser{UserId: 3, OrgId: 1, OrgRole: models.ROLE_EDITOR}
+			sc.reqContext.ReplaceAllParams(map[string]string{":uid": existing.UID, ":dashboardId": strconv.FormatInt(dash.Id, 10)})
+			response = sc.service.connectHandler(sc.reqContext)
+			require.Equal(t, 403, response.Status())
+			response = sc.service.disconnectHandler(sc.reqContext)
+			require.Equal(t, 403, response.Status())
+		})
+
+	testScenario(t, "When an editor creates or moves a library panel, they should need edit permission on the folder",
+		func(t *testing.T, sc scenarioContext) {
+			folder := models.SaveDashboardCommand{OrgId: 1, IsFolder: true, Dashboard: simplejson.NewFromAny(map[string]interface{}{"title": "Restricted"})}
+			err := bus.Dispatch(&folder)
+			require.NoError(t, err)
+			restrictDashboard(t, folder.Result.Id)
+
+			sc.reqContext.SignedInUser = &models.SignedInUser{UserId: 2, OrgId: 1, OrgRole: models.ROLE_EDITOR}
+			response := sc.service.createHandler(sc.reqContext, getCreateCommand(folder.Result.Id, "In restricted folder"))
+			require.Equal(t, 403, response.Status())
+
+			existing := createLibraryPanel(t, sc, getCreateCommand(0, "In General folder"))
+			sc.reqContext.ReplaceAllParams(map[string]string{":uid": existing.UID})
+			response = sc.service.patchHandler(sc.reqContext, patchLibraryPanelCommand{FolderID: folder.Result.Id})
+			require.Equal(t, 403, response.Status())
+			response = sc.service.patchHandler(sc.reqContext, patchLibraryPanelCommand{Name: "Renamed"})
+			require.Equal(t, 200, response.Status())
+		})
+}
+
+func TestLibraryPanelViewPermissions(t *testing.T) {
+	testScenario(t, "When a viewer can't view the folder of a library panel, it should be left out of search and not be found",
+		func(t *testing.T, sc scenarioContext) {
+			restricted := models.SaveDashboardCommand{OrgId: 1, IsFolder: true, Dashboard: simplejson.NewFromAny(map[string]interface{}{"title": "Restricted"})}
+			err := bus.Dispatch(&restricted)
+			require.NoError(t, err)
+			err = bus.Dispatch(&models.UpdateDashboardAclCommand{
+				DashboardID: restricted.Result.Id,
+				Items: []*models.DashboardAcl{{
+					OrgID: 1, DashboardID: restricted.Result.Id, UserID: 2, Permission: models.PERMISSION_VIEW,
+					Created: time.Now(), Updated: time.Now(),
+				}},
+			})
+			require.NoError(t, err)
+			createLibraryPanel(t, sc, getCreateCommand(0, "CPU open"))
+			hidden := createLibraryPanel(t, sc, getCreateCommand(restricted.Result.Id, "CPU restricted"))
+
+			search := func(user *models.SignedInUser) libraryPanelSearchResult {
+				sc.reqContext.SignedInUser = user
+				sc.ctx.Req.Request = &http.Request{URL: &url.URL{RawQuery: "query=cpu&includeModel=true"}}
+				response := sc.service.searchHandler(sc.reqContext)
+				require.Equal(t, 200, response.Status())
+				var result libraryPanelSearchResult
+				err := json.Unmarshal(response.Body(), &result)
+				require.NoError(t, err)
+				return result
+			}
+			allowed := &models.SignedInUser{UserId: 2, OrgId: 1, OrgRole: models.ROLE_VIEWER}
+			denied := &models.SignedInUser{UserId: 3, OrgId: 1, OrgRole: models.ROLE_VIEWER}
+
+			result := search(allowed).Result
+			require.Equal(t, int64(2), result.TotalCount)
+			require.Len(t, result.Facets.ByFolder, 2)
+			result = search(denied).Result
+			require.Equal(t, int64(1), result.TotalCount)
+			require.Len(t, result.LibraryPanels, 1)
+			require.Equal(t, "CPU open", result.LibraryPanels[0].Name)
+			require.Len(t, result.Facets.ByFolder, 1)
+
+			sc.reqContext.ReplaceAllParams(map[string]string{":uid": hidden.UID})
+			sc.reqContext.SignedInUser = allowed
+			response := sc.service.getHandler(sc.reqContext)
+			require.Equal(t, 200, response.Status())
+			response = sc.service.getConnectedDashboardsHandler(sc.reqContext)
+			require.Equal(t, 200, response.Status())
+			sc.reqContext.SignedInUser = denied
+			response = sc.service.getHandler(sc.reqContext)
+			requireErrorCode(t, response, 404, errorCodeNotFound)
+			response = sc.service.getConnectedDashboardsHandler(sc.reqContext)
+			requireErrorCode(t, response, 404, errorCodeNotFound)
+		})
+}
+
+// restrictDashboard replaces the default permissions of the dashboard or folder, so only admins can edit it.
+func restrictDashboard(t *testing.T, dashboardID int64) {
+	t.Helper()
+
+	viewer := models.ROLE_VIEWER
+	err := bus.Dispatch(&models.UpdateDashboardAclCommand{
+		DashboardID: dashboardID,
+		Items: []*models.DashboardAcl{{
+			OrgID: 1, DashboardID: dashboardID, Role: &viewer, Permission: models.PERMISSION_VIEW,
+			Created: time.Now(), Updated: time.Now(),
+		}},
+	})
+	require.NoError(t, err)
+}
@@ -0,0 +1,65 @@
+package librarypanels
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/grafana/pkg/infra/log"
+)
+
+func TestPinnedLibraryPanels(t *testing.T) {
+	testScenario(t, "When a library panel is pinned, the cleanup should keep it and lists should show it",
+		func(t *testing.T, sc scenarioContext) {
+			sc.service.log = log.New("librarypanels")
+			pinned := createLibraryPanel(t, sc, getCreateCommand(1, "Pinned"))
+			unpinned := createLibraryPanel(t, sc, getCreateCommand(1, "Unpinned"))
+			setLibraryPanelCreated(t, sc, time.Now().AddDate(0, 0, -40), pinned.UID, unpinned.UID)
+
+			sc.reqContext.ReplaceAllParams(map[string]string{":uid": pinned.UID})
+			response := sc.service.pinHandler(sc.reqContext)
+			require.Equal(t, 200, response.Status())
+
+			var all struct {
+				Result []struct {
+					UID    string `json:"uid"`
+					Pinned bool   `json:"pinned"`
+				} `json:"result"`
+			}
+			response = sc.service.getAllHandler(sc.reqContext)
+			require.Equal(t, 200, response.Status())
+			err := json.Unmarshal(response.Body(), &all)
+			require.NoError(t, err)
+			require.Len(t, all.Result, 2)
+			for _, libraryPanel := range all.Result {
+				require.Equal(t, libraryPanel.UID == pinned.UID, libraryPanel.Pinned)
+			}
+
+			response = sc.service.getUnusedHandler(sc.reqContext)
+			require.Equal(t, 200, response.Status())
+			var unused libraryPanelsResult
+			err = json.Unmarshal(response.Body(), &unused)
+			require.NoError(t, err)
+			require.Len(t, unused.Result, 1)
+			require.Equal(t, unpinned.UID, unused.Result[0].UID)
+
+			cmd := updateCleanupPolicyCommand{Enabled: true, OlderThanDays: 30, Action: cleanupActionDelete}
+			response = sc.service.updateCleanupPolicyHandler(sc.reqContext, cmd)
+			require.Equal(t, 200, response.Status())
+			removed, err := sc.service.cleanUpUnusedLibraryPanels()
+			require.NoError(t, err)
+			require.Equal(t, 1, removed)
+			_, err = sc.service.getLibraryPanel(sc.reqContext, pinned.UID)
+			require.NoError(t, err)
+
+			response = sc.service.unpinHandler(sc.reqContext)
+			require.Equal(t, 200, response.Status())
+			removed, err = sc.service.cleanUpUnusedLibraryPanels()
+			require.NoError(t, err)
+			require.Equal(t, 1, removed)
+			_, err = sc.service.getLibraryPanel(sc.reqContext, pinned.UID)
+			require.Equal(t, errLibraryPanelNotFound, err)
+		})
+}
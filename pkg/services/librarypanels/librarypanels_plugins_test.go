@@ -0,0 +1,92 @@
+package librarypanels
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/grafana/pkg/infra/log"
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/plugins"
+)
+
+func TestPluginLibraryPanels(t *testing.T) {
+	testScenario(t, "When an app plugin is enabled and disabled, its library panels should be added and removed",
+		func(t *testing.T, sc scenarioContext) {
+			sc.service.log = log.New("librarypanels")
+			plugin := installTestAppPlugin(t, map[string]string{
+				"panels/cpu.json":    `{ "type": "graph", "title": "CPU" }`,
+				"panels/memory.json": `{ "type": "graph", "title": "Memory" }`,
+			})
+			plugin.Includes = append(plugin.Includes, &plugins.PluginInclude{Type: "dashboard", Path: "dashboards/overview.json"})
+
+			err := sc.service.handlePluginStateChanged(&models.PluginStateChangedEvent{PluginId: plugin.Id, OrgId: 1, Enabled: true})
+			require.NoError(t, err)
+			libraryPanels, err := sc.service.getAllLibraryPanels(sc.reqContext, getAllLibraryPanelsQuery{})
+			require.NoError(t, err)
+			require.Len(t, libraryPanels, 2)
+			// the includes are read in no particular order
+			if libraryPanels[0].Name != "cpu" {
+				libraryPanels[0], libraryPanels[1] = libraryPanels[1], libraryPanels[0]
+			}
+			require.Equal(t, "cpu", libraryPanels[0].Name)
+			require.Equal(t, plugin.Id, libraryPanels[0].PluginID)
+
+			// enabling again keeps the same library panels
+			err = sc.service.handlePluginStateChanged(&models.PluginStateChangedEvent{PluginId: plugin.Id, OrgId: 1, Enabled: true})
+			require.NoError(t, err)
+			again, err := sc.service.getAllLibraryPanels(sc.reqContext, getAllLibraryPanelsQuery{})
+			require.NoError(t, err)
+			require.ElementsMatch(t, []string{libraryPanels[0].UID, libraryPanels[1].UID}, []string{again[0].UID, again[1].UID})
+
+			// a used library panel is orphaned, an unused one is deleted
+			dash := saveTestDashboard(t, `{ "title": "Dashboard", "panels": [] }`)
+			err = sc.service.connectDashboard(sc.reqContext, libraryPanels[0].UID, dash.Id, 0)
+			require.NoError(t, err)
+			err = sc.service.handlePluginStateChanged(&models.PluginStateChangedEvent{PluginId: plugin.Id, OrgId: 1, Enabled: false})
+			require.NoError(t, err)
+			remaining, err := sc.service.getAllLibraryPanels(sc.reqContext, getAllLibraryPanelsQuery{})
+			require.NoError(t, err)
+			require.Len(t, remaining, 1)
+			require.Equal(t, libraryPanels[0].UID, remaining[0].UID)
+			require.Empty(t, remaining[0].PluginPath)
+
+			// the orphan is adopted again when the plugin is enabled
+			err = sc.service.handlePluginStateChanged(&models.PluginStateChangedEvent{PluginId: plugin.Id, OrgId: 1, Enabled: true})
+			require.NoError(t, err)
+			adopted, err := sc.service.getLibraryPanel(sc.reqContext, libraryPanels[0].UID)
+			require.NoError(t, err)
+			require.Equal(t, "panels/cpu.json", adopted.PluginPath)
+		})
+
+	testScenario(t, "When an app plugin ships an invalid library panel, enabling it should fail",
+		func(t *testing.T, sc scenarioContext) {
+			plugin := installTestAppPlugin(t, map[string]string{"panels/cpu.json": `{ "title": "No type" }`})
+
+			err := sc.service.handlePluginStateChanged(&models.PluginStateChangedEvent{PluginId: plugin.Id, OrgId: 1, Enabled: true})
+			require.Error(t, err)
+		})
+}
+
+// installTestAppPlugin registers an app plugin with a library panel include for each file. The includes have no
+// name, so the library panels are named after their file.
+func installTestAppPlugin(t *testing.T, files map[string]string) *plugins.PluginBase {
+	t.Helper()
+
+	dir := t.TempDir()
+	plugin := &plugins.PluginBase{Id: "test-app", Type: "app", PluginDir: dir}
+	for path, content := range files {
+		require.NoError(t, os.MkdirAll(filepath.Join(dir, filepath.Dir(path)), 0750))
+		require.NoError(t, ioutil.WriteFile(filepath.Join(dir, path), []byte(content), 0600))
+		plugin.Includes = append(plugin.Includes, &plugins.PluginInclude{Type: pluginIncludeLibraryPanel, Path: path})
+	}
+
+	installed := plugins.Plugins
+	plugins.Plugins = map[string]*plugins.PluginBase{plugin.Id: plugin}
+	t.Cleanup(func() { plugins.Plugins = installed })
+
+	return plugin
+}
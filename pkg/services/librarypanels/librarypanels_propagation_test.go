@@ -0,0 +1,160 @@
+package librarypanels
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/grafana/pkg/components/simplejson"
+	"github.com/grafana/grafana/pkg/infra/log"
+	"github.com/grafana/grafana/pkg/services/dashboards"
+	"github.com/grafana/grafana/pkg/services/sqlstore"
+)
+
+func TestLibraryPanelPropagation(t *testing.T) {
+	testScenario(t, "When auto propagation is disabled, patching a library panel should not queue an update",
+		func(t *testing.T, sc scenarioContext) {
+			existing := createLibraryPanel(t, sc, getCreateCommand(1, "Text - Library Panel"))
+
+			sc.reqContext.ReplaceAllParams(map[string]string{":uid": existing.UID})
+			response := sc.service.patchHandler(sc.reqContext, patchLibraryPanelCommand{Model: []byte(`{ "type": "graph" }`)})
+			require.Equal(t, 200, response.Status())
+			require.Empty(t, getPropagationJobs(t, sc))
+		})
+
+	testScenario(t, "When auto propagation is enabled, patching a library panel should update the connected dashboards",
+		func(t *testing.T, sc scenarioContext) {
+			fakeService := &dashboards.FakeDashboardService{}
+			newService := dashboards.NewService
+			dashboards.MockDashboardService(fakeService)
+			t.Cleanup(func() { dashboards.NewService = newService })
+
+			sc.service.log = log.New("librarypanels")
+			sc.service.Cfg.LibraryPanels.AutoPropagate = true
+			sc.service.propagationWake = make(chan struct{}, 1)
+			existing := createLibraryPanel(t, sc, getCreateCommand(1, "Text - Library Panel"))
+			other := createLibraryPanel(t, sc, getCreateCommand(1, "Other"))
+			dash := saveTestDashboard(t, fmt.Sprintf(`{
+				"title": "Propagated",
+				"panels": [
+					{ "id": 1, "gridPos": { "x": 0, "y": 0, "w": 12, "h": 4 }, "libraryPanel": { "uid": %q } },
+					{ "id": 2, "type": "row", "collapsed": true, "panels": [
+						{ "id": 3, "gridPos": { "x": 0, "y": 5, "w": 12, "h": 4 }, "libraryPanel": { "uid": %q } }
+					] },
+					{ "id": 4, "type": "text", "libraryPanel": { "uid": %q } }
+				]
+			}`, existing.UID, existing.UID, other.UID))
+			for _, panelID := range []int64{1, 3} {
+				err := sc.service.connectDashboard(sc.reqContext, existing.UID, dash.Id, panelID)
+				require.NoError(t, err)
+			}
+
+			sc.reqContext.ReplaceAllParams(map[string]string{":uid": existing.UID})
+			response := sc.service.patchHandler(sc.reqContext, patchLibraryPanelCommand{Name: "Renamed", Model: []byte(`{ "type": "graph", "title": "Updated" }`)})
+			require.Equal(t, 200, response.Status())
+			require.Len(t, sc.service.propagationWake, 1)
+			require.Len(t, getPropagationJobs(t, sc), 1)
+
+			count, err := sc.service.propagatePendingUpdates()
+			require.NoError(t, err)
+			require.Equal(t, 1, count)
+			require.Len(t, fakeService.SavedDashboards, 1)
+			require.Empty(t, getPropagationJobs(t, sc))
+
+			saved := fakeService.SavedDashboards[0]
+			require.Equal(t, int64(0), saved.User.UserId)
+			panels := saved.Dashboard.Data.Get("panels")
+			for _, panel := range []*simplejson.Json{panels.GetIndex(0), panels.GetIndex(1).Get("panels").GetIndex(0)} {
+				require.Equal(t, existing.UID, panel.Get("libraryPanel").Get("uid").MustString())
+				require.Equal(t, "Renamed", panel.Get("libraryPanel").Get("name").MustString())
+			}
+			require.Equal(t, "Updated", panels.GetIndex(0).Get("title").MustString())
+			require.Equal(t, 12, panels.GetIndex(0).Get("gridPos").Get("w").MustInt())
+			require.Equal(t, "graph", panels.GetIndex(1).Get("panels").GetIndex(0).Get("type").MustString())
+			require.Equal(t, int64(3), panels.GetIndex(1).Get("panels").GetIndex(0).Get("id").MustInt64())
+			require.Equal(t, "text", panels.GetIndex(2).Get("type").MustString())
+		})
+
+	testScenario(t, "When a propagation is queued again while it runs, or was claimed by a server that stopped, it should run again",
+		func(t *testing.T, sc scenarioContext) {
+			fakeService := &dashboards.FakeDashboardService{}
+			newService := dashboards.NewService
+			dashboards.MockDashboardService(fakeService)
+			t.Cleanup(func() { dashboards.NewService = newService })
+
+			sc.service.log = log.New("librarypanels")
+			sc.service.Cfg.LibraryPanels.AutoPropagate = true
+			existing := createLibraryPanel(t, sc, getCreateCommand(1, "Text - Library Panel"))
+			dash := saveTestDashboard(t, fmt.Sprintf(`{ "title": "Propagated", "panels": [{ "id": 1, "libraryPanel": { "uid": %q } }] }`, existing.UID))
+			err := sc.service.connectDashboard(sc.reqContext, existing.UID, dash.Id, 1)
+			require.NoError(t, err)
+			sc.service.enqueuePropagation(LibraryPanel{OrgID: 1, UID: existing.UID})
+			jobs := getPropagationJobs(t, sc)
+			require.Len(t, jobs, 1)
+
+			// queued again after the job was read, like by a patch while the dashboards are updated
+			sc.service.enqueuePropagation(LibraryPanel{OrgID: 1, UID: existing.UID})
+			count, err := sc.service.propagateToDashboards(jobs[0])
+			require.NoError(t, err)
+			require.Equal(t, 1, count)
+			err = sc.service.SQLStore.WithDbSession(context.Background(), func(session *sqlstore.DBSession) error {
+				_, err := session.Exec("DELETE FROM library_panel_propagation WHERE id=? AND queued=?", jobs[0].ID, jobs[0].Queued)
+				return err
+			})
+			require.NoError(t, err)
+			require.Len(t, getPropagationJobs(t, sc), 1)
+
+			// claimed by a server that stopped before it was done
+			err = sc.service.SQLStore.WithDbSession(context.Background(), func(session *sqlstore.DBSession) error {
+				_, err := session.Exec("UPDATE library_panel_propagation SET claimed_at=?", time.Now().Add(-propagationClaimTimeout).Add(-time.Second).Unix())
+				return err
+			})
+			require.NoError(t, err)
+			count, err = sc.service.propagatePendingUpdates()
+			require.NoError(t, err)
+			require.Equal(t, 1, count)
+			require.Empty(t, getPropagationJobs(t, sc))
+
+			// claimed by a server that is still updating the dashboards
+			sc.service.enqueuePropagation(LibraryPanel{OrgID: 1, UID: existing.UID})
+			err = sc.service.SQLStore.WithDbSession(context.Background(), func(session *sqlstore.DBSession) error {
+				_, err := session.Exec("UPDATE library_panel_propagation SET claimed_at=?", time.Now().Unix())
+				return err
+			})
+			require.NoError(t, err)
+			count, err = sc.service.propagatePendingUpdates()
+			require.NoError(t, err)
+			require.Zero(t, count)
+			require.Len(t, getPropagationJobs(t, sc), 1)
+		})
+
+	testScenario(t, "When a queued library panel was deleted, its propagation should be removed",
+		func(t *testing.T, sc scenarioContext) {
+			sc.service.log = log.New("librarypanels")
+			sc.service.Cfg.LibraryPanels.AutoPropagate = true
+			existing := createLibraryPanel(t, sc, getCreateCommand(1, "Text - Library Panel"))
+			sc.service.enqueuePropagation(LibraryPanel{OrgID: 1, UID: existing.UID})
+			err := sc.service.deleteLibraryPanel(sc.reqContext, existing.UID)
+			require.NoError(t, err)
+
+			count, err := sc.service.propagatePendingUpdates()
+			require.NoError(t, err)
+			require.Zero(t, count)
+			require.Empty(t, getPropagationJobs(t, sc))
+		})
+}
+
+func getPropagationJobs(t *testing.T, sc scenarioContext) []propagationJob {
+	t.Helper()
+
+	var jobs []propagationJob
+	err := sc.service.SQLStore.WithDbSession(context.Background(), func(session *sqlstore.DBSession) error {
+		return session.Table("library_panel_propagation").Find(&jobs)
+	})
+	require.NoError(t, err)
+
+	return jobs
+}
@@ -0,0 +1,143 @@
+package librarypanels
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/grafana/pkg/components/simplejson"
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/sqlstore"
+)
+
+func TestLibraryQueries(t *testing.T) {
+	testScenario(t, "When a dashboard is loaded, the targets referencing a library query should be replaced by the query",
+		func(t *testing.T, sc scenarioContext) {
+			query := createLibraryQuery(t, sc, "Uptime query", `{ "datasource": "Prometheus", "expr": "up" }`)
+			panel := createLibraryPanel(t, sc, getCreateCommandWithModel(1, "Uptime", `{ "type": "graph", "targets": [
+				{ "refId": "B", "hide": true, "expr": "stale", "libraryQuery": { "uid": "`+query.UID+`" } },
+				{ "refId": "C", "libraryQuery": { "uid": "`+query.UID+`", "version": 1 } }
+			] }`))
+			sc.reqContext.ReplaceAllParams(map[string]string{":uid": query.UID})
+			response := sc.service.patchHandler(sc.reqContext, patchLibraryPanelCommand{
+				Model: []byte(`{ "datasource": "Prometheus", "expr": "rate(up[5m])" }`),
+			})
+			require.Equal(t, 200, response.Status())
+
+			dash := getDashboardWithLibraryPanels(t, panel.UID, "unknown")
+			err := sc.service.LoadLibraryPanelsForDashboard(sc.reqContext, dash)
+			require.NoError(t, err)
+
+			targets := dash.Data.Get("panels").GetIndex(0).Get("targets")
+			latest := targets.GetIndex(0)
+			require.Equal(t, "B", latest.Get("refId").MustString())
+			require.True(t, latest.Get("hide").MustBool())
+			require.Equal(t, "Prometheus", latest.Get("datasource").MustString())
+			require.Equal(t, "rate(up[5m])", latest.Get("expr").MustString())
+			require.Equal(t, "Uptime query", latest.Get("libraryQuery").Get("name").MustString())
+			pinned := targets.GetIndex(1)
+			require.Equal(t, "C", pinned.Get("refId").MustString())
+			require.Equal(t, "up", pinned.Get("expr").MustString())
+
+			response = sc.service.getQueryVersionsHandler(sc.reqContext)
+			require.Equal(t, 200, response.Status())
+			var result struct {
+				Result []libraryQueryVersion `json:"result"`
+			}
+			err = json.Unmarshal(response.Body(), &result)
+			require.NoError(t, err)
+			require.Len(t, result.Result, 2)
+			require.Equal(t, int64(2), result.Result[0].Version)
+			require.JSONEq(t, `{ "datasource": "Prometheus", "expr": "up" }`, string(result.Result[1].Model))
+		})
+
+	testScenario(t, "When alerts are extracted, the targets referencing a library query should be replaced by the query",
+		func(t *testing.T, sc scenarioContext) {
+			query := createLibraryQuery(t, sc, "Uptime query", `{ "datasource": "Prometheus", "expr": "up" }`)
+			dashboard, err := simplejson.NewJson([]byte(`{ "panels": [
+				{ "id": 1, "targets": [{ "refId": "A", "libraryQuery": { "uid": "` + query.UID + `" } }] }
+			] }`))
+			require.NoError(t, err)
+
+			err = sc.service.resolveLibraryQueriesHandler(&models.ResolveLibraryQueriesCommand{OrgId: 1, Dashboard: dashboard})
+			require.NoError(t, err)
+			target := dashboard.Get("panels").GetIndex(0).Get("targets").GetIndex(0)
+			require.Equal(t, "Prometheus", target.Get("datasource").MustString())
+			require.Equal(t, "A", target.Get("refId").MustString())
+		})
+
+	testScenario(t, "When library queries are invalid, unknown or in use, it should fail",
+		func(t *testing.T, sc scenarioContext) {
+			command := getCreateCommandWithModel(1, "No data source", `{ "expr": "up" }`)
+			command.Kind = queryElement
+			response := sc.service.createHandler(sc.reqContext, command)
+			require.Equal(t, 400, response.Status())
+
+			command = getCreateCommandWithModel(1, "Unknown query", `{ "type": "graph", "targets": [{ "libraryQuery": { "uid": "unknown" } }] }`)
+			response = sc.service.createHandler(sc.reqContext, command)
+			require.Equal(t, 400, response.Status())
+
+			query := createLibraryQuery(t, sc, "Uptime query", `{ "datasource": "Prometheus", "expr": "up" }`)
+			panel := createLibraryPanel(t, sc, getCreateCommandWithModel(1, "Uptime",
+				`{ "type": "graph", "targets": [{ "libraryQuery": { "uid": "`+query.UID+`" } }] }`))
+			sc.reqContext.ReplaceAllParams(map[string]string{":uid": query.UID})
+			response = sc.service.deleteHandler(sc.reqContext)
+			requireErrorCode(t, response, 409, errorCodeHasConnections)
+
+			sc.reqContext.ReplaceAllParams(map[string]string{":uid": panel.UID})
+			response = sc.service.getQueryVersionsHandler(sc.reqContext)
+			require.Equal(t, 400, response.Status())
+		})
+
+	testScenario(t, "When the library query usage is requested, it should count the library elements, dashboards and alerts using them",
+		func(t *testing.T, sc scenarioContext) {
+			query := createLibraryQuery(t, sc, "Uptime query", `{ "datasource": "Prometheus", "expr": "up" }`)
+			createLibraryQuery(t, sc, "Unused query", `{ "datasource": "Loki", "expr": "{job=\"grafana\"}" }`)
+			panel := createLibraryPanel(t, sc, getCreateCommandWithModel(1, "Uptime",
+				`{ "type": "graph", "targets": [{ "libraryQuery": { "uid": "`+query.UID+`" } }] }`))
+			dash := saveTestDashboard(t, `{ "title": "Dashboard", "panels": [] }`)
+			sc.reqContext.ReplaceAllParams(map[string]string{":uid": panel.UID, ":dashboardId": strconv.FormatInt(dash.Id, 10)})
+			response := sc.service.connectHandler(sc.reqContext)
+			require.Equal(t, 200, response.Status())
+			err := sc.service.SQLStore.WithDbSession(context.Background(), func(session *sqlstore.DBSession) error {
+				settings := simplejson.NewFromAny(map[string]interface{}{"conditions": []interface{}{map[string]interface{}{
+					"query": map[string]interface{}{"model": map[string]interface{}{
+						"refId": "A", "libraryQuery": map[string]interface{}{"uid": query.UID, "name": query.Name},
+					}},
+				}}})
+				_, err := session.Insert(&models.Alert{OrgId: 1, DashboardId: 1, PanelId: 2, Name: "Uptime alert",
+					Settings: settings, State: models.AlertStateOK, Created: time.Now(), Updated: time.Now(), NewStateDate: time.Now()})
+				return err
+			})
+			require.NoError(t, err)
+
+			response = sc.service.getQueryUsageReportHandler(sc.reqContext)
+			require.Equal(t, 200, response.Status())
+			var result struct {
+				Result []libraryQueryUsage `json:"result"`
+			}
+			err = json.Unmarshal(response.Body(), &result)
+			require.NoError(t, err)
+			require.Len(t, result.Result, 2)
+			require.Equal(t, "Unused query", result.Result[0].Name)
+			require.Equal(t, int64(0), result.Result[0].LibraryElements)
+			require.Equal(t, "Uptime query", result.Result[1].Name)
+			require.Equal(t, "Prometheus", result.Result[1].Datasource)
+			require.Equal(t, int64(1), result.Result[1].Version)
+			require.Equal(t, int64(1), result.Result[1].LibraryElements)
+			require.Equal(t, int64(1), result.Result[1].Dashboards)
+			require.Equal(t, int64(1), result.Result[1].Alerts)
+		})
+}
+
+func createLibraryQuery(t *testing.T, sc scenarioContext, name string, model string) libraryPanel {
+	t.Helper()
+
+	command := getCreateCommandWithModel(1, name, model)
+	command.Kind = queryElement
+	return createLibraryPanel(t, sc, command)
+}
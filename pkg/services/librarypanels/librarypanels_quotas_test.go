@@ -0,0 +1,57 @@
+package librarypanels
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/infra/log"
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/sqlstore"
+)
+
+func TestLibraryPanelQuotaWarning(t *testing.T) {
+	testScenario(t, "When the library panels of an org cross the quota warning threshold, the org admins should be notified once",
+		func(t *testing.T, sc scenarioContext) {
+			sc.service.log = log.New("librarypanels")
+			sc.service.Cfg.LibraryPanels.MaxPanelsPerOrg = 5
+			sc.service.Cfg.LibraryPanels.QuotaWarningThreshold = 80
+			admin := models.CreateUserCommand{Login: "admin", Email: "admin@example.com", SkipOrgSetup: true}
+			err := bus.Dispatch(&admin)
+			require.NoError(t, err)
+			viewer := models.CreateUserCommand{Login: "viewer", Email: "viewer@example.com", SkipOrgSetup: true}
+			err = bus.Dispatch(&viewer)
+			require.NoError(t, err)
+			err = sc.service.SQLStore.WithDbSession(context.Background(), func(session *sqlstore.DBSession) error {
+				_, err := session.Insert(
+					&models.OrgUser{OrgId: 1, UserId: admin.Result.Id, Role: models.ROLE_ADMIN, Created: time.Now(), Updated: time.Now()},
+					&models.OrgUser{OrgId: 1, UserId: viewer.Result.Id, Role: models.ROLE_VIEWER, Created: time.Now(), Updated: time.Now()},
+				)
+				return err
+			})
+			require.NoError(t, err)
+
+			for i := 1; i <= 3; i++ {
+				createLibraryPanel(t, sc, getCreateCommand(0, fmt.Sprintf("Panel %d", i)))
+			}
+			sc.reqContext.SignedInUser = &models.SignedInUser{UserId: admin.Result.Id, OrgId: 1, OrgRole: models.ROLE_ADMIN}
+			require.Empty(t, getNotifications(t, sc))
+
+			// the 4th of 5 library panels crosses 80%
+			createLibraryPanel(t, sc, getCreateCommand(0, "Panel 4"))
+			notifications := getNotifications(t, sc)
+			require.Len(t, notifications, 1)
+			require.Equal(t, "The org has 4 of its 5 library panels, more than 80% of its quota", notifications[0].Summary)
+			require.Equal(t, "Panel 4", notifications[0].LibraryPanelName)
+
+			createLibraryPanel(t, sc, getCreateCommand(0, "Panel 5"))
+			require.Len(t, getNotifications(t, sc), 1)
+
+			sc.reqContext.SignedInUser = &models.SignedInUser{UserId: viewer.Result.Id, OrgId: 1, OrgRole: models.ROLE_VIEWER}
+			require.Empty(t, getNotifications(t, sc))
+		})
+}
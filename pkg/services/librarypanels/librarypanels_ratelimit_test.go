@@ -0,0 +1,58 @@
+package librarypanels
+
+import (
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/macaron.v1"
+
+	"github.com/grafana/grafana/pkg/infra/log"
+	"github.com/grafana/grafana/pkg/infra/remotecache"
+	"github.com/grafana/grafana/pkg/models"
+)
+
+func TestRateLimit(t *testing.T) {
+	testScenario(t, "When users change library panels above the rate limits, the requests should be rejected",
+		func(t *testing.T, sc scenarioContext) {
+			sc.service.log = log.New("librarypanels")
+			sc.service.RemoteCache = remotecache.NewFakeStore(t)
+			sc.service.Cfg.LibraryPanels.UserRateLimit = 2
+			sc.service.Cfg.LibraryPanels.OrgRateLimit = 3
+
+			m := macaron.New()
+			m.Use(macaron.Renderer(macaron.RenderOptions{
+				Directory: "",
+				Delims:    macaron.Delims{Left: "[[", Right: "]]"},
+			}))
+			var user *models.SignedInUser
+			m.Post("/api/library-panels", func(c *macaron.Context) {
+				sc.service.rateLimit(&models.ReqContext{Context: c, SignedInUser: user})
+			})
+			request := func(signedInUser *models.SignedInUser) *httptest.ResponseRecorder {
+				user = signedInUser
+				recorder := httptest.NewRecorder()
+				m.ServeHTTP(recorder, httptest.NewRequest("POST", "/api/library-panels", nil))
+				return recorder
+			}
+
+			first := &models.SignedInUser{UserId: 1, OrgId: 1}
+			second := &models.SignedInUser{UserId: 2, OrgId: 1}
+			require.Equal(t, 200, request(first).Code)
+			require.Equal(t, 200, request(first).Code)
+
+			recorder := request(first)
+			require.Equal(t, 429, recorder.Code)
+			retryAfter, err := strconv.Atoi(recorder.Header().Get("Retry-After"))
+			require.NoError(t, err)
+			require.True(t, retryAfter > 0 && retryAfter <= 60)
+
+			// the rejected request isn't counted for the org
+			require.Equal(t, 200, request(second).Code)
+			require.Equal(t, 429, request(second).Code)
+
+			// other orgs have their own limits
+			require.Equal(t, 200, request(&models.SignedInUser{UserId: 2, OrgId: 2}).Code)
+		})
+}
@@ -0,0 +1,135 @@
+package librarypanels
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/grafana/pkg/components/simplejson"
+	"github.com/grafana/grafana/pkg/infra/log"
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/sqlstore"
+)
+
+func TestValidateLibraryPanelsForDashboard(t *testing.T) {
+	testScenario(t, "When a dashboard references library panels that don't exist, they should be returned as warnings",
+		func(t *testing.T, sc scenarioContext) {
+			sc.service.log = log.New("librarypanels")
+			existing := createLibraryPanel(t, sc, getCreateCommand(1, "Text - Library Panel"))
+
+			missing, err := sc.service.ValidateLibraryPanelsForDashboard(sc.reqContext, getDashboardWithLibraryPanels(t, existing.UID, "deleted"))
+			require.NoError(t, err)
+			require.Equal(t, []string{"deleted"}, missing)
+
+			missing, err = sc.service.ValidateLibraryPanelsForDashboard(sc.reqContext, getDashboardWithLibraryPanels(t, existing.UID, existing.UID))
+			require.NoError(t, err)
+			require.Empty(t, missing)
+		})
+
+	testScenario(t, "When missing references are rejected, a dashboard referencing library panels that don't exist should fail",
+		func(t *testing.T, sc scenarioContext) {
+			sc.service.Cfg.LibraryPanels.RejectMissingReferences = true
+			existing := createLibraryPanel(t, sc, getCreateCommand(1, "Text - Library Panel"))
+
+			_, err := sc.service.ValidateLibraryPanelsForDashboard(sc.reqContext, getDashboardWithLibraryPanels(t, "deleted", "other"))
+			var missingErr *MissingLibraryPanelsError
+			require.True(t, errors.As(err, &missingErr))
+			require.Equal(t, []string{"deleted", "other"}, missingErr.UIDs)
+
+			// the references are checked in the org of the user
+			sc.reqContext.SignedInUser.OrgId = 2
+			_, err = sc.service.ValidateLibraryPanelsForDashboard(sc.reqContext, getDashboardWithLibraryPanels(t, existing.UID, existing.UID))
+			require.True(t, errors.As(err, &missingErr))
+			require.Equal(t, []string{existing.UID}, missingErr.UIDs)
+		})
+}
+
+func TestGetBrokenLibraryPanelReferences(t *testing.T) {
+	testScenario(t, "When stored dashboards reference library panels that don't exist, they should be reported",
+		func(t *testing.T, sc scenarioContext) {
+			sc.service.log = log.New("librarypanels")
+			existing := createLibraryPanel(t, sc, getCreateCommand(1, "Text - Library Panel"))
+			folder := models.SaveDashboardCommand{OrgId: 1, IsFolder: true, Dashboard: simplejson.NewFromAny(map[string]interface{}{"title": "Team"})}
+			require.NoError(t, sqlstore.SaveDashboard(&folder))
+			brokenDashboard := getDashboardWithLibraryPanels(t, "deleted", existing.UID).Data
+			brokenDashboard.Set("title", "Broken")
+			workingDashboard := getDashboardWithLibraryPanels(t, existing.UID, existing.UID).Data
+			workingDashboard.Set("title", "Working")
+			for _, cmd := range []models.SaveDashboardCommand{
+				{OrgId: 1, FolderId: folder.Result.Id, Dashboard: brokenDashboard},
+				{OrgId: 1, Dashboard: workingDashboard},
+			} {
+				cmd := cmd
+				require.NoError(t, sqlstore.SaveDashboard(&cmd))
+			}
+
+			broken, err := sc.service.getBrokenLibraryPanelReferences(1)
+			require.NoError(t, err)
+			require.Len(t, broken, 2)
+			for i, panelID := range []int64{2, 4} {
+				require.Equal(t, "Broken", broken[i].DashboardTitle)
+				require.Equal(t, folder.Result.Uid, broken[i].FolderUID)
+				require.Equal(t, "Team", broken[i].FolderTitle)
+				require.Equal(t, panelID, broken[i].PanelID)
+				require.Equal(t, "deleted", broken[i].MissingUID)
+			}
+
+			count, err := sc.service.checkBrokenLibraryPanelReferences()
+			require.NoError(t, err)
+			require.Equal(t, 2, count)
+
+			broken, err = sc.service.getBrokenLibraryPanelReferences(2)
+			require.NoError(t, err)
+			require.Empty(t, broken)
+		})
+}
+
+func TestRepairBrokenLibraryPanelReferences(t *testing.T) {
+	testScenario(t, "When broken references are repaired, they should be rebound by mapping or by name",
+		func(t *testing.T, sc scenarioContext) {
+			renamed := createLibraryPanel(t, sc, getCreateCommand(1, "Text - Library Panel"))
+			replacement := createLibraryPanel(t, sc, getCreateCommand(1, "Replacement"))
+			data := getDashboardWithLibraryPanels(t, "deleted", "mapped").Data
+			data.Set("title", "Broken")
+			panels := data.Get("panels").MustArray()
+			panels[0].(map[string]interface{})["libraryPanel"].(map[string]interface{})["name"] = "Text - Library Panel"
+			panels = append(panels, map[string]interface{}{"id": 6, "libraryPanel": map[string]interface{}{"uid": "unknown", "name": "Unknown"}})
+			data.Set("panels", panels)
+			cmd := models.SaveDashboardCommand{OrgId: 1, Dashboard: data}
+			require.NoError(t, sqlstore.SaveDashboard(&cmd))
+
+			_, err := sc.service.repairBrokenLibraryPanelReferences(sc.reqContext, repairBrokenReferencesCommand{Mapping: map[string]string{"mapped": "unknown"}})
+			require.Equal(t, errLibraryPanelInvalidRepairMapping, err)
+
+			result, err := sc.service.repairBrokenLibraryPanelReferences(sc.reqContext, repairBrokenReferencesCommand{Mapping: map[string]string{"mapped": replacement.UID}})
+			require.NoError(t, err)
+			require.Len(t, result.Repaired, 2)
+			require.Equal(t, int64(2), result.Repaired[0].PanelID)
+			require.Equal(t, renamed.UID, result.Repaired[0].LibraryPanelUID)
+			require.Equal(t, int64(3), result.Repaired[1].PanelID)
+			require.Equal(t, replacement.UID, result.Repaired[1].LibraryPanelUID)
+			// the panel in the collapsed row has no name in its reference
+			require.Len(t, result.Unresolved, 2)
+			require.Equal(t, int64(4), result.Unresolved[0].PanelID)
+			require.Equal(t, "unknown", result.Unresolved[1].MissingUID)
+
+			query := models.GetDashboardQuery{Id: cmd.Result.Id, OrgId: 1}
+			require.NoError(t, sqlstore.GetDashboard(&query))
+			require.Equal(t, cmd.Result.Version+1, query.Result.Version)
+			references := getLibraryPanelReferences(query.Result.Data)
+			require.Len(t, references[renamed.UID], 1)
+			require.Equal(t, "Text - Library Panel", references[renamed.UID][0].Get("libraryPanel").Get("name").MustString())
+			require.Len(t, references[replacement.UID], 1)
+			require.Equal(t, "Replacement", references[replacement.UID][0].Get("libraryPanel").Get("name").MustString())
+			require.Len(t, references["deleted"], 1)
+
+			dashboardIDs, err := sc.service.getConnectedDashboards(sc.reqContext, replacement.UID)
+			require.NoError(t, err)
+			require.Equal(t, []int64{cmd.Result.Id}, dashboardIDs)
+
+			broken, err := sc.service.getBrokenLibraryPanelReferences(1)
+			require.NoError(t, err)
+			require.Len(t, broken, 2)
+		})
+}
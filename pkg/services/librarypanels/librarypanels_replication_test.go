@@ -0,0 +1,113 @@
+package librarypanels
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/sqlstore"
+)
+
+func TestLibraryPanelReplication(t *testing.T) {
+	testScenario(t, "When a library panel is replicated, the copies should follow it and be read only",
+		func(t *testing.T, sc scenarioContext) {
+			targetOrgID := createTestOrgs(t, sc, "Main", "Replicas")
+			existing := createLibraryPanel(t, sc, getCreateCommand(1, "Text - Library Panel"))
+
+			sc.reqContext.ReplaceAllParams(map[string]string{":uid": existing.UID})
+			response := sc.service.setReplicationHandler(sc.reqContext, setReplicationCommand{TargetOrgIDs: []int64{targetOrgID}})
+			require.Equal(t, 200, response.Status())
+			var result struct {
+				Result libraryPanelReplicationResult `json:"result"`
+			}
+			err := json.Unmarshal(response.Body(), &result)
+			require.NoError(t, err)
+			require.Equal(t, []int64{targetOrgID}, result.Result.TargetOrgIDs)
+			require.Equal(t, []replicaCopy{{OrgID: targetOrgID, UID: existing.UID}}, result.Result.Copies)
+
+			response = sc.service.patchHandler(sc.reqContext, patchLibraryPanelCommand{Name: "Renamed", Model: []byte(`{ "type": "text", "title": "Renamed" }`)})
+			require.Equal(t, 200, response.Status())
+			replica := getReplica(t, sc, targetOrgID, existing.UID)
+			require.Equal(t, "Renamed", replica.Name)
+			require.JSONEq(t, `{ "type": "text", "title": "Renamed" }`, string(replica.Model))
+
+			sc.reqContext.SignedInUser.OrgId = targetOrgID
+			response = sc.service.patchHandler(sc.reqContext, patchLibraryPanelCommand{Name: "Changed in the copy"})
+			require.Equal(t, 400, response.Status())
+			response = sc.service.deleteHandler(sc.reqContext)
+			require.Equal(t, 400, response.Status())
+			sc.reqContext.SignedInUser.OrgId = 1
+
+			response = sc.service.deleteHandler(sc.reqContext)
+			require.Equal(t, 200, response.Status())
+			require.Nil(t, getReplica(t, sc, targetOrgID, existing.UID))
+		})
+
+	testScenario(t, "When the replication of a library panel is stopped, the copies should be deleted by the reconciler",
+		func(t *testing.T, sc scenarioContext) {
+			targetOrgID := createTestOrgs(t, sc, "Main", "Replicas")
+			existing := createLibraryPanel(t, sc, getCreateCommand(1, "Text - Library Panel"))
+
+			sc.reqContext.ReplaceAllParams(map[string]string{":uid": existing.UID})
+			response := sc.service.setReplicationHandler(sc.reqContext, setReplicationCommand{TargetOrgIDs: []int64{1}})
+			require.Equal(t, 400, response.Status())
+			response = sc.service.setReplicationHandler(sc.reqContext, setReplicationCommand{TargetOrgIDs: []int64{targetOrgID + 100}})
+			require.Equal(t, 400, response.Status())
+
+			response = sc.service.setReplicationHandler(sc.reqContext, setReplicationCommand{TargetOrgIDs: []int64{targetOrgID}})
+			require.Equal(t, 200, response.Status())
+			require.NotNil(t, getReplica(t, sc, targetOrgID, existing.UID))
+
+			err := sc.service.SQLStore.WithDbSession(context.Background(), func(session *sqlstore.DBSession) error {
+				_, err := session.Exec("DELETE FROM library_panel_replication")
+				return err
+			})
+			require.NoError(t, err)
+			reconciled, err := sc.service.reconcileReplicatedLibraryPanels()
+			require.NoError(t, err)
+			require.Equal(t, 1, reconciled)
+			require.Nil(t, getReplica(t, sc, targetOrgID, existing.UID))
+		})
+}
+
+// createTestOrgs creates the orgs and returns the ID of the last one.
+func createTestOrgs(t *testing.T, sc scenarioContext, names ...string) int64 {
+	t.Helper()
+
+	var orgID int64
+	err := sc.service.SQLStore.WithDbSession(context.Background(), func(session *sqlstore.DBSession) error {
+		for _, name := range names {
+			org := models.Org{Name: name, Created: time.Now(), Updated: time.Now()}
+			if _, err := session.Insert(&org); err != nil {
+				return err
+			}
+			orgID = org.Id
+		}
+		return nil
+	})
+	require.NoError(t, err)
+
+	return orgID
+}
+
+func getReplica(t *testing.T, sc scenarioContext, orgID int64, uid string) *LibraryPanel {
+	t.Helper()
+
+	var replica *LibraryPanel
+	err := sc.service.SQLStore.WithDbSession(context.Background(), func(session *sqlstore.DBSession) error {
+		libraryPanel, err := getLibraryPanel(session, uid, orgID)
+		if err == nil {
+			replica = &libraryPanel
+		} else if err == errLibraryPanelNotFound {
+			err = nil
+		}
+		return err
+	})
+	require.NoError(t, err)
+
+	return replica
+}
@@ -0,0 +1,58 @@
+package librarypanels
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/grafana/pkg/services/sqlstore"
+)
+
+func TestDeleteExpiredLibraryQueryVersions(t *testing.T) {
+	testScenario(t, "When library query versions are beyond the retention, they should be deleted in batches except for the latest",
+		func(t *testing.T, sc scenarioContext) {
+			query := createLibraryQuery(t, sc, "Uptime query", `{ "datasource": "Prometheus", "expr": "up" }`)
+			sc.reqContext.ReplaceAllParams(map[string]string{":uid": query.UID})
+			for i := 2; i <= 5; i++ {
+				response := sc.service.patchHandler(sc.reqContext, patchLibraryPanelCommand{
+					Model: []byte(fmt.Sprintf(`{ "datasource": "Prometheus", "expr": "up%d" }`, i)),
+				})
+				require.Equal(t, 200, response.Status())
+			}
+			getVersions := func() []int64 {
+				versions, err := sc.service.getLibraryQueryVersions(sc.reqContext, query.UID)
+				require.NoError(t, err)
+				numbers := make([]int64, 0, len(versions))
+				for _, version := range versions {
+					numbers = append(numbers, version.Version)
+				}
+				return numbers
+			}
+			require.Equal(t, []int64{5, 4, 3, 2, 1}, getVersions())
+
+			sc.service.Cfg.LibraryPanels.VersionsToKeep = 0
+			result, err := sc.service.deleteExpiredVersions(2, 10)
+			require.NoError(t, err)
+			require.Zero(t, result.Deleted)
+
+			sc.service.Cfg.LibraryPanels.VersionsToKeep = 2
+			result, err = sc.service.deleteExpiredVersions(2, 10)
+			require.NoError(t, err)
+			require.Equal(t, int64(3), result.Deleted)
+			require.Equal(t, []int64{5, 4}, getVersions())
+
+			err = sc.service.SQLStore.WithDbSession(context.Background(), func(session *sqlstore.DBSession) error {
+				_, err := session.Exec("UPDATE library_query_version SET created=?", time.Now().AddDate(0, 0, -10))
+				return err
+			})
+			require.NoError(t, err)
+			sc.service.Cfg.LibraryPanels.VersionMaxAgeDays = 7
+			response := sc.service.cleanupVersionsHandler(sc.reqContext)
+			require.Equal(t, 200, response.Status())
+			require.JSONEq(t, `{"result": {"deleted": 1}}`, string(response.Body()))
+			require.Equal(t, []int64{5}, getVersions())
+		})
+}
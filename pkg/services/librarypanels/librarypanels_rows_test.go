@@ -0,0 +1,99 @@
+package librarypanels
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/grafana/pkg/components/simplejson"
+	"github.com/grafana/grafana/pkg/models"
+)
+
+func TestLibraryRows(t *testing.T) {
+	testScenario(t, "When an admin creates a library row with invalid panels, it should fail with validation errors",
+		func(t *testing.T, sc scenarioContext) {
+			command := getCreateCommandWithModel(1, "Invalid row", `{ "type": "row", "repeat": 1, "panels": [{ "type": "text" }, { "title": "No type" }] }`)
+			command.Kind = rowElement
+			response := sc.service.createHandler(sc.reqContext, command)
+			require.Equal(t, 400, response.Status())
+
+			var result validationErrorsResult
+			err := json.Unmarshal(response.Body(), &result)
+			require.NoError(t, err)
+			fields := make([]string, 0, len(result.Errors))
+			for _, validationErr := range result.Errors {
+				fields = append(fields, validationErr.Field)
+			}
+			require.Equal(t, []string{"model.panels[1].type", "model.repeat"}, fields)
+		})
+
+	testScenario(t, "When an admin loads a dashboard with an expanded library row, the row panels should be added below the row",
+		func(t *testing.T, sc scenarioContext) {
+			row := createLibraryPanel(t, sc, getCreateRowCommand(1, "Servers"))
+			require.Equal(t, int64(rowElement), row.Kind)
+
+			dash := getRowDashboard(t, row.UID, false)
+			err := sc.service.LoadLibraryPanelsForDashboard(sc.reqContext, dash)
+			require.NoError(t, err)
+
+			panels := dash.Data.Get("panels")
+			require.Len(t, panels.MustArray(), 4)
+			resolved := panels.GetIndex(1)
+			require.Equal(t, "Servers", resolved.Get("title").MustString())
+			require.Equal(t, "server", resolved.Get("repeat").MustString())
+			require.Equal(t, row.UID, resolved.Get("libraryRow").Get("uid").MustString())
+			require.Empty(t, resolved.Get("panels").MustArray())
+
+			child := panels.GetIndex(2)
+			require.Equal(t, "CPU", child.Get("title").MustString())
+			require.Equal(t, int64(4), child.Get("id").MustInt64())
+			require.Equal(t, 6, child.Get("gridPos").Get("y").MustInt())
+			require.Equal(t, 13, panels.GetIndex(3).Get("gridPos").Get("y").MustInt())
+		})
+
+	testScenario(t, "When an admin loads a dashboard with a collapsed library row, the row panels should stay in the row",
+		func(t *testing.T, sc scenarioContext) {
+			row := createLibraryPanel(t, sc, getCreateRowCommand(1, "Servers"))
+
+			dash := getRowDashboard(t, row.UID, true)
+			err := sc.service.LoadLibraryPanelsForDashboard(sc.reqContext, dash)
+			require.NoError(t, err)
+
+			panels := dash.Data.Get("panels")
+			require.Len(t, panels.MustArray(), 3)
+			children := panels.GetIndex(1).Get("panels")
+			require.Len(t, children.MustArray(), 1)
+			require.Equal(t, "CPU", children.GetIndex(0).Get("title").MustString())
+			require.Equal(t, 6, children.GetIndex(0).Get("gridPos").Get("y").MustInt())
+			require.Equal(t, 6, panels.GetIndex(2).Get("gridPos").Get("y").MustInt())
+		})
+}
+
+func getCreateRowCommand(folderID int64, name string) createLibraryPanelCommand {
+	command := getCreateCommandWithModel(folderID, name, `{
+		"type": "row",
+		"title": "Servers",
+		"repeat": "server",
+		"panels": [{ "type": "graph", "title": "CPU", "gridPos": { "x": 0, "y": 0, "w": 12, "h": 7 } }]
+	}`)
+	command.Kind = rowElement
+
+	return command
+}
+
+func getRowDashboard(t *testing.T, rowUID string, collapsed bool) *models.Dashboard {
+	t.Helper()
+
+	data, err := simplejson.NewJson([]byte(`{
+		"panels": [
+			{ "id": 1, "type": "text", "gridPos": { "x": 0, "y": 0, "w": 24, "h": 5 } },
+			{ "id": 2, "type": "row", "gridPos": { "x": 0, "y": 5, "w": 24, "h": 1 }, "libraryRow": { "uid": "` + rowUID + `" } },
+			{ "id": 3, "type": "text", "gridPos": { "x": 0, "y": 6, "w": 24, "h": 5 } }
+		]
+	}`))
+	require.NoError(t, err)
+	data.Get("panels").GetIndex(1).Set("collapsed", collapsed)
+
+	return models.NewDashboardFromJson(data)
+}
@@ -0,0 +1,94 @@
+package librarypanels
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/infra/log"
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/sqlstore"
+)
+
+func TestScheduledChanges(t *testing.T) {
+	testScenario(t, "When a change is scheduled, the old model should be served until it is published",
+		func(t *testing.T, sc scenarioContext) {
+			sc.service.log = log.New("librarypanels")
+			createUser := models.CreateUserCommand{Login: "scheduler", Email: "scheduler@example.com"}
+			err := bus.Dispatch(&createUser)
+			require.NoError(t, err)
+			require.Equal(t, sc.user.UserId, createUser.Result.Id)
+			require.Equal(t, sc.user.OrgId, createUser.Result.OrgId)
+			existing := createLibraryPanel(t, sc, getCreateCommand(1, "Text - Library Panel"))
+
+			sc.reqContext.ReplaceAllParams(map[string]string{":uid": existing.UID})
+			setEffectiveAt(sc, time.Now().Add(-time.Minute))
+			cmd := patchLibraryPanelCommand{Model: []byte(`{ "type": "text", "title": "Scheduled" }`)}
+			response := sc.service.patchHandler(sc.reqContext, cmd)
+			require.Equal(t, 400, response.Status())
+
+			setEffectiveAt(sc, time.Now().Add(time.Hour))
+			response = sc.service.patchHandler(sc.reqContext, cmd)
+			require.Equal(t, 202, response.Status())
+			var scheduled struct {
+				Result libraryPanelScheduledChange `json:"result"`
+			}
+			err = json.Unmarshal(response.Body(), &scheduled)
+			require.NoError(t, err)
+			require.Equal(t, scheduledChangeStatusScheduled, scheduled.Result.Status)
+
+			libraryPanel, err := sc.service.getLibraryPanel(sc.reqContext, existing.UID)
+			require.NoError(t, err)
+			require.JSONEq(t, `{ "datasource": "${DS_GDEV-TESTDATA}", "name": "Text - Library Panel", "type": "text" }`, string(libraryPanel.Model))
+			published, err := sc.service.publishDueScheduledChanges()
+			require.NoError(t, err)
+			require.Equal(t, 0, published)
+
+			err = sc.service.SQLStore.WithDbSession(context.Background(), func(session *sqlstore.DBSession) error {
+				_, err := session.Exec("UPDATE library_panel_scheduled_change SET effective_at=? WHERE id=?", time.Now().Add(-time.Second), scheduled.Result.ID)
+				return err
+			})
+			require.NoError(t, err)
+			published, err = sc.service.publishDueScheduledChanges()
+			require.NoError(t, err)
+			require.Equal(t, 1, published)
+			libraryPanel, err = sc.service.getLibraryPanel(sc.reqContext, existing.UID)
+			require.NoError(t, err)
+			require.JSONEq(t, `{ "type": "text", "title": "Scheduled" }`, string(libraryPanel.Model))
+			require.Equal(t, createUser.Result.Id, libraryPanel.UpdatedBy)
+			changes, err := sc.service.getScheduledChanges(sc.reqContext, existing.UID)
+			require.NoError(t, err)
+			require.Empty(t, changes)
+		})
+
+	testScenario(t, "When a scheduled change is cancelled, it should not be published",
+		func(t *testing.T, sc scenarioContext) {
+			existing := createLibraryPanel(t, sc, getCreateCommand(1, "Text - Library Panel"))
+
+			change, err := sc.service.scheduleLibraryPanelChange(sc.reqContext, patchLibraryPanelCommand{Name: "Renamed"}, existing.UID, time.Now().Add(time.Hour))
+			require.NoError(t, err)
+			changes, err := sc.service.getScheduledChanges(sc.reqContext, existing.UID)
+			require.NoError(t, err)
+			require.Len(t, changes, 1)
+
+			sc.reqContext.ReplaceAllParams(map[string]string{":uid": existing.UID, ":id": strconv.FormatInt(change.ID, 10)})
+			response := sc.service.cancelScheduledChangeHandler(sc.reqContext)
+			require.Equal(t, 200, response.Status())
+			response = sc.service.cancelScheduledChangeHandler(sc.reqContext)
+			require.Equal(t, 404, response.Status())
+			changes, err = sc.service.getScheduledChanges(sc.reqContext, existing.UID)
+			require.NoError(t, err)
+			require.Empty(t, changes)
+		})
+}
+
+func setEffectiveAt(sc scenarioContext, effectiveAt time.Time) {
+	sc.ctx.Req.Request = &http.Request{URL: &url.URL{RawQuery: url.Values{"effectiveAt": []string{effectiveAt.Format(time.RFC3339)}}.Encode()}, Header: http.Header{}}
+}
@@ -0,0 +1,94 @@
+package librarypanels
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/grafana/pkg/services/sqlstore"
+)
+
+func TestMigrateModel(t *testing.T) {
+	testCases := []struct {
+		desc        string
+		model       string
+		fromVersion int64
+		expected    string
+	}{
+		{desc: "angular table with styles", model: `{ "type": "table", "styles": [] }`, expected: `{ "type": "table-old", "styles": [] }`},
+		{desc: "react table", model: `{ "type": "table" }`, expected: `{ "type": "table" }`},
+		{desc: "react text", model: `{ "type": "text2", "options": { "angular": {}, "mode": "markdown" } }`, expected: `{ "type": "text", "options": { "mode": "markdown" } }`},
+		{desc: "only newer migrations", model: `{ "type": "table", "styles": [] }`, fromVersion: 24, expected: `{ "type": "table", "styles": [] }`},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			model, upgraded, err := migrateModel(json.RawMessage(tc.model), tc.fromVersion)
+			require.NoError(t, err)
+			require.True(t, upgraded)
+			require.JSONEq(t, tc.expected, string(model))
+		})
+	}
+
+	t.Run("current models are not touched", func(t *testing.T) {
+		model := json.RawMessage(`{ "type": "text2" }`)
+		migrated, upgraded, err := migrateModel(model, currentPanelSchemaVersion)
+		require.NoError(t, err)
+		require.False(t, upgraded)
+		require.Equal(t, model, migrated)
+	})
+}
+
+func TestUpgradeLibraryPanelModels(t *testing.T) {
+	testScenario(t, "When an admin gets a library panel with a stale model, the upgraded model should be returned",
+		func(t *testing.T, sc scenarioContext) {
+			existing := createLibraryPanel(t, sc, getCreateCommand(1, "Text - Library Panel"))
+			setStaleModel(t, sc, existing.UID, `{ "type": "text2", "options": { "angular": {} } }`)
+
+			sc.reqContext.ReplaceAllParams(map[string]string{":uid": existing.UID})
+			response := sc.service.getHandler(sc.reqContext)
+			require.Equal(t, 200, response.Status())
+
+			var result libraryPanelResult
+			err := json.Unmarshal(response.Body(), &result)
+			require.NoError(t, err)
+			require.Equal(t, "text", result.Result.Model["type"])
+			require.Equal(t, map[string]interface{}{}, result.Result.Model["options"])
+		})
+
+	testScenario(t, "When the stored models are upgraded, stale models should be stored with the current schema version",
+		func(t *testing.T, sc scenarioContext) {
+			stale := createLibraryPanel(t, sc, getCreateCommand(1, "Stale"))
+			createLibraryPanel(t, sc, getCreateCommand(1, "Current"))
+			setStaleModel(t, sc, stale.UID, `{ "type": "table", "styles": [] }`)
+
+			upgraded, err := sc.service.upgradeStoredLibraryPanelModels()
+			require.NoError(t, err)
+			require.Equal(t, 1, upgraded)
+
+			var stored LibraryPanel
+			err = sc.service.SQLStore.WithDbSession(context.Background(), func(session *sqlstore.DBSession) error {
+				_, err := session.Table("library_panel").Where("uid=?", stale.UID).Get(&stored)
+				return err
+			})
+			require.NoError(t, err)
+			require.Equal(t, int64(currentPanelSchemaVersion), stored.SchemaVersion)
+			require.JSONEq(t, `{ "type": "table-old", "styles": [] }`, string(stored.Model))
+
+			upgraded, err = sc.service.upgradeStoredLibraryPanelModels()
+			require.NoError(t, err)
+			require.Equal(t, 0, upgraded)
+		})
+}
+
+func setStaleModel(t *testing.T, sc scenarioContext, uid string, model string) {
+	t.Helper()
+
+	err := sc.service.SQLStore.WithDbSession(context.Background(), func(session *sqlstore.DBSession) error {
+		_, err := session.Exec("UPDATE library_panel SET model=?, schema_version=0 WHERE uid=?", model, uid)
+		return err
+	})
+	require.NoError(t, err)
+}
@@ -0,0 +1,272 @@
+package librarypanels
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/search"
+)
+
+func TestSearchLibraryPanels(t *testing.T) {
+	testScenario(t, "When an admin searches library panels, matches on name, tags and model should be ranked and paginated",
+		func(t *testing.T, sc scenarioContext) {
+			command := getCreateCommand(1, "CPU usage")
+			response := sc.service.createHandler(sc.reqContext, command)
+			require.Equal(t, 200, response.Status())
+
+			command = getCreateCommand(1, "Overall CPU usage")
+			response = sc.service.createHandler(sc.reqContext, command)
+			require.Equal(t, 200, response.Status())
+
+			command = getCreateCommand(1, "Memory")
+			command.Tags = []string{"cpu", " cpu ", ""}
+			response = sc.service.createHandler(sc.reqContext, command)
+			require.Equal(t, 200, response.Status())
+
+			command = getCreateCommand(1, "Disk")
+			command.Model = []byte(`{ "type": "graph", "description": "Shows cpu wait" }`)
+			response = sc.service.createHandler(sc.reqContext, command)
+			require.Equal(t, 200, response.Status())
+
+			command = getCreateCommand(1, "Network")
+			response = sc.service.createHandler(sc.reqContext, command)
+			require.Equal(t, 200, response.Status())
+
+			sc.ctx.Req.Request = &http.Request{URL: &url.URL{RawQuery: "query=cpu"}}
+			response = sc.service.searchHandler(sc.reqContext)
+			require.Equal(t, 200, response.Status())
+
+			var result libraryPanelSearchResult
+			err := json.Unmarshal(response.Body(), &result)
+			require.NoError(t, err)
+			require.Equal(t, int64(4), result.Result.TotalCount)
+			require.Equal(t, 4, len(result.Result.LibraryPanels))
+			require.Equal(t, "CPU usage", result.Result.LibraryPanels[0].Name)
+			require.Equal(t, []string{"cpu"}, result.Result.LibraryPanels[2].Tags)
+
+			sc.ctx.Req.Request = &http.Request{URL: &url.URL{RawQuery: "query=cpu&perpage=1&page=2"}}
+			response = sc.service.searchHandler(sc.reqContext)
+			require.Equal(t, 200, response.Status())
+
+			result = libraryPanelSearchResult{}
+			err = json.Unmarshal(response.Body(), &result)
+			require.NoError(t, err)
+			require.Equal(t, int64(4), result.Result.TotalCount)
+			require.Equal(t, 1, len(result.Result.LibraryPanels))
+			require.Equal(t, "Disk", result.Result.LibraryPanels[0].Name)
+		})
+
+	testScenario(t, "When an admin searches library panels, the models should only be included if asked for",
+		func(t *testing.T, sc scenarioContext) {
+			createLibraryPanel(t, sc, getCreateCommand(1, "CPU usage"))
+
+			for rawQuery, included := range map[string]bool{"query=cpu": false, "query=cpu&includeModel=true": true} {
+				sc.ctx.Req.Request = &http.Request{URL: &url.URL{RawQuery: rawQuery}}
+				response := sc.service.searchHandler(sc.reqContext)
+				require.Equal(t, 200, response.Status())
+
+				var result libraryPanelSearchResult
+				err := json.Unmarshal(response.Body(), &result)
+				require.NoError(t, err)
+				require.Len(t, result.Result.LibraryPanels, 1)
+				require.Equal(t, included, result.Result.LibraryPanels[0].Model != nil)
+			}
+		})
+
+	testScenario(t, "When a search has LIKE wildcards, they should match literally",
+		func(t *testing.T, sc scenarioContext) {
+			for _, name := range []string{"CPU 100% busy", "cpu_busy", "CPU busy"} {
+				command := getCreateCommand(0, name)
+				command.Model = []byte(`{ "type": "text" }`)
+				createLibraryPanel(t, sc, command)
+			}
+
+			for term, names := range map[string][]string{"%": {"CPU 100% busy"}, "_": {"cpu_busy"}, "cpu_": {"cpu_busy"}} {
+				sc.ctx.Req.Request = &http.Request{URL: &url.URL{RawQuery: url.Values{"query": {term}}.Encode()}}
+				response := sc.service.searchHandler(sc.reqContext)
+				require.Equal(t, 200, response.Status())
+				var result libraryPanelSearchResult
+				err := json.Unmarshal(response.Body(), &result)
+				require.NoError(t, err)
+				found := make([]string, 0, len(result.Result.LibraryPanels))
+				for _, panel := range result.Result.LibraryPanels {
+					found = append(found, panel.Name)
+				}
+				require.Equal(t, names, found, term)
+			}
+
+			query := search.FindLibraryPanelsQuery{Title: "_", SignedInUser: sc.reqContext.SignedInUser, Permission: models.PERMISSION_VIEW}
+			err := sc.service.findLibraryPanelsHandler(&query)
+			require.NoError(t, err)
+			require.Len(t, query.Result, 1)
+			require.Equal(t, "cpu_busy", query.Result[0].Title)
+		})
+
+	testScenario(t, "When a search matches the model, it should only match the values of its title and description",
+		func(t *testing.T, sc scenarioContext) {
+			command := getCreateCommand(0, "Disk")
+			command.Model = []byte(`{ "type": "graph", "title": "Disk * reads", "datasource": "${DS_TESTDATA}" }`)
+			createLibraryPanel(t, sc, command)
+			command = getCreateCommand(0, "Network")
+			command.Model = []byte(`{ "type": "graph", "description": "Bytes received" }`)
+			createLibraryPanel(t, sc, command)
+
+			for term, names := range map[string][]string{
+				"type": {}, "title": {}, "datasource": {}, "testdata": {}, "graph": {},
+				"* reads": {"Disk"}, "disk": {"Disk"}, "received": {"Network"},
+			} {
+				sc.ctx.Req.Request = &http.Request{URL: &url.URL{RawQuery: url.Values{"query": {term}}.Encode()}}
+				response := sc.service.searchHandler(sc.reqContext)
+				require.Equal(t, 200, response.Status())
+				var result libraryPanelSearchResult
+				err := json.Unmarshal(response.Body(), &result)
+				require.NoError(t, err)
+				found := make([]string, 0, len(result.Result.LibraryPanels))
+				for _, panel := range result.Result.LibraryPanels {
+					found = append(found, panel.Name)
+				}
+				require.Equal(t, names, found, term)
+			}
+		})
+
+	testScenario(t, "When an admin searches library panels, facets should count all matches by folder, type and tag",
+		func(t *testing.T, sc scenarioContext) {
+			command := getCreateCommand(1, "CPU usage")
+			command.Tags = []string{"cpu", "host"}
+			createLibraryPanel(t, sc, command)
+
+			command = getCreateCommand(0, "CPU load")
+			command.Tags = []string{"cpu"}
+			command.Model = []byte(`{ "type": "graph" }`)
+			createLibraryPanel(t, sc, command)
+
+			command = getCreateCommand(1, "Overall CPU usage")
+			createLibraryPanel(t, sc, command)
+
+			createLibraryPanel(t, sc, getCreateCommand(0, "Memory"))
+
+			sc.ctx.Req.Request = &http.Request{URL: &url.URL{RawQuery: "query=cpu&perpage=1"}}
+			response := sc.service.searchHandler(sc.reqContext)
+			require.Equal(t, 200, response.Status())
+
+			var result libraryPanelSearchResult
+			err := json.Unmarshal(response.Body(), &result)
+			require.NoError(t, err)
+			require.Len(t, result.Result.LibraryPanels, 1)
+			facets := result.Result.Facets
+			require.Len(t, facets.ByFolder, 2)
+			require.Equal(t, int64(1), facets.ByFolder[0].FolderID)
+			require.Equal(t, int64(2), facets.ByFolder[0].Count)
+			require.Equal(t, int64(0), facets.ByFolder[1].FolderID)
+			require.Equal(t, int64(1), facets.ByFolder[1].Count)
+			require.Equal(t, []libraryPanelTypeCount{{Type: "text", Count: 2}, {Type: "graph", Count: 1}}, facets.ByType)
+			require.Equal(t, []libraryPanelTagCount{{Term: "cpu", Count: 2}, {Term: "host", Count: 1}}, facets.ByTag)
+		})
+
+	testScenario(t, "When an admin searches library panels in another org, none should be returned",
+		func(t *testing.T, sc scenarioContext) {
+			command := getCreateCommand(1, "CPU usage")
+			response := sc.service.createHandler(sc.reqContext, command)
+			require.Equal(t, 200, response.Status())
+
+			sc.reqContext.SignedInUser.OrgId = 2
+			sc.ctx.Req.Request = &http.Request{URL: &url.URL{RawQuery: "query=cpu"}}
+			response = sc.service.searchHandler(sc.reqContext)
+			require.Equal(t, 200, response.Status())
+
+			var result libraryPanelSearchResult
+			err := json.Unmarshal(response.Body(), &result)
+			require.NoError(t, err)
+			require.Equal(t, int64(0), result.Result.TotalCount)
+			require.Equal(t, 0, len(result.Result.LibraryPanels))
+		})
+}
+
+func TestFindLibraryPanels(t *testing.T) {
+	testScenario(t, "When a viewer searches library panels through the search service, only panels they may view should be returned",
+		func(t *testing.T, sc scenarioContext) {
+			command := getCreateCommand(0, "CPU usage")
+			command.Tags = []string{"cpu"}
+			response := sc.service.createHandler(sc.reqContext, command)
+			require.Equal(t, 200, response.Status())
+
+			command = getCreateCommand(1, "CPU usage in restricted folder")
+			response = sc.service.createHandler(sc.reqContext, command)
+			require.Equal(t, 200, response.Status())
+
+			query := search.FindLibraryPanelsQuery{Title: "cpu", SignedInUser: sc.reqContext.SignedInUser, Permission: models.PERMISSION_VIEW}
+			err := sc.service.findLibraryPanelsHandler(&query)
+			require.NoError(t, err)
+			require.Equal(t, 2, len(query.Result))
+
+			sc.reqContext.SignedInUser.OrgRole = models.ROLE_VIEWER
+			query = search.FindLibraryPanelsQuery{Title: "cpu", SignedInUser: sc.reqContext.SignedInUser, Permission: models.PERMISSION_VIEW}
+			err = sc.service.findLibraryPanelsHandler(&query)
+			require.NoError(t, err)
+			require.Equal(t, 1, len(query.Result))
+			require.Equal(t, "CPU usage", query.Result[0].Title)
+			require.Equal(t, search.DashHitLibraryPanel, query.Result[0].Type)
+			require.Equal(t, []string{"cpu"}, query.Result[0].Tags)
+
+			query = search.FindLibraryPanelsQuery{Tags: []string{"cpu"}, SignedInUser: sc.reqContext.SignedInUser, Permission: models.PERMISSION_EDIT}
+			err = sc.service.findLibraryPanelsHandler(&query)
+			require.NoError(t, err)
+			require.Equal(t, 0, len(query.Result))
+		})
+}
+
+func TestSearchDashboardsByLibraryPanel(t *testing.T) {
+	testScenario(t, "When an admin searches dashboards by library panel, only the dashboards using it should be returned",
+		func(t *testing.T, sc scenarioContext) {
+			libraryPanel := createLibraryPanel(t, sc, getCreateCommand(0, "CPU usage"))
+			using := saveTestDashboard(t, `{"title": "Using"}`)
+			saveTestDashboard(t, `{"title": "Not using"}`)
+
+			sc.reqContext.ReplaceAllParams(map[string]string{":uid": libraryPanel.UID, ":dashboardId": strconv.FormatInt(using.Id, 10)})
+			response := sc.service.connectHandler(sc.reqContext)
+			require.Equal(t, 200, response.Status())
+
+			query := search.FindPersistedDashboardsQuery{SignedInUser: sc.reqContext.SignedInUser, Permission: models.PERMISSION_VIEW,
+				LibraryPanelUID: libraryPanel.UID}
+			err := bus.Dispatch(&query)
+			require.NoError(t, err)
+			require.Equal(t, 1, len(query.Result))
+			require.Equal(t, "Using", query.Result[0].Title)
+
+			query = search.FindPersistedDashboardsQuery{SignedInUser: sc.reqContext.SignedInUser, Permission: models.PERMISSION_VIEW,
+				LibraryPanelUID: "unknown"}
+			err = bus.Dispatch(&query)
+			require.NoError(t, err)
+			require.Equal(t, 0, len(query.Result))
+		})
+
+	testScenario(t, "When an admin searches dashboards with library panel counts, each dashboard should have the number of library panels it uses",
+		func(t *testing.T, sc scenarioContext) {
+			using := saveTestDashboard(t, `{"title": "Using"}`)
+			saveTestDashboard(t, `{"title": "Not using"}`)
+			for _, name := range []string{"CPU usage", "Memory usage"} {
+				libraryPanel := createLibraryPanel(t, sc, getCreateCommand(0, name))
+				sc.reqContext.ReplaceAllParams(map[string]string{":uid": libraryPanel.UID, ":dashboardId": strconv.FormatInt(using.Id, 10)})
+				response := sc.service.connectHandler(sc.reqContext)
+				require.Equal(t, 200, response.Status())
+			}
+
+			query := search.FindPersistedDashboardsQuery{SignedInUser: sc.reqContext.SignedInUser, Permission: models.PERMISSION_VIEW,
+				IncludeLibraryPanelCount: true}
+			err := bus.Dispatch(&query)
+			require.NoError(t, err)
+			require.Equal(t, 2, len(query.Result))
+			counts := map[string]int64{}
+			for _, hit := range query.Result {
+				counts[hit.Title] = hit.LibraryPanelCount
+			}
+			require.Equal(t, map[string]int64{"Using": 2, "Not using": 0}, counts)
+		})
+}
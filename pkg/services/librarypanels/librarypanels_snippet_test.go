@@ -0,0 +1,51 @@
+package librarypanels
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/grafana/pkg/components/simplejson"
+)
+
+func TestGetPanelSnippet(t *testing.T) {
+	testScenario(t, "When a library panel is exported as a snippet, it should be a dashboard panel referencing the library panel",
+		func(t *testing.T, sc scenarioContext) {
+			existing := createLibraryPanel(t, sc, getCreateCommand(1, "Text - Library Panel"))
+
+			sc.reqContext.ReplaceAllParams(map[string]string{":uid": existing.UID})
+			response := sc.service.getSnippetHandler(sc.reqContext)
+			require.Equal(t, 200, response.Status())
+			result, err := simplejson.NewJson(response.Body())
+			require.NoError(t, err)
+			snippet := result.Get("result")
+			require.Equal(t, "text", snippet.Get("type").MustString())
+			require.Equal(t, "${DS_GDEV-TESTDATA}", snippet.Get("datasource").MustString())
+			require.Equal(t, map[string]interface{}{"uid": existing.UID, "name": "Text - Library Panel"}, snippet.Get("libraryPanel").MustMap())
+			require.Equal(t, int64(12), snippet.Get("gridPos").Get("w").MustInt64())
+			require.Equal(t, int64(8), snippet.Get("gridPos").Get("h").MustInt64())
+			_, hasID := snippet.CheckGet("id")
+			require.False(t, hasID)
+
+			sc.ctx.Req.Request = &http.Request{URL: &url.URL{RawQuery: "panelId=7&x=12&y=8&w=6"}}
+			response = sc.service.getSnippetHandler(sc.reqContext)
+			require.Equal(t, 200, response.Status())
+			result, err = simplejson.NewJson(response.Body())
+			require.NoError(t, err)
+			snippet = result.Get("result")
+			require.Equal(t, int64(7), snippet.Get("id").MustInt64())
+			gridPos := snippet.Get("gridPos")
+			require.Equal(t, []int64{8, 6, 12, 8}, []int64{gridPos.Get("h").MustInt64(), gridPos.Get("w").MustInt64(), gridPos.Get("x").MustInt64(), gridPos.Get("y").MustInt64()})
+		})
+
+	testScenario(t, "When a library variable is exported as a snippet, it should fail",
+		func(t *testing.T, sc scenarioContext) {
+			variable := createLibraryPanel(t, sc, getCreateVariableCommand(1, "Server"))
+
+			sc.reqContext.ReplaceAllParams(map[string]string{":uid": variable.UID})
+			response := sc.service.getSnippetHandler(sc.reqContext)
+			require.Equal(t, 400, response.Status())
+		})
+}
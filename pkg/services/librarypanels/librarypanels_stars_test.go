@@ -0,0 +1,61 @@
+package librarypanels
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/grafana/pkg/models"
+)
+
+func TestLibraryPanelStars(t *testing.T) {
+	testScenario(t, "When a user stars library panels, the starred filter should only list their stars",
+		func(t *testing.T, sc scenarioContext) {
+			favorite := createLibraryPanel(t, sc, getCreateCommand(0, "Favorite"))
+			createLibraryPanel(t, sc, getCreateCommand(0, "Other"))
+
+			sc.reqContext.ReplaceAllParams(map[string]string{":uid": favorite.UID})
+			response := sc.service.starHandler(sc.reqContext)
+			require.Equal(t, 200, response.Status())
+			// starring twice does nothing
+			response = sc.service.starHandler(sc.reqContext)
+			require.Equal(t, 200, response.Status())
+
+			starred := getStarredLibraryPanels(t, sc)
+			require.Len(t, starred, 1)
+			require.Equal(t, favorite.UID, starred[0].UID)
+
+			admin := sc.reqContext.SignedInUser
+			sc.reqContext.SignedInUser = &models.SignedInUser{UserId: 2, OrgId: 1, OrgRole: models.ROLE_VIEWER}
+			require.Empty(t, getStarredLibraryPanels(t, sc))
+
+			sc.reqContext.SignedInUser = admin
+			response = sc.service.unstarHandler(sc.reqContext)
+			require.Equal(t, 200, response.Status())
+			require.Empty(t, getStarredLibraryPanels(t, sc))
+		})
+
+	testScenario(t, "When a user stars a library panel that doesn't exist, it should fail",
+		func(t *testing.T, sc scenarioContext) {
+			sc.reqContext.ReplaceAllParams(map[string]string{":uid": "unknown"})
+			response := sc.service.starHandler(sc.reqContext)
+			require.Equal(t, 404, response.Status())
+		})
+}
+
+func getStarredLibraryPanels(t *testing.T, sc scenarioContext) []libraryPanel {
+	t.Helper()
+
+	sc.ctx.Req.Request = &http.Request{URL: &url.URL{RawQuery: "starred=true"}}
+	response := sc.service.getAllHandler(sc.reqContext)
+	require.Equal(t, 200, response.Status())
+
+	var result libraryPanelsResult
+	err := json.Unmarshal(response.Body(), &result)
+	require.NoError(t, err)
+
+	return result.Result
+}
@@ -0,0 +1,49 @@
+package librarypanels
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/components/simplejson"
+	"github.com/grafana/grafana/pkg/models"
+)
+
+func TestLibraryPanelStats(t *testing.T) {
+	testScenario(t, "When an admin gets the stats, the library panels should be counted by type, folder and connection",
+		func(t *testing.T, sc scenarioContext) {
+			folder := models.SaveDashboardCommand{OrgId: 1, IsFolder: true, Dashboard: simplejson.NewFromAny(map[string]interface{}{"title": "Shared"})}
+			err := bus.Dispatch(&folder)
+			require.NoError(t, err)
+
+			connected := createLibraryPanel(t, sc, getCreateCommand(0, "Text one"))
+			createLibraryPanel(t, sc, getCreateCommand(0, "Text two"))
+			graph := getCreateCommand(folder.Result.Id, "Graph")
+			graph.Model = []byte(`{ "type": "graph" }`)
+			createLibraryPanel(t, sc, graph)
+			dash := saveTestDashboard(t, `{ "title": "Dashboard", "panels": [] }`)
+			err = sc.service.connectDashboard(sc.reqContext, connected.UID, dash.Id, 0)
+			require.NoError(t, err)
+
+			response := sc.service.getStatsHandler(sc.reqContext)
+			require.Equal(t, 200, response.Status())
+			var result struct {
+				Result libraryPanelStats `json:"result"`
+			}
+			err = json.Unmarshal(response.Body(), &result)
+			require.NoError(t, err)
+
+			stats := result.Result
+			require.Equal(t, int64(3), stats.Total)
+			require.Equal(t, int64(1), stats.Connected)
+			require.Equal(t, int64(2), stats.Unconnected)
+			require.Equal(t, int64(3), stats.CreatedLast30Days)
+			require.Equal(t, []libraryPanelTypeCount{{Type: "text", Count: 2}, {Type: "graph", Count: 1}}, stats.ByType)
+			require.Equal(t, []libraryPanelFolderCount{
+				{FolderID: 0, Count: 2},
+				{FolderID: folder.Result.Id, FolderTitle: "Shared", Count: 1},
+			}, stats.ByFolder)
+		})
+}
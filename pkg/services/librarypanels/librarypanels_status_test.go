@@ -0,0 +1,73 @@
+package librarypanels
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/grafana/pkg/models"
+)
+
+func TestLibraryPanelStatus(t *testing.T) {
+	testScenario(t, "When a user creates a draft, it should only be visible to its author and users who can edit it",
+		func(t *testing.T, sc scenarioContext) {
+			command := getCreateCommand(0, "Draft")
+			command.Status = statusDraft
+			draft := createLibraryPanel(t, sc, command)
+			createLibraryPanel(t, sc, getCreateCommand(0, "Published"))
+
+			require.Len(t, getVisibleLibraryPanels(t, sc, ""), 2)
+			require.Len(t, getVisibleLibraryPanels(t, sc, "published"), 1)
+
+			viewer := models.SignedInUser{UserId: 2, OrgId: 1, OrgRole: models.ROLE_VIEWER}
+			sc.reqContext.SignedInUser = &viewer
+			libraryPanels := getVisibleLibraryPanels(t, sc, "")
+			require.Len(t, libraryPanels, 1)
+			require.Equal(t, "Published", libraryPanels[0].Name)
+			sc.reqContext.ReplaceAllParams(map[string]string{":uid": draft.UID})
+			response := sc.service.getHandler(sc.reqContext)
+			require.Equal(t, 404, response.Status())
+			response = sc.service.publishHandler(sc.reqContext)
+			require.Equal(t, 404, response.Status())
+
+			editor := models.SignedInUser{UserId: 3, OrgId: 1, OrgRole: models.ROLE_EDITOR}
+			sc.reqContext.SignedInUser = &editor
+			require.Len(t, getVisibleLibraryPanels(t, sc, ""), 2)
+			response = sc.service.publishHandler(sc.reqContext)
+			require.Equal(t, 200, response.Status())
+			var result libraryPanelResult
+			err := json.Unmarshal(response.Body(), &result)
+			require.NoError(t, err)
+			require.Equal(t, int64(3), result.Result.UpdatedBy)
+
+			sc.reqContext.SignedInUser = &viewer
+			require.Len(t, getVisibleLibraryPanels(t, sc, "published"), 2)
+			response = sc.service.getHandler(sc.reqContext)
+			require.Equal(t, 200, response.Status())
+		})
+
+	testScenario(t, "When a user creates a library panel with an unknown status, it should fail",
+		func(t *testing.T, sc scenarioContext) {
+			command := getCreateCommand(0, "Unknown")
+			command.Status = "archived"
+			response := sc.service.createHandler(sc.reqContext, command)
+			require.Equal(t, 400, response.Status())
+		})
+}
+
+func getVisibleLibraryPanels(t *testing.T, sc scenarioContext, status string) []libraryPanel {
+	t.Helper()
+
+	sc.ctx.Req.Request = &http.Request{URL: &url.URL{RawQuery: "status=" + status}}
+	response := sc.service.getAllHandler(sc.reqContext)
+	require.Equal(t, 200, response.Status())
+
+	var result libraryPanelsResult
+	err := json.Unmarshal(response.Body(), &result)
+	require.NoError(t, err)
+
+	return result.Result
+}
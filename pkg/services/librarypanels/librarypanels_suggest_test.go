@@ -0,0 +1,47 @@
+package librarypanels
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSuggestLibraryPanels(t *testing.T) {
+	testScenario(t, "When an admin gets suggestions, the library panels should be matched fuzzily and ranked by prefix",
+		func(t *testing.T, sc scenarioContext) {
+			for _, name := range []string{"Disk", "Compute pump use", "Cluster CPU", "CPU usage", "cpu_wait"} {
+				createLibraryPanel(t, sc, getCreateCommand(1, name))
+			}
+
+			names := func(rawQuery string) []string {
+				t.Helper()
+				sc.ctx.Req.Request = &http.Request{URL: &url.URL{RawQuery: rawQuery}}
+				response := sc.service.suggestHandler(sc.reqContext)
+				require.Equal(t, 200, response.Status())
+				var result struct {
+					Result []libraryPanelSuggestion `json:"result"`
+				}
+				err := json.Unmarshal(response.Body(), &result)
+				require.NoError(t, err)
+
+				names := make([]string, 0, len(result.Result))
+				for _, suggestion := range result.Result {
+					require.NotEmpty(t, suggestion.UID)
+					require.Equal(t, int64(1), suggestion.FolderID)
+					names = append(names, suggestion.Name)
+				}
+				return names
+			}
+
+			require.Equal(t, []string{"CPU usage", "cpu_wait", "Cluster CPU", "Compute pump use"}, names("q=cpu"))
+			require.Equal(t, []string{"CPU usage"}, names("q=cpu&limit=1"))
+			require.Len(t, names(""), 5)
+			// LIKE wildcards match literally
+			require.Equal(t, []string{"cpu_wait"}, names("q=_"))
+			require.Empty(t, names("q=%25"))
+			require.Empty(t, names("q=memory"))
+		})
+}
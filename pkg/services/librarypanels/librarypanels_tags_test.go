@@ -0,0 +1,101 @@
+package librarypanels
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/grafana/pkg/api/response"
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/components/simplejson"
+	"github.com/grafana/grafana/pkg/models"
+)
+
+func TestBulkLibraryPanelTags(t *testing.T) {
+	testScenario(t, "When an admin adds a tag by UIDs, only the library panels without it should be changed",
+		func(t *testing.T, sc scenarioContext) {
+			command := getCreateCommand(0, "Tagged")
+			command.Tags = []string{"team-a"}
+			tagged := createLibraryPanel(t, sc, command)
+			untagged := createLibraryPanel(t, sc, getCreateCommand(0, "Untagged"))
+			other := createLibraryPanel(t, sc, getCreateCommand(0, "Other"))
+
+			response := sc.service.addTagHandler(sc.reqContext, bulkTagCommand{Tag: "team-a", UIDs: []string{tagged.UID, untagged.UID}})
+			require.Equal(t, 1, getBulkTagResult(t, response).LibraryPanels)
+
+			for uid, tags := range map[string][]string{tagged.UID: {"team-a"}, untagged.UID: {"team-a"}, other.UID: {}} {
+				panel, err := sc.service.getLibraryPanel(sc.reqContext, uid)
+				require.NoError(t, err)
+				require.Equal(t, tags, panel.Tags)
+			}
+		})
+
+	testScenario(t, "When an admin renames a tag with a tag filter, the library panels should get the new tag and lose the old one",
+		func(t *testing.T, sc scenarioContext) {
+			var uids []string
+			for _, name := range []string{"First", "Second"} {
+				command := getCreateCommand(0, name)
+				command.Tags = []string{"team-a", "kpi"}
+				uids = append(uids, createLibraryPanel(t, sc, command).UID)
+			}
+			command := getCreateCommand(0, "Other team")
+			command.Tags = []string{"team-b"}
+			other := createLibraryPanel(t, sc, command)
+
+			filter := bulkTagFilter{Tag: "team-a"}
+			response := sc.service.addTagHandler(sc.reqContext, bulkTagCommand{Tag: "team-c", Filter: filter})
+			require.Equal(t, 2, getBulkTagResult(t, response).LibraryPanels)
+			response = sc.service.removeTagHandler(sc.reqContext, bulkTagCommand{Tag: "team-a", Filter: filter})
+			require.Equal(t, 2, getBulkTagResult(t, response).LibraryPanels)
+
+			for _, uid := range uids {
+				panel, err := sc.service.getLibraryPanel(sc.reqContext, uid)
+				require.NoError(t, err)
+				require.Equal(t, []string{"kpi", "team-c"}, panel.Tags)
+			}
+			panel, err := sc.service.getLibraryPanel(sc.reqContext, other.UID)
+			require.NoError(t, err)
+			require.Equal(t, []string{"team-b"}, panel.Tags)
+		})
+
+	testScenario(t, "When a bulk tag change has no tag or no selection, it should fail",
+		func(t *testing.T, sc scenarioContext) {
+			response := sc.service.addTagHandler(sc.reqContext, bulkTagCommand{UIDs: []string{"uid"}})
+			requireErrorCode(t, response, 400, errorCodeInvalid)
+			response = sc.service.removeTagHandler(sc.reqContext, bulkTagCommand{Tag: "team-a"})
+			requireErrorCode(t, response, 400, errorCodeInvalid)
+		})
+
+	testScenario(t, "When an editor adds a tag, library panels in folders they can't edit should be skipped",
+		func(t *testing.T, sc scenarioContext) {
+			folder := models.SaveDashboardCommand{OrgId: 1, IsFolder: true, Dashboard: simplejson.NewFromAny(map[string]interface{}{"title": "Restricted"})}
+			err := bus.Dispatch(&folder)
+			require.NoError(t, err)
+			restrictDashboard(t, folder.Result.Id)
+			restricted := createLibraryPanel(t, sc, getCreateCommand(folder.Result.Id, "Restricted"))
+			editable := createLibraryPanel(t, sc, getCreateCommand(0, "Editable"))
+
+			sc.reqContext.SignedInUser = &models.SignedInUser{UserId: 2, OrgId: 1, OrgRole: models.ROLE_EDITOR}
+			response := sc.service.addTagHandler(sc.reqContext, bulkTagCommand{Tag: "team-a", UIDs: []string{restricted.UID, editable.UID}})
+			require.Equal(t, 1, getBulkTagResult(t, response).LibraryPanels)
+
+			sc.reqContext.SignedInUser = &sc.user
+			panel, err := sc.service.getLibraryPanel(sc.reqContext, restricted.UID)
+			require.NoError(t, err)
+			require.Empty(t, panel.Tags)
+		})
+}
+
+func getBulkTagResult(t *testing.T, resp response.Response) struct{ LibraryPanels int } {
+	t.Helper()
+
+	require.Equal(t, 200, resp.Status())
+	var result struct {
+		Result struct{ LibraryPanels int } `json:"result"`
+	}
+	err := json.Unmarshal(resp.Body(), &result)
+	require.NoError(t, err)
+
+	return result.Result
+}
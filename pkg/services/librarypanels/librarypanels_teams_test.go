@@ -0,0 +1,98 @@
+package librarypanels
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/sqlstore"
+)
+
+func TestLibraryPanelOwnerTeams(t *testing.T) {
+	testScenario(t, "When a team owns a library panel, only its members and org admins should be able to edit it",
+		func(t *testing.T, sc scenarioContext) {
+			team := createTestTeam(t, sc, "Platform", 2)
+			command := getCreateCommand(0, "Owned")
+			command.OwnerTeamID = team.Id
+			owned := createLibraryPanel(t, sc, command)
+
+			sc.reqContext.ReplaceAllParams(map[string]string{":uid": owned.UID})
+			sc.reqContext.SignedInUser = &models.SignedInUser{UserId: 3, OrgId: 1, OrgRole: models.ROLE_EDITOR}
+			response := sc.service.patchHandler(sc.reqContext, patchLibraryPanelCommand{Name: "By other editor"})
+			requireErrorCode(t, response, 403, errorCodePermissionDenied)
+
+			sc.reqContext.SignedInUser = &models.SignedInUser{UserId: 2, OrgId: 1, OrgRole: models.ROLE_EDITOR}
+			response = sc.service.patchHandler(sc.reqContext, patchLibraryPanelCommand{Name: "By member"})
+			require.Equal(t, 200, response.Status())
+
+			sc.reqContext.SignedInUser = &sc.user
+			noTeam := int64(0)
+			response = sc.service.patchHandler(sc.reqContext, patchLibraryPanelCommand{OwnerTeamID: &noTeam})
+			require.Equal(t, 200, response.Status())
+
+			sc.reqContext.SignedInUser = &models.SignedInUser{UserId: 3, OrgId: 1, OrgRole: models.ROLE_EDITOR}
+			response = sc.service.patchHandler(sc.reqContext, patchLibraryPanelCommand{Name: "By other editor"})
+			require.Equal(t, 200, response.Status())
+		})
+
+	testScenario(t, "When library panels are filtered by owning team, only the panels of the team should be returned",
+		func(t *testing.T, sc scenarioContext) {
+			team := createTestTeam(t, sc, "Platform")
+			command := getCreateCommand(1, "Owned")
+			command.OwnerTeamID = team.Id
+			owned := createLibraryPanel(t, sc, command)
+			unowned := createLibraryPanel(t, sc, getCreateCommand(1, "Unowned"))
+
+			libraryPanels, err := sc.service.getAllLibraryPanels(sc.reqContext, getAllLibraryPanelsQuery{OwnedBy: "team:" + strconv.FormatInt(team.Id, 10)})
+			require.NoError(t, err)
+			require.Len(t, libraryPanels, 1)
+			require.Equal(t, owned.UID, libraryPanels[0].UID)
+			require.Equal(t, team.Id, libraryPanels[0].OwnerTeamID)
+
+			_, err = sc.service.getAllLibraryPanels(sc.reqContext, getAllLibraryPanelsQuery{OwnedBy: "user:1"})
+			require.Equal(t, errLibraryPanelInvalidOwnedBy, err)
+
+			response := sc.service.getUnownedHandler(sc.reqContext)
+			require.Equal(t, 200, response.Status())
+			var result libraryPanelsResult
+			err = json.Unmarshal(response.Body(), &result)
+			require.NoError(t, err)
+			require.Len(t, result.Result, 1)
+			require.Equal(t, unowned.UID, result.Result[0].UID)
+		})
+
+	testScenario(t, "When a library panel is owned by a team of another org, it should fail",
+		func(t *testing.T, sc scenarioContext) {
+			command := getCreateCommand(1, "Owned")
+			command.OwnerTeamID = 42
+			response := sc.service.createHandler(sc.reqContext, command)
+			requireErrorCode(t, response, 400, errorCodeInvalid)
+		})
+}
+
+// createTestTeam creates a team in org 1 with the users as members.
+func createTestTeam(t *testing.T, sc scenarioContext, name string, userIDs ...int64) models.Team {
+	t.Helper()
+
+	team := models.Team{OrgId: 1, Name: name, Created: time.Now(), Updated: time.Now()}
+	err := sc.service.SQLStore.WithDbSession(context.Background(), func(session *sqlstore.DBSession) error {
+		if _, err := session.Insert(&team); err != nil {
+			return err
+		}
+		for _, userID := range userIDs {
+			member := models.TeamMember{OrgId: 1, TeamId: team.Id, UserId: userID, Created: time.Now(), Updated: time.Now()}
+			if _, err := session.Insert(&member); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	require.NoError(t, err)
+
+	return team
+}
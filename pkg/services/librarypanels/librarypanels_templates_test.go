@@ -0,0 +1,72 @@
+package librarypanels
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPanelTemplates(t *testing.T) {
+	testScenario(t, "When a library panel is exported as a template and instantiated, the inputs should be replaced",
+		func(t *testing.T, sc scenarioContext) {
+			existing := createLibraryPanel(t, sc, getCreateCommandWithModel(1, "Uptime", `{
+				"type": "graph",
+				"datasource": "Prometheus",
+				"targets": [{ "refId": "A", "expr": "up" }],
+				"fieldConfig": { "defaults": { "thresholds": { "steps": [{ "color": "green", "value": null }, { "color": "red", "value": 80 }] } } }
+			}`))
+
+			sc.reqContext.ReplaceAllParams(map[string]string{":uid": existing.UID})
+			response := sc.service.getTemplateHandler(sc.reqContext)
+			require.Equal(t, 200, response.Status())
+			var result struct {
+				Result panelTemplate `json:"result"`
+			}
+			err := json.Unmarshal(response.Body(), &result)
+			require.NoError(t, err)
+			template := result.Result
+			require.Equal(t, []templateInput{
+				{Name: "DS_PROMETHEUS", Label: "Prometheus", Type: templateInputDatasource, Value: "Prometheus"},
+				{Name: "METRIC_1", Label: "up", Type: templateInputMetric, Value: "up"},
+				{Name: "THRESHOLD_1", Label: "Threshold 80", Type: templateInputThreshold, Value: float64(80)},
+			}, template.Inputs)
+			require.JSONEq(t, `{
+				"type": "graph",
+				"datasource": "${DS_PROMETHEUS}",
+				"targets": [{ "refId": "A", "expr": "${METRIC_1}" }],
+				"fieldConfig": { "defaults": { "thresholds": { "steps": [{ "color": "green", "value": null }, { "color": "red", "value": "${THRESHOLD_1}" }] } } }
+			}`, string(template.Model))
+
+			response = sc.service.instantiateTemplateHandler(sc.reqContext, instantiateTemplateCommand{
+				Template: template,
+				Inputs:   map[string]interface{}{"DS_PROMETHEUS": "Thanos", "THRESHOLD_1": 90},
+				Name:     "Uptime - Thanos",
+			})
+			require.Equal(t, 200, response.Status())
+			var created libraryPanelResult
+			err = json.Unmarshal(response.Body(), &created)
+			require.NoError(t, err)
+			require.Equal(t, "Uptime - Thanos", created.Result.Name)
+			model, err := json.Marshal(created.Result.Model)
+			require.NoError(t, err)
+			require.JSONEq(t, `{
+				"type": "graph",
+				"datasource": "Thanos",
+				"targets": [{ "refId": "A", "expr": "up" }],
+				"fieldConfig": { "defaults": { "thresholds": { "steps": [{ "color": "green", "value": null }, { "color": "red", "value": 90 }] } } }
+			}`, string(model))
+		})
+
+	testScenario(t, "When a template is instantiated without a value for an input, it should fail",
+		func(t *testing.T, sc scenarioContext) {
+			response := sc.service.instantiateTemplateHandler(sc.reqContext, instantiateTemplateCommand{
+				Template: panelTemplate{
+					Inputs: []templateInput{{Name: "DS_PROMETHEUS", Type: templateInputDatasource}},
+					Name:   "Uptime",
+					Model:  []byte(`{ "type": "graph", "datasource": "${DS_PROMETHEUS}" }`),
+				},
+			})
+			require.Equal(t, 400, response.Status())
+		})
+}
@@ -1,7 +1,13 @@
 package librarypanels
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
 	"testing"
 	"time"
 
@@ -9,8 +15,13 @@ import (
 	"github.com/stretchr/testify/require"
 	"gopkg.in/macaron.v1"
 
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/components/simplejson"
+	"github.com/grafana/grafana/pkg/infra/log"
 	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/plugins"
 	"github.com/grafana/grafana/pkg/registry"
+	"github.com/grafana/grafana/pkg/services/quota"
 	"github.com/grafana/grafana/pkg/services/sqlstore"
 	"github.com/grafana/grafana/pkg/setting"
 )
@@ -25,6 +36,123 @@ func TestCreateLibraryPanel(t *testing.T) {
 			response = sc.service.createHandler(sc.reqContext, command)
 			require.Equal(t, 400, response.Status())
 		})
+
+	testScenario(t, "When an admin creates a library panel without a folder, it should be added to the default folder of the org",
+		func(t *testing.T, sc scenarioContext) {
+			err := bus.Dispatch(&models.SavePreferencesCommand{OrgId: sc.user.OrgId, LibraryPanelFolderId: 1})
+			require.NoError(t, err)
+
+			command := getCreateCommand(0, "Default folder")
+			command.FolderID = nil
+			result := createLibraryPanel(t, sc, command)
+			require.Equal(t, int64(1), result.FolderID)
+
+			result = createLibraryPanel(t, sc, getCreateCommand(0, "General folder"))
+			require.Equal(t, int64(0), result.FolderID)
+		})
+
+	testScenario(t, "When the generated uid of a new library panel is already used, another uid should be generated",
+		func(t *testing.T, sc scenarioContext) {
+			existing := createLibraryPanel(t, sc, getCreateCommand(1, "Existing"))
+			uids := []string{existing.UID, existing.UID, "fresh-uid"}
+			sc.service.uidGenerator = func() string {
+				uid := uids[0]
+				uids = uids[1:]
+				return uid
+			}
+
+			result := createLibraryPanel(t, sc, getCreateCommand(1, "New"))
+			require.Equal(t, "fresh-uid", result.UID)
+
+			sc.service.uidGenerator = func() string { return existing.UID }
+			response := sc.service.createHandler(sc.reqContext, getCreateCommand(1, "Another"))
+			require.Equal(t, 500, response.Status())
+		})
+	testScenario(t, "When a concurrent create stores the generated uid first, the library panel should be created with another uid",
+		func(t *testing.T, sc scenarioContext) {
+			uids := []string{"raced-uid", "fresh-uid"}
+			sc.service.uidGenerator = func() string {
+				uid := uids[0]
+				uids = uids[1:]
+				if uid == "raced-uid" {
+					// the other create commits after the uid was checked and before it's inserted
+					err := sc.service.SQLStore.WithDbSession(context.Background(), func(session *sqlstore.DBSession) error {
+						_, err := session.Insert(&LibraryPanel{OrgID: 1, FolderID: 1, UID: uid, Name: "Concurrent", Kind: panelElement,
+							Model: []byte(`{ "type": "text" }`), Created: time.Now(), Updated: time.Now()})
+						return err
+					})
+					require.NoError(t, err)
+				}
+				return uid
+			}
+
+			result := createLibraryPanel(t, sc, getCreateCommand(1, "New"))
+			require.Equal(t, "fresh-uid", result.UID)
+
+			// a taken name is reported as such rather than retried
+			sc.service.uidGenerator = nil
+			response := sc.service.createHandler(sc.reqContext, getCreateCommand(1, "Concurrent"))
+			requireErrorCode(t, response, 400, errorCodeAlreadyExists)
+		})
+}
+
+func TestCreateLibraryPanelQuota(t *testing.T) {
+	testScenario(t, "When an admin tries to create a library panel and the org quota is reached, it should fail",
+		func(t *testing.T, sc scenarioContext) {
+			sc.service.Cfg.Quota = setting.QuotaSettings{
+				Enabled: true,
+				Org:     &setting.OrgQuota{LibraryPanel: 1},
+				User:    &setting.UserQuota{LibraryPanel: -1},
+				Global:  &setting.GlobalQuota{LibraryPanel: -1},
+			}
+			sc.reqContext.IsSignedIn = true
+			sc.reqContext.Logger = log.New("librarypanels.test")
+
+			command := getCreateCommand(1, "Text - Library Panel")
+			response := sc.service.createHandler(sc.reqContext, command)
+			require.Equal(t, 200, response.Status())
+
+			command = getCreateCommand(1, "Text - Library Panel2")
+			response = sc.service.createHandler(sc.reqContext, command)
+			require.Equal(t, 403, response.Status())
+		})
+
+	testScenario(t, "When an admin tries to create a library panel and the user quota is reached, it should fail",
+		func(t *testing.T, sc scenarioContext) {
+			sc.service.Cfg.Quota = setting.QuotaSettings{
+				Enabled: true,
+				Org:     &setting.OrgQuota{LibraryPanel: -1},
+				User:    &setting.UserQuota{LibraryPanel: 1},
+				Global:  &setting.GlobalQuota{LibraryPanel: -1},
+			}
+			sc.reqContext.IsSignedIn = true
+			sc.reqContext.Logger = log.New("librarypanels.test")
+
+			command := getCreateCommand(1, "Text - Library Panel")
+			response := sc.service.createHandler(sc.reqContext, command)
+			require.Equal(t, 200, response.Status())
+
+			command = getCreateCommand(1, "Text - Library Panel2")
+			response = sc.service.createHandler(sc.reqContext, command)
+			require.Equal(t, 403, response.Status())
+
+			sc.reqContext.SignedInUser.UserId = 2
+			response = sc.service.createHandler(sc.reqContext, command)
+			require.Equal(t, 200, response.Status())
+		})
+
+	testScenario(t, "When an admin tries to create a library panel and the maximum of the org is reached, it should fail",
+		func(t *testing.T, sc scenarioContext) {
+			sc.service.Cfg.LibraryPanels.MaxPanelsPerOrg = 1
+
+			command := getCreateCommand(1, "Text - Library Panel")
+			response := sc.service.createHandler(sc.reqContext, command)
+			require.Equal(t, 200, response.Status())
+
+			command = getCreateCommand(1, "Text - Library Panel2")
+			response = sc.service.createHandler(sc.reqContext, command)
+			require.Equal(t, 403, response.Status())
+		})
 }
 
 func TestConnectLibraryPanel(t *testing.T) {
@@ -45,13 +173,27 @@ func TestConnectLibraryPanel(t *testing.T) {
 			err := json.Unmarshal(response.Body(), &result)
 			require.NoError(t, err)
 
-			sc.reqContext.ReplaceAllParams(map[string]string{":uid": result.Result.UID, "dashboardId": "1"})
+			dash := saveTestDashboard(t, `{ "title": "Dashboard", "panels": [] }`)
+			sc.reqContext.ReplaceAllParams(map[string]string{":uid": result.Result.UID, ":dashboardId": strconv.FormatInt(dash.Id, 10)})
 			response = sc.service.connectHandler(sc.reqContext)
 			require.Equal(t, 200, response.Status())
 
 			response = sc.service.connectHandler(sc.reqContext)
 			require.Equal(t, 200, response.Status())
 		})
+
+	testScenario(t, "When an admin tries to create a connection to a dashboard that does not exist, it should fail",
+		func(t *testing.T, sc scenarioContext) {
+			existing := createLibraryPanel(t, sc, getCreateCommand(1, "Text - Library Panel"))
+
+			sc.reqContext.ReplaceAllParams(map[string]string{":uid": existing.UID, ":dashboardId": "999"})
+			response := sc.service.connectHandler(sc.reqContext)
+			requireErrorCode(t, response, 404, errorCodeNotFound)
+			require.Contains(t, string(response.Body()), "dashboard could not be found")
+			connected, err := sc.service.getConnectedDashboards(sc.reqContext, existing.UID)
+			require.NoError(t, err)
+			require.Empty(t, connected)
+		})
 }
 
 func TestDeleteLibraryPanel(t *testing.T) {
@@ -127,7 +269,8 @@ func TestDisconnectLibraryPanel(t *testing.T) {
 			err := json.Unmarshal(response.Body(), &result)
 			require.NoError(t, err)
 
-			sc.reqContext.ReplaceAllParams(map[string]string{":uid": result.Result.UID, "dashboardId": "1"})
+			dash := saveTestDashboard(t, `{ "title": "Dashboard", "panels": [] }`)
+			sc.reqContext.ReplaceAllParams(map[string]string{":uid": result.Result.UID, ":dashboardId": strconv.FormatInt(dash.Id, 10)})
 			response = sc.service.connectHandler(sc.reqContext)
 			require.Equal(t, 200, response.Status())
 			response = sc.service.disconnectHandler(sc.reqContext)
@@ -216,6 +359,51 @@ func TestGetAllLibraryPanels(t *testing.T) {
 			require.Equal(t, "Text - Library Panel2", result.Result[1].Name)
 		})
 
+	testScenario(t, "When an admin gets all library panels, they should include the number of connected dashboards",
+		func(t *testing.T, sc scenarioContext) {
+			connected := createLibraryPanel(t, sc, getCreateCommand(1, "Connected"))
+			createLibraryPanel(t, sc, getCreateCommand(1, "Unconnected"))
+			dashboardIDs := saveTestDashboards(t, 2)
+			for _, connection := range []struct{ dashboardID, panelID int64 }{{dashboardIDs[0], 1}, {dashboardIDs[0], 2}, {dashboardIDs[1], 1}} {
+				err := sc.service.connectDashboard(sc.reqContext, connected.UID, connection.dashboardID, connection.panelID)
+				require.NoError(t, err)
+			}
+
+			response := sc.service.getAllHandler(sc.reqContext)
+			require.Equal(t, 200, response.Status())
+
+			var result libraryPanelsResult
+			err := json.Unmarshal(response.Body(), &result)
+			require.NoError(t, err)
+			require.Len(t, result.Result, 2)
+			require.Equal(t, int64(2), result.Result[0].ConnectedDashboards)
+			require.Equal(t, int64(0), result.Result[1].ConnectedDashboards)
+		})
+
+	testScenario(t, "When an admin gets all library panels, the models should only be included if asked for",
+		func(t *testing.T, sc scenarioContext) {
+			existing := createLibraryPanel(t, sc, getCreateCommand(1, "Text - Library Panel"))
+
+			getAll := func(rawQuery string) libraryPanel {
+				sc.ctx.Req.Request = &http.Request{URL: &url.URL{RawQuery: rawQuery}}
+				response := sc.service.getAllHandler(sc.reqContext)
+				require.Equal(t, 200, response.Status())
+
+				var result libraryPanelsResult
+				err := json.Unmarshal(response.Body(), &result)
+				require.NoError(t, err)
+				require.Len(t, result.Result, 1)
+				return result.Result[0]
+			}
+
+			listed := getAll("")
+			require.Nil(t, listed.Model)
+			require.Equal(t, existing.UID, listed.UID)
+			require.Equal(t, existing.Name, listed.Name)
+			require.Equal(t, existing.CreatedBy, listed.CreatedBy)
+			require.Equal(t, "text", getAll("includeModel=true").Model["type"])
+		})
+
 	testScenario(t, "When an admin tries to get all library panels in a different org, none should be returned",
 		func(t *testing.T, sc scenarioContext) {
 			command := getCreateCommand(1, "Text - Library Panel")
@@ -244,6 +432,109 @@ func TestGetAllLibraryPanels(t *testing.T) {
 			require.NotNil(t, result.Result)
 			require.Equal(t, 0, len(result.Result))
 		})
+	testScenario(t, "When an admin tries to get all library panels filtered by datasource, only matching panels should be returned",
+		func(t *testing.T, sc scenarioContext) {
+			command := getCreateCommand(1, "Text - Library Panel")
+			response := sc.service.createHandler(sc.reqContext, command)
+			require.Equal(t, 200, response.Status())
+
+			command = getCreateCommand(1, "Graph - Library Panel")
+			command.Model = []byte(`{ "datasource": "gdev-prometheus", "id": 1, "type": "graph" }`)
+			response = sc.service.createHandler(sc.reqContext, command)
+			require.Equal(t, 200, response.Status())
+
+			sc.ctx.Req.Request = &http.Request{URL: &url.URL{RawQuery: "datasource=gdev-prometheus"}}
+			response = sc.service.getAllHandler(sc.reqContext)
+			require.Equal(t, 200, response.Status())
+
+			var result libraryPanelsResult
+			err := json.Unmarshal(response.Body(), &result)
+			require.NoError(t, err)
+			require.Equal(t, 1, len(result.Result))
+			require.Equal(t, "Graph - Library Panel", result.Result[0].Name)
+		})
+
+	testScenario(t, "When a viewer tries to get all library panels, it should only return the ones in folders they can view",
+		func(t *testing.T, sc scenarioContext) {
+			open := models.SaveDashboardCommand{OrgId: 1, IsFolder: true, Dashboard: simplejson.NewFromAny(map[string]interface{}{"title": "Open"})}
+			err := bus.Dispatch(&open)
+			require.NoError(t, err)
+			restricted := models.SaveDashboardCommand{OrgId: 1, IsFolder: true, Dashboard: simplejson.NewFromAny(map[string]interface{}{"title": "Restricted"})}
+			err = bus.Dispatch(&restricted)
+			require.NoError(t, err)
+			err = bus.Dispatch(&models.UpdateDashboardAclCommand{
+				DashboardID: restricted.Result.Id,
+				Items: []*models.DashboardAcl{{
+					OrgID: 1, DashboardID: restricted.Result.Id, UserID: 2, Permission: models.PERMISSION_VIEW,
+					Created: time.Now(), Updated: time.Now(),
+				}},
+			})
+			require.NoError(t, err)
+
+			for _, command := range []createLibraryPanelCommand{
+				getCreateCommand(0, "General"),
+				getCreateCommand(open.Result.Id, "Open"),
+				getCreateCommand(restricted.Result.Id, "Restricted"),
+			} {
+				response := sc.service.createHandler(sc.reqContext, command)
+				require.Equal(t, 200, response.Status())
+			}
+
+			getNames := func(user *models.SignedInUser) []string {
+				sc.reqContext.SignedInUser = user
+				response := sc.service.getAllHandler(sc.reqContext)
+				require.Equal(t, 200, response.Status())
+
+				var result libraryPanelsResult
+				err := json.Unmarshal(response.Body(), &result)
+				require.NoError(t, err)
+				names := make([]string, 0, len(result.Result))
+				for _, panel := range result.Result {
+					names = append(names, panel.Name)
+				}
+				sort.Strings(names)
+				return names
+			}
+
+			require.Equal(t, []string{"General", "Open", "Restricted"}, getNames(&models.SignedInUser{UserId: 2, OrgId: 1, OrgRole: models.ROLE_VIEWER}))
+			require.Equal(t, []string{"General", "Open"}, getNames(&models.SignedInUser{UserId: 3, OrgId: 1, OrgRole: models.ROLE_VIEWER}))
+			require.Equal(t, []string{"General", "Open", "Restricted"}, getNames(&sc.user))
+		})
+
+	testScenario(t, "When an admin gets all library panels of a folder, it should only include those in subfolders if asked for",
+		func(t *testing.T, sc scenarioContext) {
+			parent := models.SaveDashboardCommand{OrgId: 1, IsFolder: true, Dashboard: simplejson.NewFromAny(map[string]interface{}{"title": "Team"})}
+			err := bus.Dispatch(&parent)
+			require.NoError(t, err)
+			child := models.SaveDashboardCommand{OrgId: 1, IsFolder: true, FolderId: parent.Result.Id, Dashboard: simplejson.NewFromAny(map[string]interface{}{"title": "Team services"})}
+			err = bus.Dispatch(&child)
+			require.NoError(t, err)
+
+			createLibraryPanel(t, sc, getCreateCommand(0, "General"))
+			createLibraryPanel(t, sc, getCreateCommand(parent.Result.Id, "Team"))
+			createLibraryPanel(t, sc, getCreateCommand(child.Result.Id, "Team services"))
+
+			getNames := func(rawQuery string) []string {
+				sc.ctx.Req.Request = &http.Request{URL: &url.URL{RawQuery: rawQuery}}
+				response := sc.service.getAllHandler(sc.reqContext)
+				require.Equal(t, 200, response.Status())
+
+				var result libraryPanelsResult
+				err := json.Unmarshal(response.Body(), &result)
+				require.NoError(t, err)
+				names := make([]string, 0, len(result.Result))
+				for _, panel := range result.Result {
+					names = append(names, panel.Name)
+				}
+				sort.Strings(names)
+				return names
+			}
+
+			require.Equal(t, []string{"Team"}, getNames(fmt.Sprintf("folderId=%d", parent.Result.Id)))
+			require.Equal(t, []string{"Team", "Team services"}, getNames(fmt.Sprintf("folderId=%d&includeSubfolders=true", parent.Result.Id)))
+			require.Equal(t, []string{"General"}, getNames("folderId=0"))
+			require.Equal(t, []string{"General", "Team", "Team services"}, getNames("folderId=0&includeSubfolders=true"))
+		})
 }
 
 func TestGetConnectedDashboards(t *testing.T) {
@@ -284,10 +575,11 @@ func TestGetConnectedDashboards(t *testing.T) {
 			err := json.Unmarshal(response.Body(), &result)
 			require.NoError(t, err)
 
-			sc.reqContext.ReplaceAllParams(map[string]string{":uid": result.Result.UID, ":dashboardId": "11"})
+			dashboardIDs := saveTestDashboards(t, 2)
+			sc.reqContext.ReplaceAllParams(map[string]string{":uid": result.Result.UID, ":dashboardId": strconv.FormatInt(dashboardIDs[0], 10)})
 			response = sc.service.connectHandler(sc.reqContext)
 			require.Equal(t, 200, response.Status())
-			sc.reqContext.ReplaceAllParams(map[string]string{":uid": result.Result.UID, ":dashboardId": "12"})
+			sc.reqContext.ReplaceAllParams(map[string]string{":uid": result.Result.UID, ":dashboardId": strconv.FormatInt(dashboardIDs[1], 10)})
 			response = sc.service.connectHandler(sc.reqContext)
 			require.Equal(t, 200, response.Status())
 
@@ -299,8 +591,7 @@ func TestGetConnectedDashboards(t *testing.T) {
 			err = json.Unmarshal(response.Body(), &dashResult)
 			require.NoError(t, err)
 			require.Equal(t, 2, len(dashResult.Result))
-			require.Equal(t, int64(11), dashResult.Result[0])
-			require.Equal(t, int64(12), dashResult.Result[1])
+			require.Equal(t, dashboardIDs, dashResult.Result)
 		})
 }
 
@@ -412,7 +703,7 @@ func TestPatchLibraryPanel(t *testing.T) {
 			require.NoError(t, err)
 
 			cmd := patchLibraryPanelCommand{
-				Model: []byte(`{ "name": "New Model Name" }`),
+				Model: []byte(`{ "name": "New Model Name", "type": "text" }`),
 			}
 			sc.reqContext.ReplaceAllParams(map[string]string{":uid": existing.Result.UID})
 			response = sc.service.patchHandler(sc.reqContext, cmd)
@@ -422,6 +713,7 @@ func TestPatchLibraryPanel(t *testing.T) {
 			require.NoError(t, err)
 			existing.Result.Model = map[string]interface{}{
 				"name": "New Model Name",
+				"type": "text",
 			}
 			if diff := cmp.Diff(existing.Result, result.Result, getCompareOptions()...); diff != "" {
 				t.Fatalf("Result mismatch (-want +got):\n%s", diff)
@@ -522,11 +814,21 @@ type libraryPanel struct {
 	FolderID  int64                  `json:"folderId"`
 	UID       string                 `json:"uid"`
 	Name      string                 `json:"name"`
+	Kind      int64                  `json:"kind"`
 	Model     map[string]interface{} `json:"model"`
+	Tags      []string               `json:"tags"`
 	Created   time.Time              `json:"created"`
 	Updated   time.Time              `json:"updated"`
 	CreatedBy int64                  `json:"createdBy"`
 	UpdatedBy int64                  `json:"updatedBy"`
+
+	LastConnectedAt *time.Time `json:"lastConnectedAt"`
+	LastViewedAt    *time.Time `json:"lastViewedAt"`
+
+	Deprecated bool   `json:"deprecated"`
+	ReplacedBy string `json:"replacedBy"`
+
+	ConnectedDashboards int64 `json:"connectedDashboards"`
 }
 
 type libraryPanelResult struct {
@@ -537,17 +839,32 @@ type libraryPanelsResult struct {
 	Result []libraryPanel `json:"result"`
 }
 
+type libraryPanelSearchResult struct {
+	Result struct {
+		TotalCount    int64          `json:"totalCount"`
+		LibraryPanels []libraryPanel `json:"libraryPanels"`
+		Page          int            `json:"page"`
+		PerPage       int            `json:"perPage"`
+		Facets        searchFacets   `json:"facets"`
+	} `json:"result"`
+}
+
 type libraryPanelDashboardsResult struct {
 	Result []int64 `json:"result"`
 }
 
 func overrideLibraryPanelServiceInRegistry(cfg *setting.Cfg) LibraryPanelService {
 	lps := LibraryPanelService{
-		SQLStore: nil,
-		Cfg:      cfg,
+		SQLStore:     nil,
+		Cfg:          cfg,
+		QuotaService: &quota.QuotaService{Cfg: cfg},
 	}
 
 	overrideServiceFunc := func(d registry.Descriptor) (*registry.Descriptor, bool) {
+		if d.Name != "LibraryPanelService" {
+			return nil, false
+		}
+
 		descriptor := registry.Descriptor{
 			Name:         "LibraryPanelService",
 			Instance:     &lps,
@@ -564,7 +881,7 @@ func overrideLibraryPanelServiceInRegistry(cfg *setting.Cfg) LibraryPanelService
 
 func getCreateCommand(folderID int64, name string) createLibraryPanelCommand {
 	command := createLibraryPanelCommand{
-		FolderID: folderID,
+		FolderID: &folderID,
 		Name:     name,
 		Model: []byte(`
 			{
@@ -594,7 +911,14 @@ func testScenario(t *testing.T, desc string, fn func(t *testing.T, sc scenarioCo
 	t.Run(desc, func(t *testing.T) {
 		t.Cleanup(registry.ClearOverrides)
 
-		ctx := macaron.Context{}
+		// Library panel models are validated against the installed panel plugins
+		panels := plugins.Panels
+		plugins.Panels = map[string]*plugins.PanelPlugin{"text": {}, "graph": {}}
+		t.Cleanup(func() { plugins.Panels = panels })
+
+		ctx := macaron.Context{
+			Req: macaron.Request{Request: &http.Request{URL: &url.URL{}}},
+		}
 		orgID := int64(1)
 		role := models.ROLE_ADMIN
 
@@ -608,6 +932,8 @@ func testScenario(t *testing.T, desc string, fn func(t *testing.T, sc scenarioCo
 		// We need to assign SQLStore after the override and migrations are done
 		sqlStore := sqlstore.InitTestDB(t)
 		service.SQLStore = sqlStore
+		service.viewBuffer = newLibraryPanelViewBuffer()
+		service.storedModels = &storedModelState{uncompressed: true}
 
 		user := models.SignedInUser{
 			UserId:     1,
@@ -0,0 +1,106 @@
+package librarypanels
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/grafana/pkg/infra/log"
+	"github.com/grafana/grafana/pkg/services/rendering"
+	"github.com/grafana/grafana/pkg/services/sqlstore"
+)
+
+// fakeRenderService renders every panel as the same image, or fails with err.
+type fakeRenderService struct {
+	rendering.Service
+	dir   string
+	image []byte
+	err   error
+	paths []string
+}
+
+func (s *fakeRenderService) IsAvailable() bool {
+	return true
+}
+
+func (s *fakeRenderService) Render(ctx context.Context, opts rendering.Opts) (*rendering.RenderResult, error) {
+	s.paths = append(s.paths, opts.Path)
+	if s.err != nil {
+		return nil, s.err
+	}
+
+	path := filepath.Join(s.dir, "thumbnail.png")
+	if err := ioutil.WriteFile(path, s.image, 0600); err != nil {
+		return nil, err
+	}
+	return &rendering.RenderResult{FilePath: path}, nil
+}
+
+func TestLibraryPanelThumbnails(t *testing.T) {
+	testScenario(t, "When a connected library panel has no thumbnail or is updated, its thumbnail should be rendered",
+		func(t *testing.T, sc scenarioContext) {
+			renderer := &fakeRenderService{dir: t.TempDir(), image: []byte("png")}
+			sc.service.RenderService = renderer
+			sc.service.log = log.New("librarypanels")
+			existing := createLibraryPanel(t, sc, getCreateCommand(1, "Text - Library Panel"))
+			createLibraryPanel(t, sc, getCreateCommand(1, "Unconnected"))
+			dash := saveTestDashboard(t, `{ "title": "Thumbnails" }`)
+			err := sc.service.connectDashboard(sc.reqContext, existing.UID, dash.Id, 2)
+			require.NoError(t, err)
+
+			sc.reqContext.ReplaceAllParams(map[string]string{":uid": existing.UID})
+			response := sc.service.getThumbnailHandler(sc.reqContext)
+			require.Equal(t, 404, response.Status())
+
+			rendered, err := sc.service.renderStaleThumbnails(context.Background())
+			require.NoError(t, err)
+			require.Equal(t, 1, rendered)
+			require.Equal(t, []string{"d-solo/" + dash.Uid + "/thumbnails?orgId=1&panelId=2"}, renderer.paths)
+
+			response = sc.service.getThumbnailHandler(sc.reqContext)
+			require.Equal(t, 200, response.Status())
+			require.Equal(t, []byte("png"), response.Body())
+
+			rendered, err = sc.service.renderStaleThumbnails(context.Background())
+			require.NoError(t, err)
+			require.Equal(t, 0, rendered)
+
+			err = sc.service.SQLStore.WithDbSession(context.Background(), func(session *sqlstore.DBSession) error {
+				_, err := session.Exec("UPDATE library_panel SET updated=? WHERE uid=?", time.Now().Add(time.Hour), existing.UID)
+				return err
+			})
+			require.NoError(t, err)
+			renderer.image = []byte("updated png")
+			rendered, err = sc.service.renderStaleThumbnails(context.Background())
+			require.NoError(t, err)
+			require.Equal(t, 1, rendered)
+			response = sc.service.getThumbnailHandler(sc.reqContext)
+			require.Equal(t, []byte("updated png"), response.Body())
+		})
+
+	testScenario(t, "When a thumbnail can't be rendered, it should not be found and not be rendered again until an update",
+		func(t *testing.T, sc scenarioContext) {
+			sc.service.RenderService = &fakeRenderService{err: errors.New("renderer is down")}
+			sc.service.log = log.New("librarypanels")
+			existing := createLibraryPanel(t, sc, getCreateCommand(1, "Text - Library Panel"))
+			dash := saveTestDashboard(t, `{ "title": "Thumbnails" }`)
+			err := sc.service.connectDashboard(sc.reqContext, existing.UID, dash.Id, 1)
+			require.NoError(t, err)
+
+			rendered, err := sc.service.renderStaleThumbnails(context.Background())
+			require.NoError(t, err)
+			require.Equal(t, 1, rendered)
+			rendered, err = sc.service.renderStaleThumbnails(context.Background())
+			require.NoError(t, err)
+			require.Equal(t, 0, rendered)
+
+			sc.reqContext.ReplaceAllParams(map[string]string{":uid": existing.UID})
+			response := sc.service.getThumbnailHandler(sc.reqContext)
+			require.Equal(t, 404, response.Status())
+		})
+}
@@ -0,0 +1,79 @@
+package librarypanels
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/grafana/pkg/components/simplejson"
+)
+
+func TestLibraryTransformations(t *testing.T) {
+	testScenario(t, "When a dashboard is loaded, the library transformations referenced by its panels should be expanded",
+		func(t *testing.T, sc scenarioContext) {
+			pipeline := createLibraryTransformation(t, sc, "SLO", `{ "transformations": [
+				{ "id": "reduce", "options": { "reducers": ["mean"] } },
+				{ "id": "calculateField", "options": { "alias": "SLO" } }
+			] }`)
+			panel := createLibraryPanel(t, sc, getCreateCommandWithModel(1, "Availability", `{ "type": "graph", "transformations": [
+				{ "id": "merge", "options": {} },
+				{ "libraryTransformation": { "uid": "`+pipeline.UID+`" } }
+			] }`))
+
+			dash := getDashboardWithLibraryPanels(t, panel.UID, "unknown")
+			err := sc.service.LoadLibraryPanelsForDashboard(sc.reqContext, dash)
+			require.NoError(t, err)
+			transformations := dash.Data.Get("panels").GetIndex(0).Get("transformations")
+			require.Equal(t, []string{"merge", "reduce", "calculateField"}, transformationIDs(transformations))
+			require.Equal(t, "SLO", transformations.GetIndex(2).Get("libraryTransformation").Get("name").MustString())
+
+			// a dashboard saved with the expanded transformations gets the latest ones
+			sc.reqContext.ReplaceAllParams(map[string]string{":uid": pipeline.UID})
+			response := sc.service.patchHandler(sc.reqContext, patchLibraryPanelCommand{
+				Model: []byte(`{ "transformations": [{ "id": "reduce", "options": { "reducers": ["max"] } }] }`),
+			})
+			require.Equal(t, 200, response.Status())
+			_, err = sc.service.resolveLibraryTransformations(1, dash.Data.Interface())
+			require.NoError(t, err)
+			transformations = dash.Data.Get("panels").GetIndex(0).Get("transformations")
+			require.Equal(t, []string{"merge", "reduce"}, transformationIDs(transformations))
+			require.Equal(t, "max", transformations.GetIndex(1).GetPath("options", "reducers").GetIndex(0).MustString())
+		})
+
+	testScenario(t, "When library transformations are invalid, unknown or in use, it should fail",
+		func(t *testing.T, sc scenarioContext) {
+			command := getCreateCommandWithModel(1, "No id", `{ "transformations": [{ "options": {} }] }`)
+			command.Kind = transformationElement
+			response := sc.service.createHandler(sc.reqContext, command)
+			require.Equal(t, 400, response.Status())
+
+			command = getCreateCommandWithModel(1, "Unknown transformation",
+				`{ "type": "graph", "transformations": [{ "libraryTransformation": { "uid": "unknown" } }] }`)
+			response = sc.service.createHandler(sc.reqContext, command)
+			require.Equal(t, 400, response.Status())
+
+			pipeline := createLibraryTransformation(t, sc, "SLO", `{ "transformations": [{ "id": "reduce" }] }`)
+			createLibraryPanel(t, sc, getCreateCommandWithModel(1, "Availability",
+				`{ "type": "graph", "transformations": [{ "libraryTransformation": { "uid": "`+pipeline.UID+`" } }] }`))
+			sc.reqContext.ReplaceAllParams(map[string]string{":uid": pipeline.UID})
+			response = sc.service.deleteHandler(sc.reqContext)
+			requireErrorCode(t, response, 409, errorCodeHasConnections)
+		})
+}
+
+func transformationIDs(transformations *simplejson.Json) []string {
+	ids := make([]string, 0)
+	for i := range transformations.MustArray() {
+		ids = append(ids, transformations.GetIndex(i).Get("id").MustString())
+	}
+
+	return ids
+}
+
+func createLibraryTransformation(t *testing.T, sc scenarioContext, name string, model string) libraryPanel {
+	t.Helper()
+
+	command := getCreateCommandWithModel(1, name, model)
+	command.Kind = transformationElement
+	return createLibraryPanel(t, sc, command)
+}
@@ -0,0 +1,91 @@
+package librarypanels
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/grafana/pkg/models"
+)
+
+func TestLibraryPanelTranslations(t *testing.T) {
+	testScenario(t, "When a library panel has translations, they should be returned for the language of the user",
+		func(t *testing.T, sc scenarioContext) {
+			existing := createLibraryPanel(t, sc, getCreateCommand(0, "CPU"))
+			createLibraryPanel(t, sc, getCreateCommand(0, "Memory"))
+
+			sc.reqContext.ReplaceAllParams(map[string]string{":uid": existing.UID, ":locale": "DE"})
+			response := sc.service.setTranslationHandler(sc.reqContext, setLibraryPanelTranslationCommand{Name: "CPU-Auslastung", Description: "Auslastung aller Kerne"})
+			require.Equal(t, 200, response.Status())
+			sc.reqContext.ReplaceAllParams(map[string]string{":uid": existing.UID, ":locale": "fr-fr"})
+			response = sc.service.setTranslationHandler(sc.reqContext, setLibraryPanelTranslationCommand{Name: "Utilisation CPU"})
+			require.Equal(t, 200, response.Status())
+
+			response = sc.service.getTranslationsHandler(sc.reqContext)
+			require.Equal(t, 200, response.Status())
+			var translations struct {
+				Result []libraryPanelTranslation `json:"result"`
+			}
+			err := json.Unmarshal(response.Body(), &translations)
+			require.NoError(t, err)
+			require.Len(t, translations.Result, 2)
+			require.Equal(t, "de", translations.Result[0].Locale)
+			require.Equal(t, "fr-FR", translations.Result[1].Locale)
+
+			// de-AT falls back to de
+			sc.ctx.Req.Request = &http.Request{URL: &url.URL{}, Header: http.Header{"Accept-Language": []string{"de-AT,de;q=0.9,en;q=0.8"}}}
+			response = sc.service.getHandler(sc.reqContext)
+			require.Equal(t, 200, response.Status())
+			var result struct {
+				Result LibraryPanel `json:"result"`
+			}
+			err = json.Unmarshal(response.Body(), &result)
+			require.NoError(t, err)
+			require.Equal(t, "CPU", result.Result.Name)
+			require.NotNil(t, result.Result.Translation)
+			require.Equal(t, "de", result.Result.Translation.Locale)
+			require.Equal(t, "CPU-Auslastung", result.Result.Translation.Name)
+			require.Equal(t, "Auslastung aller Kerne", result.Result.Translation.Description)
+
+			sc.ctx.Req.Request.Header.Set("Accept-Language", "fr-FR")
+			response = sc.service.getAllHandler(sc.reqContext)
+			require.Equal(t, 200, response.Status())
+			var all struct {
+				Result []LibraryPanel `json:"result"`
+			}
+			err = json.Unmarshal(response.Body(), &all)
+			require.NoError(t, err)
+			require.Len(t, all.Result, 2)
+			for _, panel := range all.Result {
+				if panel.UID == existing.UID {
+					require.Equal(t, "Utilisation CPU", panel.Translation.Name)
+				} else {
+					require.Nil(t, panel.Translation)
+				}
+			}
+
+			response = sc.service.deleteTranslationHandler(sc.reqContext)
+			require.Equal(t, 200, response.Status())
+			response = sc.service.deleteTranslationHandler(sc.reqContext)
+			requireErrorCode(t, response, 404, errorCodeNotFound)
+		})
+
+	testScenario(t, "When a translation has an invalid locale or is set by a viewer, it should fail",
+		func(t *testing.T, sc scenarioContext) {
+			existing := createLibraryPanel(t, sc, getCreateCommand(0, "CPU"))
+
+			sc.reqContext.ReplaceAllParams(map[string]string{":uid": existing.UID, ":locale": "not a locale"})
+			response := sc.service.setTranslationHandler(sc.reqContext, setLibraryPanelTranslationCommand{Name: "CPU"})
+			requireErrorCode(t, response, 400, errorCodeInvalid)
+			sc.reqContext.ReplaceAllParams(map[string]string{":uid": existing.UID, ":locale": "de"})
+			response = sc.service.setTranslationHandler(sc.reqContext, setLibraryPanelTranslationCommand{Name: " "})
+			requireErrorCode(t, response, 400, errorCodeInvalid)
+
+			sc.reqContext.SignedInUser = &models.SignedInUser{UserId: 2, OrgId: 1, OrgRole: models.ROLE_VIEWER}
+			response = sc.service.setTranslationHandler(sc.reqContext, setLibraryPanelTranslationCommand{Name: "CPU-Auslastung"})
+			requireErrorCode(t, response, 403, errorCodePermissionDenied)
+		})
+}
@@ -0,0 +1,194 @@
+package librarypanels
+
+import (
+	"encoding/json"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/grafana/pkg/components/simplejson"
+	"github.com/grafana/grafana/pkg/models"
+)
+
+func TestLoadLibraryPanelsForDashboard(t *testing.T) {
+	testScenario(t, "When an admin loads a dashboard with library panels, the library panel models should be used",
+		func(t *testing.T, sc scenarioContext) {
+			existing := createLibraryPanel(t, sc, getCreateCommand(1, "Text - Library Panel"))
+
+			dash := getDashboardWithLibraryPanels(t, existing.UID, "unknown")
+			err := sc.service.LoadLibraryPanelsForDashboard(sc.reqContext, dash)
+			require.NoError(t, err)
+
+			panels := dash.Data.Get("panels").MustArray()
+			require.Len(t, panels, 3)
+
+			resolved := simplejson.NewFromAny(panels[0])
+			require.Equal(t, int64(2), resolved.Get("id").MustInt64())
+			require.Equal(t, "text", resolved.Get("type").MustString())
+			require.Equal(t, "${DS_GDEV-TESTDATA}", resolved.Get("datasource").MustString())
+			require.Equal(t, 6, resolved.Get("gridPos").Get("w").MustInt())
+			require.Equal(t, existing.UID, resolved.Get("libraryPanel").Get("uid").MustString())
+			require.Equal(t, "Text - Library Panel", resolved.Get("libraryPanel").Get("name").MustString())
+
+			unresolved := simplejson.NewFromAny(panels[1])
+			require.Equal(t, "", unresolved.Get("type").MustString())
+			require.Equal(t, "unknown", unresolved.Get("libraryPanel").Get("uid").MustString())
+
+			nested := simplejson.NewFromAny(panels[2]).Get("panels").GetIndex(0)
+			require.Equal(t, "text", nested.Get("type").MustString())
+			require.Equal(t, int64(4), nested.Get("id").MustInt64())
+		})
+}
+
+func TestLibraryPanelUsageReport(t *testing.T) {
+	testScenario(t, "When an admin gets the usage report, panels should be grouped by views",
+		func(t *testing.T, sc scenarioContext) {
+			popular := createLibraryPanel(t, sc, getCreateCommand(1, "Popular"))
+			rare := createLibraryPanel(t, sc, getCreateCommand(1, "Rare"))
+			createLibraryPanel(t, sc, getCreateCommand(1, "Unused"))
+			connected := createLibraryPanel(t, sc, getCreateCommand(1, "Connected"))
+
+			dash := saveTestDashboard(t, `{ "title": "Dashboard", "panels": [] }`)
+			sc.reqContext.ReplaceAllParams(map[string]string{":uid": connected.UID, ":dashboardId": strconv.FormatInt(dash.Id, 10)})
+			response := sc.service.connectHandler(sc.reqContext)
+			require.Equal(t, 200, response.Status())
+
+			err := sc.service.LoadLibraryPanelsForDashboard(sc.reqContext, getDashboardWithLibraryPanels(t, popular.UID, rare.UID))
+			require.NoError(t, err)
+			for i := 0; i < 2; i++ {
+				err := sc.service.LoadLibraryPanelsForDashboard(sc.reqContext, getDashboardWithLibraryPanels(t, popular.UID, "unknown"))
+				require.NoError(t, err)
+			}
+
+			// the views are only in the usage report once they are flushed
+			response = sc.service.getUsageReportHandler(sc.reqContext)
+			require.Equal(t, 200, response.Status())
+			require.Contains(t, string(response.Body()), `"mostUsed":[]`)
+			count, err := sc.service.flushLibraryPanelViews()
+			require.NoError(t, err)
+			require.Equal(t, 2, count)
+
+			response = sc.service.getUsageReportHandler(sc.reqContext)
+			require.Equal(t, 200, response.Status())
+
+			var result struct {
+				Result struct {
+					MostUsed  []libraryPanelUsage `json:"mostUsed"`
+					LeastUsed []libraryPanelUsage `json:"leastUsed"`
+					Unused    []libraryPanelUsage `json:"unused"`
+				} `json:"result"`
+			}
+			err = json.Unmarshal(response.Body(), &result)
+			require.NoError(t, err)
+			require.Len(t, result.Result.MostUsed, 2)
+			require.Equal(t, "Popular", result.Result.MostUsed[0].Name)
+			require.Equal(t, int64(3), result.Result.MostUsed[0].Views)
+			require.Equal(t, "Rare", result.Result.LeastUsed[0].Name)
+			require.Equal(t, int64(1), result.Result.LeastUsed[0].Views)
+			require.Len(t, result.Result.Unused, 1)
+			require.Equal(t, "Unused", result.Result.Unused[0].Name)
+		})
+}
+
+func TestFlushLibraryPanelViews(t *testing.T) {
+	testScenario(t, "When views are flushed more than once, the view counts should add up",
+		func(t *testing.T, sc scenarioContext) {
+			existing := createLibraryPanel(t, sc, getCreateCommand(1, "Text - Library Panel"))
+			deleted := createLibraryPanel(t, sc, getCreateCommand(1, "Deleted"))
+
+			err := sc.service.LoadLibraryPanelsForDashboard(sc.reqContext, getDashboardWithLibraryPanels(t, existing.UID, deleted.UID))
+			require.NoError(t, err)
+			count, err := sc.service.flushLibraryPanelViews()
+			require.NoError(t, err)
+			require.Equal(t, 2, count)
+
+			err = sc.service.LoadLibraryPanelsForDashboard(sc.reqContext, getDashboardWithLibraryPanels(t, existing.UID, deleted.UID))
+			require.NoError(t, err)
+			sc.reqContext.ReplaceAllParams(map[string]string{":uid": deleted.UID})
+			response := sc.service.deleteHandler(sc.reqContext)
+			require.Equal(t, 200, response.Status())
+			count, err = sc.service.flushLibraryPanelViews()
+			require.NoError(t, err)
+			require.Equal(t, 1, count)
+
+			response = sc.service.getUsageReportHandler(sc.reqContext)
+			require.Equal(t, 200, response.Status())
+			var result struct {
+				Result libraryPanelUsageReport `json:"result"`
+			}
+			err = json.Unmarshal(response.Body(), &result)
+			require.NoError(t, err)
+			require.Len(t, result.Result.MostUsed, 1)
+			require.Equal(t, int64(2), result.Result.MostUsed[0].Views)
+		})
+}
+
+func TestLibraryPanelTimestamps(t *testing.T) {
+	testScenario(t, "When a library panel is connected and viewed, the timestamps should be recorded",
+		func(t *testing.T, sc scenarioContext) {
+			existing := createLibraryPanel(t, sc, getCreateCommand(1, "Text - Library Panel"))
+			require.Nil(t, existing.LastConnectedAt)
+			require.Nil(t, existing.LastViewedAt)
+
+			dash := saveTestDashboard(t, `{ "title": "Dashboard", "panels": [] }`)
+			sc.reqContext.ReplaceAllParams(map[string]string{":uid": existing.UID, ":dashboardId": strconv.FormatInt(dash.Id, 10)})
+			response := sc.service.connectHandler(sc.reqContext)
+			require.Equal(t, 200, response.Status())
+
+			err := sc.service.LoadLibraryPanelsForDashboard(sc.reqContext, getDashboardWithLibraryPanels(t, existing.UID, "unknown"))
+			require.NoError(t, err)
+			_, err = sc.service.flushLibraryPanelViews()
+			require.NoError(t, err)
+
+			response = sc.service.getAllHandler(sc.reqContext)
+			require.Equal(t, 200, response.Status())
+
+			var result libraryPanelsResult
+			err = json.Unmarshal(response.Body(), &result)
+			require.NoError(t, err)
+			require.Len(t, result.Result, 1)
+			require.NotNil(t, result.Result[0].LastConnectedAt)
+			require.NotNil(t, result.Result[0].LastViewedAt)
+			lastViewedAt := *result.Result[0].LastViewedAt
+
+			err = sc.service.LoadLibraryPanelsForDashboard(sc.reqContext, getDashboardWithLibraryPanels(t, existing.UID, "unknown"))
+			require.NoError(t, err)
+			_, err = sc.service.flushLibraryPanelViews()
+			require.NoError(t, err)
+
+			panel, err := sc.service.getLibraryPanel(sc.reqContext, existing.UID)
+			require.NoError(t, err)
+			require.Equal(t, lastViewedAt.Unix(), panel.LastViewedAt.Unix())
+		})
+}
+
+func createLibraryPanel(t *testing.T, sc scenarioContext, command createLibraryPanelCommand) libraryPanel {
+	t.Helper()
+
+	response := sc.service.createHandler(sc.reqContext, command)
+	require.Equal(t, 200, response.Status())
+
+	var result libraryPanelResult
+	err := json.Unmarshal(response.Body(), &result)
+	require.NoError(t, err)
+
+	return result.Result
+}
+
+func getDashboardWithLibraryPanels(t *testing.T, uid string, otherUID string) *models.Dashboard {
+	t.Helper()
+
+	data, err := simplejson.NewJson([]byte(`{
+		"panels": [
+			{ "id": 2, "gridPos": { "h": 6, "w": 6, "x": 0, "y": 0 }, "libraryPanel": { "uid": "` + uid + `", "name": "old name" } },
+			{ "id": 3, "gridPos": { "h": 6, "w": 6, "x": 6, "y": 0 }, "libraryPanel": { "uid": "` + otherUID + `" } },
+			{ "id": 5, "type": "row", "collapsed": true, "panels": [
+				{ "id": 4, "gridPos": { "h": 6, "w": 6, "x": 0, "y": 6 }, "libraryPanel": { "uid": "` + uid + `" } }
+			] }
+		]
+	}`))
+	require.NoError(t, err)
+
+	return models.NewDashboardFromJson(data)
+}
@@ -0,0 +1,152 @@
+package librarypanels
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/macaron.v1"
+
+	"github.com/grafana/grafana/pkg/models"
+)
+
+func TestValidateModel(t *testing.T) {
+	testScenario(t, "When an admin creates a library panel with an invalid model, it should fail with validation errors",
+		func(t *testing.T, sc scenarioContext) {
+			testCases := []struct {
+				model  string
+				fields []string
+			}{
+				{model: `[]`, fields: []string{"model"}},
+				{model: `{ "title": "No type" }`, fields: []string{"model.type"}},
+				{model: `{ "type": 1 }`, fields: []string{"model.type"}},
+				{model: `{ "type": "unknown-panel" }`, fields: []string{"model.type"}},
+				{model: `{ "type": "graph", "fieldConfig": [] }`, fields: []string{"model.fieldConfig"}},
+				{
+					model:  `{ "fieldConfig": { "defaults": 1, "overrides": {} } }`,
+					fields: []string{"model.type", "model.fieldConfig.defaults", "model.fieldConfig.overrides"},
+				},
+			}
+
+			for _, tc := range testCases {
+				response := sc.service.createHandler(sc.reqContext, getCreateCommandWithModel(1, "Invalid", tc.model))
+				require.Equal(t, 400, response.Status())
+
+				var result validationErrorsResult
+				err := json.Unmarshal(response.Body(), &result)
+				require.NoError(t, err)
+				fields := make([]string, 0, len(result.Errors))
+				for _, validationErr := range result.Errors {
+					fields = append(fields, validationErr.Field)
+				}
+				require.Equal(t, tc.fields, fields)
+			}
+		})
+
+	testScenario(t, "When an admin creates or patches a library panel with a model above the maximum size, it should fail",
+		func(t *testing.T, sc scenarioContext) {
+			existing := createLibraryPanel(t, sc, getCreateCommand(1, "Text - Library Panel"))
+			sc.service.Cfg.LibraryPanels.MaxModelSize = 100
+			model := `{ "type": "text", "options": { "content": "` + strings.Repeat("a", 100) + `" } }`
+
+			response := sc.service.createHandler(sc.reqContext, getCreateCommandWithModel(1, "Too large", model))
+			require.Equal(t, 413, response.Status())
+
+			cmd := patchLibraryPanelCommand{Model: []byte(model)}
+			sc.reqContext.ReplaceAllParams(map[string]string{":uid": existing.UID})
+			response = sc.service.patchHandler(sc.reqContext, cmd)
+			require.Equal(t, 413, response.Status())
+		})
+
+	testScenario(t, "When an admin creates a library panel of a type that isn't allowed, it should fail",
+		func(t *testing.T, sc scenarioContext) {
+			sc.service.Cfg.LibraryPanels.AllowedPanelTypes = []string{"text"}
+
+			response := sc.service.createHandler(sc.reqContext, getCreateCommandWithModel(1, "Graph", `{ "type": "graph" }`))
+			require.Equal(t, 400, response.Status())
+			var result validationErrorsResult
+			err := json.Unmarshal(response.Body(), &result)
+			require.NoError(t, err)
+			require.Equal(t, []modelValidationError{{Field: "model.type", Message: `panel type "graph" is not allowed`}}, result.Errors)
+
+			response = sc.service.createHandler(sc.reqContext, getCreateCommandWithModel(1, "Text", `{ "type": "text" }`))
+			require.Equal(t, 200, response.Status())
+		})
+
+	testScenario(t, "When a request is larger than the maximum model size allows, it should be rejected before binding",
+		func(t *testing.T, sc scenarioContext) {
+			sc.service.Cfg.LibraryPanels.MaxModelSize = 100
+
+			m := macaron.New()
+			m.Use(macaron.Renderer(macaron.RenderOptions{
+				Directory: "",
+				Delims:    macaron.Delims{Left: "[[", Right: "]]"},
+			}))
+			m.Post("/api/library-panels", func(c *macaron.Context) {
+				sc.service.limitRequestSize(&models.ReqContext{Context: c, SignedInUser: &sc.user})
+			})
+
+			for size, status := range map[int]int{10: 200, 100 + requestSizeOverhead + 1: 413} {
+				recorder := httptest.NewRecorder()
+				req := httptest.NewRequest("POST", "/api/library-panels", strings.NewReader(strings.Repeat("a", size)))
+				m.ServeHTTP(recorder, req)
+				require.Equal(t, status, recorder.Code)
+			}
+		})
+
+	testScenario(t, "When an admin patches a library panel with an invalid model, it should fail and keep the stored model",
+		func(t *testing.T, sc scenarioContext) {
+			existing := createLibraryPanel(t, sc, getCreateCommand(1, "Text - Library Panel"))
+
+			cmd := patchLibraryPanelCommand{Model: []byte(`{ "title": "No type" }`)}
+			sc.reqContext.ReplaceAllParams(map[string]string{":uid": existing.UID})
+			response := sc.service.patchHandler(sc.reqContext, cmd)
+			require.Equal(t, 400, response.Status())
+
+			panel, err := sc.service.getLibraryPanel(sc.reqContext, existing.UID)
+			require.NoError(t, err)
+			require.JSONEq(t, `{ "datasource": "${DS_GDEV-TESTDATA}", "name": "Text - Library Panel", "type": "text" }`, string(panel.Model))
+		})
+}
+
+type validationErrorsResult struct {
+	Message string                 `json:"message"`
+	Errors  []modelValidationError `json:"errors"`
+}
+
+func TestLibraryPanelNameExists(t *testing.T) {
+	testScenario(t, "When an admin checks a library panel name, it should exist only if the folder has a library panel with it",
+		func(t *testing.T, sc scenarioContext) {
+			existing := createLibraryPanel(t, sc, getCreateCommand(1, "Text - Library Panel"))
+
+			testCases := []struct {
+				query  string
+				exists bool
+			}{
+				{query: "name=Text+-+Library+Panel&folderId=1", exists: true},
+				{query: "name=Text+-+Library+Panel&folderId=0", exists: false},
+				{query: "name=Other&folderId=1", exists: false},
+				{query: "name=Text+-+Library+Panel&folderId=1&kind=2", exists: false},
+				{query: "name=Text+-+Library+Panel&folderId=1&uid=" + existing.UID, exists: false},
+			}
+			for _, testCase := range testCases {
+				sc.ctx.Req.Request = httptest.NewRequest("GET", "/api/library-panels/name-exists?"+testCase.query, nil)
+				response := sc.service.nameExistsHandler(sc.reqContext)
+				require.Equal(t, 200, response.Status())
+				var result struct {
+					Result struct {
+						Exists bool `json:"exists"`
+					} `json:"result"`
+				}
+				err := json.Unmarshal(response.Body(), &result)
+				require.NoError(t, err)
+				require.Equal(t, testCase.exists, result.Result.Exists, testCase.query)
+			}
+
+			sc.ctx.Req.Request = httptest.NewRequest("GET", "/api/library-panels/name-exists?folderId=1", nil)
+			response := sc.service.nameExistsHandler(sc.reqContext)
+			require.Equal(t, 400, response.Status())
+		})
+}
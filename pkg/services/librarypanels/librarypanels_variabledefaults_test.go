@@ -0,0 +1,73 @@
+package librarypanels
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/grafana/pkg/components/simplejson"
+	"github.com/grafana/grafana/pkg/models"
+)
+
+func TestLibraryPanelVariableDefaults(t *testing.T) {
+	testScenario(t, "When an org has variable defaults, the placeholders of library panels should be replaced when they are loaded",
+		func(t *testing.T, sc scenarioContext) {
+			command := getCreateCommand(0, "Requests of ${team}")
+			command.Model = []byte(`{"type": "graph", "title": "Requests of ${team}", "datasource": "${DS_PROMETHEUS}",
+				"targets": [{"refId": "A", "expr": "rate(requests{team=\"${team}\", job=\"${job}\"}[5m])"}]}`)
+			existing := createLibraryPanel(t, sc, command)
+
+			response := sc.service.updateVariableDefaultsHandler(sc.reqContext, updateVariableDefaultsCommand{
+				Variables: map[string]string{"DS_PROMETHEUS": "Prometheus EU", "team": "payments", "job": "api"},
+			})
+			require.Equal(t, 200, response.Status())
+			response = sc.service.getVariableDefaultsHandler(sc.reqContext)
+			require.Equal(t, 200, response.Status())
+			var result struct {
+				Result libraryPanelVariableDefaults `json:"result"`
+			}
+			err := json.Unmarshal(response.Body(), &result)
+			require.NoError(t, err)
+			require.Equal(t, "payments", result.Result.Variables["team"])
+
+			// the dashboard variable job takes precedence over the org default
+			data, err := simplejson.NewJson([]byte(`{
+				"templating": {"list": [{"name": "job", "type": "query"}]},
+				"panels": [{"id": 1, "libraryPanel": {"uid": "` + existing.UID + `"}}]
+			}`))
+			require.NoError(t, err)
+			dash := models.NewDashboardFromJson(data)
+			err = sc.service.LoadLibraryPanelsForDashboard(sc.reqContext, dash)
+			require.NoError(t, err)
+
+			panel := dash.Data.Get("panels").GetIndex(0)
+			require.Equal(t, "Requests of payments", panel.Get("title").MustString())
+			require.Equal(t, "Prometheus EU", panel.Get("datasource").MustString())
+			require.Equal(t, `rate(requests{team="payments", job="${job}"}[5m])`, panel.Get("targets").GetIndex(0).Get("expr").MustString())
+			// the metadata of the library panel isn't part of its model, and the model keeps its placeholders for the editor
+			require.Equal(t, "Requests of ${team}", panel.Get("libraryPanel").Get("name").MustString())
+			require.Equal(t, "Requests of ${team}", panel.Get("libraryPanel").Get("model").Get("title").MustString())
+			require.Equal(t, "${DS_PROMETHEUS}", panel.Get("libraryPanel").Get("model").Get("datasource").MustString())
+			_, hasID := panel.Get("libraryPanel").Get("model").CheckGet("id")
+			require.False(t, hasID)
+
+			// the stored model keeps its placeholders
+			sc.reqContext.ReplaceAllParams(map[string]string{":uid": existing.UID})
+			response = sc.service.getHandler(sc.reqContext)
+			require.Equal(t, 200, response.Status())
+			require.Contains(t, string(response.Body()), `Requests of ${team}`)
+		})
+
+	testScenario(t, "When variable defaults have invalid names, updating them should fail",
+		func(t *testing.T, sc scenarioContext) {
+			response := sc.service.updateVariableDefaultsHandler(sc.reqContext, updateVariableDefaultsCommand{
+				Variables: map[string]string{"not a name": "value"},
+			})
+			requireErrorCode(t, response, 400, errorCodeInvalid)
+
+			response = sc.service.getVariableDefaultsHandler(sc.reqContext)
+			require.Equal(t, 200, response.Status())
+			require.Contains(t, string(response.Body()), `"variables":{}`)
+		})
+}
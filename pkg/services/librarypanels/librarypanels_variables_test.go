@@ -0,0 +1,87 @@
+package librarypanels
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/grafana/pkg/components/simplejson"
+	"github.com/grafana/grafana/pkg/models"
+)
+
+func TestLibraryVariables(t *testing.T) {
+	testScenario(t, "When an admin creates a library variable, it should be listed separately from library panels",
+		func(t *testing.T, sc scenarioContext) {
+			createLibraryPanel(t, sc, getCreateCommand(1, "Shared"))
+			variable := createLibraryPanel(t, sc, getCreateVariableCommand(1, "Shared"))
+			require.Equal(t, int64(variableElement), variable.Kind)
+
+			response := sc.service.getAllHandler(sc.reqContext)
+			require.Equal(t, 200, response.Status())
+			var result libraryPanelsResult
+			err := json.Unmarshal(response.Body(), &result)
+			require.NoError(t, err)
+			require.Len(t, result.Result, 1)
+			require.Equal(t, int64(panelElement), result.Result[0].Kind)
+
+			sc.ctx.Req.Request = &http.Request{URL: &url.URL{RawQuery: "kind=2"}}
+			response = sc.service.getAllHandler(sc.reqContext)
+			require.Equal(t, 200, response.Status())
+			err = json.Unmarshal(response.Body(), &result)
+			require.NoError(t, err)
+			require.Len(t, result.Result, 1)
+			require.Equal(t, variable.UID, result.Result[0].UID)
+		})
+
+	testScenario(t, "When an admin creates a library element with an unknown kind or an invalid variable, it should fail",
+		func(t *testing.T, sc scenarioContext) {
+			command := getCreateCommand(1, "Unknown kind")
+			command.Kind = 7
+			response := sc.service.createHandler(sc.reqContext, command)
+			require.Equal(t, 400, response.Status())
+
+			command = getCreateCommandWithModel(1, "Invalid variable", `{ "type": "text" }`)
+			command.Kind = variableElement
+			response = sc.service.createHandler(sc.reqContext, command)
+			require.Equal(t, 400, response.Status())
+
+			var result validationErrorsResult
+			err := json.Unmarshal(response.Body(), &result)
+			require.NoError(t, err)
+			require.Len(t, result.Errors, 2)
+		})
+
+	testScenario(t, "When an admin loads a dashboard with library variables, the library variable models should be used",
+		func(t *testing.T, sc scenarioContext) {
+			variable := createLibraryPanel(t, sc, getCreateVariableCommand(1, "Server"))
+
+			data, err := simplejson.NewJson([]byte(`{
+				"templating": { "list": [
+					{ "name": "old", "current": { "text": "web-1", "value": "web-1" }, "libraryVariable": { "uid": "` + variable.UID + `" } },
+					{ "name": "local", "type": "custom", "query": "a,b" }
+				] }
+			}`))
+			require.NoError(t, err)
+			dash := models.NewDashboardFromJson(data)
+
+			err = sc.service.LoadLibraryPanelsForDashboard(sc.reqContext, dash)
+			require.NoError(t, err)
+
+			resolved := dash.Data.Get("templating").Get("list").GetIndex(0)
+			require.Equal(t, "server", resolved.Get("name").MustString())
+			require.Equal(t, "query", resolved.Get("type").MustString())
+			require.Equal(t, "web-1", resolved.Get("current").Get("value").MustString())
+			require.Equal(t, variable.UID, resolved.Get("libraryVariable").Get("uid").MustString())
+			require.Equal(t, "local", dash.Data.Get("templating").Get("list").GetIndex(1).Get("name").MustString())
+		})
+}
+
+func getCreateVariableCommand(folderID int64, name string) createLibraryPanelCommand {
+	command := getCreateCommandWithModel(folderID, name, `{ "name": "server", "type": "query", "datasource": "gdev-prometheus", "query": "label_values(instance)" }`)
+	command.Kind = variableElement
+
+	return command
+}
@@ -0,0 +1,110 @@
+package librarypanels
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/grafana/pkg/components/simplejson"
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/sqlstore"
+)
+
+func TestLibraryPanelVariants(t *testing.T) {
+	testScenario(t, "When a library panel has an experimental variant, dashboards should get it for its teams and percentage",
+		func(t *testing.T, sc scenarioContext) {
+			team := models.Team{OrgId: 1, Name: "Trial", Created: time.Now(), Updated: time.Now()}
+			err := sc.service.SQLStore.WithDbSession(context.Background(), func(session *sqlstore.DBSession) error {
+				_, err := session.Insert(&team)
+				return err
+			})
+			require.NoError(t, err)
+			existing := createLibraryPanel(t, sc, getCreateCommand(1, "Text - Library Panel"))
+
+			sc.reqContext.ReplaceAllParams(map[string]string{":uid": existing.UID})
+			cmd := setLibraryPanelVariantCommand{
+				Model:   []byte(`{ "type": "text", "title": "Experimental" }`),
+				TeamIDs: []int64{team.Id},
+			}
+			response := sc.service.setVariantHandler(sc.reqContext, cmd)
+			require.Equal(t, 200, response.Status())
+
+			sc.service.variantRandom = func() float64 { return 0.4 }
+			require.Equal(t, []string{"", ""}, loadVariantTitles(t, sc, existing.UID))
+			sc.reqContext.SignedInUser.Teams = []int64{team.Id}
+			require.Equal(t, []string{"Experimental", "Experimental"}, loadVariantTitles(t, sc, existing.UID))
+			sc.reqContext.SignedInUser.Teams = nil
+
+			cmd.Percentage = 50
+			cmd.TeamIDs = nil
+			response = sc.service.setVariantHandler(sc.reqContext, cmd)
+			require.Equal(t, 200, response.Status())
+			require.Equal(t, []string{"Experimental", "Experimental"}, loadVariantTitles(t, sc, existing.UID))
+			sc.service.variantRandom = func() float64 { return 0.6 }
+			require.Equal(t, []string{"", ""}, loadVariantTitles(t, sc, existing.UID))
+
+			response = sc.service.getVariantHandler(sc.reqContext)
+			require.Equal(t, 200, response.Status())
+			var result struct {
+				Result libraryPanelVariant `json:"result"`
+			}
+			err = json.Unmarshal(response.Body(), &result)
+			require.NoError(t, err)
+			require.Equal(t, 50, result.Result.Percentage)
+			require.Empty(t, result.Result.TeamIDs)
+
+			response = sc.service.deleteVariantHandler(sc.reqContext)
+			require.Equal(t, 200, response.Status())
+			response = sc.service.getVariantHandler(sc.reqContext)
+			require.Equal(t, 404, response.Status())
+			sc.service.variantRandom = func() float64 { return 0 }
+			require.Equal(t, []string{"", ""}, loadVariantTitles(t, sc, existing.UID))
+		})
+
+	testScenario(t, "When an experimental variant has an invalid percentage or unknown teams, it should fail",
+		func(t *testing.T, sc scenarioContext) {
+			existing := createLibraryPanel(t, sc, getCreateCommand(1, "Text - Library Panel"))
+
+			sc.reqContext.ReplaceAllParams(map[string]string{":uid": existing.UID})
+			response := sc.service.setVariantHandler(sc.reqContext, setLibraryPanelVariantCommand{
+				Model:      []byte(`{ "type": "text" }`),
+				Percentage: 101,
+			})
+			require.Equal(t, 400, response.Status())
+			response = sc.service.setVariantHandler(sc.reqContext, setLibraryPanelVariantCommand{
+				Model:   []byte(`{ "type": "text" }`),
+				TeamIDs: []int64{42},
+			})
+			require.Equal(t, 400, response.Status())
+			response = sc.service.getVariantHandler(sc.reqContext)
+			require.Equal(t, 404, response.Status())
+		})
+}
+
+// loadVariantTitles loads a dashboard that uses the library panel twice and returns the titles of the two panels,
+// checking that the panels that got the experimental variant are marked.
+func loadVariantTitles(t *testing.T, sc scenarioContext, uid string) []string {
+	t.Helper()
+
+	dash := getDashboardWithLibraryPanels(t, uid, "unknown")
+	err := sc.service.LoadLibraryPanelsForDashboard(sc.reqContext, dash)
+	require.NoError(t, err)
+
+	panels := dash.Data.Get("panels")
+	titles := make([]string, 0, 2)
+	for _, panel := range []*simplejson.Json{panels.GetIndex(0), panels.GetIndex(2).Get("panels").GetIndex(0)} {
+		title := panel.Get("title").MustString()
+		if title != "" {
+			require.Equal(t, variantExperimental, panel.Get("libraryPanel").Get("variant").MustString())
+		} else {
+			_, marked := panel.Get("libraryPanel").CheckGet("variant")
+			require.False(t, marked)
+		}
+		titles = append(titles, title)
+	}
+
+	return titles
+}
@@ -0,0 +1,182 @@
+package librarypanels
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// deprecatedPanelTypes are the panel types that have a replacement, by the panel type to use instead.
+var deprecatedPanelTypes = map[string]string{
+	"singlestat":               "stat",
+	"grafana-singlestat-panel": "stat",
+}
+
+// deprecatedPanelOptions are the panel options that are replaced by other options, by what to use instead.
+var deprecatedPanelOptions = []struct {
+	path        []string
+	replacement string
+}{
+	{path: []string{"span"}, replacement: "gridPos"},
+	{path: []string{"options", "fieldOptions"}, replacement: "fieldConfig"},
+}
+
+// unitPanelTypes are the panel types that show values that should have a unit.
+var unitPanelTypes = map[string]bool{
+	"stat": true, "gauge": true, "bargauge": true, "timeseries": true,
+}
+
+// validateLibraryPanelCommand is the command for validating a library element model.
+type validateLibraryPanelCommand struct {
+	Kind  libraryElementKind `json:"kind"`
+	Model json.RawMessage    `json:"model"`
+}
+
+// lintResult is the result of validating and linting a library element model. Valid is false if the model
+// has errors, or if it has warnings and strict linting is enabled.
+type lintResult struct {
+	Valid    bool                  `json:"valid"`
+	Errors   modelValidationErrors `json:"errors"`
+	Warnings modelValidationErrors `json:"warnings"`
+}
+
+// lintLibraryPanelModel validates the model like when it is saved, and returns the validation errors and the
+// lint warnings. Models that are too large or of an unknown kind are returned as errors.
+func (lps *LibraryPanelService) lintLibraryPanelModel(kind libraryElementKind, model json.RawMessage) (lintResult, error) {
+	settings := lps.Cfg.LibraryPanels
+	settings.StrictLinting = false
+	result := lintResult{Errors: modelValidationErrors{}, Warnings: lintElementModel(kind, model)}
+	if err := validateElementModel(kind, model, settings); err != nil {
+		if !errors.As(err, &result.Errors) {
+			return lintResult{}, err
+		}
+	}
+
+	result.Valid = len(result.Errors) == 0 && (!lps.Cfg.LibraryPanels.StrictLinting || len(result.Warnings) == 0)
+	return result, nil
+}
+
+// lintElementModel returns the lint warnings of the model of a library element: deprecated panel types and
+// options, values without a unit and thresholds that can't be applied as intended. Only the panels of
+// Library Panels and library rows are linted, parts of the model that aren't valid are skipped.
+func lintElementModel(kind libraryElementKind, model json.RawMessage) modelValidationErrors {
+	var object map[string]json.RawMessage
+	if err := json.Unmarshal(model, &object); err != nil {
+		return modelValidationErrors{}
+	}
+
+	warnings := modelValidationErrors{}
+	switch kind {
+	case panelElement:
+		warnings = append(warnings, lintPanel(object, "model")...)
+	case rowElement:
+		var panels []map[string]json.RawMessage
+		// invalid panels are validation errors
+		_ = json.Unmarshal(object["panels"], &panels)
+		for i, panel := range panels {
+			warnings = append(warnings, lintPanel(panel, fmt.Sprintf("model.panels[%d]", i))...)
+		}
+	}
+
+	return warnings
+}
+
+func lintPanel(panel map[string]json.RawMessage, field string) modelValidationErrors {
+	var warnings modelValidationErrors
+	var panelType string
+	_ = json.Unmarshal(panel["type"], &panelType)
+	if replacement, ok := deprecatedPanelTypes[panelType]; ok {
+		warnings = append(warnings, modelValidationError{Field: field + ".type",
+			Message: fmt.Sprintf("panel type %q is deprecated, use %q instead", panelType, replacement)})
+	}
+	for _, option := range deprecatedPanelOptions {
+		if hasPath(panel, option.path) {
+			path := field
+			for _, key := range option.path {
+				path += "." + key
+			}
+			warnings = append(warnings, modelValidationError{Field: path,
+				Message: fmt.Sprintf("is deprecated, use %s instead", option.replacement)})
+		}
+	}
+
+	var fieldConfig struct {
+		Defaults struct {
+			Unit       *string         `json:"unit"`
+			Thresholds json.RawMessage `json:"thresholds"`
+		} `json:"defaults"`
+	}
+	if raw, ok := panel["fieldConfig"]; ok {
+		// invalid field configs are validation errors
+		_ = json.Unmarshal(raw, &fieldConfig)
+	}
+	defaults := field + ".fieldConfig.defaults"
+	if unitPanelTypes[panelType] && (fieldConfig.Defaults.Unit == nil || *fieldConfig.Defaults.Unit == "") {
+		warnings = append(warnings, modelValidationError{Field: defaults + ".unit", Message: "is not set, values are shown without a unit"})
+	}
+	if len(fieldConfig.Defaults.Thresholds) > 0 {
+		warnings = append(warnings, lintThresholds(fieldConfig.Defaults.Thresholds, defaults+".thresholds")...)
+	}
+
+	return warnings
+}
+
+// lintThresholds checks that the thresholds have a known mode, start with the base step, which has no value,
+// and have increasing values.
+func lintThresholds(raw json.RawMessage, field string) modelValidationErrors {
+	var thresholds struct {
+		Mode  string `json:"mode"`
+		Steps []struct {
+			Value *float64 `json:"value"`
+		} `json:"steps"`
+	}
+	if err := json.Unmarshal(raw, &thresholds); err != nil {
+		return modelValidationErrors{{Field: field, Message: "must be a JSON object with a mode and steps"}}
+	}
+
+	var warnings modelValidationErrors
+	if thresholds.Mode != "absolute" && thresholds.Mode != "percentage" {
+		warnings = append(warnings, modelValidationError{Field: field + ".mode", Message: `must be "absolute" or "percentage"`})
+	}
+	if len(thresholds.Steps) == 0 {
+		return append(warnings, modelValidationError{Field: field + ".steps", Message: "is empty, values won't have a color"})
+	}
+	if thresholds.Steps[0].Value != nil {
+		warnings = append(warnings, modelValidationError{Field: field + ".steps[0].value", Message: "must be null, the first step is the base for values below the other steps"})
+	}
+
+	var previous *float64
+	for i, step := range thresholds.Steps[1:] {
+		stepField := fmt.Sprintf("%s.steps[%d].value", field, i+1)
+		switch {
+		case step.Value == nil:
+			warnings = append(warnings, modelValidationError{Field: stepField, Message: "is required, only the first step can be null"})
+			continue
+		case previous != nil && *step.Value <= *previous:
+			warnings = append(warnings, modelValidationError{Field: stepField, Message: fmt.Sprintf("must be greater than the value of the previous step, %v", *previous)})
+		case thresholds.Mode == "percentage" && (*step.Value < 0 || *step.Value > 100):
+			warnings = append(warnings, modelValidationError{Field: stepField, Message: "must be between 0 and 100 in percentage mode"})
+		}
+		previous = step.Value
+	}
+
+	return warnings
+}
+
+// hasPath returns true if the nested keys exist in the object.
+func hasPath(object map[string]json.RawMessage, path []string) bool {
+	raw, ok := object[path[0]]
+	if !ok {
+		return false
+	}
+	if len(path) == 1 {
+		return true
+	}
+
+	var nested map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &nested); err != nil {
+		return false
+	}
+
+	return hasPath(nested, path[1:])
+}
@@ -0,0 +1,57 @@
+package librarypanels
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+)
+
+// selectModelPaths returns the parts of the model at the dot separated paths, like fieldConfig.defaults.unit,
+// nested the same way as in the model. Paths only go through objects, an array is selected as a whole, and
+// paths that don't exist in the model are left out.
+func selectModelPaths(model json.RawMessage, paths []string) (json.RawMessage, error) {
+	var object map[string]interface{}
+	decoder := json.NewDecoder(bytes.NewReader(model))
+	decoder.UseNumber()
+	if err := decoder.Decode(&object); err != nil {
+		return nil, err
+	}
+
+	selected := map[string]interface{}{}
+	for _, path := range paths {
+		keys := strings.Split(strings.TrimSpace(path), ".")
+		for _, key := range keys {
+			if key == "" {
+				return nil, errLibraryPanelInvalidModelPath
+			}
+		}
+		selectModelPath(object, selected, keys)
+	}
+
+	return canonicalJSON(selected)
+}
+
+func selectModelPath(source map[string]interface{}, target map[string]interface{}, keys []string) {
+	value, ok := source[keys[0]]
+	if !ok {
+		return
+	}
+	if len(keys) == 1 {
+		target[keys[0]] = value
+		return
+	}
+
+	child, ok := value.(map[string]interface{})
+	if !ok {
+		return
+	}
+	// a shorter path that already selected the whole object selects it in the target too
+	targetChild, ok := target[keys[0]].(map[string]interface{})
+	if !ok {
+		targetChild = map[string]interface{}{}
+	}
+	selectModelPath(child, targetChild, keys[1:])
+	if len(targetChild) > 0 {
+		target[keys[0]] = targetChild
+	}
+}
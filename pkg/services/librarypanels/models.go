@@ -2,10 +2,29 @@ package librarypanels
 
 import (
 	"encoding/json"
-	"errors"
 	"time"
 )
 
+// libraryElementKind is the kind of a library element, Library Panels and library variables
+// share the same tables and API.
+type libraryElementKind int64
+
+const (
+	// panelElement is a Library Panel.
+	panelElement libraryElementKind = iota + 1
+	// variableElement is a library template variable.
+	variableElement
+	// rowElement is a library row, a dashboard row with its panels.
+	rowElement
+	// fragmentElement is a library fragment, a part of a model like a query or a transformation that the
+	// models of other library elements reference.
+	fragmentElement
+	// queryElement is a library query, a data source and a query that panels and alerts reference.
+	queryElement
+	// transformationElement is a library transformation, a pipeline of transformations that panels reference.
+	transformationElement
+)
+
 // LibraryPanel is the model for library panel definitions.
 type LibraryPanel struct {
 	ID       int64  `xorm:"pk autoincr 'id'"`
@@ -13,13 +32,64 @@ type LibraryPanel struct {
 	FolderID int64  `xorm:"folder_id"`
 	UID      string `xorm:"uid"`
 	Name     string
-	Model    json.RawMessage
+	Kind     libraryElementKind `xorm:"kind"`
+	Model    json.RawMessage    `xorm:"-"`
+	Tags     []string           `xorm:"-"`
+	// StoredModel is the model as it's stored, it's encoded and decoded by the xorm processors of LibraryPanel.
+	StoredModel json.RawMessage `json:"-" xorm:"model"`
+	// modelCompression is the compression the model is stored with when the Library Panel is written, the
+	// configured compression of the service if it's set before writing, uncompressed otherwise.
+	modelCompression string `xorm:"-"`
 
 	Created time.Time
 	Updated time.Time
 
 	CreatedBy int64
 	UpdatedBy int64
+
+	LastConnectedAt *time.Time `xorm:"last_connected_at"`
+	LastViewedAt    *time.Time `xorm:"last_viewed_at"`
+
+	// ModelHash is the SHA-256 of the normalized model, patches with the same model are no-ops.
+	ModelHash string `xorm:"model_hash"`
+	// SchemaVersion is the dashboard schemaVersion of the model.
+	SchemaVersion int64 `xorm:"schema_version"`
+	// CatalogUID is the catalog panel a Library Panel installed as a linked reference follows.
+	CatalogUID string `xorm:"catalog_uid"`
+	// SyncPath is the file in the synced Git repository that a provisioned Library Panel is read from.
+	SyncPath string `xorm:"sync_path"`
+	// PluginID is the app plugin that shipped the Library Panel.
+	PluginID string `xorm:"plugin_id"`
+	// PluginPath is the plugin include the Library Panel is read from. It is cleared when the plugin is
+	// disabled while the Library Panel is used, the Library Panel is then orphaned and kept as is.
+	PluginPath string `xorm:"plugin_path"`
+	// Status is draft or published, drafts are only visible to their author and users who can edit them.
+	Status string `xorm:"status"`
+	// Deprecated marks a Library Panel that dashboards should stop using, ReplacedBy is the UID of the
+	// Library Panel to use instead, if any.
+	Deprecated bool   `xorm:"deprecated"`
+	ReplacedBy string `xorm:"replaced_by"`
+	// RegistrySource is the URL of the community registry panel a Library Panel was installed from, and
+	// RegistryRevision the revision that was installed.
+	RegistrySource   string `xorm:"registry_source"`
+	RegistryRevision int64  `xorm:"registry_revision"`
+	// ReplicaOf is the ID of the Library Panel in another org that a replicated copy is kept in sync with.
+	ReplicaOf int64 `xorm:"replica_of"`
+	// Pinned exempts the Library Panel from the automated cleanups: the cleanup policies don't remove it, and
+	// it's kept when the Git repository or plugin it's read from doesn't have it anymore.
+	Pinned bool `xorm:"pinned"`
+	// OwnerTeamID is the team that owns the Library Panel, 0 if no team does. Only the members of the owning team
+	// and org admins can edit a Library Panel with an owning team.
+	OwnerTeamID int64 `xorm:"owner_team_id"`
+	// Translation is the name and description for the language of the user, it is only set in API responses.
+	Translation *libraryPanelTranslation `json:",omitempty" xorm:"-"`
+
+	// ConnectedDashboards is the number of dashboards using the Library Panel. It is only set in lists.
+	ConnectedDashboards int64 `xorm:"-"`
+	// Fingerprint is the libraryPanelFingerprint, it is only set in API responses with the model.
+	Fingerprint string `json:",omitempty" xorm:"-"`
+	// Meta is only set when a single Library Panel is read.
+	Meta *libraryPanelMeta `json:",omitempty" xorm:"-"`
 }
 
 // libraryPanelDashboard is the model for library panel connections.
@@ -27,28 +97,270 @@ type libraryPanelDashboard struct {
 	ID             int64 `xorm:"pk autoincr 'id'"`
 	LibraryPanelID int64 `xorm:"librarypanel_id"`
 	DashboardID    int64 `xorm:"dashboard_id"`
+	PanelID        int64 `xorm:"panel_id"`
 
 	Created time.Time
 
 	CreatedBy int64
 }
 
+// libraryPanelTag is the model for library panel tags.
+type libraryPanelTag struct {
+	ID             int64 `xorm:"pk autoincr 'id'"`
+	LibraryPanelID int64 `xorm:"librarypanel_id"`
+	Term           string
+}
+
+// libraryPanelErrorCode is the machine readable kind of a library panel API error, API clients can rely on it
+// rather than on the error message.
+type libraryPanelErrorCode string
+
+const (
+	errorCodeNotFound         libraryPanelErrorCode = "NotFound"
+	errorCodeAlreadyExists    libraryPanelErrorCode = "AlreadyExists"
+	errorCodeVersionMismatch  libraryPanelErrorCode = "VersionMismatch"
+	errorCodeHasConnections   libraryPanelErrorCode = "HasConnections"
+	errorCodeQuotaExceeded    libraryPanelErrorCode = "QuotaExceeded"
+	errorCodeTooLarge         libraryPanelErrorCode = "TooLarge"
+	errorCodeInvalid          libraryPanelErrorCode = "Invalid"
+	errorCodeReadOnly         libraryPanelErrorCode = "ReadOnly"
+	errorCodePermissionDenied libraryPanelErrorCode = "PermissionDenied"
+	errorCodeRateLimited      libraryPanelErrorCode = "RateLimited"
+)
+
+// httpStatus returns the HTTP status of the API responses for errors of the code.
+func (code libraryPanelErrorCode) httpStatus() int {
+	switch code {
+	case errorCodeNotFound:
+		return 404
+	case errorCodeVersionMismatch:
+		return 412
+	case errorCodeHasConnections:
+		return 409
+	case errorCodeQuotaExceeded, errorCodePermissionDenied:
+		return 403
+	case errorCodeTooLarge:
+		return 413
+	case errorCodeRateLimited:
+		return 429
+	default:
+		return 400
+	}
+}
+
+// libraryPanelError is an error of the library panel API with a machine readable code.
+type libraryPanelError struct {
+	code    libraryPanelErrorCode
+	message string
+}
+
+func newLibraryPanelError(code libraryPanelErrorCode, message string) *libraryPanelError {
+	return &libraryPanelError{code: code, message: message}
+}
+
+func (e *libraryPanelError) Error() string {
+	return e.message
+}
+
 var (
 	// errLibraryPanelAlreadyExists is an error for when the user tries to add a library panel that already exists.
-	errLibraryPanelAlreadyExists = errors.New("library panel with that name already exists")
+	errLibraryPanelAlreadyExists = newLibraryPanelError(errorCodeAlreadyExists, "library panel with that name already exists")
 	// errLibraryPanelNotFound is an error for when a library panel can't be found.
-	errLibraryPanelNotFound = errors.New("library panel could not be found")
+	errLibraryPanelNotFound = newLibraryPanelError(errorCodeNotFound, "library panel could not be found")
 	// errLibraryPanelDashboardNotFound is an error for when a library panel connection can't be found.
-	errLibraryPanelDashboardNotFound = errors.New("library panel connection could not be found")
+	errLibraryPanelDashboardNotFound = newLibraryPanelError(errorCodeNotFound, "library panel connection could not be found")
+	// errLibraryPanelQuotaReached is an error for when the library panel quota of the org or user is reached.
+	errLibraryPanelQuotaReached = newLibraryPanelError(errorCodeQuotaExceeded, "library panel quota reached")
+	// errLibraryPanelInvalidCleanupPolicy is an error for when a cleanup policy has an unknown action or a non positive age.
+	errLibraryPanelInvalidCleanupPolicy = newLibraryPanelError(errorCodeInvalid, "cleanup policy must have an action of archive or delete and a positive number of days")
+	// errLibraryPanelInvalidDatasourceRewrite is an error for when a datasource rewrite is missing the old or new datasource.
+	errLibraryPanelInvalidDatasourceRewrite = newLibraryPanelError(errorCodeInvalid, "datasource rewrite must have different from and to datasources")
+	// errLibraryPanelModelTooLarge is an error for when a library panel model is larger than the configured maximum.
+	errLibraryPanelModelTooLarge = newLibraryPanelError(errorCodeTooLarge, "library panel model is too large")
+	// errLibraryElementInvalidKind is an error for when a library element has an unknown kind.
+	errLibraryElementInvalidKind = newLibraryPanelError(errorCodeInvalid, "library element kind must be 1 (panel), 2 (variable), 3 (row), 4 (fragment), 5 (query) or 6 (transformation)")
+	// errLibraryPanelCollectionAlreadyExists is an error for when the user tries to add a collection that already exists.
+	errLibraryPanelCollectionAlreadyExists = newLibraryPanelError(errorCodeAlreadyExists, "library panel collection with that name already exists")
+	// errLibraryPanelCollectionNotFound is an error for when a library panel collection can't be found.
+	errLibraryPanelCollectionNotFound = newLibraryPanelError(errorCodeNotFound, "library panel collection could not be found")
+	// errLibraryPanelCollectionMemberNotFound is an error for when a library panel isn't in a collection.
+	errLibraryPanelCollectionMemberNotFound = newLibraryPanelError(errorCodeNotFound, "library panel is not in the collection")
+	// errLibraryPanelCollectionInvalidName is an error for when a library panel collection has no name.
+	errLibraryPanelCollectionInvalidName = newLibraryPanelError(errorCodeInvalid, "library panel collection must have a name")
+	// errLibraryPanelCatalogPanelAlreadyExists is an error for when the user tries to add a catalog panel that already exists.
+	errLibraryPanelCatalogPanelAlreadyExists = newLibraryPanelError(errorCodeAlreadyExists, "catalog panel with that name already exists")
+	// errLibraryPanelCatalogPanelNotFound is an error for when a catalog panel can't be found.
+	errLibraryPanelCatalogPanelNotFound = newLibraryPanelError(errorCodeNotFound, "catalog panel could not be found")
+	// errLibraryPanelLinked is an error for when the user tries to change the model of a library panel linked to the catalog.
+	errLibraryPanelLinked = newLibraryPanelError(errorCodeReadOnly, "library panel is linked to the catalog, its model can only be changed in the catalog")
+	// errLibraryPanelProvisioned is an error for when the user tries to change or delete a library panel synced from Git.
+	errLibraryPanelProvisioned = newLibraryPanelError(errorCodeReadOnly, "library panel is synced from a git repository and can only be changed in the repository")
+	// errLibraryPanelInvalidGitSync is an error for when a git sync configuration is incomplete or unsafe.
+	errLibraryPanelInvalidGitSync = newLibraryPanelError(errorCodeInvalid, "git sync must have an https or ssh repository, a branch, a relative path and an interval of at least a minute")
+	// errLibraryPanelInvalidStatus is an error for when a library panel has an unknown status.
+	errLibraryPanelInvalidStatus = newLibraryPanelError(errorCodeInvalid, "library panel status must be draft or published")
+	// errLibraryPanelPermissionDenied is an error for when the user can't edit a library panel.
+	errLibraryPanelPermissionDenied = newLibraryPanelError(errorCodePermissionDenied, "access denied to library panel")
+	// errLibraryPanelPendingChangeNotFound is an error for when a pending library panel change can't be found.
+	errLibraryPanelPendingChangeNotFound = newLibraryPanelError(errorCodeNotFound, "pending library panel change could not be found")
+	// errLibraryPanelInvalidReplacement is an error for when a deprecated library panel is replaced by itself or by an unknown library element.
+	errLibraryPanelInvalidReplacement = newLibraryPanelError(errorCodeInvalid, "library panel must be replaced by another library element of the same kind")
+	// errLibraryPanelCommentNotFound is an error for when a library panel comment can't be found.
+	errLibraryPanelCommentNotFound = newLibraryPanelError(errorCodeNotFound, "library panel comment could not be found")
+	// errLibraryPanelInvalidComment is an error for when a library panel comment is empty or too long.
+	errLibraryPanelInvalidComment = newLibraryPanelError(errorCodeInvalid, "library panel comment must not be empty or longer than 10000 characters")
+	// errLibraryPanelNotificationNotFound is an error for when a library panel notification can't be found.
+	errLibraryPanelNotificationNotFound = newLibraryPanelError(errorCodeNotFound, "library panel notification could not be found")
+	// errLibraryPanelAPIKeyNotFound is an error for when the API key of a library panel access can't be found.
+	errLibraryPanelAPIKeyNotFound = newLibraryPanelError(errorCodeNotFound, "API key could not be found")
+	// errLibraryPanelInvalidAPIKeyAccess is an error for when the library panel access of an API key is unknown.
+	errLibraryPanelInvalidAPIKeyAccess = newLibraryPanelError(errorCodeInvalid, "API key access must be read or write")
+	// errLibraryPanelReadOnlyAPIKey is an error for when a read only API key tries to change library panels.
+	errLibraryPanelReadOnlyAPIKey = newLibraryPanelError(errorCodePermissionDenied, "API key has read only access to library panels")
+	// errLibraryPanelRateLimited is an error for when a user or org changes Library Panels too often.
+	errLibraryPanelRateLimited = newLibraryPanelError(errorCodeRateLimited, "too many library panel changes, try again later")
+	// errLibraryPanelUserRequired is an error for when an API key uses a feature that needs a user.
+	errLibraryPanelUserRequired = newLibraryPanelError(errorCodePermissionDenied, "library panel stars, comments and notifications require a user")
+	// errLibraryPanelInvalidOwnershipTransfer is an error for when an ownership transfer is missing a user or has the same user twice.
+	errLibraryPanelInvalidOwnershipTransfer = newLibraryPanelError(errorCodeInvalid, "ownership transfer must have different from and to users")
+	// errLibraryPanelThumbnailNotFound is an error for when a library panel has no rendered thumbnail.
+	errLibraryPanelThumbnailNotFound = newLibraryPanelError(errorCodeNotFound, "library panel thumbnail could not be found")
+	// errLibraryPanelPreconditionFailed is an error for when the If-Match header doesn't match the ETag of a library panel.
+	errLibraryPanelPreconditionFailed = newLibraryPanelError(errorCodeVersionMismatch, "library panel has been changed since it was read")
+	// errLibraryPanelNameRequired is an error for when a name is checked without a name.
+	errLibraryPanelNameRequired = newLibraryPanelError(errorCodeInvalid, "library panel name must not be empty")
+	// errLibraryPanelUnknownFragment is an error for when a model references a library fragment that doesn't exist.
+	errLibraryPanelUnknownFragment = newLibraryPanelError(errorCodeInvalid, "library fragment could not be found")
+	// errLibraryPanelDependencyCycle is an error for when a library fragment would reference itself through other fragments.
+	errLibraryPanelDependencyCycle = newLibraryPanelError(errorCodeInvalid, "library fragment must not reference itself")
+	// errLibraryElementInUse is an error for when a library fragment, query or transformation that other library
+	// elements reference is deleted.
+	errLibraryElementInUse = newLibraryPanelError(errorCodeHasConnections, "library element is referenced by other library elements")
+	// errLibraryPanelBackupNotFound is an error for when a library panel backup doesn't exist.
+	errLibraryPanelBackupNotFound = newLibraryPanelError(errorCodeNotFound, "library panel backup could not be found")
+	// errLibraryPanelUnknownQuery is an error for when a model references a library query that doesn't exist.
+	errLibraryPanelUnknownQuery = newLibraryPanelError(errorCodeInvalid, "library query could not be found")
+	// errLibraryPanelNotAQuery is an error for when the versions of a library element that isn't a library query are requested.
+	errLibraryPanelNotAQuery = newLibraryPanelError(errorCodeInvalid, "library element is not a library query")
+	// errLibraryPanelUnknownTransformation is an error for when a model references a library transformation that doesn't exist.
+	errLibraryPanelUnknownTransformation = newLibraryPanelError(errorCodeInvalid, "library transformation could not be found")
+	// errLibraryPanelHasAlertRules is an error for when a library panel that alert rules were created from is deleted.
+	errLibraryPanelHasAlertRules = newLibraryPanelError(errorCodeHasConnections, "library panel has alert rules created from it")
+	// errLibraryPanelMissingTemplateInput is an error for when a panel template is instantiated without a value for an input.
+	errLibraryPanelMissingTemplateInput = newLibraryPanelError(errorCodeInvalid, "panel template input must have a value")
+	// errLibraryPanelCommunityPanelNotFound is an error for when a panel can't be found in the community registry.
+	errLibraryPanelCommunityPanelNotFound = newLibraryPanelError(errorCodeNotFound, "community panel could not be found")
+	// errLibraryPanelNotFromRegistry is an error for when a library panel that wasn't installed from the community registry is checked for updates.
+	errLibraryPanelNotFromRegistry = newLibraryPanelError(errorCodeInvalid, "library panel was not installed from the community registry")
+	// errLibraryPanelReplica is an error for when a replicated copy of a library panel is changed.
+	errLibraryPanelReplica = newLibraryPanelError(errorCodeReadOnly, "library panel is a replicated copy and can only be changed in the org it is replicated from")
+	// errLibraryPanelInvalidReplicationTarget is an error for when a library panel is replicated to an org that doesn't exist or to its own org.
+	errLibraryPanelInvalidReplicationTarget = newLibraryPanelError(errorCodeInvalid, "replication target orgs must exist and differ from the org of the library panel")
+	// errLibraryPanelInvalidPatch is an error for when a JSON Patch or JSON Merge Patch of a library panel can't be applied.
+	errLibraryPanelInvalidPatch = newLibraryPanelError(errorCodeInvalid, "library panel patch is invalid")
+	// errLibraryPanelPatchTestFailed is an error for when a test operation of a JSON Patch of a library panel fails.
+	errLibraryPanelPatchTestFailed = newLibraryPanelError(errorCodeVersionMismatch, "library panel patch test failed")
+	// errLibraryPanelInvalidModelPath is an error for when a model path to read has an empty key.
+	errLibraryPanelInvalidModelPath = newLibraryPanelError(errorCodeInvalid, "library panel model paths must be dot separated keys")
+	// errLibraryPanelInvalidEffectiveAt is an error for when a library panel change is scheduled at a time that isn't in the future.
+	errLibraryPanelInvalidEffectiveAt = newLibraryPanelError(errorCodeInvalid, "library panel change must be scheduled at a future RFC 3339 time")
+	// errLibraryPanelScheduleNeedsApproval is an error for when a change that needs approval is scheduled by a user who isn't an org admin.
+	errLibraryPanelScheduleNeedsApproval = newLibraryPanelError(errorCodePermissionDenied, "library panel change needs approval and can only be scheduled by an org admin")
+	// errLibraryPanelScheduledChangeNotFound is an error for when a scheduled library panel change can't be found.
+	errLibraryPanelScheduledChangeNotFound = newLibraryPanelError(errorCodeNotFound, "scheduled library panel change could not be found")
+	// errLibraryPanelVariantNotFound is an error for when a library panel has no experimental variant.
+	errLibraryPanelVariantNotFound = newLibraryPanelError(errorCodeNotFound, "library panel variant could not be found")
+	// errLibraryPanelInvalidVariant is an error for when an experimental variant isn't for a library panel, has a percentage out of range or unknown teams.
+	errLibraryPanelInvalidVariant = newLibraryPanelError(errorCodeInvalid, "library panel variant must be for a library panel, with a percentage from 0 to 100 and teams of the org")
+	// errLibraryPanelInvalidRepairMapping is an error for when a broken reference is mapped to a UID that isn't a library panel of the org.
+	errLibraryPanelInvalidRepairMapping = newLibraryPanelError(errorCodeInvalid, "broken references must be mapped to library panels of the org")
+	// errLibraryPanelFolderNotFound is an error for when the folder of a folder scoped route doesn't exist or can't be viewed.
+	errLibraryPanelFolderNotFound = newLibraryPanelError(errorCodeNotFound, "folder could not be found")
+	// errLibraryPanelDashboardOrgRequired is an error for when the library panels of a dashboard without an org are resolved by dashboard access.
+	errLibraryPanelDashboardOrgRequired = newLibraryPanelError(errorCodeInvalid, "dashboard must belong to an org to resolve its library panels")
+	// errLibraryPanelInvalidSnippet is an error for when a panel snippet is requested for a library element that isn't a library panel.
+	errLibraryPanelInvalidSnippet = newLibraryPanelError(errorCodeInvalid, "only library panels can be exported as dashboard panels")
+	// errLibraryPanelInvalidBulkTag is an error for when a bulk tag change has no tag, a tag that is too long, or neither UIDs nor a filter.
+	errLibraryPanelInvalidBulkTag = newLibraryPanelError(errorCodeInvalid, "bulk tag change must have a tag of at most 50 characters and uids or a folderId or tag filter")
+	// errLibraryPanelInvalidOwnerTeam is an error for when a library panel is owned by a team that isn't a team of the org.
+	errLibraryPanelInvalidOwnerTeam = newLibraryPanelError(errorCodeInvalid, "library panel owner must be a team of the org")
+	// errLibraryPanelInvalidOwnedBy is an error for when the ownedBy filter isn't of the form team:<id>.
+	errLibraryPanelInvalidOwnedBy = newLibraryPanelError(errorCodeInvalid, "ownedBy must be of the form team:<id>")
+	// errLibraryPanelEditSuggestionNotFound is an error for when a pending edit suggestion can't be found.
+	errLibraryPanelEditSuggestionNotFound = newLibraryPanelError(errorCodeNotFound, "library panel edit suggestion could not be found")
+	// errLibraryPanelInvalidEditSuggestion is an error for when an edit suggestion has no model or a too long comment.
+	errLibraryPanelInvalidEditSuggestion = newLibraryPanelError(errorCodeInvalid, "library panel edit suggestion must have a model and a comment of at most 10000 characters")
+	// errLibraryPanelInvalidFeedFormat is an error for when the change feed is requested in an unknown format.
+	errLibraryPanelInvalidFeedFormat = newLibraryPanelError(errorCodeInvalid, "library panel feed format must be atom or rss")
+	// errLibraryPanelInvalidMerge is an error for when a library panel is merged into itself or with a library element that isn't a library panel.
+	errLibraryPanelInvalidMerge = newLibraryPanelError(errorCodeInvalid, "library panel must be merged into another library panel")
+	// errLibraryPanelTranslationNotFound is an error for when a library panel has no translation for a locale.
+	errLibraryPanelTranslationNotFound = newLibraryPanelError(errorCodeNotFound, "library panel translation could not be found")
+	// errLibraryPanelInvalidTranslation is an error for when a library panel translation has an invalid locale, a too long name or neither a name nor a description.
+	errLibraryPanelInvalidTranslation = newLibraryPanelError(errorCodeInvalid, "library panel translation must have a language tag as locale and a name or description")
+	// errLibraryPanelConnectedDashboardNotFound is an error for when a library panel is connected to a dashboard that
+	// doesn't exist in its org.
+	errLibraryPanelConnectedDashboardNotFound = newLibraryPanelError(errorCodeNotFound, "dashboard could not be found")
+	// errLibraryPanelTooManyDashboards is an error for when a library panel is connected to the MaxDashboardsPerPanel.
+	errLibraryPanelTooManyDashboards = newLibraryPanelError(errorCodeQuotaExceeded, "library panel is connected to the maximum number of dashboards")
+	// errLibraryPanelTooManyConnections is an error for when a dashboard has the MaxConnectionsPerDashboard.
+	errLibraryPanelTooManyConnections = newLibraryPanelError(errorCodeQuotaExceeded, "dashboard is connected to the maximum number of library panels")
+	// errLibraryPanelInvalidVariableDefaults is an error for when a variable default has a name placeholders can't use.
+	errLibraryPanelInvalidVariableDefaults = newLibraryPanelError(errorCodeInvalid, "variable names must start with a letter or underscore and contain only letters, digits and underscores")
 )
 
+// Queries
+
+// getAllLibraryPanelsQuery is the query for listing LibraryPanels.
+type getAllLibraryPanelsQuery struct {
+	// Datasource, if set, limits the result to panels whose model uses that datasource.
+	Datasource string
+	// Kind is the kind of library elements to list, Library Panels if not set.
+	Kind libraryElementKind
+	// Status, if set, limits the result to draft or published panels.
+	Status string
+	// Starred, if set, limits the result to the panels the user starred.
+	Starred bool
+	// IncludeModel includes the models of the panels in the result.
+	IncludeModel bool
+	// FolderID, if set, limits the result to the panels in that folder, 0 being the General folder.
+	FolderID *int64
+	// IncludeSubfolders also includes the panels in the descendant folders of FolderID.
+	IncludeSubfolders bool
+	// OwnedBy, if set, limits the result to the panels owned by a team, given as team:<id>.
+	OwnedBy string
+}
+
+// nameExistsQuery is the query for checking if a name is taken in a folder.
+type nameExistsQuery struct {
+	Name     string
+	FolderID int64
+	// Kind is the kind of library elements the name has to be unique for, Library Panels if not set.
+	Kind libraryElementKind
+	// UID, if set, is the library element being renamed, which doesn't count.
+	UID string
+}
+
 // Commands
 
 // createLibraryPanelCommand is the command for adding a LibraryPanel
 type createLibraryPanelCommand struct {
-	FolderID int64           `json:"folderId"`
-	Name     string          `json:"name"`
-	Model    json.RawMessage `json:"model"`
+	// FolderID is the folder of the LibraryPanel, the default folder of the org if not set.
+	FolderID *int64             `json:"folderId"`
+	Name     string             `json:"name"`
+	Kind     libraryElementKind `json:"kind"`
+	Model    json.RawMessage    `json:"model"`
+	Tags     []string           `json:"tags"`
+	// Status is draft or published, published if not set.
+	Status string `json:"status"`
+	// OwnerTeamID is the team that owns the LibraryPanel, no team if not set.
+	OwnerTeamID int64 `json:"ownerTeamId"`
+
+	// CatalogUID is set when a catalog panel is installed as a linked reference.
+	CatalogUID string `json:"-"`
+	// RegistrySource and RegistryRevision are set when a community registry panel is installed.
+	RegistrySource   string `json:"-"`
+	RegistryRevision int64  `json:"-"`
 }
 
 // patchLibraryPanelCommand is the command for patching a LibraryPanel
@@ -56,4 +368,7 @@ type patchLibraryPanelCommand struct {
 	FolderID int64           `json:"folderId"`
 	Name     string          `json:"name"`
 	Model    json.RawMessage `json:"model"`
+	Tags     []string        `json:"tags"`
+	// OwnerTeamID, if set, changes the team that owns the LibraryPanel, 0 for no team.
+	OwnerTeamID *int64 `json:"ownerTeamId,omitempty"`
 }
@@ -0,0 +1,105 @@
+package librarypanels
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"reflect"
+	"sort"
+)
+
+// volatilePanelKeys are the properties of panel models that belong to the placement of the panel in a dashboard,
+// or that are added when a dashboard is loaded, rather than to the Library Panel.
+var volatilePanelKeys = []string{"id", "gridPos", "libraryPanel"}
+
+// defaultPanelValues are the values the frontend uses for panel properties that aren't set.
+var defaultPanelValues = map[string]interface{}{
+	"description": "",
+	"links":       []interface{}{},
+	"transparent": false,
+	"repeat":      "",
+}
+
+// normalizeModel returns the canonical JSON of a library element model, so that models that only differ in
+// serialization are stored the same: keys are sorted, whitespace is removed and, for panels, the volatile
+// properties and the properties with default values are dropped. Models that aren't JSON objects are returned
+// as they are, for the validation to report.
+func normalizeModel(kind libraryElementKind, model json.RawMessage) json.RawMessage {
+	var object map[string]interface{}
+	decoder := json.NewDecoder(bytes.NewReader(model))
+	decoder.UseNumber()
+	if err := decoder.Decode(&object); err != nil || object == nil {
+		return model
+	}
+
+	if kind == panelElement {
+		for _, key := range volatilePanelKeys {
+			delete(object, key)
+		}
+		for key, value := range object {
+			if defaultValue, ok := defaultPanelValues[key]; value == nil || (ok && reflect.DeepEqual(value, defaultValue)) {
+				delete(object, key)
+			}
+		}
+	}
+
+	normalized, err := canonicalJSON(object)
+	if err != nil {
+		return model
+	}
+
+	return normalized
+}
+
+// normalizeLibraryPanelModels normalizes the models of Library Panels that were read, so models stored before
+// they were normalized, or changed by a schema upgrade, are returned the same as if they were saved now.
+func normalizeLibraryPanelModels(libraryPanels []LibraryPanel) {
+	for i := range libraryPanels {
+		if libraryPanels[i].Model != nil {
+			libraryPanels[i].Model = normalizeModel(libraryPanels[i].Kind, libraryPanels[i].Model)
+		}
+	}
+}
+
+// libraryPanelFingerprint returns the SHA-256 of the properties of the Library Panel that its users set: the
+// folder, name, kind, status, sorted tags and normalized model. Unlike the ETag it doesn't change with updates
+// that change none of them, so tools managing Library Panels can compare it to detect drift.
+func libraryPanelFingerprint(panel LibraryPanel) string {
+	tags := append([]string{}, panel.Tags...)
+	sort.Strings(tags)
+
+	var model interface{}
+	decoder := json.NewDecoder(bytes.NewReader(normalizeModel(panel.Kind, panel.Model)))
+	decoder.UseNumber()
+	if err := decoder.Decode(&model); err != nil {
+		model = string(panel.Model)
+	}
+	fingerprinted, err := canonicalJSON(map[string]interface{}{
+		"folderId": panel.FolderID,
+		"name":     panel.Name,
+		"kind":     panel.Kind,
+		"status":   panel.Status,
+		"tags":     tags,
+		"model":    model,
+	})
+	if err != nil {
+		return ""
+	}
+
+	hash := sha256.Sum256(fingerprinted)
+	return hex.EncodeToString(hash[:])
+}
+
+// canonicalJSON returns the JSON of the value with sorted keys and without whitespace. Unlike json.Marshal it
+// doesn't escape HTML, so the models of text panels stay readable.
+func canonicalJSON(value interface{}) (json.RawMessage, error) {
+	var buffer bytes.Buffer
+	encoder := json.NewEncoder(&buffer)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(value); err != nil {
+		return nil, err
+	}
+
+	return bytes.TrimSuffix(buffer.Bytes(), []byte("\n")), nil
+}
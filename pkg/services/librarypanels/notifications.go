@@ -0,0 +1,266 @@
+package librarypanels
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/sqlstore"
+	"github.com/grafana/grafana/pkg/util"
+)
+
+// maxNotifications is the number of the latest notifications that are listed.
+const maxNotifications = 100
+
+// libraryPanelNotification notifies a dashboard owner of a change to a Library Panel used in their dashboards.
+type libraryPanelNotification struct {
+	ID               int64     `json:"id" xorm:"pk autoincr 'id'"`
+	OrgID            int64     `json:"-" xorm:"org_id"`
+	UserID           int64     `json:"-" xorm:"user_id"`
+	LibraryPanelID   int64     `json:"-" xorm:"librarypanel_id"`
+	LibraryPanelUID  string    `json:"libraryPanelUid" xorm:"<- librarypanel_uid"`
+	LibraryPanelName string    `json:"libraryPanelName" xorm:"<- librarypanel_name"`
+	Summary          string    `json:"summary"`
+	Seen             bool      `json:"seen"`
+	Created          time.Time `json:"created"`
+}
+
+// libraryPanelNotificationMute mutes the notifications of a user for a Library Panel, or for all Library Panels
+// in the org if LibraryPanelID is 0.
+type libraryPanelNotificationMute struct {
+	ID             int64 `xorm:"pk autoincr 'id'"`
+	OrgID          int64 `xorm:"org_id"`
+	UserID         int64 `xorm:"user_id"`
+	LibraryPanelID int64 `xorm:"librarypanel_id"`
+}
+
+// notificationMutes are the notification mute settings of a user.
+type notificationMutes struct {
+	All              bool     `json:"all"`
+	LibraryPanelUIDs []string `json:"libraryPanelUids"`
+}
+
+// notificationRecipient is the owner of a dashboard connected to a changed Library Panel.
+type notificationRecipient struct {
+	UserID         int64  `xorm:"user_id"`
+	Login          string `xorm:"login"`
+	Email          string `xorm:"email"`
+	Name           string `xorm:"name"`
+	DashboardTitle string `xorm:"dashboard_title"`
+}
+
+// recipientDashboards is a user to notify with the titles of their dashboards connected to the Library Panel.
+type recipientDashboards struct {
+	notificationRecipient
+	dashboardTitles []string
+}
+
+// libraryPanelChanges returns the names of the properties that are different in the updated Library Panel,
+// in a fixed order.
+func libraryPanelChanges(before LibraryPanel, after LibraryPanel) []string {
+	var changes []string
+	if before.Name != after.Name {
+		changes = append(changes, "name")
+	}
+	if before.FolderID != after.FolderID {
+		changes = append(changes, "folder")
+	}
+	if !bytes.Equal(before.Model, after.Model) {
+		changes = append(changes, "model")
+	}
+	if strings.Join(before.Tags, ",") != strings.Join(after.Tags, ",") {
+		changes = append(changes, "tags")
+	}
+
+	return changes
+}
+
+// notifyLibraryPanelChanged notifies the creators and last editors of the dashboards connected to a Library
+// Panel that it changed, except the user who changed it and users who muted the notifications. If emails are
+// enabled the notifications are sent by email too. Notifications are best effort, failures are logged.
+func (lps *LibraryPanelService) notifyLibraryPanelChanged(c *models.ReqContext, panel LibraryPanel, changes []string) {
+	if len(changes) == 0 {
+		return
+	}
+
+	recipients, err := lps.getNotificationRecipients(c.SignedInUser, panel)
+	if err != nil {
+		lps.log.Warn("Failed to get the users to notify of library panel change", "uid", panel.UID, "error", err)
+		return
+	}
+
+	changedBy := util.StringsFallback3(c.SignedInUser.Name, c.SignedInUser.Login, c.SignedInUser.Email)
+	now := time.Now()
+	for _, recipient := range recipients {
+		dashboards := recipient.dashboardTitles
+		summary := fmt.Sprintf("%s changed the %s of library panel %s, used in %s", changedBy, strings.Join(changes, ", "),
+			panel.Name, strings.Join(dashboards, ", "))
+		notification := libraryPanelNotification{
+			OrgID:          panel.OrgID,
+			UserID:         recipient.UserID,
+			LibraryPanelID: panel.ID,
+			Summary:        summary,
+			Created:        now,
+		}
+		err := lps.SQLStore.WithDbSession(context.Background(), func(session *sqlstore.DBSession) error {
+			_, err := session.Table("library_panel_notification").Insert(&notification)
+			return err
+		})
+		if err != nil {
+			lps.log.Warn("Failed to notify of library panel change", "uid", panel.UID, "userId", recipient.UserID, "error", err)
+			continue
+		}
+
+		if !lps.Cfg.LibraryPanels.ChangeEmails || !util.IsEmail(recipient.Email) {
+			continue
+		}
+		emailCmd := models.SendEmailCommand{
+			To:       []string{recipient.Email},
+			Template: "library_panel_changed.html",
+			Data: map[string]interface{}{
+				"Name":             util.StringsFallback2(recipient.Name, recipient.Login),
+				"ChangedBy":        changedBy,
+				"LibraryPanelName": panel.Name,
+				"Changes":          strings.Join(changes, ", "),
+				"Dashboards":       dashboards,
+			},
+		}
+		if err := bus.Dispatch(&emailCmd); err != nil {
+			lps.log.Warn("Failed to send library panel change email", "uid", panel.UID, "userId", recipient.UserID, "error", err)
+		}
+	}
+}
+
+// getNotificationRecipients gets the creators and last editors of the dashboards connected to a Library Panel,
+// except the user and the users who muted notifications for the Library Panel, ordered by user ID.
+func (lps *LibraryPanelService) getNotificationRecipients(user *models.SignedInUser, panel LibraryPanel) ([]recipientDashboards, error) {
+	var rows []notificationRecipient
+	err := lps.SQLStore.WithReadReplicaDbSession(context.Background(), func(session *sqlstore.DBSession) error {
+		u := lps.SQLStore.Dialect.Quote("user")
+		return session.SQL(`SELECT DISTINCT `+u+`.id AS user_id, `+u+`.login, `+u+`.email, `+u+`.name, dashboard.title AS dashboard_title
+			FROM library_panel_dashboard
+			INNER JOIN dashboard ON dashboard.id = library_panel_dashboard.dashboard_id
+			INNER JOIN `+u+` ON `+u+`.id = dashboard.created_by OR `+u+`.id = dashboard.updated_by
+			WHERE library_panel_dashboard.librarypanel_id=? AND dashboard.org_id=? AND `+u+`.id<>?
+			AND NOT EXISTS (SELECT 1 FROM library_panel_notification_mute
+				WHERE library_panel_notification_mute.org_id=? AND library_panel_notification_mute.user_id = `+u+`.id
+				AND library_panel_notification_mute.librarypanel_id IN (0, ?))`,
+			panel.ID, panel.OrgID, user.UserId, panel.OrgID, panel.ID).Find(&rows)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	byUser := make(map[int64]*recipientDashboards)
+	for _, row := range rows {
+		recipient, ok := byUser[row.UserID]
+		if !ok {
+			recipient = &recipientDashboards{notificationRecipient: row}
+			byUser[row.UserID] = recipient
+		}
+		recipient.dashboardTitles = append(recipient.dashboardTitles, row.DashboardTitle)
+	}
+
+	recipients := make([]recipientDashboards, 0, len(byUser))
+	for _, recipient := range byUser {
+		sort.Strings(recipient.dashboardTitles)
+		recipients = append(recipients, *recipient)
+	}
+	sort.Slice(recipients, func(i, j int) bool { return recipients[i].UserID < recipients[j].UserID })
+
+	return recipients, nil
+}
+
+// getNotifications gets the latest notifications of the user in the org, newest first.
+func (lps *LibraryPanelService) getNotifications(c *models.ReqContext) ([]libraryPanelNotification, error) {
+	notifications := make([]libraryPanelNotification, 0)
+	err := lps.SQLStore.WithReadReplicaDbSession(context.Background(), func(session *sqlstore.DBSession) error {
+		return session.SQL(`SELECT library_panel_notification.*, library_panel.uid AS librarypanel_uid, library_panel.name AS librarypanel_name
+			FROM library_panel_notification
+			INNER JOIN library_panel ON library_panel.id = library_panel_notification.librarypanel_id
+			WHERE library_panel_notification.org_id=? AND library_panel_notification.user_id=?
+			ORDER BY library_panel_notification.created DESC, library_panel_notification.id DESC`+lps.SQLStore.Dialect.Limit(maxNotifications),
+			c.SignedInUser.OrgId, c.SignedInUser.UserId).Find(&notifications)
+	})
+
+	return notifications, err
+}
+
+// markNotificationSeen marks a notification of the user as seen.
+func (lps *LibraryPanelService) markNotificationSeen(c *models.ReqContext, id int64) error {
+	return lps.SQLStore.WithDbSession(context.Background(), func(session *sqlstore.DBSession) error {
+		result, err := session.Exec("UPDATE library_panel_notification SET seen="+lps.SQLStore.Dialect.BooleanStr(true)+" WHERE id=? AND org_id=? AND user_id=?",
+			id, c.SignedInUser.OrgId, c.SignedInUser.UserId)
+		if err != nil {
+			return err
+		}
+
+		if rowsAffected, err := result.RowsAffected(); err != nil {
+			return err
+		} else if rowsAffected == 0 {
+			return errLibraryPanelNotificationNotFound
+		}
+
+		return nil
+	})
+}
+
+// getNotificationMutes gets the notification mute settings of the user in the org.
+func (lps *LibraryPanelService) getNotificationMutes(c *models.ReqContext) (notificationMutes, error) {
+	mutes := notificationMutes{LibraryPanelUIDs: make([]string, 0)}
+	err := lps.SQLStore.WithReadReplicaDbSession(context.Background(), func(session *sqlstore.DBSession) error {
+		all, err := session.Where("org_id=? AND user_id=? AND librarypanel_id=0", c.SignedInUser.OrgId, c.SignedInUser.UserId).
+			Count(&libraryPanelNotificationMute{})
+		if err != nil {
+			return err
+		}
+		mutes.All = all > 0
+
+		return session.SQL(`SELECT library_panel.uid FROM library_panel_notification_mute
+			INNER JOIN library_panel ON library_panel.id = library_panel_notification_mute.librarypanel_id
+			WHERE library_panel_notification_mute.org_id=? AND library_panel_notification_mute.user_id=?
+			ORDER BY library_panel.uid ASC`, c.SignedInUser.OrgId, c.SignedInUser.UserId).Find(&mutes.LibraryPanelUIDs)
+	})
+
+	return mutes, err
+}
+
+// setNotificationMute mutes or unmutes the notifications of the user for a Library Panel, or for all Library
+// Panels if the uid is empty. Muting muted notifications does nothing.
+func (lps *LibraryPanelService) setNotificationMute(c *models.ReqContext, uid string, muted bool) error {
+	if err := checkSignedInUser(c.SignedInUser); err != nil {
+		return err
+	}
+
+	var libraryPanelID int64
+	if uid != "" {
+		libraryPanel, err := lps.getLibraryPanel(c, uid)
+		if err != nil {
+			return err
+		}
+		libraryPanelID = libraryPanel.ID
+	}
+
+	return lps.SQLStore.WithTransactionalDbSession(context.Background(), func(session *sqlstore.DBSession) error {
+		if !muted {
+			_, err := session.Exec("DELETE FROM library_panel_notification_mute WHERE org_id=? AND user_id=? AND librarypanel_id=?",
+				c.SignedInUser.OrgId, c.SignedInUser.UserId, libraryPanelID)
+			return err
+		}
+
+		mute := libraryPanelNotificationMute{OrgID: c.SignedInUser.OrgId, UserID: c.SignedInUser.UserId, LibraryPanelID: libraryPanelID}
+		count, err := session.Where("org_id=? AND user_id=? AND librarypanel_id=?", mute.OrgID, mute.UserID, mute.LibraryPanelID).
+			Count(&libraryPanelNotificationMute{})
+		if err != nil || count > 0 {
+			return err
+		}
+
+		_, err = session.Insert(&mute)
+		return err
+	})
+}
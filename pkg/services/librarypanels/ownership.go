@@ -0,0 +1,121 @@
+package librarypanels
+
+import (
+	"context"
+	"strings"
+
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/events"
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/sqlstore"
+)
+
+// ownershipTransferBatchSize is how many Library Panels are reassigned per transaction.
+const ownershipTransferBatchSize = 500
+
+// transferOwnershipCommand is the command for reassigning the Library Panels of a user to another user.
+type transferOwnershipCommand struct {
+	FromUserID int64 `json:"fromUserId"`
+	ToUserID   int64 `json:"toUserId"`
+}
+
+// ownershipTransferResult is the number of Library Panels that were reassigned.
+type ownershipTransferResult struct {
+	LibraryPanels int64 `json:"libraryPanels"`
+}
+
+// transferOwnership reassigns created_by and updated_by of the Library Panels in all orgs from one user to
+// another, in transactions of batchSize Library Panels. The from user doesn't have to exist anymore, so
+// author IDs left behind by deleted users can be fixed.
+func (lps *LibraryPanelService) transferOwnership(cmd transferOwnershipCommand, batchSize int) (ownershipTransferResult, error) {
+	result := ownershipTransferResult{}
+	if cmd.FromUserID <= 0 || cmd.ToUserID <= 0 || cmd.FromUserID == cmd.ToUserID {
+		return result, errLibraryPanelInvalidOwnershipTransfer
+	}
+	if err := bus.Dispatch(&models.GetUserByIdQuery{Id: cmd.ToUserID}); err != nil {
+		return result, err
+	}
+
+	for {
+		var ids []int64
+		err := lps.SQLStore.WithTransactionalDbSession(context.Background(), func(session *sqlstore.DBSession) error {
+			if err := session.SQL("SELECT id FROM library_panel WHERE created_by=? OR updated_by=? ORDER BY id"+
+				lps.SQLStore.Dialect.Limit(int64(batchSize)), cmd.FromUserID, cmd.FromUserID).Find(&ids); err != nil {
+				return err
+			}
+			if len(ids) == 0 {
+				return nil
+			}
+
+			in := "(?" + strings.Repeat(",?", len(ids)-1) + ")"
+			for _, column := range []string{"created_by", "updated_by"} {
+				sqlOrArgs := []interface{}{"UPDATE library_panel SET " + column + "=? WHERE " + column + "=? AND id IN " + in, cmd.ToUserID, cmd.FromUserID}
+				for _, id := range ids {
+					sqlOrArgs = append(sqlOrArgs, id)
+				}
+				if _, err := session.Exec(sqlOrArgs...); err != nil {
+					return err
+				}
+			}
+
+			return nil
+		})
+		if err != nil {
+			return result, err
+		}
+
+		result.LibraryPanels += int64(len(ids))
+		if len(ids) < batchSize {
+			return result, nil
+		}
+	}
+}
+
+// handleUserDeleted reassigns the Library Panels of a deleted user to the configured fallback author. Without
+// a fallback author the Library Panels keep the ID of the deleted user, and are listed by
+// getLibraryPanelsWithMissingAuthors.
+func (lps *LibraryPanelService) handleUserDeleted(event *events.UserDeleted) error {
+	if lps.Cfg.LibraryPanels.FallbackAuthor == "" {
+		return nil
+	}
+
+	query := models.GetUserByLoginQuery{LoginOrEmail: lps.Cfg.LibraryPanels.FallbackAuthor}
+	if err := bus.Dispatch(&query); err != nil {
+		lps.log.Warn("Failed to find the fallback author of library panels", "login", lps.Cfg.LibraryPanels.FallbackAuthor, "error", err)
+		return nil
+	}
+	if query.Result.Id == event.Id {
+		lps.log.Warn("The fallback author of library panels was deleted", "login", lps.Cfg.LibraryPanels.FallbackAuthor)
+		return nil
+	}
+
+	result, err := lps.transferOwnership(transferOwnershipCommand{FromUserID: event.Id, ToUserID: query.Result.Id}, ownershipTransferBatchSize)
+	if err != nil {
+		return err
+	}
+	if result.LibraryPanels > 0 {
+		lps.log.Info("Reassigned the library panels of a deleted user", "userId", event.Id, "fallbackUserId", query.Result.Id, "libraryPanels", result.LibraryPanels)
+	}
+
+	return nil
+}
+
+// getLibraryPanelsWithMissingAuthors gets the Library Panels in the org that were created or last updated by a
+// user that doesn't exist anymore. Library Panels written by Grafana itself, like synced ones, are ignored.
+func (lps *LibraryPanelService) getLibraryPanelsWithMissingAuthors(c *models.ReqContext) ([]LibraryPanel, error) {
+	libraryPanels := make([]LibraryPanel, 0)
+	err := lps.SQLStore.WithReadReplicaDbSession(context.Background(), func(session *sqlstore.DBSession) error {
+		user := lps.SQLStore.Dialect.Quote("user")
+		if err := session.SQL(`SELECT * FROM library_panel WHERE org_id=? AND (
+			(created_by > 0 AND NOT EXISTS (SELECT 1 FROM `+user+` WHERE `+user+`.id = library_panel.created_by)) OR
+			(updated_by > 0 AND NOT EXISTS (SELECT 1 FROM `+user+` WHERE `+user+`.id = library_panel.updated_by)))
+			ORDER BY name ASC`, c.SignedInUser.OrgId).Find(&libraryPanels); err != nil {
+			return err
+		}
+
+		upgradeLibraryPanelModels(libraryPanels)
+		return loadLibraryPanelTags(session, libraryPanels)
+	})
+
+	return libraryPanels, err
+}
@@ -0,0 +1,97 @@
+package librarypanels
+
+import (
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/sqlstore"
+	"github.com/grafana/grafana/pkg/services/sqlstore/migrator"
+	"github.com/grafana/grafana/pkg/services/sqlstore/permissions"
+)
+
+// checkCanEditLibraryPanel returns errLibraryPanelPermissionDenied if the user can't edit the Library Panel,
+// or errLibraryPanelNotFound if the Library Panel is a draft the user can't see. The service methods check
+// permissions themselves, so they don't depend on the middleware of the routes that call them.
+func checkCanEditLibraryPanel(session *sqlstore.DBSession, dialect migrator.Dialect, user *models.SignedInUser, panel LibraryPanel) error {
+	canEdit, err := canEditLibraryPanel(session, dialect, user, panel.ID)
+	if err != nil {
+		return err
+	}
+	if !canEdit {
+		if panel.Status == statusDraft && panel.CreatedBy != user.UserId {
+			return errLibraryPanelNotFound
+		}
+		return errLibraryPanelPermissionDenied
+	}
+
+	return nil
+}
+
+// checkCanViewLibraryPanel returns errLibraryPanelNotFound if the user can't view the folder of the Library Panel,
+// or if the Library Panel is a draft of another user they can't edit.
+func checkCanViewLibraryPanel(session *sqlstore.DBSession, dialect migrator.Dialect, user *models.SignedInUser, panel LibraryPanel) error {
+	if panel.Status == statusDraft && panel.CreatedBy != user.UserId {
+		if err := checkCanEditLibraryPanel(session, dialect, user, panel); err != nil {
+			return errLibraryPanelNotFound
+		}
+		return nil
+	}
+
+	builder := sqlstore.SQLBuilder{}
+	builder.Write("SELECT COUNT(*) FROM library_panel WHERE library_panel.id=?", panel.ID)
+	writePermissionFilter(&builder, dialect, user, models.PERMISSION_VIEW)
+
+	var count int64
+	if _, err := session.SQL(builder.GetSQLString(), builder.GetParams()...).Get(&count); err != nil {
+		return err
+	}
+	if count == 0 {
+		return errLibraryPanelNotFound
+	}
+
+	return nil
+}
+
+// checkCanEditFolder returns errLibraryPanelPermissionDenied if the user can't add Library Panels to the folder.
+// Editors can add Library Panels to the General folder.
+func checkCanEditFolder(session *sqlstore.DBSession, dialect migrator.Dialect, user *models.SignedInUser, folderID int64) error {
+	switch {
+	case user.OrgRole == models.ROLE_ADMIN:
+		return nil
+	case user.OrgRole == models.ROLE_VIEWER:
+		return errLibraryPanelPermissionDenied
+	case folderID == 0:
+		return nil
+	}
+
+	return checkCanEditDashboard(session, dialect, user, folderID)
+}
+
+// checkCanEditDashboard returns errLibraryPanelPermissionDenied if the user can't edit the dashboard or folder.
+// The permissions of the dashboard and its folder decide rather than the role, so viewers with the Edit
+// permission on a dashboard can edit it and editors with only the View permission can't.
+func checkCanEditDashboard(session *sqlstore.DBSession, dialect migrator.Dialect, user *models.SignedInUser, dashboardID int64) error {
+	if user.OrgRole == models.ROLE_ADMIN {
+		return nil
+	}
+
+	filter := permissions.DashboardPermissionFilter{
+		OrgRole:         user.OrgRole,
+		Dialect:         dialect,
+		UserId:          user.UserId,
+		OrgId:           user.OrgId,
+		PermissionLevel: models.PERMISSION_EDIT,
+	}
+	builder := sqlstore.SQLBuilder{}
+	builder.Write("SELECT COUNT(*) FROM dashboard WHERE dashboard.id=? AND dashboard.org_id=?", dashboardID, user.OrgId)
+	filterSQL, params := filter.Where()
+	builder.Write(" AND "+filterSQL, params...)
+
+	var count int64
+	if _, err := session.SQL(builder.GetSQLString(), builder.GetParams()...).Get(&count); err != nil {
+		return err
+	}
+	if count == 0 {
+		return errLibraryPanelPermissionDenied
+	}
+
+	return nil
+}
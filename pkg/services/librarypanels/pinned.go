@@ -0,0 +1,30 @@
+package librarypanels
+
+import (
+	"context"
+
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/sqlstore"
+)
+
+// setLibraryPanelPinned pins a Library Panel, which exempts it from the automated cleanups, or unpins it.
+// Replicated copies can't be pinned, they follow the Library Panel they are replicated from.
+func (lps *LibraryPanelService) setLibraryPanelPinned(c *models.ReqContext, uid string, pinned bool) (LibraryPanel, error) {
+	var libraryPanel LibraryPanel
+	err := lps.SQLStore.WithTransactionalDbSession(context.Background(), func(session *sqlstore.DBSession) error {
+		var err error
+		libraryPanel, err = getLibraryPanel(session, uid, c.SignedInUser.OrgId)
+		if err != nil {
+			return err
+		}
+		if libraryPanel.ReplicaOf != 0 {
+			return errLibraryPanelReplica
+		}
+
+		libraryPanel.Pinned = pinned
+		_, err = session.ID(libraryPanel.ID).Cols("pinned").Update(&libraryPanel)
+		return err
+	})
+
+	return libraryPanel, err
+}
@@ -0,0 +1,210 @@
+package librarypanels
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/plugins"
+	"github.com/grafana/grafana/pkg/services/sqlstore"
+)
+
+// pluginIncludeLibraryPanel is the type of the plugin includes that ship a Library Panel model.
+const pluginIncludeLibraryPanel = "library-panel"
+
+// handlePluginStateChanged adds the Library Panels shipped by an app plugin when it's enabled in an org,
+// and removes them when it's disabled.
+func (lps *LibraryPanelService) handlePluginStateChanged(event *models.PluginStateChangedEvent) error {
+	if !event.Enabled {
+		return lps.removePluginLibraryPanels(event.OrgId, event.PluginId)
+	}
+
+	plugin, exists := plugins.Plugins[event.PluginId]
+	if !exists {
+		return nil
+	}
+
+	return lps.syncPluginLibraryPanels(event.OrgId, plugin)
+}
+
+// pluginLibraryPanel is a Library Panel read from a plugin include.
+type pluginLibraryPanel struct {
+	name  string
+	model json.RawMessage
+}
+
+func (lps *LibraryPanelService) readPluginLibraryPanels(plugin *plugins.PluginBase) (map[string]pluginLibraryPanel, error) {
+	libraryPanels := make(map[string]pluginLibraryPanel)
+	for _, include := range plugin.Includes {
+		if include.Type != pluginIncludeLibraryPanel {
+			continue
+		}
+
+		path := filepath.Clean(include.Path)
+		if filepath.IsAbs(path) || strings.HasPrefix(path, "..") {
+			return nil, fmt.Errorf("library panel include %q is outside of the plugin directory", include.Path)
+		}
+		// #nosec G304 -- the path is inside the plugin directory
+		model, err := ioutil.ReadFile(filepath.Join(plugin.PluginDir, path))
+		if err != nil {
+			return nil, err
+		}
+		model = normalizeModel(panelElement, model)
+		if err := validateModel(model, lps.Cfg.LibraryPanels); err != nil {
+			return nil, fmt.Errorf("invalid library panel in %s: %w", include.Path, err)
+		}
+
+		name := include.Name
+		if name == "" {
+			name = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+		}
+		libraryPanels[filepath.ToSlash(path)] = pluginLibraryPanel{name: name, model: model}
+	}
+
+	return libraryPanels, nil
+}
+
+// syncPluginLibraryPanels makes the Library Panels of the plugin in the org match its includes. Orphaned
+// Library Panels of the plugin are adopted again by name.
+func (lps *LibraryPanelService) syncPluginLibraryPanels(orgID int64, plugin *plugins.PluginBase) error {
+	included, err := lps.readPluginLibraryPanels(plugin)
+	if err != nil {
+		return err
+	}
+
+	err = lps.SQLStore.WithTransactionalDbSession(context.Background(), func(session *sqlstore.DBSession) error {
+		var existing []LibraryPanel
+		if err := session.Table("library_panel").Where("org_id=? AND plugin_id=?", orgID, plugin.Id).Find(&existing); err != nil {
+			return err
+		}
+		byPath := make(map[string]LibraryPanel, len(existing))
+		orphanedByName := make(map[string]LibraryPanel)
+		for _, panel := range existing {
+			if panel.PluginPath == "" {
+				orphanedByName[panel.Name] = panel
+			} else {
+				byPath[panel.PluginPath] = panel
+			}
+		}
+
+		for path, pluginPanel := range included {
+			panel, exists := byPath[path]
+			if !exists {
+				panel, exists = orphanedByName[pluginPanel.name]
+			}
+			delete(byPath, path)
+
+			if exists && panel.PluginPath == path && panel.Name == pluginPanel.name && jsonEqual(panel.Model, pluginPanel.model) {
+				continue
+			}
+
+			now := time.Now()
+			if exists {
+				panel.Name = pluginPanel.name
+				panel.Model = pluginPanel.model
+				panel.ModelHash = modelHash(pluginPanel.model)
+				panel.PluginPath = path
+				panel.SchemaVersion = currentPanelSchemaVersion
+				panel.Updated = now
+				panel.modelCompression = lps.modelCompression
+				if _, err := session.ID(panel.ID).Cols("name", "model", "model_hash", "plugin_path", "schema_version", "updated").Update(&panel); err != nil {
+					return err
+				}
+			} else {
+				// inserting a duplicate would abort the transaction on some databases, so check the name first
+				taken, err := session.Where("org_id=? AND folder_id=0 AND name=? AND kind=?", orgID, pluginPanel.name, panelElement).Count(&LibraryPanel{})
+				if err != nil {
+					return err
+				}
+				if taken > 0 {
+					lps.log.Warn("Library panel of plugin has the name of an existing library panel", "pluginId", plugin.Id, "name", pluginPanel.name)
+					continue
+				}
+
+				uid, err := lps.generateLibraryPanelUID(session, orgID)
+				if err != nil {
+					return err
+				}
+				panel = LibraryPanel{
+					OrgID:         orgID,
+					UID:           uid,
+					Name:          pluginPanel.name,
+					Kind:          panelElement,
+					Model:         pluginPanel.model,
+					ModelHash:     modelHash(pluginPanel.model),
+					SchemaVersion: currentPanelSchemaVersion,
+					PluginID:      plugin.Id,
+					PluginPath:    path,
+					Status:        statusPublished,
+					Created:       now,
+					Updated:       now,
+
+					modelCompression: lps.modelCompression,
+				}
+				if _, err := session.Insert(&panel); err != nil {
+					return err
+				}
+			}
+
+			if err := setLibraryPanelDatasources(session, panel.ID, panel.Model); err != nil {
+				return err
+			}
+		}
+
+		// includes that were removed from the plugin
+		for _, panel := range byPath {
+			if err := removePluginLibraryPanel(session, panel); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err == nil {
+		lps.invalidateLibraryPanelCache()
+	}
+
+	return err
+}
+
+// removePluginLibraryPanels deletes the Library Panels of the plugin in the org that aren't used, and
+// orphans the rest so dashboards keep working.
+func (lps *LibraryPanelService) removePluginLibraryPanels(orgID int64, pluginID string) error {
+	err := lps.SQLStore.WithTransactionalDbSession(context.Background(), func(session *sqlstore.DBSession) error {
+		var libraryPanels []LibraryPanel
+		if err := session.Table("library_panel").Where("org_id=? AND plugin_id=? AND plugin_path<>''", orgID, pluginID).Find(&libraryPanels); err != nil {
+			return err
+		}
+
+		for _, panel := range libraryPanels {
+			if err := removePluginLibraryPanel(session, panel); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err == nil {
+		lps.invalidateLibraryPanelCache()
+	}
+
+	return err
+}
+
+func removePluginLibraryPanel(session *sqlstore.DBSession, panel LibraryPanel) error {
+	connections, err := session.Where("librarypanel_id=?", panel.ID).Count(&libraryPanelDashboard{})
+	if err != nil {
+		return err
+	}
+	if connections == 0 && !panel.Pinned {
+		return deleteLibraryPanelByID(session, panel.ID)
+	}
+
+	_, err = session.Exec("UPDATE library_panel SET plugin_path='' WHERE id=?", panel.ID)
+	return err
+}
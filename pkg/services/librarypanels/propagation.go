@@ -0,0 +1,226 @@
+package librarypanels
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/components/simplejson"
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/dashboards"
+	"github.com/grafana/grafana/pkg/services/sqlstore"
+)
+
+const (
+	// propagationCheckInterval is how often pending propagations are looked for, besides when an update is queued,
+	// to pick up the ones queued before a restart, queued on other servers or that failed.
+	propagationCheckInterval = time.Minute
+	// propagationClaimTimeout is how long a server that claimed a propagation has to finish it, before other servers
+	// can claim it, so the propagations of a server that stopped are done.
+	propagationClaimTimeout = 10 * time.Minute
+)
+
+// propagationJob is a Library Panel update to propagate to the connected dashboards. Jobs are stored until the
+// dashboards were updated, so they survive restarts, and there is at most one for each Library Panel.
+type propagationJob struct {
+	ID    int64  `xorm:"pk autoincr 'id'"`
+	OrgID int64  `xorm:"org_id"`
+	UID   string `xorm:"uid"`
+	// Queued is when the latest update was queued, in nanoseconds. A job that was queued again while the dashboards
+	// were updated is done again.
+	Queued int64 `xorm:"queued"`
+	// ClaimedAt is when a server started updating the dashboards, in seconds, 0 if none did.
+	ClaimedAt int64 `xorm:"claimed_at"`
+}
+
+// enqueuePropagation queues the propagation of a Library Panel update to the connected dashboards, if
+// auto propagation is enabled, and wakes up the propagation of this server.
+func (lps *LibraryPanelService) enqueuePropagation(panel LibraryPanel) {
+	if !lps.Cfg.LibraryPanels.AutoPropagate {
+		return
+	}
+
+	err := lps.SQLStore.WithDbSession(context.Background(), func(session *sqlstore.DBSession) error {
+		queued := time.Now().UnixNano()
+		result, err := session.Exec("UPDATE library_panel_propagation SET queued=? WHERE org_id=? AND uid=?", queued, panel.OrgID, panel.UID)
+		if err != nil {
+			return err
+		}
+		if rowsAffected, err := result.RowsAffected(); err != nil || rowsAffected > 0 {
+			return err
+		}
+
+		_, err = session.Table("library_panel_propagation").Insert(&propagationJob{OrgID: panel.OrgID, UID: panel.UID, Queued: queued})
+		if err != nil && lps.SQLStore.Dialect.IsUniqueConstraintViolation(err) {
+			// another update of the Library Panel queued it in the meantime
+			_, err = session.Exec("UPDATE library_panel_propagation SET queued=? WHERE org_id=? AND uid=?", queued, panel.OrgID, panel.UID)
+		}
+		return err
+	})
+	if err != nil {
+		lps.log.Error("Failed to queue library panel propagation, connected dashboards are not updated", "uid", panel.UID, "error", err)
+		return
+	}
+
+	select {
+	case lps.propagationWake <- struct{}{}:
+	default:
+	}
+}
+
+// runPropagations propagates the queued Library Panel updates until the context is done. It runs apart from the
+// other background jobs, so the updates don't wait for long running ones like Git syncs or backups.
+func (lps *LibraryPanelService) runPropagations(ctx context.Context) {
+	ticker := time.NewTicker(propagationCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-lps.propagationWake:
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+
+		if _, err := lps.propagatePendingUpdates(); err != nil {
+			lps.log.Error("Failed to propagate library panel updates", "error", err)
+		}
+	}
+}
+
+// propagatePendingUpdates propagates the queued Library Panel updates that no other server is propagating, and
+// returns the number of updates that were propagated. A server claims an update before propagating it, and the
+// update is only removed if it wasn't queued again meanwhile. Updates that fail are released to be tried again.
+func (lps *LibraryPanelService) propagatePendingUpdates() (int, error) {
+	var jobs []propagationJob
+	err := lps.SQLStore.WithDbSession(context.Background(), func(session *sqlstore.DBSession) error {
+		return session.Table("library_panel_propagation").Where("claimed_at<?", time.Now().Add(-propagationClaimTimeout).Unix()).Asc("queued").Find(&jobs)
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	done := 0
+	for _, job := range jobs {
+		claimed := false
+		err := lps.SQLStore.WithDbSession(context.Background(), func(session *sqlstore.DBSession) error {
+			result, err := session.Exec("UPDATE library_panel_propagation SET claimed_at=? WHERE id=? AND claimed_at=?",
+				time.Now().Unix(), job.ID, job.ClaimedAt)
+			if err != nil {
+				return err
+			}
+			rowsAffected, err := result.RowsAffected()
+			claimed = rowsAffected == 1
+			return err
+		})
+		if err != nil {
+			return done, err
+		}
+		if !claimed {
+			continue
+		}
+
+		count, propagateErr := lps.propagateToDashboards(job)
+		if propagateErr != nil && !errors.Is(propagateErr, errLibraryPanelNotFound) {
+			lps.log.Error("Failed to update dashboards connected to library panel", "uid", job.UID, "error", propagateErr)
+		} else if count > 0 {
+			lps.log.Info("Updated dashboards connected to library panel", "uid", job.UID, "count", count)
+		}
+
+		err = lps.SQLStore.WithDbSession(context.Background(), func(session *sqlstore.DBSession) error {
+			// deleted Library Panels have no dashboards to update anymore
+			if propagateErr == nil || errors.Is(propagateErr, errLibraryPanelNotFound) {
+				result, err := session.Exec("DELETE FROM library_panel_propagation WHERE id=? AND queued=?", job.ID, job.Queued)
+				if err != nil {
+					return err
+				}
+				if rowsAffected, err := result.RowsAffected(); err != nil || rowsAffected == 1 {
+					return err
+				}
+			}
+			_, err := session.Exec("UPDATE library_panel_propagation SET claimed_at=0 WHERE id=?", job.ID)
+			return err
+		})
+		if err != nil {
+			return done, err
+		}
+		if propagateErr == nil {
+			done++
+		}
+	}
+
+	return done, nil
+}
+
+// propagateToDashboards updates the stored JSON of the dashboards connected to a Library Panel with its
+// current model, and returns the number of dashboards that were updated. The dashboards are saved by a system
+// actor, like provisioned dashboards, so every update is a new dashboard version. Dashboards that can't be
+// saved are logged and skipped.
+func (lps *LibraryPanelService) propagateToDashboards(job propagationJob) (int, error) {
+	var panel LibraryPanel
+	var dashboardIDs []int64
+	// the primary database is read, so the model that was just patched isn't read stale from a lagging replica
+	err := lps.SQLStore.WithDbSession(context.Background(), func(session *sqlstore.DBSession) error {
+		var err error
+		if panel, err = getLibraryPanel(session, job.UID, job.OrgID); err != nil {
+			return err
+		}
+
+		return session.SQL("SELECT DISTINCT dashboard_id FROM library_panel_dashboard WHERE librarypanel_id=?", panel.ID).Find(&dashboardIDs)
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	var references func(*simplejson.Json) map[string][]*simplejson.Json
+	var resolve func(*simplejson.Json, LibraryPanel) error
+	switch panel.Kind {
+	case panelElement:
+		references, resolve = getLibraryPanelReferences, resolveLibraryPanel
+	case variableElement:
+		references, resolve = getLibraryVariableReferences, resolveLibraryVariable
+	default:
+		// library rows are expanded into the panels of the dashboard, so they have no reference to update
+		return 0, nil
+	}
+
+	actor := &models.SignedInUser{
+		UserId:  0,
+		OrgRole: models.ROLE_ADMIN,
+		OrgId:   job.OrgID,
+	}
+	updated := 0
+	for _, dashboardID := range dashboardIDs {
+		query := models.GetDashboardQuery{Id: dashboardID, OrgId: job.OrgID}
+		if err := bus.Dispatch(&query); err != nil {
+			lps.log.Warn("Failed to get dashboard connected to library panel", "uid", panel.UID, "dashboardId", dashboardID, "error", err)
+			continue
+		}
+		dash := query.Result
+
+		objects := references(dash.Data)[panel.UID]
+		if len(objects) == 0 {
+			continue
+		}
+		for _, object := range objects {
+			if err := resolve(object, panel); err != nil {
+				return updated, err
+			}
+		}
+
+		_, err := dashboards.NewService().SaveDashboard(&dashboards.SaveDashboardDTO{
+			OrgId:     job.OrgID,
+			User:      actor,
+			Message:   fmt.Sprintf("Updated library panel %s", panel.Name),
+			Dashboard: dash,
+		}, false)
+		if err != nil {
+			lps.log.Warn("Failed to update dashboard connected to library panel", "uid", panel.UID, "dashboardId", dashboardID, "error", err)
+			continue
+		}
+		updated++
+	}
+
+	return updated, nil
+}
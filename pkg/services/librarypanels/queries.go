@@ -0,0 +1,301 @@
+package librarypanels
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"time"
+
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/sqlstore"
+)
+
+// queryReferenceKey is the key of the references to library queries in the targets of panels. A target like
+// {"refId": "A", "libraryQuery": {"uid": "nErXDvCkzz"}} is replaced by the library query, keeping the keys in
+// queryTargetKeys. A reference with a "version" uses that version of the library query instead of the latest.
+const queryReferenceKey = "libraryQuery"
+
+// queryTargetKeys are the keys of a target that belong to the panel using a library query, not to the query.
+var queryTargetKeys = map[string]bool{"refId": true, "hide": true}
+
+// libraryQueryVersion is a version of the model of a library query, a version is stored every time the model
+// of a library query is saved.
+type libraryQueryVersion struct {
+	ID             int64           `json:"-" xorm:"pk autoincr 'id'"`
+	LibraryPanelID int64           `json:"-" xorm:"librarypanel_id"`
+	Version        int64           `json:"version"`
+	Model          json.RawMessage `json:"model"`
+	Created        time.Time       `json:"created"`
+	CreatedBy      int64           `json:"createdBy"`
+}
+
+// libraryQueryUsage is the usage of a library query.
+type libraryQueryUsage struct {
+	UID        string          `json:"uid" xorm:"uid"`
+	Name       string          `json:"name"`
+	FolderID   int64           `json:"folderId" xorm:"folder_id"`
+	Datasource string          `json:"datasource" xorm:"-"`
+	Model      json.RawMessage `json:"-"`
+	Version    int64           `json:"version"`
+	// LibraryElements are the library elements referencing the library query, and Dashboards the dashboards
+	// connected to them.
+	LibraryElements int64 `json:"libraryElements"`
+	Dashboards      int64 `json:"dashboards"`
+	// Alerts are the alert rules with a condition on the library query.
+	Alerts int64 `json:"alerts" xorm:"-"`
+}
+
+// queryReference is a reference to the latest version of a library query, or to a version of it when Version
+// isn't 0.
+type queryReference struct {
+	UID     string
+	Version int64
+}
+
+// getQueryReference returns the library query the object references, if any.
+func getQueryReference(object map[string]interface{}) (queryReference, bool) {
+	reference, ok := object[queryReferenceKey].(map[string]interface{})
+	if !ok {
+		return queryReference{}, false
+	}
+	uid, _ := reference["uid"].(string)
+	var version int64
+	switch value := reference["version"].(type) {
+	case float64:
+		version = int64(value)
+	case json.Number:
+		version, _ = value.Int64()
+	}
+
+	return queryReference{UID: uid, Version: version}, uid != ""
+}
+
+// collectQueryReferences adds the library queries referenced in the value to references.
+func collectQueryReferences(value interface{}, references map[queryReference]bool) {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		if reference, ok := getQueryReference(value); ok {
+			references[reference] = true
+			return
+		}
+		for _, child := range value {
+			collectQueryReferences(child, references)
+		}
+	case []interface{}:
+		for _, child := range value {
+			collectQueryReferences(child, references)
+		}
+	}
+}
+
+// getQueryReferences returns the UIDs of the library queries referenced in a model, sorted.
+func getQueryReferences(model json.RawMessage) []string {
+	var value interface{}
+	if err := json.Unmarshal(model, &value); err != nil {
+		return []string{}
+	}
+
+	references := map[queryReference]bool{}
+	collectQueryReferences(value, references)
+	return queryReferenceUIDs(references)
+}
+
+func queryReferenceUIDs(references map[queryReference]bool) []string {
+	set := map[string]bool{}
+	for reference := range references {
+		set[reference.UID] = true
+	}
+	uids := make([]string, 0, len(set))
+	for uid := range set {
+		uids = append(uids, uid)
+	}
+	sort.Strings(uids)
+
+	return uids
+}
+
+// addLibraryQueryVersion stores the model of a library query as its next version.
+func addLibraryQueryVersion(session *sqlstore.DBSession, libraryQuery LibraryPanel) error {
+	var latest int64
+	if _, err := session.SQL("SELECT COALESCE(MAX(version), 0) FROM library_query_version WHERE librarypanel_id=?",
+		libraryQuery.ID).Get(&latest); err != nil {
+		return err
+	}
+
+	_, err := session.Insert(&libraryQueryVersion{
+		LibraryPanelID: libraryQuery.ID,
+		Version:        latest + 1,
+		Model:          libraryQuery.Model,
+		Created:        libraryQuery.Updated,
+		CreatedBy:      libraryQuery.UpdatedBy,
+	})
+	return err
+}
+
+// getLibraryQueryVersions gets the versions of a library query, the latest first.
+func (lps *LibraryPanelService) getLibraryQueryVersions(c *models.ReqContext, uid string) ([]libraryQueryVersion, error) {
+	libraryQuery, err := lps.getLibraryPanel(c, uid)
+	if err != nil {
+		return nil, err
+	}
+	if libraryQuery.Kind != queryElement {
+		return nil, errLibraryPanelNotAQuery
+	}
+
+	versions := make([]libraryQueryVersion, 0)
+	err = lps.SQLStore.WithReadReplicaDbSession(context.Background(), func(session *sqlstore.DBSession) error {
+		return session.Where("librarypanel_id=?", libraryQuery.ID).Desc("version").Find(&versions)
+	})
+
+	return versions, err
+}
+
+// resolveLibraryQueries replaces the targets in the dashboard that reference a library query with the library
+// query, and returns the library queries that were found. It runs after the library fragments are resolved,
+// since fragments can reference library queries.
+func (lps *LibraryPanelService) resolveLibraryQueries(orgID int64, dashboard interface{}) ([]LibraryPanel, error) {
+	references := map[queryReference]bool{}
+	collectQueryReferences(dashboard, references)
+	if len(references) == 0 {
+		return nil, nil
+	}
+
+	queries, err := lps.getLibraryPanelsByUIDs(orgID, queryElement, queryReferenceUIDs(references))
+	if err != nil {
+		return nil, err
+	}
+	byUID := make(map[string]LibraryPanel, len(queries))
+	queryModels := map[queryReference]json.RawMessage{}
+	pinned := make([]int64, 0)
+	for _, query := range queries {
+		byUID[query.UID] = query
+		queryModels[queryReference{UID: query.UID}] = query.Model
+	}
+	for reference := range references {
+		if query, ok := byUID[reference.UID]; ok && reference.Version > 0 {
+			pinned = append(pinned, query.ID)
+		}
+	}
+
+	if len(pinned) > 0 {
+		var versions []libraryQueryVersion
+		err := lps.SQLStore.WithReadReplicaDbSession(context.Background(), func(session *sqlstore.DBSession) error {
+			return session.In("librarypanel_id", pinned).Find(&versions)
+		})
+		if err != nil {
+			return nil, err
+		}
+		uids := make(map[int64]string, len(queries))
+		for _, query := range queries {
+			uids[query.ID] = query.UID
+		}
+		for _, version := range versions {
+			queryModels[queryReference{UID: uids[version.LibraryPanelID], Version: version.Version}] = version.Model
+		}
+	}
+
+	if err := mergeLibraryQueries(dashboard, byUID, queryModels); err != nil {
+		return nil, err
+	}
+
+	return queries, nil
+}
+
+// mergeLibraryQueries replaces the objects referencing a library query with the model of the library query, in
+// place. References to versions that don't exist are left as they are.
+func mergeLibraryQueries(value interface{}, queries map[string]LibraryPanel, queryModels map[queryReference]json.RawMessage) error {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		reference, ok := getQueryReference(value)
+		if !ok {
+			for _, child := range value {
+				if err := mergeLibraryQueries(child, queries, queryModels); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		queryModel, found := queryModels[reference]
+		if !found {
+			return nil
+		}
+
+		var target map[string]interface{}
+		if err := json.Unmarshal(queryModel, &target); err != nil {
+			return err
+		}
+		for key, child := range value {
+			if queryTargetKeys[key] {
+				target[key] = child
+			}
+		}
+		link := map[string]interface{}{"uid": reference.UID, "name": queries[reference.UID].Name}
+		if reference.Version > 0 {
+			link["version"] = reference.Version
+		}
+		target[queryReferenceKey] = link
+		for key := range value {
+			delete(value, key)
+		}
+		for key, child := range target {
+			value[key] = child
+		}
+	case []interface{}:
+		for _, child := range value {
+			if err := mergeLibraryQueries(child, queries, queryModels); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// resolveLibraryQueriesHandler handles models.ResolveLibraryQueriesCommand, so that alert rules use the library
+// queries their panels reference.
+func (lps *LibraryPanelService) resolveLibraryQueriesHandler(cmd *models.ResolveLibraryQueriesCommand) error {
+	_, err := lps.resolveLibraryQueries(cmd.OrgId, cmd.Dashboard.Interface())
+	return err
+}
+
+// getLibraryQueryUsageReport gets the library queries in the org with the library elements, dashboards and alert
+// rules using them.
+func (lps *LibraryPanelService) getLibraryQueryUsageReport(c *models.ReqContext) ([]libraryQueryUsage, error) {
+	usages := make([]libraryQueryUsage, 0)
+	err := lps.SQLStore.WithReadReplicaDbSession(context.Background(), func(session *sqlstore.DBSession) error {
+		orgID := c.SignedInUser.OrgId
+		if err := session.SQL(`SELECT library_panel.uid, library_panel.name, library_panel.folder_id, library_panel.model,
+			(SELECT COALESCE(MAX(library_query_version.version), 0) FROM library_query_version WHERE library_query_version.librarypanel_id = library_panel.id) AS version,
+			(SELECT COUNT(*) FROM library_panel_dependency WHERE library_panel_dependency.dependency_id = library_panel.id) AS library_elements,
+			(SELECT COUNT(DISTINCT library_panel_dashboard.dashboard_id) FROM library_panel_dependency
+				INNER JOIN library_panel_dashboard ON library_panel_dashboard.librarypanel_id = library_panel_dependency.librarypanel_id
+				WHERE library_panel_dependency.dependency_id = library_panel.id) AS dashboards
+			FROM library_panel
+			WHERE library_panel.org_id=? AND library_panel.kind=?
+			ORDER BY library_panel.name ASC`, orgID, queryElement).Find(&usages); err != nil {
+			return err
+		}
+
+		for i := range usages {
+			var query struct {
+				Datasource string `json:"datasource"`
+			}
+			// the model is validated when the library query is saved
+			model, _ := decodeStoredModel(usages[i].Model)
+			_ = json.Unmarshal(model, &query)
+			usages[i].Datasource = query.Datasource
+
+			// alert rules store the conditions with the resolved targets, which keep the reference
+			alerts, err := session.Table("alert").Where("org_id=? AND settings "+lps.SQLStore.Dialect.LikeStr()+" ?",
+				orgID, `%"`+queryReferenceKey+`":{%"uid":"`+usages[i].UID+`"%`).Count()
+			if err != nil {
+				return err
+			}
+			usages[i].Alerts = alerts
+		}
+
+		return nil
+	})
+
+	return usages, err
+}
@@ -0,0 +1,71 @@
+package librarypanels
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/sqlstore"
+)
+
+// libraryPanelLimit returns the number of library elements the org can have, the lower of its library_panel quota
+// and the MaxPanelsPerOrg, or 0 if it's unlimited.
+func (lps *LibraryPanelService) libraryPanelLimit(orgID int64) (int64, error) {
+	limit := lps.Cfg.LibraryPanels.MaxPanelsPerOrg
+	if !lps.Cfg.Quota.Enabled {
+		return limit, nil
+	}
+
+	query := models.GetOrgQuotaByTargetQuery{OrgId: orgID, Target: "library_panel", Default: lps.Cfg.Quota.Org.LibraryPanel}
+	if err := bus.Dispatch(&query); err != nil {
+		return 0, err
+	}
+	// negative quotas are unlimited
+	if quota := query.Result.Limit; quota > 0 && (limit == 0 || quota < limit) {
+		limit = quota
+	}
+
+	return limit, nil
+}
+
+// warnIfQuotaThresholdCrossed notifies the admins of the org when the Library Panel created in it made the number
+// of library elements cross the QuotaWarningThreshold of its limit. Warnings are best effort, failures are logged.
+func (lps *LibraryPanelService) warnIfQuotaThresholdCrossed(panel LibraryPanel) {
+	percentage := lps.Cfg.LibraryPanels.QuotaWarningThreshold
+	if percentage <= 0 {
+		return
+	}
+	limit, err := lps.libraryPanelLimit(panel.OrgID)
+	if err != nil {
+		lps.log.Warn("Failed to get the library panel quota", "orgId", panel.OrgID, "error", err)
+		return
+	}
+	if limit <= 0 {
+		return
+	}
+
+	// the threshold is rounded up, so it isn't crossed before the percentage is reached
+	threshold := (limit*percentage + 99) / 100
+	var count int64
+	var adminIDs []int64
+	err = lps.SQLStore.WithDbSession(context.Background(), func(session *sqlstore.DBSession) error {
+		var err error
+		if count, err = countLibraryPanels(session, panel.OrgID, 0); err != nil || count != threshold {
+			return err
+		}
+		return session.Table("org_user").Where("org_id=? AND role=?", panel.OrgID, models.ROLE_ADMIN).
+			OrderBy("user_id ASC").Cols("user_id").Find(&adminIDs)
+	})
+	if err != nil {
+		lps.log.Warn("Failed to check the library panel quota warning threshold", "orgId", panel.OrgID, "error", err)
+		return
+	}
+	if count != threshold {
+		return
+	}
+
+	lps.log.Warn("Library panel quota warning threshold crossed", "orgId", panel.OrgID, "count", count, "limit", limit)
+	lps.addNotifications(panel, adminIDs, fmt.Sprintf("The org has %d of its %d library panels, more than %d%% of its quota",
+		count, limit, percentage))
+}
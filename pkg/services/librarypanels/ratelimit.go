@@ -0,0 +1,80 @@
+package librarypanels
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/grafana/grafana/pkg/infra/remotecache"
+	"github.com/grafana/grafana/pkg/models"
+)
+
+// rateLimitWindow is the window the rate limits count requests in.
+const rateLimitWindow = time.Minute
+
+// rateLimit rejects requests above the per user and per org rate limits with errLibraryPanelRateLimited and a
+// Retry-After header. The requests are counted in the remote cache, so the limits are shared by all Grafana
+// servers using the same remote cache. Failures of the remote cache are logged and let the request through.
+func (lps *LibraryPanelService) rateLimit(c *models.ReqContext) {
+	userLimit := lps.Cfg.LibraryPanels.UserRateLimit
+	orgLimit := lps.Cfg.LibraryPanels.OrgRateLimit
+	if userLimit <= 0 && orgLimit <= 0 {
+		return
+	}
+
+	now := time.Now()
+	window := now.Truncate(rateLimitWindow)
+	// API keys have no user, they are limited like users
+	user := fmt.Sprintf("user-%d", c.SignedInUser.UserId)
+	if c.SignedInUser.ApiKeyId != 0 {
+		user = fmt.Sprintf("apikey-%d", c.SignedInUser.ApiKeyId)
+	}
+
+	limits := []struct {
+		key   string
+		limit int64
+	}{
+		{key: fmt.Sprintf("library-panels-rate-limit-%d-%s-%d", c.SignedInUser.OrgId, user, window.Unix()), limit: userLimit},
+		{key: fmt.Sprintf("library-panels-rate-limit-%d-%d", c.SignedInUser.OrgId, window.Unix()), limit: orgLimit},
+	}
+	for _, limit := range limits {
+		if limit.limit <= 0 {
+			continue
+		}
+
+		count, err := lps.incrementRateLimitCount(limit.key)
+		if err != nil {
+			lps.log.Warn("Failed to count library panel requests for rate limiting", "error", err)
+			return
+		}
+		if count > limit.limit {
+			retryAfter := math.Ceil(window.Add(rateLimitWindow).Sub(now).Seconds())
+			c.Resp.Header().Set("Retry-After", strconv.FormatFloat(retryAfter, 'f', 0, 64))
+			errorResponse(errLibraryPanelRateLimited, "").WriteTo(c)
+			return
+		}
+	}
+}
+
+// incrementRateLimitCount increments the number of requests stored under the key, and returns it. The get and
+// set aren't atomic, so concurrent requests can be counted once. That is precise enough to stop runaway
+// automation, and works with every remote cache.
+func (lps *LibraryPanelService) incrementRateLimitCount(key string) (int64, error) {
+	var count int64
+	value, err := lps.RemoteCache.Get(key)
+	if err != nil && !errors.Is(err, remotecache.ErrCacheItemNotFound) {
+		return 0, err
+	}
+	if err == nil {
+		count, _ = value.(int64)
+	}
+
+	count++
+	if err := lps.RemoteCache.Set(key, count, rateLimitWindow); err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
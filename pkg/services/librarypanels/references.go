@@ -0,0 +1,474 @@
+package librarypanels
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/grafana/grafana/pkg/components/simplejson"
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/sqlstore"
+)
+
+// MissingLibraryPanelsError is the error for saving a dashboard with panels that reference library panels that
+// don't exist, when missing references are rejected.
+type MissingLibraryPanelsError struct {
+	// UIDs are the UIDs of the missing library panels, sorted.
+	UIDs []string
+}
+
+func (e *MissingLibraryPanelsError) Error() string {
+	return fmt.Sprintf("dashboard references library panels that don't exist: %s", strings.Join(e.UIDs, ", "))
+}
+
+// ValidateLibraryPanelsForDashboard checks that the library panels that the panels of the dashboard reference
+// exist in the org of the user, and returns the UIDs of the ones that don't, sorted. If the
+// reject_missing_references setting is enabled, missing library panels are returned as a
+// *MissingLibraryPanelsError, otherwise they are only logged.
+func (lps *LibraryPanelService) ValidateLibraryPanelsForDashboard(c *models.ReqContext, dash *models.Dashboard) ([]string, error) {
+	references := getLibraryPanelReferences(dash.Data)
+	if len(references) == 0 {
+		return nil, nil
+	}
+	uids := make([]string, 0, len(references))
+	for uid := range references {
+		uids = append(uids, uid)
+	}
+
+	var found []string
+	// the primary database is read, so library panels that were just created aren't missing on a lagging replica
+	err := lps.SQLStore.WithDbSession(context.Background(), func(session *sqlstore.DBSession) error {
+		return session.Table("library_panel").Where("org_id=? AND kind=?", c.SignedInUser.OrgId, panelElement).
+			In("uid", uids).Cols("uid").Find(&found)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	exists := make(map[string]bool, len(found))
+	for _, uid := range found {
+		exists[uid] = true
+	}
+	missing := make([]string, 0)
+	for _, uid := range uids {
+		if !exists[uid] {
+			missing = append(missing, uid)
+		}
+	}
+	if len(missing) == 0 {
+		return nil, nil
+	}
+	sort.Strings(missing)
+
+	if lps.Cfg.LibraryPanels.RejectMissingReferences {
+		return missing, &MissingLibraryPanelsError{UIDs: missing}
+	}
+	lps.log.Warn("Dashboard references library panels that don't exist", "dashboardUid", dash.Uid, "libraryPanelUids", missing)
+	return missing, nil
+}
+
+// brokenReferenceCheckInterval is how often the stored dashboards are checked for broken Library Panel references.
+const brokenReferenceCheckInterval = time.Hour
+
+// brokenReferenceBatchSize is the number of dashboards that are checked at a time.
+const brokenReferenceBatchSize = 100
+
+var brokenReferencesGauge = prometheus.NewGauge(prometheus.GaugeOpts{
+	Namespace: "grafana",
+	Name:      "library_panel_broken_references",
+	Help:      "The number of panels in stored dashboards that reference library panels that don't exist, as of the last check",
+})
+
+func init() {
+	prometheus.MustRegister(brokenReferencesGauge)
+}
+
+// brokenLibraryPanelReference is a panel of a stored dashboard that references a Library Panel that doesn't exist.
+type brokenLibraryPanelReference struct {
+	DashboardID    int64  `json:"dashboardId"`
+	DashboardUID   string `json:"dashboardUid"`
+	DashboardTitle string `json:"dashboardTitle"`
+	FolderID       int64  `json:"folderId"`
+	FolderUID      string `json:"folderUid"`
+	FolderTitle    string `json:"folderTitle"`
+	PanelID        int64  `json:"panelId"`
+	// MissingUID is the UID of the Library Panel the panel references.
+	MissingUID string `json:"missingUid"`
+	// MissingName is the name of the Library Panel stored in the reference, if any.
+	MissingName string `json:"missingName"`
+}
+
+// getBrokenLibraryPanelReferences gets the panels of the stored dashboards in the org that reference Library
+// Panels that don't exist, ordered by dashboard title and panel ID.
+func (lps *LibraryPanelService) getBrokenLibraryPanelReferences(orgID int64) ([]brokenLibraryPanelReference, error) {
+	var broken []brokenLibraryPanelReference
+	err := lps.SQLStore.WithReadReplicaDbSession(context.Background(), func(session *sqlstore.DBSession) error {
+		var err error
+		broken, err = getBrokenLibraryPanelReferences(session, orgID)
+		return err
+	})
+
+	return broken, err
+}
+
+func getBrokenLibraryPanelReferences(session *sqlstore.DBSession, orgID int64) ([]brokenLibraryPanelReference, error) {
+	broken := make([]brokenLibraryPanelReference, 0)
+	var lastID int64
+	for {
+		var dashboards []models.Dashboard
+		if err := session.Table("dashboard").Where("org_id=? AND is_folder=? AND id>?", orgID, false, lastID).
+			Cols("id", "uid", "title", "folder_id", "data").OrderBy("id ASC").Limit(brokenReferenceBatchSize).Find(&dashboards); err != nil {
+			return nil, err
+		}
+		if len(dashboards) == 0 {
+			break
+		}
+		lastID = dashboards[len(dashboards)-1].Id
+
+		batch, err := findBrokenLibraryPanelReferences(session, orgID, dashboards)
+		if err != nil {
+			return nil, err
+		}
+		broken = append(broken, batch...)
+		if len(dashboards) < brokenReferenceBatchSize {
+			break
+		}
+	}
+	if err := loadBrokenReferenceFolders(session, broken); err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(broken, func(i, j int) bool {
+		if broken[i].DashboardTitle != broken[j].DashboardTitle {
+			return broken[i].DashboardTitle < broken[j].DashboardTitle
+		}
+		if broken[i].DashboardID != broken[j].DashboardID {
+			return broken[i].DashboardID < broken[j].DashboardID
+		}
+		return broken[i].PanelID < broken[j].PanelID
+	})
+
+	return broken, nil
+}
+
+func findBrokenLibraryPanelReferences(session *sqlstore.DBSession, orgID int64, dashboards []models.Dashboard) ([]brokenLibraryPanelReference, error) {
+	references := make([]map[string][]*simplejson.Json, len(dashboards))
+	uids := make(map[string]bool)
+	for i, dashboard := range dashboards {
+		references[i] = getLibraryPanelReferences(dashboard.Data)
+		for uid := range references[i] {
+			uids[uid] = true
+		}
+	}
+	if len(uids) == 0 {
+		return nil, nil
+	}
+
+	referenced := make([]string, 0, len(uids))
+	for uid := range uids {
+		referenced = append(referenced, uid)
+	}
+	var found []string
+	if err := session.Table("library_panel").Where("org_id=? AND kind=?", orgID, panelElement).
+		In("uid", referenced).Cols("uid").Find(&found); err != nil {
+		return nil, err
+	}
+	exists := make(map[string]bool, len(found))
+	for _, uid := range found {
+		exists[uid] = true
+	}
+
+	var broken []brokenLibraryPanelReference
+	for i, dashboard := range dashboards {
+		for uid, panels := range references[i] {
+			if exists[uid] {
+				continue
+			}
+			for _, panel := range panels {
+				broken = append(broken, brokenLibraryPanelReference{
+					DashboardID:    dashboard.Id,
+					DashboardUID:   dashboard.Uid,
+					DashboardTitle: dashboard.Title,
+					FolderID:       dashboard.FolderId,
+					PanelID:        panel.Get("id").MustInt64(),
+					MissingUID:     uid,
+					MissingName:    panel.Get("libraryPanel").Get("name").MustString(),
+				})
+			}
+		}
+	}
+
+	return broken, nil
+}
+
+func loadBrokenReferenceFolders(session *sqlstore.DBSession, broken []brokenLibraryPanelReference) error {
+	folderIDs := make([]int64, 0)
+	for _, reference := range broken {
+		if reference.FolderID != 0 {
+			folderIDs = append(folderIDs, reference.FolderID)
+		}
+	}
+	if len(folderIDs) == 0 {
+		return nil
+	}
+
+	var folders []models.Dashboard
+	if err := session.Table("dashboard").In("id", folderIDs).Cols("id", "uid", "title").Find(&folders); err != nil {
+		return err
+	}
+	byID := make(map[int64]models.Dashboard, len(folders))
+	for _, folder := range folders {
+		byID[folder.Id] = folder
+	}
+	for i := range broken {
+		if folder, ok := byID[broken[i].FolderID]; ok {
+			broken[i].FolderUID = folder.Uid
+			broken[i].FolderTitle = folder.Title
+		}
+	}
+
+	return nil
+}
+
+// checkBrokenLibraryPanelReferences checks the stored dashboards of all orgs for broken Library Panel references,
+// logs the orgs that have some, and returns the number of broken references.
+func (lps *LibraryPanelService) checkBrokenLibraryPanelReferences() (int, error) {
+	var orgIDs []int64
+	err := lps.SQLStore.WithReadReplicaDbSession(context.Background(), func(session *sqlstore.DBSession) error {
+		return session.SQL("SELECT DISTINCT org_id FROM dashboard ORDER BY org_id ASC").Find(&orgIDs)
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	total := 0
+	for _, orgID := range orgIDs {
+		broken, err := lps.getBrokenLibraryPanelReferences(orgID)
+		if err != nil {
+			return total, err
+		}
+		if len(broken) > 0 {
+			lps.log.Warn("Dashboards reference library panels that don't exist", "orgId", orgID, "count", len(broken))
+		}
+		total += len(broken)
+	}
+	brokenReferencesGauge.Set(float64(total))
+
+	return total, nil
+}
+
+// repairBrokenReferencesCommand is the command for repairing the broken Library Panel references of the stored
+// dashboards in an org.
+type repairBrokenReferencesCommand struct {
+	// Mapping maps the UIDs of missing Library Panels to the UIDs of the Library Panels to use instead. The
+	// references to missing Library Panels that aren't mapped are rebound to the Library Panel with the same name.
+	Mapping map[string]string `json:"mapping"`
+}
+
+// repairedLibraryPanelReference is a broken reference that was rebound to another Library Panel.
+type repairedLibraryPanelReference struct {
+	brokenLibraryPanelReference
+	// LibraryPanelUID is the UID of the Library Panel the panel references now.
+	LibraryPanelUID string `json:"libraryPanelUid"`
+}
+
+// repairBrokenReferencesResult is the result of repairing broken Library Panel references.
+type repairBrokenReferencesResult struct {
+	Repaired []repairedLibraryPanelReference `json:"repaired"`
+	// Unresolved are the broken references that aren't mapped and have no Library Panel with the same name, or
+	// several in other folders than the dashboard.
+	Unresolved []brokenLibraryPanelReference `json:"unresolved"`
+}
+
+// repairBrokenLibraryPanelReferences rebinds the broken Library Panel references of the stored dashboards in the
+// org of the user to the Library Panels of the mapping, or to the Library Panel with the same name. A name
+// matches the Library Panel with that name in the folder of the dashboard, or the only one in the org. The
+// dashboards are saved as a new version and connected to the Library Panels in one transaction.
+func (lps *LibraryPanelService) repairBrokenLibraryPanelReferences(c *models.ReqContext, cmd repairBrokenReferencesCommand) (repairBrokenReferencesResult, error) {
+	result := repairBrokenReferencesResult{
+		Repaired:   make([]repairedLibraryPanelReference, 0),
+		Unresolved: make([]brokenLibraryPanelReference, 0),
+	}
+	orgID := c.SignedInUser.OrgId
+	err := lps.SQLStore.WithTransactionalDbSession(context.Background(), func(session *sqlstore.DBSession) error {
+		broken, err := getBrokenLibraryPanelReferences(session, orgID)
+		if err != nil {
+			return err
+		}
+
+		mapped := make(map[string]LibraryPanel, len(cmd.Mapping))
+		if len(cmd.Mapping) > 0 {
+			uids := make([]string, 0, len(cmd.Mapping))
+			for _, uid := range cmd.Mapping {
+				uids = append(uids, uid)
+			}
+			var libraryPanels []LibraryPanel
+			if err := session.Table("library_panel").Where("org_id=? AND kind=?", orgID, panelElement).In("uid", uids).
+				Cols("id", "uid", "name", "folder_id").Find(&libraryPanels); err != nil {
+				return err
+			}
+			byUID := make(map[string]LibraryPanel, len(libraryPanels))
+			for _, libraryPanel := range libraryPanels {
+				byUID[libraryPanel.UID] = libraryPanel
+			}
+			for missingUID, uid := range cmd.Mapping {
+				libraryPanel, ok := byUID[uid]
+				if !ok {
+					return errLibraryPanelInvalidRepairMapping
+				}
+				mapped[missingUID] = libraryPanel
+			}
+		}
+
+		names := make([]string, 0)
+		for _, reference := range broken {
+			if _, ok := mapped[reference.MissingUID]; !ok && reference.MissingName != "" {
+				names = append(names, reference.MissingName)
+			}
+		}
+		byName := make(map[string][]LibraryPanel)
+		if len(names) > 0 {
+			var libraryPanels []LibraryPanel
+			if err := session.Table("library_panel").Where("org_id=? AND kind=?", orgID, panelElement).In("name", names).
+				Cols("id", "uid", "name", "folder_id").Find(&libraryPanels); err != nil {
+				return err
+			}
+			for _, libraryPanel := range libraryPanels {
+				byName[libraryPanel.Name] = append(byName[libraryPanel.Name], libraryPanel)
+			}
+		}
+
+		repairs := make(map[int64][]repairedLibraryPanelReference)
+		targets := make(map[string]LibraryPanel)
+		var dashboardIDs []int64
+		for _, reference := range broken {
+			target, ok := mapped[reference.MissingUID]
+			if !ok {
+				target, ok = matchLibraryPanelByName(byName[reference.MissingName], reference.FolderID)
+			}
+			if !ok {
+				result.Unresolved = append(result.Unresolved, reference)
+				continue
+			}
+
+			if _, ok := repairs[reference.DashboardID]; !ok {
+				dashboardIDs = append(dashboardIDs, reference.DashboardID)
+			}
+			targets[target.UID] = target
+			repaired := repairedLibraryPanelReference{brokenLibraryPanelReference: reference, LibraryPanelUID: target.UID}
+			repairs[reference.DashboardID] = append(repairs[reference.DashboardID], repaired)
+			result.Repaired = append(result.Repaired, repaired)
+		}
+
+		for _, dashboardID := range dashboardIDs {
+			if err := repairDashboard(session, c.SignedInUser, dashboardID, repairs[dashboardID], targets); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return repairBrokenReferencesResult{}, err
+	}
+
+	return result, nil
+}
+
+// matchLibraryPanelByName picks the Library Panel in the folder of the dashboard among the Library Panels with
+// the name of a broken reference, or the only one if there's just one.
+func matchLibraryPanelByName(libraryPanels []LibraryPanel, folderID int64) (LibraryPanel, bool) {
+	for _, libraryPanel := range libraryPanels {
+		if libraryPanel.FolderID == folderID {
+			return libraryPanel, true
+		}
+	}
+	if len(libraryPanels) == 1 {
+		return libraryPanels[0], true
+	}
+
+	return LibraryPanel{}, false
+}
+
+// repairDashboard rebinds the repaired references of the dashboard, saves it as a new version and connects it
+// to the Library Panels.
+func repairDashboard(session *sqlstore.DBSession, user *models.SignedInUser, dashboardID int64,
+	repairs []repairedLibraryPanelReference, targets map[string]LibraryPanel) error {
+	dash := models.Dashboard{}
+	has, err := session.Where("id=? AND org_id=?", dashboardID, user.OrgId).Get(&dash)
+	if err != nil {
+		return err
+	}
+	if !has {
+		return models.ErrDashboardNotFound
+	}
+
+	references := getLibraryPanelReferences(dash.Data)
+	for _, repair := range repairs {
+		target := targets[repair.LibraryPanelUID]
+		for _, panel := range references[repair.MissingUID] {
+			if panel.Get("id").MustInt64() != repair.PanelID {
+				continue
+			}
+			panel.Get("libraryPanel").Set("uid", target.UID)
+			panel.Get("libraryPanel").Set("name", target.Name)
+		}
+	}
+
+	if err := saveDashboardVersion(session, user, &dash, "Repaired library panel references"); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, repair := range repairs {
+		target := targets[repair.LibraryPanelUID]
+		exists, err := session.Table("library_panel_dashboard").
+			Where("librarypanel_id=? AND dashboard_id=? AND panel_id=?", target.ID, dash.Id, repair.PanelID).Exist()
+		if err != nil {
+			return err
+		}
+		if !exists {
+			if _, err := session.Insert(&libraryPanelDashboard{
+				LibraryPanelID: target.ID,
+				DashboardID:    dash.Id,
+				PanelID:        repair.PanelID,
+				Created:        now,
+				CreatedBy:      user.UserId,
+			}); err != nil {
+				return err
+			}
+		}
+		if _, err := session.Exec("UPDATE library_panel SET last_connected_at=? WHERE id=?", now, target.ID); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// saveDashboardVersion stores the changed JSON of a dashboard as a new version in the session, so that the change
+// is part of the transaction of the caller.
+func saveDashboardVersion(session *sqlstore.DBSession, user *models.SignedInUser, dash *models.Dashboard, message string) error {
+	now := time.Now()
+	parentVersion := dash.Version
+	dash.SetVersion(dash.Version + 1)
+	dash.Updated = now
+	dash.UpdatedBy = user.UserId
+	if _, err := session.ID(dash.Id).Cols("data", "version", "updated", "updated_by").Update(dash); err != nil {
+		return err
+	}
+	_, err := session.Insert(&models.DashboardVersion{
+		DashboardId:   dash.Id,
+		ParentVersion: parentVersion,
+		Version:       dash.Version,
+		Created:       now,
+		CreatedBy:     user.UserId,
+		Message:       message,
+		Data:          dash.Data,
+	})
+	return err
+}
@@ -0,0 +1,301 @@
+package librarypanels
+
+import (
+	"context"
+	"reflect"
+	"time"
+
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/sqlstore"
+)
+
+const (
+	// replicationReconcileInterval is how often all copies are reconciled with their Library Panels.
+	replicationReconcileInterval = 5 * time.Minute
+	// replicationUserID is the user that copies are created and updated by.
+	replicationUserID = -1
+)
+
+// libraryPanelReplication is a rule that keeps a copy of a Library Panel in another org.
+type libraryPanelReplication struct {
+	ID             int64 `xorm:"pk autoincr 'id'"`
+	OrgID          int64 `xorm:"org_id"`
+	LibraryPanelID int64 `xorm:"librarypanel_id"`
+	TargetOrgID    int64 `xorm:"target_org_id"`
+
+	Created   time.Time
+	CreatedBy int64
+}
+
+// setReplicationCommand is the command for setting the orgs a Library Panel is replicated to.
+type setReplicationCommand struct {
+	// TargetOrgIDs are the orgs that get a copy, an empty list stops the replication and deletes the copies.
+	TargetOrgIDs []int64 `json:"targetOrgIds"`
+}
+
+// replicaCopy is a copy of a Library Panel.
+type replicaCopy struct {
+	OrgID int64  `json:"orgId" xorm:"org_id"`
+	UID   string `json:"uid" xorm:"uid"`
+}
+
+// libraryPanelReplicationResult is the replication of a Library Panel and its current copies.
+type libraryPanelReplicationResult struct {
+	TargetOrgIDs []int64       `json:"targetOrgIds"`
+	Copies       []replicaCopy `json:"copies"`
+}
+
+func getLibraryPanelReplication(session *sqlstore.DBSession, libraryPanelID int64) (libraryPanelReplicationResult, error) {
+	result := libraryPanelReplicationResult{TargetOrgIDs: make([]int64, 0), Copies: make([]replicaCopy, 0)}
+	var rules []libraryPanelReplication
+	if err := session.Where("librarypanel_id=?", libraryPanelID).OrderBy("target_org_id ASC").Find(&rules); err != nil {
+		return libraryPanelReplicationResult{}, err
+	}
+	for _, rule := range rules {
+		result.TargetOrgIDs = append(result.TargetOrgIDs, rule.TargetOrgID)
+	}
+	if err := session.Table("library_panel").Where("replica_of=?", libraryPanelID).Cols("org_id", "uid").
+		OrderBy("org_id ASC").Find(&result.Copies); err != nil {
+		return libraryPanelReplicationResult{}, err
+	}
+
+	return result, nil
+}
+
+// getReplication gets the orgs a Library Panel is replicated to.
+func (lps *LibraryPanelService) getReplication(c *models.ReqContext, uid string) (libraryPanelReplicationResult, error) {
+	libraryPanel, err := lps.getLibraryPanel(c, uid)
+	if err != nil {
+		return libraryPanelReplicationResult{}, err
+	}
+
+	var result libraryPanelReplicationResult
+	err = lps.SQLStore.WithReadReplicaDbSession(context.Background(), func(session *sqlstore.DBSession) error {
+		result, err = getLibraryPanelReplication(session, libraryPanel.ID)
+		return err
+	})
+
+	return result, err
+}
+
+// setReplication replaces the orgs a Library Panel is replicated to, and reconciles its copies right away.
+func (lps *LibraryPanelService) setReplication(c *models.ReqContext, uid string, cmd setReplicationCommand) (libraryPanelReplicationResult, error) {
+	libraryPanel, err := lps.getLibraryPanel(c, uid)
+	if err != nil {
+		return libraryPanelReplicationResult{}, err
+	}
+	if libraryPanel.ReplicaOf != 0 {
+		return libraryPanelReplicationResult{}, errLibraryPanelReplica
+	}
+
+	targets := make(map[int64]bool, len(cmd.TargetOrgIDs))
+	for _, orgID := range cmd.TargetOrgIDs {
+		if orgID == libraryPanel.OrgID {
+			return libraryPanelReplicationResult{}, errLibraryPanelInvalidReplicationTarget
+		}
+		targets[orgID] = true
+	}
+
+	err = lps.SQLStore.WithTransactionalDbSession(context.Background(), func(session *sqlstore.DBSession) error {
+		orgIDs := make([]int64, 0, len(targets))
+		for orgID := range targets {
+			orgIDs = append(orgIDs, orgID)
+		}
+		if len(orgIDs) > 0 {
+			count, err := session.Table("org").In("id", orgIDs).Count()
+			if err != nil {
+				return err
+			}
+			if count != int64(len(orgIDs)) {
+				return errLibraryPanelInvalidReplicationTarget
+			}
+		}
+
+		if _, err := session.Exec("DELETE FROM library_panel_replication WHERE librarypanel_id=?", libraryPanel.ID); err != nil {
+			return err
+		}
+		for _, orgID := range orgIDs {
+			if _, err := session.Insert(&libraryPanelReplication{
+				OrgID:          libraryPanel.OrgID,
+				LibraryPanelID: libraryPanel.ID,
+				TargetOrgID:    orgID,
+				Created:        time.Now(),
+				CreatedBy:      c.SignedInUser.UserId,
+			}); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return libraryPanelReplicationResult{}, err
+	}
+	if err := lps.reconcileLibraryPanelReplicas(libraryPanel.ID); err != nil {
+		return libraryPanelReplicationResult{}, err
+	}
+
+	var result libraryPanelReplicationResult
+	err = lps.SQLStore.WithDbSession(context.Background(), func(session *sqlstore.DBSession) error {
+		result, err = getLibraryPanelReplication(session, libraryPanel.ID)
+		return err
+	})
+
+	return result, err
+}
+
+// reconcileReplicasAfterChange reconciles the copies of a Library Panel that was changed or deleted. Failures
+// are only logged, the scheduled reconciliation catches up.
+func (lps *LibraryPanelService) reconcileReplicasAfterChange(libraryPanelID int64) {
+	if err := lps.reconcileLibraryPanelReplicas(libraryPanelID); err != nil {
+		lps.log.Warn("Failed to reconcile replicated library panels", "id", libraryPanelID, "error", err)
+	}
+}
+
+// reconcileLibraryPanelReplicas makes the copies of a Library Panel match its replication rules: copies are
+// created in the General folder of target orgs that don't have one yet, updated when the Library Panel changed,
+// and deleted from orgs that aren't targeted anymore or when the Library Panel was deleted.
+func (lps *LibraryPanelService) reconcileLibraryPanelReplicas(libraryPanelID int64) error {
+	err := lps.SQLStore.WithTransactionalDbSession(context.Background(), func(session *sqlstore.DBSession) error {
+		var source LibraryPanel
+		has, err := session.Table("library_panel").ID(libraryPanelID).Get(&source)
+		if err != nil {
+			return err
+		}
+		targets := map[int64]bool{}
+		if has {
+			sources := []LibraryPanel{source}
+			if err := loadLibraryPanelTags(session, sources); err != nil {
+				return err
+			}
+			source = sources[0]
+			var rules []libraryPanelReplication
+			if err := session.Where("librarypanel_id=?", libraryPanelID).Find(&rules); err != nil {
+				return err
+			}
+			for _, rule := range rules {
+				targets[rule.TargetOrgID] = true
+			}
+		}
+
+		var replicas []LibraryPanel
+		if err := session.Table("library_panel").Where("replica_of=?", libraryPanelID).Find(&replicas); err != nil {
+			return err
+		}
+		if err := loadLibraryPanelTags(session, replicas); err != nil {
+			return err
+		}
+		for _, replica := range replicas {
+			if !targets[replica.OrgID] {
+				if err := deleteLibraryPanelByID(session, replica.ID); err != nil {
+					return err
+				}
+				continue
+			}
+			delete(targets, replica.OrgID)
+			if replica.Name == source.Name && replica.Kind == source.Kind && jsonEqual(replica.Model, source.Model) &&
+				reflect.DeepEqual(replica.Tags, source.Tags) {
+				continue
+			}
+
+			replica.Name = source.Name
+			replica.Kind = source.Kind
+			replica.Model = source.Model
+			replica.ModelHash = modelHash(source.Model)
+			replica.SchemaVersion = source.SchemaVersion
+			replica.Updated = time.Now()
+			replica.UpdatedBy = replicationUserID
+			replica.modelCompression = lps.modelCompression
+			if _, err := session.ID(replica.ID).Cols("name", "kind", "model", "model_hash", "schema_version", "updated", "updated_by").Update(&replica); err != nil {
+				return err
+			}
+			if err := setLibraryPanelTags(session, replica.ID, source.Tags); err != nil {
+				return err
+			}
+			if err := setLibraryPanelDatasources(session, replica.ID, replica.Model); err != nil {
+				return err
+			}
+		}
+
+		for orgID := range targets {
+			replica := LibraryPanel{
+				OrgID:         orgID,
+				UID:           source.UID,
+				Name:          source.Name,
+				Kind:          source.Kind,
+				Model:         source.Model,
+				ModelHash:     modelHash(source.Model),
+				SchemaVersion: source.SchemaVersion,
+				Status:        statusPublished,
+				ReplicaOf:     source.ID,
+				Created:       time.Now(),
+				Updated:       time.Now(),
+				CreatedBy:     replicationUserID,
+				UpdatedBy:     replicationUserID,
+
+				modelCompression: lps.modelCompression,
+			}
+			// copies keep the UID of the Library Panel, unless the target org already uses it
+			if exists, err := session.Table("library_panel").Where("org_id=? AND uid=?", orgID, replica.UID).Exist(); err != nil {
+				return err
+			} else if exists {
+				if replica.UID, err = lps.generateLibraryPanelUID(session, orgID); err != nil {
+					return err
+				}
+			}
+			if _, err := session.Insert(&replica); err != nil {
+				return err
+			}
+			if err := setLibraryPanelTags(session, replica.ID, source.Tags); err != nil {
+				return err
+			}
+			if err := setLibraryPanelDatasources(session, replica.ID, replica.Model); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err == nil {
+		lps.invalidateLibraryPanelCache()
+	}
+
+	return err
+}
+
+// reconcileReplicatedLibraryPanels reconciles the copies of all replicated Library Panels, and deletes the
+// copies of Library Panels that aren't replicated anymore. It returns the number of Library Panels reconciled.
+func (lps *LibraryPanelService) reconcileReplicatedLibraryPanels() (int, error) {
+	var ids []int64
+	err := lps.SQLStore.WithDbSession(context.Background(), func(session *sqlstore.DBSession) error {
+		var replicated, copied []int64
+		if err := session.Table("library_panel_replication").Distinct("librarypanel_id").Find(&replicated); err != nil {
+			return err
+		}
+		if err := session.Table("library_panel").Where("replica_of<>0").Distinct("replica_of").Find(&copied); err != nil {
+			return err
+		}
+		seen := map[int64]bool{}
+		for _, id := range append(replicated, copied...) {
+			if !seen[id] {
+				seen[id] = true
+				ids = append(ids, id)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	reconciled := 0
+	for _, id := range ids {
+		if err := lps.reconcileLibraryPanelReplicas(id); err != nil {
+			lps.log.Error("Failed to reconcile replicated library panel", "id", id, "error", err)
+			continue
+		}
+		reconciled++
+	}
+
+	return reconciled, nil
+}
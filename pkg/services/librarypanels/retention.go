@@ -0,0 +1,86 @@
+package librarypanels
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/grafana/grafana/pkg/services/sqlstore"
+)
+
+const (
+	// versionRetentionInterval is how often the library query versions beyond the retention are deleted.
+	versionRetentionInterval = time.Hour
+	// Like the dashboard versions, expired versions are deleted in batches, up to a maximum per run.
+	maxVersionsToDeletePerBatch = 500
+	maxVersionDeletionBatches   = 50
+)
+
+// versionRetentionResult is the result of deleting the library query versions beyond the retention.
+type versionRetentionResult struct {
+	Deleted int64 `json:"deleted"`
+}
+
+// deleteExpiredLibraryQueryVersions deletes the versions of library queries beyond the versions_to_keep latest
+// ones, and the ones older than version_max_age_days. The latest version of a library query is always kept.
+// References pinned to a deleted version are left as they are, like references to versions that never existed.
+func (lps *LibraryPanelService) deleteExpiredLibraryQueryVersions() (versionRetentionResult, error) {
+	return lps.deleteExpiredVersions(maxVersionsToDeletePerBatch, maxVersionDeletionBatches)
+}
+
+func (lps *LibraryPanelService) deleteExpiredVersions(perBatch int, maxBatches int) (versionRetentionResult, error) {
+	versionsToKeep := lps.Cfg.LibraryPanels.VersionsToKeep
+	maxAgeDays := lps.Cfg.LibraryPanels.VersionMaxAgeDays
+
+	var conditions []string
+	var params []interface{}
+	if versionsToKeep > 0 {
+		conditions = append(conditions, "library_query_version.version <= latest_version.version - ?")
+		params = append(params, versionsToKeep)
+	}
+	if maxAgeDays > 0 {
+		conditions = append(conditions, "library_query_version.created < ?")
+		params = append(params, time.Now().AddDate(0, 0, -int(maxAgeDays)))
+	}
+	result := versionRetentionResult{}
+	if len(conditions) == 0 {
+		return result, nil
+	}
+	params = append(params, perBatch)
+
+	for batch := 0; batch < maxBatches; batch++ {
+		var deleted int64
+		err := lps.SQLStore.WithTransactionalDbSession(context.Background(), func(session *sqlstore.DBSession) error {
+			var ids []interface{}
+			if err := session.SQL(`SELECT library_query_version.id FROM library_query_version
+				INNER JOIN (
+					SELECT librarypanel_id, MAX(version) AS version FROM library_query_version GROUP BY librarypanel_id
+				) AS latest_version ON latest_version.librarypanel_id = library_query_version.librarypanel_id
+				WHERE library_query_version.version < latest_version.version AND (`+strings.Join(conditions, " OR ")+`)
+				LIMIT ?`, params...).Find(&ids); err != nil {
+				return err
+			}
+			if len(ids) == 0 {
+				return nil
+			}
+
+			sql := "DELETE FROM library_query_version WHERE id IN (?" + strings.Repeat(",?", len(ids)-1) + ")"
+			res, err := session.Exec(append([]interface{}{sql}, ids...)...)
+			if err != nil {
+				return err
+			}
+			deleted, err = res.RowsAffected()
+			return err
+		})
+		if err != nil {
+			return result, err
+		}
+
+		result.Deleted += deleted
+		if deleted < int64(perBatch) {
+			break
+		}
+	}
+
+	return result, nil
+}
@@ -0,0 +1,98 @@
+package librarypanels
+
+import (
+	"github.com/grafana/grafana/pkg/components/simplejson"
+)
+
+// expandLibraryRows replaces the rows in the dashboard that reference a library row with the stored row and
+// its panels, and returns the library rows that were found. The panels of a library row are positioned
+// relative to the row, and get new ids so they don't clash with the other panels of the dashboard. The
+// panels of expanded rows are added after the row, moving the panels below it down.
+func (lps *LibraryPanelService) expandLibraryRows(orgID int64, dashboard *simplejson.Json) ([]LibraryPanel, error) {
+	panels := dashboard.Get("panels").MustArray()
+	uids := make([]string, 0)
+	for _, panel := range panels {
+		if uid := simplejson.NewFromAny(panel).Get("libraryRow").Get("uid").MustString(); uid != "" {
+			uids = append(uids, uid)
+		}
+	}
+	if len(uids) == 0 {
+		return nil, nil
+	}
+
+	libraryRows, err := lps.getLibraryPanelsByUIDs(orgID, rowElement, uids)
+	if err != nil {
+		return nil, err
+	}
+	rowsByUID := make(map[string]LibraryPanel, len(libraryRows))
+	for _, libraryRow := range libraryRows {
+		rowsByUID[libraryRow.UID] = libraryRow
+	}
+
+	nextID := maxPanelID(panels) + 1
+	expanded := make([]interface{}, 0, len(panels))
+	shift := 0
+	for _, item := range panels {
+		panel := simplejson.NewFromAny(item)
+		if shift > 0 {
+			gridPos := panel.Get("gridPos")
+			gridPos.Set("y", gridPos.Get("y").MustInt()+shift)
+		}
+
+		libraryRow, ok := rowsByUID[panel.Get("libraryRow").Get("uid").MustString()]
+		if !ok {
+			expanded = append(expanded, panel.Interface())
+			continue
+		}
+
+		if err := replaceWithModel(panel, libraryRow.Model, []string{"id", "gridPos", "collapsed"}, "libraryRow", libraryRow); err != nil {
+			return nil, err
+		}
+
+		rowY := panel.Get("gridPos").Get("y").MustInt()
+		children := panel.Get("panels").MustArray()
+		height := 0
+		for _, child := range children {
+			childPanel := simplejson.NewFromAny(child)
+			childPanel.Set("id", nextID)
+			nextID++
+
+			gridPos := childPanel.Get("gridPos")
+			relativeY := gridPos.Get("y").MustInt()
+			gridPos.Set("y", rowY+1+relativeY)
+			if bottom := relativeY + gridPos.Get("h").MustInt(); bottom > height {
+				height = bottom
+			}
+		}
+
+		if panel.Get("collapsed").MustBool() {
+			panel.Set("panels", children)
+			expanded = append(expanded, panel.Interface())
+			continue
+		}
+
+		panel.Set("panels", []interface{}{})
+		expanded = append(expanded, panel.Interface())
+		expanded = append(expanded, children...)
+		shift += height
+	}
+	dashboard.Set("panels", expanded)
+
+	return libraryRows, nil
+}
+
+// maxPanelID returns the highest panel id in the panels, including the panels in collapsed rows.
+func maxPanelID(panels []interface{}) int64 {
+	maxID := int64(0)
+	for _, item := range panels {
+		panel := simplejson.NewFromAny(item)
+		if id := panel.Get("id").MustInt64(); id > maxID {
+			maxID = id
+		}
+		if id := maxPanelID(panel.Get("panels").MustArray()); id > maxID {
+			maxID = id
+		}
+	}
+
+	return maxID
+}
@@ -0,0 +1,210 @@
+package librarypanels
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"time"
+
+	"gopkg.in/macaron.v1"
+
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/sqlstore"
+)
+
+const (
+	scheduledChangeStatusScheduled = "scheduled"
+	scheduledChangeStatusPublished = "published"
+	scheduledChangeStatusCancelled = "cancelled"
+	scheduledChangeStatusFailed    = "failed"
+
+	// scheduledChangeCheckInterval is how often the scheduled changes that became effective are published.
+	scheduledChangeCheckInterval = time.Minute
+)
+
+// libraryPanelScheduledChange is the model for changes to Library Panels that are published at a later time,
+// so dashboards keep getting the current model until then.
+type libraryPanelScheduledChange struct {
+	ID              int64  `json:"id" xorm:"pk autoincr 'id'"`
+	OrgID           int64  `json:"-" xorm:"org_id"`
+	LibraryPanelID  int64  `json:"-" xorm:"librarypanel_id"`
+	LibraryPanelUID string `json:"libraryPanelUid" xorm:"-"`
+	// Command is the JSON of the patchLibraryPanelCommand that is applied when the change becomes effective.
+	Command     json.RawMessage `json:"command"`
+	EffectiveAt time.Time       `json:"effectiveAt" xorm:"effective_at"`
+	Status      string          `json:"status"`
+	// Error is why a change failed to be published.
+	Error string `json:"error,omitempty"`
+
+	Created   time.Time  `json:"created"`
+	CreatedBy int64      `json:"createdBy"`
+	Published *time.Time `json:"published"`
+}
+
+// scheduleLibraryPanelChange stores the patch to be published at effectiveAt. The patch is checked like it
+// would be applied right away, so a change that can't be applied is rejected now rather than when it becomes
+// effective. Changes that need approval can't be scheduled by users who aren't org admins.
+func (lps *LibraryPanelService) scheduleLibraryPanelChange(c *models.ReqContext, cmd patchLibraryPanelCommand, uid string, effectiveAt time.Time) (libraryPanelScheduledChange, error) {
+	if !effectiveAt.After(time.Now()) {
+		return libraryPanelScheduledChange{}, errLibraryPanelInvalidEffectiveAt
+	}
+	panelInDB, _, err := lps.applyLibraryPanelPatch(c, cmd, uid, true)
+	if err != nil {
+		return libraryPanelScheduledChange{}, err
+	}
+
+	threshold := lps.Cfg.LibraryPanels.ApprovalThreshold
+	change := libraryPanelScheduledChange{
+		OrgID:           c.SignedInUser.OrgId,
+		LibraryPanelID:  panelInDB.ID,
+		LibraryPanelUID: panelInDB.UID,
+		EffectiveAt:     effectiveAt,
+		Status:          scheduledChangeStatusScheduled,
+		Created:         time.Now(),
+		CreatedBy:       c.SignedInUser.UserId,
+	}
+	err = lps.SQLStore.WithTransactionalDbSession(context.Background(), func(session *sqlstore.DBSession) error {
+		if threshold > 0 && cmd.Model != nil && c.SignedInUser.OrgRole != models.ROLE_ADMIN {
+			connections, err := countConnectedDashboards(session, panelInDB.ID)
+			if err != nil {
+				return err
+			}
+			if connections > threshold {
+				return errLibraryPanelScheduleNeedsApproval
+			}
+		}
+
+		if cmd.Model != nil {
+			cmd.Model = normalizeModel(panelInDB.Kind, cmd.Model)
+		}
+		command, err := json.Marshal(cmd)
+		if err != nil {
+			return err
+		}
+		change.Command = command
+		_, err = session.Insert(&change)
+		return err
+	})
+
+	return change, err
+}
+
+// getScheduledChanges gets the changes of the Library Panel that aren't published yet, the earliest first.
+func (lps *LibraryPanelService) getScheduledChanges(c *models.ReqContext, uid string) ([]libraryPanelScheduledChange, error) {
+	libraryPanel, err := lps.getLibraryPanel(c, uid)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := make([]libraryPanelScheduledChange, 0)
+	err = lps.SQLStore.WithReadReplicaDbSession(context.Background(), func(session *sqlstore.DBSession) error {
+		return session.Table("library_panel_scheduled_change").Where("librarypanel_id=? AND status=?", libraryPanel.ID, scheduledChangeStatusScheduled).
+			OrderBy("effective_at ASC, id ASC").Find(&changes)
+	})
+	for i := range changes {
+		changes[i].LibraryPanelUID = libraryPanel.UID
+	}
+
+	return changes, err
+}
+
+// cancelScheduledChange cancels a change of the Library Panel that isn't published yet. It requires edit
+// permission on the Library Panel.
+func (lps *LibraryPanelService) cancelScheduledChange(c *models.ReqContext, uid string, id int64) (libraryPanelScheduledChange, error) {
+	var change libraryPanelScheduledChange
+	err := lps.SQLStore.WithTransactionalDbSession(context.Background(), func(session *sqlstore.DBSession) error {
+		libraryPanel, err := getLibraryPanel(session, uid, c.SignedInUser.OrgId)
+		if err != nil {
+			return err
+		}
+		if err := checkCanEditLibraryPanel(session, lps.SQLStore.Dialect, c.SignedInUser, libraryPanel); err != nil {
+			return err
+		}
+
+		has, err := session.Table("library_panel_scheduled_change").Where("id=? AND librarypanel_id=? AND status=?", id, libraryPanel.ID, scheduledChangeStatusScheduled).Get(&change)
+		if err != nil {
+			return err
+		}
+		if !has {
+			return errLibraryPanelScheduledChangeNotFound
+		}
+
+		change.LibraryPanelUID = libraryPanel.UID
+		change.Status = scheduledChangeStatusCancelled
+		_, err = session.ID(change.ID).Cols("status").Update(&change)
+		return err
+	})
+
+	return change, err
+}
+
+// publishDueScheduledChanges publishes the scheduled changes that became effective, in the order they became
+// effective, as the users who scheduled them. A change that can't be applied anymore, for example because the
+// user lost their permission or the Library Panel became read only, is marked as failed. It returns the number
+// of changes published.
+func (lps *LibraryPanelService) publishDueScheduledChanges() (int, error) {
+	var changes []libraryPanelScheduledChange
+	err := lps.SQLStore.WithDbSession(context.Background(), func(session *sqlstore.DBSession) error {
+		return session.Table("library_panel_scheduled_change").Where("status=? AND effective_at<=?", scheduledChangeStatusScheduled, time.Now()).
+			OrderBy("effective_at ASC, id ASC").Find(&changes)
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	published := 0
+	for _, change := range changes {
+		if err := lps.publishScheduledChange(change); err != nil {
+			lps.log.Warn("Failed to publish scheduled library panel change", "id", change.ID, "error", err)
+			change.Status = scheduledChangeStatusFailed
+			change.Error = err.Error()
+		} else {
+			now := time.Now()
+			change.Status = scheduledChangeStatusPublished
+			change.Published = &now
+			published++
+		}
+
+		err := lps.SQLStore.WithDbSession(context.Background(), func(session *sqlstore.DBSession) error {
+			_, err := session.ID(change.ID).Cols("status", "error", "published").Update(&change)
+			return err
+		})
+		if err != nil {
+			return published, err
+		}
+	}
+
+	return published, nil
+}
+
+func (lps *LibraryPanelService) publishScheduledChange(change libraryPanelScheduledChange) error {
+	var uid string
+	err := lps.SQLStore.WithDbSession(context.Background(), func(session *sqlstore.DBSession) error {
+		has, err := session.Table("library_panel").Where("id=?", change.LibraryPanelID).Cols("uid").Get(&uid)
+		if err == nil && !has {
+			err = errLibraryPanelNotFound
+		}
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	query := models.GetSignedInUserQuery{UserId: change.CreatedBy, OrgId: change.OrgID}
+	if err := lps.SQLStore.GetSignedInUserWithCache(&query); err != nil {
+		return err
+	}
+	var cmd patchLibraryPanelCommand
+	if err := json.Unmarshal(change.Command, &cmd); err != nil {
+		return err
+	}
+
+	// the change was checked when it was scheduled, it's published as if its user saved it now
+	c := &models.ReqContext{
+		Context:      &macaron.Context{Req: macaron.Request{Request: &http.Request{URL: &url.URL{}, Header: http.Header{}}}},
+		SignedInUser: query.Result,
+	}
+	_, err = lps.patchLibraryPanel(c, cmd, uid)
+	return err
+}
@@ -0,0 +1,126 @@
+package librarypanels
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/grafana/grafana/pkg/services/sqlstore"
+)
+
+// currentPanelSchemaVersion is the dashboard schemaVersion that stored Library Panel models are upgraded to.
+// It must match the schemaVersion of the frontend DashboardMigrator.
+const currentPanelSchemaVersion = 27
+
+// panelModelMigration upgrades a panel model to the dashboard schemaVersion it belongs to.
+type panelModelMigration struct {
+	version int64
+	migrate func(panel map[string]interface{})
+}
+
+// panelModelMigrations are the panel upgrades of the frontend DashboardMigrator, in schemaVersion order.
+var panelModelMigrations = []panelModelMigration{
+	{version: 24, migrate: migrateAngularTablePanel},
+	{version: 26, migrate: migrateReactTextPanel},
+}
+
+// migrateAngularTablePanel moves angular tables with custom styles to the table-old panel.
+func migrateAngularTablePanel(panel map[string]interface{}) {
+	if panel["type"] != "table" {
+		return
+	}
+	if _, ok := panel["styles"]; !ok {
+		return
+	}
+
+	panel["type"] = "table-old"
+}
+
+// migrateReactTextPanel moves the react text2 panel back to the text panel.
+func migrateReactTextPanel(panel map[string]interface{}) {
+	if panel["type"] != "text2" {
+		return
+	}
+
+	panel["type"] = "text"
+	if options, ok := panel["options"].(map[string]interface{}); ok {
+		delete(options, "angular")
+	}
+}
+
+// migrateModel applies the panel model migrations newer than fromVersion, and returns the upgraded model
+// and whether a migration was needed.
+func migrateModel(model json.RawMessage, fromVersion int64) (json.RawMessage, bool, error) {
+	if fromVersion >= currentPanelSchemaVersion {
+		return model, false, nil
+	}
+
+	var panel map[string]interface{}
+	if err := json.Unmarshal(model, &panel); err != nil {
+		return nil, false, err
+	}
+
+	for _, migration := range panelModelMigrations {
+		if migration.version > fromVersion {
+			migration.migrate(panel)
+		}
+	}
+
+	upgraded, err := json.Marshal(panel)
+	if err != nil {
+		return nil, false, err
+	}
+
+	return upgraded, true, nil
+}
+
+// upgradeLibraryPanelModels upgrades stale models of the given Library Panels in memory, so that readers get
+// current models before the background upgrade has stored them. Models that can't be parsed, and library
+// variables, are left as is.
+func upgradeLibraryPanelModels(libraryPanels []LibraryPanel) {
+	for i := range libraryPanels {
+		if libraryPanels[i].Kind != panelElement {
+			continue
+		}
+
+		model, upgraded, err := migrateModel(libraryPanels[i].Model, libraryPanels[i].SchemaVersion)
+		if err != nil || !upgraded {
+			continue
+		}
+
+		libraryPanels[i].Model = model
+		libraryPanels[i].SchemaVersion = currentPanelSchemaVersion
+	}
+}
+
+// upgradeStoredLibraryPanelModels upgrades and stores all stale Library Panel models, and returns the
+// number of Library Panels that were upgraded.
+func (lps *LibraryPanelService) upgradeStoredLibraryPanelModels() (int, error) {
+	upgraded := 0
+	err := lps.SQLStore.WithTransactionalDbSession(context.Background(), func(session *sqlstore.DBSession) error {
+		var libraryPanels []LibraryPanel
+		if err := session.Table("library_panel").Where("kind=? AND schema_version < ?", panelElement, currentPanelSchemaVersion).Find(&libraryPanels); err != nil {
+			return err
+		}
+
+		for _, panel := range libraryPanels {
+			model, _, err := migrateModel(panel.Model, panel.SchemaVersion)
+			if err != nil {
+				lps.log.Warn("Failed to upgrade library panel model", "uid", panel.UID, "error", err)
+				continue
+			}
+
+			if _, err := session.Exec("UPDATE library_panel SET model=?, model_hash=?, schema_version=? WHERE id=?",
+				string(encodeStoredModel(model, lps.modelCompression)), modelHash(model), currentPanelSchemaVersion, panel.ID); err != nil {
+				return err
+			}
+			upgraded++
+		}
+
+		return nil
+	})
+	if err == nil && upgraded > 0 {
+		lps.invalidateLibraryPanelCache()
+	}
+
+	return upgraded, err
+}
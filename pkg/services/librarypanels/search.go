@@ -0,0 +1,316 @@
+package librarypanels
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/search"
+	"github.com/grafana/grafana/pkg/services/sqlstore"
+	"github.com/grafana/grafana/pkg/services/sqlstore/migrator"
+)
+
+const (
+	defaultSearchPerPage = 30
+	maxSearchPerPage     = 100
+)
+
+// searchLibraryPanelsQuery is the query for searching LibraryPanels.
+type searchLibraryPanelsQuery struct {
+	Query   string
+	Page    int
+	PerPage int
+	// Kind is the kind of library elements to search, Library Panels if not set.
+	Kind libraryElementKind
+	// Status, if set, limits the result to draft or published panels.
+	Status string
+	// IncludeModel includes the models of the panels in the result.
+	IncludeModel bool
+}
+
+// searchLibraryPanelsResult is the result of searching LibraryPanels.
+type searchLibraryPanelsResult struct {
+	TotalCount    int64          `json:"totalCount"`
+	LibraryPanels []LibraryPanel `json:"libraryPanels"`
+	Page          int            `json:"page"`
+	PerPage       int            `json:"perPage"`
+	Facets        searchFacets   `json:"facets"`
+}
+
+// libraryPanelTagCount is the number of Library Panels with a tag.
+type libraryPanelTagCount struct {
+	Term  string `json:"term" xorm:"term"`
+	Count int64  `json:"count" xorm:"count"`
+}
+
+// searchFacets are the number of Library Panels matching a search, by folder, by panel type and by tag, for
+// filtering the search further. They are sorted from the most to the least Library Panels.
+type searchFacets struct {
+	ByFolder []libraryPanelFolderCount `json:"byFolder"`
+	ByType   []libraryPanelTypeCount   `json:"byType"`
+	ByTag    []libraryPanelTagCount    `json:"byTag"`
+}
+
+// libraryPanelSearchHit is the projection used to build search hits for library panels.
+type libraryPanelSearchHit struct {
+	ID          int64  `xorm:"id"`
+	UID         string `xorm:"uid"`
+	Name        string
+	FolderID    int64  `xorm:"folder_id"`
+	FolderUID   string `xorm:"folder_uid"`
+	FolderSlug  string `xorm:"folder_slug"`
+	FolderTitle string `xorm:"folder_title"`
+}
+
+// searchLibraryPanels searches Library Panels by name, tags, and the title and description in the model.
+// Results are ranked with exact name matches first, then name prefix matches, then everything else. The models
+// are only included if the query asks for them. The facets count all matches, not only the page of results.
+func (lps *LibraryPanelService) searchLibraryPanels(c *models.ReqContext, query searchLibraryPanelsQuery) (searchLibraryPanelsResult, error) {
+	if query.PerPage <= 0 {
+		query.PerPage = defaultSearchPerPage
+	}
+	if query.PerPage > maxSearchPerPage {
+		query.PerPage = maxSearchPerPage
+	}
+	if query.Page <= 0 {
+		query.Page = 1
+	}
+	if query.Kind == 0 {
+		query.Kind = panelElement
+	}
+
+	result := searchLibraryPanelsResult{
+		LibraryPanels: make([]LibraryPanel, 0),
+		Page:          query.Page,
+		PerPage:       query.PerPage,
+	}
+	err := lps.SQLStore.WithReadReplicaDbSession(context.Background(), func(session *sqlstore.DBSession) error {
+		dialect := lps.SQLStore.Dialect
+		term := strings.TrimSpace(query.Query)
+
+		where := sqlstore.SQLBuilder{}
+		where.Write(" WHERE library_panel.org_id=? AND library_panel.kind=?", c.SignedInUser.OrgId, query.Kind)
+		writeStatusFilter(&where, dialect, c.SignedInUser, query.Status)
+		writePermissionFilter(&where, dialect, c.SignedInUser, models.PERMISSION_VIEW)
+		if term != "" {
+			like := " " + dialect.LikeStr() + " ?" + likeEscape
+			wildcard := "%" + escapeLike(term) + "%"
+			where.Write(" AND (library_panel.name"+like, wildcard)
+			modelFields := []string{"title", "description"}
+			if _, ok := lps.jsonTextSQL("library_panel.model", "title"); ok {
+				for _, field := range modelFields {
+					expr, _ := lps.jsonTextSQL("library_panel.model", field)
+					where.Write(" OR "+expr+like, wildcard)
+				}
+			} else if lps.modelsFilterable() {
+				// the database can't extract JSON paths, compressed models can't be matched by the database at all
+				ids, err := findModelValueMatches(session, dialect, c.SignedInUser.OrgId, query.Kind, modelFields, term)
+				if err != nil {
+					return err
+				}
+				if len(ids) > 0 {
+					params := make([]interface{}, 0, len(ids))
+					for _, id := range ids {
+						params = append(params, id)
+					}
+					where.Write(" OR library_panel.id IN (?"+strings.Repeat(",?", len(ids)-1)+")", params...)
+				}
+			}
+			where.Write(" OR EXISTS (SELECT 1 FROM library_panel_tag WHERE library_panel_tag.librarypanel_id = library_panel.id AND library_panel_tag.term"+like+")", wildcard)
+			where.Write(")")
+		}
+
+		count := sqlstore.SQLBuilder{}
+		count.Write("SELECT COUNT(*) FROM library_panel" + where.GetSQLString())
+		count.AddParams(where.GetParams()...)
+		if _, err := session.SQL(count.GetSQLString(), count.GetParams()...).Get(&result.TotalCount); err != nil {
+			return err
+		}
+		var err error
+		if result.Facets, err = lps.getSearchFacets(session, where); err != nil {
+			return err
+		}
+
+		builder := sqlstore.SQLBuilder{}
+		builder.Write("SELECT " + libraryPanelColumns(query.IncludeModel) + " FROM library_panel" + where.GetSQLString())
+		builder.AddParams(where.GetParams()...)
+		if term != "" {
+			builder.Write(" ORDER BY CASE WHEN LOWER(library_panel.name) = ? THEN 0", strings.ToLower(term))
+			builder.Write(" WHEN LOWER(library_panel.name) "+dialect.LikeStr()+" ?"+likeEscape+" THEN 1", escapeLike(strings.ToLower(term))+"%")
+			builder.Write(" ELSE 2 END, library_panel.name ASC")
+		} else {
+			builder.Write(" ORDER BY library_panel.name ASC")
+		}
+		builder.Write(dialect.LimitOffset(int64(query.PerPage), int64((query.Page-1)*query.PerPage)))
+
+		if err := session.SQL(builder.GetSQLString(), builder.GetParams()...).Find(&result.LibraryPanels); err != nil {
+			return err
+		}
+
+		if query.IncludeModel {
+			upgradeLibraryPanelModels(result.LibraryPanels)
+		}
+		if err := loadConnectedDashboardCounts(session, result.LibraryPanels); err != nil {
+			return err
+		}
+		return loadLibraryPanelTags(session, result.LibraryPanels)
+	})
+
+	return result, err
+}
+
+// likeEscape is the ESCAPE clause of LIKE conditions with patterns escaped by escapeLike. The escape character
+// is ! rather than a backslash, since the databases quote backslashes in string literals differently.
+const likeEscape = " ESCAPE '!'"
+
+// escapeLike escapes the wildcards of LIKE in user input, so it only matches literally in a LIKE pattern.
+func escapeLike(s string) string {
+	return strings.NewReplacer("!", "!!", "%", "!%", "_", "!_").Replace(s)
+}
+
+// findModelValueMatches returns the IDs of the library elements of the org with the term in the string values of
+// the keys of their models, for databases that can't extract JSON paths. The models are narrowed down with LIKE
+// and then matched in Go, so the term doesn't match the keys of the models.
+func findModelValueMatches(session *sqlstore.DBSession, dialect migrator.Dialect, orgID int64, kind libraryElementKind, keys []string, term string) ([]int64, error) {
+	var libraryPanels []LibraryPanel
+	if err := session.SQL("SELECT library_panel.id, library_panel.model FROM library_panel WHERE org_id=? AND kind=? AND model "+
+		dialect.LikeStr()+" ?"+likeEscape, orgID, kind, "%"+escapeLike(term)+"%").Find(&libraryPanels); err != nil {
+		return nil, err
+	}
+
+	term = strings.ToLower(term)
+	ids := make([]int64, 0)
+	for _, panel := range libraryPanels {
+		var model map[string]interface{}
+		if err := json.Unmarshal(panel.Model, &model); err != nil {
+			continue
+		}
+		for _, key := range keys {
+			if value, ok := model[key].(string); ok && strings.Contains(strings.ToLower(value), term) {
+				ids = append(ids, panel.ID)
+				break
+			}
+		}
+	}
+
+	return ids, nil
+}
+
+// getSearchFacets counts the Library Panels matching the where clause of a search by folder, type and tag.
+func (lps *LibraryPanelService) getSearchFacets(session *sqlstore.DBSession, where sqlstore.SQLBuilder) (searchFacets, error) {
+	facets := searchFacets{ByType: make([]libraryPanelTypeCount, 0), ByTag: make([]libraryPanelTagCount, 0)}
+
+	var byFolder []struct {
+		FolderID int64 `xorm:"folder_id"`
+		Count    int64 `xorm:"count"`
+	}
+	if err := session.SQL("SELECT library_panel.folder_id, COUNT(*) AS count FROM library_panel"+where.GetSQLString()+
+		" GROUP BY library_panel.folder_id", where.GetParams()...).Find(&byFolder); err != nil {
+		return facets, err
+	}
+	folderCounts := make(map[int64]int64, len(byFolder))
+	for _, folder := range byFolder {
+		folderCounts[folder.FolderID] = folder.Count
+	}
+	var err error
+	if facets.ByFolder, err = getLibraryPanelFolderCounts(session, folderCounts); err != nil {
+		return facets, err
+	}
+
+	if expr, ok := lps.jsonTextSQL("library_panel.model", "type"); ok {
+		if err := session.SQL("SELECT COALESCE("+expr+", '') AS type, COUNT(*) AS count FROM library_panel"+where.GetSQLString()+
+			" GROUP BY "+expr+" ORDER BY count DESC, type ASC", where.GetParams()...).Find(&facets.ByType); err != nil {
+			return facets, err
+		}
+	} else {
+		// the database can't extract the type in SQL, so only the models are read
+		var libraryPanels []LibraryPanel
+		if err := session.SQL("SELECT library_panel.model FROM library_panel"+where.GetSQLString(), where.GetParams()...).Find(&libraryPanels); err != nil {
+			return facets, err
+		}
+		facets.ByType = countLibraryPanelTypes(libraryPanels)
+	}
+
+	err = session.SQL(`SELECT library_panel_tag.term, COUNT(*) AS count FROM library_panel_tag
+		INNER JOIN library_panel ON library_panel.id = library_panel_tag.librarypanel_id`+where.GetSQLString()+
+		" GROUP BY library_panel_tag.term ORDER BY count DESC, library_panel_tag.term ASC", where.GetParams()...).Find(&facets.ByTag)
+	return facets, err
+}
+
+// findLibraryPanelsHandler handles search.FindLibraryPanelsQuery, which makes library panels
+// part of the results of the main search API.
+func (lps *LibraryPanelService) findLibraryPanelsHandler(query *search.FindLibraryPanelsQuery) error {
+	limit := query.Limit
+	if limit < 1 {
+		limit = 1000
+	}
+	page := query.Page
+	if page < 1 {
+		page = 1
+	}
+
+	var hits []libraryPanelSearchHit
+	err := lps.SQLStore.WithReadReplicaDbSession(context.Background(), func(session *sqlstore.DBSession) error {
+		dialect := lps.SQLStore.Dialect
+		builder := sqlstore.SQLBuilder{}
+		builder.Write(`SELECT library_panel.id, library_panel.uid, library_panel.name, library_panel.folder_id,
+			folder.uid AS folder_uid, folder.slug AS folder_slug, folder.title AS folder_title
+			FROM library_panel
+			LEFT JOIN dashboard AS folder ON folder.id = library_panel.folder_id
+			WHERE library_panel.org_id=? AND library_panel.kind=? AND library_panel.status<>?`, query.SignedInUser.OrgId, panelElement, statusDraft)
+		if query.Title != "" {
+			builder.Write(" AND library_panel.name "+dialect.LikeStr()+" ?"+likeEscape, "%"+escapeLike(query.Title)+"%")
+		}
+		if len(query.FolderIds) > 0 {
+			builder.Write(" AND library_panel.folder_id IN (?" + strings.Repeat(",?", len(query.FolderIds)-1) + ")")
+			for _, id := range query.FolderIds {
+				builder.AddParams(id)
+			}
+		}
+		for _, tag := range query.Tags {
+			builder.Write(" AND EXISTS (SELECT 1 FROM library_panel_tag WHERE library_panel_tag.librarypanel_id = library_panel.id AND library_panel_tag.term = ?)", tag)
+		}
+		writePermissionFilter(&builder, dialect, query.SignedInUser, query.Permission)
+		if query.Descending {
+			builder.Write(" ORDER BY library_panel.name DESC")
+		} else {
+			builder.Write(" ORDER BY library_panel.name ASC")
+		}
+		builder.Write(dialect.LimitOffset(limit, (page-1)*limit))
+
+		if err := session.SQL(builder.GetSQLString(), builder.GetParams()...).Find(&hits); err != nil {
+			return err
+		}
+
+		panels := make([]LibraryPanel, 0, len(hits))
+		for _, hit := range hits {
+			panels = append(panels, LibraryPanel{ID: hit.ID})
+		}
+		if err := loadLibraryPanelTags(session, panels); err != nil {
+			return err
+		}
+
+		query.Result = make(search.HitList, 0, len(hits))
+		for i, hit := range hits {
+			searchHit := &search.Hit{
+				Id:          hit.ID,
+				Uid:         hit.UID,
+				Title:       hit.Name,
+				Type:        search.DashHitLibraryPanel,
+				Tags:        panels[i].Tags,
+				FolderId:    hit.FolderID,
+				FolderUid:   hit.FolderUID,
+				FolderTitle: hit.FolderTitle,
+			}
+			if hit.FolderID > 0 {
+				searchHit.FolderUrl = models.GetFolderUrl(hit.FolderUID, hit.FolderSlug)
+			}
+			query.Result = append(query.Result, searchHit)
+		}
+
+		return nil
+	})
+
+	return err
+}
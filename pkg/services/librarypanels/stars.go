@@ -0,0 +1,54 @@
+package librarypanels
+
+import (
+	"context"
+
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/sqlstore"
+)
+
+// libraryPanelStar is the model for the Library Panels users starred.
+type libraryPanelStar struct {
+	ID             int64 `xorm:"pk autoincr 'id'"`
+	UserID         int64 `xorm:"user_id"`
+	LibraryPanelID int64 `xorm:"librarypanel_id"`
+}
+
+// starLibraryPanel stars a Library Panel the user can view. Starring a starred Library Panel does nothing.
+func (lps *LibraryPanelService) starLibraryPanel(c *models.ReqContext, uid string) error {
+	if err := checkSignedInUser(c.SignedInUser); err != nil {
+		return err
+	}
+
+	libraryPanel, err := lps.getLibraryPanel(c, uid)
+	if err != nil {
+		return err
+	}
+
+	return lps.SQLStore.WithTransactionalDbSession(context.Background(), func(session *sqlstore.DBSession) error {
+		starred, err := session.Where("user_id=? AND librarypanel_id=?", c.SignedInUser.UserId, libraryPanel.ID).Count(&libraryPanelStar{})
+		if err != nil || starred > 0 {
+			return err
+		}
+
+		_, err = session.Insert(&libraryPanelStar{UserID: c.SignedInUser.UserId, LibraryPanelID: libraryPanel.ID})
+		return err
+	})
+}
+
+// unstarLibraryPanel unstars a Library Panel. Unstarring a Library Panel that isn't starred does nothing.
+func (lps *LibraryPanelService) unstarLibraryPanel(c *models.ReqContext, uid string) error {
+	if err := checkSignedInUser(c.SignedInUser); err != nil {
+		return err
+	}
+
+	return lps.SQLStore.WithTransactionalDbSession(context.Background(), func(session *sqlstore.DBSession) error {
+		libraryPanel, err := getLibraryPanel(session, uid, c.SignedInUser.OrgId)
+		if err != nil {
+			return err
+		}
+
+		_, err = session.Exec("DELETE FROM library_panel_star WHERE user_id=? AND librarypanel_id=?", c.SignedInUser.UserId, libraryPanel.ID)
+		return err
+	})
+}
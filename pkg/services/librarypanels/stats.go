@@ -0,0 +1,155 @@
+package librarypanels
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"time"
+
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/sqlstore"
+)
+
+// statsGrowthDays is the period the growth in the Library Panel statistics is counted over.
+const statsGrowthDays = 30
+
+// libraryPanelTypeCount is the number of Library Panels of a panel type.
+type libraryPanelTypeCount struct {
+	Type  string `json:"type" xorm:"type"`
+	Count int64  `json:"count" xorm:"count"`
+}
+
+// libraryPanelFolderCount is the number of Library Panels in a folder.
+type libraryPanelFolderCount struct {
+	FolderID    int64  `json:"folderId" xorm:"folder_id"`
+	FolderTitle string `json:"folderTitle" xorm:"folder_title"`
+	Count       int64  `json:"count" xorm:"count"`
+}
+
+// libraryPanelStats are the Library Panel statistics of an org.
+type libraryPanelStats struct {
+	Total       int64                     `json:"total"`
+	Connected   int64                     `json:"connected"`
+	Unconnected int64                     `json:"unconnected"`
+	ByType      []libraryPanelTypeCount   `json:"byType"`
+	ByFolder    []libraryPanelFolderCount `json:"byFolder"`
+	// CreatedLast30Days is the number of Library Panels created in the last 30 days.
+	CreatedLast30Days int64 `json:"createdLast30Days"`
+}
+
+// getLibraryPanelStats counts the Library Panels in the org, in total, by panel type, by folder, connected to
+// dashboards or not, and created in the last 30 days.
+func (lps *LibraryPanelService) getLibraryPanelStats(c *models.ReqContext) (libraryPanelStats, error) {
+	stats := libraryPanelStats{
+		ByType:   make([]libraryPanelTypeCount, 0),
+		ByFolder: make([]libraryPanelFolderCount, 0),
+	}
+	err := lps.SQLStore.WithReadReplicaDbSession(context.Background(), func(session *sqlstore.DBSession) error {
+		orgID := c.SignedInUser.OrgId
+		since := time.Now().AddDate(0, 0, -statsGrowthDays)
+
+		var totals struct {
+			Total     int64 `xorm:"total"`
+			Connected int64 `xorm:"connected"`
+			Recent    int64 `xorm:"recent"`
+		}
+		if _, err := session.SQL(`SELECT COUNT(*) AS total,
+			COALESCE(SUM(CASE WHEN EXISTS (SELECT 1 FROM library_panel_dashboard WHERE library_panel_dashboard.librarypanel_id = library_panel.id) THEN 1 ELSE 0 END), 0) AS connected,
+			COALESCE(SUM(CASE WHEN library_panel.created >= ? THEN 1 ELSE 0 END), 0) AS recent
+			FROM library_panel WHERE library_panel.org_id=? AND library_panel.kind=?`, since, orgID, panelElement).Get(&totals); err != nil {
+			return err
+		}
+		stats.Total = totals.Total
+		stats.Connected = totals.Connected
+		stats.Unconnected = totals.Total - totals.Connected
+		stats.CreatedLast30Days = totals.Recent
+
+		byFolder, err := countLibraryPanelsByFolder(session, orgID, panelElement)
+		if err != nil {
+			return err
+		}
+		if stats.ByFolder, err = getLibraryPanelFolderCounts(session, byFolder); err != nil {
+			return err
+		}
+
+		if expr, ok := lps.jsonTextSQL("model", "type"); ok {
+			return session.SQL(`SELECT COALESCE(`+expr+`, '') AS type, COUNT(*) AS count
+				FROM library_panel WHERE org_id=? AND kind=?
+				GROUP BY `+expr+`
+				ORDER BY count DESC, type ASC`, orgID, panelElement).Find(&stats.ByType)
+		}
+
+		// the database can't extract the type in SQL, so only the models are read
+		var rows []LibraryPanel
+		if err := session.Table("library_panel").Cols("model").Where("org_id=? AND kind=?", orgID, panelElement).Find(&rows); err != nil {
+			return err
+		}
+		stats.ByType = countLibraryPanelTypes(rows)
+		return nil
+	})
+
+	return stats, err
+}
+
+// getLibraryPanelFolderCounts adds the folder titles to the number of Library Panels by folder, and sorts them
+// from the most to the least Library Panels.
+func getLibraryPanelFolderCounts(session *sqlstore.DBSession, byFolder map[int64]int64) ([]libraryPanelFolderCount, error) {
+	folderIDs := make([]int64, 0, len(byFolder))
+	for folderID := range byFolder {
+		folderIDs = append(folderIDs, folderID)
+	}
+
+	titles := make(map[int64]string, len(folderIDs))
+	if len(folderIDs) > 0 {
+		var folders []struct {
+			ID    int64  `xorm:"id"`
+			Title string `xorm:"title"`
+		}
+		if err := session.Table("dashboard").Cols("id", "title").In("id", folderIDs).Find(&folders); err != nil {
+			return nil, err
+		}
+		for _, folder := range folders {
+			titles[folder.ID] = folder.Title
+		}
+	}
+
+	counts := make([]libraryPanelFolderCount, 0, len(byFolder))
+	for folderID, count := range byFolder {
+		counts = append(counts, libraryPanelFolderCount{FolderID: folderID, FolderTitle: titles[folderID], Count: count})
+	}
+	sort.Slice(counts, func(i, j int) bool {
+		if counts[i].Count != counts[j].Count {
+			return counts[i].Count > counts[j].Count
+		}
+		return counts[i].FolderID < counts[j].FolderID
+	})
+
+	return counts, nil
+}
+
+// countLibraryPanelTypes is the fallback for counting the Library Panels by type when the database can't
+// extract the type from the model.
+func countLibraryPanelTypes(libraryPanels []LibraryPanel) []libraryPanelTypeCount {
+	counts := make(map[string]int64)
+	for _, panel := range libraryPanels {
+		var model struct {
+			Type string `json:"type"`
+		}
+		// invalid models are counted without a type, like in SQL
+		_ = json.Unmarshal(panel.Model, &model)
+		counts[model.Type]++
+	}
+
+	byType := make([]libraryPanelTypeCount, 0, len(counts))
+	for panelType, count := range counts {
+		byType = append(byType, libraryPanelTypeCount{Type: panelType, Count: count})
+	}
+	sort.Slice(byType, func(i, j int) bool {
+		if byType[i].Count != byType[j].Count {
+			return byType[i].Count > byType[j].Count
+		}
+		return byType[i].Type < byType[j].Type
+	})
+
+	return byType
+}
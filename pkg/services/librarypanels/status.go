@@ -0,0 +1,78 @@
+package librarypanels
+
+import (
+	"context"
+	"time"
+
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/sqlstore"
+	"github.com/grafana/grafana/pkg/services/sqlstore/migrator"
+)
+
+const (
+	statusDraft     = "draft"
+	statusPublished = "published"
+)
+
+// writeStatusFilter hides the drafts the user neither created nor can edit, and limits the query to the
+// given status if it is set.
+func writeStatusFilter(builder *sqlstore.SQLBuilder, dialect migrator.Dialect, user *models.SignedInUser, status string) {
+	editSQL, params := folderPermissionSQL(dialect, user, models.PERMISSION_EDIT)
+	if user.OrgRole == models.ROLE_VIEWER {
+		editSQL, params = "1=0", nil
+	}
+	builder.Write(" AND (library_panel.status<>? OR library_panel.created_by=? OR "+editSQL+")",
+		append([]interface{}{statusDraft, user.UserId}, params...)...)
+
+	if status != "" {
+		builder.Write(" AND library_panel.status=?", status)
+	}
+}
+
+// canEditLibraryPanel returns true if the user can edit the Library Panel: edit its folder and, if a team owns
+// it, be a member of the team.
+func canEditLibraryPanel(session *sqlstore.DBSession, dialect migrator.Dialect, user *models.SignedInUser, id int64) (bool, error) {
+	if user.OrgRole == models.ROLE_VIEWER {
+		return false, nil
+	}
+
+	builder := sqlstore.SQLBuilder{}
+	builder.Write("SELECT COUNT(*) FROM library_panel WHERE library_panel.id=?", id)
+	writePermissionFilter(&builder, dialect, user, models.PERMISSION_EDIT)
+	writeOwnerTeamFilter(&builder, user)
+
+	var count int64
+	if _, err := session.SQL(builder.GetSQLString(), builder.GetParams()...).Get(&count); err != nil {
+		return false, err
+	}
+
+	return count > 0, nil
+}
+
+// publishLibraryPanel publishes a draft Library Panel, which makes it visible to everyone who can view
+// its folder. Publishing requires edit permission.
+func (lps *LibraryPanelService) publishLibraryPanel(c *models.ReqContext, uid string) (LibraryPanel, error) {
+	var libraryPanel LibraryPanel
+	err := lps.SQLStore.WithTransactionalDbSession(context.Background(), func(session *sqlstore.DBSession) error {
+		var err error
+		libraryPanel, err = getLibraryPanel(session, uid, c.SignedInUser.OrgId)
+		if err != nil {
+			return err
+		}
+
+		if err := checkCanEditLibraryPanel(session, lps.SQLStore.Dialect, c.SignedInUser, libraryPanel); err != nil {
+			return err
+		}
+		if libraryPanel.Status == statusPublished {
+			return nil
+		}
+
+		libraryPanel.Status = statusPublished
+		libraryPanel.Updated = time.Now()
+		libraryPanel.UpdatedBy = c.SignedInUser.UserId
+		_, err = session.ID(libraryPanel.ID).Cols("status", "updated", "updated_by").Update(&libraryPanel)
+		return err
+	})
+
+	return libraryPanel, err
+}
@@ -0,0 +1,88 @@
+package librarypanels
+
+import (
+	"context"
+	"strings"
+
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/sqlstore"
+)
+
+const (
+	defaultSuggestLimit = 10
+	maxSuggestLimit     = 20
+	// maxSuggestQueryLength is the maximum number of characters of the name to suggest Library Panels for, longer
+	// queries are truncated.
+	maxSuggestQueryLength = 64
+)
+
+// suggestLibraryPanelsQuery is the query for suggesting Library Panels by name.
+type suggestLibraryPanelsQuery struct {
+	Query string
+	Limit int
+	// Kind is the kind of library elements to suggest, Library Panels if not set.
+	Kind libraryElementKind
+}
+
+// libraryPanelSuggestion is a Library Panel suggested for a search as you type.
+type libraryPanelSuggestion struct {
+	UID      string `json:"uid" xorm:"uid"`
+	Name     string `json:"name" xorm:"name"`
+	FolderID int64  `json:"folderId" xorm:"folder_id"`
+}
+
+// suggestLibraryPanels suggests Library Panels the user can view for the start of a name. Names are matched
+// if they contain the characters of the query in order, and ranked with prefix matches first, then names
+// containing the query, then the other matches. Only the columns of the suggestions are read, not the models.
+func (lps *LibraryPanelService) suggestLibraryPanels(c *models.ReqContext, query suggestLibraryPanelsQuery) ([]libraryPanelSuggestion, error) {
+	if query.Limit <= 0 {
+		query.Limit = defaultSuggestLimit
+	}
+	if query.Limit > maxSuggestLimit {
+		query.Limit = maxSuggestLimit
+	}
+	if query.Kind == 0 {
+		query.Kind = panelElement
+	}
+	term := []rune(strings.TrimSpace(query.Query))
+	if len(term) > maxSuggestQueryLength {
+		term = term[:maxSuggestQueryLength]
+	}
+
+	suggestions := make([]libraryPanelSuggestion, 0)
+	err := lps.SQLStore.WithReadReplicaDbSession(context.Background(), func(session *sqlstore.DBSession) error {
+		dialect := lps.SQLStore.Dialect
+		builder := sqlstore.SQLBuilder{}
+		builder.Write(`SELECT library_panel.uid, library_panel.name, library_panel.folder_id FROM library_panel
+			WHERE library_panel.org_id=? AND library_panel.kind=?`, c.SignedInUser.OrgId, query.Kind)
+		writeStatusFilter(&builder, dialect, c.SignedInUser, "")
+		writePermissionFilter(&builder, dialect, c.SignedInUser, models.PERMISSION_VIEW)
+		if len(term) > 0 {
+			like := " " + dialect.LikeStr() + " ?" + likeEscape
+			builder.Write(" AND library_panel.name"+like, fuzzyLikePattern(term))
+			builder.Write(" ORDER BY CASE WHEN library_panel.name"+like+" THEN 0", escapeLike(string(term))+"%")
+			builder.Write(" WHEN library_panel.name"+like+" THEN 1", "%"+escapeLike(string(term))+"%")
+			builder.Write(" ELSE 2 END, library_panel.name ASC")
+		} else {
+			builder.Write(" ORDER BY library_panel.name ASC")
+		}
+		builder.Write(dialect.Limit(int64(query.Limit)))
+
+		return session.SQL(builder.GetSQLString(), builder.GetParams()...).Find(&suggestions)
+	})
+
+	return suggestions, err
+}
+
+// fuzzyLikePattern returns the LIKE pattern matching the strings that contain the characters of the term in
+// order, for example %c%p%u% for cpu. The wildcards of LIKE in the term are escaped with escapeLike.
+func fuzzyLikePattern(term []rune) string {
+	var pattern strings.Builder
+	pattern.WriteString("%")
+	for _, r := range term {
+		pattern.WriteString(escapeLike(string(r)))
+		pattern.WriteString("%")
+	}
+
+	return pattern.String()
+}
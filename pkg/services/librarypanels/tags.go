@@ -0,0 +1,119 @@
+package librarypanels
+
+import (
+	"context"
+	"strings"
+
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/sqlstore"
+)
+
+// maxTagLength is the length of the term column of library_panel_tag.
+const maxTagLength = 50
+
+// bulkTagCommand is the command for adding a tag to, or removing a tag from, many Library Panels at once.
+type bulkTagCommand struct {
+	Tag string `json:"tag"`
+	// UIDs are the Library Panels to change. Without UIDs, the Library Panels matching the filter are changed.
+	UIDs   []string      `json:"uids"`
+	Filter bulkTagFilter `json:"filter"`
+}
+
+// bulkTagFilter selects the Library Panels of a bulkTagCommand without UIDs. At least one of FolderID and Tag
+// has to be set, so that a request can't change the whole library by accident.
+type bulkTagFilter struct {
+	// Kind is the kind of library elements to change, Library Panels if not set.
+	Kind libraryElementKind `json:"kind"`
+	// FolderID, if set, limits the change to the Library Panels in that folder, 0 being the General folder.
+	FolderID *int64 `json:"folderId"`
+	// Tag, if set, limits the change to the Library Panels with that tag.
+	Tag string `json:"tag"`
+}
+
+// bulkTagResult is the number of Library Panels that got or lost the tag.
+type bulkTagResult struct {
+	LibraryPanels int64 `json:"libraryPanels"`
+}
+
+// addLibraryPanelTag adds the tag to the Library Panels of the command that don't have it yet, in a single
+// statement.
+func (lps *LibraryPanelService) addLibraryPanelTag(c *models.ReqContext, cmd bulkTagCommand) (bulkTagResult, error) {
+	return lps.changeLibraryPanelTag(c, cmd, func(where *sqlstore.SQLBuilder, tag string) *sqlstore.SQLBuilder {
+		builder := &sqlstore.SQLBuilder{}
+		builder.Write("INSERT INTO library_panel_tag (librarypanel_id, term) SELECT library_panel.id, ? FROM library_panel", tag)
+		builder.Write(where.GetSQLString(), where.GetParams()...)
+		builder.Write(` AND NOT EXISTS (SELECT 1 FROM library_panel_tag AS existing
+			WHERE existing.librarypanel_id = library_panel.id AND existing.term = ?)`, tag)
+		return builder
+	})
+}
+
+// removeLibraryPanelTag removes the tag from the Library Panels of the command, in a single statement.
+func (lps *LibraryPanelService) removeLibraryPanelTag(c *models.ReqContext, cmd bulkTagCommand) (bulkTagResult, error) {
+	return lps.changeLibraryPanelTag(c, cmd, func(where *sqlstore.SQLBuilder, tag string) *sqlstore.SQLBuilder {
+		// MySQL can't delete from a table that a subquery reads, unless the subquery is a derived table
+		builder := &sqlstore.SQLBuilder{}
+		builder.Write("DELETE FROM library_panel_tag WHERE term=? AND librarypanel_id IN (SELECT id FROM (SELECT library_panel.id FROM library_panel", tag)
+		builder.Write(where.GetSQLString(), where.GetParams()...)
+		builder.Write(") AS changed)")
+		return builder
+	})
+}
+
+// changeLibraryPanelTag runs the statement built by statement for the Library Panels of the command that the user
+// can edit. Library Panels synced from Git and replicated copies are skipped, like they can't be patched.
+func (lps *LibraryPanelService) changeLibraryPanelTag(c *models.ReqContext, cmd bulkTagCommand,
+	statement func(where *sqlstore.SQLBuilder, tag string) *sqlstore.SQLBuilder) (bulkTagResult, error) {
+	result := bulkTagResult{}
+	tag := strings.TrimSpace(cmd.Tag)
+	if tag == "" || len(tag) > maxTagLength {
+		return result, errLibraryPanelInvalidBulkTag
+	}
+	if len(cmd.UIDs) == 0 && cmd.Filter.FolderID == nil && strings.TrimSpace(cmd.Filter.Tag) == "" {
+		return result, errLibraryPanelInvalidBulkTag
+	}
+	if c.SignedInUser.OrgRole == models.ROLE_VIEWER {
+		return result, errLibraryPanelPermissionDenied
+	}
+
+	kind := cmd.Filter.Kind
+	if kind == 0 {
+		kind = panelElement
+	}
+	where := sqlstore.SQLBuilder{}
+	where.Write(" WHERE library_panel.org_id=? AND library_panel.kind=? AND library_panel.sync_path='' AND library_panel.replica_of=0",
+		c.SignedInUser.OrgId, kind)
+	if len(cmd.UIDs) > 0 {
+		params := make([]interface{}, 0, len(cmd.UIDs))
+		for _, uid := range cmd.UIDs {
+			params = append(params, uid)
+		}
+		where.Write(" AND library_panel.uid IN (?"+strings.Repeat(",?", len(cmd.UIDs)-1)+")", params...)
+	} else {
+		if cmd.Filter.FolderID != nil {
+			where.Write(" AND library_panel.folder_id=?", *cmd.Filter.FolderID)
+		}
+		if filterTag := strings.TrimSpace(cmd.Filter.Tag); filterTag != "" {
+			where.Write(` AND EXISTS (SELECT 1 FROM library_panel_tag AS tagged
+				WHERE tagged.librarypanel_id = library_panel.id AND tagged.term = ?)`, filterTag)
+		}
+	}
+	writePermissionFilter(&where, lps.SQLStore.Dialect, c.SignedInUser, models.PERMISSION_EDIT)
+	writeOwnerTeamFilter(&where, c.SignedInUser)
+
+	err := lps.SQLStore.WithTransactionalDbSession(context.Background(), func(session *sqlstore.DBSession) error {
+		builder := statement(&where, tag)
+		res, err := session.Exec(append([]interface{}{builder.GetSQLString()}, builder.GetParams()...)...)
+		if err != nil {
+			return err
+		}
+
+		result.LibraryPanels, err = res.RowsAffected()
+		return err
+	})
+	if err == nil && result.LibraryPanels > 0 {
+		lps.invalidateLibraryPanelCache()
+	}
+
+	return result, err
+}
@@ -0,0 +1,72 @@
+package librarypanels
+
+import (
+	"context"
+	"strconv"
+	"strings"
+
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/sqlstore"
+)
+
+// ownedByTeamPrefix is the prefix of the team ids in the ownedBy filter, like team:123.
+const ownedByTeamPrefix = "team:"
+
+// parseOwnedBy returns the team id of an ownedBy filter.
+func parseOwnedBy(ownedBy string) (int64, error) {
+	if !strings.HasPrefix(ownedBy, ownedByTeamPrefix) {
+		return 0, errLibraryPanelInvalidOwnedBy
+	}
+	teamID, err := strconv.ParseInt(strings.TrimPrefix(ownedBy, ownedByTeamPrefix), 10, 64)
+	if err != nil || teamID <= 0 {
+		return 0, errLibraryPanelInvalidOwnedBy
+	}
+
+	return teamID, nil
+}
+
+// checkOwnerTeam returns errLibraryPanelInvalidOwnerTeam if the team isn't a team of the org. Team 0 is no team.
+func checkOwnerTeam(session *sqlstore.DBSession, orgID int64, teamID int64) error {
+	if teamID == 0 {
+		return nil
+	}
+
+	exists, err := session.Table("team").Where("id=? AND org_id=?", teamID, orgID).Exist()
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return errLibraryPanelInvalidOwnerTeam
+	}
+
+	return nil
+}
+
+// writeOwnerTeamFilter limits the query to Library Panels without owning team or owned by a team of the user.
+// Org admins can edit all Library Panels.
+func writeOwnerTeamFilter(builder *sqlstore.SQLBuilder, user *models.SignedInUser) {
+	if user.OrgRole == models.ROLE_ADMIN {
+		return
+	}
+
+	builder.Write(" AND (library_panel.owner_team_id = 0 OR library_panel.owner_team_id IN (SELECT team_id FROM team_member WHERE user_id=?))",
+		user.UserId)
+}
+
+// getLibraryPanelsWithoutOwnerTeam gets the Library Panels in the org that no team owns, including the ones
+// owned by a team that was deleted.
+func (lps *LibraryPanelService) getLibraryPanelsWithoutOwnerTeam(c *models.ReqContext) ([]LibraryPanel, error) {
+	libraryPanels := make([]LibraryPanel, 0)
+	err := lps.SQLStore.WithReadReplicaDbSession(context.Background(), func(session *sqlstore.DBSession) error {
+		if err := session.SQL(`SELECT * FROM library_panel WHERE org_id=? AND kind=? AND (
+			owner_team_id = 0 OR NOT EXISTS (SELECT 1 FROM team WHERE team.id = library_panel.owner_team_id))
+			ORDER BY name ASC`, c.SignedInUser.OrgId, panelElement).Find(&libraryPanels); err != nil {
+			return err
+		}
+
+		upgradeLibraryPanelModels(libraryPanels)
+		return loadLibraryPanelTags(session, libraryPanels)
+	})
+
+	return libraryPanels, err
+}
@@ -0,0 +1,233 @@
+package librarypanels
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/grafana/grafana/pkg/models"
+)
+
+// Input types of panel templates.
+const (
+	templateInputDatasource = "datasource"
+	templateInputMetric     = "metric"
+	templateInputThreshold  = "threshold"
+)
+
+// metricKeys are the keys of panel targets that hold the metric a target queries, in the query editors of the
+// core data sources.
+var metricKeys = []string{"expr", "metric", "metricName", "measurement", "target"}
+
+var nonInputNameChars = regexp.MustCompile(`[^A-Z0-9]+`)
+
+// templateInput is a value of a library panel that a panel template leaves to be set when it is instantiated.
+// The model of the template has "${Name}" where the value was.
+type templateInput struct {
+	Name  string `json:"name"`
+	Label string `json:"label"`
+	Type  string `json:"type"`
+	// Value is the value of the exported library panel, it is used when an instantiation doesn't set the input.
+	Value interface{} `json:"value"`
+}
+
+// panelTemplate is a Library Panel with its data sources, metrics and thresholds replaced by inputs, like the
+// __inputs of exported dashboards.
+type panelTemplate struct {
+	Inputs []templateInput    `json:"__inputs"`
+	Name   string             `json:"name"`
+	Kind   libraryElementKind `json:"kind"`
+	Model  json.RawMessage    `json:"model"`
+	Tags   []string           `json:"tags"`
+}
+
+// instantiateTemplateCommand is the command for creating a Library Panel from a panel template.
+type instantiateTemplateCommand struct {
+	Template panelTemplate `json:"template"`
+	// Inputs are the values of the inputs of the template by name.
+	Inputs   map[string]interface{} `json:"inputs"`
+	FolderID *int64                 `json:"folderId"`
+	// Name is the name of the Library Panel, the name of the template if not set.
+	Name string `json:"name"`
+}
+
+// templateBuilder declares the inputs of a panel template while the model is walked.
+type templateBuilder struct {
+	inputs      []templateInput
+	datasources map[string]string
+	counts      map[string]int
+}
+
+func (b *templateBuilder) placeholder(name string) string {
+	return "${" + name + "}"
+}
+
+func (b *templateBuilder) datasource(name string) string {
+	if input, ok := b.datasources[name]; ok {
+		return b.placeholder(input)
+	}
+	input := "DS_" + strings.Trim(nonInputNameChars.ReplaceAllString(strings.ToUpper(name), "_"), "_")
+	b.datasources[name] = input
+	b.inputs = append(b.inputs, templateInput{Name: input, Label: name, Type: templateInputDatasource, Value: name})
+
+	return b.placeholder(input)
+}
+
+func (b *templateBuilder) add(inputType string, prefix string, label string, value interface{}) string {
+	b.counts[inputType]++
+	input := fmt.Sprintf("%s_%d", prefix, b.counts[inputType])
+	b.inputs = append(b.inputs, templateInput{Name: input, Label: label, Type: inputType, Value: value})
+
+	return b.placeholder(input)
+}
+
+// thresholdSteps replaces the values of threshold steps with inputs. The base step has no value.
+func (b *templateBuilder) thresholdSteps(steps []interface{}) {
+	for _, step := range steps {
+		object, ok := step.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if value, ok := object["value"].(float64); ok {
+			object["value"] = b.add(templateInputThreshold, "THRESHOLD", fmt.Sprintf("Threshold %v", value), value)
+		}
+	}
+}
+
+// panel replaces the data sources, metrics and thresholds of a panel, and of the panels of a row, with inputs.
+func (b *templateBuilder) panel(panel map[string]interface{}) {
+	if name, ok := panel["datasource"].(string); ok && name != "" && !strings.HasPrefix(name, "$") {
+		panel["datasource"] = b.datasource(name)
+	}
+	if targets, ok := panel["targets"].([]interface{}); ok {
+		for _, target := range targets {
+			object, ok := target.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			if name, ok := object["datasource"].(string); ok && name != "" && !strings.HasPrefix(name, "$") {
+				object["datasource"] = b.datasource(name)
+			}
+			for _, key := range metricKeys {
+				if metric, ok := object[key].(string); ok && metric != "" {
+					object[key] = b.add(templateInputMetric, "METRIC", metric, metric)
+				}
+			}
+		}
+	}
+	if fieldConfig, ok := panel["fieldConfig"].(map[string]interface{}); ok {
+		if defaults, ok := fieldConfig["defaults"].(map[string]interface{}); ok {
+			if thresholds, ok := defaults["thresholds"].(map[string]interface{}); ok {
+				if steps, ok := thresholds["steps"].([]interface{}); ok {
+					b.thresholdSteps(steps)
+				}
+			}
+		}
+	}
+	// the graph panel keeps its thresholds in a list of its own
+	if thresholds, ok := panel["thresholds"].([]interface{}); ok {
+		b.thresholdSteps(thresholds)
+	}
+	if panels, ok := panel["panels"].([]interface{}); ok {
+		for _, child := range panels {
+			if object, ok := child.(map[string]interface{}); ok {
+				b.panel(object)
+			}
+		}
+	}
+}
+
+// getPanelTemplate exports a Library Panel as a panel template, with its data sources, metrics and threshold
+// values replaced by inputs.
+func (lps *LibraryPanelService) getPanelTemplate(c *models.ReqContext, uid string) (panelTemplate, error) {
+	libraryPanel, err := lps.getLibraryPanel(c, uid)
+	if err != nil {
+		return panelTemplate{}, err
+	}
+
+	var model map[string]interface{}
+	if err := json.Unmarshal(libraryPanel.Model, &model); err != nil {
+		return panelTemplate{}, err
+	}
+	builder := templateBuilder{inputs: make([]templateInput, 0), datasources: map[string]string{}, counts: map[string]int{}}
+	if libraryPanel.Kind == panelElement || libraryPanel.Kind == rowElement {
+		builder.panel(model)
+	}
+	templateModel, err := json.Marshal(model)
+	if err != nil {
+		return panelTemplate{}, err
+	}
+
+	return panelTemplate{
+		Inputs: builder.inputs,
+		Name:   libraryPanel.Name,
+		Kind:   libraryPanel.Kind,
+		Model:  templateModel,
+		Tags:   libraryPanel.Tags,
+	}, nil
+}
+
+// instantiateTemplate creates a Library Panel from a panel template, replacing the inputs in its model by the
+// values of the command or else the values of the exported Library Panel.
+func (lps *LibraryPanelService) instantiateTemplate(c *models.ReqContext, cmd instantiateTemplateCommand) (LibraryPanel, error) {
+	values := make(map[string]interface{}, len(cmd.Template.Inputs))
+	for _, input := range cmd.Template.Inputs {
+		value, ok := cmd.Inputs[input.Name]
+		if !ok || value == nil {
+			value = input.Value
+		}
+		if value == nil || value == "" {
+			return LibraryPanel{}, fmt.Errorf("%w: %s", errLibraryPanelMissingTemplateInput, input.Name)
+		}
+		values[input.Name] = value
+	}
+
+	var model interface{}
+	if err := json.Unmarshal(cmd.Template.Model, &model); err != nil {
+		return LibraryPanel{}, modelValidationErrors{{Field: "template.model", Message: "must be a JSON object"}}
+	}
+	concrete, err := json.Marshal(replaceTemplateInputs(model, values))
+	if err != nil {
+		return LibraryPanel{}, err
+	}
+
+	name := cmd.Name
+	if name == "" {
+		name = cmd.Template.Name
+	}
+	return lps.createLibraryPanel(c, createLibraryPanelCommand{
+		FolderID: cmd.FolderID,
+		Name:     name,
+		Kind:     cmd.Template.Kind,
+		Model:    concrete,
+		Tags:     cmd.Template.Tags,
+	})
+}
+
+// replaceTemplateInputs replaces the strings that are a single "${NAME}" with the value of the input, keeping its
+// JSON type, and the inputs within other strings with the value as a string.
+func replaceTemplateInputs(value interface{}, values map[string]interface{}) interface{} {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		for key, child := range value {
+			value[key] = replaceTemplateInputs(child, values)
+		}
+	case []interface{}:
+		for i, child := range value {
+			value[i] = replaceTemplateInputs(child, values)
+		}
+	case string:
+		if strings.HasPrefix(value, "${") && strings.HasSuffix(value, "}") {
+			if input, ok := values[value[2:len(value)-1]]; ok {
+				return input
+			}
+		}
+		for name, input := range values {
+			value = strings.ReplaceAll(value, "${"+name+"}", fmt.Sprint(input))
+		}
+		return value
+	}
+
+	return value
+}
@@ -0,0 +1,277 @@
+// Package testutil has fixtures for the integration tests of packages that need library panels in the database,
+// like the dashboard and provisioning services. The fixtures write to the test database directly, without the
+// validation and permission checks of the library panel API, so tests can set up any state they need.
+//
+// The library panel tables are created by the migrations that run when the test database of a test binary is
+// initialized, so Setup has to be called before anything else in the binary calls sqlstore.InitTestDB. Tests
+// in the packages that the librarypanels package imports, like the dashboards package, can only use the fixtures
+// from an external test package.
+package testutil
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/macaron.v1"
+
+	"github.com/grafana/grafana/pkg/api/routing"
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/components/simplejson"
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/registry"
+	"github.com/grafana/grafana/pkg/services/librarypanels"
+	"github.com/grafana/grafana/pkg/services/quota"
+	"github.com/grafana/grafana/pkg/services/sqlstore"
+	"github.com/grafana/grafana/pkg/setting"
+	"github.com/grafana/grafana/pkg/util"
+)
+
+// DefaultModel is the model of the library panels that are created without a model.
+const DefaultModel = `{ "type": "text", "title": "Text - Library Panel" }`
+
+// Fixture is a test database with the library panel tables, and a library panel service using it.
+type Fixture struct {
+	t        *testing.T
+	SQLStore *sqlstore.SQLStore
+	// Service is initialized with the panelLibrary feature toggle, its bus handlers are on its own bus.
+	Service *librarypanels.LibraryPanelService
+}
+
+// Setup sets up the test database with the library panel tables and returns a Fixture for it. The database is
+// emptied, like it is by sqlstore.InitTestDB.
+func Setup(t *testing.T) *Fixture {
+	t.Helper()
+
+	cfg := setting.NewCfg()
+	cfg.FeatureToggles = map[string]bool{"panelLibrary": true}
+	service := &librarypanels.LibraryPanelService{
+		Bus:           bus.New(),
+		Cfg:           cfg,
+		QuotaService:  &quota.QuotaService{Cfg: cfg},
+		RouteRegister: routing.NewRouteRegister(),
+	}
+
+	// the service has to be in the registry with the feature toggle for its migrations to run
+	registry.RegisterOverride(func(d registry.Descriptor) (*registry.Descriptor, bool) {
+		if d.Name != "LibraryPanelService" {
+			return nil, false
+		}
+		return &registry.Descriptor{Name: "LibraryPanelService", Instance: service}, true
+	})
+	t.Cleanup(registry.ClearOverrides)
+
+	sqlStore := sqlstore.InitTestDB(t)
+	err := sqlStore.WithDbSession(context.Background(), func(session *sqlstore.DBSession) error {
+		exists, err := session.IsTableExist("library_panel")
+		if err == nil && !exists {
+			err = fmt.Errorf("the test database was initialized before testutil.Setup was called")
+		}
+		return err
+	})
+	require.NoError(t, err, "Failed to set up the library panel tables")
+
+	service.SQLStore = sqlStore
+	require.NoError(t, service.Init(), "Failed to init the library panel service")
+
+	return &Fixture{t: t, SQLStore: sqlStore, Service: service}
+}
+
+// CreateOrg creates an org and returns its ID.
+func (f *Fixture) CreateOrg(name string) int64 {
+	f.t.Helper()
+
+	org := models.Org{Name: name, Created: time.Now(), Updated: time.Now()}
+	f.insert(&org)
+
+	return org.Id
+}
+
+// CreateUser creates a user with the role in the org, and returns the user as signed in to the org.
+func (f *Fixture) CreateUser(orgID int64, login string, role models.RoleType) *models.SignedInUser {
+	f.t.Helper()
+
+	cmd := models.CreateUserCommand{Login: login, Email: login + "@example.com", Name: login, SkipOrgSetup: true}
+	require.NoError(f.t, sqlstore.CreateUser(context.Background(), &cmd), "Failed to create user")
+	f.insert(&models.OrgUser{OrgId: orgID, UserId: cmd.Result.Id, Role: role, Created: time.Now(), Updated: time.Now()})
+
+	return &models.SignedInUser{
+		UserId:     cmd.Result.Id,
+		OrgId:      orgID,
+		OrgRole:    role,
+		Login:      login,
+		Email:      cmd.Email,
+		Name:       login,
+		LastSeenAt: time.Now(),
+	}
+}
+
+// ReqContext returns a request context of the user, for calling the service as the user would through the API.
+func (f *Fixture) ReqContext(user *models.SignedInUser) *models.ReqContext {
+	return &models.ReqContext{
+		Context:      &macaron.Context{Req: macaron.Request{Request: &http.Request{URL: &url.URL{}, Header: http.Header{}}}},
+		SignedInUser: user,
+	}
+}
+
+// CreateFolder creates a folder in the org and returns its ID.
+func (f *Fixture) CreateFolder(orgID int64, title string) int64 {
+	f.t.Helper()
+
+	return f.saveDashboard(models.SaveDashboardCommand{
+		OrgId:     orgID,
+		IsFolder:  true,
+		Dashboard: simplejson.NewFromAny(map[string]interface{}{"title": title}),
+	}).Id
+}
+
+// CreateDashboard creates a dashboard in the folder with a panel for each of the library panels, which is
+// connected to the dashboard. The panels have the IDs 1, 2 and so on.
+func (f *Fixture) CreateDashboard(orgID int64, folderID int64, title string, libraryPanels ...librarypanels.LibraryPanel) *models.Dashboard {
+	f.t.Helper()
+
+	panels := make([]interface{}, 0, len(libraryPanels))
+	for i, libraryPanel := range libraryPanels {
+		panels = append(panels, map[string]interface{}{
+			"id":      i + 1,
+			"gridPos": map[string]interface{}{"h": 6, "w": 6, "x": 6 * (i % 4), "y": 6 * (i / 4)},
+			"libraryPanel": map[string]interface{}{
+				"uid":  libraryPanel.UID,
+				"name": libraryPanel.Name,
+			},
+		})
+	}
+	dashboard := f.saveDashboard(models.SaveDashboardCommand{
+		OrgId:    orgID,
+		FolderId: folderID,
+		Dashboard: simplejson.NewFromAny(map[string]interface{}{
+			"title":  title,
+			"panels": panels,
+		}),
+	})
+	for i, libraryPanel := range libraryPanels {
+		f.Connect(libraryPanel, dashboard.Id, int64(i+1))
+	}
+
+	return dashboard
+}
+
+// Connect connects the library panel to a panel of the dashboard, or to the dashboard if panelID is 0.
+func (f *Fixture) Connect(libraryPanel librarypanels.LibraryPanel, dashboardID int64, panelID int64) {
+	f.t.Helper()
+
+	f.exec("INSERT INTO library_panel_dashboard (librarypanel_id, dashboard_id, panel_id, created, created_by) VALUES (?, ?, ?, ?, ?)",
+		libraryPanel.ID, dashboardID, panelID, time.Now(), libraryPanel.CreatedBy)
+	f.exec("UPDATE library_panel SET last_connected_at=? WHERE id=?", time.Now(), libraryPanel.ID)
+}
+
+// LibraryPanel returns a builder of a published library panel in the General folder of the org, with the
+// DefaultModel and created by the user with ID 1.
+func (f *Fixture) LibraryPanel(orgID int64, name string) *LibraryPanelBuilder {
+	return &LibraryPanelBuilder{
+		fixture: f,
+		libraryPanel: librarypanels.LibraryPanel{
+			OrgID:     orgID,
+			UID:       util.GenerateShortUID(),
+			Name:      name,
+			Kind:      1,
+			Model:     json.RawMessage(DefaultModel),
+			Status:    "published",
+			CreatedBy: 1,
+			UpdatedBy: 1,
+		},
+		tags: make([]string, 0),
+	}
+}
+
+// LibraryPanelBuilder builds a library panel, which is stored by Create.
+type LibraryPanelBuilder struct {
+	fixture      *Fixture
+	libraryPanel librarypanels.LibraryPanel
+	tags         []string
+}
+
+// InFolder puts the library panel in the folder.
+func (b *LibraryPanelBuilder) InFolder(folderID int64) *LibraryPanelBuilder {
+	b.libraryPanel.FolderID = folderID
+	return b
+}
+
+// WithUID sets the UID of the library panel, instead of a generated one.
+func (b *LibraryPanelBuilder) WithUID(uid string) *LibraryPanelBuilder {
+	b.libraryPanel.UID = uid
+	return b
+}
+
+// WithModel sets the model of the library panel.
+func (b *LibraryPanelBuilder) WithModel(model string) *LibraryPanelBuilder {
+	b.libraryPanel.Model = json.RawMessage(model)
+	return b
+}
+
+// WithTags sets the tags of the library panel.
+func (b *LibraryPanelBuilder) WithTags(tags ...string) *LibraryPanelBuilder {
+	b.tags = tags
+	return b
+}
+
+// AsDraft makes the library panel a draft.
+func (b *LibraryPanelBuilder) AsDraft() *LibraryPanelBuilder {
+	b.libraryPanel.Status = "draft"
+	return b
+}
+
+// CreatedBy sets the user that created and last updated the library panel.
+func (b *LibraryPanelBuilder) CreatedBy(userID int64) *LibraryPanelBuilder {
+	b.libraryPanel.CreatedBy = userID
+	b.libraryPanel.UpdatedBy = userID
+	return b
+}
+
+// Create stores the library panel and returns it.
+func (b *LibraryPanelBuilder) Create() librarypanels.LibraryPanel {
+	b.fixture.t.Helper()
+
+	libraryPanel := b.libraryPanel
+	libraryPanel.Created = time.Now()
+	libraryPanel.Updated = time.Now()
+	libraryPanel.Tags = b.tags
+	b.fixture.insert(&libraryPanel)
+	for _, tag := range b.tags {
+		b.fixture.exec("INSERT INTO library_panel_tag (librarypanel_id, term) VALUES (?, ?)", libraryPanel.ID, tag)
+	}
+
+	return libraryPanel
+}
+
+func (f *Fixture) saveDashboard(cmd models.SaveDashboardCommand) *models.Dashboard {
+	f.t.Helper()
+
+	require.NoError(f.t, sqlstore.SaveDashboard(&cmd), "Failed to save dashboard")
+	return cmd.Result
+}
+
+func (f *Fixture) insert(bean interface{}) {
+	f.t.Helper()
+
+	err := f.SQLStore.WithDbSession(context.Background(), func(session *sqlstore.DBSession) error {
+		_, err := session.Insert(bean)
+		return err
+	})
+	require.NoError(f.t, err, "Failed to insert %T", bean)
+}
+
+func (f *Fixture) exec(sql string, args ...interface{}) {
+	f.t.Helper()
+
+	err := f.SQLStore.WithDbSession(context.Background(), func(session *sqlstore.DBSession) error {
+		_, err := session.Exec(append([]interface{}{sql}, args...)...)
+		return err
+	})
+	require.NoError(f.t, err, "Failed to run %q", sql)
+}
@@ -0,0 +1,43 @@
+package testutil
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/sqlstore"
+)
+
+func TestFixture(t *testing.T) {
+	f := Setup(t)
+	orgID := f.CreateOrg("Main")
+	user := f.CreateUser(orgID, "editor", models.ROLE_EDITOR)
+	folderID := f.CreateFolder(orgID, "Shared")
+	libraryPanel := f.LibraryPanel(orgID, "Shared text").InFolder(folderID).WithTags("shared", "text").
+		WithModel(`{ "type": "text", "title": "Shared" }`).CreatedBy(user.UserId).Create()
+	require.NotZero(t, libraryPanel.ID)
+	require.Equal(t, folderID, libraryPanel.FolderID)
+
+	dashboard := f.CreateDashboard(orgID, 0, "Uses the shared text", libraryPanel)
+	err := f.Service.LoadLibraryPanelsForDashboard(f.ReqContext(user), dashboard)
+	require.NoError(t, err)
+	panel := dashboard.Data.Get("panels").GetIndex(0)
+	require.Equal(t, "Shared", panel.Get("title").MustString())
+	require.Equal(t, int64(1), panel.Get("id").MustInt64())
+	require.Equal(t, libraryPanel.UID, panel.Get("libraryPanel").Get("uid").MustString())
+
+	var connections, tags int64
+	err = f.SQLStore.WithDbSession(context.Background(), func(session *sqlstore.DBSession) error {
+		connections, err = session.Table("library_panel_dashboard").Where("librarypanel_id=? AND dashboard_id=?", libraryPanel.ID, dashboard.Id).Count()
+		if err != nil {
+			return err
+		}
+		tags, err = session.Table("library_panel_tag").Where("librarypanel_id=?", libraryPanel.ID).Count()
+		return err
+	})
+	require.NoError(t, err)
+	require.Equal(t, int64(1), connections)
+	require.Equal(t, int64(2), tags)
+}
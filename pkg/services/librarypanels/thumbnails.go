@@ -0,0 +1,158 @@
+package librarypanels
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/rendering"
+	"github.com/grafana/grafana/pkg/services/sqlstore"
+)
+
+const (
+	// thumbnailRenderInterval is how often the thumbnails of new and updated Library Panels are rendered.
+	thumbnailRenderInterval = time.Minute
+	// thumbnailBatchSize is the maximum number of thumbnails rendered every thumbnailRenderInterval.
+	thumbnailBatchSize = 10
+	thumbnailWidth     = 320
+	thumbnailHeight    = 180
+	thumbnailTimeout   = 30 * time.Second
+)
+
+// libraryPanelThumbnail is the model for the rendered PNG thumbnails of Library Panels. PanelUpdated is the
+// update time of the Library Panel that was rendered, the thumbnail is rendered again when the Library Panel
+// is updated. Image is empty if the rendering failed, it isn't retried until the next update.
+type libraryPanelThumbnail struct {
+	ID             int64  `xorm:"pk autoincr 'id'"`
+	LibraryPanelID int64  `xorm:"librarypanel_id"`
+	Image          []byte `xorm:"image"`
+	PanelUpdated   time.Time
+	Rendered       time.Time
+}
+
+// staleThumbnail is a Library Panel without a current thumbnail, and a dashboard panel it can be rendered from.
+type staleThumbnail struct {
+	ID            int64     `xorm:"id"`
+	OrgID         int64     `xorm:"org_id"`
+	UID           string    `xorm:"uid"`
+	Updated       time.Time `xorm:"updated"`
+	DashboardUID  string    `xorm:"dashboard_uid"`
+	DashboardSlug string    `xorm:"dashboard_slug"`
+	PanelID       int64     `xorm:"panel_id"`
+}
+
+// renderStaleThumbnails renders the thumbnails of the Library Panels that don't have one, or were updated
+// since theirs was rendered, and returns the number of Library Panels it tried to render. Only Library Panels connected to a
+// known panel of a dashboard can be rendered, from the first connected dashboard. Nothing is rendered if the
+// image renderer isn't available.
+func (lps *LibraryPanelService) renderStaleThumbnails(ctx context.Context) (int, error) {
+	if lps.RenderService == nil || !lps.RenderService.IsAvailable() {
+		return 0, nil
+	}
+
+	var candidates []staleThumbnail
+	err := lps.SQLStore.WithReadReplicaDbSession(context.Background(), func(session *sqlstore.DBSession) error {
+		return session.SQL(`SELECT library_panel.id, library_panel.org_id, library_panel.uid, library_panel.updated,
+			dashboard.uid AS dashboard_uid, dashboard.slug AS dashboard_slug, library_panel_dashboard.panel_id
+			FROM library_panel
+			INNER JOIN library_panel_dashboard ON library_panel_dashboard.librarypanel_id = library_panel.id AND library_panel_dashboard.panel_id > 0
+			INNER JOIN dashboard ON dashboard.id = library_panel_dashboard.dashboard_id
+			LEFT JOIN library_panel_thumbnail ON library_panel_thumbnail.librarypanel_id = library_panel.id
+			WHERE library_panel.kind=? AND (library_panel_thumbnail.id IS NULL OR library_panel_thumbnail.panel_updated < library_panel.updated)
+			ORDER BY library_panel.id ASC, library_panel_dashboard.id ASC`, panelElement).Find(&candidates)
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	rendered := 0
+	seen := make(map[int64]bool)
+	for _, candidate := range candidates {
+		if seen[candidate.ID] {
+			continue
+		}
+		seen[candidate.ID] = true
+		if rendered == thumbnailBatchSize {
+			break
+		}
+
+		image, err := lps.renderThumbnail(ctx, candidate)
+		if err != nil {
+			lps.log.Warn("Failed to render library panel thumbnail", "uid", candidate.UID, "error", err)
+		}
+		if err := lps.saveThumbnail(candidate, image); err != nil {
+			return rendered, err
+		}
+		rendered++
+	}
+
+	return rendered, nil
+}
+
+// renderThumbnail renders the dashboard panel of the stale thumbnail as a PNG.
+func (lps *LibraryPanelService) renderThumbnail(ctx context.Context, thumbnail staleThumbnail) ([]byte, error) {
+	result, err := lps.RenderService.Render(ctx, rendering.Opts{
+		Width:           thumbnailWidth,
+		Height:          thumbnailHeight,
+		Timeout:         thumbnailTimeout,
+		OrgId:           thumbnail.OrgID,
+		OrgRole:         models.ROLE_ADMIN,
+		Path:            fmt.Sprintf("d-solo/%s/%s?orgId=%d&panelId=%d", thumbnail.DashboardUID, thumbnail.DashboardSlug, thumbnail.OrgID, thumbnail.PanelID),
+		ConcurrentLimit: lps.Cfg.RendererConcurrentRequestLimit,
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := os.Remove(result.FilePath); err != nil {
+			lps.log.Warn("Failed to remove rendered library panel thumbnail", "path", result.FilePath, "error", err)
+		}
+	}()
+
+	// We can ignore the gosec G304 warning on this one because the path comes from the image renderer.
+	// nolint:gosec
+	return ioutil.ReadFile(result.FilePath)
+}
+
+// saveThumbnail replaces the thumbnail of a Library Panel.
+func (lps *LibraryPanelService) saveThumbnail(thumbnail staleThumbnail, image []byte) error {
+	return lps.SQLStore.WithTransactionalDbSession(context.Background(), func(session *sqlstore.DBSession) error {
+		if _, err := session.Exec("DELETE FROM library_panel_thumbnail WHERE librarypanel_id=?", thumbnail.ID); err != nil {
+			return err
+		}
+
+		_, err := session.Insert(&libraryPanelThumbnail{
+			LibraryPanelID: thumbnail.ID,
+			Image:          image,
+			PanelUpdated:   thumbnail.Updated,
+			Rendered:       time.Now(),
+		})
+		return err
+	})
+}
+
+// getThumbnail gets the PNG thumbnail of a Library Panel.
+func (lps *LibraryPanelService) getThumbnail(c *models.ReqContext, uid string) ([]byte, error) {
+	libraryPanel, err := lps.getLibraryPanel(c, uid)
+	if err != nil {
+		return nil, err
+	}
+
+	var thumbnail libraryPanelThumbnail
+	err = lps.SQLStore.WithReadReplicaDbSession(context.Background(), func(session *sqlstore.DBSession) error {
+		has, err := session.Where("librarypanel_id=?", libraryPanel.ID).Get(&thumbnail)
+		if err != nil {
+			return err
+		}
+		if !has || len(thumbnail.Image) == 0 {
+			return errLibraryPanelThumbnailNotFound
+		}
+
+		return nil
+	})
+
+	return thumbnail.Image, err
+}
@@ -0,0 +1,163 @@
+package librarypanels
+
+import (
+	"encoding/json"
+	"sort"
+)
+
+// transformationReferenceKey is the key of the references to library transformations in the transformations of
+// panels. A transformation like {"libraryTransformation": {"uid": "nErXDvCkzz"}} is replaced by the
+// transformations of the library transformation. Each of them keeps the reference, so that they are replaced
+// together by the latest transformations the next time the dashboard is loaded.
+const transformationReferenceKey = "libraryTransformation"
+
+// transformationReference returns the UID of the library transformation the transformation references, if any.
+func transformationReference(transformation interface{}) (string, bool) {
+	object, ok := transformation.(map[string]interface{})
+	if !ok {
+		return "", false
+	}
+	reference, ok := object[transformationReferenceKey].(map[string]interface{})
+	if !ok {
+		return "", false
+	}
+	uid, ok := reference["uid"].(string)
+
+	return uid, ok && uid != ""
+}
+
+// collectTransformationReferences adds the UIDs of the library transformations referenced in the transformations
+// of the panels in the value to uids.
+func collectTransformationReferences(value interface{}, uids map[string]bool) {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		for key, child := range value {
+			if transformations, ok := child.([]interface{}); ok && key == "transformations" {
+				for _, transformation := range transformations {
+					if uid, ok := transformationReference(transformation); ok {
+						uids[uid] = true
+					}
+				}
+				continue
+			}
+			collectTransformationReferences(child, uids)
+		}
+	case []interface{}:
+		for _, child := range value {
+			collectTransformationReferences(child, uids)
+		}
+	}
+}
+
+// getTransformationReferences returns the UIDs of the library transformations referenced in a model, sorted.
+func getTransformationReferences(model json.RawMessage) []string {
+	var value interface{}
+	if err := json.Unmarshal(model, &value); err != nil {
+		return []string{}
+	}
+
+	set := map[string]bool{}
+	collectTransformationReferences(value, set)
+	uids := make([]string, 0, len(set))
+	for uid := range set {
+		uids = append(uids, uid)
+	}
+	sort.Strings(uids)
+
+	return uids
+}
+
+// resolveLibraryTransformations replaces the references to library transformations in the transformations of the
+// panels in the dashboard with the transformations of the library transformations, and returns the library
+// transformations that were found.
+func (lps *LibraryPanelService) resolveLibraryTransformations(orgID int64, dashboard interface{}) ([]LibraryPanel, error) {
+	set := map[string]bool{}
+	collectTransformationReferences(dashboard, set)
+	if len(set) == 0 {
+		return nil, nil
+	}
+	uids := make([]string, 0, len(set))
+	for uid := range set {
+		uids = append(uids, uid)
+	}
+	sort.Strings(uids)
+
+	pipelines, err := lps.getLibraryPanelsByUIDs(orgID, transformationElement, uids)
+	if err != nil {
+		return nil, err
+	}
+	byUID := make(map[string]LibraryPanel, len(pipelines))
+	for _, pipeline := range pipelines {
+		byUID[pipeline.UID] = pipeline
+	}
+	if err := expandLibraryTransformations(dashboard, byUID); err != nil {
+		return nil, err
+	}
+
+	return pipelines, nil
+}
+
+// expandLibraryTransformations expands the references to library transformations in the transformations of the
+// panels in the value, in place.
+func expandLibraryTransformations(value interface{}, pipelines map[string]LibraryPanel) error {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		for key, child := range value {
+			if transformations, ok := child.([]interface{}); ok && key == "transformations" {
+				expanded, err := expandTransformations(transformations, pipelines)
+				if err != nil {
+					return err
+				}
+				value[key] = expanded
+				continue
+			}
+			if err := expandLibraryTransformations(child, pipelines); err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		for _, child := range value {
+			if err := expandLibraryTransformations(child, pipelines); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// expandTransformations replaces each run of transformations referencing the same library transformation with
+// the transformations of the library transformation. References to library transformations that don't exist are
+// left as they are.
+func expandTransformations(transformations []interface{}, pipelines map[string]LibraryPanel) ([]interface{}, error) {
+	result := make([]interface{}, 0, len(transformations))
+	for i := 0; i < len(transformations); {
+		uid, ok := transformationReference(transformations[i])
+		pipeline, found := pipelines[uid]
+		if !ok || !found {
+			result = append(result, transformations[i])
+			i++
+			continue
+		}
+		// skip the transformations that an earlier load expanded from the library transformation
+		for i < len(transformations) {
+			if next, ok := transformationReference(transformations[i]); !ok || next != uid {
+				break
+			}
+			i++
+		}
+
+		var model struct {
+			Transformations []map[string]interface{} `json:"transformations"`
+		}
+		if err := json.Unmarshal(pipeline.Model, &model); err != nil {
+			return nil, err
+		}
+		for _, transformation := range model.Transformations {
+			transformation[transformationReferenceKey] = map[string]interface{}{"uid": pipeline.UID, "name": pipeline.Name}
+			result = append(result, transformation)
+		}
+	}
+
+	return result, nil
+}
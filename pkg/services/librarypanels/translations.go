@@ -0,0 +1,209 @@
+package librarypanels
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/sqlstore"
+)
+
+// localePattern matches BCP 47 language tags like de, pt-BR or zh-Hant-TW.
+var localePattern = regexp.MustCompile(`^[a-zA-Z]{2,3}(-[a-zA-Z0-9]{2,8})*$`)
+
+// maxLocaleLength is the length of the locale column.
+const maxLocaleLength = 20
+
+// libraryPanelTranslation overrides the name and description of a Library Panel for users of a locale. An empty
+// name or description isn't overridden.
+type libraryPanelTranslation struct {
+	ID             int64  `json:"-" xorm:"pk autoincr 'id'"`
+	LibraryPanelID int64  `json:"-" xorm:"librarypanel_id"`
+	Locale         string `json:"locale" xorm:"locale"`
+	Name           string `json:"name" xorm:"name"`
+	Description    string `json:"description" xorm:"description"`
+
+	Updated   time.Time `json:"updated"`
+	UpdatedBy int64     `json:"updatedBy"`
+}
+
+// setLibraryPanelTranslationCommand is the command for setting the translation of a Library Panel for a locale.
+type setLibraryPanelTranslationCommand struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+// normalizeLocale returns the locale with a lower case language and upper case region, like pt-BR, or an empty
+// string for locales that aren't language tags.
+func normalizeLocale(locale string) string {
+	if len(locale) > maxLocaleLength || !localePattern.MatchString(locale) {
+		return ""
+	}
+
+	parts := strings.Split(locale, "-")
+	parts[0] = strings.ToLower(parts[0])
+	for i := 1; i < len(parts); i++ {
+		switch len(parts[i]) {
+		case 2:
+			parts[i] = strings.ToUpper(parts[i])
+		case 4:
+			parts[i] = strings.ToUpper(parts[i][:1]) + strings.ToLower(parts[i][1:])
+		default:
+			parts[i] = strings.ToLower(parts[i])
+		}
+	}
+
+	return strings.Join(parts, "-")
+}
+
+// requestLocales returns the locales of the Accept-Language header of the request in the order of preference,
+// each followed by its language when it has a region, so de-AT falls back to de.
+func requestLocales(c *models.ReqContext) []string {
+	var locales []string
+	seen := make(map[string]bool)
+	add := func(locale string) {
+		if locale != "" && !seen[locale] {
+			seen[locale] = true
+			locales = append(locales, locale)
+		}
+	}
+
+	// the browser sends the languages in the order of preference, the quality values are ignored like in the index
+	for _, part := range strings.Split(c.Req.Header.Get("Accept-Language"), ",") {
+		locale := normalizeLocale(strings.TrimSpace(strings.SplitN(part, ";", 2)[0]))
+		add(locale)
+		if i := strings.Index(locale, "-"); i > 0 {
+			add(locale[:i])
+		}
+	}
+
+	return locales
+}
+
+// getLibraryPanelTranslations gets the translations of a Library Panel, ordered by locale.
+func (lps *LibraryPanelService) getLibraryPanelTranslations(c *models.ReqContext, uid string) ([]libraryPanelTranslation, error) {
+	libraryPanel, err := lps.getLibraryPanel(c, uid)
+	if err != nil {
+		return nil, err
+	}
+
+	translations := make([]libraryPanelTranslation, 0)
+	err = lps.SQLStore.WithReadReplicaDbSession(context.Background(), func(session *sqlstore.DBSession) error {
+		return session.Where("librarypanel_id=?", libraryPanel.ID).OrderBy("locale ASC").Find(&translations)
+	})
+
+	return translations, err
+}
+
+// setLibraryPanelTranslation sets the translation of a Library Panel for the locale, replacing the one it has. It
+// requires edit permission on the Library Panel.
+func (lps *LibraryPanelService) setLibraryPanelTranslation(c *models.ReqContext, uid string, locale string, cmd setLibraryPanelTranslationCommand) (libraryPanelTranslation, error) {
+	translation := libraryPanelTranslation{
+		Locale:      normalizeLocale(locale),
+		Name:        strings.TrimSpace(cmd.Name),
+		Description: strings.TrimSpace(cmd.Description),
+		Updated:     time.Now(),
+		UpdatedBy:   c.SignedInUser.UserId,
+	}
+	if translation.Locale == "" || (translation.Name == "" && translation.Description == "") || len(translation.Name) > 255 {
+		return libraryPanelTranslation{}, errLibraryPanelInvalidTranslation
+	}
+
+	err := lps.SQLStore.WithTransactionalDbSession(context.Background(), func(session *sqlstore.DBSession) error {
+		libraryPanel, err := getLibraryPanel(session, uid, c.SignedInUser.OrgId)
+		if err != nil {
+			return err
+		}
+		if libraryPanel.ReplicaOf != 0 {
+			return errLibraryPanelReplica
+		}
+		if err := checkCanEditLibraryPanel(session, lps.SQLStore.Dialect, c.SignedInUser, libraryPanel); err != nil {
+			return err
+		}
+
+		var existing libraryPanelTranslation
+		has, err := session.Where("librarypanel_id=? AND locale=?", libraryPanel.ID, translation.Locale).Get(&existing)
+		if err != nil {
+			return err
+		}
+		translation.LibraryPanelID = libraryPanel.ID
+		if has {
+			translation.ID = existing.ID
+			_, err = session.ID(existing.ID).AllCols().Update(&translation)
+		} else {
+			_, err = session.Insert(&translation)
+		}
+		return err
+	})
+	if err != nil {
+		return libraryPanelTranslation{}, err
+	}
+
+	return translation, nil
+}
+
+// deleteLibraryPanelTranslation deletes the translation of a Library Panel for the locale, so its users get the
+// name and description of the Library Panel again. It requires edit permission on the Library Panel.
+func (lps *LibraryPanelService) deleteLibraryPanelTranslation(c *models.ReqContext, uid string, locale string) error {
+	return lps.SQLStore.WithTransactionalDbSession(context.Background(), func(session *sqlstore.DBSession) error {
+		libraryPanel, err := getLibraryPanel(session, uid, c.SignedInUser.OrgId)
+		if err != nil {
+			return err
+		}
+		if err := checkCanEditLibraryPanel(session, lps.SQLStore.Dialect, c.SignedInUser, libraryPanel); err != nil {
+			return err
+		}
+
+		result, err := session.Exec("DELETE FROM library_panel_translation WHERE librarypanel_id=? AND locale=?", libraryPanel.ID, normalizeLocale(locale))
+		if err != nil {
+			return err
+		}
+		if rowsAffected, err := result.RowsAffected(); err != nil {
+			return err
+		} else if rowsAffected == 0 {
+			return errLibraryPanelTranslationNotFound
+		}
+		return nil
+	})
+}
+
+// translateLibraryPanels sets the Translation of the Library Panels to their translation for the most preferred
+// locale of the request that they have one for. Library Panels without one are left as they are.
+func (lps *LibraryPanelService) translateLibraryPanels(c *models.ReqContext, libraryPanels []LibraryPanel) error {
+	locales := requestLocales(c)
+	if len(locales) == 0 || len(libraryPanels) == 0 {
+		return nil
+	}
+
+	ids := make([]int64, 0, len(libraryPanels))
+	for _, libraryPanel := range libraryPanels {
+		ids = append(ids, libraryPanel.ID)
+	}
+	var translations []libraryPanelTranslation
+	err := lps.SQLStore.WithReadReplicaDbSession(context.Background(), func(session *sqlstore.DBSession) error {
+		return session.In("librarypanel_id", ids).In("locale", locales).Find(&translations)
+	})
+	if err != nil {
+		return err
+	}
+
+	byPanel := make(map[int64]map[string]libraryPanelTranslation)
+	for _, translation := range translations {
+		if byPanel[translation.LibraryPanelID] == nil {
+			byPanel[translation.LibraryPanelID] = make(map[string]libraryPanelTranslation)
+		}
+		byPanel[translation.LibraryPanelID][translation.Locale] = translation
+	}
+	for i := range libraryPanels {
+		for _, locale := range locales {
+			if translation, ok := byPanel[libraryPanels[i].ID][locale]; ok {
+				libraryPanels[i].Translation = &translation
+				break
+			}
+		}
+	}
+
+	return nil
+}
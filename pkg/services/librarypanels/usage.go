@@ -0,0 +1,213 @@
+package librarypanels
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/sqlstore"
+	"github.com/grafana/grafana/pkg/services/sqlstore/migrator"
+)
+
+const (
+	defaultUsageReportLimit = 10
+	// lastViewedInterval is how often last_viewed_at is written for a Library Panel at most,
+	// since Library Panels are resolved on every dashboard load.
+	lastViewedInterval = time.Hour
+	// viewFlushInterval is how often the views counted on this Grafana server are written to the database.
+	viewFlushInterval = time.Minute
+)
+
+// libraryPanelStat is the model for library panel usage statistics.
+type libraryPanelStat struct {
+	ID             int64 `xorm:"pk autoincr 'id'"`
+	OrgID          int64 `xorm:"org_id"`
+	LibraryPanelID int64 `xorm:"librarypanel_id"`
+	Views          int64
+
+	Created time.Time
+	Updated time.Time
+}
+
+// libraryPanelUsage is the usage of a Library Panel.
+type libraryPanelUsage struct {
+	UID                 string `json:"uid" xorm:"uid"`
+	Name                string `json:"name"`
+	FolderID            int64  `json:"folderId" xorm:"folder_id"`
+	Views               int64  `json:"views"`
+	ConnectedDashboards int64  `json:"connectedDashboards"`
+}
+
+// libraryPanelUsageReport is the usage report for the Library Panels in an org.
+type libraryPanelUsageReport struct {
+	MostUsed  []libraryPanelUsage `json:"mostUsed"`
+	LeastUsed []libraryPanelUsage `json:"leastUsed"`
+	Unused    []libraryPanelUsage `json:"unused"`
+}
+
+// libraryPanelViewBuffer counts the views of library elements on this Grafana server until they are written to
+// the database, so that loading a dashboard doesn't write to the database.
+type libraryPanelViewBuffer struct {
+	mu    sync.Mutex
+	views map[int64]*bufferedViews
+}
+
+// bufferedViews are the views of a library element that weren't written to the database yet.
+type bufferedViews struct {
+	orgID      int64
+	views      int64
+	lastViewed time.Time
+}
+
+func newLibraryPanelViewBuffer() *libraryPanelViewBuffer {
+	return &libraryPanelViewBuffer{views: map[int64]*bufferedViews{}}
+}
+
+// add counts a view of each of the library elements.
+func (buffer *libraryPanelViewBuffer) add(orgID int64, libraryPanels []LibraryPanel, viewed time.Time) {
+	buffer.mu.Lock()
+	defer buffer.mu.Unlock()
+
+	for _, panel := range libraryPanels {
+		pending, ok := buffer.views[panel.ID]
+		if !ok {
+			pending = &bufferedViews{orgID: orgID}
+			buffer.views[panel.ID] = pending
+		}
+		pending.views++
+		pending.lastViewed = viewed
+	}
+}
+
+// take returns the counted views and empties the buffer.
+func (buffer *libraryPanelViewBuffer) take() map[int64]*bufferedViews {
+	buffer.mu.Lock()
+	defer buffer.mu.Unlock()
+
+	views := buffer.views
+	buffer.views = map[int64]*bufferedViews{}
+	return views
+}
+
+// restore adds views that couldn't be written back to the buffer, so they are written by the next flush.
+func (buffer *libraryPanelViewBuffer) restore(views map[int64]*bufferedViews) {
+	buffer.mu.Lock()
+	defer buffer.mu.Unlock()
+
+	for id, restored := range views {
+		pending, ok := buffer.views[id]
+		if !ok {
+			buffer.views[id] = restored
+			continue
+		}
+		pending.views += restored.views
+		if restored.lastViewed.After(pending.lastViewed) {
+			pending.lastViewed = restored.lastViewed
+		}
+	}
+}
+
+// recordLibraryPanelViews counts a view of the given Library Panels. The views are written to the database by
+// flushLibraryPanelViews every viewFlushInterval, and are lost if the Grafana server stops before that.
+func (lps *LibraryPanelService) recordLibraryPanelViews(orgID int64, libraryPanels []LibraryPanel) {
+	if len(libraryPanels) == 0 {
+		return
+	}
+
+	lps.viewBuffer.add(orgID, libraryPanels, time.Now())
+}
+
+// flushLibraryPanelViews adds the counted views to the view counts of the Library Panels and updates when they were
+// last viewed, at most once per lastViewedInterval, and returns the number of Library Panels that were updated.
+// Views of Library Panels that were deleted in the meantime are dropped.
+func (lps *LibraryPanelService) flushLibraryPanelViews() (int, error) {
+	views := lps.viewBuffer.take()
+	if len(views) == 0 {
+		return 0, nil
+	}
+
+	ids := make([]interface{}, 0, len(views))
+	for id := range views {
+		ids = append(ids, id)
+	}
+
+	count := 0
+	err := lps.SQLStore.WithTransactionalDbSession(context.Background(), func(session *sqlstore.DBSession) error {
+		var existing []int64
+		if err := session.Table("library_panel").In("id", ids...).Cols("id").Find(&existing); err != nil {
+			return err
+		}
+
+		upsertSQL := libraryPanelStatUpsertSQL(lps.SQLStore.Dialect)
+		for _, id := range existing {
+			pending := views[id]
+			if _, err := session.Exec(upsertSQL, pending.orgID, id, pending.views, pending.lastViewed, pending.lastViewed); err != nil {
+				return err
+			}
+			if _, err := session.Exec("UPDATE library_panel SET last_viewed_at = ? WHERE id = ? AND (last_viewed_at IS NULL OR last_viewed_at < ?)",
+				pending.lastViewed, id, pending.lastViewed.Add(-lastViewedInterval)); err != nil {
+				return err
+			}
+		}
+		count = len(existing)
+
+		return nil
+	})
+	if err != nil {
+		lps.viewBuffer.restore(views)
+		return 0, err
+	}
+
+	return count, nil
+}
+
+// libraryPanelStatUpsertSQL returns the statement that adds views to the view count of a Library Panel, and creates
+// its view count if it has none, in one statement so that servers flushing at the same time don't race.
+func libraryPanelStatUpsertSQL(dialect migrator.Dialect) string {
+	insert := "INSERT INTO library_panel_stat (org_id, librarypanel_id, views, created, updated) VALUES (?, ?, ?, ?, ?)"
+	if dialect.DriverName() == migrator.MySQL {
+		return insert + " ON DUPLICATE KEY UPDATE views = views + VALUES(views), updated = VALUES(updated)"
+	}
+
+	return insert + " ON CONFLICT(librarypanel_id) DO UPDATE SET views = library_panel_stat.views + excluded.views, updated = excluded.updated"
+}
+
+// getLibraryPanelUsageReport gets the most used, least used and unused Library Panels in the org.
+// Library Panels are unused when they have no views and no connected dashboards.
+func (lps *LibraryPanelService) getLibraryPanelUsageReport(c *models.ReqContext, limit int) (libraryPanelUsageReport, error) {
+	if limit <= 0 {
+		limit = defaultUsageReportLimit
+	}
+
+	report := libraryPanelUsageReport{}
+	err := lps.SQLStore.WithReadReplicaDbSession(context.Background(), func(session *sqlstore.DBSession) error {
+		dialect := lps.SQLStore.Dialect
+		base := `SELECT library_panel.uid, library_panel.name, library_panel.folder_id,
+			COALESCE(library_panel_stat.views, 0) AS views,
+			(SELECT COUNT(DISTINCT library_panel_dashboard.dashboard_id) FROM library_panel_dashboard WHERE library_panel_dashboard.librarypanel_id = library_panel.id) AS connected_dashboards
+			FROM library_panel
+			LEFT JOIN library_panel_stat ON library_panel_stat.librarypanel_id = library_panel.id
+			WHERE library_panel.org_id=?`
+		orgID := c.SignedInUser.OrgId
+
+		report.MostUsed = make([]libraryPanelUsage, 0)
+		if err := session.SQL(base+" AND COALESCE(library_panel_stat.views, 0) > 0 ORDER BY views DESC, library_panel.name ASC"+
+			dialect.Limit(int64(limit)), orgID).Find(&report.MostUsed); err != nil {
+			return err
+		}
+
+		report.LeastUsed = make([]libraryPanelUsage, 0)
+		if err := session.SQL(base+" AND COALESCE(library_panel_stat.views, 0) > 0 ORDER BY views ASC, library_panel.name ASC"+
+			dialect.Limit(int64(limit)), orgID).Find(&report.LeastUsed); err != nil {
+			return err
+		}
+
+		report.Unused = make([]libraryPanelUsage, 0)
+		return session.SQL(base+` AND COALESCE(library_panel_stat.views, 0) = 0
+			AND NOT EXISTS (SELECT 1 FROM library_panel_dashboard WHERE library_panel_dashboard.librarypanel_id = library_panel.id)
+			ORDER BY library_panel.name ASC`, orgID).Find(&report.Unused)
+	})
+
+	return report, err
+}
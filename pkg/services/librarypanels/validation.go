@@ -0,0 +1,281 @@
+package librarypanels
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/plugins"
+	"github.com/grafana/grafana/pkg/setting"
+)
+
+// requestSizeOverhead is the room left for the other fields of create and patch requests,
+// on top of the maximum model size.
+const requestSizeOverhead = 64 * 1024
+
+// modelValidationError is a problem with a single field of a Library Panel model.
+type modelValidationError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// modelValidationErrors is the error returned when a Library Panel model is invalid.
+type modelValidationErrors []modelValidationError
+
+func (e modelValidationErrors) Error() string {
+	messages := make([]string, 0, len(e))
+	for _, err := range e {
+		messages = append(messages, err.Field+": "+err.Message)
+	}
+
+	return "invalid library panel model: " + strings.Join(messages, ", ")
+}
+
+// variableTypes are the types of template variables that can be stored as library variables.
+var variableTypes = map[string]bool{
+	"query": true, "adhoc": true, "constant": true, "datasource": true, "interval": true, "textbox": true, "custom": true,
+}
+
+// validateElementModel validates the model of a library element of the given kind. With strict linting, models
+// with lint warnings are invalid too.
+func validateElementModel(kind libraryElementKind, model json.RawMessage, settings setting.LibraryPanelsSettings) error {
+	var err error
+	switch kind {
+	case panelElement:
+		err = validateModel(model, settings)
+	case variableElement:
+		err = validateVariableModel(model, settings.MaxModelSize)
+	case rowElement:
+		err = validateRowModel(model, settings)
+	case fragmentElement:
+		_, err = parseModel(model, settings.MaxModelSize)
+	case queryElement:
+		err = validateQueryModel(model, settings.MaxModelSize)
+	case transformationElement:
+		err = validateTransformationModel(model, settings.MaxModelSize)
+	default:
+		return errLibraryElementInvalidKind
+	}
+	if err != nil || !settings.StrictLinting {
+		return err
+	}
+
+	return validationResult(lintElementModel(kind, model))
+}
+
+// validateModel checks that the model is a panel that dashboards can render: a JSON object of a
+// known and allowed panel type, with a well formed field config, that isn't larger than the maximum
+// model size. A maximum size of 0 or less means the size is unlimited.
+func validateModel(model json.RawMessage, settings setting.LibraryPanelsSettings) error {
+	panel, err := parseModel(model, settings.MaxModelSize)
+	if err != nil {
+		return err
+	}
+
+	return validationResult(validatePanel(panel, "model", settings.AllowedPanelTypes))
+}
+
+// validateVariableModel checks that the model is a template variable: a JSON object with a name and
+// a known variable type, that isn't larger than maxSize bytes.
+func validateVariableModel(model json.RawMessage, maxSize int64) error {
+	variable, err := parseModel(model, maxSize)
+	if err != nil {
+		return err
+	}
+
+	var errs modelValidationErrors
+	if variableType, typeErr := requiredString(variable, "model", "type"); typeErr != nil {
+		errs = append(errs, *typeErr)
+	} else if !variableTypes[variableType] {
+		errs = append(errs, modelValidationError{Field: "model.type", Message: fmt.Sprintf("unknown variable type %q", variableType)})
+	}
+	if _, nameErr := requiredString(variable, "model", "name"); nameErr != nil {
+		errs = append(errs, *nameErr)
+	}
+
+	return validationResult(errs)
+}
+
+// validateQueryModel checks that the model is a query: a JSON object with the name of a data source, that
+// isn't larger than maxSize bytes.
+func validateQueryModel(model json.RawMessage, maxSize int64) error {
+	query, err := parseModel(model, maxSize)
+	if err != nil {
+		return err
+	}
+
+	var errs modelValidationErrors
+	if _, datasourceErr := requiredString(query, "model", "datasource"); datasourceErr != nil {
+		errs = append(errs, *datasourceErr)
+	}
+
+	return validationResult(errs)
+}
+
+// validateTransformationModel checks that the model is a transformation pipeline: a JSON object with a list of
+// transformations that each have an id, that isn't larger than maxSize bytes.
+func validateTransformationModel(model json.RawMessage, maxSize int64) error {
+	pipeline, err := parseModel(model, maxSize)
+	if err != nil {
+		return err
+	}
+
+	var errs modelValidationErrors
+	var transformations []map[string]json.RawMessage
+	if raw, ok := pipeline["transformations"]; !ok {
+		errs = append(errs, modelValidationError{Field: "model.transformations", Message: "is required"})
+	} else if err := json.Unmarshal(raw, &transformations); err != nil {
+		errs = append(errs, modelValidationError{Field: "model.transformations", Message: "must be an array of JSON objects"})
+	}
+	for i, transformation := range transformations {
+		if _, idErr := requiredString(transformation, fmt.Sprintf("model.transformations[%d]", i), "id"); idErr != nil {
+			errs = append(errs, *idErr)
+		}
+	}
+
+	return validationResult(errs)
+}
+
+// validateRowModel checks that the model is a dashboard row: a JSON object of the row type with
+// a list of valid panels, that isn't larger than the maximum model size.
+func validateRowModel(model json.RawMessage, settings setting.LibraryPanelsSettings) error {
+	row, err := parseModel(model, settings.MaxModelSize)
+	if err != nil {
+		return err
+	}
+
+	var errs modelValidationErrors
+	if rowType, typeErr := requiredString(row, "model", "type"); typeErr != nil {
+		errs = append(errs, *typeErr)
+	} else if rowType != "row" {
+		errs = append(errs, modelValidationError{Field: "model.type", Message: `must be "row"`})
+	}
+
+	var panels []map[string]json.RawMessage
+	if raw, ok := row["panels"]; !ok {
+		errs = append(errs, modelValidationError{Field: "model.panels", Message: "is required"})
+	} else if err := json.Unmarshal(raw, &panels); err != nil {
+		errs = append(errs, modelValidationError{Field: "model.panels", Message: "must be an array of JSON objects"})
+	}
+	for i, panel := range panels {
+		errs = append(errs, validatePanel(panel, fmt.Sprintf("model.panels[%d]", i), settings.AllowedPanelTypes)...)
+	}
+	if raw, ok := row["repeat"]; ok {
+		var repeat string
+		if err := json.Unmarshal(raw, &repeat); err != nil {
+			errs = append(errs, modelValidationError{Field: "model.repeat", Message: "must be the name of a variable"})
+		}
+	}
+
+	return validationResult(errs)
+}
+
+// validatePanel validates a panel of a model. An empty allowedTypes allows all installed panel types.
+func validatePanel(panel map[string]json.RawMessage, field string, allowedTypes []string) modelValidationErrors {
+	var errs modelValidationErrors
+	if panelType, typeErr := requiredString(panel, field, "type"); typeErr != nil {
+		errs = append(errs, *typeErr)
+	} else if _, exists := plugins.Panels[panelType]; !exists {
+		errs = append(errs, modelValidationError{Field: field + ".type", Message: fmt.Sprintf("unknown panel type %q", panelType)})
+	} else if !isAllowedPanelType(allowedTypes, panelType) {
+		errs = append(errs, modelValidationError{Field: field + ".type", Message: fmt.Sprintf("panel type %q is not allowed", panelType)})
+	}
+
+	if raw, ok := panel["fieldConfig"]; ok {
+		errs = append(errs, validateFieldConfig(raw, field+".fieldConfig")...)
+	}
+
+	return errs
+}
+
+func isAllowedPanelType(allowedTypes []string, panelType string) bool {
+	if len(allowedTypes) == 0 {
+		return true
+	}
+	for _, allowedType := range allowedTypes {
+		if allowedType == panelType {
+			return true
+		}
+	}
+
+	return false
+}
+
+// validationResult returns the validation errors as an error, or nil if there are none.
+func validationResult(errs modelValidationErrors) error {
+	if len(errs) > 0 {
+		return errs
+	}
+
+	return nil
+}
+
+// parseModel checks the size of the model and parses it as a JSON object.
+func parseModel(model json.RawMessage, maxSize int64) (map[string]json.RawMessage, error) {
+	if maxSize > 0 && int64(len(model)) > maxSize {
+		return nil, fmt.Errorf("%w: model is %d bytes, the maximum is %d bytes", errLibraryPanelModelTooLarge, len(model), maxSize)
+	}
+
+	var object map[string]json.RawMessage
+	if err := json.Unmarshal(model, &object); err != nil || object == nil {
+		return nil, modelValidationErrors{{Field: "model", Message: "must be a JSON object"}}
+	}
+
+	return object, nil
+}
+
+func requiredString(object map[string]json.RawMessage, field string, key string) (string, *modelValidationError) {
+	raw, ok := object[key]
+	if !ok {
+		return "", &modelValidationError{Field: field + "." + key, Message: "is required"}
+	}
+
+	var value string
+	if err := json.Unmarshal(raw, &value); err != nil || value == "" {
+		return "", &modelValidationError{Field: field + "." + key, Message: "must be a non empty string"}
+	}
+
+	return value, nil
+}
+
+func validateFieldConfig(raw json.RawMessage, field string) modelValidationErrors {
+	var fieldConfig map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &fieldConfig); err != nil || fieldConfig == nil {
+		return modelValidationErrors{{Field: field, Message: "must be a JSON object"}}
+	}
+
+	var errs modelValidationErrors
+	if defaults, ok := fieldConfig["defaults"]; ok {
+		var value map[string]interface{}
+		if err := json.Unmarshal(defaults, &value); err != nil || value == nil {
+			errs = append(errs, modelValidationError{Field: field + ".defaults", Message: "must be a JSON object"})
+		}
+	}
+	if overrides, ok := fieldConfig["overrides"]; ok {
+		var value []map[string]interface{}
+		if err := json.Unmarshal(overrides, &value); err != nil {
+			errs = append(errs, modelValidationError{Field: field + ".overrides", Message: "must be an array of JSON objects"})
+		}
+	}
+
+	return errs
+}
+
+// limitRequestSize rejects create and patch requests that can't fit a model of the maximum size,
+// so huge payloads are refused before they are read into memory.
+func (lps *LibraryPanelService) limitRequestSize(c *models.ReqContext) {
+	maxSize := lps.Cfg.LibraryPanels.MaxModelSize
+	if maxSize <= 0 {
+		return
+	}
+
+	limit := maxSize + requestSizeOverhead
+	if c.Req.ContentLength > limit {
+		c.JsonApiErr(413, errLibraryPanelModelTooLarge.Error(), nil)
+		return
+	}
+
+	c.Req.Request.Body = http.MaxBytesReader(c.Resp, c.Req.Request.Body, limit)
+}
@@ -0,0 +1,175 @@
+package librarypanels
+
+import (
+	"context"
+	"encoding/json"
+	"regexp"
+	"time"
+
+	"github.com/grafana/grafana/pkg/components/simplejson"
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/sqlstore"
+)
+
+// placeholderPattern matches the ${name} placeholders of Library Panel models, without a format like ${name:csv}.
+var placeholderPattern = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// variableNamePattern matches the names of variables that placeholders can use.
+var variableNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// libraryPanelVariableDefaults is the model for the per org values of the placeholders in Library Panel models.
+type libraryPanelVariableDefaults struct {
+	ID        int64             `json:"-" xorm:"pk autoincr 'id'"`
+	OrgID     int64             `json:"-" xorm:"org_id"`
+	Variables map[string]string `json:"variables" xorm:"variables"`
+
+	Updated   time.Time `json:"updated"`
+	UpdatedBy int64     `json:"updatedBy"`
+}
+
+// updateVariableDefaultsCommand is the command for replacing the variable defaults of an org.
+type updateVariableDefaultsCommand struct {
+	Variables map[string]string `json:"variables"`
+}
+
+// getVariableDefaults gets the variable defaults of the org, without variables if the org has none.
+func (lps *LibraryPanelService) getVariableDefaults(c *models.ReqContext) (libraryPanelVariableDefaults, error) {
+	defaults := libraryPanelVariableDefaults{OrgID: c.SignedInUser.OrgId}
+	err := lps.SQLStore.WithDbSession(context.Background(), func(session *sqlstore.DBSession) error {
+		_, err := session.Table("library_panel_variable_defaults").Where("org_id=?", c.SignedInUser.OrgId).Get(&defaults)
+		return err
+	})
+	if defaults.Variables == nil {
+		defaults.Variables = map[string]string{}
+	}
+
+	return defaults, err
+}
+
+// updateVariableDefaults creates or replaces the variable defaults of the org.
+func (lps *LibraryPanelService) updateVariableDefaults(c *models.ReqContext, cmd updateVariableDefaultsCommand) (libraryPanelVariableDefaults, error) {
+	for name := range cmd.Variables {
+		if !variableNamePattern.MatchString(name) {
+			return libraryPanelVariableDefaults{}, errLibraryPanelInvalidVariableDefaults
+		}
+	}
+
+	orgID := c.SignedInUser.OrgId
+	defaults := libraryPanelVariableDefaults{
+		OrgID:     orgID,
+		Variables: cmd.Variables,
+		Updated:   time.Now(),
+		UpdatedBy: c.SignedInUser.UserId,
+	}
+	if defaults.Variables == nil {
+		defaults.Variables = map[string]string{}
+	}
+	err := lps.SQLStore.WithTransactionalDbSession(context.Background(), func(session *sqlstore.DBSession) error {
+		var existing libraryPanelVariableDefaults
+		has, err := session.Table("library_panel_variable_defaults").Where("org_id=?", orgID).Get(&existing)
+		if err != nil {
+			return err
+		}
+
+		if !has {
+			_, err = session.Insert(&defaults)
+			return err
+		}
+
+		defaults.ID = existing.ID
+		_, err = session.ID(existing.ID).AllCols().Update(&defaults)
+		return err
+	})
+
+	return defaults, err
+}
+
+// getOrgVariables gets the variable defaults of the org for resolving Library Panels, leaving out the variables
+// that the dashboard defines itself, so its template variables keep precedence over the org defaults.
+func (lps *LibraryPanelService) getOrgVariables(orgID int64, dash *simplejson.Json) (map[string]string, error) {
+	var defaults libraryPanelVariableDefaults
+	err := lps.SQLStore.WithReadReplicaDbSession(context.Background(), func(session *sqlstore.DBSession) error {
+		_, err := session.Table("library_panel_variable_defaults").Where("org_id=?", orgID).Get(&defaults)
+		return err
+	})
+	if err != nil || len(defaults.Variables) == 0 {
+		return nil, err
+	}
+
+	for _, item := range dash.Get("templating").Get("list").MustArray() {
+		if name := simplejson.NewFromAny(item).Get("name").MustString(); name != "" {
+			delete(defaults.Variables, name)
+		}
+	}
+
+	return defaults.Variables, nil
+}
+
+// substitutingResolver returns a resolver that resolves Library Panels with resolve, and then replaces the
+// placeholders of the variables in the properties of the resolved panels that come from their models. Placeholders
+// of other variables are left for the dashboard to replace. When placeholders were replaced, the model with its
+// placeholders is added to the libraryPanel reference, so that editing the Library Panel saves the placeholders
+// rather than the values of the org.
+func substitutingResolver(variables map[string]string, resolve func(*simplejson.Json, LibraryPanel) error) func(*simplejson.Json, LibraryPanel) error {
+	if len(variables) == 0 {
+		return resolve
+	}
+
+	return func(panel *simplejson.Json, libraryPanel LibraryPanel) error {
+		if err := resolve(panel, libraryPanel); err != nil {
+			return err
+		}
+
+		model := make(map[string]interface{})
+		for key, value := range panel.MustMap() {
+			// the id and position are the dashboard's, the reference is the Library Panel's metadata
+			if key != "id" && key != "gridPos" && key != "libraryPanel" {
+				model[key] = value
+			}
+		}
+		withPlaceholders, err := json.Marshal(model)
+		if err != nil {
+			return err
+		}
+		for key, value := range model {
+			model[key] = substituteVariables(value, variables)
+			panel.Set(key, model[key])
+		}
+		substituted, err := json.Marshal(model)
+		if err != nil {
+			return err
+		}
+
+		if string(substituted) != string(withPlaceholders) {
+			var original map[string]interface{}
+			if err := json.Unmarshal(withPlaceholders, &original); err != nil {
+				return err
+			}
+			panel.Get("libraryPanel").Set("model", original)
+		}
+		return nil
+	}
+}
+
+// substituteVariables replaces the placeholders of the variables in the strings of the JSON value.
+func substituteVariables(value interface{}, variables map[string]string) interface{} {
+	switch v := value.(type) {
+	case string:
+		return placeholderPattern.ReplaceAllStringFunc(v, func(placeholder string) string {
+			if replacement, ok := variables[placeholderPattern.FindStringSubmatch(placeholder)[1]]; ok {
+				return replacement
+			}
+			return placeholder
+		})
+	case map[string]interface{}:
+		for key, item := range v {
+			v[key] = substituteVariables(item, variables)
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = substituteVariables(item, variables)
+		}
+	}
+
+	return value
+}
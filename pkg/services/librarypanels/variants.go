@@ -0,0 +1,316 @@
+package librarypanels
+
+import (
+	"context"
+	"encoding/json"
+	"math/rand"
+	"sort"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/grafana/grafana/pkg/components/simplejson"
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/sqlstore"
+)
+
+// Variants of a Library Panel that are served in dashboards.
+const (
+	variantDefault      = "default"
+	variantExperimental = "experimental"
+)
+
+var variantsServedCounter = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Namespace: "grafana",
+		Name:      "library_panel_variants_served_total",
+		Help:      "A counter for the variants of library panels with an experimental variant served in dashboards",
+	},
+	[]string{"variant"},
+)
+
+func init() {
+	prometheus.MustRegister(variantsServedCounter)
+}
+
+// libraryPanelVariant is an experimental model of a Library Panel, which dashboards get instead of its model for
+// a share of the loads and for the members of some teams, to trial visual changes before they're saved.
+type libraryPanelVariant struct {
+	ID             int64           `json:"-" xorm:"pk autoincr 'id'"`
+	OrgID          int64           `json:"-" xorm:"org_id"`
+	LibraryPanelID int64           `json:"-" xorm:"librarypanel_id"`
+	Model          json.RawMessage `json:"model"`
+	// Percentage is the share of the dashboard loads, from 0 to 100, that get the variant.
+	Percentage int `json:"percentage"`
+	// TeamIDs are the teams whose members always get the variant.
+	TeamIDs []int64 `json:"teamIds" xorm:"-"`
+
+	Created   time.Time `json:"created"`
+	Updated   time.Time `json:"updated"`
+	UpdatedBy int64     `json:"updatedBy"`
+}
+
+// libraryPanelVariantTeam is a team whose members get the experimental variant of a Library Panel.
+type libraryPanelVariantTeam struct {
+	ID             int64 `xorm:"pk autoincr 'id'"`
+	LibraryPanelID int64 `xorm:"librarypanel_id"`
+	TeamID         int64 `xorm:"team_id"`
+}
+
+// setLibraryPanelVariantCommand is the command for setting the experimental variant of a Library Panel.
+type setLibraryPanelVariantCommand struct {
+	Model      json.RawMessage `json:"model"`
+	Percentage int             `json:"percentage"`
+	TeamIDs    []int64         `json:"teamIds"`
+}
+
+func loadVariantTeams(session *sqlstore.DBSession, variants []libraryPanelVariant) error {
+	if len(variants) == 0 {
+		return nil
+	}
+
+	ids := make([]int64, 0, len(variants))
+	byPanel := make(map[int64]*libraryPanelVariant, len(variants))
+	for i := range variants {
+		variants[i].TeamIDs = make([]int64, 0)
+		ids = append(ids, variants[i].LibraryPanelID)
+		byPanel[variants[i].LibraryPanelID] = &variants[i]
+	}
+
+	var teams []libraryPanelVariantTeam
+	if err := session.In("librarypanel_id", ids).OrderBy("team_id ASC").Find(&teams); err != nil {
+		return err
+	}
+	for _, team := range teams {
+		variant := byPanel[team.LibraryPanelID]
+		variant.TeamIDs = append(variant.TeamIDs, team.TeamID)
+	}
+
+	return nil
+}
+
+// getLibraryPanelVariant gets the experimental variant of a Library Panel.
+func (lps *LibraryPanelService) getLibraryPanelVariant(c *models.ReqContext, uid string) (libraryPanelVariant, error) {
+	libraryPanel, err := lps.getLibraryPanel(c, uid)
+	if err != nil {
+		return libraryPanelVariant{}, err
+	}
+
+	var variants []libraryPanelVariant
+	err = lps.SQLStore.WithReadReplicaDbSession(context.Background(), func(session *sqlstore.DBSession) error {
+		if err := session.Where("librarypanel_id=?", libraryPanel.ID).Find(&variants); err != nil {
+			return err
+		}
+		return loadVariantTeams(session, variants)
+	})
+	if err != nil {
+		return libraryPanelVariant{}, err
+	}
+	if len(variants) == 0 {
+		return libraryPanelVariant{}, errLibraryPanelVariantNotFound
+	}
+
+	return variants[0], nil
+}
+
+// setLibraryPanelVariant sets the experimental variant of a Library Panel, replacing the one it has. It requires
+// edit permission on the Library Panel. Only Library Panels that aren't replicated copies can have variants.
+func (lps *LibraryPanelService) setLibraryPanelVariant(c *models.ReqContext, uid string, cmd setLibraryPanelVariantCommand) (libraryPanelVariant, error) {
+	if cmd.Percentage < 0 || cmd.Percentage > 100 {
+		return libraryPanelVariant{}, errLibraryPanelInvalidVariant
+	}
+	cmd.Model = normalizeModel(panelElement, cmd.Model)
+	if err := validateElementModel(panelElement, cmd.Model, lps.Cfg.LibraryPanels); err != nil {
+		return libraryPanelVariant{}, err
+	}
+
+	teams := make(map[int64]bool, len(cmd.TeamIDs))
+	for _, teamID := range cmd.TeamIDs {
+		teams[teamID] = true
+	}
+	teamIDs := make([]int64, 0, len(teams))
+	for teamID := range teams {
+		teamIDs = append(teamIDs, teamID)
+	}
+	sort.Slice(teamIDs, func(i, j int) bool { return teamIDs[i] < teamIDs[j] })
+
+	variant := libraryPanelVariant{
+		Model:      cmd.Model,
+		Percentage: cmd.Percentage,
+		TeamIDs:    teamIDs,
+		Created:    time.Now(),
+		Updated:    time.Now(),
+		UpdatedBy:  c.SignedInUser.UserId,
+	}
+	err := lps.SQLStore.WithTransactionalDbSession(context.Background(), func(session *sqlstore.DBSession) error {
+		libraryPanel, err := getLibraryPanel(session, uid, c.SignedInUser.OrgId)
+		if err != nil {
+			return err
+		}
+		if libraryPanel.Kind != panelElement {
+			return errLibraryPanelInvalidVariant
+		}
+		if libraryPanel.ReplicaOf != 0 {
+			return errLibraryPanelReplica
+		}
+		if err := checkCanEditLibraryPanel(session, lps.SQLStore.Dialect, c.SignedInUser, libraryPanel); err != nil {
+			return err
+		}
+		if len(teamIDs) > 0 {
+			count, err := session.Table("team").Where("org_id=?", libraryPanel.OrgID).In("id", teamIDs).Count()
+			if err != nil {
+				return err
+			}
+			if count != int64(len(teamIDs)) {
+				return errLibraryPanelInvalidVariant
+			}
+		}
+
+		var existing libraryPanelVariant
+		has, err := session.Where("librarypanel_id=?", libraryPanel.ID).Get(&existing)
+		if err != nil {
+			return err
+		}
+		variant.OrgID = libraryPanel.OrgID
+		variant.LibraryPanelID = libraryPanel.ID
+		if has {
+			variant.ID = existing.ID
+			variant.Created = existing.Created
+			if _, err := session.ID(existing.ID).AllCols().Update(&variant); err != nil {
+				return err
+			}
+		} else if _, err := session.Insert(&variant); err != nil {
+			return err
+		}
+
+		if _, err := session.Exec("DELETE FROM library_panel_variant_team WHERE librarypanel_id=?", libraryPanel.ID); err != nil {
+			return err
+		}
+		for _, teamID := range teamIDs {
+			if _, err := session.Insert(&libraryPanelVariantTeam{LibraryPanelID: libraryPanel.ID, TeamID: teamID}); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+
+	return variant, err
+}
+
+// deleteLibraryPanelVariant deletes the experimental variant of a Library Panel, so all dashboard loads get its
+// model again. It requires edit permission on the Library Panel.
+func (lps *LibraryPanelService) deleteLibraryPanelVariant(c *models.ReqContext, uid string) error {
+	return lps.SQLStore.WithTransactionalDbSession(context.Background(), func(session *sqlstore.DBSession) error {
+		libraryPanel, err := getLibraryPanel(session, uid, c.SignedInUser.OrgId)
+		if err != nil {
+			return err
+		}
+		if err := checkCanEditLibraryPanel(session, lps.SQLStore.Dialect, c.SignedInUser, libraryPanel); err != nil {
+			return err
+		}
+
+		result, err := session.Exec("DELETE FROM library_panel_variant WHERE librarypanel_id=?", libraryPanel.ID)
+		if err != nil {
+			return err
+		}
+		if rowsAffected, err := result.RowsAffected(); err != nil {
+			return err
+		} else if rowsAffected == 0 {
+			return errLibraryPanelVariantNotFound
+		}
+		_, err = session.Exec("DELETE FROM library_panel_variant_team WHERE librarypanel_id=?", libraryPanel.ID)
+		return err
+	})
+}
+
+// getLibraryPanelVariantsByUIDs gets the experimental variants of the Library Panels in the org, by Library Panel UID.
+func (lps *LibraryPanelService) getLibraryPanelVariantsByUIDs(orgID int64, uids []string) (map[string]libraryPanelVariant, error) {
+	result := make(map[string]libraryPanelVariant)
+	if len(uids) == 0 {
+		return result, nil
+	}
+
+	err := lps.SQLStore.WithReadReplicaDbSession(context.Background(), func(session *sqlstore.DBSession) error {
+		var libraryPanels []LibraryPanel
+		if err := session.Table("library_panel").Where("org_id=?", orgID).In("uid", uids).Cols("id", "uid").Find(&libraryPanels); err != nil {
+			return err
+		}
+		if len(libraryPanels) == 0 {
+			return nil
+		}
+		uidsByID := make(map[int64]string, len(libraryPanels))
+		ids := make([]int64, 0, len(libraryPanels))
+		for _, libraryPanel := range libraryPanels {
+			uidsByID[libraryPanel.ID] = libraryPanel.UID
+			ids = append(ids, libraryPanel.ID)
+		}
+
+		var variants []libraryPanelVariant
+		if err := session.In("librarypanel_id", ids).Find(&variants); err != nil {
+			return err
+		}
+		if err := loadVariantTeams(session, variants); err != nil {
+			return err
+		}
+		for _, variant := range variants {
+			result[uidsByID[variant.LibraryPanelID]] = variant
+		}
+		return nil
+	})
+
+	return result, err
+}
+
+// serveExperimentalVariant returns true if the dashboard load of the user gets the experimental variant: always
+// for the members of its teams, otherwise for its percentage of the loads. The user is nil for loads without a
+// user, which are never team members.
+func (lps *LibraryPanelService) serveExperimentalVariant(user *models.SignedInUser, variant libraryPanelVariant) bool {
+	if user != nil {
+		for _, teamID := range variant.TeamIDs {
+			for _, userTeamID := range user.Teams {
+				if teamID == userTeamID {
+					return true
+				}
+			}
+		}
+	}
+
+	random := lps.variantRandom
+	if random == nil {
+		random = rand.Float64
+	}
+	return random() < float64(variant.Percentage)/100
+}
+
+// variantResolver returns the resolve function of Library Panels that replaces the references to the Library
+// Panels with variants with the variant the user gets. The variant is picked once per Library Panel, so all
+// the panels of a dashboard that use the same Library Panel get the same variant.
+func (lps *LibraryPanelService) variantResolver(user *models.SignedInUser, variants map[string]libraryPanelVariant) func(*simplejson.Json, LibraryPanel) error {
+	served := make(map[string]string)
+	return func(panel *simplejson.Json, libraryPanel LibraryPanel) error {
+		variant, ok := variants[libraryPanel.UID]
+		if !ok {
+			return resolveLibraryPanel(panel, libraryPanel)
+		}
+
+		name, picked := served[libraryPanel.UID]
+		if !picked {
+			name = variantDefault
+			if lps.serveExperimentalVariant(user, variant) {
+				name = variantExperimental
+			}
+			served[libraryPanel.UID] = name
+			variantsServedCounter.WithLabelValues(name).Inc()
+		}
+		if name == variantDefault {
+			return resolveLibraryPanel(panel, libraryPanel)
+		}
+
+		if err := replaceWithModel(panel, variant.Model, []string{"id", "gridPos"}, "libraryPanel", libraryPanel); err != nil {
+			return err
+		}
+		panel.Get("libraryPanel").Set("variant", variantExperimental)
+		return nil
+	}
+}
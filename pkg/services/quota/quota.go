@@ -146,6 +146,13 @@ func (qs *QuotaService) getQuotaScopes(target string) ([]models.QuotaScope, erro
 			models.QuotaScope{Name: "org", Target: target, DefaultLimit: qs.Cfg.Quota.Org.ApiKey},
 		)
 		return scopes, nil
+	case "library_panel":
+		scopes = append(scopes,
+			models.QuotaScope{Name: "global", Target: target, DefaultLimit: qs.Cfg.Quota.Global.LibraryPanel},
+			models.QuotaScope{Name: "org", Target: target, DefaultLimit: qs.Cfg.Quota.Org.LibraryPanel},
+			models.QuotaScope{Name: "user", Target: target, DefaultLimit: qs.Cfg.Quota.User.LibraryPanel},
+		)
+		return scopes, nil
 	case "session":
 		scopes = append(scopes,
 			models.QuotaScope{Name: "global", Target: target, DefaultLimit: qs.Cfg.Quota.Global.Session},
@@ -8,6 +8,9 @@ const (
 	DashHitDB     HitType = "dash-db"
 	DashHitHome   HitType = "dash-home"
 	DashHitFolder HitType = "dash-folder"
+	// DashHitLibraryPanel is the hit type for library panels, which are only
+	// returned when the Panel Library feature is enabled.
+	DashHitLibraryPanel HitType = "library-panel"
 )
 
 type Hit struct {
@@ -24,6 +27,8 @@ type Hit struct {
 	FolderUid   string   `json:"folderUid,omitempty"`
 	FolderTitle string   `json:"folderTitle,omitempty"`
 	FolderUrl   string   `json:"folderUrl,omitempty"`
+	// LibraryPanelCount is the number of library panels a dashboard uses, if the Panel Library feature is enabled.
+	LibraryPanelCount int64 `json:"libraryPanelCount,omitempty"`
 }
 
 type HitList []*Hit
@@ -1,7 +1,9 @@
 package search
 
 import (
+	"errors"
 	"sort"
+	"strings"
 
 	"github.com/grafana/grafana/pkg/setting"
 
@@ -27,6 +29,8 @@ type Query struct {
 	FolderIds    []int64
 	Permission   models.PermissionType
 	Sort         string
+	// LibraryPanelUID, if set, limits the result to the dashboards using that library panel.
+	LibraryPanelUID string
 
 	Result HitList
 }
@@ -43,12 +47,31 @@ type FindPersistedDashboardsQuery struct {
 	Limit        int64
 	Page         int64
 	Permission   models.PermissionType
+	// LibraryPanelUID, if set, limits the result to the dashboards using that library panel.
+	LibraryPanelUID string
+	// IncludeLibraryPanelCount adds the number of library panels each dashboard uses to the result.
+	IncludeLibraryPanelCount bool
 
 	Filters []interface{}
 
 	Result HitList
 }
 
+// FindLibraryPanelsQuery is handled by the library panels service, if enabled.
+type FindLibraryPanelsQuery struct {
+	Title        string
+	SignedInUser *models.SignedInUser
+	FolderIds    []int64
+	Tags         []string
+	Limit        int64
+	Page         int64
+	Permission   models.PermissionType
+	// Descending orders the library panels by name from Z to A.
+	Descending bool
+
+	Result HitList
+}
+
 type SearchService struct {
 	Bus bus.Bus      `inject:""`
 	Cfg *setting.Cfg `inject:""`
@@ -78,19 +101,71 @@ func (s *SearchService) searchHandler(query *Query) error {
 		Limit:        query.Limit,
 		Page:         query.Page,
 		Permission:   query.Permission,
+
+		LibraryPanelUID: query.LibraryPanelUID,
 	}
 
+	// no dashboard uses library panels if they are disabled, and their tables don't exist
+	libraryPanelsEnabled := s.Cfg != nil && s.Cfg.IsPanelLibraryEnabled()
+	if query.LibraryPanelUID != "" && !libraryPanelsEnabled {
+		query.Result = HitList{}
+		return nil
+	}
+	dashboardQuery.IncludeLibraryPanelCount = libraryPanelsEnabled
+
 	if sortOpt, exists := s.sortOptions[query.Sort]; exists {
 		for _, filter := range sortOpt.Filter {
 			dashboardQuery.Filters = append(dashboardQuery.Filters, filter)
 		}
 	}
 
-	if err := bus.Dispatch(&dashboardQuery); err != nil {
-		return err
+	libraryPanels := includeLibraryPanels(query)
+	descending := query.Sort == sortAlphaDesc.Name
+	// library panels can only be sorted by title, so other sort options leave them out of dashboard results
+	if libraryPanels && query.Type == "" && query.Sort != "" && query.Sort != sortAlphaAsc.Name && !descending {
+		libraryPanels = false
+	}
+	// dashboards and library panels are merged by title and paginated once, so both are read up to the end
+	// of the page
+	mixed := libraryPanels && query.Type != string(DashHitLibraryPanel) && query.Limit > 0
+	limit, page := query.Limit, query.Page
+	if mixed {
+		if page < 1 {
+			page = 1
+		}
+		limit, page = page*query.Limit, 1
+		dashboardQuery.Limit, dashboardQuery.Page = limit, page
+	}
+
+	hits := HitList{}
+	if query.Type != string(DashHitLibraryPanel) {
+		if err := bus.Dispatch(&dashboardQuery); err != nil {
+			return err
+		}
+		hits = append(hits, dashboardQuery.Result...)
+	}
+
+	if libraryPanels {
+		libraryPanelQuery := FindLibraryPanelsQuery{
+			Title:        query.Title,
+			SignedInUser: query.SignedInUser,
+			FolderIds:    query.FolderIds,
+			Tags:         query.Tags,
+			Limit:        limit,
+			Page:         page,
+			Permission:   query.Permission,
+			Descending:   descending,
+		}
+		if err := bus.Dispatch(&libraryPanelQuery); err != nil && !errors.Is(err, bus.ErrHandlerNotFound) {
+			return err
+		}
+		hits = append(hits, libraryPanelQuery.Result...)
+	}
+
+	if mixed {
+		hits = pageOfMergedHits(hits, query.Limit, query.Page, descending)
 	}
 
-	hits := dashboardQuery.Result
 	if query.Sort == "" {
 		hits = sortedHits(hits)
 	}
@@ -104,6 +179,44 @@ func (s *SearchService) searchHandler(query *Query) error {
 	return nil
 }
 
+// includeLibraryPanels returns true if library panels should be part of the search result.
+// Filters that only apply to dashboards, like starred, dashboard IDs or library panel usage, exclude them.
+func includeLibraryPanels(query *Query) bool {
+	if query.LibraryPanelUID != "" {
+		return false
+	}
+	if query.Type == string(DashHitLibraryPanel) {
+		return true
+	}
+
+	return query.Type == "" && !query.IsStarred && len(query.DashboardIds) == 0
+}
+
+// pageOfMergedHits orders the dashboards and library panels by title, like the database orders each of them,
+// and returns the hits of the page.
+func pageOfMergedHits(hits HitList, limit int64, page int64, descending bool) HitList {
+	sort.SliceStable(hits, func(i, j int) bool {
+		if descending {
+			return strings.ToLower(hits[i].Title) > strings.ToLower(hits[j].Title)
+		}
+		return strings.ToLower(hits[i].Title) < strings.ToLower(hits[j].Title)
+	})
+
+	if page < 1 {
+		page = 1
+	}
+	start := (page - 1) * limit
+	if start >= int64(len(hits)) {
+		return HitList{}
+	}
+	end := start + limit
+	if end > int64(len(hits)) {
+		end = int64(len(hits))
+	}
+
+	return hits[start:end]
+}
+
 func sortedHits(unsorted HitList) HitList {
 	hits := make(HitList, 0)
 	hits = append(hits, unsorted...)
@@ -127,6 +240,9 @@ func setStarredDashboards(userID int64, hits []*Hit) error {
 	}
 
 	for _, dashboard := range hits {
+		if dashboard.Type == DashHitLibraryPanel {
+			continue
+		}
 		if _, ok := query.Result[dashboard.Id]; ok {
 			dashboard.IsStarred = true
 		}
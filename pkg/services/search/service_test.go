@@ -5,6 +5,8 @@ import (
 
 	"github.com/grafana/grafana/pkg/bus"
 	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/sqlstore/searchstore"
+	"github.com/grafana/grafana/pkg/setting"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -55,3 +57,124 @@ func TestSearch_SortedResults(t *testing.T) {
 	assert.Equal(t, "BB", query.Result[3].Tags[1])
 	assert.Equal(t, "EE", query.Result[3].Tags[2])
 }
+
+func TestSearch_LibraryPanels(t *testing.T) {
+	bus.AddHandler("test", func(query *FindPersistedDashboardsQuery) error {
+		query.Result = HitList{
+			&Hit{Id: 10, Title: "BBAA", Type: "dash-db"},
+		}
+		return nil
+	})
+
+	bus.AddHandler("test", func(query *FindLibraryPanelsQuery) error {
+		query.Result = HitList{
+			&Hit{Id: 10, Title: "AABB", Type: DashHitLibraryPanel},
+		}
+		return nil
+	})
+
+	bus.AddHandler("test", func(query *models.GetUserStarsQuery) error {
+		query.Result = map[int64]bool{10: true}
+		return nil
+	})
+
+	svc := &SearchService{}
+
+	t.Run("Should include library panels alongside dashboards", func(t *testing.T) {
+		query := &Query{SignedInUser: &models.SignedInUser{}}
+
+		err := svc.searchHandler(query)
+		require.NoError(t, err)
+		require.Len(t, query.Result, 2)
+		assert.Equal(t, DashHitLibraryPanel, query.Result[0].Type)
+		assert.False(t, query.Result[0].IsStarred)
+		assert.True(t, query.Result[1].IsStarred)
+	})
+
+	t.Run("Should only return library panels when filtering by type", func(t *testing.T) {
+		query := &Query{SignedInUser: &models.SignedInUser{}, Type: string(DashHitLibraryPanel)}
+
+		err := svc.searchHandler(query)
+		require.NoError(t, err)
+		require.Len(t, query.Result, 1)
+		assert.Equal(t, "AABB", query.Result[0].Title)
+	})
+
+	t.Run("Should not include library panels when filtering starred dashboards", func(t *testing.T) {
+		query := &Query{SignedInUser: &models.SignedInUser{}, IsStarred: true}
+
+		err := svc.searchHandler(query)
+		require.NoError(t, err)
+		require.Len(t, query.Result, 1)
+		assert.Equal(t, "BBAA", query.Result[0].Title)
+	})
+
+	t.Run("Should only return dashboards when filtering by library panel usage", func(t *testing.T) {
+		svc := &SearchService{Cfg: &setting.Cfg{LibraryPanels: setting.LibraryPanelsSettings{Enabled: true}}}
+		query := &Query{SignedInUser: &models.SignedInUser{}, LibraryPanelUID: "lp1"}
+
+		err := svc.searchHandler(query)
+		require.NoError(t, err)
+		require.Len(t, query.Result, 1)
+		assert.Equal(t, "BBAA", query.Result[0].Title)
+	})
+
+	t.Run("Should not return dashboards when filtering by library panel usage and library panels are disabled", func(t *testing.T) {
+		query := &Query{SignedInUser: &models.SignedInUser{}, LibraryPanelUID: "lp1"}
+
+		err := svc.searchHandler(query)
+		require.NoError(t, err)
+		require.Empty(t, query.Result)
+	})
+}
+
+func TestSearch_MixedResultsPagination(t *testing.T) {
+	// the fake sources page their titles like the database, dashboards and library panels alternate by title
+	pageOf := func(titles []string, hitType HitType, limit int64, page int64, descending bool) HitList {
+		ordered := append([]string{}, titles...)
+		if descending {
+			for i, j := 0, len(ordered)-1; i < j; i, j = i+1, j-1 {
+				ordered[i], ordered[j] = ordered[j], ordered[i]
+			}
+		}
+		hits := HitList{}
+		for i := (page - 1) * limit; i < page*limit && i < int64(len(ordered)); i++ {
+			hits = append(hits, &Hit{Title: ordered[i], Type: hitType})
+		}
+		return hits
+	}
+	bus.AddHandler("test", func(query *FindPersistedDashboardsQuery) error {
+		descending := len(query.Filters) > 0 && query.Filters[0] == searchstore.TitleSorter{Descending: true}
+		query.Result = pageOf([]string{"A", "C", "E", "G", "I"}, DashHitDB, query.Limit, query.Page, descending)
+		return nil
+	})
+	bus.AddHandler("test", func(query *FindLibraryPanelsQuery) error {
+		query.Result = pageOf([]string{"B", "D", "F", "H", "J"}, DashHitLibraryPanel, query.Limit, query.Page, query.Descending)
+		return nil
+	})
+	bus.AddHandler("test", func(query *models.GetUserStarsQuery) error {
+		query.Result = map[int64]bool{}
+		return nil
+	})
+
+	svc := &SearchService{}
+	svc.sortOptions = map[string]SortOption{sortAlphaAsc.Name: sortAlphaAsc, sortAlphaDesc.Name: sortAlphaDesc}
+	titles := func(query *Query) []string {
+		t.Helper()
+		err := svc.searchHandler(query)
+		require.NoError(t, err)
+		require.LessOrEqual(t, int64(len(query.Result)), query.Limit)
+		titles := make([]string, 0, len(query.Result))
+		for _, hit := range query.Result {
+			titles = append(titles, hit.Title)
+		}
+		return titles
+	}
+
+	assert.Equal(t, []string{"A", "B", "C"}, titles(&Query{SignedInUser: &models.SignedInUser{}, Limit: 3, Page: 1}))
+	assert.Equal(t, []string{"D", "E", "F"}, titles(&Query{SignedInUser: &models.SignedInUser{}, Limit: 3, Page: 2}))
+	assert.Equal(t, []string{"J"}, titles(&Query{SignedInUser: &models.SignedInUser{}, Limit: 3, Page: 4}))
+	assert.Empty(t, titles(&Query{SignedInUser: &models.SignedInUser{}, Limit: 3, Page: 5}))
+	assert.Equal(t, []string{"G", "F", "E"}, titles(&Query{SignedInUser: &models.SignedInUser{}, Limit: 3, Page: 2, Sort: sortAlphaDesc.Name}))
+	assert.Equal(t, []string{"B", "D", "F"}, titles(&Query{SignedInUser: &models.SignedInUser{}, Limit: 3, Page: 1, Type: string(DashHitLibraryPanel)}))
+}
@@ -128,6 +128,7 @@ func (r *SQLAnnotationRepo) Find(query *annotations.ItemQuery) ([]*annotations.I
 			annotation.epoch_end as time_end,
 			annotation.dashboard_id,
 			annotation.panel_id,
+			annotation.library_panel_uid,
 			annotation.new_state,
 			annotation.prev_state,
 			annotation.alert_id,
@@ -160,14 +161,32 @@ func (r *SQLAnnotationRepo) Find(query *annotations.ItemQuery) ([]*annotations.I
 		params = append(params, query.AlertId)
 	}
 
-	if query.DashboardId != 0 {
-		sql.WriteString(` AND a.dashboard_id = ?`)
-		params = append(params, query.DashboardId)
-	}
+	if len(query.LibraryPanelUids) > 0 {
+		// annotations of the library panels are shown in every dashboard using them
+		sql.WriteString(` AND (a.library_panel_uid IN (?` + strings.Repeat(",?", len(query.LibraryPanelUids)-1) + `)`)
+		for _, uid := range query.LibraryPanelUids {
+			params = append(params, uid)
+		}
+		if query.DashboardId != 0 {
+			sql.WriteString(` OR (a.dashboard_id = ?`)
+			params = append(params, query.DashboardId)
+			if query.PanelId != 0 {
+				sql.WriteString(` AND a.panel_id = ?`)
+				params = append(params, query.PanelId)
+			}
+			sql.WriteString(`)`)
+		}
+		sql.WriteString(`)`)
+	} else {
+		if query.DashboardId != 0 {
+			sql.WriteString(` AND a.dashboard_id = ?`)
+			params = append(params, query.DashboardId)
+		}
 
-	if query.PanelId != 0 {
-		sql.WriteString(` AND a.panel_id = ?`)
-		params = append(params, query.PanelId)
+		if query.PanelId != 0 {
+			sql.WriteString(` AND a.panel_id = ?`)
+			params = append(params, query.PanelId)
+		}
 	}
 
 	if query.UserId != 0 {
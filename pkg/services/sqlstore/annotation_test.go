@@ -252,4 +252,46 @@ func TestAnnotations(t *testing.T) {
 			assert.Empty(t, items)
 		})
 	})
+
+	t.Run("Testing annotations of library panels", func(t *testing.T) {
+		t.Cleanup(func() {
+			_, err := x.Exec("DELETE FROM annotation WHERE 1=1")
+			assert.NoError(t, err)
+		})
+
+		for _, item := range []*annotations.Item{
+			{OrgId: 1, UserId: 1, DashboardId: 1, PanelId: 2, Text: "panel", Epoch: 10},
+			{OrgId: 1, UserId: 1, DashboardId: 1, PanelId: 3, Text: "other panel", Epoch: 10},
+			{OrgId: 1, UserId: 1, LibraryPanelUid: "lib-uid", Text: "query changed", Epoch: 10},
+			{OrgId: 1, UserId: 1, LibraryPanelUid: "other-lib-uid", Text: "other library panel", Epoch: 10},
+		} {
+			err := repo.Save(item)
+			require.NoError(t, err)
+		}
+
+		t.Run("Can query for the annotations of a panel and its library panel", func(t *testing.T) {
+			items, err := repo.Find(&annotations.ItemQuery{
+				OrgId:            1,
+				DashboardId:      1,
+				PanelId:          2,
+				LibraryPanelUids: []string{"lib-uid"},
+			})
+			require.NoError(t, err)
+			require.Len(t, items, 2)
+			texts := []string{items[0].Text, items[1].Text}
+			assert.ElementsMatch(t, []string{"panel", "query changed"}, texts)
+		})
+
+		t.Run("Can query for the annotations of library panels", func(t *testing.T) {
+			items, err := repo.Find(&annotations.ItemQuery{
+				OrgId:            1,
+				LibraryPanelUids: []string{"lib-uid", "other-lib-uid"},
+			})
+			require.NoError(t, err)
+			require.Len(t, items, 2)
+			for _, item := range items {
+				assert.NotEmpty(t, item.LibraryPanelUid)
+			}
+		})
+	})
 }
@@ -213,6 +213,8 @@ type DashboardSearchProjection struct {
 	FolderUid   string
 	FolderSlug  string
 	FolderTitle string
+
+	LibraryPanelCount int64
 }
 
 func findDashboards(query *search.FindPersistedDashboardsQuery) ([]DashboardSearchProjection, error) {
@@ -258,8 +260,12 @@ func findDashboards(query *search.FindPersistedDashboardsQuery) ([]DashboardSear
 		filters = append(filters, searchstore.FolderFilter{IDs: query.FolderIds})
 	}
 
+	if query.LibraryPanelUID != "" {
+		filters = append(filters, searchstore.LibraryPanelFilter{UID: query.LibraryPanelUID})
+	}
+
 	var res []DashboardSearchProjection
-	sb := &searchstore.Builder{Dialect: dialect, Filters: filters}
+	sb := &searchstore.Builder{Dialect: dialect, Filters: filters, LibraryPanelCount: query.IncludeLibraryPanelCount}
 
 	limit := query.Limit
 	if limit < 1 {
@@ -320,6 +326,8 @@ func makeQueryResult(query *search.FindPersistedDashboardsQuery, res []Dashboard
 				FolderUid:   item.FolderUid,
 				FolderTitle: item.FolderTitle,
 				Tags:        []string{},
+
+				LibraryPanelCount: item.LibraryPanelCount,
 			}
 
 			if item.FolderId > 0 {
@@ -178,6 +178,16 @@ func addAnnotationMig(mg *Migrator) {
 	mg.AddMigration("Add index for alert_id on annotation table", NewAddIndexMigration(table, &Index{
 		Cols: []string{"alert_id"}, Type: IndexType,
 	}))
+
+	//
+	// Annotations of library panels
+	//
+	mg.AddMigration("Add library_panel_uid column to annotation table", NewAddColumnMigration(table, &Column{
+		Name: "library_panel_uid", Type: DB_NVarchar, Length: 40, Nullable: true,
+	}))
+	mg.AddMigration("Add index for org_id_library_panel_uid on annotation table", NewAddIndexMigration(table, &Index{
+		Cols: []string{"org_id", "library_panel_uid"}, Type: IndexType,
+	}))
 }
 
 type AddMakeRegionSingleRowMigration struct {
@@ -42,4 +42,8 @@ func addPreferencesMigrations(mg *Migrator) {
 		SQLite("UPDATE preferences SET team_id=0 WHERE team_id IS NULL;").
 		Postgres("UPDATE preferences SET team_id=0 WHERE team_id IS NULL;").
 		Mysql("UPDATE preferences SET team_id=0 WHERE team_id IS NULL;"))
+
+	mg.AddMigration("Add column library_panel_folder_id in preferences", NewAddColumnMigration(preferencesV2, &Column{
+		Name: "library_panel_folder_id", Type: DB_BigInt, Nullable: false, Default: "0",
+	}))
 }
@@ -23,6 +23,15 @@ type targetCount struct {
 	Count int64
 }
 
+// userQuotaColumn returns the column that relates rows of the target table to a user.
+func userQuotaColumn(target string) string {
+	if target == "library_panel" {
+		return "created_by"
+	}
+
+	return "user_id"
+}
+
 func GetOrgQuotaByTarget(query *models.GetOrgQuotaByTargetQuery) error {
 	quota := models.Quota{
 		Target: query.Target,
@@ -139,7 +148,7 @@ func GetUserQuotaByTarget(query *models.GetUserQuotaByTargetQuery) error {
 	}
 
 	// get quota used.
-	rawSQL := fmt.Sprintf("SELECT COUNT(*) as count from %s where user_id=?", dialect.Quote(query.Target))
+	rawSQL := fmt.Sprintf("SELECT COUNT(*) as count from %s where %s=?", dialect.Quote(query.Target), userQuotaColumn(query.Target))
 	resp := make([]*targetCount, 0)
 	if err := x.SQL(rawSQL, query.UserId).Find(&resp); err != nil {
 		return err
@@ -182,7 +191,7 @@ func GetUserQuotas(query *models.GetUserQuotasQuery) error {
 	result := make([]*models.UserQuotaDTO, len(quotas))
 	for i, q := range quotas {
 		// get quota used.
-		rawSQL := fmt.Sprintf("SELECT COUNT(*) as count from %s where user_id=?", dialect.Quote(q.Target))
+		rawSQL := fmt.Sprintf("SELECT COUNT(*) as count from %s where %s=?", dialect.Quote(q.Target), userQuotaColumn(q.Target))
 		resp := make([]*targetCount, 0)
 		if err := x.SQL(rawSQL, q.UserId).Find(&resp); err != nil {
 			return err
@@ -15,6 +15,9 @@ type Builder struct {
 	// to modify the query.
 	Filters []interface{}
 	Dialect migrator.Dialect
+	// LibraryPanelCount adds the number of library panels each dashboard uses,
+	// which requires the library panel tables.
+	LibraryPanelCount bool
 
 	params []interface{}
 	sql    bytes.Buffer
@@ -37,6 +40,14 @@ func (b *Builder) ToSQL(limit, page int64) (string, []interface{}) {
 	b.sql.WriteString(
 		`LEFT OUTER JOIN dashboard AS folder ON folder.id = dashboard.folder_id
 		LEFT OUTER JOIN dashboard_tag ON dashboard.id = dashboard_tag.dashboard_id`)
+	if b.LibraryPanelCount {
+		b.sql.WriteString(`
+		LEFT OUTER JOIN (
+			SELECT dashboard_id, COUNT(DISTINCT librarypanel_id) AS panel_count
+			FROM library_panel_dashboard
+			GROUP BY dashboard_id
+		) AS library_panels ON library_panels.dashboard_id = dashboard.id`)
+	}
 	b.sql.WriteString("\n")
 	b.sql.WriteString(orderQuery)
 
@@ -55,7 +66,12 @@ func (b *Builder) buildSelect() {
 			dashboard.folder_id,
 			folder.uid AS folder_uid,
 			folder.slug AS folder_slug,
-			folder.title AS folder_title
+			folder.title AS folder_title`)
+	if b.LibraryPanelCount {
+		b.sql.WriteString(`,
+			COALESCE(library_panels.panel_count, 0) AS library_panel_count`)
+	}
+	b.sql.WriteString(`
 		FROM `)
 }
 
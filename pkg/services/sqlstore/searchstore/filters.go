@@ -98,6 +98,18 @@ func (f DashboardFilter) Where() (string, []interface{}) {
 	return sqlIDin("dashboard.id", f.IDs)
 }
 
+// LibraryPanelFilter limits the result to the dashboards connected to the library panel with the UID.
+type LibraryPanelFilter struct {
+	UID string
+}
+
+func (f LibraryPanelFilter) Where() (string, []interface{}) {
+	return `dashboard.id IN (SELECT library_panel_dashboard.dashboard_id
+			 FROM library_panel_dashboard
+			 INNER JOIN library_panel ON library_panel.id = library_panel_dashboard.librarypanel_id
+			 WHERE library_panel.org_id = dashboard.org_id AND library_panel.uid = ?)`, []interface{}{f.UID}
+}
+
 type TagsFilter struct {
 	Tags []string
 }
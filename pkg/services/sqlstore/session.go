@@ -57,6 +57,25 @@ func (ss *SQLStore) WithDbSession(ctx context.Context, callback dbTransactionFun
 	return callback(sess)
 }
 
+// WithReadReplicaDbSession calls the callback with a session connected to the read replica, if
+// one is configured. Otherwise, or when the context already carries a session (for example
+// within a transaction), it behaves like WithDbSession.
+// Only use it for read queries that can tolerate replication lag.
+func (ss *SQLStore) WithReadReplicaDbSession(ctx context.Context, callback dbTransactionFunc) error {
+	engine := ss.engine
+	if ss.replicaEngine != nil {
+		engine = ss.replicaEngine
+	}
+
+	sess, err := startSession(ctx, engine, false)
+	if err != nil {
+		return err
+	}
+	defer sess.Close()
+
+	return callback(sess)
+}
+
 func withDbSession(ctx context.Context, callback dbTransactionFunc) error {
 	sess, err := startSession(ctx, x, false)
 	if err != nil {
@@ -24,6 +24,10 @@ func (sb *SQLBuilder) GetSQLString() string {
 	return sb.sql.String()
 }
 
+func (sb *SQLBuilder) GetParams() []interface{} {
+	return sb.params
+}
+
 func (sb *SQLBuilder) AddParams(params ...interface{}) {
 	sb.params = append(sb.params, params...)
 }
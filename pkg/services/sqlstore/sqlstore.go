@@ -54,6 +54,8 @@ type SQLStore struct {
 
 	dbCfg                       DatabaseConfig
 	engine                      *xorm.Engine
+	replicaCfg                  *DatabaseConfig
+	replicaEngine               *xorm.Engine
 	log                         log.Logger
 	Dialect                     migrator.Dialect
 	skipEnsureDefaultOrgAndUser bool
@@ -195,13 +197,13 @@ func (ss *SQLStore) ensureMainOrgAndAdminUser() error {
 	return err
 }
 
-func (ss *SQLStore) buildExtraConnectionString(sep rune) string {
-	if ss.dbCfg.UrlQueryParams == nil {
+func buildExtraConnectionString(dbCfg *DatabaseConfig, sep rune) string {
+	if dbCfg.UrlQueryParams == nil {
 		return ""
 	}
 
 	var sb strings.Builder
-	for key, values := range ss.dbCfg.UrlQueryParams {
+	for key, values := range dbCfg.UrlQueryParams {
 		for _, value := range values {
 			sb.WriteRune(sep)
 			sb.WriteString(key)
@@ -213,25 +215,30 @@ func (ss *SQLStore) buildExtraConnectionString(sep rune) string {
 }
 
 func (ss *SQLStore) buildConnectionString() (string, error) {
-	cnnstr := ss.dbCfg.ConnectionString
+	return ss.buildConnectionStringFor(&ss.dbCfg)
+}
+
+// buildConnectionStringFor builds the connection string for the given database configuration.
+func (ss *SQLStore) buildConnectionStringFor(dbCfg *DatabaseConfig) (string, error) {
+	cnnstr := dbCfg.ConnectionString
 
 	// special case used by integration tests
 	if cnnstr != "" {
 		return cnnstr, nil
 	}
 
-	switch ss.dbCfg.Type {
+	switch dbCfg.Type {
 	case migrator.MySQL:
 		protocol := "tcp"
-		if strings.HasPrefix(ss.dbCfg.Host, "/") {
+		if strings.HasPrefix(dbCfg.Host, "/") {
 			protocol = "unix"
 		}
 
 		cnnstr = fmt.Sprintf("%s:%s@%s(%s)/%s?collation=utf8mb4_unicode_ci&allowNativePasswords=true",
-			ss.dbCfg.User, ss.dbCfg.Pwd, protocol, ss.dbCfg.Host, ss.dbCfg.Name)
+			dbCfg.User, dbCfg.Pwd, protocol, dbCfg.Host, dbCfg.Name)
 
-		if ss.dbCfg.SslMode == "true" || ss.dbCfg.SslMode == "skip-verify" {
-			tlsCert, err := makeCert(ss.dbCfg)
+		if dbCfg.SslMode == "true" || dbCfg.SslMode == "skip-verify" {
+			tlsCert, err := makeCert(*dbCfg)
 			if err != nil {
 				return "", err
 			}
@@ -242,37 +249,37 @@ func (ss *SQLStore) buildConnectionString() (string, error) {
 			cnnstr += "&tls=custom"
 		}
 
-		cnnstr += ss.buildExtraConnectionString('&')
+		cnnstr += buildExtraConnectionString(dbCfg, '&')
 	case migrator.Postgres:
-		addr, err := util.SplitHostPortDefault(ss.dbCfg.Host, "127.0.0.1", "5432")
+		addr, err := util.SplitHostPortDefault(dbCfg.Host, "127.0.0.1", "5432")
 		if err != nil {
-			return "", errutil.Wrapf(err, "Invalid host specifier '%s'", ss.dbCfg.Host)
+			return "", errutil.Wrapf(err, "Invalid host specifier '%s'", dbCfg.Host)
 		}
 
-		if ss.dbCfg.Pwd == "" {
-			ss.dbCfg.Pwd = "''"
+		if dbCfg.Pwd == "" {
+			dbCfg.Pwd = "''"
 		}
-		if ss.dbCfg.User == "" {
-			ss.dbCfg.User = "''"
+		if dbCfg.User == "" {
+			dbCfg.User = "''"
 		}
 		cnnstr = fmt.Sprintf("user=%s password=%s host=%s port=%s dbname=%s sslmode=%s sslcert=%s sslkey=%s sslrootcert=%s",
-			ss.dbCfg.User, ss.dbCfg.Pwd, addr.Host, addr.Port, ss.dbCfg.Name, ss.dbCfg.SslMode, ss.dbCfg.ClientCertPath,
-			ss.dbCfg.ClientKeyPath, ss.dbCfg.CaCertPath)
+			dbCfg.User, dbCfg.Pwd, addr.Host, addr.Port, dbCfg.Name, dbCfg.SslMode, dbCfg.ClientCertPath,
+			dbCfg.ClientKeyPath, dbCfg.CaCertPath)
 
-		cnnstr += ss.buildExtraConnectionString(' ')
+		cnnstr += buildExtraConnectionString(dbCfg, ' ')
 	case migrator.SQLite:
 		// special case for tests
-		if !filepath.IsAbs(ss.dbCfg.Path) {
-			ss.dbCfg.Path = filepath.Join(ss.Cfg.DataPath, ss.dbCfg.Path)
+		if !filepath.IsAbs(dbCfg.Path) {
+			dbCfg.Path = filepath.Join(ss.Cfg.DataPath, dbCfg.Path)
 		}
-		if err := os.MkdirAll(path.Dir(ss.dbCfg.Path), os.ModePerm); err != nil {
+		if err := os.MkdirAll(path.Dir(dbCfg.Path), os.ModePerm); err != nil {
 			return "", err
 		}
 
-		cnnstr = fmt.Sprintf("file:%s?cache=%s&mode=rwc", ss.dbCfg.Path, ss.dbCfg.CacheMode)
-		cnnstr += ss.buildExtraConnectionString('&')
+		cnnstr = fmt.Sprintf("file:%s?cache=%s&mode=rwc", dbCfg.Path, dbCfg.CacheMode)
+		cnnstr += buildExtraConnectionString(dbCfg, '&')
 	default:
-		return "", fmt.Errorf("unknown database type: %s", ss.dbCfg.Type)
+		return "", fmt.Errorf("unknown database type: %s", dbCfg.Type)
 	}
 
 	return cnnstr, nil
@@ -344,6 +351,42 @@ func (ss *SQLStore) initEngine() error {
 	}
 
 	ss.engine = engine
+
+	if ss.replicaCfg != nil {
+		if err := ss.initReplicaEngine(); err != nil {
+			return errutil.Wrap("failed to connect to read replica", err)
+		}
+	}
+
+	return nil
+}
+
+// initReplicaEngine initializes ss.replicaEngine, which is used for read-only queries.
+func (ss *SQLStore) initReplicaEngine() error {
+	if ss.replicaCfg.Type != ss.dbCfg.Type {
+		return fmt.Errorf("read replica type %q does not match database type %q", ss.replicaCfg.Type, ss.dbCfg.Type)
+	}
+	if ss.replicaCfg.Type == migrator.SQLite {
+		return fmt.Errorf("read replicas are not supported for %q", migrator.SQLite)
+	}
+
+	connectionString, err := ss.buildConnectionStringFor(ss.replicaCfg)
+	if err != nil {
+		return err
+	}
+
+	sqlog.Info("Connecting to read replica", "dbtype", ss.replicaCfg.Type)
+	engine, err := xorm.NewEngine(ss.dbCfg.Type, connectionString)
+	if err != nil {
+		return err
+	}
+
+	engine.SetMaxOpenConns(ss.dbCfg.MaxOpenConn)
+	engine.SetMaxIdleConns(ss.dbCfg.MaxIdleConn)
+	engine.SetConnMaxLifetime(time.Second * time.Duration(ss.dbCfg.ConnMaxLifetime))
+	engine.SetLogger(ss.engine.Logger())
+
+	ss.replicaEngine = engine
 	return nil
 }
 
@@ -391,6 +434,37 @@ func (ss *SQLStore) readConfig() {
 
 	ss.dbCfg.CacheMode = sec.Key("cache_mode").MustString("private")
 	ss.dbCfg.SkipMigrations = sec.Key("skip_migrations").MustBool()
+
+	replicaURL := sec.Key("replica_url").String()
+	if len(replicaURL) != 0 {
+		dbURL, err := url.Parse(replicaURL)
+		if err != nil {
+			sqlog.Error("Failed to parse read replica url, falling back to the primary database", "error", err)
+			return
+		}
+
+		replicaCfg := ss.dbCfg
+		replicaCfg.ConnectionString = ""
+		replicaCfg.Type = dbURL.Scheme
+		replicaCfg.Host = dbURL.Host
+		replicaCfg.Name = ""
+		replicaCfg.User = ""
+		replicaCfg.Pwd = ""
+
+		pathSplit := strings.Split(dbURL.Path, "/")
+		if len(pathSplit) > 1 {
+			replicaCfg.Name = pathSplit[1]
+		}
+
+		userInfo := dbURL.User
+		if userInfo != nil {
+			replicaCfg.User = userInfo.Username()
+			replicaCfg.Pwd, _ = userInfo.Password()
+		}
+
+		replicaCfg.UrlQueryParams = dbURL.Query()
+		ss.replicaCfg = &replicaCfg
+	}
 }
 
 // ITestDB is an interface of arguments for testing db
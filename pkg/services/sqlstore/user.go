@@ -723,6 +723,13 @@ func deleteUserInTransaction(sess *DBSession, cmd *models.DeleteUserCommand) err
 		}
 	}
 
+	sess.publishAfterCommit(&events.UserDeleted{
+		Timestamp: time.Now(),
+		Id:        user.Id,
+		Login:     user.Login,
+		Email:     user.Email,
+	})
+
 	return nil
 }
 
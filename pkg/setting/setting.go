@@ -217,6 +217,9 @@ type Cfg struct {
 	// SMTP email settings
 	Smtp SmtpSettings
 
+	// Library panels
+	LibraryPanels LibraryPanelsSettings
+
 	// Rendering
 	ImagesDir                      string
 	RendererUrl                    string
@@ -368,7 +371,7 @@ func (cfg Cfg) IsHTTPRequestHistogramEnabled() bool {
 
 // IsPanelLibraryEnabled returns whether the panel library feature is enabled.
 func (cfg Cfg) IsPanelLibraryEnabled() bool {
-	return cfg.FeatureToggles["panelLibrary"]
+	return cfg.LibraryPanels.Enabled || cfg.FeatureToggles["panelLibrary"]
 }
 
 type CommandLineArgs struct {
@@ -825,7 +828,6 @@ func (cfg *Cfg) Load(args *CommandLineArgs) error {
 
 	panelsSection := iniFile.Section("panels")
 	cfg.DisableSanitizeHtml = panelsSection.Key("disable_sanitize_html").MustBool(false)
-
 	pluginsSection := iniFile.Section("plugins")
 	cfg.PluginsEnableAlpha = pluginsSection.Key("enable_alpha").MustBool(false)
 	cfg.PluginsAppsSkipVerifyTLS = pluginsSection.Key("app_tls_skip_verify_insecure").MustBool(false)
@@ -853,6 +855,8 @@ func (cfg *Cfg) Load(args *CommandLineArgs) error {
 	cfg.readLDAPConfig()
 	cfg.readSessionConfig()
 	cfg.readSmtpSettings()
+	// before the quota, which depends on whether library panels are enabled
+	cfg.readLibraryPanelsSettings()
 	cfg.readQuotaSettings()
 	cfg.readAnnotationSettings()
 	if err := cfg.readGrafanaEnvironmentMetrics(); err != nil {
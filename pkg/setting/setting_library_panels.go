@@ -0,0 +1,148 @@
+package setting
+
+import (
+	"strings"
+	"time"
+
+	"github.com/grafana/grafana/pkg/util"
+)
+
+// LibraryPanelsSettings are the settings of the [library_panels] section.
+type LibraryPanelsSettings struct {
+	// Enabled enables library panels like the panelLibrary feature toggle.
+	Enabled bool
+	// MaxPanelsPerOrg is the maximum number of library panels in an org, 0 means unlimited. Unlike the
+	// library_panel quota it can't be changed per org.
+	MaxPanelsPerOrg int64
+	// QuotaWarningThreshold is the percentage of the library panel quota or MaxPanelsPerOrg of an org above which
+	// its admins are notified, 0 disables the warnings.
+	QuotaWarningThreshold int64
+	// MaxDashboardsPerPanel is the maximum number of dashboards a library panel can be connected to, 0 means
+	// unlimited.
+	MaxDashboardsPerPanel int64
+	// MaxConnectionsPerDashboard is the maximum number of library panel connections of a dashboard, one for each
+	// panel that uses a library panel, 0 means unlimited.
+	MaxConnectionsPerDashboard int64
+	// AllowedPanelTypes are the panel types that library panels can have, empty means all installed panels.
+	AllowedPanelTypes []string
+	// MaxModelSize is the maximum size in bytes of a library panel model, 0 means unlimited.
+	MaxModelSize int64
+	// StrictLinting rejects library panel models with lint warnings when they are saved, instead of only
+	// reporting the warnings from the validate endpoint.
+	StrictLinting bool
+	// RejectMissingReferences rejects saving dashboards with panels that reference library panels that don't
+	// exist, instead of only warning about them in the response.
+	RejectMissingReferences bool
+	// ApprovalThreshold is the number of connected dashboards above which changes to a library panel model
+	// must be approved, 0 means changes are never held for approval.
+	ApprovalThreshold int64
+	// FallbackAuthor is the login of the user that library panels of deleted users are reassigned to.
+	FallbackAuthor string
+	// AutoPropagate enables updating the stored JSON of connected dashboards when a library panel is updated.
+	AutoPropagate bool
+	// ChangeEmails enables emailing the owners of connected dashboards when a library panel changes.
+	ChangeEmails bool
+	// UserRateLimit is the number of library panel changes a user can make per minute, 0 means unlimited.
+	UserRateLimit int64
+	// OrgRateLimit is the number of library panel changes an org can make per minute, 0 means unlimited.
+	OrgRateLimit int64
+	// CacheTTL is how long Grafana servers cache the library panels that dashboards are loaded with, 0 disables
+	// the cache.
+	CacheTTL time.Duration
+
+	// ThumbnailsEnabled enables rendering thumbnails of library panels in the background, with the image renderer.
+	ThumbnailsEnabled bool
+
+	// CleanupEnabled enables the scheduled cleanup of unused library panels for the orgs that opted in.
+	CleanupEnabled bool
+	// CleanupInterval is how often the scheduled cleanup runs.
+	CleanupInterval time.Duration
+	// CleanupOlderThanDays is the number of days of the cleanup policy of orgs that didn't set one.
+	CleanupOlderThanDays int64
+
+	// BackupEnabled enables the scheduled backups of the library panels of all orgs.
+	BackupEnabled bool
+	// BackupInterval is how often the library panels are backed up.
+	BackupInterval time.Duration
+	// BackupRetention is the number of backups that are kept, older backups are deleted.
+	BackupRetention int64
+	// BackupPath is the directory the backups are stored in, or the key prefix of the backups in the S3 bucket.
+	BackupPath string
+	// BackupS3Bucket, if set, stores the backups in an S3-compatible bucket instead of a local directory.
+	BackupS3Bucket          string
+	BackupS3Region          string
+	BackupS3Endpoint        string
+	BackupS3AccessKey       string
+	BackupS3SecretKey       string
+	BackupS3PathStyleAccess bool
+
+	// VersionsToKeep is the number of versions of each library query that are kept, 0 means all versions.
+	VersionsToKeep int64
+	// VersionMaxAgeDays is the number of days versions of library queries are kept, 0 means forever. The latest
+	// version of a library query is always kept.
+	VersionMaxAgeDays int64
+
+	// ModelCompression is the compression of the stored models, gzip or empty for none.
+	ModelCompression string
+
+	// CommunityRegistryURL is the API of the registry that community-published Library Panels are browsed and
+	// installed from.
+	CommunityRegistryURL string
+}
+
+func (cfg *Cfg) readLibraryPanelsSettings() {
+	sec := cfg.Raw.Section("library_panels")
+	cfg.LibraryPanels.Enabled = sec.Key("enabled").MustBool(false)
+	cfg.LibraryPanels.MaxPanelsPerOrg = sec.Key("max_panels_per_org").MustInt64(0)
+	cfg.LibraryPanels.QuotaWarningThreshold = sec.Key("quota_warning_threshold").MustInt64(80)
+	if cfg.LibraryPanels.QuotaWarningThreshold < 0 || cfg.LibraryPanels.QuotaWarningThreshold >= 100 {
+		cfg.LibraryPanels.QuotaWarningThreshold = 0
+	}
+	cfg.LibraryPanels.MaxDashboardsPerPanel = sec.Key("max_dashboards_per_panel").MustInt64(0)
+	cfg.LibraryPanels.MaxConnectionsPerDashboard = sec.Key("max_connections_per_dashboard").MustInt64(0)
+	cfg.LibraryPanels.AllowedPanelTypes = util.SplitString(valueAsString(sec, "allowed_panel_types", ""))
+	cfg.LibraryPanels.MaxModelSize = sec.Key("max_model_size").MustInt64(1048576)
+	cfg.LibraryPanels.StrictLinting = sec.Key("strict_linting").MustBool(false)
+	cfg.LibraryPanels.RejectMissingReferences = sec.Key("reject_missing_references").MustBool(false)
+	cfg.LibraryPanels.ApprovalThreshold = sec.Key("approval_threshold").MustInt64(0)
+	cfg.LibraryPanels.FallbackAuthor = valueAsString(sec, "fallback_author", "")
+	cfg.LibraryPanels.AutoPropagate = sec.Key("auto_propagate").MustBool(false)
+	cfg.LibraryPanels.ChangeEmails = sec.Key("change_emails").MustBool(false)
+	cfg.LibraryPanels.UserRateLimit = sec.Key("user_rate_limit").MustInt64(0)
+	cfg.LibraryPanels.OrgRateLimit = sec.Key("org_rate_limit").MustInt64(0)
+	cfg.LibraryPanels.CacheTTL = sec.Key("cache_ttl").MustDuration(0)
+	cfg.LibraryPanels.ThumbnailsEnabled = sec.Key("thumbnails_enabled").MustBool(false)
+
+	cfg.LibraryPanels.CleanupEnabled = sec.Key("cleanup_enabled").MustBool(true)
+	cfg.LibraryPanels.CleanupInterval = sec.Key("cleanup_interval").MustDuration(time.Hour)
+	if cfg.LibraryPanels.CleanupInterval <= 0 {
+		cfg.LibraryPanels.CleanupInterval = time.Hour
+	}
+	cfg.LibraryPanels.CleanupOlderThanDays = sec.Key("cleanup_older_than_days").MustInt64(90)
+
+	cfg.LibraryPanels.BackupEnabled = sec.Key("backup_enabled").MustBool(false)
+	cfg.LibraryPanels.BackupInterval = sec.Key("backup_interval").MustDuration(24 * time.Hour)
+	if cfg.LibraryPanels.BackupInterval <= 0 {
+		cfg.LibraryPanels.BackupInterval = 24 * time.Hour
+	}
+	cfg.LibraryPanels.BackupRetention = sec.Key("backup_retention").MustInt64(7)
+	cfg.LibraryPanels.BackupPath = valueAsString(sec, "backup_path", "")
+	cfg.LibraryPanels.BackupS3Bucket = valueAsString(sec, "backup_s3_bucket", "")
+	cfg.LibraryPanels.BackupS3Region = valueAsString(sec, "backup_s3_region", "")
+	cfg.LibraryPanels.BackupS3Endpoint = valueAsString(sec, "backup_s3_endpoint", "")
+	cfg.LibraryPanels.BackupS3AccessKey = valueAsString(sec, "backup_s3_access_key", "")
+	cfg.LibraryPanels.BackupS3SecretKey = valueAsString(sec, "backup_s3_secret_key", "")
+	cfg.LibraryPanels.BackupS3PathStyleAccess = sec.Key("backup_s3_path_style_access").MustBool(false)
+
+	cfg.LibraryPanels.VersionsToKeep = sec.Key("versions_to_keep").MustInt64(20)
+	cfg.LibraryPanels.VersionMaxAgeDays = sec.Key("version_max_age_days").MustInt64(0)
+
+	cfg.LibraryPanels.ModelCompression = valueAsString(sec, "model_compression", "")
+	cfg.LibraryPanels.CommunityRegistryURL = strings.TrimSuffix(valueAsString(sec, "community_registry_url",
+		"https://grafana.com/api/library-panels"), "/")
+
+	// the frontend only knows the feature toggle
+	if cfg.LibraryPanels.Enabled {
+		cfg.FeatureToggles["panelLibrary"] = true
+	}
+}
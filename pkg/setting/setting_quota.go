@@ -4,46 +4,65 @@ import (
 	"reflect"
 )
 
+// featureQuotaTargets are quota targets that belong to features behind a feature toggle.
+// They are only reported once the feature is enabled, since their tables may not exist otherwise.
+var featureQuotaTargets = map[string]bool{
+	"library_panel": true,
+}
+
 type OrgQuota struct {
-	User       int64 `target:"org_user"`
-	DataSource int64 `target:"data_source"`
-	Dashboard  int64 `target:"dashboard"`
-	ApiKey     int64 `target:"api_key"`
+	User         int64 `target:"org_user"`
+	DataSource   int64 `target:"data_source"`
+	Dashboard    int64 `target:"dashboard"`
+	ApiKey       int64 `target:"api_key"`
+	LibraryPanel int64 `target:"library_panel"`
+
+	// enabledFeatureTargets are the targets of enabled features, see featureQuotaTargets.
+	enabledFeatureTargets map[string]bool
 }
 
 type UserQuota struct {
-	Org int64 `target:"org_user"`
+	Org          int64 `target:"org_user"`
+	LibraryPanel int64 `target:"library_panel"`
+
+	// enabledFeatureTargets are the targets of enabled features, see featureQuotaTargets.
+	enabledFeatureTargets map[string]bool
 }
 
 type GlobalQuota struct {
-	Org        int64 `target:"org"`
-	User       int64 `target:"user"`
-	DataSource int64 `target:"data_source"`
-	Dashboard  int64 `target:"dashboard"`
-	ApiKey     int64 `target:"api_key"`
-	Session    int64 `target:"-"`
+	Org          int64 `target:"org"`
+	User         int64 `target:"user"`
+	DataSource   int64 `target:"data_source"`
+	Dashboard    int64 `target:"dashboard"`
+	ApiKey       int64 `target:"api_key"`
+	Session      int64 `target:"-"`
+	LibraryPanel int64 `target:"library_panel"`
 }
 
 func (q *OrgQuota) ToMap() map[string]int64 {
-	return quotaToMap(*q)
+	return quotaToMap(*q, q.enabledFeatureTargets)
 }
 
 func (q *UserQuota) ToMap() map[string]int64 {
-	return quotaToMap(*q)
+	return quotaToMap(*q, q.enabledFeatureTargets)
 }
 
-func quotaToMap(q interface{}) map[string]int64 {
+func quotaToMap(q interface{}, enabledFeatureTargets map[string]bool) map[string]int64 {
 	qMap := make(map[string]int64)
 	typ := reflect.TypeOf(q)
 	val := reflect.ValueOf(q)
 
 	for i := 0; i < typ.NumField(); i++ {
 		field := typ.Field(i)
+		if field.PkgPath != "" {
+			// unexported
+			continue
+		}
 		name := field.Tag.Get("target")
 		if name == "" {
 			name = field.Name
 		}
-		if name == "-" {
+		if name == "-" || (featureQuotaTargets[name] && !enabledFeatureTargets[name]) {
 			continue
 		}
 		value := val.Field(i)
@@ -64,27 +83,36 @@ func (cfg *Cfg) readQuotaSettings() {
 	quota := cfg.Raw.Section("quota")
 	Quota.Enabled = quota.Key("enabled").MustBool(false)
 
+	enabledFeatureTargets := map[string]bool{
+		"library_panel": cfg.IsPanelLibraryEnabled(),
+	}
+
 	// per ORG Limits
 	Quota.Org = &OrgQuota{
-		User:       quota.Key("org_user").MustInt64(10),
-		DataSource: quota.Key("org_data_source").MustInt64(10),
-		Dashboard:  quota.Key("org_dashboard").MustInt64(10),
-		ApiKey:     quota.Key("org_api_key").MustInt64(10),
+		User:                  quota.Key("org_user").MustInt64(10),
+		DataSource:            quota.Key("org_data_source").MustInt64(10),
+		Dashboard:             quota.Key("org_dashboard").MustInt64(10),
+		ApiKey:                quota.Key("org_api_key").MustInt64(10),
+		LibraryPanel:          quota.Key("org_library_panel").MustInt64(100),
+		enabledFeatureTargets: enabledFeatureTargets,
 	}
 
 	// per User limits
 	Quota.User = &UserQuota{
-		Org: quota.Key("user_org").MustInt64(10),
+		Org:                   quota.Key("user_org").MustInt64(10),
+		LibraryPanel:          quota.Key("user_library_panel").MustInt64(-1),
+		enabledFeatureTargets: enabledFeatureTargets,
 	}
 
 	// Global Limits
 	Quota.Global = &GlobalQuota{
-		User:       quota.Key("global_user").MustInt64(-1),
-		Org:        quota.Key("global_org").MustInt64(-1),
-		DataSource: quota.Key("global_data_source").MustInt64(-1),
-		Dashboard:  quota.Key("global_dashboard").MustInt64(-1),
-		ApiKey:     quota.Key("global_api_key").MustInt64(-1),
-		Session:    quota.Key("global_session").MustInt64(-1),
+		User:         quota.Key("global_user").MustInt64(-1),
+		Org:          quota.Key("global_org").MustInt64(-1),
+		DataSource:   quota.Key("global_data_source").MustInt64(-1),
+		Dashboard:    quota.Key("global_dashboard").MustInt64(-1),
+		ApiKey:       quota.Key("global_api_key").MustInt64(-1),
+		Session:      quota.Key("global_session").MustInt64(-1),
+		LibraryPanel: quota.Key("global_library_panel").MustInt64(-1),
 	}
 
 	cfg.Quota = Quota
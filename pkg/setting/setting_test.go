@@ -389,3 +389,57 @@ func TestAuthDurationSettings(t *testing.T) {
 	require.NoError(t, err)
 	require.Equal(t, maxLifetimeDurationTest, cfg.LoginMaxLifetime)
 }
+
+func TestLibraryPanelsSettings(t *testing.T) {
+	cfg := NewCfg()
+	cfg.FeatureToggles = map[string]bool{}
+	cfg.readLibraryPanelsSettings()
+	require.False(t, cfg.IsPanelLibraryEnabled())
+	require.Empty(t, cfg.LibraryPanels.AllowedPanelTypes)
+	require.Equal(t, int64(1048576), cfg.LibraryPanels.MaxModelSize)
+	require.Equal(t, int64(80), cfg.LibraryPanels.QuotaWarningThreshold)
+	require.Zero(t, cfg.LibraryPanels.MaxDashboardsPerPanel)
+	require.Zero(t, cfg.LibraryPanels.MaxConnectionsPerDashboard)
+	require.Zero(t, cfg.LibraryPanels.CacheTTL)
+	require.False(t, cfg.LibraryPanels.RejectMissingReferences)
+	require.True(t, cfg.LibraryPanels.CleanupEnabled)
+	require.Equal(t, time.Hour, cfg.LibraryPanels.CleanupInterval)
+	require.Equal(t, int64(90), cfg.LibraryPanels.CleanupOlderThanDays)
+	require.False(t, cfg.LibraryPanels.BackupEnabled)
+	require.Equal(t, 24*time.Hour, cfg.LibraryPanels.BackupInterval)
+	require.Equal(t, int64(7), cfg.LibraryPanels.BackupRetention)
+	require.Equal(t, int64(20), cfg.LibraryPanels.VersionsToKeep)
+	require.Zero(t, cfg.LibraryPanels.VersionMaxAgeDays)
+	require.Empty(t, cfg.LibraryPanels.ModelCompression)
+	require.Equal(t, "https://grafana.com/api/library-panels", cfg.LibraryPanels.CommunityRegistryURL)
+
+	f := ini.Empty()
+	sec, err := f.NewSection("library_panels")
+	require.NoError(t, err)
+	for key, value := range map[string]string{
+		"enabled":                       "true",
+		"allowed_panel_types":           "graph, stat",
+		"max_panels_per_org":            "500",
+		"quota_warning_threshold":       "100",
+		"max_dashboards_per_panel":      "1000",
+		"max_connections_per_dashboard": "50",
+		"cleanup_interval":              "6h",
+		"reject_missing_references":     "true",
+		"version_max_age_days":          "90",
+	} {
+		_, err = sec.NewKey(key, value)
+		require.NoError(t, err)
+	}
+	cfg.Raw = f
+	cfg.readLibraryPanelsSettings()
+	require.True(t, cfg.IsPanelLibraryEnabled())
+	require.True(t, cfg.FeatureToggles["panelLibrary"])
+	require.Equal(t, []string{"graph", "stat"}, cfg.LibraryPanels.AllowedPanelTypes)
+	require.Equal(t, int64(500), cfg.LibraryPanels.MaxPanelsPerOrg)
+	require.Zero(t, cfg.LibraryPanels.QuotaWarningThreshold)
+	require.Equal(t, int64(1000), cfg.LibraryPanels.MaxDashboardsPerPanel)
+	require.Equal(t, int64(50), cfg.LibraryPanels.MaxConnectionsPerDashboard)
+	require.Equal(t, 6*time.Hour, cfg.LibraryPanels.CleanupInterval)
+	require.True(t, cfg.LibraryPanels.RejectMissingReferences)
+	require.Equal(t, int64(90), cfg.LibraryPanels.VersionMaxAgeDays)
+}
@@ -28,6 +28,7 @@ export interface State {
   homeDashboardId: number;
   theme: string;
   timezone: string;
+  libraryPanelFolderId: number;
   dashboards: DashboardSearchHit[];
 }
 
@@ -47,6 +48,7 @@ export class SharedPreferences extends PureComponent<Props, State> {
       homeDashboardId: 0,
       theme: '',
       timezone: '',
+      libraryPanelFolderId: 0,
       dashboards: [],
     };
   }
@@ -82,17 +84,19 @@ export class SharedPreferences extends PureComponent<Props, State> {
       homeDashboardId: prefs.homeDashboardId,
       theme: prefs.theme,
       timezone: prefs.timezone,
+      libraryPanelFolderId: prefs.libraryPanelFolderId,
       dashboards: [defaultDashboardHit, ...dashboards],
     });
   }
 
   onSubmitForm = async () => {
-    const { homeDashboardId, theme, timezone } = this.state;
+    const { homeDashboardId, theme, timezone, libraryPanelFolderId } = this.state;
 
     await backendSrv.put(`/api/${this.props.resourceUri}/preferences`, {
       homeDashboardId,
       theme,
       timezone,
+      libraryPanelFolderId,
     });
     window.location.reload();
   };